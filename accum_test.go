@@ -14,8 +14,6 @@ import (
 	"github.com/grailbio/bigslice/sliceio"
 )
 
-var typeOfInt64 = reflect.TypeOf(int64(0))
-
 var accumulableTypes = []reflect.Type{typeOfString, typeOfInt, typeOfInt64}
 
 func TestAccumulator(t *testing.T) {
@@ -0,0 +1,140 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// AggregateByKey returns a slice that aggregates the values of each
+// key into an accumulator whose type may differ from the values'.
+// The keys are the slice's prefix columns; the remaining columns are
+// the values. Schematically:
+//
+//	AggregateByKey(Slice<k1, ..., kp, v1, ..., vn>,
+//		func(acc A, v1, ..., vn) A,
+//		func(acc1, acc2 A) A) Slice<k1, ..., kp, A>
+//
+// The add function adds a single row's values to an accumulator; it
+// is passed the zero value of the accumulator type for each row. The
+// merge function merges two accumulators of the same key; it must be
+// commutative and associative. Accumulators are merged with the same
+// combiner machinery that is used by Reduce: they are merged on the
+// map side, before they are shuffled, and again after. Thus, unlike
+// Fold, AggregateByKey does not shuffle every row, and may be used
+// with any key types that can be reduced.
+//
+// For example, the mean of float64 values by string key may be
+// computed by:
+//
+//	type mean struct{ Sum float64; N int }
+//	means := bigslice.AggregateByKey(slice,
+//		func(acc mean, v float64) mean { return mean{acc.Sum + v, acc.N + 1} },
+//		func(a, b mean) mean { return mean{a.Sum + b.Sum, a.N + b.N} })
+//
+// Accumulators may be shuffled, and thus must be gob-encodable.
+// Functions should not mutate the accumulators that they are passed,
+// as they may be shared.
+func AggregateByKey(slice Slice, add, merge interface{}) Slice {
+	if slice.NumOut() == slice.Prefix() {
+		typecheck.Panic(1, "aggregatebykey: slice must have at least one value column")
+	}
+	if err := canMakeCombiningFrame(slice); err != nil {
+		typecheck.Panic(1, err.Error())
+	}
+	arg, ret, ok := typecheck.Func(add)
+	if !ok {
+		typecheck.Panicf(1, "aggregatebykey: invalid add function %T", add)
+	}
+	if ret.NumOut() != 1 {
+		typecheck.Panicf(1, "aggregatebykey: add function must return exactly one value")
+	}
+	values := slicetype.Slice(slice, slice.Prefix(), slice.NumOut())
+	if !typecheck.Equal(arg, slicetype.Append(ret, values)) {
+		typecheck.Panicf(1, "aggregatebykey: expected add function func(acc, v1, ..., vn) acc, got %T", add)
+	}
+	acc := ret.Out(0)
+	arg, ret, ok = typecheck.Func(merge)
+	if !ok {
+		typecheck.Panicf(1, "aggregatebykey: invalid merge function %T", merge)
+	}
+	if arg.NumOut() != 2 || arg.Out(0) != acc || arg.Out(1) != acc || ret.NumOut() != 1 || ret.Out(0) != acc {
+		typecheck.Panicf(1, "aggregatebykey: invalid merge function %T, expected func(%s, %s) %s", merge, acc, acc, acc)
+	}
+	a := &aggregateSlice{
+		name:  MakeName("aggregatebykey_add"),
+		Slice: slice,
+		add:   slicefunc.Of(add),
+		out:   slicetype.Append(slicetype.Slice(slice, 0, slice.Prefix()), ret),
+	}
+	return &reduceSlice{a, MakeName("aggregatebykey"), slicefunc.Of(merge)}
+}
+
+// AggregateSlice adds the values of each row to a zero accumulator,
+// producing rows of keys and accumulators that are reduced by merging
+// the accumulators.
+type aggregateSlice struct {
+	name Name
+	Slice
+	add slicefunc.Func
+	out slicetype.Type
+}
+
+func (a *aggregateSlice) Name() Name             { return a.name }
+func (a *aggregateSlice) NumOut() int            { return a.out.NumOut() }
+func (a *aggregateSlice) Out(c int) reflect.Type { return a.out.Out(c) }
+func (*aggregateSlice) NumDep() int              { return 1 }
+func (a *aggregateSlice) Dep(i int) Dep          { return singleDep(i, a.Slice, false) }
+func (*aggregateSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (a *aggregateSlice) MaxRows() int           { return maxRows(a.Slice) }
+
+func (a *aggregateSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &aggregateReader{op: a, reader: deps[0]}
+}
+
+type aggregateReader struct {
+	op     *aggregateSlice
+	reader sliceio.Reader
+	in     frame.Frame
+	err    error
+}
+
+func (r *aggregateReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	n := out.Len()
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, n, n)
+	} else {
+		r.in = r.in.Ensure(n)
+	}
+	n, r.err = r.reader.Read(ctx, r.in.Slice(0, n))
+	var (
+		prefix = r.op.Slice.Prefix()
+		cols   = r.in.Values()
+		args   = make([]reflect.Value, 1+len(cols)-prefix)
+		zero   = reflect.Zero(r.op.out.Out(prefix))
+	)
+	frame.Copy(frame.Values(out.Values()[:prefix]).Slice(0, n), frame.Values(cols[:prefix]).Slice(0, n))
+	for i := 0; i < n; i++ {
+		args[0] = zero
+		for j := prefix; j < len(cols); j++ {
+			args[1+j-prefix] = r.in.Index(j, i)
+		}
+		out.Index(prefix, i).Set(r.op.add.Call(ctx, args)[0])
+	}
+	return n, r.err
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+type meanAcc struct {
+	Sum float64
+	N   int
+}
+
+func TestAggregateByKey(t *testing.T) {
+	const N = 1000
+	var (
+		keys = make([]string, N)
+		vals = make([]float64, N)
+	)
+	for i := range keys {
+		keys[i] = []string{"a", "b", "c"}[i%3]
+		vals[i] = float64(i % 3)
+	}
+	slice := bigslice.Const(7, keys, vals)
+	slice = bigslice.AggregateByKey(slice,
+		func(acc meanAcc, v float64) meanAcc { return meanAcc{acc.Sum + v, acc.N + 1} },
+		func(a, b meanAcc) meanAcc { return meanAcc{a.Sum + b.Sum, a.N + b.N} })
+	assertEqual(t, slice, true,
+		[]string{"a", "b", "c"},
+		[]meanAcc{{0, 334}, {333, 333}, {666, 333}})
+
+	// Keys may span multiple columns, and rows may have multiple values.
+	slice = bigslice.Const(3,
+		[]string{"x", "x", "y", "x", "y"},
+		[]int{1, 2, 1, 1, 1},
+		[]string{"p", "q", "r", "s", "t"},
+		[]int{1, 2, 3, 4, 5})
+	slice = bigslice.Prefixed(slice, 2)
+	slice = bigslice.AggregateByKey(slice,
+		func(acc []string, s string, n int) []string {
+			for i := 0; i < n; i++ {
+				acc = append(acc, s)
+			}
+			return acc
+		},
+		func(a, b []string) []string {
+			return append(append([]string{}, a...), b...)
+		})
+	slice = bigslice.Map(slice, func(key string, n int, acc []string) (string, int, int) { return key, n, len(acc) })
+	assertEqual(t, slice, true,
+		[]string{"x", "x", "y"},
+		[]int{1, 2, 1},
+		[]int{5, 2, 8})
+}
+
+func TestAggregateByKeyError(t *testing.T) {
+	var (
+		slice = bigslice.Const(1, []string{"a"}, []int{1})
+		add   = func(acc int64, v int) int64 { return acc + int64(v) }
+		merge = func(a, b int64) int64 { return a + b }
+	)
+	expectTypeError(t, "aggregatebykey: slice must have at least one value column", func() {
+		bigslice.AggregateByKey(bigslice.Const(1, []string{"a"}), add, merge)
+	})
+	expectTypeError(t, "aggregatebykey: invalid add function int", func() { bigslice.AggregateByKey(slice, 1, merge) })
+	expectTypeError(t, "aggregatebykey: expected add function func(acc, v1, ..., vn) acc, got func(int64, string) int64", func() {
+		bigslice.AggregateByKey(slice, func(acc int64, v string) int64 { return acc }, merge)
+	})
+	expectTypeError(t, "aggregatebykey: invalid merge function func(int, int) int, expected func(int64, int64) int64", func() {
+		bigslice.AggregateByKey(slice, add, func(a, b int) int { return a + b })
+	})
+}
@@ -0,0 +1,319 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicestats"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+const (
+	// approxTopKWidth and approxTopKDepth are the dimensions of the
+	// count-min sketches of ApproxTopK: counts are overestimated by at
+	// most about 0.07% of the total, with probability 99.3%.
+	approxTopKWidth = 4096
+	approxTopKDepth = 5
+	// approxTopKSlack is the factor by which the number of candidates
+	// kept by each shard exceeds k, so that values that are frequent
+	// overall, but less so in some shards, are not missed.
+	approxTopKSlack = 4
+)
+
+var (
+	typeOfInt64      = reflect.TypeOf(int64(0))
+	typeOfTopKSketch = reflect.TypeOf(topKSketch{})
+)
+
+// ApproxTopK returns a single-shard slice that contains approximately
+// the k most frequent values of the provided single-column slice, in
+// descending order of frequency, each with its estimated frequency.
+// Schematically:
+//
+//	ApproxTopK(Slice<v>, k) Slice<v, int64>
+//
+// Frequencies are estimated by count-min sketches (see
+// slicestats.CountMin), which overestimate frequencies by at most
+// about 0.07% of the number of rows. Each shard keeps a sketch of its
+// values, and the values that are most frequent according to it; the
+// shards' sketches and candidate values are merged by a single
+// reducer, so that heavy hitters are found among very many distinct
+// values without shuffling each of them.
+func ApproxTopK(slice Slice, k int) Slice {
+	if k <= 0 {
+		typecheck.Panicf(1, "approxtopk: k must be positive, got %d", k)
+	}
+	if slice.NumOut() != 1 {
+		typecheck.Panicf(1, "approxtopk: slice %s must have exactly one column", slicetype.String(slice))
+	}
+	typ := slice.Out(0)
+	if !frame.CanHash(typ) {
+		typecheck.Panicf(1, "approxtopk: value type %s cannot be hashed", typ)
+	}
+	if typ.Kind() != reflect.Interface {
+		// Candidate values are carried in sketches as interface values.
+		gob.Register(reflect.Zero(typ).Interface())
+	}
+	name := MakeName(fmt.Sprintf("approxtopk(%d)", k))
+	shards := &approxTopKSlice{name, slice, k, false}
+	return &approxTopKSlice{name, shards, k, true}
+}
+
+// A topKSketch is a count-min sketch of the values of a shard, and the
+// values that are most frequent according to it.
+type topKSketch struct {
+	CountMin   slicestats.CountMin
+	Candidates []topKCandidate
+}
+
+// A topKCandidate is a value, its hash, and its estimated frequency.
+type topKCandidate struct {
+	Value interface{}
+	Hash  uint64
+	Count int64
+}
+
+// An approxTopKSlice emits a topKSketch of each shard of its
+// dependency, keyed by a constant. If merge is true, the dependency,
+// itself an approxTopKSlice, is shuffled to a single shard, which
+// emits the k most frequent values of the merged sketches.
+type approxTopKSlice struct {
+	name Name
+	Slice
+	k     int
+	merge bool
+}
+
+func (a *approxTopKSlice) Name() Name             { return a.name }
+func (*approxTopKSlice) NumOut() int              { return 2 }
+func (*approxTopKSlice) Prefix() int              { return 1 }
+func (*approxTopKSlice) NumDep() int              { return 1 }
+func (a *approxTopKSlice) Dep(i int) Dep          { return singleDep(i, a.Slice, a.merge) }
+func (*approxTopKSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (a *approxTopKSlice) Out(c int) reflect.Type {
+	switch {
+	case a.merge && c == 0:
+		return a.Slice.(*approxTopKSlice).Slice.Out(0)
+	case a.merge:
+		return typeOfInt64
+	case c == 0:
+		return typeOfInt
+	default:
+		return typeOfTopKSketch
+	}
+}
+
+func (a *approxTopKSlice) NumShard() int {
+	if a.merge {
+		return 1
+	}
+	return a.Slice.NumShard()
+}
+
+func (a *approxTopKSlice) ShardType() ShardType {
+	if a.merge {
+		return HashShard
+	}
+	return a.Slice.ShardType()
+}
+
+// MaxRows implements Sizer.
+func (a *approxTopKSlice) MaxRows() int {
+	if a.merge {
+		return a.k
+	}
+	return a.Slice.NumShard()
+}
+
+func (a *approxTopKSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &approxTopKReader{op: a, reader: deps[0]}
+}
+
+type approxTopKReader struct {
+	op     *approxTopKSlice
+	reader sliceio.Reader
+	err    error
+	// rows holds the rows that are emitted once the dependency has been
+	// read, which is done if read is true; off is the offset of the
+	// next row to be emitted.
+	rows frame.Frame
+	read bool
+	off  int
+}
+
+func (r *approxTopKReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if !r.read {
+		r.read = true
+		if r.op.merge {
+			r.err = r.mergeSketches(ctx)
+		} else {
+			r.err = r.sketch(ctx)
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+	n := frame.Copy(out, r.rows.Slice(r.off, r.rows.Len()))
+	r.off += n
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// sketch computes the sketch of the shard.
+func (r *approxTopKReader) sketch(ctx context.Context) error {
+	const bufferSize = 1024
+	var (
+		cms = slicestats.NewCountMin(approxTopKWidth, approxTopKDepth)
+		top = newTopKCandidates(approxTopKSlack * r.op.k)
+		in  = frame.Make(r.op.Slice, bufferSize, bufferSize)
+	)
+	for {
+		n, err := r.reader.Read(ctx, in)
+		for i := 0; i < n; i++ {
+			h := hashValue(in, i)
+			cms.Add(h, 1)
+			top.add(in.Index(0, i).Interface(), h, cms.Count(h))
+		}
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.rows = frame.Make(r.op, 1, 1)
+	r.rows.Index(1, 0).Set(reflect.ValueOf(topKSketch{*cms, top.candidates()}))
+	return nil
+}
+
+// mergeSketches merges the sketches of every shard, and computes the
+// k most frequent of their candidates.
+func (r *approxTopKReader) mergeSketches(ctx context.Context) error {
+	var (
+		cms        = slicestats.NewCountMin(approxTopKWidth, approxTopKDepth)
+		candidates = make(map[uint64]topKCandidate)
+		in         = frame.Make(r.op.Slice, 1, 1)
+	)
+	for {
+		n, err := r.reader.Read(ctx, in)
+		if n > 0 {
+			sketch := in.Index(1, 0).Interface().(topKSketch)
+			cms.MergeFrom(&sketch.CountMin)
+			for _, c := range sketch.Candidates {
+				candidates[c.Hash] = c
+			}
+		}
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	top := newTopKCandidates(r.op.k)
+	for h, c := range candidates {
+		top.add(c.Value, h, cms.Count(h))
+	}
+	sorted := top.candidates()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Count > sorted[j].Count })
+	r.rows = frame.Make(r.op, len(sorted), len(sorted))
+	for i, c := range sorted {
+		if c.Value != nil {
+			r.rows.Index(0, i).Set(reflect.ValueOf(c.Value))
+		}
+		r.rows.Index(1, i).SetInt(c.Count)
+	}
+	return nil
+}
+
+// hashValue returns the 64-bit hash of row i of the single-column
+// frame f, composed of two 32-bit frame hashes with distinct seeds.
+func hashValue(f frame.Frame, i int) uint64 {
+	return uint64(f.HashWithSeed(i, 0x9e3779b9))<<32 | uint64(f.HashWithSeed(i, 0x85ebca6b))
+}
+
+// topKCandidates keeps the candidates with the largest estimated
+// counts, up to a capacity, in a min-heap.
+type topKCandidates struct {
+	capacity int
+	heap     []*topKCandidate
+	index    map[uint64]int
+}
+
+func newTopKCandidates(capacity int) *topKCandidates {
+	return &topKCandidates{capacity: capacity, index: make(map[uint64]int)}
+}
+
+// add considers the value with the provided hash and estimated count
+// for inclusion, updating its count if it is already included.
+func (t *topKCandidates) add(value interface{}, h uint64, count int64) {
+	if i, ok := t.index[h]; ok {
+		t.heap[i].Count = count
+		heap.Fix(t, i)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		heap.Push(t, &topKCandidate{value, h, count})
+		return
+	}
+	if min := t.heap[0]; count > min.Count {
+		delete(t.index, min.Hash)
+		*min = topKCandidate{value, h, count}
+		t.index[h] = 0
+		heap.Fix(t, 0)
+	}
+}
+
+func (t *topKCandidates) candidates() []topKCandidate {
+	candidates := make([]topKCandidate, len(t.heap))
+	for i, c := range t.heap {
+		candidates[i] = *c
+	}
+	return candidates
+}
+
+// Len, Less, Swap, Push, and Pop implement heap.Interface, so that the
+// candidate with the smallest count is at the root.
+
+func (t *topKCandidates) Len() int           { return len(t.heap) }
+func (t *topKCandidates) Less(i, j int) bool { return t.heap[i].Count < t.heap[j].Count }
+
+func (t *topKCandidates) Swap(i, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+	t.index[t.heap[i].Hash] = i
+	t.index[t.heap[j].Hash] = j
+}
+
+func (t *topKCandidates) Push(x interface{}) {
+	c := x.(*topKCandidate)
+	t.index[c.Hash] = len(t.heap)
+	t.heap = append(t.heap, c)
+}
+
+func (t *topKCandidates) Pop() interface{} {
+	c := t.heap[len(t.heap)-1]
+	t.heap = t.heap[:len(t.heap)-1]
+	delete(t.index, c.Hash)
+	return c
+}
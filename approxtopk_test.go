@@ -0,0 +1,68 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestApproxTopK(t *testing.T) {
+	const (
+		N      = 100000
+		Nheavy = 5
+	)
+	var (
+		r      = rand.New(rand.NewSource(1))
+		values = make([]string, N)
+	)
+	// Heavy hitter i occurs 5000*(Nheavy-i) times; the remaining rows are
+	// nearly all distinct.
+	var i int
+	for h := 0; h < Nheavy; h++ {
+		for j := 0; j < 5000*(Nheavy-h); j++ {
+			values[i] = fmt.Sprint("heavy", h)
+			i++
+		}
+	}
+	for ; i < N; i++ {
+		values[i] = fmt.Sprint("light", r.Intn(N))
+	}
+	r.Shuffle(N, func(i, j int) { values[i], values[j] = values[j], values[i] })
+	for nshard := 1; nshard < 8; nshard += 3 {
+		slice := bigslice.ApproxTopK(bigslice.Const(nshard, values), Nheavy)
+		var (
+			top    []string
+			counts []int64
+		)
+		slicetest.RunAndScan(t, slice, &top, &counts)
+		if got, want := len(top), Nheavy; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for h := range top {
+			if got, want := top[h], fmt.Sprint("heavy", h); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			// Counts are overestimated by at most about 0.07% of N.
+			if got, want := counts[h], int64(5000*(Nheavy-h)); got < want || got > want+N/1000 {
+				t.Errorf("%s: got %v, want about %v", top[h], got, want)
+			}
+		}
+	}
+}
+
+func TestApproxTopKError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "approxtopk: slice slice[1]string,int must have exactly one column", func() {
+		bigslice.ApproxTopK(input, 1)
+	})
+	expectTypeError(t, "approxtopk: k must be positive, got 0", func() {
+		bigslice.ApproxTopK(input, 0)
+	})
+}
@@ -0,0 +1,482 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package cacheslice implements a bigslice sink that publishes (key,
+// value) rows to serving caches: Redis or memcached servers. Values
+// are written with pipelined batches of commands over a configurable
+// number of connections per server.
+//
+// Computed values, e.g., features, are typically published with a
+// two-phase swap: each computation writes its values to a staging
+// keyspace, named by a version, and the version is published with
+// Flip only once the whole computation has succeeded. Readers look up
+// the current version (see Current) and read keys from its keyspace,
+// so that they never observe a partially written result. Older
+// versions are not deleted; they should be given a TTL that outlives
+// their tenure.
+package cacheslice
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+	"golang.org/x/sync/errgroup"
+)
+
+// Protocol is the protocol spoken by cache servers.
+type Protocol int
+
+const (
+	// Redis is the Redis serialization protocol (RESP). Values are
+	// written with SET commands.
+	Redis Protocol = iota
+	// Memcached is the memcached text protocol. Values are written with
+	// set commands.
+	Memcached
+)
+
+// String returns the name of the protocol p.
+func (p Protocol) String() string {
+	switch p {
+	case Redis:
+		return "redis"
+	case Memcached:
+		return "memcached"
+	default:
+		return fmt.Sprintf("Protocol(%d)", int(p))
+	}
+}
+
+const (
+	// DefaultBatchSize is the default number of commands that are
+	// pipelined in a batch.
+	DefaultBatchSize = 256
+	// DefaultConcurrency is the default number of connections that each
+	// shard makes to each server.
+	DefaultConcurrency = 2
+	// DefaultTimeout is the default timeout for writing a batch to a
+	// server and reading its replies.
+	DefaultTimeout = time.Minute
+)
+
+// Options configures the writing of values to cache servers.
+type Options struct {
+	// Protocol is the protocol spoken by the servers.
+	Protocol Protocol
+	// Addrs holds the addresses (host:port) of the servers. Keys are
+	// distributed among servers by the CRC-32 (IEEE) checksum of the
+	// written key, modulo the number of servers; see Options.Addr.
+	// Redis servers are treated as independent instances, not as a
+	// cluster.
+	Addrs []string
+	// Prefix is prepended to every key that is written.
+	Prefix string
+	// Version, if not empty, is the version to whose staging keyspace
+	// values are written: the value of key is written to
+	// Prefix+Version+":"+key. The version is published by Flip.
+	Version string
+	// TTL is the amount of time after which written values expire. If
+	// zero, values do not expire. Memcached expiration times are
+	// rounded up to whole seconds.
+	TTL time.Duration
+	// BatchSize is the number of commands that are pipelined in each
+	// batch. If zero, DefaultBatchSize is used.
+	BatchSize int
+	// Concurrency is the number of connections that each shard makes to
+	// each server, i.e., the number of batches that each shard may have
+	// outstanding on each server. If zero, DefaultConcurrency is used.
+	Concurrency int
+	// Timeout is the timeout for writing a batch and reading its
+	// replies. If zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// Key returns the key to which the value of the provided key is
+// written.
+func (o Options) Key(key string) string {
+	if o.Version == "" {
+		return o.Prefix + key
+	}
+	return o.Prefix + o.Version + ":" + key
+}
+
+// CurrentKey returns the key that holds the current version, as
+// published by Flip. It is written to every server.
+func (o Options) CurrentKey() string {
+	return o.Prefix + "current"
+}
+
+// Addr returns the address of the server to which the value of the
+// provided key is written.
+func (o Options) Addr(key string) string {
+	return o.Addrs[o.server([]byte(o.Key(key)))]
+}
+
+// server returns the index of the server that holds the provided
+// (prefixed) key.
+func (o Options) server(key []byte) int {
+	return int(crc32.ChecksumIEEE(key) % uint32(len(o.Addrs)))
+}
+
+func (o Options) protocol() protocol {
+	if o.Protocol == Memcached {
+		return memcachedProtocol{}
+	}
+	return redisProtocol{}
+}
+
+var (
+	typeOfString       = reflect.TypeOf("")
+	typeOfBytes        = reflect.TypeOf([]byte(nil))
+	typeOfProtoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	typeOfError        = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Writer returns a slice that writes the rows of slice to the cache
+// servers configured by opts. The slice must have two columns: a key
+// column of type string or []byte, and a value column of type string,
+// []byte, or a type that implements proto.Message, in which case the
+// written value is the serialized protocol buffer message. The
+// returned slice passes through the rows of slice.
+//
+// A shard fails if any of its writes fail; writes of failed shards
+// are not rolled back, and so should be made to a staging keyspace.
+func Writer(slice bigslice.Slice, opts Options) bigslice.Slice {
+	bigslice.Helper()
+	if len(opts.Addrs) == 0 {
+		typecheck.Panicf(1, "cacheslice.Writer: no server addresses")
+	}
+	switch opts.Protocol {
+	case Redis, Memcached:
+	default:
+		typecheck.Panicf(1, "cacheslice.Writer: invalid protocol %v", opts.Protocol)
+	}
+	if slice.NumOut() != 2 {
+		typecheck.Panicf(1, "cacheslice.Writer: expected slice with two columns, got %d columns", slice.NumOut())
+	}
+	keyType, valueType := slice.Out(0), slice.Out(1)
+	if keyType != typeOfString && keyType != typeOfBytes {
+		typecheck.Panicf(1, "cacheslice.Writer: key type %s is neither string nor []byte", keyType)
+	}
+	var marshal func(reflect.Value) ([]byte, error)
+	switch {
+	case valueType == typeOfString:
+		marshal = func(v reflect.Value) ([]byte, error) { return []byte(v.String()), nil }
+	case valueType == typeOfBytes:
+		marshal = func(v reflect.Value) ([]byte, error) { return v.Bytes(), nil }
+	case valueType.Implements(typeOfProtoMessage):
+		marshal = func(v reflect.Value) ([]byte, error) { return proto.Marshal(v.Interface().(proto.Message)) }
+	default:
+		typecheck.Panicf(1, "cacheslice.Writer: value type %s is neither string, []byte, nor a proto.Message", valueType)
+	}
+	opts = opts.withDefaults()
+	write := func(state *writerState, err error, keys, values reflect.Value) error {
+		if state.pipe == nil {
+			if err != nil && err != sliceio.EOF {
+				return nil
+			}
+			// WriterFunc does not supply the task's context.
+			state.pipe = newPipeline(context.Background(), opts)
+		}
+		if err != nil && err != sliceio.EOF {
+			state.pipe.Abort()
+			return nil
+		}
+		var key []byte
+		for i := 0; i < keys.Len(); i++ {
+			key = append(key[:0], opts.Prefix...)
+			if opts.Version != "" {
+				key = append(append(key, opts.Version...), ':')
+			}
+			if k := keys.Index(i); keyType == typeOfString {
+				key = append(key, k.String()...)
+			} else {
+				key = append(key, k.Bytes()...)
+			}
+			value, merr := marshal(values.Index(i))
+			if merr != nil {
+				state.pipe.Abort()
+				return merr
+			}
+			if werr := state.pipe.Set(key, value); werr != nil {
+				state.pipe.Abort()
+				return werr
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		return state.pipe.Close()
+	}
+	// WriterFunc requires a function that is typed according to the
+	// slice's column types, so we construct one dynamically.
+	fnType := reflect.FuncOf(
+		[]reflect.Type{reflect.TypeOf(0), reflect.TypeOf(&writerState{}), typeOfError, reflect.SliceOf(keyType), reflect.SliceOf(valueType)},
+		[]reflect.Type{typeOfError},
+		false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		err, _ := args[2].Interface().(error)
+		werr := write(args[1].Interface().(*writerState), err, args[3], args[4])
+		ret := reflect.New(typeOfError).Elem()
+		if werr != nil {
+			ret.Set(reflect.ValueOf(werr))
+		}
+		return []reflect.Value{ret}
+	})
+	return bigslice.WriterFunc(slice, fn.Interface())
+}
+
+// Flip publishes opts.Version as the current version, by writing it to
+// opts.CurrentKey on every server. The current version does not
+// expire. Flip should be called once all of the version's values have
+// been written, i.e., after the evaluation of the slice returned by
+// Writer has succeeded.
+func Flip(ctx context.Context, opts Options) error {
+	if opts.Version == "" {
+		return fmt.Errorf("cacheslice.Flip: no version")
+	}
+	opts = opts.withDefaults()
+	codec := opts.protocol()
+	cmd := codec.appendSet(nil, []byte(opts.CurrentKey()), []byte(opts.Version), 0)
+	g, ctx := errgroup.WithContext(ctx)
+	for _, addr := range opts.Addrs {
+		addr := addr
+		g.Go(func() error {
+			c, err := dial(ctx, addr, opts.Timeout)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			if err := c.send(cmd); err != nil {
+				return err
+			}
+			return c.check(codec.readSet(c.r))
+		})
+	}
+	return g.Wait()
+}
+
+// Current returns the current version, as published by Flip, as it is
+// recorded on the first of opts.Addrs. Current returns an empty version
+// if none has been published.
+func Current(ctx context.Context, opts Options) (string, error) {
+	if len(opts.Addrs) == 0 {
+		return "", fmt.Errorf("cacheslice.Current: no server addresses")
+	}
+	opts = opts.withDefaults()
+	codec := opts.protocol()
+	c, err := dial(ctx, opts.Addrs[0], opts.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	if err := c.send(codec.appendGet(nil, []byte(opts.CurrentKey()))); err != nil {
+		return "", err
+	}
+	version, err := codec.readGet(c.r)
+	return string(version), c.check(err)
+}
+
+// writerState is the per-shard state of a writer.
+type writerState struct {
+	pipe *pipeline
+}
+
+// A batch is a set of encoded commands that are pipelined together.
+type batch struct {
+	p []byte
+	n int
+}
+
+// A pipeline writes values to a set of servers in batches, each of
+// which is sent to the server in its entirety before its replies are
+// read.
+type pipeline struct {
+	opts   Options
+	proto  protocol
+	ctx    context.Context
+	cancel func()
+	group  *errgroup.Group
+	// pending holds the batch that is being accumulated for each server.
+	pending []batch
+	// batches holds the channels on which batches are sent to each
+	// server's connections.
+	batches []chan batch
+	closed  bool
+}
+
+func newPipeline(ctx context.Context, opts Options) *pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &pipeline{
+		opts:    opts,
+		proto:   opts.protocol(),
+		cancel:  cancel,
+		pending: make([]batch, len(opts.Addrs)),
+		batches: make([]chan batch, len(opts.Addrs)),
+	}
+	p.group, p.ctx = errgroup.WithContext(ctx)
+	for i, addr := range opts.Addrs {
+		p.batches[i] = make(chan batch)
+		for j := 0; j < opts.Concurrency; j++ {
+			addr, batches := addr, p.batches[i]
+			p.group.Go(func() error { return p.serve(addr, batches) })
+		}
+	}
+	return p
+}
+
+// Set writes the provided value to the provided key. Set does not
+// retain key or value.
+func (p *pipeline) Set(key, value []byte) error {
+	if err := p.proto.validKey(key); err != nil {
+		return err
+	}
+	i := p.opts.server(key)
+	b := &p.pending[i]
+	b.p = p.proto.appendSet(b.p, key, value, p.opts.TTL)
+	b.n++
+	if b.n < p.opts.BatchSize {
+		return nil
+	}
+	return p.flush(i)
+}
+
+// flush sends the pending batch of the i'th server.
+func (p *pipeline) flush(i int) error {
+	b := p.pending[i]
+	if b.n == 0 {
+		return nil
+	}
+	p.pending[i] = batch{}
+	select {
+	case p.batches[i] <- b:
+		return nil
+	case <-p.ctx.Done():
+		p.closed = true
+		for _, c := range p.batches {
+			close(c)
+		}
+		return p.group.Wait()
+	}
+}
+
+// Close flushes pending batches and waits for all of their replies,
+// returning the first error.
+func (p *pipeline) Close() error {
+	if p.closed {
+		return p.group.Wait()
+	}
+	defer p.cancel()
+	for i := range p.pending {
+		if err := p.flush(i); err != nil {
+			return err
+		}
+	}
+	p.closed = true
+	for _, c := range p.batches {
+		close(c)
+	}
+	return p.group.Wait()
+}
+
+// Abort abandons the pipeline, closing its connections.
+func (p *pipeline) Abort() {
+	p.cancel()
+	if !p.closed {
+		p.closed = true
+		for _, c := range p.batches {
+			close(c)
+		}
+	}
+	p.group.Wait() // nolint: errcheck
+}
+
+// serve writes the batches that are received on the provided channel
+// to the server at addr, over a dedicated connection.
+func (p *pipeline) serve(addr string, batches <-chan batch) error {
+	var c *conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	for b := range batches {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		if c == nil {
+			var err error
+			if c, err = dial(p.ctx, addr, p.opts.Timeout); err != nil {
+				return err
+			}
+		}
+		if err := c.send(b.p); err != nil {
+			return err
+		}
+		for i := 0; i < b.n; i++ {
+			if err := c.check(p.proto.readSet(c.r)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// conn is a connection to a cache server.
+type conn struct {
+	net.Conn
+	addr    string
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+func dial(ctx context.Context, addr string, timeout time.Duration) (*conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, addr: addr, r: bufio.NewReader(c), timeout: timeout}, nil
+}
+
+// send writes the provided commands to the server. Replies must be
+// read before the connection's timeout expires.
+func (c *conn) send(p []byte) error {
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	_, err := c.Write(p)
+	return err
+}
+
+// check annotates a non-nil error that occurred while reading a reply
+// with the server's address.
+func (c *conn) check(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("cacheslice: %s: %v", c.addr, err)
+}
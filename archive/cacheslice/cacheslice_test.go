@@ -0,0 +1,339 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cacheslice_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/archive/cacheslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+const (
+	numRows   = 1000
+	numShards = 7
+)
+
+// entry is a value stored by a fake server, along with the TTL with
+// which it was written, as given by the command.
+type entry struct {
+	value string
+	ttl   string
+}
+
+// server is a fake cache server that speaks a subset of the Redis or
+// memcached protocol.
+type server struct {
+	protocol cacheslice.Protocol
+	ln       net.Listener
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func startServer(t *testing.T, protocol cacheslice.Protocol) *server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{protocol: protocol, ln: ln, entries: make(map[string]entry)}
+	go s.serve()
+	return s
+}
+
+func (s *server) Addr() string { return s.ln.Addr().String() }
+
+func (s *server) Close() { s.ln.Close() }
+
+func (s *server) Get(key string) (entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+func (s *server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			r, w := bufio.NewReader(c), bufio.NewWriter(c)
+			for {
+				var err error
+				if s.protocol == cacheslice.Redis {
+					err = s.redis(r, w)
+				} else {
+					err = s.memcached(r, w)
+				}
+				if err == nil && r.Buffered() == 0 {
+					err = w.Flush()
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimSuffix(line, "\r\n"), err
+}
+
+func readData(r *bufio.Reader, n int) (string, error) {
+	p := make([]byte, n+2)
+	_, err := io.ReadFull(r, p)
+	return string(p[:n]), err
+}
+
+func (s *server) redis(r *bufio.Reader, w *bufio.Writer) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	n, _ := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = readLine(r); err != nil {
+			return err
+		}
+		size, _ := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if args[i], err = readData(r, size); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(args) == 3 && args[0] == "SET":
+		s.entries[args[1]] = entry{value: args[2]}
+		_, err = w.WriteString("+OK\r\n")
+	case len(args) == 5 && args[0] == "SET" && args[3] == "PX":
+		s.entries[args[1]] = entry{value: args[2], ttl: args[4]}
+		_, err = w.WriteString("+OK\r\n")
+	case len(args) == 2 && args[0] == "GET":
+		e, ok := s.entries[args[1]]
+		if !ok {
+			_, err = w.WriteString("$-1\r\n")
+		} else {
+			_, err = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+		}
+	default:
+		_, err = w.WriteString("-ERR unknown command\r\n")
+	}
+	return err
+}
+
+func (s *server) memcached(r *bufio.Reader, w *bufio.Writer) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(fields) == 5 && fields[0] == "set":
+		n, _ := strconv.Atoi(fields[4])
+		value, err := readData(r, n)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(value, "reject") {
+			_, err = w.WriteString("SERVER_ERROR object too large for cache\r\n")
+			return err
+		}
+		s.entries[fields[1]] = entry{value: value, ttl: fields[3]}
+		_, err = w.WriteString("STORED\r\n")
+	case len(fields) == 2 && fields[0] == "get":
+		if e, ok := s.entries[fields[1]]; ok {
+			_, err = fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(e.value), e.value)
+		}
+		if err == nil {
+			_, err = w.WriteString("END\r\n")
+		}
+	default:
+		_, err = w.WriteString("ERROR\r\n")
+	}
+	return err
+}
+
+func rows() ([]string, []string) {
+	keys, values := make([]string, numRows), make([]string, numRows)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%04d", i)
+		values[i] = fmt.Sprintf("value %d", i)
+	}
+	return keys, values
+}
+
+func TestWriter(t *testing.T) {
+	for _, c := range []struct {
+		protocol cacheslice.Protocol
+		ttl      time.Duration
+		wantTTL  string
+	}{
+		{cacheslice.Redis, 0, ""},
+		{cacheslice.Redis, 90 * time.Second, "90000"},
+		{cacheslice.Memcached, 0, "0"},
+		{cacheslice.Memcached, 1500 * time.Millisecond, "2"},
+	} {
+		t.Run(fmt.Sprintf("%v/ttl=%v", c.protocol, c.ttl), func(t *testing.T) {
+			servers := []*server{startServer(t, c.protocol), startServer(t, c.protocol), startServer(t, c.protocol)}
+			byAddr := make(map[string]*server)
+			opts := cacheslice.Options{
+				Protocol:    c.protocol,
+				Prefix:      "features/",
+				Version:     "v1",
+				TTL:         c.ttl,
+				BatchSize:   17,
+				Concurrency: 3,
+			}
+			for _, s := range servers {
+				defer s.Close()
+				byAddr[s.Addr()] = s
+				opts.Addrs = append(opts.Addrs, s.Addr())
+			}
+			keys, values := rows()
+			slicetest.Run(t, cacheslice.Writer(bigslice.Const(numShards, keys, values), opts))
+
+			var n int
+			for _, s := range servers {
+				n += s.Len()
+				if s.Len() == 0 {
+					t.Errorf("server %s was not written", s.Addr())
+				}
+			}
+			if got, want := n, numRows; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			for i, key := range keys {
+				e, ok := byAddr[opts.Addr(key)].Get("features/v1:" + key)
+				if !ok {
+					t.Errorf("key %s not written", key)
+					continue
+				}
+				if got, want := e.value, values[i]; got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				if got, want := e.ttl, c.wantTTL; got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			}
+
+			ctx := context.Background()
+			version, err := cacheslice.Current(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != "" {
+				t.Errorf("got %q, want no version", version)
+			}
+			if err := cacheslice.Flip(ctx, opts); err != nil {
+				t.Fatal(err)
+			}
+			if version, err = cacheslice.Current(ctx, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := version, "v1"; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			for _, s := range servers {
+				if e, _ := s.Get(opts.CurrentKey()); e.value != "v1" {
+					t.Errorf("server %s: version not published", s.Addr())
+				}
+			}
+		})
+	}
+}
+
+func TestWriterProto(t *testing.T) {
+	s := startServer(t, cacheslice.Redis)
+	defer s.Close()
+	keys, values := rows()
+	keyBytes := make([][]byte, len(keys))
+	msgs := make([]*wrappers.StringValue, len(values))
+	for i := range keys {
+		keyBytes[i] = []byte(keys[i])
+		msgs[i] = &wrappers.StringValue{Value: values[i]}
+	}
+	opts := cacheslice.Options{Addrs: []string{s.Addr()}}
+	slicetest.Run(t, cacheslice.Writer(bigslice.Const(numShards, keyBytes, msgs), opts))
+	for i, key := range keys {
+		e, _ := s.Get(key)
+		var msg wrappers.StringValue
+		if err := proto.Unmarshal([]byte(e.value), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := msg.Value, values[i]; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWriterError(t *testing.T) {
+	s := startServer(t, cacheslice.Memcached)
+	defer s.Close()
+	keys, values := rows()
+	values[numRows/2] = "rejected"
+	opts := cacheslice.Options{Protocol: cacheslice.Memcached, Addrs: []string{s.Addr()}}
+	err := slicetest.RunErr(cacheslice.Writer(bigslice.Const(numShards, keys, values), opts))
+	if err == nil || !strings.Contains(err.Error(), "object too large") {
+		t.Errorf("got %v, want server error", err)
+	}
+
+	values[numRows/2] = "accepted"
+	keys[0] = "bad key"
+	err = slicetest.RunErr(cacheslice.Writer(bigslice.Const(numShards, keys, values), opts))
+	if err == nil || !strings.Contains(err.Error(), "whitespace") {
+		t.Errorf("got %v, want key error", err)
+	}
+}
+
+func TestWriterTypeError(t *testing.T) {
+	opts := cacheslice.Options{Addrs: []string{"unused:0"}}
+	for _, c := range []struct {
+		slice bigslice.Slice
+		opts  cacheslice.Options
+	}{
+		{bigslice.Const(1, []string{"a"}), opts},
+		{bigslice.Const(1, []int{1}, []string{"a"}), opts},
+		{bigslice.Const(1, []string{"a"}, []int{1}), opts},
+		{bigslice.Const(1, []string{"a"}, []string{"a"}), cacheslice.Options{}},
+		{bigslice.Const(1, []string{"a"}, []string{"a"}), cacheslice.Options{Protocol: 3, Addrs: opts.Addrs}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected error", c.slice)
+				}
+			}()
+			cacheslice.Writer(c.slice, c.opts)
+		}()
+	}
+}
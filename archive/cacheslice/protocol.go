@@ -0,0 +1,224 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cacheslice
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// A protocol encodes commands to, and decodes replies from, cache
+// servers.
+type protocol interface {
+	// validKey returns an error if key cannot be written with the
+	// protocol.
+	validKey(key []byte) error
+	// appendSet appends to b a command that sets key to value, expiring
+	// after ttl, or never if ttl is zero.
+	appendSet(b, key, value []byte, ttl time.Duration) []byte
+	// readSet reads the reply to a set command.
+	readSet(r *bufio.Reader) error
+	// appendGet appends to b a command that gets the value of key.
+	appendGet(b, key []byte) []byte
+	// readGet reads the reply to a get command. It returns a nil value
+	// if the key is not set.
+	readGet(r *bufio.Reader) ([]byte, error)
+}
+
+// readLine reads a CRLF-terminated line from r, returning it without
+// its terminator.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errors.New("reply line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readData reads n bytes of data, followed by CRLF, from r.
+func readData(r *bufio.Reader, n int) ([]byte, error) {
+	p := make([]byte, n+2)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	if p[n] != '\r' || p[n+1] != '\n' {
+		return nil, errors.New("malformed data block")
+	}
+	return p[:n], nil
+}
+
+// redisProtocol implements the Redis serialization protocol (RESP).
+// Commands are arrays of bulk strings.
+type redisProtocol struct{}
+
+func (redisProtocol) validKey(key []byte) error { return nil }
+
+func (redisProtocol) appendSet(b, key, value []byte, ttl time.Duration) []byte {
+	if ttl <= 0 {
+		b = append(b, "*3\r\n"...)
+	} else {
+		b = append(b, "*5\r\n"...)
+	}
+	b = appendBulk(b, []byte("SET"))
+	b = appendBulk(b, key)
+	b = appendBulk(b, value)
+	if ttl > 0 {
+		ms := int64((ttl + time.Millisecond - 1) / time.Millisecond)
+		b = appendBulk(b, []byte("PX"))
+		b = appendBulk(b, strconv.AppendInt(nil, ms, 10))
+	}
+	return b
+}
+
+func (redisProtocol) readSet(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(line) > 0 && line[0] == '+':
+		return nil
+	case len(line) > 0 && line[0] == '-':
+		return fmt.Errorf("redis: %s", line[1:])
+	default:
+		return fmt.Errorf("redis: unexpected reply %q to SET", line)
+	}
+}
+
+func (redisProtocol) appendGet(b, key []byte) []byte {
+	b = append(b, "*2\r\n"...)
+	b = appendBulk(b, []byte("GET"))
+	return appendBulk(b, key)
+}
+
+func (redisProtocol) readGet(r *bufio.Reader) ([]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > 0 && line[0] == '-' {
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("redis: unexpected reply %q to GET", line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("redis: unexpected reply %q to GET", line)
+	}
+	if n < 0 {
+		return nil, nil
+	}
+	return readData(r, n)
+}
+
+// appendBulk appends p to b as a RESP bulk string.
+func appendBulk(b, p []byte) []byte {
+	b = append(b, '$')
+	b = strconv.AppendInt(b, int64(len(p)), 10)
+	b = append(b, "\r\n"...)
+	b = append(b, p...)
+	return append(b, "\r\n"...)
+}
+
+// memcachedProtocol implements the memcached text protocol.
+type memcachedProtocol struct{}
+
+// maxMemcachedKey is the maximum length of memcached keys.
+const maxMemcachedKey = 250
+
+// maxMemcachedRelativeTTL is the longest expiration time that memcached
+// interprets as relative to the current time; longer times are
+// interpreted as Unix times.
+const maxMemcachedRelativeTTL = 30 * 24 * time.Hour
+
+func (memcachedProtocol) validKey(key []byte) error {
+	if len(key) > maxMemcachedKey {
+		return fmt.Errorf("memcached: key %.32q... is longer than %d bytes", key, maxMemcachedKey)
+	}
+	for _, c := range key {
+		if c <= ' ' || c == 0x7f {
+			return fmt.Errorf("memcached: key %q contains whitespace or control characters", key)
+		}
+	}
+	return nil
+}
+
+func (memcachedProtocol) appendSet(b, key, value []byte, ttl time.Duration) []byte {
+	var exptime int64
+	if ttl > 0 {
+		exptime = int64((ttl + time.Second - 1) / time.Second)
+		if ttl > maxMemcachedRelativeTTL {
+			exptime += time.Now().Unix()
+		}
+	}
+	b = append(b, "set "...)
+	b = append(b, key...)
+	b = append(b, " 0 "...)
+	b = strconv.AppendInt(b, exptime, 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(value)), 10)
+	b = append(b, "\r\n"...)
+	b = append(b, value...)
+	return append(b, "\r\n"...)
+}
+
+func (memcachedProtocol) readSet(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	if string(line) == "STORED" {
+		return nil
+	}
+	return fmt.Errorf("memcached: %s", line)
+}
+
+func (memcachedProtocol) appendGet(b, key []byte) []byte {
+	b = append(b, "get "...)
+	b = append(b, key...)
+	return append(b, "\r\n"...)
+}
+
+func (memcachedProtocol) readGet(r *bufio.Reader) ([]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if string(line) == "END" {
+		return nil, nil
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := bytes.Fields(line)
+	if len(fields) != 4 || string(fields[0]) != "VALUE" {
+		return nil, fmt.Errorf("memcached: %s", line)
+	}
+	n, err := strconv.Atoi(string(fields[3]))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("memcached: unexpected reply %q to get", line)
+	}
+	value, err := readData(r, n)
+	if err != nil {
+		return nil, err
+	}
+	if line, err = readLine(r); err != nil {
+		return nil, err
+	}
+	if string(line) != "END" {
+		return nil, fmt.Errorf("memcached: unexpected reply %q to get", line)
+	}
+	return value, nil
+}
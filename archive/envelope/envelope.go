@@ -0,0 +1,345 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package envelope implements reading, and writing, of objects that
+// are encrypted on the client side with envelope encryption: each
+// object is encrypted with its own data key, which is stored with the
+// object, wrapped by a master key held in a key management service
+// such as AWS KMS.
+//
+// Encrypted objects are read by bigslice file sources through Open,
+// which wraps the sources' reader funcs. For example:
+//
+//	var keys = envelope.NewCache(envelope.KMS{Client: kms.New(sess)}, time.Hour)
+//
+//	var lines = bigslice.Func(func(path string) bigslice.Slice {
+//		return bigslice.ScanReader(8, envelope.Open(func() (io.ReadCloser, error) {
+//			return os.Open(path)
+//		}, keys))
+//	})
+//
+// Because keys is a package-level variable, each worker process keeps
+// a single cache of unwrapped data keys, so that the key management
+// service is called once per object, rather than once per shard.
+//
+// Objects written by NewWriter are encrypted in chunks with
+// AES-256-GCM, so that they may be streamed. Each object begins with a
+// header that identifies its master key and holds its wrapped data key;
+// the header is authenticated by every chunk, and chunks are numbered,
+// and the last chunk marked, so that objects cannot be reordered or
+// truncated without detection.
+//
+// Objects written by the Amazon S3 encryption client, in any of the
+// AWS SDKs, are read by NewS3Reader and OpenS3. That format holds the
+// envelope in the object's metadata, and authenticates the object as a
+// whole, so that its plaintext cannot be released until all of it has
+// been read; such objects are thus decrypted in memory. NewWriter's
+// chunked format exists so that objects of any size may be streamed
+// by readers that never release unauthenticated data.
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/grailbio/base/errors"
+)
+
+const (
+	magic = "bsenvel1"
+	// chunkSize is the size of the plaintext of each chunk but the
+	// last.
+	chunkSize = 64 << 10
+	// noncePrefixSize is the size of the random prefix of each chunk's
+	// nonce; the remainder holds the chunk's index and whether it is
+	// the last.
+	noncePrefixSize = 7
+	// maxFieldSize bounds the size of the header's variable-length
+	// fields, so that corrupt headers do not cause large allocations.
+	maxFieldSize = 1 << 16
+)
+
+// A KeyDecrypter unwraps data keys.
+type KeyDecrypter interface {
+	// DecryptKey returns the plaintext of the provided data key, which
+	// was wrapped by the master key with the provided ID in the
+	// provided encryption context. The context is nil for objects
+	// written by NewWriter.
+	DecryptKey(ctx context.Context, keyID string, wrapped []byte, encryptionContext map[string]string) ([]byte, error)
+}
+
+// A KeyEncrypter generates data keys.
+type KeyEncrypter interface {
+	// GenerateKey returns a new 256-bit data key, both in plaintext and
+	// wrapped by the master key with the provided ID.
+	GenerateKey(ctx context.Context, keyID string) (plaintext, wrapped []byte, err error)
+}
+
+// header is the header of an encrypted object.
+type header struct {
+	keyID       string
+	wrapped     []byte
+	noncePrefix [noncePrefixSize]byte
+}
+
+func (h header) marshal() []byte {
+	b := make([]byte, 0, len(magic)+2+len(h.keyID)+2+len(h.wrapped)+noncePrefixSize)
+	b = append(b, magic...)
+	b = appendField(b, []byte(h.keyID))
+	b = appendField(b, h.wrapped)
+	return append(b, h.noncePrefix[:]...)
+}
+
+func appendField(b, field []byte) []byte {
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], uint16(len(field)))
+	return append(append(b, n[:]...), field...)
+}
+
+func readHeader(r io.Reader) (header, []byte, error) {
+	var h header
+	raw := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return h, nil, errors.E(errors.Integrity, "envelope: reading header", err)
+	}
+	if string(raw) != magic {
+		return h, nil, errors.E(errors.Integrity, "envelope: object is not envelope encrypted")
+	}
+	readField := func() ([]byte, error) {
+		var n [2]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, err
+		}
+		raw = append(raw, n[:]...)
+		field := make([]byte, binary.BigEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(r, field); err != nil {
+			return nil, err
+		}
+		raw = append(raw, field...)
+		return field, nil
+	}
+	keyID, err := readField()
+	if err != nil {
+		return h, nil, errors.E(errors.Integrity, "envelope: reading header", err)
+	}
+	h.keyID = string(keyID)
+	if h.wrapped, err = readField(); err != nil {
+		return h, nil, errors.E(errors.Integrity, "envelope: reading header", err)
+	}
+	if _, err := io.ReadFull(r, h.noncePrefix[:]); err != nil {
+		return h, nil, errors.E(errors.Integrity, "envelope: reading header", err)
+	}
+	raw = append(raw, h.noncePrefix[:]...)
+	return h, raw, nil
+}
+
+// nonce returns the nonce of the chunk with the provided index.
+func (h header) nonce(index uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, h.noncePrefix[:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.E(errors.Invalid, fmt.Sprintf("envelope: data key has %d bytes, not 32", len(key)))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewReader returns a reader of the plaintext of the encrypted object
+// read from r. The object's data key is unwrapped by the provided
+// KeyDecrypter. Errors that indicate that the object was corrupted,
+// or tampered with, are of kind errors.Integrity.
+func NewReader(ctx context.Context, r io.Reader, keys KeyDecrypter) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, chunkSize+64)
+	h, raw, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys.DecryptKey(ctx, h.keyID, h.wrapped, nil)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: br, header: h, aad: raw, aead: aead, buf: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+type reader struct {
+	r      *bufio.Reader
+	header header
+	aad    []byte
+	aead   cipher.AEAD
+
+	buf   []byte
+	plain []byte
+	index uint32
+	done  bool
+	err   error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			r.err = io.EOF
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk.
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.r, r.buf)
+	switch err {
+	case nil:
+		// A full chunk is the last one only if it is followed by the end
+		// of the object.
+		if _, err := r.r.Peek(1); err == io.EOF {
+			r.done = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		r.done = true
+	default:
+		return err
+	}
+	if r.index == 1<<32-1 {
+		return errors.E(errors.Invalid, "envelope: object is too large")
+	}
+	r.plain, err = r.aead.Open(r.buf[:0], r.header.nonce(r.index, r.done), r.buf[:n], r.aad)
+	if err != nil {
+		return errors.E(errors.Integrity, fmt.Sprintf("envelope: chunk %d failed authentication", r.index), err)
+	}
+	r.index++
+	return nil
+}
+
+// Open returns a reader func, as used by bigslice file sources such as
+// bigslice.ScanReader, that opens the object returned by the provided
+// reader func and decrypts it with data keys unwrapped by keys.
+func Open(open func() (io.ReadCloser, error), keys KeyDecrypter) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		r, err := NewReader(context.Background(), rc, keys)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return readCloser{r, rc}, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// NewWriter returns a writer that encrypts the object written to it to
+// w, with a new data key that is generated by keys, and wrapped by the
+// master key with the provided ID. The object is complete only once
+// the writer is closed; closing the writer does not close w.
+func NewWriter(ctx context.Context, w io.Writer, keys KeyEncrypter, keyID string) (io.WriteCloser, error) {
+	if len(keyID) >= maxFieldSize {
+		return nil, errors.E(errors.Invalid, "envelope: key ID is too long")
+	}
+	key, wrapped, err := keys.GenerateKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) >= maxFieldSize {
+		return nil, errors.E(errors.Invalid, "envelope: wrapped data key is too long")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	h := header{keyID: keyID, wrapped: wrapped}
+	if _, err := rand.Read(h.noncePrefix[:]); err != nil {
+		return nil, err
+	}
+	raw := h.marshal()
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, header: h, aad: raw, aead: aead, buf: make([]byte, 0, chunkSize+aead.Overhead())}, nil
+}
+
+type writer struct {
+	w      io.Writer
+	header header
+	aad    []byte
+	aead   cipher.AEAD
+	buf    []byte
+	index  uint32
+	err    error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 && w.err == nil {
+		if len(w.buf) == chunkSize {
+			// The buffered chunk is not the last, since there is more
+			// data to write.
+			w.err = w.flush(false)
+			continue
+		}
+		m := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, w.err
+}
+
+func (w *writer) flush(last bool) error {
+	if w.index == 1<<32-1 {
+		return errors.E(errors.Invalid, "envelope: object is too large")
+	}
+	sealed := w.aead.Seal(w.buf[:0], w.header.nonce(w.index, last), w.buf, w.aad)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+// Close writes the last chunk of the object.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.flush(true)
+	if w.err == nil {
+		w.err = errors.E(errors.Invalid, "envelope: writer is closed")
+		return nil
+	}
+	return w.err
+}
@@ -0,0 +1,328 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package envelope_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3crypto"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/archive/envelope"
+)
+
+// testKeys is a KeyEncrypter and KeyDecrypter that "wraps" data keys
+// by prefixing them with their master key ID, counting unwrappings.
+type testKeys struct {
+	decrypts int
+}
+
+func (k *testKeys) GenerateKey(ctx context.Context, keyID string) (plaintext, wrapped []byte, err error) {
+	plaintext = make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, nil, err
+	}
+	return plaintext, append([]byte(keyID+":"), plaintext...), nil
+}
+
+func (k *testKeys) DecryptKey(ctx context.Context, keyID string, wrapped []byte, _ map[string]string) ([]byte, error) {
+	k.decrypts++
+	if !bytes.HasPrefix(wrapped, []byte(keyID+":")) {
+		return nil, errors.E(errors.NotAllowed, "wrong master key")
+	}
+	return wrapped[len(keyID)+1:], nil
+}
+
+func encrypt(t *testing.T, keys envelope.KeyEncrypter, plaintext []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := envelope.NewWriter(context.Background(), &b, keys, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func decrypt(keys envelope.KeyDecrypter, ciphertext []byte) ([]byte, error) {
+	r, err := envelope.NewReader(context.Background(), bytes.NewReader(ciphertext), keys)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	keys := new(testKeys)
+	for _, n := range []int{0, 1, 64 << 10, 64<<10 + 1, 3*64<<10 + 5} {
+		plaintext := make([]byte, n)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		got, err := decrypt(keys, encrypt(t, keys, plaintext))
+		if err != nil {
+			t.Fatalf("size %d: %v", n, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: plaintext mismatch", n)
+		}
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	keys := new(testKeys)
+	plaintext := make([]byte, 2*64<<10)
+	ciphertext := encrypt(t, keys, plaintext)
+	for _, c := range []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"flipped", append(append([]byte{}, ciphertext[:100]...), append([]byte{ciphertext[100] ^ 1}, ciphertext[101:]...)...)},
+		// Drop the last, empty chunk, so that the last full chunk
+		// appears to be the last.
+		{"truncated", ciphertext[:len(ciphertext)-16]},
+		{"plaintext", plaintext},
+	} {
+		if _, err := decrypt(keys, c.ciphertext); !errors.Is(errors.Integrity, err) {
+			t.Errorf("%s: got %v, want integrity error", c.name, err)
+		}
+	}
+}
+
+func TestCacheAudit(t *testing.T) {
+	keys := new(testKeys)
+	ciphertext := encrypt(t, keys, []byte("hello"))
+	var usages []envelope.Usage
+	audited := envelope.Audited(envelope.NewCache(keys, time.Hour), func(u envelope.Usage) {
+		usages = append(usages, u)
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := decrypt(audited, ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := keys.decrypts, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(usages), 3; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := usages[0].KeyID, "master"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if usages[0].Digest == "" || usages[0].Digest != usages[2].Digest {
+		t.Errorf("bad digests %v, %v", usages[0].Digest, usages[2].Digest)
+	}
+	// Expired keys are unwrapped again.
+	cache := envelope.NewCache(keys, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := decrypt(cache, ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := keys.decrypts, 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// testKMS is a KMS client whose data keys are wrapped by testKeys. As
+// with KMS, a data key is unwrapped only in the encryption context in
+// which it was generated.
+type testKMS struct {
+	kmsiface.KMSAPI
+	keys     testKeys
+	contexts map[string]map[string]string
+}
+
+func (k *testKMS) GenerateDataKeyWithContext(ctx aws.Context, in *kms.GenerateDataKeyInput, _ ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+	if got, want := aws.StringValue(in.KeySpec), kms.DataKeySpecAes256; got != want {
+		return nil, errors.E(errors.Invalid, "bad key spec "+got)
+	}
+	plaintext, wrapped, err := k.keys.GenerateKey(ctx, aws.StringValue(in.KeyId))
+	if k.contexts == nil {
+		k.contexts = make(map[string]map[string]string)
+	}
+	k.contexts[string(wrapped)] = aws.StringValueMap(in.EncryptionContext)
+	return &kms.GenerateDataKeyOutput{Plaintext: plaintext, CiphertextBlob: wrapped}, err
+}
+
+func (k *testKMS) DecryptWithContext(ctx aws.Context, in *kms.DecryptInput, _ ...request.Option) (*kms.DecryptOutput, error) {
+	if got, want := aws.StringValueMap(in.EncryptionContext), k.contexts[string(in.CiphertextBlob)]; len(got) != len(want) || len(got) > 0 && !reflect.DeepEqual(got, want) {
+		return nil, errors.E(errors.NotAllowed, "wrong encryption context")
+	}
+	keyID := string(in.CiphertextBlob[:bytes.IndexByte(in.CiphertextBlob, ':')])
+	plaintext, err := k.keys.DecryptKey(ctx, keyID, in.CiphertextBlob, nil)
+	return &kms.DecryptOutput{Plaintext: plaintext}, err
+}
+
+func TestOpenKMS(t *testing.T) {
+	keys := envelope.KMS{Client: new(testKMS)}
+	ciphertext := encrypt(t, keys, []byte("a\nb\nc\n"))
+	closed := false
+	open := envelope.Open(func() (io.ReadCloser, error) {
+		return readCloser{bytes.NewReader(ciphertext), &closed}, nil
+	}, keys)
+	rc, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(plaintext), "a\nb\nc\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !closed {
+		t.Error("object was not closed")
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	closed *bool
+}
+
+func (r readCloser) Close() error {
+	*r.closed = true
+	return nil
+}
+
+// encryptS3 encrypts plaintext as the S3 encryption client does, with
+// a data key that is generated by client and wrapped by the master key
+// "master". It returns the ciphertext and the object's user metadata,
+// as returned by S3.
+func encryptS3(t *testing.T, client kmsiface.KMSAPI, wrapAlg string, plaintext []byte) ([]byte, map[string]*string) {
+	t.Helper()
+	matdesc := s3crypto.MaterialDescription{"kms_cmk_id": aws.String("master")}
+	if wrapAlg == "kms+context" {
+		matdesc = s3crypto.MaterialDescription{"aws:x-amz-cek-alg": aws.String(s3crypto.AESGCMNoPadding)}
+	}
+	cipher, err := s3crypto.AESGCMContentCipherBuilder(
+		s3crypto.NewKMSKeyGeneratorWithMatDesc(client, "master", matdesc)).ContentCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cipher.EncryptContents(bytes.NewReader(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := cipher.GetCipherData()
+	desc, err := json.Marshal(cd.MaterialDescription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext, map[string]*string{
+		"X-Amz-Key-V2":   aws.String(base64.StdEncoding.EncodeToString(cd.EncryptedKey)),
+		"X-Amz-Iv":       aws.String(base64.StdEncoding.EncodeToString(cd.IV)),
+		"X-Amz-Matdesc":  aws.String(string(desc)),
+		"X-Amz-Wrap-Alg": aws.String(wrapAlg),
+		"X-Amz-Cek-Alg":  aws.String(cd.CEKAlgorithm),
+		"X-Amz-Tag-Len":  aws.String(cd.TagLength),
+	}
+}
+
+type testS3 struct {
+	s3iface.S3API
+	body     []byte
+	metadata map[string]*string
+	closed   bool
+}
+
+func (s *testS3) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{
+		Body:     readCloser{bytes.NewReader(s.body), &s.closed},
+		Metadata: s.metadata,
+	}, nil
+}
+
+func TestOpenS3(t *testing.T) {
+	client := new(testKMS)
+	for _, wrapAlg := range []string{"kms", "kms+context"} {
+		var usages []envelope.Usage
+		keys := envelope.Audited(envelope.NewCache(envelope.KMS{Client: client}, time.Hour), func(u envelope.Usage) {
+			usages = append(usages, u)
+		})
+		body, metadata := encryptS3(t, client, wrapAlg, []byte("a\nb\nc\n"))
+		s3client := &testS3{body: body, metadata: metadata}
+		rc, err := envelope.OpenS3(s3client, "bucket", "key", keys)()
+		if err != nil {
+			t.Fatalf("%s: %v", wrapAlg, err)
+		}
+		plaintext, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(plaintext), "a\nb\nc\n"; got != want {
+			t.Errorf("%s: got %q, want %q", wrapAlg, got, want)
+		}
+		if !s3client.closed {
+			t.Errorf("%s: object was not closed", wrapAlg)
+		}
+		if got, want := len(usages), 1; got != want {
+			t.Fatalf("%s: got %v, want %v", wrapAlg, got, want)
+		}
+		var want map[string]string
+		if err := json.Unmarshal([]byte(*metadata["X-Amz-Matdesc"]), &want); err != nil {
+			t.Fatal(err)
+		}
+		if got := usages[0].EncryptionContext; len(got) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", wrapAlg, got, want)
+		}
+	}
+}
+
+func TestS3ReaderIntegrity(t *testing.T) {
+	client := new(testKMS)
+	keys := envelope.KMS{Client: client}
+	body, metadata := encryptS3(t, client, "kms", make([]byte, 1024))
+	tampered := append([]byte{}, body...)
+	tampered[10] ^= 1
+	if _, err := envelope.NewS3Reader(context.Background(), bytes.NewReader(tampered), metadata, keys); !errors.Is(errors.Integrity, err) {
+		t.Errorf("got %v, want integrity error", err)
+	}
+	// The data key is not unwrapped in another encryption context.
+	other := make(map[string]*string)
+	for k, v := range metadata {
+		other[k] = v
+	}
+	other["X-Amz-Matdesc"] = aws.String(`{"kms_cmk_id":"other"}`)
+	if _, err := envelope.NewS3Reader(context.Background(), bytes.NewReader(body), other, keys); !errors.Is(errors.NotAllowed, err) {
+		t.Errorf("got %v, want not allowed error", err)
+	}
+	delete(other, "X-Amz-Key-V2")
+	if _, err := envelope.NewS3Reader(context.Background(), bytes.NewReader(body), other, keys); !errors.Is(errors.Integrity, err) {
+		t.Errorf("got %v, want integrity error", err)
+	}
+}
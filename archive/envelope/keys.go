@@ -0,0 +1,164 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/grailbio/base/log"
+)
+
+// KMS is a KeyDecrypter and KeyEncrypter whose master keys are held in
+// AWS KMS. Key IDs are KMS key IDs, ARNs, or aliases.
+type KMS struct {
+	Client kmsiface.KMSAPI
+}
+
+// DecryptKey implements KeyDecrypter. The wrapped key identifies its
+// master key to KMS; keyID is not used.
+func (k KMS) DecryptKey(ctx context.Context, keyID string, wrapped []byte, encryptionContext map[string]string) ([]byte, error) {
+	in := &kms.DecryptInput{CiphertextBlob: wrapped}
+	if len(encryptionContext) > 0 {
+		in.EncryptionContext = aws.StringMap(encryptionContext)
+	}
+	out, err := k.Client.DecryptWithContext(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// GenerateKey implements KeyEncrypter.
+func (k KMS) GenerateKey(ctx context.Context, keyID string) (plaintext, wrapped []byte, err error) {
+	out, err := k.Client.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Plaintext, out.CiphertextBlob, nil
+}
+
+// A Cache is a KeyDecrypter that caches the data keys unwrapped by an
+// underlying KeyDecrypter for a fixed amount of time. Caches should be
+// kept in package-level variables, so that they are shared by all of a
+// worker's readers.
+type Cache struct {
+	keys KeyDecrypter
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	key     []byte
+	expires time.Time
+}
+
+// NewCache returns a cache of the data keys unwrapped by keys, each of
+// which is kept for the provided time to live.
+func NewCache(keys KeyDecrypter, ttl time.Duration) *Cache {
+	return &Cache{keys: keys, ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// DecryptKey implements KeyDecrypter. Keys are cached by their
+// encryption context as well, so that a cached key is not returned
+// for a context in which it was not wrapped.
+func (c *Cache) DecryptKey(ctx context.Context, keyID string, wrapped []byte, encryptionContext map[string]string) ([]byte, error) {
+	id := keyID + "\x00" + string(wrapped)
+	names := make([]string, 0, len(encryptionContext))
+	for name := range encryptionContext {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id += "\x00" + name + "=" + encryptionContext[name]
+	}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.key, nil
+	}
+	key, err := c.keys.DecryptKey(ctx, keyID, wrapped, encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	// Expired entries are evicted as new keys are added, so that the
+	// cache does not grow without bound.
+	for id, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[id] = cacheEntry{key, now.Add(c.ttl)}
+	c.mu.Unlock()
+	return key, nil
+}
+
+// A Usage records the use of a data key.
+type Usage struct {
+	// KeyID is the ID of the master key that wrapped the data key.
+	KeyID string
+	// Digest is the hex-encoded SHA-256 digest of the wrapped data key.
+	// It identifies the data key, but does not reveal it.
+	Digest string
+	// EncryptionContext is the encryption context in which the data
+	// key was wrapped, if any.
+	EncryptionContext map[string]string
+	// Time is the time at which the key was used.
+	Time time.Time
+	// Err is the error, if any, with which unwrapping the key failed.
+	Err error
+}
+
+// Audited returns a KeyDecrypter that unwraps data keys with keys, and
+// reports each unwrapping to the provided audit func. Audited may wrap
+// a Cache, to audit each object that is read, or be wrapped by one, to
+// audit only the keys that are unwrapped by the key management
+// service.
+func Audited(keys KeyDecrypter, audit func(Usage)) KeyDecrypter {
+	return auditor{keys, audit}
+}
+
+type auditor struct {
+	keys  KeyDecrypter
+	audit func(Usage)
+}
+
+func (a auditor) DecryptKey(ctx context.Context, keyID string, wrapped []byte, encryptionContext map[string]string) ([]byte, error) {
+	digest := sha256.Sum256(wrapped)
+	usage := Usage{
+		KeyID:             keyID,
+		Digest:            hex.EncodeToString(digest[:]),
+		EncryptionContext: encryptionContext,
+		Time:              time.Now(),
+	}
+	key, err := a.keys.DecryptKey(ctx, keyID, wrapped, encryptionContext)
+	usage.Err = err
+	a.audit(usage)
+	return key, err
+}
+
+// LogUsage is an audit func that logs each key usage.
+func LogUsage(u Usage) {
+	if u.Err != nil {
+		log.Printf("envelope: data key %s of master key %s: %v", u.Digest, u.KeyID, u.Err)
+		return
+	}
+	log.Printf("envelope: used data key %s of master key %s", u.Digest, u.KeyID)
+}
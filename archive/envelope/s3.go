@@ -0,0 +1,146 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grailbio/base/errors"
+)
+
+// The metadata and algorithms of the envelopes of objects written by
+// the Amazon S3 encryption client.
+const (
+	s3KeyV1   = "x-amz-key"
+	s3KeyV2   = "x-amz-key-v2"
+	s3IV      = "x-amz-iv"
+	s3MatDesc = "x-amz-matdesc"
+	s3WrapAlg = "x-amz-wrap-alg"
+	s3CEKAlg  = "x-amz-cek-alg"
+	s3TagLen  = "x-amz-tag-len"
+
+	s3AESGCM         = "AES/GCM/NoPadding"
+	s3WrapKMS        = "kms"
+	s3WrapKMSContext = "kms+context"
+	// s3CEKAlgContext is the encryption context entry in which the
+	// "kms+context" wrap algorithm records the content cipher.
+	s3CEKAlgContext = "aws:" + s3CEKAlg
+)
+
+// NewS3Reader returns a reader of the plaintext of an object that was
+// encrypted by the Amazon S3 encryption client, given the object's
+// body and its user metadata, which holds the object's envelope, as
+// returned by S3's GetObject. The object's data key, which must be
+// wrapped by an AWS KMS master key (wrap algorithm "kms" or
+// "kms+context"), is unwrapped by the provided KeyDecrypter in the
+// object's encryption context. Objects must be encrypted with
+// AES-GCM; envelopes kept in instruction files, rather than in the
+// object's metadata, are not supported.
+//
+// Since the object is authenticated as a whole, NewS3Reader reads and
+// authenticates all of it before it returns, and keeps its plaintext
+// in memory. Errors that indicate that the object was corrupted, or
+// tampered with, are of kind errors.Integrity.
+func NewS3Reader(ctx context.Context, body io.Reader, metadata map[string]*string, keys KeyDecrypter) (io.Reader, error) {
+	meta := func(name string) string {
+		for key, val := range metadata {
+			if strings.EqualFold(key, name) || strings.EqualFold(key, "x-amz-meta-"+name) {
+				return aws.StringValue(val)
+			}
+		}
+		return ""
+	}
+	switch {
+	case meta(s3KeyV2) != "":
+	case meta(s3KeyV1) != "":
+		return nil, errors.E(errors.NotSupported, "envelope: objects written by version 1 of the S3 encryption client are not supported")
+	default:
+		return nil, errors.E(errors.Integrity, "envelope: object has no S3 encryption client envelope")
+	}
+	if alg := meta(s3CEKAlg); alg != s3AESGCM {
+		return nil, errors.E(errors.NotSupported, "envelope: unsupported content cipher "+alg)
+	}
+	if n := meta(s3TagLen); n != "" && n != "128" {
+		return nil, errors.E(errors.NotSupported, "envelope: unsupported tag length "+n)
+	}
+	var encryptionContext map[string]string
+	if err := json.Unmarshal([]byte(meta(s3MatDesc)), &encryptionContext); err != nil {
+		return nil, errors.E(errors.Integrity, "envelope: decoding material description", err)
+	}
+	var keyID string
+	switch alg := meta(s3WrapAlg); alg {
+	case s3WrapKMS:
+		if keyID = encryptionContext["kms_cmk_id"]; keyID == "" {
+			return nil, errors.E(errors.Integrity, "envelope: material description has no KMS key ID")
+		}
+	case s3WrapKMSContext:
+		if encryptionContext[s3CEKAlgContext] != s3AESGCM {
+			return nil, errors.E(errors.Integrity, "envelope: encryption context does not match the content cipher")
+		}
+	default:
+		return nil, errors.E(errors.NotSupported, "envelope: unsupported wrap algorithm "+alg)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(meta(s3KeyV2))
+	if err != nil {
+		return nil, errors.E(errors.Integrity, "envelope: decoding data key", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(meta(s3IV))
+	if err != nil {
+		return nil, errors.E(errors.Integrity, "envelope: decoding IV", err)
+	}
+	key, err := keys.DecryptKey(ctx, keyID, wrapped, encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() {
+		return nil, errors.E(errors.Integrity, "envelope: IV has the wrong size")
+	}
+	ciphertext, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(ciphertext[:0], iv, ciphertext, nil)
+	if err != nil {
+		return nil, errors.E(errors.Integrity, "envelope: object failed authentication", err)
+	}
+	return bytes.NewReader(plaintext), nil
+}
+
+// OpenS3 returns a reader func, as used by bigslice file sources such
+// as bigslice.ScanReader, that reads the S3 object with the provided
+// bucket and key, which was written by the Amazon S3 encryption
+// client, and decrypts it with data keys unwrapped by keys. See
+// NewS3Reader.
+func OpenS3(client s3iface.S3API, bucket, key string, keys KeyDecrypter) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		ctx := context.Background()
+		out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, err
+		}
+		r, err := NewS3Reader(ctx, out.Body, out.Metadata, keys)
+		if err != nil {
+			out.Body.Close()
+			return nil, err
+		}
+		return readCloser{r, out.Body}, nil
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package recordslice implements bigslice sinks that write records to
+// sharded files in formats that are consumed outside of Go: TFRecord,
+// as read by TensorFlow and JAX input pipelines, and recordio.
+//
+// Records are taken from a slice with a single column, either of type
+// []byte, in which case the records are written verbatim, or of a type
+// that implements proto.Message, in which case each record is the
+// serialized protocol buffer message.
+//
+// Each shard is written to its own file, named according to the
+// conventional sharded file pattern; see ShardPath.
+package recordslice
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/base/recordio"
+	"github.com/grailbio/base/recordio/recordioflate"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Compression is the type of compression applied to written files.
+type Compression int
+
+const (
+	// NoCompression writes uncompressed files.
+	NoCompression Compression = iota
+	// Gzip compresses files with gzip. This corresponds to TFRecord's
+	// "GZIP" compression type.
+	Gzip
+	// Zlib compresses files with zlib. This corresponds to TFRecord's
+	// "ZLIB" compression type.
+	Zlib
+)
+
+// String returns the TFRecord compression type corresponding to c.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return ""
+	case Gzip:
+		return "GZIP"
+	case Zlib:
+		return "ZLIB"
+	default:
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+}
+
+// ShardPath returns the path of the file to which shard of nshard is
+// written, given a path prefix. The path follows the conventional
+// pattern for sharded files, e.g., "prefix-00002-of-00010".
+func ShardPath(prefix string, shard, nshard int) string {
+	return fmt.Sprintf("%s-%05d-of-%05d", prefix, shard, nshard)
+}
+
+// TFRecordWriter returns a slice that writes the records of slice to
+// TFRecord files, one per shard, at the paths given by ShardPath(prefix,
+// ...). Compression, which must be one of NoCompression, Gzip, or Zlib,
+// is applied to files as a whole, as expected by TensorFlow. The
+// returned slice passes through the records of slice.
+func TFRecordWriter(slice bigslice.Slice, prefix string, compression Compression) bigslice.Slice {
+	bigslice.Helper()
+	switch compression {
+	case NoCompression, Gzip, Zlib:
+	default:
+		typecheck.Panicf(1, "recordslice.TFRecordWriter: invalid compression %v", compression)
+	}
+	return writer(slice, prefix, func(w io.Writer) (recordWriter, error) {
+		switch compression {
+		case Gzip:
+			gz := gzip.NewWriter(w)
+			return &tfrecordWriter{w: gz, closer: gz}, nil
+		case Zlib:
+			z := zlib.NewWriter(w)
+			return &tfrecordWriter{w: z, closer: z}, nil
+		default:
+			return &tfrecordWriter{w: w}, nil
+		}
+	})
+}
+
+// RecordIOWriter returns a slice that writes the records of slice to
+// recordio files, one per shard, at the paths given by ShardPath(prefix,
+// ...). If compress is true, record blocks are compressed with the
+// recordio "flate" transformer. The returned slice passes through the
+// records of slice.
+func RecordIOWriter(slice bigslice.Slice, prefix string, compress bool) bigslice.Slice {
+	bigslice.Helper()
+	var opts recordio.WriterOpts
+	if compress {
+		recordioflate.Init()
+		opts.Transformers = []string{recordioflate.Name}
+	}
+	return writer(slice, prefix, func(w io.Writer) (recordWriter, error) {
+		return &recordioWriter{recordio.NewWriter(w, opts)}, nil
+	})
+}
+
+var (
+	typeOfBytes        = reflect.TypeOf([]byte(nil))
+	typeOfProtoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	typeOfError        = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// A recordWriter writes serialized records to an underlying writer.
+type recordWriter interface {
+	// Append writes the record p.
+	Append(p []byte) error
+	// Close flushes any buffered records. It does not close the
+	// underlying writer.
+	Close() error
+}
+
+// writerState is the per-shard state of a writer.
+type writerState struct {
+	file file.File
+	buf  *bufio.Writer
+	w    recordWriter
+}
+
+// writer returns a slice that writes the records of slice to the
+// sharded files at prefix, using record writers returned by newWriter.
+func writer(slice bigslice.Slice, prefix string, newWriter func(io.Writer) (recordWriter, error)) bigslice.Slice {
+	if slice.NumOut() != 1 {
+		typecheck.Panicf(2, "recordslice: expected slice with a single column, got %d columns", slice.NumOut())
+	}
+	typ := slice.Out(0)
+	var marshal func(reflect.Value) ([]byte, error)
+	switch {
+	case typ == typeOfBytes:
+		marshal = func(v reflect.Value) ([]byte, error) { return v.Bytes(), nil }
+	case typ.Implements(typeOfProtoMessage):
+		marshal = func(v reflect.Value) ([]byte, error) { return proto.Marshal(v.Interface().(proto.Message)) }
+	default:
+		typecheck.Panicf(2, "recordslice: column type %s is neither []byte nor a proto.Message", typ)
+	}
+	nshard := slice.NumShard()
+	write := func(shard int, state *writerState, err error, records reflect.Value) error {
+		// WriterFunc does not supply the task's context.
+		ctx := context.Background()
+		if state.file == nil {
+			if err != nil && err != sliceio.EOF {
+				return nil
+			}
+			path := ShardPath(prefix, shard, nshard)
+			f, createErr := file.Create(ctx, path)
+			if createErr != nil {
+				return createErr
+			}
+			state.file = f
+			state.buf = bufio.NewWriter(f.Writer(ctx))
+			if state.w, createErr = newWriter(state.buf); createErr != nil {
+				f.Discard(ctx)
+				return createErr
+			}
+		}
+		if err != nil && err != sliceio.EOF {
+			state.file.Discard(ctx)
+			return nil
+		}
+		for i := 0; i < records.Len(); i++ {
+			p, merr := marshal(records.Index(i))
+			if merr != nil {
+				state.file.Discard(ctx)
+				return merr
+			}
+			if werr := state.w.Append(p); werr != nil {
+				state.file.Discard(ctx)
+				return werr
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if cerr := state.w.Close(); cerr != nil {
+			state.file.Discard(ctx)
+			return cerr
+		}
+		if ferr := state.buf.Flush(); ferr != nil {
+			state.file.Discard(ctx)
+			return ferr
+		}
+		return state.file.Close(ctx)
+	}
+	// WriterFunc requires a function that is typed according to the
+	// slice's column type, so we construct one dynamically.
+	fnType := reflect.FuncOf(
+		[]reflect.Type{reflect.TypeOf(0), reflect.TypeOf(&writerState{}), typeOfError, reflect.SliceOf(typ)},
+		[]reflect.Type{typeOfError},
+		false)
+	fn := reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		err, _ := args[2].Interface().(error)
+		werr := write(int(args[0].Int()), args[1].Interface().(*writerState), err, args[3])
+		ret := reflect.New(typeOfError).Elem()
+		if werr != nil {
+			ret.Set(reflect.ValueOf(werr))
+		}
+		return []reflect.Value{ret}
+	})
+	return bigslice.WriterFunc(slice, fn.Interface())
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC returns the masked CRC-32C checksum of p, as used in
+// TFRecord framing.
+func maskedCRC(p []byte) uint32 {
+	crc := crc32.Checksum(p, crc32c)
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// TfrecordWriter writes records in the TFRecord format. Each record is
+// framed as follows:
+//
+//	uint64 length
+//	uint32 masked CRC-32C of length
+//	byte   data[length]
+//	uint32 masked CRC-32C of data
+//
+// All integers are little-endian.
+type tfrecordWriter struct {
+	w      io.Writer
+	closer io.Closer
+	hdr    [12]byte
+	ftr    [4]byte
+}
+
+func (w *tfrecordWriter) Append(p []byte) error {
+	binary.LittleEndian.PutUint64(w.hdr[:8], uint64(len(p)))
+	binary.LittleEndian.PutUint32(w.hdr[8:], maskedCRC(w.hdr[:8]))
+	if _, err := w.w.Write(w.hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(p); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(w.ftr[:], maskedCRC(p))
+	_, err := w.w.Write(w.ftr[:])
+	return err
+}
+
+func (w *tfrecordWriter) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+// RecordioWriter adapts a recordio.Writer to a recordWriter.
+type recordioWriter struct {
+	w recordio.Writer
+}
+
+func (w *recordioWriter) Append(p []byte) error {
+	// Recordio may retain the record until it is flushed, so we must
+	// copy it: the record's buffer may be reused by the caller.
+	w.w.Append(append([]byte(nil), p...))
+	return w.w.Err()
+}
+
+func (w *recordioWriter) Close() error {
+	return w.w.Finish()
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package recordslice_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/grailbio/base/recordio"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/archive/recordslice"
+	"github.com/grailbio/bigslice/slicetest"
+	"github.com/grailbio/testutil"
+)
+
+const (
+	numRecords = 1000
+	numShards  = 7
+)
+
+func records() []string {
+	recs := make([]string, numRecords)
+	for i := range recs {
+		recs[i] = fmt.Sprintf("record %04d", i)
+	}
+	return recs
+}
+
+func bytesSlice() bigslice.Slice {
+	recs := records()
+	p := make([][]byte, len(recs))
+	for i := range recs {
+		p[i] = []byte(recs[i])
+	}
+	return bigslice.Const(numShards, p)
+}
+
+// readTFRecords reads all of the records of the TFRecord file at path,
+// verifying their checksums.
+func readTFRecords(t *testing.T, path string, compression recordslice.Compression) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch compression {
+	case recordslice.Gzip:
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	case recordslice.Zlib:
+		if r, err = zlib.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []string
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("%s: truncated header", path)
+		}
+		n := binary.LittleEndian.Uint64(data)
+		if got, want := binary.LittleEndian.Uint32(data[8:]), maskedCRC(data[:8]); got != want {
+			t.Fatalf("%s: bad length checksum: got %x, want %x", path, got, want)
+		}
+		data = data[12:]
+		if uint64(len(data)) < n+4 {
+			t.Fatalf("%s: truncated record", path)
+		}
+		rec := data[:n]
+		if got, want := binary.LittleEndian.Uint32(data[n:]), maskedCRC(rec); got != want {
+			t.Fatalf("%s: bad data checksum: got %x, want %x", path, got, want)
+		}
+		recs = append(recs, string(rec))
+		data = data[n+4:]
+	}
+	return recs
+}
+
+func maskedCRC(p []byte) uint32 {
+	crc := crc32.Checksum(p, crc32.MakeTable(crc32.Castagnoli))
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+func checkRecords(t *testing.T, got []string) {
+	t.Helper()
+	sort.Strings(got)
+	want := records()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("record %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTFRecordWriter(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	for _, compression := range []recordslice.Compression{recordslice.NoCompression, recordslice.Gzip, recordslice.Zlib} {
+		t.Run(fmt.Sprint("compression=", compression), func(t *testing.T) {
+			prefix := filepath.Join(dir, fmt.Sprintf("tfrecord%d", compression))
+			slicetest.Run(t, recordslice.TFRecordWriter(bytesSlice(), prefix, compression))
+			var recs []string
+			for shard := 0; shard < numShards; shard++ {
+				recs = append(recs, readTFRecords(t, recordslice.ShardPath(prefix, shard, numShards), compression)...)
+			}
+			checkRecords(t, recs)
+		})
+	}
+}
+
+func TestTFRecordWriterProto(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	recs := records()
+	msgs := make([]*wrappers.StringValue, len(recs))
+	for i := range recs {
+		msgs[i] = &wrappers.StringValue{Value: recs[i]}
+	}
+	prefix := filepath.Join(dir, "proto")
+	slicetest.Run(t, recordslice.TFRecordWriter(bigslice.Const(numShards, msgs), prefix, recordslice.NoCompression))
+	var got []string
+	for shard := 0; shard < numShards; shard++ {
+		for _, p := range readTFRecords(t, recordslice.ShardPath(prefix, shard, numShards), recordslice.NoCompression) {
+			var msg wrappers.StringValue
+			if err := proto.Unmarshal([]byte(p), &msg); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, msg.Value)
+		}
+	}
+	checkRecords(t, got)
+}
+
+func TestRecordIOWriter(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprint("compress=", compress), func(t *testing.T) {
+			prefix := filepath.Join(dir, fmt.Sprintf("recordio%v", compress))
+			slicetest.Run(t, recordslice.RecordIOWriter(bytesSlice(), prefix, compress))
+			var recs []string
+			for shard := 0; shard < numShards; shard++ {
+				data, err := ioutil.ReadFile(recordslice.ShardPath(prefix, shard, numShards))
+				if err != nil {
+					t.Fatal(err)
+				}
+				scan := recordio.NewScanner(bytes.NewReader(data), recordio.ScannerOpts{})
+				for scan.Scan() {
+					recs = append(recs, string(scan.Get().([]byte)))
+				}
+				if err := scan.Err(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkRecords(t, recs)
+		})
+	}
+}
+
+func TestWriterTypeError(t *testing.T) {
+	for _, slice := range []bigslice.Slice{
+		bigslice.Const(1, []int{1, 2, 3}),
+		bigslice.Const(1, [][]byte{nil}, []int{1}),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected type error", slice)
+				}
+			}()
+			recordslice.TFRecordWriter(slice, "unused", recordslice.NoCompression)
+		}()
+	}
+}
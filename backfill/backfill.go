@@ -0,0 +1,256 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package backfill drives date-partitioned backfills: it runs a
+// bigslice Func that is parameterized by a date once for each date of
+// a range, a bounded number of dates at a time, retrying dates that
+// fail. The dates that have completed are recorded in a progress file,
+// so that a backfill that is interrupted, e.g., because its driver
+// crashed, resumes where it left off when it is run again.
+//
+// For example, to reprocess the first quarter of 2019, four days at a
+// time:
+//
+//	var process = bigslice.Func(func(date time.Time) bigslice.Slice { ... })
+//
+//	err := backfill.Run(ctx, sess, process,
+//		time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+//		time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC),
+//		backfill.Options{Parallelism: 4, Retries: 2, Progress: "s3://bucket/backfill/q1.json"})
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/retry"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
+)
+
+// DateFormat is the format of dates in progress files and errors.
+const DateFormat = "2006-01-02"
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+// retryPolicy determines the wait between attempts to run a date. It
+// is overridden in tests.
+var retryPolicy = retry.Backoff(10*time.Second, 5*time.Minute, 2)
+
+// Options configures a backfill.
+type Options struct {
+	// Parallelism is the maximum number of dates that are run
+	// concurrently. Dates are run one at a time if it is zero.
+	Parallelism int
+	// Retries is the number of times that a date whose run fails is
+	// retried before it is given up on.
+	Retries int
+	// Progress is the path of the file, e.g., a local path or an S3
+	// URL, in which completed dates are recorded. Progress is not
+	// persisted if it is empty.
+	Progress string
+	// Done, if not nil, is called with the result of each date that is
+	// run successfully, e.g., to write its output. The date is recorded
+	// as complete only if Done returns nil; otherwise the date is
+	// retried. Each result is discarded once Done returns.
+	Done func(ctx context.Context, date time.Time, result *exec.Result) error
+}
+
+// Dates returns the dates, i.e., UTC midnights, of the days in the
+// range [start, end).
+func Dates(start, end time.Time) []time.Time {
+	var (
+		dates []time.Time
+		date  = truncateDay(start)
+		last  = end.UTC()
+	)
+	if date.Before(start.UTC()) {
+		date = date.AddDate(0, 0, 1)
+	}
+	for ; date.Before(last); date = date.AddDate(0, 0, 1) {
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Progress is the content of a progress file.
+type Progress struct {
+	// Completed lists the dates that have completed, in DateFormat.
+	Completed []string
+}
+
+// ReadProgress reads the progress file at the provided path. An empty
+// Progress is returned if the file does not exist.
+func ReadProgress(ctx context.Context, path string) (Progress, error) {
+	var p Progress
+	f, err := file.Open(ctx, path)
+	if errors.Is(errors.NotExist, err) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	defer f.Close(ctx) // nolint: errcheck
+	b, err := ioutil.ReadAll(f.Reader(ctx))
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, errors.E(errors.Invalid, "corrupt backfill progress file "+path, err)
+	}
+	return p, nil
+}
+
+func writeProgress(ctx context.Context, path string, p Progress) error {
+	b, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := file.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Writer(ctx).Write(b); err != nil {
+		f.Discard(ctx)
+		return err
+	}
+	return f.Close(ctx)
+}
+
+// Run runs fn, which must take a single time.Time argument, in the
+// provided session, once for each date in [start, end) that has not
+// already completed according to the progress file of opts. Dates are
+// run in order, up to opts.Parallelism at a time. Run returns an error
+// that lists the dates that failed, after all of their retries, once
+// every other date has been run; dates that fail do not prevent others
+// from running. A backfill that fails, or is interrupted, may be
+// resumed by calling Run again with the same progress file.
+func Run(ctx context.Context, sess *exec.Session, fn *bigslice.FuncValue, start, end time.Time, opts Options) error {
+	if fn.NumIn() != 1 || fn.In(0) != typeOfTime {
+		return errors.E(errors.Invalid, "backfill: func must take a single time.Time argument")
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	var progress Progress
+	if opts.Progress != "" {
+		var err error
+		if progress, err = ReadProgress(ctx, opts.Progress); err != nil {
+			return err
+		}
+	}
+	completed := make(map[string]bool)
+	for _, date := range progress.Completed {
+		completed[date] = true
+	}
+	var todo []time.Time
+	for _, date := range Dates(start, end) {
+		if !completed[date.Format(DateFormat)] {
+			todo = append(todo, date)
+		}
+	}
+	log.Printf("backfill: %d dates to run, %d already completed", len(todo), len(completed))
+
+	var (
+		mu     sync.Mutex
+		failed []string
+		dates  = make(chan time.Time)
+		wg     sync.WaitGroup
+	)
+	// record records the outcome of a date, persisting the progress of
+	// the backfill if it completed.
+	record := func(date time.Time, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed = append(failed, date.Format(DateFormat))
+			return nil
+		}
+		progress.Completed = append(progress.Completed, date.Format(DateFormat))
+		sort.Strings(progress.Completed)
+		if opts.Progress == "" {
+			return nil
+		}
+		return writeProgress(ctx, opts.Progress, progress)
+	}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for date := range dates {
+				err := runDate(ctx, sess, fn, date, opts)
+				if err != nil {
+					log.Error.Printf("backfill: %s: %v", date.Format(DateFormat), err)
+				}
+				if err := record(date, err); err != nil {
+					log.Error.Printf("backfill: recording progress of %s: %v", date.Format(DateFormat), err)
+				}
+			}
+		}()
+	}
+	var err error
+	for _, date := range todo {
+		select {
+		case dates <- date:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(dates)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.E(fmt.Sprintf("backfill: %d dates failed: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// runDate runs fn for the provided date, retrying failed runs up to
+// opts.Retries times.
+func runDate(ctx context.Context, sess *exec.Session, fn *bigslice.FuncValue, date time.Time, opts Options) error {
+	for retries := 0; ; retries++ {
+		err := runDateOnce(ctx, sess, fn, date, opts)
+		if err == nil || retries == opts.Retries || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("backfill: %s: attempt %d failed: %v; retrying", date.Format(DateFormat), retries+1, err)
+		if err := retry.Wait(ctx, retryPolicy, retries); err != nil {
+			return err
+		}
+	}
+}
+
+func runDateOnce(ctx context.Context, sess *exec.Session, fn *bigslice.FuncValue, date time.Time, opts Options) error {
+	result, err := sess.Run(ctx, fn, date)
+	if err != nil {
+		return err
+	}
+	defer result.Discard(ctx)
+	if opts.Done != nil {
+		return opts.Done(ctx, date, result)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package backfill
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/retry"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+var (
+	mu sync.Mutex
+	// attempts counts the runs of each date.
+	attempts = make(map[string]int)
+	// failures is the number of times each date fails before it
+	// succeeds.
+	failures = make(map[string]int)
+)
+
+var dateFunc = bigslice.Func(func(date time.Time) bigslice.Slice {
+	key := date.Format(DateFormat)
+	mu.Lock()
+	attempts[key]++
+	fail := attempts[key] <= failures[key]
+	mu.Unlock()
+	return bigslice.ReaderFunc(1, func(shard int, done *bool, dates []string) (int, error) {
+		if fail {
+			return 0, errors.New("injected failure")
+		}
+		if *done {
+			return 0, sliceio.EOF
+		}
+		*done = true
+		dates[0] = key
+		return 1, nil
+	})
+})
+
+func TestDates(t *testing.T) {
+	dates := Dates(time.Date(2019, 1, 30, 12, 0, 0, 0, time.UTC), time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC))
+	var got []string
+	for _, date := range dates {
+		got = append(got, date.Format(DateFormat))
+	}
+	if want := []string{"2019-01-31", "2019-02-01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	save := retryPolicy
+	retryPolicy = retry.Backoff(time.Nanosecond, time.Nanosecond, 1)
+	defer func() { retryPolicy = save }()
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ctx   = context.Background()
+		sess  = exec.Start(exec.Local)
+		start = time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+		end   = time.Date(2019, 3, 6, 0, 0, 0, 0, time.UTC)
+		seen  []string
+		opts  = Options{
+			Parallelism: 2,
+			Retries:     1,
+			Progress:    filepath.Join(dir, "progress.json"),
+			Done: func(ctx context.Context, date time.Time, result *exec.Result) error {
+				scanner := result.Scanner()
+				defer scanner.Close()
+				var key string
+				for scanner.Scan(ctx, &key) {
+					mu.Lock()
+					seen = append(seen, key)
+					mu.Unlock()
+				}
+				return scanner.Err()
+			},
+		}
+	)
+	mu.Lock()
+	failures["2019-03-02"] = 1
+	failures["2019-03-04"] = 10
+	mu.Unlock()
+	err = Run(ctx, sess, dateFunc, start, end, opts)
+	if err == nil || !strings.Contains(err.Error(), "1 dates failed: 2019-03-04") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sort.Strings(seen)
+	if got, want := seen, []string{"2019-03-01", "2019-03-02", "2019-03-03", "2019-03-05"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	progress, err := ReadProgress(ctx, opts.Progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := progress.Completed, seen; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := attempts["2019-03-04"], 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Resuming the backfill runs only the date that failed.
+	mu.Lock()
+	failures["2019-03-04"] = 0
+	seen = nil
+	mu.Unlock()
+	if err := Run(ctx, sess, dateFunc, start, end, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := seen, []string{"2019-03-04"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := attempts["2019-03-01"], 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var stringFunc = bigslice.Func(func(date string) bigslice.Slice {
+	return bigslice.Const(1, []string{date})
+})
+
+func TestRunInvalidFunc(t *testing.T) {
+	sess := exec.Start(exec.Local)
+	if err := Run(context.Background(), sess, stringFunc, time.Now(), time.Now(), Options{}); err == nil {
+		t.Error("expected error")
+	}
+}
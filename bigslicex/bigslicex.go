@@ -0,0 +1,185 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package bigslicex provides a type-parameterized facade for a subset
+// of the bigslice API. Slices are typed by the types of their columns,
+// and the functions that are passed to operators are checked by the
+// compiler, rather than by bigslice's reflection-based type checks
+// when the slices are constructed. Typed slices compile down to
+// ordinary bigslice slices, which are returned by their Untyped
+// methods, e.g., to be passed to other bigslice operators or returned
+// from bigslice.Funcs; Of and OfKV type the slices returned by the
+// untyped API. For example:
+//
+//	counts := bigslice.Func(func(path string) bigslice.Slice {
+//		lines := bigslicex.Of[string](bigslice.ScanReader(8, open(path)))
+//		words := bigslicex.Flatmap(lines, strings.Fields)
+//		ones := bigslicex.MapKV(words, func(w string) (string, int) { return w, 1 })
+//		return bigslicex.Reduce(ones, func(a, b int) int { return a + b }).Untyped()
+//	})
+//
+// Slice is a single-column slice, and KV is a two-column slice keyed
+// by its first column.
+//
+// Since it requires type parameters, bigslicex is a separate module
+// that requires Go 1.18, so that bigslice itself continues to build
+// with earlier versions of Go.
+package bigslicex
+
+import (
+	"reflect"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Slice is a slice with a single column of type T.
+type Slice[T any] struct {
+	slice bigslice.Slice
+}
+
+// Untyped returns the underlying bigslice.Slice.
+func (s Slice[T]) Untyped() bigslice.Slice { return s.slice }
+
+// KV is a slice with a key column of type K, which is its prefix, and
+// a value column of type V.
+type KV[K comparable, V any] struct {
+	slice bigslice.Slice
+}
+
+// Untyped returns the underlying bigslice.Slice.
+func (s KV[K, V]) Untyped() bigslice.Slice { return s.slice }
+
+// Of returns the provided slice as a typed slice. It panics with a
+// type error if the slice does not have a single column of type T.
+// Of is used to type slices that are returned by the untyped API.
+func Of[T any](slice bigslice.Slice) Slice[T] {
+	if slice.NumOut() != 1 || slice.Out(0) != typeOf[T]() {
+		typecheck.Panicf(1, "bigslicex.Of: slice %s is not of type %s", bigslice.String(slice), typeOf[T]())
+	}
+	return Slice[T]{slice}
+}
+
+// OfKV returns the provided slice as a typed key-value slice. It
+// panics with a type error if the slice does not have columns of
+// types K and V.
+func OfKV[K comparable, V any](slice bigslice.Slice) KV[K, V] {
+	if slice.NumOut() != 2 || slice.Out(0) != typeOf[K]() || slice.Out(1) != typeOf[V]() {
+		typecheck.Panicf(1, "bigslicex.OfKV: slice %s is not of types %s, %s", bigslice.String(slice), typeOf[K](), typeOf[V]())
+	}
+	return KV[K, V]{slice}
+}
+
+// Const returns a typed slice with nshard shards of the provided
+// values. See bigslice.Const.
+func Const[T any](nshard int, values []T) Slice[T] {
+	bigslice.Helper()
+	return Slice[T]{bigslice.Const(nshard, values)}
+}
+
+// ConstKV returns a typed key-value slice with nshard shards of the
+// provided keys and values. See bigslice.Const.
+func ConstKV[K comparable, V any](nshard int, keys []K, values []V) KV[K, V] {
+	bigslice.Helper()
+	return KV[K, V]{bigslice.Const(nshard, keys, values)}
+}
+
+// Map returns a slice of the values returned by fn for each value of
+// the provided slice. See bigslice.Map.
+func Map[T, U any](slice Slice[T], fn func(T) U, prags ...bigslice.Pragma) Slice[U] {
+	bigslice.Helper()
+	return Slice[U]{bigslice.Map(slice.slice, fn, prags...)}
+}
+
+// MapKV returns a key-value slice of the keys and values returned by
+// fn for each value of the provided slice. See bigslice.Map.
+func MapKV[T any, K comparable, V any](slice Slice[T], fn func(T) (K, V), prags ...bigslice.Pragma) KV[K, V] {
+	bigslice.Helper()
+	return KV[K, V]{bigslice.Map(slice.slice, fn, prags...)}
+}
+
+// MapValues returns a key-value slice whose values are computed by fn
+// from the values of the provided slice, and whose keys are retained.
+// See bigslice.Map.
+func MapValues[K comparable, V, W any](slice KV[K, V], fn func(V) W, prags ...bigslice.Pragma) KV[K, W] {
+	bigslice.Helper()
+	return KV[K, W]{bigslice.Map(slice.slice, func(k K, v V) (K, W) { return k, fn(v) }, prags...)}
+}
+
+// Filter returns a slice of the values of the provided slice for which
+// pred returns true. See bigslice.Filter.
+func Filter[T any](slice Slice[T], pred func(T) bool, prags ...bigslice.Pragma) Slice[T] {
+	bigslice.Helper()
+	return Slice[T]{bigslice.Filter(slice.slice, pred, prags...)}
+}
+
+// FilterKV returns a key-value slice of the rows of the provided slice
+// for which pred returns true. See bigslice.Filter.
+func FilterKV[K comparable, V any](slice KV[K, V], pred func(K, V) bool, prags ...bigslice.Pragma) KV[K, V] {
+	bigslice.Helper()
+	return KV[K, V]{bigslice.Filter(slice.slice, pred, prags...)}
+}
+
+// Flatmap returns a slice of the values in the Go slices returned by fn
+// for each value of the provided slice. See bigslice.Flatmap.
+func Flatmap[T, U any](slice Slice[T], fn func(T) []U, prags ...bigslice.Pragma) Slice[U] {
+	bigslice.Helper()
+	return Slice[U]{bigslice.Flatmap(slice.slice, fn, prags...)}
+}
+
+// Reduce returns a key-value slice with the values of each key of the
+// provided slice reduced pairwise by fn. See bigslice.Reduce.
+func Reduce[K comparable, V any](slice KV[K, V], fn func(V, V) V) KV[K, V] {
+	bigslice.Helper()
+	return KV[K, V]{bigslice.Reduce(slice.slice, fn)}
+}
+
+// AggregateByKey returns a key-value slice with the values of each key
+// of the provided slice aggregated into accumulators of type A. See
+// bigslice.AggregateByKey.
+func AggregateByKey[K comparable, V, A any](slice KV[K, V], add func(A, V) A, merge func(A, A) A) KV[K, A] {
+	bigslice.Helper()
+	return KV[K, A]{bigslice.AggregateByKey(slice.slice, add, merge)}
+}
+
+// Keys returns a slice of the keys of the provided key-value slice.
+func Keys[K comparable, V any](slice KV[K, V]) Slice[K] {
+	bigslice.Helper()
+	return Slice[K]{bigslice.Map(slice.slice, func(k K, _ V) K { return k })}
+}
+
+// Values returns a slice of the values of the provided key-value
+// slice.
+func Values[K comparable, V any](slice KV[K, V]) Slice[V] {
+	bigslice.Helper()
+	return Slice[V]{bigslice.Map(slice.slice, func(_ K, v V) V { return v })}
+}
+
+// Reshuffle returns a slice that is shuffled by its values. See
+// bigslice.Reshuffle.
+func Reshuffle[T any](slice Slice[T]) Slice[T] {
+	bigslice.Helper()
+	return Slice[T]{bigslice.Reshuffle(slice.slice)}
+}
+
+// ReshuffleKV returns a key-value slice that is shuffled by its keys.
+// See bigslice.Reshuffle.
+func ReshuffleKV[K comparable, V any](slice KV[K, V]) KV[K, V] {
+	bigslice.Helper()
+	return KV[K, V]{bigslice.Reshuffle(slice.slice)}
+}
+
+// Union returns the union of the provided slices. See bigslice.Union.
+func Union[T any](slices ...Slice[T]) Slice[T] {
+	bigslice.Helper()
+	untyped := make([]bigslice.Slice, len(slices))
+	for i := range slices {
+		untyped[i] = slices[i].slice
+	}
+	return Slice[T]{bigslice.Union(untyped...)}
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
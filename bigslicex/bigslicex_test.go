@@ -0,0 +1,66 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicex_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/bigslicex"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestWordCount(t *testing.T) {
+	lines := bigslicex.Const(2, []string{"a b c", "b c", "c", ""})
+	words := bigslicex.Flatmap(lines, strings.Fields)
+	ones := bigslicex.MapKV(words, func(w string) (string, int) { return w, 1 })
+	counts := bigslicex.Reduce(ones, func(a, b int) int { return a + b })
+	counts = bigslicex.FilterKV(counts, func(w string, n int) bool { return n > 1 })
+	var (
+		keys []string
+		vals []int
+	)
+	slicetest.RunAndScan(t, counts.Untyped(), &keys, &vals)
+	sort.Strings(keys)
+	sort.Ints(vals)
+	if got, want := keys, []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := vals, []int{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	var (
+		a    = bigslicex.Const(2, []int{1, 2, 3})
+		b    = bigslicex.Of[int](bigslice.Const(2, []int{4, 5}))
+		all  = bigslicex.Union(a, b)
+		kv   = bigslicex.MapKV(all, func(x int) (bool, int) { return x%2 == 0, x })
+		sums = bigslicex.AggregateByKey(kv,
+			func(acc []int, x int) []int { return append(acc, x) },
+			func(a, b []int) []int { return append(append([]int{}, a...), b...) })
+		lens = bigslicex.Values(bigslicex.MapValues(sums, func(xs []int) int { return len(xs) }))
+	)
+	var vals []int
+	slicetest.RunAndScan(t, lens.Untyped(), &vals)
+	sort.Ints(vals)
+	if got, want := vals, []int{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOfError(t *testing.T) {
+	defer func() {
+		e := recover()
+		if e == nil || !strings.Contains(e.(error).Error(), "is not of type string") {
+			t.Errorf("expected type error, got %v", e)
+		}
+	}()
+	bigslicex.Of[string](bigslice.Const(1, []int{1}))
+}
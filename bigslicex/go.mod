@@ -0,0 +1,35 @@
+module github.com/grailbio/bigslice/bigslicex
+
+go 1.18
+
+require github.com/grailbio/bigslice v0.0.0
+
+require (
+	github.com/Nvveen/Gotty v0.0.0-20120604004816-cd527374f1e5 // indirect
+	github.com/aws/aws-sdk-go v1.29.24 // indirect
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/google/pprof v0.0.0-20190930153522-6ce02741cba3 // indirect
+	github.com/grailbio/base v0.0.9 // indirect
+	github.com/grailbio/bigmachine v0.5.7 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/shirou/gopsutil v2.19.9+incompatible // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	go.opentelemetry.io/otel v1.7.0 // indirect
+	go.opentelemetry.io/otel/trace v1.7.0 // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e // indirect
+	golang.org/x/sys v0.0.0-20200331124033-c3d80250170d // indirect
+	golang.org/x/text v0.3.2 // indirect
+	golang.org/x/time v0.0.0-20190921001708-c4c64cad1fd0 // indirect
+	google.golang.org/genproto v0.0.0-20191007204434-a023cd5227bd // indirect
+	google.golang.org/grpc v1.27.0 // indirect
+	gopkg.in/yaml.v2 v2.2.4 // indirect
+	v.io v0.1.8 // indirect
+	v.io/x/lib v0.1.5 // indirect
+)
+
+replace github.com/grailbio/bigslice => ../
@@ -0,0 +1,243 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/bloom"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var typeOfBloomFilter = reflect.TypeOf((*bloom.Filter)(nil))
+
+// BloomFilter returns a slice that contains the rows of the provided
+// slice whose keys may appear in the keys slice, which is expected to
+// contain about n distinct keys. Keys are the prefix columns of each
+// slice, as in Join; the slices must have the same key types. Rows
+// whose keys do not appear in the keys slice are dropped, except for
+// about 1% of them, which are false positives.
+//
+// BloomFilter builds a Bloom filter of the keys of each shard of the
+// keys slice, merges them in a single shard, and broadcasts the merged
+// filter to each shard of the provided slice, which is filtered as it
+// is computed, without being shuffled. It is thus used to reduce the
+// number of rows of a large slice that are shuffled by a selective
+// join with a smaller, but not broadcastable, slice:
+//
+//	Join(BloomFilter(large, small, n), small)
+//
+// Only the keys of the keys slice are read. The returned slice retains
+// the shards and the prefix of the provided slice.
+func BloomFilter(slice, keys Slice, n int) Slice {
+	if n <= 0 {
+		typecheck.Panicf(1, "bloomfilter: n must be positive, got %d", n)
+	}
+	if got, want := keys.Prefix(), slice.Prefix(); got != want {
+		typecheck.Panicf(1, "bloomfilter: prefix mismatch: expected %d but got %d", want, got)
+	}
+	for i := 0; i < slice.Prefix(); i++ {
+		if got, want := keys.Out(i), slice.Out(i); got != want {
+			typecheck.Panicf(1, "bloomfilter: key column type mismatch: expected %s but got %s", want, got)
+		}
+		if !frame.CanHash(slice.Out(i)) {
+			typecheck.Panicf(1, "bloomfilter: key column(%d) type %s cannot be hashed", i, slice.Out(i))
+		}
+	}
+	name := MakeName("bloomfilter")
+	shards := &bloomSketchSlice{name, keyColumns(keys), n, false}
+	filter := &bloomSketchSlice{name, shards, n, true}
+	return &bloomFilterSlice{name, slice, filter}
+}
+
+// A bloomSketchSlice emits a Bloom filter of the keys of each shard of
+// its dependency, keyed by a constant. If merge is true, the
+// dependency, itself a bloomSketchSlice, is shuffled to a single
+// shard, which emits the union of its filters.
+type bloomSketchSlice struct {
+	name Name
+	Slice
+	n     int
+	merge bool
+}
+
+func (b *bloomSketchSlice) Name() Name             { return b.name }
+func (*bloomSketchSlice) NumOut() int              { return 2 }
+func (*bloomSketchSlice) Prefix() int              { return 1 }
+func (*bloomSketchSlice) NumDep() int              { return 1 }
+func (b *bloomSketchSlice) Dep(i int) Dep          { return singleDep(i, b.Slice, b.merge) }
+func (*bloomSketchSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (*bloomSketchSlice) Out(c int) reflect.Type {
+	if c == 0 {
+		return typeOfInt
+	}
+	return typeOfBloomFilter
+}
+
+func (b *bloomSketchSlice) NumShard() int {
+	if b.merge {
+		return 1
+	}
+	return b.Slice.NumShard()
+}
+
+func (b *bloomSketchSlice) ShardType() ShardType {
+	if b.merge {
+		return HashShard
+	}
+	return b.Slice.ShardType()
+}
+
+// MaxRows implements Sizer.
+func (b *bloomSketchSlice) MaxRows() int {
+	if b.merge {
+		return 1
+	}
+	return b.Slice.NumShard()
+}
+
+func (b *bloomSketchSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &bloomSketchReader{op: b, reader: deps[0]}
+}
+
+type bloomSketchReader struct {
+	op     *bloomSketchSlice
+	reader sliceio.Reader
+	err    error
+}
+
+func (r *bloomSketchReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 1024
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if out.Len() == 0 {
+		return 0, nil
+	}
+	var (
+		filter = bloom.New(r.op.n, bloom.FalsePositiveRate)
+		in     = frame.Make(r.op.Slice, bufferSize, bufferSize)
+	)
+	for {
+		n, err := r.reader.Read(ctx, in)
+		for i := 0; i < n; i++ {
+			if r.op.merge {
+				filter.MergeFrom(in.Index(1, i).Interface().(*bloom.Filter))
+			} else {
+				filter.Add(in, i)
+			}
+		}
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+	out.Index(1, 0).Set(reflect.ValueOf(filter))
+	r.err = sliceio.EOF
+	return 1, nil
+}
+
+// A bloomFilterSlice filters the rows of its slice by the Bloom filter
+// of its broadcast filter slice.
+type bloomFilterSlice struct {
+	name Name
+	Slice
+	filter *bloomSketchSlice
+}
+
+func (b *bloomFilterSlice) Name() Name             { return b.name }
+func (*bloomFilterSlice) NumDep() int              { return 2 }
+func (*bloomFilterSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (b *bloomFilterSlice) Dep(i int) Dep {
+	if i == 0 {
+		return Dep{b.Slice, false, nil, false, false}
+	}
+	return Dep{b.filter, false, nil, false, true}
+}
+
+// MaxRows implements Sizer.
+func (b *bloomFilterSlice) MaxRows() int { return maxRows(b.Slice) }
+
+func (b *bloomFilterSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &bloomFilterReader{op: b, reader: deps[0], filterReader: deps[1]}
+}
+
+type bloomFilterReader struct {
+	op                   *bloomFilterSlice
+	reader, filterReader sliceio.Reader
+	filter               *bloom.Filter
+	in                   frame.Frame
+	err                  error
+}
+
+func (r *bloomFilterReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.filter == nil {
+		if r.err = r.readFilter(ctx); r.err != nil {
+			return 0, r.err
+		}
+	}
+	var (
+		m   int
+		max = out.Len()
+	)
+	for m < max && r.err == nil {
+		if r.in.IsZero() {
+			r.in = frame.Make(r.op, max-m, max-m)
+		} else {
+			r.in = r.in.Ensure(max - m)
+		}
+		var n int
+		n, r.err = r.reader.Read(ctx, r.in)
+		for i := 0; i < n; i++ {
+			if r.filter.MayContain(r.in, i) {
+				frame.Copy(out.Slice(m, m+1), r.in.Slice(i, i+1))
+				m++
+			}
+		}
+	}
+	return m, r.err
+}
+
+// readFilter reads the merged filter from the reader's broadcast
+// dependency, whose single shard emits exactly one filter.
+func (r *bloomFilterReader) readFilter(ctx context.Context) error {
+	filters := frame.Make(r.op.filter, 1, 1)
+	for {
+		n, err := r.filterReader.Read(ctx, filters)
+		if n > 0 {
+			r.filter = filters.Index(1, 0).Interface().(*bloom.Filter)
+		}
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.filter == nil {
+		return errors.E(errors.Fatal, errors.Invalid, "bloomfilter: missing filter")
+	}
+	return nil
+}
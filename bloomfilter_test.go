@@ -0,0 +1,65 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const N = 10000
+	keys := make([]string, N)
+	vals := make([]int, N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i % 1000)
+		vals[i] = i
+	}
+	small := bigslice.Const(2, []string{"1", "2", "3", "999"}, []string{"one", "two", "three", "nine"})
+	for nshard := 1; nshard < 4; nshard++ {
+		large := bigslice.Const(nshard, keys, vals)
+		filtered := bigslice.BloomFilter(large, small, 4)
+		if got, want := filtered.NumShard(), nshard; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		var (
+			gotKeys []string
+			gotVals []int
+		)
+		slicetest.RunAndScan(t, filtered, &gotKeys, &gotVals)
+		counts := make(map[string]int)
+		for _, key := range gotKeys {
+			counts[key]++
+		}
+		for _, key := range []string{"1", "2", "3", "999"} {
+			if got, want := counts[key], N/1000; got != want {
+				t.Errorf("key %s: got %v, want %v", key, got, want)
+			}
+		}
+		// About 1% of the other keys are false positives.
+		if got, max := len(counts), 4+50; got > max {
+			t.Errorf("got %v distinct keys, want at most %v", got, max)
+		}
+		// Filtering does not change the result of the join.
+		joined := bigslice.Join(filtered, small)
+		joined = bigslice.Map(joined, func(k string, v int, s string) (string, int) { return s, 1 })
+		joined = bigslice.Reduce(joined, func(a, b int) int { return a + b })
+		assertEqual(t, joined, true, []string{"nine", "one", "three", "two"}, []int{10, 10, 10, 10})
+	}
+}
+
+func TestBloomFilterError(t *testing.T) {
+	var (
+		a = bigslice.Const(1, []string{"x"}, []int{1})
+		b = bigslice.Const(1, []int{1}, []int{1})
+		c = bigslice.Prefixed(bigslice.Const(1, []string{"x"}, []int{1}), 2)
+	)
+	expectTypeError(t, "bloomfilter: key column type mismatch: expected string but got int", func() { bigslice.BloomFilter(a, b, 1) })
+	expectTypeError(t, "bloomfilter: prefix mismatch: expected 1 but got 2", func() { bigslice.BloomFilter(a, c, 1) })
+	expectTypeError(t, "bloomfilter: n must be positive, got 0", func() { bigslice.BloomFilter(a, a, 0) })
+}
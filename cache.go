@@ -6,11 +6,14 @@ package bigslice
 
 import (
 	"context"
+	"reflect"
 
+	"github.com/grailbio/bigslice/frame"
 	"github.com/grailbio/bigslice/internal/slicecache"
 	"github.com/grailbio/bigslice/slicefunc"
 	"github.com/grailbio/bigslice/sliceio"
 	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
 )
 
 type cacheSlice struct {
@@ -23,12 +26,44 @@ var _ slicecache.Cacheable = (*cacheSlice)(nil)
 
 func (c *cacheSlice) Name() Name                                             { return c.name }
 func (c *cacheSlice) NumDep() int                                            { return 1 }
-func (c *cacheSlice) Dep(i int) Dep                                          { return Dep{c.Slice, false, nil, false} }
+func (c *cacheSlice) Dep(i int) Dep                                          { return Dep{c.Slice, false, nil, false, false} }
 func (*cacheSlice) Combiner() slicefunc.Func                                 { return slicefunc.Nil }
 func (c *cacheSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader { return deps[0] }
 
 func (c *cacheSlice) Cache() slicecache.ShardCache { return c.cache }
 
+// A CacheOption configures a cache written by Cache or CachePartial.
+type CacheOption func(*slicecache.FileShardCache)
+
+// IndexKeys configures a cache to write, along with each shard's data
+// file, a sidecar file named "prefix-nnnn-of-mmmm.bloom" that contains a
+// Bloom filter of the keys (prefix columns) of the shard's records.
+// ReadCacheKeys uses these to skip shards that do not contain the keys
+// that are looked up. Key lookups thus read only a small fraction of a
+// large cache when the cached slice's shards have mostly disjoint
+// keys, e.g., because it was reduced or reshuffled.
+var IndexKeys CacheOption = (*slicecache.FileShardCache).IndexKeys
+
+// AddedColumn declares that column col of a cached slice was added
+// after some of its cached data may have been written. Cached shards
+// whose stored schemas lack the column, but otherwise match the
+// slice's type, are read with value in the column, instead of failing
+// with a schema mismatch. A nil value denotes nulls, and is permitted
+// only for nullable columns (see slicetype.WithNullable). For example,
+// a cache of a slice to which a third column of type float64 was
+// added may be reused by:
+//
+//	bigslice.Cache(ctx, slice, prefix, bigslice.AddedColumn(2, 1.0))
+func AddedColumn(col int, value interface{}) CacheOption {
+	return func(c *slicecache.FileShardCache) {
+		if err := c.AddColumn(col, value); err != nil {
+			// Report the error at the caller of the function to which the
+			// option was passed.
+			typecheck.Panicf(2, "addedcolumn: %v", err)
+		}
+	}
+}
+
 // Cache caches the output of a slice to the given file prefix.
 // Cached data are stored as "prefix-nnnn-of-mmmm" for shards nnnn of
 // mmmm. When the slice is computed, each shard is encoded and
@@ -40,11 +75,22 @@ func (c *cacheSlice) Cache() slicecache.ShardCache { return c.cache }
 // cached files, or picking a different prefix that correctly
 // represents the operation to be cached.
 //
+// The schema of each cached shard, i.e., the types, names, and
+// nullability of its columns, is stored in a sidecar file named
+// "prefix-nnnn-of-mmmm.schema". Cached shards whose stored schemas do
+// not match the slice's type fail to be read with an error that
+// describes the differences, unless the differences are columns that
+// were declared to be added by AddedColumn.
+//
 // Cache uses GRAIL's file library, so prefix may refer to URLs to a
 // distributed object store such as S3.
-func Cache(ctx context.Context, slice Slice, prefix string) Slice {
+func Cache(ctx context.Context, slice Slice, prefix string, opts ...CacheOption) Slice {
 	shardCache := slicecache.NewFileShardCache(ctx, prefix, slice.NumShard())
 	shardCache.RequireAllCached()
+	shardCache.SetType(slice)
+	for _, opt := range opts {
+		opt(shardCache)
+	}
 	return &cacheSlice{MakeName("cache"), slice, shardCache}
 }
 
@@ -60,8 +106,12 @@ func Cache(ctx context.Context, slice Slice, prefix string) Slice {
 // of a modifiable file in S3, CachePartial produces corrupt results.
 //
 // As with Cache, the user must guarantee cache consistency.
-func CachePartial(ctx context.Context, slice Slice, prefix string) Slice {
+func CachePartial(ctx context.Context, slice Slice, prefix string, opts ...CacheOption) Slice {
 	shardCache := slicecache.NewFileShardCache(ctx, prefix, slice.NumShard())
+	shardCache.SetType(slice)
+	for _, opt := range opts {
+		opt(shardCache)
+	}
 	return &cacheSlice{MakeName("cachepartial"), slice, shardCache}
 }
 
@@ -70,6 +120,8 @@ type readCacheSlice struct {
 	name     Name
 	numShard int
 	cache    *slicecache.FileShardCache
+	// keys, if not zero, are the keys of the records to read.
+	keys frame.Frame
 }
 
 func (r *readCacheSlice) Name() Name             { return r.name }
@@ -80,6 +132,9 @@ func (*readCacheSlice) Dep(i int) Dep            { panic("no deps") }
 func (*readCacheSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
 
 func (r *readCacheSlice) Reader(shard int, _ []sliceio.Reader) sliceio.Reader {
+	if !r.keys.IsZero() {
+		return r.cache.LookupReader(shard, r.keys)
+	}
 	return r.cache.CacheReader(shard)
 }
 
@@ -87,9 +142,49 @@ func (r *readCacheSlice) Reader(shard int, _ []sliceio.Reader) sliceio.Reader {
 // This may be useful if you want to reuse a cache from a previous computation
 // and fail if it does not exist. typ is the type of the cached and returned
 // slice. You may construct typ using slicetype.New or pass a Slice, which
-// embeds slicetype.Type.
-func ReadCache(ctx context.Context, typ slicetype.Type, numShard int, prefix string) Slice {
+// embeds slicetype.Type. As with Cache, the stored schemas of the
+// cached shards must match typ, except for columns that are declared
+// to be added by AddedColumn options.
+func ReadCache(ctx context.Context, typ slicetype.Type, numShard int, prefix string, opts ...CacheOption) Slice {
+	shardCache := slicecache.NewFileShardCache(ctx, prefix, numShard)
+	shardCache.RequireAllCached()
+	shardCache.SetType(typ)
+	for _, opt := range opts {
+		opt(shardCache)
+	}
+	return &readCacheSlice{typ, MakeName("readcache"), numShard, shardCache, frame.Frame{}}
+}
+
+// ReadCacheKeys reads from an existing cache, as ReadCache does, only
+// the records whose keys are among the provided keys. Each of keys is
+// a Go slice containing the values of a key (prefix) column of typ, so
+// that the i'th key comprises the i'th element of each of the slices.
+// For example, given a cache of type (string, int), the records with
+// keys "a" and "b" are read by:
+//
+//	bigslice.ReadCacheKeys(ctx, typ, numShard, prefix, []string{"a", "b"})
+//
+// If the cache was written with IndexKeys, shards whose key indexes show
+// that they contain none of the keys are not read at all. Caches without
+// indexes are scanned in full.
+//
+// The files written by exec.Checkpoint, which is configured with
+// exec.CheckpointIndexKeys, may also be read by ReadCacheKeys: the
+// prefix of a checkpointed task's output is its invocation's checkpoint
+// directory joined with the task's operation name.
+func ReadCacheKeys(ctx context.Context, typ slicetype.Type, numShard int, prefix string, keys ...interface{}) Slice {
+	if len(keys) != typ.Prefix() {
+		typecheck.Panicf(1, "readcachekeys: expected %d key columns, got %d", typ.Prefix(), len(keys))
+	}
+	for i, key := range keys {
+		keyType := reflect.TypeOf(key)
+		if keyType == nil || keyType.Kind() != reflect.Slice || keyType.Elem() != typ.Out(i) {
+			typecheck.Panicf(1, "readcachekeys: key column %d: expected []%s, got %v", i, typ.Out(i), keyType)
+		}
+	}
 	shardCache := slicecache.NewFileShardCache(ctx, prefix, numShard)
 	shardCache.RequireAllCached()
-	return &readCacheSlice{typ, MakeName("readcache"), numShard, shardCache}
+	shardCache.SetType(typ)
+	f := frame.Slices(keys...).Prefixed(len(keys))
+	return &readCacheSlice{typ, MakeName("readcachekeys"), numShard, shardCache, f}
 }
@@ -5,10 +5,13 @@ package bigslice_test
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/grailbio/base/errors"
@@ -41,6 +44,29 @@ func TestCache(t *testing.T) {
 	runTestCache(t, makeSlice)
 }
 
+// TestCheckpoint verifies that checkpointed slices are written to and
+// read from their prefixes as caches are.
+func TestCheckpoint(t *testing.T) {
+	makeSlice := func(n, nShard int, dir string, computeAllowed bool) bigslice.Slice {
+		input := make([]int, n)
+		for i := range input {
+			input[i] = i
+		}
+		slice := bigslice.Const(nShard, input)
+		slice = bigslice.Map(slice, func(i int) int {
+			if !computeAllowed {
+				panic("compute not allowed")
+			}
+			return i * 2
+		})
+		return bigslice.Checkpoint(context.Background(), slice, filepath.Join(dir, "checkpoint"))
+	}
+	runTestCache(t, makeSlice)
+	expectTypeError(t, "checkpoint: prefix must be nonempty", func() {
+		bigslice.Checkpoint(context.Background(), bigslice.Const(1, []int{1}), "")
+	})
+}
+
 // TestCacheDeps verifies that caching works when pipelined tasks have non-empty
 // dependencies. When the cache is valid, we do not need to read from these
 // dependencies. Verify that this does not break compilation or execution (e.g.
@@ -327,6 +353,75 @@ func TestReadCache(t *testing.T) {
 	}
 }
 
+// TestReadCacheKeys verifies that ReadCacheKeys reads only the records with
+// the provided keys, and uses key indexes to skip shards.
+func TestReadCacheKeys(t *testing.T) {
+	dir, cleanUp := testutil.TempDir(t, "", "")
+	defer cleanUp()
+	prefix := filepath.Join(dir, "cached")
+	ctx := context.Background()
+
+	const (
+		N      = 10000
+		Nshard = 10
+	)
+	keys := make([]int, N)
+	vals := make([]string, N)
+	for i := range keys {
+		keys[i] = i
+		vals[i] = fmt.Sprint(i)
+	}
+	slice := bigslice.Const(Nshard, keys, vals)
+	slice = bigslice.Cache(ctx, slice, prefix, bigslice.IndexKeys)
+	runLocal(ctx, t, slice).Close()
+	for shard := 0; shard < Nshard; shard++ {
+		path := fmt.Sprintf("%s-%04d-of-%04d.bloom", prefix, shard, Nshard)
+		if _, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Corrupt a shard that does not contain the keys that are looked up:
+	// it must be skipped by virtue of its index.
+	if err := ioutil.WriteFile(fmt.Sprintf("%s-0004-of-%04d", prefix, Nshard), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := bigslice.ReadCacheKeys(ctx, slice, Nshard, prefix, []int{5, 9995, 9995, N + 1})
+	scan := runLocal(ctx, t, lookup)
+	defer scan.Close()
+	var (
+		k       int
+		v       string
+		gotKeys []int
+	)
+	for scan.Scan(ctx, &k, &v) {
+		if got, want := v, fmt.Sprint(k); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		gotKeys = append(gotKeys, k)
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(gotKeys)
+	if got, want := gotKeys, []int{5, 9995}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Without indexes, lookups scan every shard.
+	for shard := 0; shard < Nshard; shard++ {
+		if err := os.Remove(fmt.Sprintf("%s-%04d-of-%04d.bloom", prefix, shard, Nshard)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fn := bigslice.Func(func() bigslice.Slice { return lookup })
+	sess := exec.Start(exec.Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(ctx, fn); err == nil {
+		t.Error("expected error reading corrupt shard")
+	}
+}
+
 // TestReadCacheError verifies that a ReadCache reader returns an error if the
 // cache does not exist.
 func TestReadCacheError(t *testing.T) {
@@ -346,6 +441,69 @@ func TestReadCacheError(t *testing.T) {
 	}
 }
 
+// TestCacheSchema verifies that caches are read only by slices whose
+// types match the caches' stored schemas, or differ by declared added
+// columns.
+func TestCacheSchema(t *testing.T) {
+	dir, cleanUp := testutil.TempDir(t, "", "")
+	defer cleanUp()
+	var (
+		prefix = filepath.Join(dir, "cached")
+		ctx    = context.Background()
+		keys   = []string{"a", "b", "c"}
+		vals   = []int{1, 2, 3}
+	)
+	slice := bigslice.Const(2, keys, vals)
+	slice = bigslice.Cache(ctx, slice, prefix)
+	runLocal(ctx, t, slice).Close()
+	if _, err := os.Stat(prefix + "-0000-of-0002.schema"); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		typString  = reflect.TypeOf("")
+		typInt     = reflect.TypeOf(0)
+		typFloat64 = reflect.TypeOf(0.0)
+	)
+	err := slicetest.RunErr(bigslice.ReadCache(ctx, slicetype.New(typString, typFloat64), 2, prefix))
+	if err == nil {
+		t.Fatal("expected schema mismatch")
+	}
+	if got, want := err.Error(), "column 1: stored int, slice has float64"; !strings.Contains(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	typ := slicetype.New(typString, typInt, typFloat64)
+	err = slicetest.RunErr(bigslice.ReadCache(ctx, typ, 2, prefix))
+	if err == nil {
+		t.Fatal("expected schema mismatch")
+	}
+	if got, want := err.Error(), "column 2: float64 is not stored"; !strings.Contains(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Declared added columns are read with their defaults.
+	evolved := bigslice.ReadCache(ctx, typ, 2, prefix, bigslice.AddedColumn(2, 0.5))
+	assertEqual(t, evolved, true, keys, vals, []float64{0.5, 0.5, 0.5})
+	err = slicetest.RunErr(bigslice.ReadCache(ctx, typ, 2, prefix, bigslice.AddedColumn(1, 0)))
+	if err == nil {
+		t.Fatal("expected schema mismatch")
+	}
+	expectTypeError(t, "addedcolumn: default value of type string is not assignable to column 2 of type float64", func() {
+		bigslice.ReadCache(ctx, typ, 2, prefix, bigslice.AddedColumn(2, "x"))
+	})
+	expectTypeError(t, "addedcolumn: column 2 of type float64 is not nullable, and cannot default to null", func() {
+		bigslice.ReadCache(ctx, typ, 2, prefix, bigslice.AddedColumn(2, nil))
+	})
+
+	// Caches without schemas are not checked.
+	for shard := 0; shard < 2; shard++ {
+		if err := os.Remove(fmt.Sprintf("%s-%04d-of-0002.schema", prefix, shard)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, bigslice.ReadCache(ctx, slice, 2, prefix), true, keys, vals)
+}
+
 func ls1(t *testing.T, dir string) []string {
 	t.Helper()
 	d, err := os.Open(dir)
@@ -356,9 +514,12 @@ func ls1(t *testing.T, dir string) []string {
 	if err != nil {
 		t.Fatal(err)
 	}
-	paths := make([]string, len(infos))
-	for i := range paths {
-		paths[i] = infos[i].Name()
+	var paths []string
+	for _, info := range infos {
+		// Count only data files, and not their schema sidecars.
+		if !strings.HasSuffix(info.Name(), ".schema") {
+			paths = append(paths, info.Name())
+		}
 	}
 	sort.Strings(paths)
 	return paths
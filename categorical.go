@@ -0,0 +1,305 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+	"github.com/spaolacci/murmur3"
+)
+
+// A Category is a value of a categorical column: it is the integer
+// code of one of the string values of a Dictionary. Categorical
+// columns are stored, shuffled, hashed, and compared as integers, and
+// so are much cheaper than string columns with few distinct values.
+// Categories are ordered as their string values are.
+type Category uint32
+
+var typeOfCategory = reflect.TypeOf(Category(0))
+
+func init() {
+	frame.RegisterOps(func(slice []Category) frame.Ops {
+		return frame.Ops{
+			Less: func(i, j int) bool { return slice[i] < slice[j] },
+			HashWithSeed: func(i int, seed uint32) uint32 {
+				var b [4]byte
+				binary.LittleEndian.PutUint32(b[:], uint32(slice[i]))
+				return murmur3.Sum32WithSeed(b[:], seed)
+			},
+		}
+	})
+}
+
+// A Dictionary is a dictionary of the string values of categorical
+// columns that is shared by the slices of a pipeline. Its values need
+// not be declared: they are the distinct values of all of the columns
+// that are converted by Categorize with the dictionary, which are
+// computed as the pipeline runs, before any of them is converted. Each
+// value is coded by its index in the sorted set of values, so that
+// codes are ordered as values are, and so that every shard of every
+// slice of the pipeline codes a value identically: categorical columns
+// of different sources may thus be joined, grouped, and compared with
+// one another, and they are restored to their values at the pipeline's
+// sinks by Decategorize.
+//
+// A dictionary belongs to the invocation of the Func that creates it,
+// and its sources must all be categorized before any slice that uses
+// it is run.
+type Dictionary struct {
+	mu sync.Mutex
+	// sources are the (single-column) slices of the values that are
+	// converted with the dictionary.
+	sources []Slice
+	// values is the slice of the distinct values of the sources. It is
+	// made when it is first used, after which no sources may be added.
+	values Slice
+}
+
+// NewDictionary returns a new, empty dictionary.
+func NewDictionary() *Dictionary {
+	return new(Dictionary)
+}
+
+// add adds the provided source to the dictionary. It returns false if
+// the dictionary is already in use.
+func (d *Dictionary) add(source Slice) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.values != nil {
+		return false
+	}
+	d.sources = append(d.sources, source)
+	return true
+}
+
+// slice returns the slice of the dictionary's distinct values, which
+// is read in full by every shard that converts values.
+func (d *Dictionary) slice() Slice {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.values == nil {
+		if len(d.sources) == 0 {
+			d.values = Const(1, []string{})
+		} else {
+			d.values = Distinct(Union(d.sources...))
+		}
+	}
+	return d.values
+}
+
+// Categorize returns a slice in which the provided string columns of
+// slice are converted to categorical columns, coded by the provided
+// dictionary; if no columns are provided, all of the slice's string
+// columns are converted. Categorize is applied at a pipeline's
+// sources, so that their string values are thereafter stored,
+// shuffled, and compared as integers; their values are added to the
+// dictionary, so that every value is coded. The values are restored at
+// the pipeline's sinks by Decategorize. The returned slice retains the
+// prefix of slice. Schematically:
+//
+//	Categorize(Slice<t1, ..., string, ..., tn>, dict, col) Slice<t1, ..., Category, ..., tn>
+//
+// The dictionary is computed from slice, which is thus read twice: it
+// should be cheap to compute, or else materialized (see
+// ExperimentalMaterialize).
+func Categorize(slice Slice, dict *Dictionary, cols ...int) Slice {
+	if len(cols) == 0 {
+		for col := 0; col < slice.NumOut(); col++ {
+			if slice.Out(col) == typeOfString {
+				cols = append(cols, col)
+			}
+		}
+		if len(cols) == 0 {
+			typecheck.Panicf(1, "categorize: slice %s has no string columns", slicetype.String(slice))
+		}
+	}
+	for _, col := range cols {
+		if col < 0 || col >= slice.NumOut() {
+			typecheck.Panicf(1, "categorize: column %d out of range for slice %s", col, slicetype.String(slice))
+		}
+		if typ := slice.Out(col); typ != typeOfString {
+			typecheck.Panicf(1, "categorize: column %d has type %s, not string", col, typ)
+		}
+	}
+	for _, col := range cols {
+		if !dict.add(SelectColumns(slice, col)) {
+			typecheck.Panic(1, "categorize: dictionary is already in use by a running pipeline")
+		}
+	}
+	return makeCategorySlice("categorize", slice, dict, cols, typeOfCategory)
+}
+
+// Decategorize returns a slice in which the provided categorical
+// columns of slice are converted back to the string values of the
+// provided dictionary, e.g., at the sinks of a pipeline whose sources
+// are converted by Categorize; if no columns are provided, all of the
+// slice's categorical columns are converted. The returned slice
+// retains the prefix of slice. Schematically:
+//
+//	Decategorize(Slice<t1, ..., Category, ..., tn>, dict, col) Slice<t1, ..., string, ..., tn>
+func Decategorize(slice Slice, dict *Dictionary, cols ...int) Slice {
+	if len(cols) == 0 {
+		for col := 0; col < slice.NumOut(); col++ {
+			if slice.Out(col) == typeOfCategory {
+				cols = append(cols, col)
+			}
+		}
+		if len(cols) == 0 {
+			typecheck.Panicf(1, "decategorize: slice %s has no categorical columns", slicetype.String(slice))
+		}
+	}
+	for _, col := range cols {
+		if col < 0 || col >= slice.NumOut() {
+			typecheck.Panicf(1, "decategorize: column %d out of range for slice %s", col, slicetype.String(slice))
+		}
+		if typ := slice.Out(col); typ != typeOfCategory {
+			typecheck.Panicf(1, "decategorize: column %d has type %s, not %s", col, typ, typeOfCategory)
+		}
+	}
+	return makeCategorySlice("decategorize", slice, dict, cols, typeOfString)
+}
+
+// categorySlice converts columns of its first dependency to or from
+// categories, coded by the dictionary that is its second, broadcast,
+// dependency.
+type categorySlice struct {
+	name Name
+	Slice
+	dict *Dictionary
+	cols []int
+	out  slicetype.Type
+}
+
+func makeCategorySlice(op string, slice Slice, dict *Dictionary, cols []int, typ reflect.Type) Slice {
+	out := append([]reflect.Type(nil), slicetype.Columns(slice)...)
+	for _, col := range cols {
+		out[col] = typ
+	}
+	return &categorySlice{
+		name:  MakeName(op),
+		Slice: slice,
+		dict:  dict,
+		cols:  append([]int(nil), cols...),
+		out:   slicetype.New(out...),
+	}
+}
+
+func (s *categorySlice) Name() Name             { return s.name }
+func (s *categorySlice) NumOut() int            { return s.out.NumOut() }
+func (s *categorySlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (*categorySlice) ShardType() ShardType     { return HashShard }
+func (*categorySlice) NumDep() int              { return 2 }
+func (*categorySlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *categorySlice) MaxRows() int           { return maxRows(s.Slice) }
+
+func (s *categorySlice) Dep(i int) Dep {
+	switch i {
+	case 0:
+		return Dep{s.Slice, false, nil, false, false}
+	case 1:
+		return Dep{s.dict.slice(), false, nil, false, true}
+	}
+	panic(fmt.Sprintf("invalid dependency %d", i))
+}
+
+func (s *categorySlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &categoryReader{op: s, reader: deps[0], dict: deps[1]}
+}
+
+type categoryReader struct {
+	op           *categorySlice
+	reader, dict sliceio.Reader
+	// values and codes are the dictionary's sorted values and their
+	// codes, loaded on the first read.
+	values []string
+	codes  map[string]Category
+	// in holds buffers for the unconverted columns.
+	in []reflect.Value
+}
+
+// load reads the dictionary's values.
+func (r *categoryReader) load(ctx context.Context) error {
+	buf := frame.Make(slicetype.New(typeOfString), defaultChunksize, defaultChunksize)
+	for {
+		n, err := r.dict.Read(ctx, buf)
+		if err != nil && err != sliceio.EOF {
+			return err
+		}
+		r.values = append(r.values, buf.Value(0).Interface().([]string)[:n]...)
+		if err == sliceio.EOF {
+			break
+		}
+	}
+	sort.Strings(r.values)
+	r.codes = make(map[string]Category, len(r.values))
+	values := r.values[:0]
+	for _, v := range r.values {
+		if _, ok := r.codes[v]; ok {
+			continue
+		}
+		r.codes[v] = Category(len(values))
+		values = append(values, v)
+	}
+	r.values = values
+	return nil
+}
+
+func (r *categoryReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.codes == nil {
+		if err := r.load(ctx); err != nil {
+			return 0, err
+		}
+		r.in = make([]reflect.Value, len(r.op.cols))
+	}
+	n := out.Len()
+	// Read all other columns directly into the output frame.
+	cols := out.Values()
+	outCols := make([]reflect.Value, len(r.op.cols))
+	for i, col := range r.op.cols {
+		if !r.in[i].IsValid() || r.in[i].Len() < n {
+			r.in[i] = reflect.MakeSlice(reflect.SliceOf(r.op.Slice.Out(col)), n, n)
+		}
+		outCols[i] = cols[col]
+		cols[col] = r.in[i].Slice(0, n)
+	}
+	n, err := r.reader.Read(ctx, frame.Values(cols))
+	categorize := r.op.out.Out(r.op.cols[0]) == typeOfCategory
+	for i := range r.op.cols {
+		in, col := r.in[i], outCols[i]
+		for j := 0; j < n; j++ {
+			if categorize {
+				v := in.Index(j).String()
+				code, ok := r.codes[v]
+				if !ok {
+					return 0, errors.E(errors.Fatal, errors.Invalid,
+						fmt.Sprintf("categorize: value %q is not in the dictionary", v))
+				}
+				col.Index(j).SetUint(uint64(code))
+				continue
+			}
+			code := Category(in.Index(j).Uint())
+			if int(code) >= len(r.values) {
+				return 0, errors.E(errors.Fatal, errors.Invalid,
+					fmt.Sprintf("decategorize: code %d is not in the dictionary", code))
+			}
+			col.Index(j).SetString(r.values[code])
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestCategorize(t *testing.T) {
+	const N = 1000
+	var (
+		colors = []string{"red", "green", "blue"}
+		keys   = make([]string, N)
+		counts = make([]int, N)
+	)
+	for i := range keys {
+		keys[i] = colors[i%len(colors)]
+		counts[i] = 1
+	}
+	for nshard := 1; nshard < 4; nshard++ {
+		dict := bigslice.NewDictionary()
+		slice := bigslice.Const(nshard, keys, counts)
+		slice = bigslice.Categorize(slice, dict, 0)
+		slice = bigslice.Reduce(slice, func(a, e int) int { return a + e })
+		slice = bigslice.Decategorize(slice, dict, 0)
+		assertEqual(t, slice, true, []string{"blue", "green", "red"}, []int{333, 333, 334})
+	}
+}
+
+func TestCategorizeShared(t *testing.T) {
+	// The values of each source are coded by the dictionary of all of
+	// them, so that the categorical columns of both sources may be
+	// joined.
+	dict := bigslice.NewDictionary()
+	left := bigslice.Const(2, []string{"a", "b", "c", "d"}, []int{1, 2, 3, 4})
+	left = bigslice.Categorize(left, dict)
+	right := bigslice.Const(3, []string{"d", "e", "b", "f", "a"}, []string{"x", "y", "x", "y", "y"})
+	right = bigslice.Categorize(right, dict)
+	if got, want := right.Out(1), reflect.TypeOf(bigslice.Category(0)); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	slice := bigslice.Cogroup(left, right)
+	slice = bigslice.Map(slice, func(k bigslice.Category, vs []int, ws []bigslice.Category) (bigslice.Category, int, int) {
+		return k, len(vs), len(ws)
+	})
+	slice = bigslice.Decategorize(slice, dict)
+	assertEqual(t, slice, true,
+		[]string{"a", "b", "c", "d", "e", "f"},
+		[]int{1, 1, 1, 1, 0, 0},
+		[]int{1, 1, 0, 1, 1, 1},
+	)
+}
+
+func TestCategorizeOrder(t *testing.T) {
+	// Categories are ordered as their values are.
+	dict := bigslice.NewDictionary()
+	slice := bigslice.Const(2, []string{"pear", "apple", "fig", "banana"})
+	slice = bigslice.Categorize(slice, dict)
+	slice = bigslice.SortBy(slice, 1, bigslice.Asc(0))
+	slice = bigslice.Decategorize(slice, dict)
+	assertEqual(t, slice, false, []string{"apple", "banana", "fig", "pear"})
+}
+
+func TestCategorizeError(t *testing.T) {
+	dict := bigslice.NewDictionary()
+	input := bigslice.Const(1, []int{1})
+	expectTypeError(t, "categorize: column 1 out of range for slice slice[1]int", func() { bigslice.Categorize(input, dict, 1) })
+	expectTypeError(t, "categorize: column 0 has type int, not string", func() { bigslice.Categorize(input, dict, 0) })
+	expectTypeError(t, "categorize: slice slice[1]int has no string columns", func() { bigslice.Categorize(input, dict) })
+	expectTypeError(t, "decategorize: column 0 has type int, not bigslice.Category", func() { bigslice.Decategorize(input, dict, 0) })
+	expectTypeError(t, "decategorize: slice slice[1]int has no categorical columns", func() { bigslice.Decategorize(input, dict) })
+
+	// Sources may not be added once the dictionary is in use.
+	strings := bigslice.Const(1, []string{"a"})
+	slice := bigslice.Categorize(strings, dict)
+	slice.Dep(1)
+	expectTypeError(t, "categorize: dictionary is already in use by a running pipeline", func() { bigslice.Categorize(strings, dict) })
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/slicecache"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A Checkpointer is a Slice whose output is durably stored once it is
+// computed, so that it may be read without recomputing its
+// dependencies. See Checkpoint.
+type Checkpointer interface {
+	// Checkpointed returns a slice without dependencies that reads the
+	// slice's stored output. It should be called only once the slice
+	// has been computed.
+	Checkpointed() Slice
+}
+
+type checkpointSlice struct {
+	name Name
+	Slice
+	prefix string
+	cache  *slicecache.FileShardCache
+}
+
+var (
+	_ slicecache.Cacheable = (*checkpointSlice)(nil)
+	_ Checkpointer         = (*checkpointSlice)(nil)
+)
+
+// Checkpoint returns a slice that is identical to the provided slice,
+// but whose output is written to durable storage under the provided
+// prefix, using the same file naming scheme as Cache, and which
+// truncates the slice's lineage: once an invocation that returns a
+// checkpointed slice is computed, later invocations that read its
+// result (i.e., are passed the *exec.Result) read the stored output
+// instead of depending on the tasks that computed it. If those outputs
+// are lost, they are read again from storage rather than recomputed
+// from the slice's dependencies, so that the cost of recovering from
+// lost tasks does not grow with the number of iterations of an
+// iterative job. For example:
+//
+//	step := bigslice.Func(func(state bigslice.Slice, i int) bigslice.Slice {
+//		next := update(state)
+//		return bigslice.Checkpoint(ctx, next, fmt.Sprintf("s3://bucket/ckpt/iter-%d", i))
+//	})
+//	for i := 0; i < iterations; i++ {
+//		state = sess.Must(ctx, step, state, i)
+//	}
+//
+// Lineage is truncated only at invocation boundaries, so Checkpoint
+// should be applied to the slice that is returned by the Func. Within
+// the invocation that computes it, the checkpointed slice is computed
+// by tasks of its own. As with Cache, if all of the slice's shards are
+// already stored under the prefix, they are read instead of being
+// computed, and the user is responsible for the consistency of the
+// stored output.
+func Checkpoint(ctx context.Context, slice Slice, prefix string) Slice {
+	if prefix == "" {
+		typecheck.Panic(1, "checkpoint: prefix must be nonempty")
+	}
+	shardCache := slicecache.NewFileShardCache(ctx, prefix, slice.NumShard())
+	shardCache.RequireAllCached()
+	shardCache.SetType(slice)
+	return &checkpointSlice{MakeName("checkpoint"), slice, prefix, shardCache}
+}
+
+func (c *checkpointSlice) Name() Name                   { return c.name }
+func (*checkpointSlice) NumDep() int                    { return 1 }
+func (c *checkpointSlice) Dep(i int) Dep                { return singleDep(i, c.Slice, false) }
+func (*checkpointSlice) Combiner() slicefunc.Func       { return slicefunc.Nil }
+func (c *checkpointSlice) MaxRows() int                 { return maxRows(c.Slice) }
+func (c *checkpointSlice) Cache() slicecache.ShardCache { return c.cache }
+
+// Checkpointed slices are materialized, so that they are computed by
+// tasks of their own.
+func (*checkpointSlice) Procs() int        { return 1 }
+func (*checkpointSlice) Exclusive() bool   { return false }
+func (*checkpointSlice) Materialize() bool { return true }
+func (*checkpointSlice) Broadcast() bool   { return false }
+
+func (c *checkpointSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+// Checkpointed implements Checkpointer. The returned slice retains only
+// the checkpointed slice's type, and not its dependencies.
+func (c *checkpointSlice) Checkpointed() Slice {
+	shardCache := slicecache.NewFileShardCache(context.Background(), c.prefix, c.NumShard())
+	shardCache.RequireAllCached()
+	shardCache.SetType(c)
+	var slice Slice = &readCacheSlice{
+		slicetype.New(slicetype.Columns(c)...),
+		c.name,
+		c.NumShard(),
+		shardCache,
+		frame.Frame{},
+	}
+	if prefix := c.Prefix(); prefix > 1 {
+		slice = &prefixSlice{slice, prefix}
+	}
+	return slice
+}
@@ -45,7 +45,7 @@ func main() {
 `))
 
 // BuildUsage is the usage message for the Build command.
-const BuildUsage = `usage: bigslice build [-o output] [inputs]
+const BuildUsage = `usage: bigslice build [-o output] [-targets targets] [inputs]
 
 Command build builds a bigslice binary for the given package or
 source files. If no input is given, it is taken to be the package
@@ -53,21 +53,37 @@ source files. If no input is given, it is taken to be the package
 
 Build uses the "go" tool to build a fat bigslice binary, consisting
 of the native binary for the host GOOS and GOARCH, concatenated with
-the binary for GOOS=linux and GOARCH=amd64, since that is the target
-platform for Bigslice workers. See package
+a binary for each of the target platforms of Bigslice workers. By
+default the only target is GOOS=linux and GOARCH=amd64; sessions that
+use machines of other architectures, e.g., linux/arm64, should
+include them in the comma-separated list of targets. See package
 github.com/grailbio/base/fatbin for more details.
 
-If the host is GOOS=linux, GOARCH=amd64, then the user can use the
-regular go tool to build binaries, as the extra build target is not
-needed.
+If the host is the only target, then the user can use the regular go
+tool to build binaries, as no extra build targets are needed.
 
 The flags are:
 `
 
+// DefaultTargets is the default set of worker platforms for which
+// binaries are built.
+var DefaultTargets = []string{"linux/amd64"}
+
 // Build builds the bigslice binary and writes it out to specified output filename,
 // if that string is empty then a suitable name is computed and returned.
+// The binary includes images for DefaultTargets.
 func Build(ctx context.Context, paths []string, output string) string {
+	return BuildTargets(ctx, paths, output, DefaultTargets)
+}
+
+// BuildTargets is like Build, but the binary includes an image for
+// each of the provided targets, in the form "GOOS/GOARCH", so that
+// it may run on workers of those platforms.
+func BuildTargets(ctx context.Context, paths []string, output string, targets []string) string {
 	must.True(len(paths) > 0, "no paths defined")
+	for _, target := range targets {
+		must.True(strings.Count(target, "/") == 1, "invalid target ", target, "; must be GOOS/GOARCH")
+	}
 
 	// If we are passed multiple paths, then they must be Go files.
 	if len(paths) > 1 {
@@ -183,38 +199,53 @@ func Build(ctx context.Context, paths []string, output string) string {
 	build.Stderr = os.Stderr
 	must.Nil(build.Run())
 
-	// We currently assume that the target is linux/amd64.
-	// TODO(marius): don't hard code this.
-	if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+	// The native binary serves its own platform; every other target
+	// needs its own image.
+	var (
+		host   = runtime.GOOS + "/" + runtime.GOARCH
+		extra  []string
+		images = map[string]bool{host: true}
+	)
+	for _, target := range targets {
+		if !images[target] {
+			images[target] = true
+			extra = append(extra, target)
+		}
+	}
+	if len(extra) == 0 {
 		return output
 	}
 
-	f, err := ioutil.TempFile("", output)
-	must.Nil(err)
-	object := f.Name()
-	must.Nil(f.Close())
-
-	build = exec.Command("go", append([]string{"build", "-o", object}, paths...)...)
-	build.Stdout = os.Stdout
-	build.Stderr = os.Stderr
-	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64")
-	must.Nil(build.Run())
-
 	outputFile, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND, 0777)
 	must.Nil(err)
 	outputInfo, err := outputFile.Stat()
 	must.Nil(err)
 	fat := fatbin.NewWriter(outputFile, outputInfo.Size(), runtime.GOOS, runtime.GOARCH)
+	for _, target := range extra {
+		parts := strings.SplitN(target, "/", 2)
+		goos, goarch := parts[0], parts[1]
 
-	linuxAmd64File, err := os.Open(object)
-	must.Nil(err)
-	w, err := fat.Create("linux", "amd64")
-	must.Nil(err)
-	_, err = io.Copy(w, linuxAmd64File)
-	must.Nil(err)
-	must.Nil(os.Remove(object))
+		f, err := ioutil.TempFile("", filepath.Base(output))
+		must.Nil(err)
+		object := f.Name()
+		must.Nil(f.Close())
+
+		build = exec.Command("go", append([]string{"build", "-o", object}, paths...)...)
+		build.Stdout = os.Stdout
+		build.Stderr = os.Stderr
+		build.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch)
+		must.Nil(build.Run())
+
+		objectFile, err := os.Open(object)
+		must.Nil(err)
+		w, err := fat.Create(goos, goarch)
+		must.Nil(err)
+		_, err = io.Copy(w, objectFile)
+		must.Nil(err)
+		must.Nil(os.Remove(object))
+		must.Nil(objectFile.Close())
+	}
 	must.Nil(fat.Close())
-	must.Nil(linuxAmd64File.Close())
 	must.Nil(outputFile.Close())
 
 	return output
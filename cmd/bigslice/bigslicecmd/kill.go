@@ -0,0 +1,56 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/exec"
+)
+
+// KillUsage is the usage message for the Kill command.
+const KillUsage = `usage: bigslice kill addr|job-id invocation...
+
+Command kill cancels the provided invocations of a running bigslice
+driver, identified as by "bigslice status", which also lists the
+driver's running invocations by index. Each invocation's context is
+canceled: its tasks stop, including those running on workers, and
+the call that ran it returns an error. The driver and its other
+invocations continue to run.
+`
+
+// Cancel cancels the invocation with the provided index of the driver
+// whose status server has the provided address. An error of kind
+// errors.NotExist is returned if no such invocation is running.
+func Cancel(ctx context.Context, addr string, index uint64) error {
+	form := url.Values{"invocation": {fmt.Sprint(index)}}
+	req, err := http.NewRequest("POST", driverURL(addr, "/debug/cancel"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set(exec.CancelHeader, "1")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.E(errors.Unavailable, "driver ", addr, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	msg := strings.TrimSpace(string(body))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errors.E(errors.NotExist, msg)
+	default:
+		return errors.E("driver ", addr, ": ", resp.Status, ": ", msg)
+	}
+}
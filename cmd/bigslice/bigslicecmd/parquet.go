@@ -0,0 +1,379 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// This file implements just enough of the Parquet file format to
+// decode the schema of a Parquet file from its footer. The footer
+// holds a FileMetaData structure, encoded with Thrift's compact
+// protocol. See https://github.com/apache/parquet-format.
+
+const parquetMagic = "PAR1"
+
+// maxParquetFooter bounds the size of Parquet footers that we are
+// willing to decode.
+const maxParquetFooter = 64 << 20
+
+// parquetElement is a Parquet SchemaElement. Only the fields that are
+// used to infer Go types are decoded.
+type parquetElement struct {
+	Name          string
+	Type          int32 // physical type; -1 for groups
+	Repetition    int32
+	NumChildren   int32
+	ConvertedType int32 // -1 if unset
+	Scale         int32
+	Precision     int32
+	// Logical is the field ID of the logical type, if any, and
+	// IntWidth and IntSigned describe INTEGER logical types.
+	Logical   int16
+	IntWidth  int8
+	IntSigned bool
+}
+
+// Parquet physical types.
+const (
+	parquetBoolean           = 0
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetInt96             = 3
+	parquetFloat             = 4
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+)
+
+// Parquet repetition types.
+const (
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+)
+
+// Parquet converted types.
+const (
+	parquetUTF8            = 0
+	parquetMap             = 1
+	parquetMapKeyValue     = 2
+	parquetList            = 3
+	parquetEnum            = 4
+	parquetDecimal         = 5
+	parquetDate            = 6
+	parquetTimeMillis      = 7
+	parquetTimeMicros      = 8
+	parquetTimestampMillis = 9
+	parquetTimestampMicros = 10
+	parquetUint8           = 11
+	parquetUint16          = 12
+	parquetUint32          = 13
+	parquetUint64          = 14
+	parquetInt8            = 15
+	parquetInt16           = 16
+	parquetInt32Converted  = 17
+	parquetInt64Converted  = 18
+	parquetJSON            = 19
+)
+
+// Field IDs of Parquet logical types, which form a Thrift union.
+const (
+	parquetLogicalString    = 1
+	parquetLogicalMap       = 2
+	parquetLogicalList      = 3
+	parquetLogicalEnum      = 4
+	parquetLogicalDecimal   = 5
+	parquetLogicalDate      = 6
+	parquetLogicalTimestamp = 8
+	parquetLogicalInteger   = 10
+	parquetLogicalJSON      = 12
+)
+
+// readParquetSchema reads the schema elements, in depth-first order,
+// and number of rows of the Parquet file read by r, whose size is
+// size.
+func readParquetSchema(r io.ReadSeeker, size int64) ([]parquetElement, int64, error) {
+	if size < 12 {
+		return nil, 0, errors.New("parquet: file too short")
+	}
+	if _, err := r.Seek(size-8, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var trailer [8]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, 0, err
+	}
+	if string(trailer[4:]) != parquetMagic {
+		return nil, 0, errors.New("parquet: not a parquet file")
+	}
+	n := int64(binary.LittleEndian.Uint32(trailer[:4]))
+	if n > maxParquetFooter || n > size-12 {
+		return nil, 0, fmt.Errorf("parquet: invalid footer length %d", n)
+	}
+	if _, err := r.Seek(size-8-n, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	d := &thriftDecoder{r: bufio.NewReader(io.LimitReader(r, n))}
+	var (
+		elems   []parquetElement
+		numRows int64
+	)
+	err := d.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 2 && typ == thriftList:
+			size, _, err := d.readListHeader()
+			if err != nil {
+				return err
+			}
+			for i := 0; i < size; i++ {
+				elem, err := d.readParquetElement()
+				if err != nil {
+					return err
+				}
+				elems = append(elems, elem)
+			}
+			return nil
+		case id == 3 && typ == thriftI64:
+			var err error
+			numRows, err = d.readZigzag()
+			return err
+		default:
+			return d.skip(typ)
+		}
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("parquet: decoding footer: %v", err)
+	}
+	if len(elems) == 0 {
+		return nil, 0, errors.New("parquet: empty schema")
+	}
+	return elems, numRows, nil
+}
+
+func (d *thriftDecoder) readParquetElement() (parquetElement, error) {
+	e := parquetElement{Type: -1, ConvertedType: -1}
+	err := d.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI32:
+			e.Type, err = d.readI32()
+		case id == 3 && typ == thriftI32:
+			e.Repetition, err = d.readI32()
+		case id == 4 && typ == thriftBinary:
+			var p []byte
+			p, err = d.readBinary()
+			e.Name = string(p)
+		case id == 5 && typ == thriftI32:
+			e.NumChildren, err = d.readI32()
+		case id == 6 && typ == thriftI32:
+			e.ConvertedType, err = d.readI32()
+		case id == 7 && typ == thriftI32:
+			e.Scale, err = d.readI32()
+		case id == 8 && typ == thriftI32:
+			e.Precision, err = d.readI32()
+		case id == 10 && typ == thriftStruct:
+			err = d.readStruct(func(id int16, typ byte) error {
+				e.Logical = id
+				if id != parquetLogicalInteger || typ != thriftStruct {
+					return d.skip(typ)
+				}
+				return d.readStruct(func(id int16, typ byte) error {
+					switch {
+					case id == 1 && typ == thriftByte:
+						b, err := d.r.ReadByte()
+						e.IntWidth = int8(b)
+						return err
+					case id == 2 && (typ == thriftTrue || typ == thriftFalse):
+						e.IntSigned = typ == thriftTrue
+						return nil
+					default:
+						return d.skip(typ)
+					}
+				})
+			})
+		default:
+			err = d.skip(typ)
+		}
+		return err
+	})
+	return e, err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// maxThriftDepth bounds the nesting depth of decoded structures.
+const maxThriftDepth = 64
+
+// thriftDecoder decodes values encoded with Thrift's compact protocol.
+type thriftDecoder struct {
+	r     *bufio.Reader
+	depth int
+}
+
+func (d *thriftDecoder) readVarint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+func (d *thriftDecoder) readZigzag() (int64, error) {
+	v, err := d.readVarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (d *thriftDecoder) readI32() (int32, error) {
+	v, err := d.readZigzag()
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, errors.New("i32 out of range")
+	}
+	return int32(v), err
+}
+
+func (d *thriftDecoder) readBinary() ([]byte, error) {
+	n, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxParquetFooter {
+		return nil, errors.New("binary too long")
+	}
+	p := make([]byte, n)
+	_, err = io.ReadFull(d.r, p)
+	return p, err
+}
+
+func (d *thriftDecoder) readListHeader() (size int, elemType byte, err error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, elemType = int(b>>4), b&0x0f
+	if size == 15 {
+		n, err := d.readVarint()
+		if err != nil {
+			return 0, 0, err
+		}
+		if n > maxParquetFooter {
+			return 0, 0, errors.New("list too long")
+		}
+		size = int(n)
+	}
+	return size, elemType, nil
+}
+
+// readStruct reads a struct, calling field for each of its fields.
+// Field must consume the field's value.
+func (d *thriftDecoder) readStruct(field func(id int16, typ byte) error) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxThriftDepth {
+		return errors.New("structure too deep")
+	}
+	var id int16
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		typ := b & 0x0f
+		if typ == thriftStop {
+			return nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := d.readZigzag()
+			if err != nil {
+				return err
+			}
+			id = int16(v)
+		}
+		if err := field(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// skip skips a value of the provided type.
+func (d *thriftDecoder) skip(typ byte) error {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := d.r.ReadByte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := d.readVarint()
+		return err
+	case thriftDouble:
+		_, err := d.r.Discard(8)
+		return err
+	case thriftBinary:
+		_, err := d.readBinary()
+		return err
+	case thriftList, thriftSet:
+		size, elemType, err := d.readListHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := d.skip(collectionType(elemType)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftMap:
+		size, err := d.readVarint()
+		if err != nil || size == 0 {
+			return err
+		}
+		kv, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := d.skip(collectionType(kv >> 4)); err != nil {
+				return err
+			}
+			if err := d.skip(collectionType(kv & 0x0f)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftStruct:
+		return d.readStruct(func(_ int16, typ byte) error { return d.skip(typ) })
+	default:
+		return fmt.Errorf("invalid type %d", typ)
+	}
+}
+
+// collectionType returns the type with which elements of the provided
+// type are encoded in collections: booleans, whose values are encoded
+// in field headers in structs, are encoded as one byte each.
+func collectionType(typ byte) byte {
+	if typ == thriftTrue || typ == thriftFalse {
+		return thriftByte
+	}
+	return typ
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+// ProfilesUsage is the usage message for the profiles command.
+const ProfilesUsage = `usage: bigslice profiles
+
+Command profiles lists the named profiles with which bigslice programs
+may be run. Named profiles are files in $HOME/.bigslice/profiles, in
+the same syntax as $HOME/.bigslice/config, on top of which they are
+applied, e.g.:
+
+	$HOME/.bigslice/profiles/prod-large:
+		param bigslice parallelism = 4096
+		param bigmachine/ec2system instance = "m5.24xlarge"
+
+Programs that create their sessions with sliceconfig.Parse select a
+named profile with the -config flag or the $BIGSLICE_CONFIG
+environment variable, e.g.:
+
+	bigslice run ./myprog -config=prod-large
+
+The built-in profile "local" runs programs in the current process, as
+with -local.
+`
@@ -0,0 +1,143 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// ReapUsage is the usage message for the Reap command.
+const ReapUsage = `usage: bigslice reap [-age duration] [-user user] [-binary binary] [-terminate]
+
+Command reap lists the bigmachine EC2 instances in the account (and
+the region of the AWS configuration) that are likely to be orphaned:
+those that have been running for longer than -age. With -terminate,
+the listed instances are terminated.
+
+Sessions configured with exec.OrphanTimeout tear down their own
+machines when their driver disappears; reap finds machines that were
+leaked regardless, e.g., by sessions without an orphan timeout, or by
+drivers that are hung but alive. Because such machines cannot be told
+apart from those of legitimately long-running sessions, candidates
+should be narrowed by -age, -user, and -binary before they are
+terminated.
+`
+
+// DefaultReapAge is the default age beyond which bigmachine instances
+// are considered orphaned.
+const DefaultReapAge = 24 * time.Hour
+
+// ReapOptions determines which instances are considered orphaned.
+type ReapOptions struct {
+	// Age is the minimum amount of time for which orphaned instances have
+	// been running. If zero, DefaultReapAge is used.
+	Age time.Duration
+	// User and Binary, if not empty, restrict orphaned instances to those
+	// started by the named user and binary.
+	User, Binary string
+}
+
+// An Instance is a bigmachine EC2 instance.
+type Instance struct {
+	// ID is the instance's EC2 ID.
+	ID string
+	// Type is the instance's EC2 type, e.g., "m5.xlarge".
+	Type string
+	// User and Binary are the user and the name of the binary that
+	// started the instance, as recorded in its tags.
+	User, Binary string
+	// Launch is the time at which the instance was launched.
+	Launch time.Time
+}
+
+// Orphans returns the running bigmachine instances that svc reports
+// and that are considered orphaned according to the provided options,
+// ordered by launch time.
+func Orphans(ctx context.Context, svc ec2iface.EC2API, opts ReapOptions) ([]Instance, error) {
+	age := opts.Age
+	if age == 0 {
+		age = DefaultReapAge
+	}
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:bigmachine"), Values: aws.StringSlice([]string{"true"})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})},
+		},
+	}
+	var (
+		cutoff    = time.Now().Add(-age)
+		instances []Instance
+	)
+	err := svc.DescribeInstancesPagesWithContext(ctx, input, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, res := range page.Reservations {
+			for _, inst := range res.Instances {
+				instance := Instance{
+					ID:     aws.StringValue(inst.InstanceId),
+					Type:   aws.StringValue(inst.InstanceType),
+					Launch: aws.TimeValue(inst.LaunchTime),
+				}
+				for _, tag := range inst.Tags {
+					switch aws.StringValue(tag.Key) {
+					case "Name":
+						// Bigmachine names instances "user:binary(digest) args".
+						if name := aws.StringValue(tag.Value); strings.Contains(name, ":") {
+							instance.User = name[:strings.Index(name, ":")]
+						}
+					case "bigmachine:binary":
+						instance.Binary = aws.StringValue(tag.Value)
+					}
+				}
+				switch {
+				case instance.Launch.After(cutoff):
+				case opts.User != "" && instance.User != opts.User:
+				case opts.Binary != "" && instance.Binary != opts.Binary:
+				default:
+					instances = append(instances, instance)
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		return instances[i].Launch.Before(instances[j].Launch)
+	})
+	return instances, nil
+}
+
+// maxTerminate is the maximum number of instances terminated by a
+// single EC2 API call.
+const maxTerminate = 500
+
+// Reap terminates the provided instances.
+func Reap(ctx context.Context, svc ec2iface.EC2API, instances []Instance) error {
+	for len(instances) > 0 {
+		n := len(instances)
+		if n > maxTerminate {
+			n = maxTerminate
+		}
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = instances[i].ID
+		}
+		_, err := svc.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{
+			InstanceIds: aws.StringSlice(ids),
+		})
+		if err != nil {
+			return err
+		}
+		instances = instances[n:]
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// fakeEC2 serves a fixed set of instances, in pages of two.
+type fakeEC2 struct {
+	ec2iface.EC2API
+	instances  []*ec2.Instance
+	terminated []string
+}
+
+func (f *fakeEC2) DescribeInstancesPagesWithContext(ctx aws.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, _ ...request.Option) error {
+	for i := 0; i < len(f.instances); i += 2 {
+		j := i + 2
+		if j > len(f.instances) {
+			j = len(f.instances)
+		}
+		page := &ec2.DescribeInstancesOutput{
+			Reservations: []*ec2.Reservation{{Instances: f.instances[i:j]}},
+		}
+		if !fn(page, j == len(f.instances)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) TerminateInstancesWithContext(ctx aws.Context, input *ec2.TerminateInstancesInput, _ ...request.Option) (*ec2.TerminateInstancesOutput, error) {
+	f.terminated = append(f.terminated, aws.StringValueSlice(input.InstanceIds)...)
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+func TestReap(t *testing.T) {
+	now := time.Now()
+	instance := func(id, user, binary string, age time.Duration) *ec2.Instance {
+		return &ec2.Instance{
+			InstanceId:   aws.String(id),
+			InstanceType: aws.String("m5.xlarge"),
+			LaunchTime:   aws.Time(now.Add(-age)),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("%s:%s(abc) -flag (bigmachine)", user, binary))},
+				{Key: aws.String("bigmachine"), Value: aws.String("true")},
+				{Key: aws.String("bigmachine:binary"), Value: aws.String(binary)},
+			},
+		}
+	}
+	svc := &fakeEC2{
+		instances: []*ec2.Instance{
+			instance("i-1", "alice", "pipeline", 48*time.Hour),
+			instance("i-2", "alice", "pipeline", time.Hour),
+			instance("i-3", "bob", "pipeline", 72*time.Hour),
+			instance("i-4", "alice", "other", 30*time.Hour),
+			instance("i-5", "bob", "other", 25*time.Hour),
+		},
+	}
+	ctx := context.Background()
+	for _, c := range []struct {
+		opts ReapOptions
+		ids  []string
+	}{
+		{ReapOptions{}, []string{"i-3", "i-1", "i-4", "i-5"}},
+		{ReapOptions{Age: 30 * time.Minute}, []string{"i-3", "i-1", "i-4", "i-5", "i-2"}},
+		{ReapOptions{User: "alice"}, []string{"i-1", "i-4"}},
+		{ReapOptions{User: "bob", Binary: "other"}, []string{"i-5"}},
+		{ReapOptions{User: "carol"}, nil},
+	} {
+		instances, err := Orphans(ctx, svc, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, inst := range instances {
+			ids = append(ids, inst.ID)
+		}
+		if got, want := ids, c.ids; !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: got %v, want %v", c.opts, got, want)
+		}
+	}
+
+	instances, err := Orphans(ctx, svc, ReapOptions{User: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Instance{ID: "i-3", Type: "m5.xlarge", User: "bob", Binary: "pipeline", Launch: now.Add(-72 * time.Hour)}
+	if got := instances[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if err := Reap(ctx, svc, instances); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.terminated, []string{"i-3", "i-5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+// ReplUsage is the usage message for the repl command.
+const ReplUsage = `usage: bigslice repl [input] [flags]
+
+Command repl builds and then runs the provided package or files, as
+"bigslice run" does, but in lieu of running the program, runs an
+interactive REPL in the program's session. The REPL queries, in the SQL
+dialect of package slicesql, the tables that the program registers
+with package slicerepl. Queries are run as invocations of a single
+session, so the machines that it starts are reused from one query to
+the next. This requires the program to create its session with
+sliceconfig.Parse.
+
+Within the REPL, type \help for a list of statements.
+`
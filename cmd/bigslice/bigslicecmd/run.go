@@ -9,10 +9,22 @@ import (
 )
 
 // RunUsage is the usage message for the Run command.
-const RunUsage = `usage: bigslice run [input] [flags]
+const RunUsage = `usage: bigslice run [-explain] [input] [flags]
 
 Command run builds and then runs the provided package or files. See
 "bigslice build -help" for more details.
+
+With -explain, the program's invocations are compiled but not run:
+their plans (stages, shard counts, shuffle boundaries, pipelined
+operators, the number of partitions moved between stages, and, where
+sources provide statistics, the estimated sizes of stages and the
+approximate processor time required to run them) are printed
+instead. This requires the program to create its session with
+sliceconfig.Parse.
+
+Programs that create their sessions with sliceconfig.Parse may be run
+with a named profile by passing -config=name to the program; see
+"bigslice profiles".
 `
 
 // Run executes the supplied arguments as a subprocess. If no arguments are
@@ -0,0 +1,484 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// SchemaUsage is the usage message for the Schema command.
+const SchemaUsage = `usage: bigslice schema [-format format] [-n rows] [-name name] [-noheader] path
+
+Command schema infers the schema of the CSV, TSV, or Parquet file at
+path, and prints Go definitions for it that are ready to be pasted into
+pipeline code: a struct type with a field for each of the file's
+columns, and the signature of a bigslice.ReaderFunc that reads the
+file's columns.
+
+The types of CSV and TSV columns are inferred from a sample of the
+file's rows; the first row names the columns unless -noheader is given.
+Such files may be gzip-compressed. The types of Parquet columns are
+derived from the schema stored in the file's footer.
+
+The file's format is determined by its extension (.csv, .tsv, or
+.parquet, optionally followed by .gz for CSV and TSV files), unless it
+is given by -format.
+`
+
+// DefaultSchemaSample is the default number of rows sampled to infer
+// the schema of CSV and TSV files.
+const DefaultSchemaSample = 1000
+
+// SchemaOptions configures schema inference.
+type SchemaOptions struct {
+	// Format is the format of the file: "csv", "tsv", or "parquet". If
+	// empty, it is determined by the file's extension.
+	Format string
+	// Sample is the number of rows sampled to infer the types of CSV and
+	// TSV columns. If zero, DefaultSchemaSample rows are sampled.
+	Sample int
+	// NoHeader indicates that the first row of a CSV or TSV file is
+	// data, and not the names of the file's columns.
+	NoHeader bool
+}
+
+// A SchemaField is a column of an inferred schema.
+type SchemaField struct {
+	// Name is the column's name in the file.
+	Name string
+	// Type is the Go type of the column, e.g., "int64" or "[]string".
+	Type string
+	// Comment describes the column's type, if it was not inferred
+	// exactly, e.g., because the column contains empty values.
+	Comment string
+}
+
+// A Schema is the inferred schema of a file.
+type Schema struct {
+	// Path is the path of the file.
+	Path string
+	// Format is the format of the file: "csv", "tsv", or "parquet".
+	Format string
+	// Rows is the number of rows from which the schema was inferred:
+	// the number of sampled rows of CSV and TSV files, and the total
+	// number of rows of Parquet files.
+	Rows int64
+	// Fields are the columns of the file.
+	Fields []SchemaField
+}
+
+// InferSchema infers the schema of the file at path, which may be any
+// path supported by GRAIL's file library, e.g., an S3 URL.
+func InferSchema(ctx context.Context, path string, opts SchemaOptions) (*Schema, error) {
+	format := opts.Format
+	if format == "" {
+		ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+		switch ext {
+		case ".csv":
+			format = "csv"
+		case ".tsv", ".tab":
+			format = "tsv"
+		case ".parquet", ".parq":
+			format = "parquet"
+		default:
+			return nil, fmt.Errorf("%s: cannot determine format from extension %q; specify a format", path, ext)
+		}
+	}
+	if opts.Sample <= 0 {
+		opts.Sample = DefaultSchemaSample
+	}
+	f, err := file.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close(ctx) // nolint: errcheck
+	schema := &Schema{Path: path, Format: format}
+	switch format {
+	case "csv", "tsv":
+		var r io.Reader = f.Reader(ctx)
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			defer gz.Close() // nolint: errcheck
+			r = gz
+		}
+		comma := ','
+		if format == "tsv" {
+			comma = '\t'
+		}
+		err = schema.inferDelimited(r, comma, opts)
+	case "parquet":
+		var info file.Info
+		if info, err = f.Stat(ctx); err != nil {
+			return nil, err
+		}
+		err = schema.inferParquet(f.Reader(ctx), info.Size())
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return schema, nil
+}
+
+// columnStats tracks which types a sampled column's values are
+// compatible with.
+type columnStats struct {
+	values, empty             int
+	notInt, notFloat, notBool bool
+}
+
+func (c *columnStats) add(v string) {
+	c.values++
+	v = strings.TrimSpace(v)
+	if v == "" {
+		c.empty++
+		return
+	}
+	if !c.notInt {
+		_, err := strconv.ParseInt(v, 10, 64)
+		c.notInt = err != nil
+	}
+	if !c.notFloat {
+		_, err := strconv.ParseFloat(v, 64)
+		c.notFloat = err != nil
+	}
+	if !c.notBool {
+		c.notBool = !strings.EqualFold(v, "true") && !strings.EqualFold(v, "false")
+	}
+}
+
+func (c *columnStats) field(name string) SchemaField {
+	f := SchemaField{Name: name}
+	switch {
+	case c.values == c.empty:
+		f.Type = "string"
+		f.Comment = "no values sampled"
+		return f
+	case !c.notInt:
+		f.Type = "int64"
+	case !c.notFloat:
+		f.Type = "float64"
+	case !c.notBool:
+		f.Type = "bool"
+	default:
+		f.Type = "string"
+	}
+	if c.empty > 0 {
+		f.Comment = fmt.Sprintf("%d of %d sampled values are empty", c.empty, c.values)
+	}
+	return f
+}
+
+func (s *Schema) inferDelimited(r io.Reader, comma rune, opts SchemaOptions) error {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = comma == '\t'
+	var (
+		names []string
+		stats []columnStats
+	)
+	if !opts.NoHeader {
+		header, err := cr.Read()
+		if err == io.EOF {
+			return fmt.Errorf("empty file")
+		}
+		if err != nil {
+			return err
+		}
+		names = append(names, header...)
+	}
+	for s.Rows < int64(opts.Sample) {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.Rows++
+		for len(stats) < len(row) {
+			stats = append(stats, columnStats{})
+		}
+		for i, v := range row {
+			stats[i].add(v)
+		}
+	}
+	for len(stats) < len(names) {
+		stats = append(stats, columnStats{})
+	}
+	for i := range stats {
+		name := fmt.Sprintf("col%d", i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		s.Fields = append(s.Fields, stats[i].field(name))
+	}
+	return nil
+}
+
+func (s *Schema) inferParquet(r io.ReadSeeker, size int64) error {
+	elems, numRows, err := readParquetSchema(r, size)
+	if err != nil {
+		return err
+	}
+	s.Rows = numRows
+	// The first element is the root of the schema, whose children are
+	// the file's columns.
+	root, rest := elems[0], elems[1:]
+	for i := 0; i < int(root.NumChildren); i++ {
+		var node *parquetNode
+		if node, rest, err = parseParquetNode(rest); err != nil {
+			return err
+		}
+		typ, comment := node.goType()
+		s.Fields = append(s.Fields, SchemaField{Name: node.Name, Type: typ, Comment: comment})
+	}
+	return nil
+}
+
+// parquetNode is a node of a Parquet schema tree.
+type parquetNode struct {
+	parquetElement
+	Children []*parquetNode
+}
+
+// parseParquetNode parses the schema tree rooted at the first of the
+// provided elements, which are in depth-first order, and returns the
+// remaining elements.
+func parseParquetNode(elems []parquetElement) (*parquetNode, []parquetElement, error) {
+	if len(elems) == 0 {
+		return nil, nil, fmt.Errorf("parquet: truncated schema")
+	}
+	node := &parquetNode{parquetElement: elems[0]}
+	elems = elems[1:]
+	for i := 0; i < int(node.NumChildren); i++ {
+		var (
+			child *parquetNode
+			err   error
+		)
+		if child, elems, err = parseParquetNode(elems); err != nil {
+			return nil, nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, elems, nil
+}
+
+// goType returns the Go type of the values of node n, accounting for
+// its repetition, along with a comment that qualifies it.
+func (n *parquetNode) goType() (typ, comment string) {
+	typ, comment = n.valueType()
+	switch n.Repetition {
+	case parquetRepeated:
+		typ = "[]" + typ
+	case parquetOptional:
+		if !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") {
+			typ = "*" + typ
+		}
+	}
+	return
+}
+
+// valueType returns the Go type of a single value of node n.
+func (n *parquetNode) valueType() (typ, comment string) {
+	if len(n.Children) > 0 || n.Type < 0 {
+		return n.groupType()
+	}
+	switch {
+	case n.Logical == parquetLogicalString || n.Logical == parquetLogicalEnum || n.Logical == parquetLogicalJSON,
+		n.ConvertedType == parquetUTF8 || n.ConvertedType == parquetEnum || n.ConvertedType == parquetJSON:
+		return "string", ""
+	case n.Logical == parquetLogicalInteger && n.IntWidth > 0:
+		if n.IntSigned {
+			return fmt.Sprintf("int%d", n.IntWidth), ""
+		}
+		return fmt.Sprintf("uint%d", n.IntWidth), ""
+	case n.ConvertedType >= parquetUint8 && n.ConvertedType <= parquetUint64:
+		return fmt.Sprintf("uint%d", 8<<uint(n.ConvertedType-parquetUint8)), ""
+	case n.ConvertedType >= parquetInt8 && n.ConvertedType <= parquetInt64Converted:
+		return fmt.Sprintf("int%d", 8<<uint(n.ConvertedType-parquetInt8)), ""
+	case n.Logical == parquetLogicalDate || n.ConvertedType == parquetDate,
+		n.Logical == parquetLogicalTimestamp || n.ConvertedType == parquetTimestampMillis || n.ConvertedType == parquetTimestampMicros:
+		return "time.Time", ""
+	case n.Logical == parquetLogicalDecimal || n.ConvertedType == parquetDecimal:
+		if n.Precision <= slicetype.MaxDecimalPrecision {
+			return "slicetype.Decimal", fmt.Sprintf("decimal(%d, %d)", n.Precision, n.Scale)
+		}
+		return "float64", fmt.Sprintf("decimal(%d, %d)", n.Precision, n.Scale)
+	}
+	switch n.Type {
+	case parquetBoolean:
+		return "bool", ""
+	case parquetInt32:
+		return "int32", ""
+	case parquetInt64:
+		return "int64", ""
+	case parquetInt96:
+		return "time.Time", "INT96 timestamp"
+	case parquetFloat:
+		return "float32", ""
+	case parquetDouble:
+		return "float64", ""
+	case parquetByteArray, parquetFixedLenByteArray:
+		return "[]byte", ""
+	default:
+		return "interface{}", fmt.Sprintf("unknown parquet type %d", n.Type)
+	}
+}
+
+// groupType returns the Go type of a value of the group node n: lists
+// and maps, as annotated by the Parquet format, are represented by Go
+// slices and maps, and other groups by structs.
+func (n *parquetNode) groupType() (typ, comment string) {
+	isList := n.Logical == parquetLogicalList || n.ConvertedType == parquetList
+	isMap := n.Logical == parquetLogicalMap || n.ConvertedType == parquetMap || n.ConvertedType == parquetMapKeyValue
+	if len(n.Children) == 1 && n.Children[0].Repetition == parquetRepeated {
+		repeated := n.Children[0]
+		switch {
+		case isList && len(repeated.Children) == 1:
+			// A list annotated group contains a repeated group that in
+			// turn contains the list's element.
+			elem, comment := repeated.Children[0].goType()
+			return "[]" + elem, comment
+		case isList:
+			// Legacy lists repeat their elements directly.
+			elem, comment := repeated.valueType()
+			return "[]" + elem, comment
+		case isMap && len(repeated.Children) == 2:
+			key, _ := repeated.Children[0].valueType()
+			val, comment := repeated.Children[1].goType()
+			return fmt.Sprintf("map[%s]%s", key, val), comment
+		}
+	}
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	fields := make(fieldNamer)
+	for _, child := range n.Children {
+		typ, comment := child.goType()
+		writeField(&b, fields.name(child.Name), typ, "parquet", child.Name, comment)
+	}
+	b.WriteString("}")
+	return b.String(), ""
+}
+
+// WriteGo writes Go definitions for schema s to w: a struct type named
+// name with a field for each column, and the signature of a
+// bigslice.ReaderFunc that reads the columns.
+func (s *Schema) WriteGo(w io.Writer, name string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s is the schema of %s, as inferred by \"bigslice schema\"", name, s.Path)
+	switch s.Format {
+	case "parquet":
+		fmt.Fprintf(&b, " from its footer (%d rows).\n", s.Rows)
+	default:
+		fmt.Fprintf(&b, " from %d sampled rows.\n", s.Rows)
+	}
+	tag := s.Format
+	if tag == "tsv" {
+		tag = "csv"
+	}
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	var (
+		fields = make(fieldNamer)
+		params = make(fieldNamer)
+		args   []string
+	)
+	for _, f := range s.Fields {
+		writeField(&b, fields.name(f.Name), f.Type, tag, f.Name, f.Comment)
+		args = append(args, fmt.Sprintf("%s []%s", params.param(f.Name), singleLine(f.Type)))
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "// The columns of %s, in order, are read by a bigslice.ReaderFunc with signature:\n//\n", name)
+	fmt.Fprintf(&b, "//\tfunc(shard int, state *State, %s) (int, error)\n", strings.Join(args, ", "))
+	p, err := format.Source(b.Bytes())
+	if err != nil {
+		// This should not happen, but it's better to emit unformatted
+		// definitions than none at all.
+		p = b.Bytes()
+	}
+	_, err = w.Write(p)
+	return err
+}
+
+// singleLine returns the type typ, which may be a multi-line struct
+// type, on a single line.
+func singleLine(typ string) string {
+	typ = strings.Replace(typ, "{\n", "{ ", -1)
+	typ = strings.Replace(typ, "\n}", " }", -1)
+	return strings.Replace(typ, "\n", "; ", -1)
+}
+
+func writeField(b io.Writer, field, typ, tag, name, comment string) {
+	fmt.Fprintf(b, "%s %s `%s:%q`", field, typ, tag, name)
+	if comment != "" {
+		fmt.Fprintf(b, " // %s", comment)
+	}
+	fmt.Fprintln(b)
+}
+
+// fieldNamer derives unique Go identifiers from column names.
+type fieldNamer map[string]bool
+
+// name returns an exported identifier for the column name.
+func (n fieldNamer) name(column string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range column {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	ident := b.String()
+	if ident == "" || !unicode.IsLetter([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+	return n.unique(ident)
+}
+
+// param returns an unexported identifier for the column name.
+func (n fieldNamer) param(column string) string {
+	ident := []rune(n.name(column))
+	delete(n, string(ident))
+	ident[0] = unicode.ToLower(ident[0])
+	param := string(ident)
+	if token.Lookup(param).IsKeyword() || param == "shard" || param == "state" {
+		param += "_"
+	}
+	return n.unique(param)
+}
+
+func (n fieldNamer) unique(ident string) string {
+	unique := ident
+	for i := 2; n[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", ident, i)
+	}
+	n[unique] = true
+	return unique
+}
@@ -0,0 +1,288 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/testutil"
+)
+
+func TestInferSchemaCSV(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	path := filepath.Join(dir, "data.csv")
+	data := `id,score,name,active,note,type
+1,1.5,alice,true,,x
+2,2,"bob, jr.",FALSE,,y
+3,-3e2,carol,true,hello,z
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := InferSchema(context.Background(), path, SchemaOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schema.Rows, int64(3); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want := []SchemaField{
+		{Name: "id", Type: "int64"},
+		{Name: "score", Type: "float64"},
+		{Name: "name", Type: "string"},
+		{Name: "active", Type: "bool"},
+		{Name: "note", Type: "string", Comment: "2 of 3 sampled values are empty"},
+		{Name: "type", Type: "string"},
+	}
+	if got := schema.Fields; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var b bytes.Buffer
+	if err := schema.WriteGo(&b, "Record"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type Record struct {",
+		"\tId     int64   `csv:\"id\"`\n",
+		"\tNote   string  `csv:\"note\"` // 2 of 3 sampled values are empty\n",
+		"\tType   string  `csv:\"type\"`\n",
+		"//\tfunc(shard int, state *State, id []int64, score []float64, name []string, active []bool, note []string, type_ []string) (int, error)",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestInferSchemaTSVGzip(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	path := filepath.Join(dir, "data.tsv.gz")
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	for i := 0; i < 100; i++ {
+		_, _ = gz.Write([]byte("1\tx\"y\n"))
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := InferSchema(context.Background(), path, SchemaOptions{NoHeader: true, Sample: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schema.Rows, int64(10); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want := []SchemaField{
+		{Name: "col0", Type: "int64"},
+		{Name: "col1", Type: "string"},
+	}
+	if got := schema.Fields; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestInferSchemaParquet(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	path := filepath.Join(dir, "data.parquet")
+	elems := []parquetElement{
+		{Name: "schema", Type: -1, NumChildren: 8, ConvertedType: -1},
+		{Name: "id", Type: parquetInt64, ConvertedType: -1},
+		{Name: "name", Type: parquetByteArray, Repetition: parquetOptional, ConvertedType: parquetUTF8},
+		{Name: "count", Type: parquetInt32, ConvertedType: -1, Logical: parquetLogicalInteger, IntWidth: 16},
+		{Name: "ts", Type: parquetInt64, ConvertedType: parquetTimestampMicros},
+		{Name: "price", Type: parquetFixedLenByteArray, ConvertedType: parquetDecimal, Precision: 10, Scale: 2},
+		{Name: "tags", Type: -1, Repetition: parquetOptional, NumChildren: 1, ConvertedType: parquetList},
+		{Name: "list", Type: -1, Repetition: parquetRepeated, NumChildren: 1, ConvertedType: -1},
+		{Name: "element", Type: parquetByteArray, ConvertedType: parquetUTF8},
+		{Name: "point", Type: -1, NumChildren: 2, ConvertedType: -1},
+		{Name: "x", Type: parquetDouble, ConvertedType: -1},
+		{Name: "y", Type: parquetDouble, Repetition: parquetRepeated, ConvertedType: -1},
+		{Name: "attrs", Type: -1, NumChildren: 1, ConvertedType: parquetMap},
+		{Name: "key_value", Type: -1, Repetition: parquetRepeated, NumChildren: 2, ConvertedType: -1},
+		{Name: "key", Type: parquetByteArray, ConvertedType: parquetUTF8},
+		{Name: "value", Type: parquetInt64, Repetition: parquetOptional, ConvertedType: -1},
+	}
+	if err := ioutil.WriteFile(path, encodeParquetFooter(elems, 12345), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := InferSchema(context.Background(), path, SchemaOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schema.Rows, int64(12345); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want := []SchemaField{
+		{Name: "id", Type: "int64"},
+		{Name: "name", Type: "*string"},
+		{Name: "count", Type: "uint16"},
+		{Name: "ts", Type: "time.Time"},
+		{Name: "price", Type: "slicetype.Decimal", Comment: "decimal(10, 2)"},
+		{Name: "tags", Type: "[]string"},
+		{Name: "point", Type: "struct {\nX float64 `parquet:\"x\"`\nY []float64 `parquet:\"y\"`\n}"},
+		{Name: "attrs", Type: "map[string]*int64"},
+	}
+	if got := schema.Fields; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var b bytes.Buffer
+	if err := schema.WriteGo(&b, "Row"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\tPoint struct {\n\t\tX float64   `parquet:\"x\"`\n",
+		"point []struct { X float64 `parquet:\"x\"`; Y []float64 `parquet:\"y\"` }, attrs []map[string]*int64) (int, error)",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestInferSchemaParquetInvalid(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t, "", "")
+	defer cleanup()
+	path := filepath.Join(dir, "data.parquet")
+	p := encodeParquetFooter([]parquetElement{{Name: "schema", NumChildren: 1}}, 0)
+	// Truncate the footer.
+	binary.LittleEndian.PutUint32(p[len(p)-8:], 3)
+	if err := ioutil.WriteFile(path, p, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InferSchema(context.Background(), path, SchemaOptions{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// encodeParquetFooter returns the contents of a Parquet file (without
+// any data) whose footer describes the provided schema.
+func encodeParquetFooter(elems []parquetElement, numRows int64) []byte {
+	var e thriftEncoder
+	e.fieldHeader(1, thriftI32)
+	e.zigzag(1)
+	e.fieldHeader(2, thriftList)
+	e.listHeader(len(elems), thriftStruct)
+	for _, elem := range elems {
+		e.push()
+		if elem.Type >= 0 {
+			e.fieldHeader(1, thriftI32)
+			e.zigzag(int64(elem.Type))
+		}
+		e.fieldHeader(3, thriftI32)
+		e.zigzag(int64(elem.Repetition))
+		e.fieldHeader(4, thriftBinary)
+		e.varint(uint64(len(elem.Name)))
+		e.buf.WriteString(elem.Name)
+		if elem.NumChildren > 0 {
+			e.fieldHeader(5, thriftI32)
+			e.zigzag(int64(elem.NumChildren))
+		}
+		if elem.ConvertedType >= 0 {
+			e.fieldHeader(6, thriftI32)
+			e.zigzag(int64(elem.ConvertedType))
+		}
+		if elem.Precision > 0 {
+			e.fieldHeader(7, thriftI32)
+			e.zigzag(int64(elem.Scale))
+			e.fieldHeader(8, thriftI32)
+			e.zigzag(int64(elem.Precision))
+		}
+		if elem.Logical == parquetLogicalInteger {
+			e.fieldHeader(10, thriftStruct)
+			e.push()
+			e.fieldHeader(parquetLogicalInteger, thriftStruct)
+			e.push()
+			e.fieldHeader(1, thriftByte)
+			e.buf.WriteByte(byte(elem.IntWidth))
+			if elem.IntSigned {
+				e.fieldHeader(2, thriftTrue)
+			} else {
+				e.fieldHeader(2, thriftFalse)
+			}
+			e.pop()
+			e.pop()
+		}
+		e.pop()
+	}
+	e.fieldHeader(3, thriftI64)
+	e.zigzag(numRows)
+	// A field that is skipped by the decoder.
+	e.fieldHeader(5, thriftBinary)
+	e.varint(3)
+	e.buf.WriteString("xyz")
+	e.buf.WriteByte(thriftStop)
+
+	var b bytes.Buffer
+	b.WriteString(parquetMagic)
+	b.Write(e.buf.Bytes())
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(e.buf.Len()))
+	b.Write(n[:])
+	b.WriteString(parquetMagic)
+	return b.Bytes()
+}
+
+// thriftEncoder is a minimal encoder for Thrift's compact protocol.
+type thriftEncoder struct {
+	buf    bytes.Buffer
+	last   int16
+	stack  []int16
+	varbuf [binary.MaxVarintLen64]byte
+}
+
+func (e *thriftEncoder) varint(v uint64) {
+	n := binary.PutUvarint(e.varbuf[:], v)
+	e.buf.Write(e.varbuf[:n])
+}
+
+func (e *thriftEncoder) zigzag(v int64) {
+	e.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (e *thriftEncoder) fieldHeader(id int16, typ byte) {
+	if delta := id - e.last; delta > 0 && delta <= 15 {
+		e.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		e.buf.WriteByte(typ)
+		e.zigzag(int64(id))
+	}
+	e.last = id
+}
+
+func (e *thriftEncoder) listHeader(size int, typ byte) {
+	if size < 15 {
+		e.buf.WriteByte(byte(size)<<4 | typ)
+		return
+	}
+	e.buf.WriteByte(0xf0 | typ)
+	e.varint(uint64(size))
+}
+
+// push begins a nested struct.
+func (e *thriftEncoder) push() {
+	e.stack = append(e.stack, e.last)
+	e.last = 0
+}
+
+// pop ends a nested struct.
+func (e *thriftEncoder) pop() {
+	e.buf.WriteByte(thriftStop)
+	e.last = e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+}
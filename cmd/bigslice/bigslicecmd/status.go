@@ -0,0 +1,155 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/exec"
+	"github.com/grailbio/bigslice/sliceconfig"
+)
+
+// StatusUsage is the usage message for the Status command.
+const StatusUsage = `usage: bigslice status [-interval duration] [-once] [addr|job-id]
+
+Command status connects to the status server of a running bigslice
+driver and renders the progress of its invocations, the machines that
+it uses, and its most recent task errors, refreshing them every
+-interval until interrupted, or once with -once.
+
+The driver is identified either by the address of its HTTP server
+(e.g., "localhost:3333"), or by its job ID: drivers whose sessions are
+created by sliceconfig.Parse register themselves under
+$HOME/.bigslice/jobs, and log their job IDs when they start. Without
+arguments, status lists the registered jobs that are running.
+`
+
+// DefaultStatusInterval is the default interval at which status is
+// refreshed.
+const DefaultStatusInterval = 2 * time.Second
+
+// StatusAddr returns the address of the status server of the driver
+// identified by target, which is either the address itself, or the ID
+// of a job registered by sliceconfig.
+func StatusAddr(target string) (string, error) {
+	if strings.Contains(target, ":") {
+		return target, nil
+	}
+	job, err := sliceconfig.LookupJob(target)
+	if err != nil {
+		return "", err
+	}
+	return job.Addr, nil
+}
+
+// driverURL returns the URL of the provided path on the HTTP server
+// of the driver with the provided address.
+func driverURL(addr, path string) string {
+	url := addr
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		if strings.HasPrefix(url, ":") {
+			url = "localhost" + url
+		}
+		url = "http://" + url
+	}
+	return strings.TrimSuffix(url, "/") + path
+}
+
+// FetchSummary fetches the summary of the session of the driver whose
+// status server has the provided address.
+func FetchSummary(ctx context.Context, addr string) (*exec.Summary, error) {
+	req, err := http.NewRequest("GET", driverURL(addr, "/debug/summary"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.E(errors.Unavailable, "driver ", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.E("driver ", addr, ": ", resp.Status)
+	}
+	sum := new(exec.Summary)
+	if err := json.NewDecoder(resp.Body).Decode(sum); err != nil {
+		return nil, errors.E(err, "decoding summary from driver ", addr)
+	}
+	return sum, nil
+}
+
+// RenderSummary renders the provided summary, fetched from the driver
+// with the provided address, as text to w.
+func RenderSummary(w io.Writer, addr string, sum *exec.Summary) error {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	p := sum.Progress
+	fmt.Fprintf(tw, "driver %s (%s executor) at %s\n", addr, sum.Executor, sum.Time.Local().Format(time.RFC3339))
+	fmt.Fprintf(tw, "tasks: %d/%d done (%.0f%%), %d running, %d failed; %d records, %s written",
+		p.Done, p.Tasks, 100*p.Fraction(), p.Running, p.Failed, p.Records, data.Size(p.Bytes))
+	if remaining := p.Remaining(sum.Time); remaining > 0 {
+		fmt.Fprintf(tw, "; ETA %s", remaining.Round(time.Second))
+	}
+	fmt.Fprintln(tw)
+	if len(sum.Invocations) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "inv\tlocation\trunning")
+		for _, inv := range sum.Invocations {
+			running := sum.Time.Sub(inv.Start).Round(time.Second).String()
+			if inv.Canceled {
+				running += " (canceled)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", inv.Index, inv.Location, running)
+		}
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "inv\tstage\tdone\trunning\tfailed\trecords\tbytes\tETA")
+	for _, stage := range p.Stages {
+		eta := "-"
+		if !stage.ETA.IsZero() && stage.ETA.After(sum.Time) {
+			eta = stage.ETA.Sub(sum.Time).Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%d\t%d\t%d\t%s\t%s\n",
+			stage.Invocation, stage.Op, stage.Done, stage.Tasks, stage.Running, stage.Failed,
+			stage.Records, data.Size(stage.Bytes), eta)
+	}
+	if len(sum.Tenants) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "tenant\tprocs\twaiting\truns")
+		for _, t := range sum.Tenants {
+			name := t.Name
+			if name == exec.DefaultTenant {
+				name = "(default)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", name, t.Procs, t.Waiting, t.Runs)
+		}
+	}
+	if len(sum.Machines) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "machine\tstatus")
+		for _, m := range sum.Machines {
+			fmt.Fprintf(tw, "%s\t%s\n", m.Addr, m.Status)
+		}
+	}
+	if len(sum.Errors) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "time\ttask\tmachine\terror")
+		for _, e := range sum.Errors {
+			msg := e.Error
+			if i := strings.IndexByte(msg, '\n'); i >= 0 {
+				msg = msg[:i] + " ..."
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Time.Local().Format("15:04:05"), e.Task, e.Machine, msg)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslicecmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	baseerrors "github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
+)
+
+func TestStatus(t *testing.T) {
+	ints := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Const(2, []int{1, 2, 3, 4})
+	})
+	fail := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, _ *int, out []int) (int, error) {
+			return 0, errors.New("reader failed")
+		})
+	})
+	ctx := context.Background()
+	sess := exec.Start(exec.Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(ctx, ints); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.Run(ctx, fail); err == nil {
+		t.Fatal("expected error")
+	}
+	mux := http.NewServeMux()
+	sess.HandleDebug(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	if got, err := StatusAddr(addr); err != nil || got != addr {
+		t.Errorf("got %v, %v, want %v", got, err, addr)
+	}
+	sum, err := FetchSummary(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sum.Progress.Tasks, 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := sum.Progress.Failed, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(sum.Errors), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var b bytes.Buffer
+	if err := RenderSummary(&b, addr, sum); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"tasks: 2/3 done", "inv1_const", "reader failed"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("status does not contain %q:\n%s", want, b.String())
+		}
+	}
+	if err := Cancel(ctx, addr, 1); !baseerrors.Is(baseerrors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+	// Requests without the cancel header, e.g., forged by browsers, are
+	// rejected.
+	resp, err := http.PostForm(srv.URL+"/debug/cancel", url.Values{"invocation": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusForbidden; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/grailbio/base/must"
 	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
@@ -23,8 +24,10 @@ func buildCmdUsage(flags *flag.FlagSet) {
 
 func buildCmd(args []string) {
 	var (
-		flags  = flag.NewFlagSet("bigslice build", flag.ExitOnError)
-		output = flags.String("o", "", "output path")
+		flags   = flag.NewFlagSet("bigslice build", flag.ExitOnError)
+		output  = flags.String("o", "", "output path")
+		targets = flags.String("targets", strings.Join(bigslicecmd.DefaultTargets, ","),
+			"comma-separated list of GOOS/GOARCH worker platforms")
 	)
 	flags.Usage = func() { buildCmdUsage(flags) }
 	must.Nil(flags.Parse(args))
@@ -38,5 +41,5 @@ func buildCmd(args []string) {
 		paths = []string{"."}
 	}
 	ctx := context.Background()
-	bigslicecmd.Build(ctx, paths, *output)
+	bigslicecmd.BuildTargets(ctx, paths, *output, strings.Split(*targets, ","))
 }
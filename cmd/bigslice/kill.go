@@ -0,0 +1,53 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+)
+
+func killCmdUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, bigslicecmd.KillUsage)
+	flags.PrintDefaults()
+	os.Exit(2)
+}
+
+func killCmd(args []string) {
+	flags := flag.NewFlagSet("bigslice kill", flag.ExitOnError)
+	flags.Usage = func() { killCmdUsage(flags) }
+	must.Nil(flags.Parse(args))
+	if flags.NArg() < 2 {
+		flags.Usage()
+	}
+	addr, err := bigslicecmd.StatusAddr(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	var failed bool
+	for _, arg := range flags.Args()[1:] {
+		index, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid invocation %q", arg)
+		}
+		if err := bigslicecmd.Cancel(ctx, addr, index); err != nil {
+			log.Error.Print(err)
+			failed = true
+			continue
+		}
+		log.Printf("canceled invocation %d", index)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -33,6 +33,12 @@ The commands are:
 	setup-ec2   configure EC2 for use with Bigslice
 	build       build a bigslice program
 	run         run a bigslice program or source files
+	repl        query a bigslice program's tables interactively
+	schema      infer Go column types from a CSV, TSV, or Parquet file
+	reap        list and terminate orphaned bigmachine instances on EC2
+	status      render the live status of a running bigslice driver
+	kill        cancel invocations of a running bigslice driver
+	profiles    list the named profiles with which programs may be run
 `)
 	// TODO(marius): this command pulls in way too many global flags
 	// from other modules, including Vanadium; these dependencies
@@ -62,8 +68,20 @@ func main() {
 		flag.Usage()
 	case "run":
 		runCmd(args)
+	case "repl":
+		replCmd(args)
 	case "build":
 		buildCmd(args)
+	case "schema":
+		schemaCmd(args)
+	case "reap":
+		reapCmd(args)
+	case "status":
+		statusCmd(args)
+	case "kill":
+		killCmd(args)
+	case "profiles":
+		profilesCmd(args)
 	case "setup-ec2":
 		setupEc2Cmd(args)
 	}
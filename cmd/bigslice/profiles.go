@@ -0,0 +1,46 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+	"github.com/grailbio/bigslice/sliceconfig"
+)
+
+func profilesCmdUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, bigslicecmd.ProfilesUsage)
+	flags.PrintDefaults()
+	os.Exit(2)
+}
+
+func profilesCmd(args []string) {
+	flags := flag.NewFlagSet("bigslice profiles", flag.ExitOnError)
+	flags.Usage = func() { profilesCmdUsage(flags) }
+	must.Nil(flags.Parse(args))
+	if flags.NArg() != 0 {
+		flags.Usage()
+	}
+	names, err := sliceconfig.Profiles()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "profile\tpath")
+	for _, name := range names {
+		path, err := sliceconfig.ProfilePath(name)
+		if err != nil {
+			path = "(built-in)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, path)
+	}
+	must.Nil(tw.Flush())
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+)
+
+func reapCmdUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, bigslicecmd.ReapUsage)
+	flags.PrintDefaults()
+	os.Exit(2)
+}
+
+func reapCmd(args []string) {
+	var (
+		flags     = flag.NewFlagSet("bigslice reap", flag.ExitOnError)
+		age       = flags.Duration("age", bigslicecmd.DefaultReapAge, "minimum running time of orphaned instances")
+		user      = flags.String("user", "", "only consider instances started by this user")
+		binary    = flags.String("binary", "", "only consider instances started by this binary")
+		terminate = flags.Bool("terminate", false, "terminate the orphaned instances")
+	)
+	flags.Usage = func() { reapCmdUsage(flags) }
+	must.Nil(flags.Parse(args))
+	if flags.NArg() != 0 {
+		flags.Usage()
+	}
+	sess, err := session.NewSession()
+	must.Nil(err, "setting up AWS session")
+	svc := ec2.New(sess)
+	ctx := context.Background()
+	instances, err := bigslicecmd.Orphans(ctx, svc, bigslicecmd.ReapOptions{
+		Age:    *age,
+		User:   *user,
+		Binary: *binary,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(instances) == 0 {
+		log.Print("no orphaned instances")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "instance\ttype\tuser\tbinary\tlaunched\tage")
+	for _, inst := range instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			inst.ID, inst.Type, inst.User, inst.Binary,
+			inst.Launch.Local().Format(time.RFC3339),
+			time.Since(inst.Launch).Round(time.Minute))
+	}
+	must.Nil(tw.Flush())
+	if !*terminate {
+		return
+	}
+	if err := bigslicecmd.Reap(ctx, svc, instances); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("terminated %d instances", len(instances))
+}
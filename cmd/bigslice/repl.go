@@ -0,0 +1,39 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+)
+
+func replCmdUsage() {
+	fmt.Fprint(os.Stderr, bigslicecmd.ReplUsage)
+	os.Exit(2)
+}
+
+func replCmd(args []string) {
+	for _, arg := range args {
+		if arg == "-help" || arg == "--help" {
+			replCmdUsage()
+		}
+	}
+	// The program's session is configured by sliceconfig, which reads
+	// the environment.
+	must.Nil(os.Setenv("BIGSLICE_REPL", "1"))
+	var buildIndex int
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		buildIndex++
+	}
+	bigslicecmd.Run(context.Background(), args[buildIndex:])
+}
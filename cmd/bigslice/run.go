@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/grailbio/base/must"
 	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
 )
 
@@ -19,6 +20,12 @@ func runCmdUsage() {
 }
 
 func runCmd(args []string) {
+	if len(args) > 0 && (args[0] == "-explain" || args[0] == "--explain") {
+		// The program's session is configured by sliceconfig, which
+		// reads the environment.
+		must.Nil(os.Setenv("BIGSLICE_EXPLAIN", "1"))
+		args = args[1:]
+	}
 	var buildIndex int
 	for _, arg := range args {
 		if arg == "-help" || arg == "--help" {
@@ -0,0 +1,47 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+)
+
+func schemaCmdUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, bigslicecmd.SchemaUsage)
+	flags.PrintDefaults()
+	os.Exit(2)
+}
+
+func schemaCmd(args []string) {
+	var (
+		flags    = flag.NewFlagSet("bigslice schema", flag.ExitOnError)
+		format   = flags.String("format", "", "file format: csv, tsv, or parquet; determined by the file extension by default")
+		sample   = flags.Int("n", bigslicecmd.DefaultSchemaSample, "number of rows sampled from CSV and TSV files")
+		name     = flags.String("name", "Record", "name of the emitted struct type")
+		noHeader = flags.Bool("noheader", false, "the first row of a CSV or TSV file is data, not column names")
+	)
+	flags.Usage = func() { schemaCmdUsage(flags) }
+	must.Nil(flags.Parse(args))
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+	ctx := context.Background()
+	schema, err := bigslicecmd.InferSchema(ctx, flags.Arg(0), bigslicecmd.SchemaOptions{
+		Format:   *format,
+		Sample:   *sample,
+		NoHeader: *noHeader,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	must.Nil(schema.WriteGo(os.Stdout, *name))
+}
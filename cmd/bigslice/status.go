@@ -0,0 +1,81 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/must"
+	"github.com/grailbio/bigslice/cmd/bigslice/bigslicecmd"
+	"github.com/grailbio/bigslice/sliceconfig"
+)
+
+func statusCmdUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, bigslicecmd.StatusUsage)
+	flags.PrintDefaults()
+	os.Exit(2)
+}
+
+func statusCmd(args []string) {
+	var (
+		flags    = flag.NewFlagSet("bigslice status", flag.ExitOnError)
+		interval = flags.Duration("interval", bigslicecmd.DefaultStatusInterval, "interval at which status is refreshed")
+		once     = flags.Bool("once", false, "render status once and exit")
+	)
+	flags.Usage = func() { statusCmdUsage(flags) }
+	must.Nil(flags.Parse(args))
+	switch flags.NArg() {
+	case 0:
+		jobs, err := sliceconfig.Jobs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(jobs) == 0 {
+			log.Print("no running jobs")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "job\taddr\tstarted\tage")
+		for _, job := range jobs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", job.ID, job.Addr,
+				job.Start.Local().Format(time.RFC3339), time.Since(job.Start).Round(time.Second))
+		}
+		must.Nil(tw.Flush())
+		return
+	case 1:
+	default:
+		flags.Usage()
+	}
+	addr, err := bigslicecmd.StatusAddr(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	for {
+		sum, err := bigslicecmd.FetchSummary(ctx, addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var b bytes.Buffer
+		must.Nil(bigslicecmd.RenderSummary(&b, addr, sum))
+		if !*once {
+			// Clear the terminal before each refresh.
+			fmt.Print("\033[H\033[2J")
+		}
+		_, err = b.WriteTo(os.Stdout)
+		must.Nil(err)
+		if *once {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
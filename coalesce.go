@@ -0,0 +1,77 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"fmt"
+
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A ShardCoalescer is a Slice each of whose shards reads a contiguous
+// range of the shards of its single dependency, which is not a shuffle
+// dependency, rather than the same shard. The reader of each shard is
+// passed a single reader, which concatenates the dependency's shards
+// in the range, in order.
+type ShardCoalescer interface {
+	// DepShards returns the range [start, end) of the dependency's
+	// shards that is read by the provided shard.
+	DepShards(shard int) (start, end int)
+}
+
+// Coalesce returns a slice that reduces the number of shards of the
+// provided slice to at most n, by concatenating contiguous ranges of
+// its shards. Schematically:
+//
+//	Coalesce(Slice<t1, ..., tn>, n) Slice<t1, ..., tn>
+//
+// Unlike Reshuffle, Coalesce does not repartition the slice: each of
+// its shards reads the outputs of the tasks that compute a range of the
+// slice's shards, one after the other, so that it is cheap, and rows
+// retain their order. Coalesce is useful to write fewer, larger files
+// from a heavily filtered slice, e.g., before Cache or WriterFunc. The
+// returned slice retains the prefix and shard type of the provided
+// slice: since the ranges are contiguous, a range-sharded slice remains
+// range-sharded.
+//
+// The slice is computed with its own parallelism; only the tasks that
+// read it are coalesced.
+func Coalesce(slice Slice, n int) Slice {
+	if n <= 0 {
+		typecheck.Panicf(1, "coalesce: n must be positive, got %d", n)
+	}
+	if n > slice.NumShard() {
+		n = slice.NumShard()
+	}
+	return &coalesceSlice{MakeName(fmt.Sprintf("coalesce(%d)", n)), slice, n}
+}
+
+type coalesceSlice struct {
+	name Name
+	Slice
+	numShard int
+}
+
+func (c *coalesceSlice) Name() Name             { return c.name }
+func (c *coalesceSlice) NumShard() int          { return c.numShard }
+func (*coalesceSlice) NumDep() int              { return 1 }
+func (c *coalesceSlice) Dep(i int) Dep          { return singleDep(i, c.Slice, false) }
+func (*coalesceSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// MaxRows implements Sizer.
+func (c *coalesceSlice) MaxRows() int { return maxRows(c.Slice) }
+
+// DepShards implements ShardCoalescer. The dependency's shards are
+// spread evenly across the coalesced shards.
+func (c *coalesceSlice) DepShards(shard int) (start, end int) {
+	n := c.Slice.NumShard()
+	return shard * n / c.numShard, (shard + 1) * n / c.numShard
+}
+
+func (*coalesceSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestCoalesce(t *testing.T) {
+	const N = 1000
+	keys := make([]string, N)
+	vals := make([]int, N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+		vals[i] = i
+	}
+	slice := bigslice.Const(16, keys, vals)
+	slice = bigslice.Filter(slice, func(key string, val int) bool { return val%100 == 0 })
+	coalesced := bigslice.Coalesce(slice, 3)
+	if got, want := coalesced.NumShard(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var (
+		expectKeys []string
+		expectVals []int
+	)
+	for i := 0; i < N; i += 100 {
+		expectKeys = append(expectKeys, fmt.Sprint(i))
+		expectVals = append(expectVals, i)
+	}
+	// Coalescing retains the order of the rows.
+	var gotVals []int
+	slicetest.RunAndScan(t, coalesced, new([]string), &gotVals)
+	for i := 1; i < len(gotVals); i++ {
+		if gotVals[i-1] > gotVals[i] {
+			t.Errorf("rows out of order: %v", gotVals)
+			break
+		}
+	}
+	assertEqual(t, coalesced, true, expectKeys, expectVals)
+
+	// Coalesced slices may be pipelined and shuffled.
+	mapped := bigslice.Map(coalesced, func(key string, val int) (string, int) { return "x", 1 })
+	reduced := bigslice.Reduce(mapped, func(a, b int) int { return a + b })
+	assertEqual(t, reduced, false, []string{"x"}, []int{N / 100})
+
+	// Slices are not coalesced into more shards than they have.
+	if got, want := bigslice.Coalesce(slice, 100).NumShard(), 16; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCoalesceError(t *testing.T) {
+	slice := bigslice.Const(1, []string{"x"})
+	expectTypeError(t, "coalesce: n must be positive, got 0", func() { bigslice.Coalesce(slice, 0) })
+}
@@ -39,18 +39,38 @@ type cogroupSlice struct {
 // TODO(marius): don't require spilling to disk when the input data
 // set is small enough.
 //
-// TODO(marius): consider providing a version that returns scanners
-// in the returned slice, so that we can stream through. This would
-// require some changes downstream, however, so that buffering and
-// encoding functionality also know how to read scanner values.
+// Cogroup materializes the values of each key in memory; use
+// CogroupFunc to stream through them instead.
 func Cogroup(slices ...Slice) Slice {
+	keyTypes := cogroupKeyTypes("cogroup", slices)
+	out := keyTypes
+	for _, slice := range slices {
+		for i := len(keyTypes); i < slice.NumOut(); i++ {
+			out = append(out, reflect.SliceOf(slice.Out(i)))
+		}
+	}
+
+	return &cogroupSlice{
+		name:     MakeName("cogroup"),
+		numShard: cogroupNumShard(slices),
+		slices:   slices,
+		out:      out,
+		prefix:   len(keyTypes),
+	}
+}
+
+// cogroupKeyTypes returns the key types of the provided slices, which
+// are to be cogrouped by the named operation. It panics with a type
+// error, on behalf of its caller's caller, if the slices cannot be
+// cogrouped.
+func cogroupKeyTypes(op string, slices []Slice) []reflect.Type {
 	if len(slices) == 0 {
-		typecheck.Panic(1, "cogroup: expected at least one slice")
+		typecheck.Panicf(2, "%s: expected at least one slice", op)
 	}
 	var keyTypes []reflect.Type
 	for i, slice := range slices {
 		if slice.NumOut() == 0 {
-			typecheck.Panicf(1, "cogroup: slice %d has no columns", i)
+			typecheck.Panicf(2, "%s: slice %d has no columns", op, i)
 		}
 		if i == 0 {
 			keyTypes = make([]reflect.Type, slice.Prefix())
@@ -59,46 +79,37 @@ func Cogroup(slices ...Slice) Slice {
 			}
 		} else {
 			if got, want := slice.Prefix(), len(keyTypes); got != want {
-				typecheck.Panicf(1, "cogroup: prefix mismatch: expected %d but got %d", want, got)
+				typecheck.Panicf(2, "%s: prefix mismatch: expected %d but got %d", op, want, got)
 			}
 			for j := range keyTypes {
 				if got, want := slice.Out(j), keyTypes[j]; got != want {
-					typecheck.Panicf(1, "cogroup: key column type mismatch: expected %s but got %s", want, got)
+					typecheck.Panicf(2, "%s: key column type mismatch: expected %s but got %s", op, want, got)
 				}
 			}
 		}
 	}
 	for i := range keyTypes {
 		if !frame.CanHash(keyTypes[i]) {
-			typecheck.Panicf(1, "cogroup: key column(%d) type %s cannot be hashed", i, keyTypes[i])
+			typecheck.Panicf(2, "%s: key column(%d) type %s cannot be hashed", op, i, keyTypes[i])
 		}
 		if !frame.CanCompare(keyTypes[i]) {
-			typecheck.Panicf(1, "cogroup: key column(%d) type %s cannot be sorted", i, keyTypes[i])
-		}
-	}
-	out := keyTypes
-	for _, slice := range slices {
-		for i := len(keyTypes); i < slice.NumOut(); i++ {
-			out = append(out, reflect.SliceOf(slice.Out(i)))
+			typecheck.Panicf(2, "%s: key column(%d) type %s cannot be sorted", op, i, keyTypes[i])
 		}
 	}
+	return keyTypes
+}
 
-	// Pick the max of the number of parent shards, so that the input
-	// will be partitioned as widely as the user desires.
+// cogroupNumShard returns the number of shards of a cogroup of the
+// provided slices: the max of the number of their shards, so that the
+// input will be partitioned as widely as the user desires.
+func cogroupNumShard(slices []Slice) int {
 	var numShard int
 	for _, slice := range slices {
 		if slice.NumShard() > numShard {
 			numShard = slice.NumShard()
 		}
 	}
-
-	return &cogroupSlice{
-		name:     MakeName("cogroup"),
-		numShard: numShard,
-		slices:   slices,
-		out:      out,
-		prefix:   len(keyTypes),
-	}
+	return numShard
 }
 
 func (c *cogroupSlice) Name() Name             { return c.name }
@@ -108,7 +119,7 @@ func (c *cogroupSlice) NumOut() int            { return len(c.out) }
 func (c *cogroupSlice) Out(i int) reflect.Type { return c.out[i] }
 func (c *cogroupSlice) Prefix() int            { return c.prefix }
 func (c *cogroupSlice) NumDep() int            { return len(c.slices) }
-func (c *cogroupSlice) Dep(i int) Dep          { return Dep{c.slices[i], true, nil, false} }
+func (c *cogroupSlice) Dep(i int) Dep          { return Dep{c.slices[i], true, nil, false, false} }
 func (*cogroupSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
 
 type cogroupReader struct {
@@ -270,3 +281,280 @@ func (c *cogroupSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
 		readers: deps,
 	}
 }
+
+var typeOfValues = reflect.TypeOf((*Values)(nil))
+
+type cogroupFuncSlice struct {
+	name     Name
+	slices   []Slice
+	fval     slicefunc.Func
+	out      []reflect.Type
+	prefix   int
+	numShard int
+}
+
+// CogroupFunc returns a slice that, for each key in any slice, contains
+// the key, and the values returned by the provided function for the
+// values of that key in each slice. The function is passed the key,
+// followed by a *Values for each slice, which iterates over the
+// slice's values of the key, and it returns one or more columns.
+// Schematically:
+//
+//	CogroupFunc(func(tk1, ..., tkp, *Values, ..., *Values) (r1, ..., rq),
+//		Slice<tk1, ..., tkp, t11, ..., t1n>, ..., Slice<tk1, ..., tkp, tm1, ..., tmn>)
+//		Slice<tk1, ..., tkp, r1, ..., rq>
+//
+// Unlike Cogroup, CogroupFunc does not materialize the values of each
+// key: they are streamed from each slice's sorted (and possibly
+// spilled) input as the function scans them, so that keys with very
+// many values can be processed in bounded memory. Values are valid
+// only during the call of the function that was passed them. For
+// example, the following computes, for each user, the number of
+// events and the largest purchase:
+//
+//	bigslice.CogroupFunc(func(user string, events, purchases *bigslice.Values) (int, float64) {
+//		var (
+//			n      int
+//			event  string
+//			amount float64
+//			max    float64
+//		)
+//		for events.Scan(&event) {
+//			n++
+//		}
+//		for purchases.Scan(&amount) {
+//			if amount > max {
+//				max = amount
+//			}
+//		}
+//		return n, max
+//	}, events, purchases)
+//
+// The function may accept a context.Context as its first argument.
+// Keys must be partitionable and sortable, as for Cogroup.
+func CogroupFunc(fn interface{}, slices ...Slice) Slice {
+	keyTypes := cogroupKeyTypes("cogroupfunc", slices)
+	arg, ret, ok := typecheck.Func(fn)
+	if !ok {
+		typecheck.Panicf(1, "cogroupfunc: invalid cogroup function %T", fn)
+	}
+	expect := append([]reflect.Type(nil), keyTypes...)
+	for range slices {
+		expect = append(expect, typeOfValues)
+	}
+	if !typecheck.Equal(slicetype.New(expect...), arg) {
+		typecheck.Panicf(1, "cogroupfunc: function %T does not match expected signature %s",
+			fn, slicetype.Signature(slicetype.New(expect...), ret))
+	}
+	if ret.NumOut() == 0 {
+		typecheck.Panic(1, "cogroupfunc: need at least one output column")
+	}
+	out := append([]reflect.Type(nil), keyTypes...)
+	out = append(out, slicetype.Columns(ret)...)
+	return &cogroupFuncSlice{
+		name:     MakeName("cogroupfunc"),
+		slices:   slices,
+		fval:     slicefunc.Of(fn),
+		out:      out,
+		prefix:   len(keyTypes),
+		numShard: cogroupNumShard(slices),
+	}
+}
+
+func (c *cogroupFuncSlice) Name() Name             { return c.name }
+func (c *cogroupFuncSlice) NumShard() int          { return c.numShard }
+func (c *cogroupFuncSlice) ShardType() ShardType   { return HashShard }
+func (c *cogroupFuncSlice) NumOut() int            { return len(c.out) }
+func (c *cogroupFuncSlice) Out(i int) reflect.Type { return c.out[i] }
+func (c *cogroupFuncSlice) Prefix() int            { return c.prefix }
+func (c *cogroupFuncSlice) NumDep() int            { return len(c.slices) }
+func (c *cogroupFuncSlice) Dep(i int) Dep          { return Dep{c.slices[i], true, nil, false, false} }
+func (*cogroupFuncSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (c *cogroupFuncSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &cogroupFuncReader{op: c, readers: deps}
+}
+
+// Values iterates over the values of a single key in one of the slices
+// of a CogroupFunc. See CogroupFunc.
+type Values struct {
+	r    *cogroupFuncReader
+	side int
+	done bool
+}
+
+// Scan scans the next value of the key into the provided pointers,
+// one for each value column of the slice, and returns whether there
+// was one. Scan returns false once the key's values are exhausted, or
+// if an error occurred, in which case the error is returned by the
+// cogroup's reader once the function returns. Scan panics if the
+// pointers do not match the slice's value columns.
+func (v *Values) Scan(values ...interface{}) bool {
+	if v.done || v.r.err != nil {
+		return false
+	}
+	var (
+		typ    = v.r.op.slices[v.side]
+		prefix = v.r.op.prefix
+	)
+	if got, want := len(values), typ.NumOut()-prefix; got != want {
+		typecheck.Panicf(1, "cogroupfunc: wrong arity: expected %d columns, got %d", want, got)
+	}
+	for i := range values {
+		if got, want := reflect.TypeOf(values[i]), reflect.PtrTo(typ.Out(prefix+i)); got != want {
+			typecheck.Panicf(1, "cogroupfunc: wrong type for argument %d: expected %s, got %s", i, want, got)
+		}
+	}
+	if !v.r.atKey(v.side) {
+		v.done = true
+		return false
+	}
+	buf := v.r.bufs[v.side]
+	for i := range values {
+		reflect.ValueOf(values[i]).Elem().Set(buf.Frame.Index(prefix+i, buf.Index))
+	}
+	v.r.advance(v.side)
+	return true
+}
+
+type cogroupFuncReader struct {
+	err error
+	op  *cogroupFuncSlice
+
+	readers []sliceio.Reader
+	// bufs holds the sorted input of each dependency; a buffer is nil
+	// once its input is exhausted.
+	bufs []*sortio.FrameBuffer
+	// ctx is the context of the current read, used to refill buffers
+	// while the function scans values.
+	ctx context.Context
+	// key holds the current key in its first row. It is used to compare
+	// keys across the heterogeneously typed buffers.
+	key frame.Frame
+}
+
+// atKey returns whether the buffer of the provided side is positioned
+// at a value of the current key.
+func (c *cogroupFuncReader) atKey(side int) bool {
+	buf := c.bufs[side]
+	if buf == nil {
+		return false
+	}
+	for i := 0; i < c.op.prefix; i++ {
+		c.key.Index(i, 1).Set(buf.Frame.Index(i, buf.Index))
+	}
+	// Buffers are sorted, and are never behind the current key.
+	return !c.key.Less(0, 1)
+}
+
+// advance advances the buffer of the provided side to its next value,
+// refilling it as needed.
+func (c *cogroupFuncReader) advance(side int) {
+	buf := c.bufs[side]
+	buf.Index++
+	if buf.Index < buf.Len {
+		return
+	}
+	switch err := buf.Fill(c.ctx); {
+	case err == sliceio.EOF:
+		c.bufs[side] = nil
+	case err != nil:
+		c.err = err
+		c.bufs[side] = nil
+	}
+}
+
+func (c *cogroupFuncReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const (
+		bufferSize = 128
+		spillSize  = 1 << 25
+	)
+	if c.err != nil {
+		return 0, c.err
+	}
+	if !slicetype.Assignable(out, c.op) {
+		return 0, errTypeError
+	}
+	c.ctx = ctx
+	if c.bufs == nil {
+		c.key = frame.Make(slicetype.New(c.op.out[:c.op.prefix]...), 2, 2).Prefixed(c.op.prefix)
+		c.bufs = make([]*sortio.FrameBuffer, len(c.readers))
+		for i := range c.readers {
+			var sorted sliceio.Reader
+			sorted, c.err = sortio.SortReader(ctx, spillSize, c.op.Dep(i), c.readers[i])
+			if c.err != nil {
+				return 0, c.err
+			}
+			buf := &sortio.FrameBuffer{
+				Frame:  frame.Make(c.op.Dep(i), bufferSize, bufferSize),
+				Reader: sorted,
+			}
+			switch err := buf.Fill(ctx); {
+			case err == sliceio.EOF:
+				// No data. Skip.
+			case err != nil:
+				c.err = err
+				return 0, err
+			default:
+				c.bufs[i] = buf
+			}
+		}
+	}
+	var (
+		n    int
+		args = make([]reflect.Value, c.op.prefix+len(c.bufs))
+	)
+	for n < out.Len() {
+		// Find the smallest key among the buffers, and make it current.
+		min := -1
+		for i, buf := range c.bufs {
+			if buf == nil {
+				continue
+			}
+			if min >= 0 {
+				for j := 0; j < c.op.prefix; j++ {
+					c.key.Index(j, 1).Set(buf.Frame.Index(j, buf.Index))
+				}
+				if !c.key.Less(1, 0) {
+					continue
+				}
+			}
+			min = i
+			for j := 0; j < c.op.prefix; j++ {
+				c.key.Index(j, 0).Set(buf.Frame.Index(j, buf.Index))
+			}
+		}
+		if min < 0 {
+			c.err = sliceio.EOF
+			break
+		}
+		for j := 0; j < c.op.prefix; j++ {
+			args[j] = c.key.Index(j, 0)
+			out.Index(j, n).Set(args[j])
+		}
+		values := make([]*Values, len(c.bufs))
+		for i := range values {
+			values[i] = &Values{r: c, side: i}
+			args[c.op.prefix+i] = reflect.ValueOf(values[i])
+		}
+		rvs := c.op.fval.Call(ctx, args)
+		// Skip the values that were not scanned by the function.
+		for i := range values {
+			values[i].done = true
+			for c.err == nil && c.atKey(i) {
+				c.advance(i)
+			}
+		}
+		if c.err != nil {
+			return n, c.err
+		}
+		for j, rv := range rvs {
+			out.Index(c.op.prefix+j, n).Set(rv)
+		}
+		n++
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, c.err
+}
@@ -5,11 +5,15 @@
 package bigslice_test
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
 	"github.com/grailbio/bigslice/slicetype"
 )
 
@@ -141,3 +145,92 @@ func TestCogroupPrefixed(t *testing.T) {
 		}
 	}
 }
+
+func TestCogroupFunc(t *testing.T) {
+	data1 := []interface{}{
+		[]string{"z", "b", "d", "d"},
+		[]int{1, 2, 3, 4},
+	}
+	data2 := []interface{}{
+		[]string{"x", "y", "z", "d"},
+		[]string{"one", "two", "three", "four"},
+	}
+	sharding := [][]int{{1, 1}, {1, 4}, {2, 1}, {4, 4}}
+	for _, shard := range sharding {
+		slice1 := bigslice.Const(shard[0], data1...)
+		slice2 := bigslice.Const(shard[1], data2...)
+		slice := bigslice.CogroupFunc(func(key string, ints, strs *bigslice.Values) (int, int) {
+			var (
+				sum, n int
+				i      int
+				s      string
+			)
+			for ints.Scan(&i) {
+				sum += i
+			}
+			for strs.Scan(&s) {
+				n++
+			}
+			return sum, n
+		}, slice1, slice2)
+		assertEqual(t, slice, true,
+			[]string{"b", "d", "x", "y", "z"},
+			[]int{2, 7, 0, 0, 1},
+			[]int{0, 1, 1, 1, 1},
+		)
+		if testing.Short() {
+			break
+		}
+	}
+}
+
+func TestCogroupFuncStreaming(t *testing.T) {
+	const N = 100000
+	keys := make([]string, N)
+	values := make([]int, N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i % 3)
+		values[i] = i
+	}
+	slice := bigslice.Const(4, keys, values)
+	// Values need not be scanned in full: the rest are skipped.
+	slice = bigslice.CogroupFunc(func(key string, values *bigslice.Values) (int, int) {
+		var count, v, min int
+		for count < N/6 && values.Scan(&v) {
+			if count == 0 || v < min {
+				min = v
+			}
+			count++
+		}
+		return count, min % 3
+	}, slice)
+	assertEqual(t, slice, true,
+		[]string{"0", "1", "2"},
+		[]int{N / 6, N / 6, N / 6},
+		[]int{0, 1, 2},
+	)
+}
+
+func TestCogroupFuncError(t *testing.T) {
+	ints := bigslice.Const(1, []string{"a"}, []int{1})
+	expectTypeError(t, "cogroupfunc: expected at least one slice", func() {
+		bigslice.CogroupFunc(func() int { return 0 })
+	})
+	expectTypeError(t, "cogroupfunc: function func(string, []int) int does not match expected signature func(string, *bigslice.Values) int", func() {
+		bigslice.CogroupFunc(func(string, []int) int { return 0 }, ints)
+	})
+	expectTypeError(t, "cogroupfunc: need at least one output column", func() {
+		bigslice.CogroupFunc(func(string, *bigslice.Values) {}, ints)
+	})
+	slice := bigslice.CogroupFunc(func(key string, values *bigslice.Values) int {
+		var s string
+		values.Scan(&s)
+		return 0
+	}, ints)
+	fn := bigslice.Func(func() bigslice.Slice { return slice })
+	sess := exec.Start(exec.Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), fn); err == nil || !strings.Contains(err.Error(), "wrong type for argument 0") {
+		t.Errorf("got %v, want type error", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// The operators in this file implement trivial, per-record transforms
+// directly on column vectors. They are equivalent to simple Maps, but
+// do not pay the cost of a reflective function call per record.
+
+type selectColumnsSlice struct {
+	name Name
+	Slice
+	cols []int
+	out  slicetype.Type
+}
+
+// SelectColumns returns a slice that contains the provided columns of
+// slice, in the order given. Columns may be selected more than once.
+// Since columns are positional, SelectColumns is also the means by which
+// columns are reordered. The returned slice has a prefix of 1.
+//
+// Schematically:
+//
+//	SelectColumns(Slice<t0, t1, t2>, 2, 0) Slice<t2, t0>
+func SelectColumns(slice Slice, cols ...int) Slice {
+	if len(cols) == 0 {
+		typecheck.Panic(1, "selectcolumns: need at least one column")
+	}
+	out := make([]reflect.Type, len(cols))
+	for i, col := range cols {
+		if col < 0 || col >= slice.NumOut() {
+			typecheck.Panicf(1, "selectcolumns: column %d out of range for slice %s", col, slicetype.String(slice))
+		}
+		out[i] = slice.Out(col)
+	}
+	return &selectColumnsSlice{
+		name:  MakeName("selectcolumns"),
+		Slice: slice,
+		cols:  append([]int(nil), cols...),
+		out:   slicetype.New(out...),
+	}
+}
+
+func (s *selectColumnsSlice) Name() Name             { return s.name }
+func (s *selectColumnsSlice) NumOut() int            { return s.out.NumOut() }
+func (s *selectColumnsSlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (*selectColumnsSlice) Prefix() int              { return 1 }
+func (*selectColumnsSlice) ShardType() ShardType     { return HashShard }
+func (*selectColumnsSlice) NumDep() int              { return 1 }
+func (s *selectColumnsSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*selectColumnsSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// ColumnName implements slicetype.NamedType.
+func (s *selectColumnsSlice) ColumnName(i int) string {
+	return slicetype.ColumnName(s.Slice, s.cols[i])
+}
+
+type selectColumnsReader struct {
+	op     *selectColumnsSlice
+	reader sliceio.Reader
+	in     frame.Frame
+}
+
+func (r *selectColumnsReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	n := out.Len()
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, n, n)
+	} else {
+		r.in = r.in.Ensure(n)
+	}
+	n, err := r.reader.Read(ctx, r.in.Slice(0, n))
+	for i, col := range r.op.cols {
+		reflect.Copy(out.Value(i), r.in.Value(col).Slice(0, n))
+	}
+	return n, err
+}
+
+func (s *selectColumnsSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &selectColumnsReader{op: s, reader: deps[0]}
+}
+
+// DepColumns implements ColumnUser.
+func (s *selectColumnsSlice) DepColumns(used []bool) []bool {
+	dep := make([]bool, s.Slice.NumOut())
+	for i, col := range s.cols {
+		dep[col] = dep[col] || used[i]
+	}
+	return dep
+}
+
+type addConstantColumnSlice struct {
+	name Name
+	Slice
+	value reflect.Value
+	out   slicetype.Type
+}
+
+// AddConstantColumn returns a slice that appends to each record of slice
+// a column with the provided value. The type of the new column is the
+// type of value, which must not be nil. The returned slice retains the
+// prefix of slice.
+//
+// Schematically:
+//
+//	AddConstantColumn(Slice<t1, ..., tn>, v t) Slice<t1, ..., tn, t>
+func AddConstantColumn(slice Slice, value interface{}) Slice {
+	if value == nil {
+		typecheck.Panic(1, "addconstantcolumn: value must not be nil")
+	}
+	v := reflect.ValueOf(value)
+	out := make([]reflect.Type, slice.NumOut()+1)
+	for i := 0; i < slice.NumOut(); i++ {
+		out[i] = slice.Out(i)
+	}
+	out[slice.NumOut()] = v.Type()
+	return &addConstantColumnSlice{
+		name:  MakeName("addconstantcolumn"),
+		Slice: slice,
+		value: v,
+		out:   slicetype.New(out...),
+	}
+}
+
+func (s *addConstantColumnSlice) Name() Name             { return s.name }
+func (s *addConstantColumnSlice) NumOut() int            { return s.out.NumOut() }
+func (s *addConstantColumnSlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (*addConstantColumnSlice) ShardType() ShardType     { return HashShard }
+func (*addConstantColumnSlice) NumDep() int              { return 1 }
+func (s *addConstantColumnSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*addConstantColumnSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// ColumnName implements slicetype.NamedType. The constant column is
+// unnamed.
+func (s *addConstantColumnSlice) ColumnName(i int) string {
+	if i < s.Slice.NumOut() {
+		return slicetype.ColumnName(s.Slice, i)
+	}
+	return ""
+}
+
+type addConstantColumnReader struct {
+	op     *addConstantColumnSlice
+	reader sliceio.Reader
+}
+
+func (r *addConstantColumnReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	// Read the input columns directly into the output frame.
+	cols := out.Values()
+	last := len(cols) - 1
+	n, err := r.reader.Read(ctx, frame.Values(cols[:last]))
+	if n > 0 {
+		// Fill the constant column by repeated doubling, so that the number
+		// of (reflective) copies is logarithmic in n.
+		col := cols[last]
+		col.Index(0).Set(r.op.value)
+		for m := 1; m < n; m *= 2 {
+			reflect.Copy(col.Slice(m, n), col.Slice(0, m))
+		}
+	}
+	return n, err
+}
+
+func (s *addConstantColumnSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &addConstantColumnReader{op: s, reader: deps[0]}
+}
+
+// DepColumns implements ColumnUser.
+func (s *addConstantColumnSlice) DepColumns(used []bool) []bool {
+	return used[:len(used)-1]
+}
+
+type castColumnSlice struct {
+	name Name
+	Slice
+	col int
+	out slicetype.Type
+}
+
+// CastColumn returns a slice in which column col of slice is converted
+// to type typ, following Go's conversion rules. The column's type must be
+// convertible to typ. Integer columns cannot be converted to strings,
+// which Go would interpret as runes; use Map with strconv to format them
+// instead. The returned slice retains the prefix of slice; note that
+// converting a key column may change how keys are ordered.
+//
+// Schematically:
+//
+//	CastColumn(Slice<t1, ..., tcol, ..., tn>, col, typ) Slice<t1, ..., typ, ..., tn>
+func CastColumn(slice Slice, col int, typ reflect.Type) Slice {
+	if col < 0 || col >= slice.NumOut() {
+		typecheck.Panicf(1, "castcolumn: column %d out of range for slice %s", col, slicetype.String(slice))
+	}
+	if !slice.Out(col).ConvertibleTo(typ) {
+		typecheck.Panicf(1, "castcolumn: column %d of type %s cannot be converted to %s", col, slice.Out(col), typ)
+	}
+	if isInteger(slice.Out(col)) && typ.Kind() == reflect.String {
+		typecheck.Panicf(1, "castcolumn: column %d of integer type %s cannot be converted to %s", col, slice.Out(col), typ)
+	}
+	out := make([]reflect.Type, slice.NumOut())
+	for i := range out {
+		out[i] = slice.Out(i)
+	}
+	out[col] = typ
+	return &castColumnSlice{
+		name:  MakeName("castcolumn"),
+		Slice: slice,
+		col:   col,
+		out:   slicetype.New(out...),
+	}
+}
+
+// isInteger tells whether typ is an integer type.
+func isInteger(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func (s *castColumnSlice) Name() Name             { return s.name }
+func (s *castColumnSlice) NumOut() int            { return s.out.NumOut() }
+func (s *castColumnSlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (*castColumnSlice) ShardType() ShardType     { return HashShard }
+func (*castColumnSlice) NumDep() int              { return 1 }
+func (s *castColumnSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*castColumnSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// ColumnName implements slicetype.NamedType.
+func (s *castColumnSlice) ColumnName(i int) string { return slicetype.ColumnName(s.Slice, i) }
+
+type castColumnReader struct {
+	op     *castColumnSlice
+	reader sliceio.Reader
+	// in is a buffer for the unconverted column.
+	in reflect.Value
+}
+
+func (r *castColumnReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	n := out.Len()
+	if !r.in.IsValid() || r.in.Len() < n {
+		r.in = reflect.MakeSlice(reflect.SliceOf(r.op.Slice.Out(r.op.col)), n, n)
+	}
+	// Read all other columns directly into the output frame.
+	cols := out.Values()
+	col := cols[r.op.col]
+	cols[r.op.col] = r.in.Slice(0, n)
+	n, err := r.reader.Read(ctx, frame.Values(cols))
+	typ := r.op.out.Out(r.op.col)
+	for i := 0; i < n; i++ {
+		col.Index(i).Set(r.in.Index(i).Convert(typ))
+	}
+	return n, err
+}
+
+func (s *castColumnSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &castColumnReader{op: s, reader: deps[0]}
+}
+
+// DepColumns implements ColumnUser.
+func (*castColumnSlice) DepColumns(used []bool) []bool { return used }
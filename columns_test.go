@@ -0,0 +1,85 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestSelectColumns(t *testing.T) {
+	const N = 10000
+	ints := make([]int, N)
+	strs := make([]string, N)
+	floats := make([]float64, N)
+	for i := range ints {
+		ints[i] = i
+		strs[i] = fmt.Sprint(i)
+		floats[i] = float64(i) / 2
+	}
+	slice := bigslice.Const(5, ints, strs, floats)
+	// Note that assertEqual sorts expected columns in place, so they must
+	// not alias each other nor the input.
+	var (
+		wantStrs    = append([]string(nil), strs...)
+		wantFloats  = append([]float64(nil), floats...)
+		wantInts    = append([]int(nil), ints...)
+		wantFloats2 = append([]float64(nil), floats...)
+	)
+	assertEqual(t, bigslice.SelectColumns(slice, 1, 2, 0, 2), true, wantStrs, wantFloats, wantInts, wantFloats2)
+	assertEqual(t, bigslice.SelectColumns(slice, 1), true, append([]string(nil), strs...))
+}
+
+func TestSelectColumnsError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x", "y"}, []int{1, 2})
+	expectTypeError(t, "selectcolumns: need at least one column", func() { bigslice.SelectColumns(input) })
+	expectTypeError(t, "selectcolumns: column 2 out of range for slice slice[1]string,int", func() { bigslice.SelectColumns(input, 0, 2) })
+}
+
+func TestAddConstantColumn(t *testing.T) {
+	const N = 10000
+	var (
+		strs   = make([]string, N)
+		consts = make([]int, N)
+	)
+	for i := range strs {
+		strs[i] = fmt.Sprint(i)
+		consts[i] = 123
+	}
+	slice := bigslice.Const(7, strs)
+	slice = bigslice.AddConstantColumn(slice, 123)
+	assertEqual(t, slice, true, strs, consts)
+	expectTypeError(t, "addconstantcolumn: value must not be nil", func() { bigslice.AddConstantColumn(slice, nil) })
+}
+
+type sampleID string
+
+func TestCastColumn(t *testing.T) {
+	const N = 10000
+	var (
+		ints   = make([]int, N)
+		ids    = make([]sampleID, N)
+		strs   = make([]string, N)
+		floats = make([]float64, N)
+	)
+	for i := range ints {
+		ints[i] = i
+		ids[i] = sampleID(fmt.Sprint(i))
+		strs[i] = fmt.Sprint(i)
+		floats[i] = float64(i)
+	}
+	slice := bigslice.Const(3, ids, ints)
+	assertEqual(t, bigslice.CastColumn(slice, 0, reflect.TypeOf("")), true,
+		append([]string(nil), strs...), append([]int(nil), ints...))
+	slice = bigslice.CastColumn(slice, 0, reflect.TypeOf(""))
+	assertEqual(t, bigslice.CastColumn(slice, 1, reflect.TypeOf(0.0)), true, strs, floats)
+	expectTypeError(t, "castcolumn: column 0 of type bigslice_test.sampleID cannot be converted to float64", func() { bigslice.CastColumn(bigslice.Const(1, ids), 0, reflect.TypeOf(0.0)) })
+	// Go converts integers to strings as runes, e.g., 65 to "A".
+	expectTypeError(t, "castcolumn: column 1 of integer type int cannot be converted to string", func() { bigslice.CastColumn(slice, 1, reflect.TypeOf("")) })
+	expectTypeError(t, "castcolumn: column 0 of integer type uint8 cannot be converted to bigslice_test.sampleID", func() { bigslice.CastColumn(bigslice.Const(1, []byte{65}), 0, reflect.TypeOf(sampleID(""))) })
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Cross returns a slice that contains a row for each pair of rows in
+// the provided slices: the cartesian product of the slices.
+// Schematically:
+//
+//	Cross(Slice<t11, ..., t1n>, Slice<t21, ..., t2m>)
+//		Slice<t11, ..., t1n, t21, ..., t2m>
+//
+// Cross is meant for small-by-large pairwise computations, e.g.,
+// scoring the similarity of each of a large set of items with each of
+// a small set of queries. Its small side is broadcast: it is read in
+// full into memory by each shard of the large side, which is crossed
+// with it as it is computed. The returned slice thus has the shards of
+// the large side, and the prefix of the left side. The small side is
+// the one with the Broadcast pragma, or else the one that declares the
+// fewest rows (see Sized and Sizer); if neither does, it is the right
+// side.
+//
+// Since the size of the product is the product of the sizes of the
+// slices, most uses should instead use CrossFilter, which discards the
+// pairs that are not needed before they are materialized.
+func Cross(left, right Slice) Slice {
+	return makeCrossSlice("cross", left, right, nil)
+}
+
+// CrossFilter returns a slice that contains a row for each pair of
+// rows in the provided slices that is accepted by the provided
+// predicate. The predicate is called with the columns of the left and
+// right rows of each pair, and returns whether the pair is retained.
+// Schematically:
+//
+//	CrossFilter(Slice<t11, ..., t1n>, Slice<t21, ..., t2m>, func(t11, ..., t1n, t21, ..., t2m) bool)
+//		Slice<t11, ..., t1n, t21, ..., t2m>
+//
+// The predicate is evaluated as the pairs are formed, so that rejected
+// pairs are never materialized. See Cross for how the slices are
+// crossed.
+func CrossFilter(left, right Slice, pred interface{}) Slice {
+	return makeCrossSlice("crossfilter", left, right, pred)
+}
+
+type crossSlice struct {
+	name   Name
+	slices [2]Slice
+	out    slicetype.Type
+	pred   slicefunc.Func
+	// broadcast is the side of the product that is broadcast.
+	broadcast int
+}
+
+// makeCrossSlice returns the product of the provided slices, filtered
+// by the provided predicate, if any. It panics with a type error if the
+// predicate does not match the slices.
+func makeCrossSlice(op string, left, right Slice, pred interface{}) Slice {
+	var out []reflect.Type
+	for _, slice := range [2]Slice{left, right} {
+		for i := 0; i < slice.NumOut(); i++ {
+			out = append(out, slice.Out(i))
+		}
+	}
+	c := &crossSlice{
+		name:      MakeName(op),
+		slices:    [2]Slice{left, right},
+		out:       slicetype.New(out...),
+		pred:      slicefunc.Nil,
+		broadcast: innerJoin.broadcastSide(left, right),
+	}
+	if c.broadcast < 0 {
+		c.broadcast = 1
+	}
+	if pred == nil {
+		return c
+	}
+	arg, ret, ok := typecheck.Func(pred)
+	if !ok {
+		typecheck.Panicf(2, "%s: invalid predicate function %T", op, pred)
+	}
+	if !typecheck.Equal(c.out, arg) {
+		typecheck.Panicf(2, "%s: function %T does not match input slice types %s and %s",
+			op, pred, slicetype.String(left), slicetype.String(right))
+	}
+	if ret.NumOut() != 1 || ret.Out(0).Kind() != reflect.Bool {
+		typecheck.Panicf(2, "%s: predicate must return a single boolean value", op)
+	}
+	c.pred = slicefunc.Of(pred)
+	return c
+}
+
+func (c *crossSlice) Name() Name             { return c.name }
+func (c *crossSlice) NumShard() int          { return c.slices[1-c.broadcast].NumShard() }
+func (c *crossSlice) NumOut() int            { return c.out.NumOut() }
+func (c *crossSlice) Out(i int) reflect.Type { return c.out.Out(i) }
+func (c *crossSlice) Prefix() int            { return c.slices[0].Prefix() }
+func (*crossSlice) NumDep() int              { return 2 }
+func (*crossSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (c *crossSlice) ShardType() ShardType {
+	if c.broadcast == 1 {
+		// Rows remain in the shards of the left side, in order.
+		return c.slices[0].ShardType()
+	}
+	return HashShard
+}
+
+func (c *crossSlice) Dep(i int) Dep {
+	return Dep{c.slices[i], false, nil, false, i == c.broadcast}
+}
+
+// MaxRows implements Sizer.
+func (c *crossSlice) MaxRows() int {
+	left, right := maxRows(c.slices[0]), maxRows(c.slices[1])
+	if left < 0 || right < 0 {
+		return -1
+	}
+	if right > 0 && left > int(^uint(0)>>1)/right {
+		return -1
+	}
+	return left * right
+}
+
+func (c *crossSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &crossReader{op: c, readers: deps}
+}
+
+// crossReader crosses each row of a shard of the large side of a
+// product with the rows of its small, broadcast side, which are read
+// into memory.
+type crossReader struct {
+	op      *crossSlice
+	readers []sliceio.Reader
+	err     error
+
+	// table holds the rows of the broadcast side.
+	table frame.Frame
+	// in holds the rows of the large side that are being crossed, of
+	// which rest are yet to be crossed; the first row of rest is crossed
+	// with the rows of the table starting at next.
+	in, rest frame.Frame
+	next     int
+	// args holds the arguments of the predicate.
+	args []reflect.Value
+}
+
+func (r *crossReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 128
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		small = r.op.broadcast
+		large = 1 - small
+	)
+	if r.in.IsZero() {
+		if r.err = r.load(ctx, r.readers[small]); r.err != nil {
+			return 0, r.err
+		}
+		r.in = frame.Make(r.op.slices[large], bufferSize, bufferSize)
+		r.args = make([]reflect.Value, r.op.NumOut())
+	}
+	var n int
+	for n < out.Len() {
+		if r.rest.Len() == 0 || r.next == r.table.Len() {
+			if r.rest.Len() > 0 {
+				r.rest = r.rest.Slice(1, r.rest.Len())
+				r.next = 0
+				continue
+			}
+			if r.readers == nil || r.table.Len() == 0 {
+				break
+			}
+			m, err := r.readers[large].Read(ctx, r.in)
+			switch {
+			case err == sliceio.EOF:
+				r.readers = nil
+			case err != nil:
+				r.err = err
+				return n, err
+			}
+			r.rest = r.in.Slice(0, m)
+			continue
+		}
+		var rows [2]frame.Frame
+		rows[large] = r.rest.Slice(0, 1)
+		rows[small] = r.table.Slice(r.next, r.next+1)
+		r.next++
+		if !r.accept(ctx, rows) {
+			continue
+		}
+		col := 0
+		for _, row := range rows {
+			for i := 0; i < row.NumOut(); i++ {
+				out.Index(col, n).Set(row.Index(i, 0))
+				col++
+			}
+		}
+		n++
+	}
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// accept returns whether the provided pair of (single-row) left and
+// right frames is accepted by the product's predicate.
+func (r *crossReader) accept(ctx context.Context, rows [2]frame.Frame) bool {
+	if r.op.pred.IsNil() {
+		return true
+	}
+	col := 0
+	for _, row := range rows {
+		for i := 0; i < row.NumOut(); i++ {
+			r.args[col] = row.Index(i, 0)
+			col++
+		}
+	}
+	return r.op.pred.Call(ctx, r.args)[0].Bool()
+}
+
+// load reads the rows of the broadcast side from the provided reader
+// into the reader's table.
+func (r *crossReader) load(ctx context.Context, reader sliceio.Reader) error {
+	const chunkSize = 1 << 10
+	r.table = frame.Make(r.op.slices[r.op.broadcast], 0, chunkSize)
+	for {
+		n := r.table.Len()
+		r.table = r.table.Ensure(n + chunkSize)
+		m, err := reader.Read(ctx, r.table.Slice(n, n+chunkSize))
+		r.table = r.table.Slice(0, n+m)
+		if err == sliceio.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
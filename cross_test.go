@@ -0,0 +1,84 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestCross(t *testing.T) {
+	const N = 100
+	items := make([]string, N)
+	for i := range items {
+		items[i] = fmt.Sprint(i)
+	}
+	var (
+		large   = bigslice.Const(4, items)
+		small   = bigslice.Const(2, []string{"a", "b", "c"}, []int{1, 2, 3})
+		crossed = bigslice.Cross(large, small)
+	)
+	// Neither side declares its size, so the right side is broadcast.
+	if got, want := crossed.NumShard(), 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var (
+		expectItems []string
+		expectNames []string
+		expectVals  []int
+	)
+	for _, item := range items {
+		for i, name := range []string{"a", "b", "c"} {
+			expectItems = append(expectItems, item)
+			expectNames = append(expectNames, name)
+			expectVals = append(expectVals, i+1)
+		}
+	}
+	assertEqual(t, crossed, true, expectItems, expectNames, expectVals)
+
+	// The left side is broadcast if it is smaller.
+	crossed = bigslice.Cross(bigslice.Sized(small, 3), bigslice.Sized(large, N))
+	if got, want := crossed.NumShard(), 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := crossed.(bigslice.Sizer).MaxRows(), 3*N; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	crossed = bigslice.Map(crossed, func(name string, val int, item string) (string, int) { return name, val })
+	crossed = bigslice.Reduce(crossed, func(a, b int) int { return a + b })
+	assertEqual(t, crossed, true, []string{"a", "b", "c"}, []int{N, 2 * N, 3 * N})
+
+	// Crossing with an empty slice produces an empty slice.
+	empty := bigslice.Const(1, []string{}, []int{})
+	assertEqual(t, bigslice.Cross(large, empty), false, []string{}, []string{}, []int{})
+}
+
+func TestCrossFilter(t *testing.T) {
+	var (
+		words   = bigslice.Const(3, []string{"apple", "banana", "cherry", "avocado", "blueberry"})
+		queries = bigslice.Const(1, []string{"a", "b", "z"})
+	)
+	slice := bigslice.CrossFilter(words, queries, func(word, query string) bool {
+		return strings.HasPrefix(word, query)
+	})
+	assertEqual(t, slice, true,
+		[]string{"apple", "avocado", "banana", "blueberry"},
+		[]string{"a", "a", "b", "b"})
+}
+
+func TestCrossError(t *testing.T) {
+	var (
+		a = bigslice.Const(1, []string{"x"})
+		b = bigslice.Const(1, []int{1})
+	)
+	expectTypeError(t, "crossfilter: invalid predicate function int", func() { bigslice.CrossFilter(a, b, 1) })
+	expectTypeError(t, "crossfilter: function func(string, string) bool does not match input slice types slice[1]string and slice[1]int",
+		func() { bigslice.CrossFilter(a, b, func(string, string) bool { return true }) })
+	expectTypeError(t, "crossfilter: predicate must return a single boolean value",
+		func() { bigslice.CrossFilter(a, b, func(string, int) int { return 0 }) })
+}
@@ -0,0 +1,251 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicestats"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/sortio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Distinct returns a slice that contains each distinct row of the
+// provided slice exactly once: rows are considered equal if all of
+// their columns are equal. The returned slice retains the prefix of
+// slice. Schematically:
+//
+//	Distinct(Slice<t1, ..., tn>) Slice<t1, ..., tn>
+//
+// Distinct deduplicates rows map-side, using combiners, before they
+// are shuffled, so that each distinct row is shuffled at most once by
+// each task. All of the slice's columns must be hashable and sortable.
+func Distinct(slice Slice) Slice {
+	Helper()
+	for i := 0; i < slice.NumOut(); i++ {
+		if !frame.CanHash(slice.Out(i)) || !frame.CanCompare(slice.Out(i)) {
+			typecheck.Panicf(1, "distinct: column(%d) type %s cannot be hashed and sorted", i, slice.Out(i))
+		}
+	}
+	// Rows are deduplicated by reducing them, keyed by all of their
+	// columns, with a marker value.
+	keyed := AddConstantColumn(Prefixed(slice, slice.NumOut()), true)
+	reduced := Reduce(keyed, func(x, y bool) bool { return x })
+	cols := make([]int, slice.NumOut())
+	for i := range cols {
+		cols[i] = i
+	}
+	return Prefixed(SelectColumns(reduced, cols...), slice.Prefix())
+}
+
+// DistinctPrefix returns a slice that contains one row for each
+// distinct key of the provided slice, where a row's key comprises its
+// prefix columns. Which of a key's rows is retained is unspecified.
+// Schematically:
+//
+//	DistinctPrefix(Slice<k1, ..., kp, v1, ..., vn>) Slice<k1, ..., kp, v1, ..., vn>
+//
+// DistinctPrefix shuffles all rows by key, and deduplicates them as it
+// streams through the sorted, shuffled input, so that its memory use
+// is independent of the number of keys. If all of the slice's columns
+// are keys, DistinctPrefix is equivalent to Distinct, which should be
+// preferred, since it also deduplicates rows map-side.
+func DistinctPrefix(slice Slice) Slice {
+	for i := 0; i < slice.Prefix(); i++ {
+		if !frame.CanHash(slice.Out(i)) {
+			typecheck.Panicf(1, "distinctprefix: key column(%d) type %s cannot be hashed", i, slice.Out(i))
+		}
+		if !frame.CanCompare(slice.Out(i)) {
+			typecheck.Panicf(1, "distinctprefix: key column(%d) type %s cannot be sorted", i, slice.Out(i))
+		}
+	}
+	return &distinctPrefixSlice{MakeName("distinctprefix"), slice}
+}
+
+type distinctPrefixSlice struct {
+	name Name
+	Slice
+}
+
+func (d *distinctPrefixSlice) Name() Name             { return d.name }
+func (*distinctPrefixSlice) ShardType() ShardType     { return HashShard }
+func (*distinctPrefixSlice) NumDep() int              { return 1 }
+func (d *distinctPrefixSlice) Dep(i int) Dep          { return singleDep(i, d.Slice, true) }
+func (*distinctPrefixSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (d *distinctPrefixSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &distinctPrefixReader{op: d, reader: deps[0]}
+}
+
+type distinctPrefixReader struct {
+	op     *distinctPrefixSlice
+	reader sliceio.Reader
+	sorted sliceio.Reader
+	err    error
+
+	// buf buffers sorted input. Row 0 holds the key of the most
+	// recently emitted row, if any.
+	buf  frame.Frame
+	last bool
+}
+
+func (r *distinctPrefixReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const (
+		bufferSize = 1024
+		spillSize  = 1 << 25
+	)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.sorted == nil {
+		r.sorted, r.err = sortio.SortReader(ctx, spillSize, r.op.Slice, r.reader)
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.buf = frame.Make(r.op.Slice, bufferSize+1, bufferSize+1)
+	}
+	var n int
+	for n < out.Len() && r.err == nil {
+		// Read no more rows than can be emitted, so that no rows need to
+		// be carried over to the next call.
+		m := out.Len() - n
+		if m > bufferSize {
+			m = bufferSize
+		}
+		m, r.err = r.sorted.Read(ctx, r.buf.Slice(1, 1+m))
+		for i := 1; i <= m; i++ {
+			if r.last && !r.buf.Less(0, i) && !r.buf.Less(i, 0) {
+				continue
+			}
+			frame.Copy(out.Slice(n, n+1), r.buf.Slice(i, i+1))
+			frame.Copy(r.buf.Slice(0, 1), r.buf.Slice(i, i+1))
+			r.last = true
+			n++
+		}
+	}
+	if n > 0 && r.err == sliceio.EOF {
+		return n, nil
+	}
+	return n, r.err
+}
+
+// ApproxCountDistinct returns a slice that estimates the number of
+// distinct values of each key of the provided slice, which must have
+// exactly one value column. Schematically:
+//
+//	ApproxCountDistinct(Slice<k1, ..., kp, v>, precision) Slice<k1, ..., kp, int64>
+//
+// Values are counted with HyperLogLog sketches (see
+// slicestats.HyperLogLog) of the provided precision, which are merged
+// map-side by combiners, so that counts over very large slices do not
+// require each distinct row to be shuffled, as they would with
+// Distinct. Estimates have a relative standard error of about
+// 1.04/sqrt(2^precision); keys with few distinct values are counted
+// exactly, barring hash collisions.
+func ApproxCountDistinct(slice Slice, precision int) Slice {
+	if res := slice.NumOut() - slice.Prefix(); res != 1 {
+		typecheck.Panicf(1, "approxcountdistinct: the slice must have exactly 1 value column; has %d", res)
+	}
+	if precision < slicestats.MinPrecision || precision > slicestats.MaxPrecision {
+		typecheck.Panicf(1, "approxcountdistinct: precision %d is not in [%d, %d]",
+			precision, slicestats.MinPrecision, slicestats.MaxPrecision)
+	}
+	if typ := slice.Out(slice.Prefix()); !frame.CanHash(typ) {
+		typecheck.Panicf(1, "approxcountdistinct: value type %s cannot be hashed", typ)
+	}
+	sketches := &approxCountSlice{
+		name:      MakeName("approxcountdistinct"),
+		Slice:     slice,
+		precision: precision,
+		out:       typeOfSketch,
+	}
+	if err := canMakeCombiningFrame(sketches); err != nil {
+		typecheck.Panic(1, err.Error())
+	}
+	reduced := Reduce(sketches, func(x, y *slicestats.HyperLogLog) *slicestats.HyperLogLog {
+		// Sketches are made afresh for each row, and are not otherwise
+		// shared, and so they may be merged in place.
+		x.MergeFrom(y)
+		return x
+	})
+	return &approxCountSlice{
+		name:  MakeName("approxcountdistinct"),
+		Slice: reduced,
+		out:   typeOfInt64,
+	}
+}
+
+var typeOfSketch = reflect.TypeOf((*slicestats.HyperLogLog)(nil))
+
+// approxCountSlice replaces the value column of its dependency: by the
+// sketch of each value if its output is a sketch, or by the estimated
+// count of each sketch, otherwise.
+type approxCountSlice struct {
+	name Name
+	Slice
+	precision int
+	out       reflect.Type
+}
+
+func (a *approxCountSlice) Name() Name { return a.name }
+
+func (a *approxCountSlice) Out(c int) reflect.Type {
+	if c == a.Prefix() {
+		return a.out
+	}
+	return a.Slice.Out(c)
+}
+
+func (*approxCountSlice) NumDep() int              { return 1 }
+func (a *approxCountSlice) Dep(i int) Dep          { return singleDep(i, a.Slice, false) }
+func (*approxCountSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (a *approxCountSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &approxCountReader{op: a, reader: deps[0]}
+}
+
+type approxCountReader struct {
+	op     *approxCountSlice
+	reader sliceio.Reader
+	in     frame.Frame
+}
+
+func (r *approxCountReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, out.Len(), out.Len())
+	} else {
+		r.in = r.in.Ensure(out.Len())
+	}
+	n, err := r.reader.Read(ctx, r.in)
+	vcol := r.op.Prefix()
+	for c := 0; c < vcol; c++ {
+		reflect.Copy(out.Value(c), r.in.Value(c).Slice(0, n))
+	}
+	if r.op.out == typeOfSketch {
+		values := frame.Values([]reflect.Value{r.in.Value(vcol)})
+		for i := 0; i < n; i++ {
+			sketch := slicestats.NewHyperLogLog(r.op.precision)
+			sketch.AddHash(hashValue(values, i))
+			out.Index(vcol, i).Set(reflect.ValueOf(sketch))
+		}
+	} else {
+		for i := 0; i < n; i++ {
+			sketch := r.in.Index(vcol, i).Interface().(*slicestats.HyperLogLog)
+			out.Index(vcol, i).SetInt(sketch.Count())
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestDistinct(t *testing.T) {
+	const N = 1000
+	ints := make([]int, N)
+	strs := make([]string, N)
+	for i := range ints {
+		ints[i] = i % 10
+		strs[i] = fmt.Sprint(i % 4)
+	}
+	var want []string
+	for i := 0; i < 20; i++ {
+		// Rows (i%10, i%4) repeat with period 20.
+		want = append(want, fmt.Sprintf("%d:%d", i%10, i%4))
+	}
+	for nshard := 1; nshard < 4; nshard++ {
+		slice := bigslice.Const(nshard, ints, strs)
+		slice = bigslice.Distinct(slice)
+		// Rows are rendered as strings so that they may be compared in
+		// sorted order.
+		slice = bigslice.Map(slice, func(i int, s string) string { return fmt.Sprintf("%d:%s", i, s) })
+		assertEqual(t, slice, true, append([]string(nil), want...))
+	}
+}
+
+func TestDistinctPrefix(t *testing.T) {
+	const N = 1000
+	keys := make([]string, N)
+	values := make([]int, N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i % 7)
+		values[i] = i % 7
+	}
+	for nshard := 1; nshard < 4; nshard++ {
+		slice := bigslice.Const(nshard, keys, values)
+		assertEqual(t, bigslice.DistinctPrefix(slice), true,
+			[]string{"0", "1", "2", "3", "4", "5", "6"}, []int{0, 1, 2, 3, 4, 5, 6})
+	}
+}
+
+func TestDistinctError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, [][]int{{1}})
+	expectTypeError(t, "distinct: column(1) type []int cannot be hashed and sorted", func() { bigslice.Distinct(input) })
+}
+
+func TestApproxCountDistinct(t *testing.T) {
+	const N = 100000
+	keys := make([]string, N)
+	values := make([]int, N)
+	for i := range keys {
+		// Key "a" has 50000 distinct values; key "b" has 5, repeated.
+		if i%2 == 0 {
+			keys[i] = "a"
+			values[i] = i / 2 % 50000
+		} else {
+			keys[i] = "b"
+			values[i] = i % 10
+		}
+	}
+	for nshard := 1; nshard < 4; nshard++ {
+		slice := bigslice.Const(nshard, keys, values)
+		slice = bigslice.ApproxCountDistinct(slice, 14)
+		var (
+			gotKeys []string
+			counts  []int64
+		)
+		slicetest.RunAndScan(t, slice, &gotKeys, &counts)
+		got := make(map[string]int64)
+		for i, key := range gotKeys {
+			got[key] = counts[i]
+		}
+		if n := got["a"]; n < 48500 || n > 51500 {
+			t.Errorf("got %v distinct values of a, want about 50000", n)
+		}
+		if got, want := got["b"], int64(5); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestApproxCountDistinctError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1}, []int{2})
+	expectTypeError(t, "approxcountdistinct: the slice must have exactly 1 value column; has 2", func() {
+		bigslice.ApproxCountDistinct(input, 14)
+	})
+	input = bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "approxcountdistinct: precision 30 is not in [4, 18]", func() {
+		bigslice.ApproxCountDistinct(input, 30)
+	})
+}
@@ -45,7 +45,9 @@
 	the lifetime of the context is tied to that of the underlying bigslice task.
 	Additionally, the context carries a metrics scope
 	(github.com/grailbio/base/bigslice/metrics.Scope) which can be used to update
-	metric values during data processing.
+	metric values during data processing. The values of named metrics (e.g.,
+	metrics.NewNamedCounter) are aggregated across tasks and displayed in the
+	session's status while the slice is computed.
 
 */
 package bigslice
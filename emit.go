@@ -0,0 +1,108 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// emitBatchSize is the number of rows that are read and emitted at a
+// time by the readers of FlatmapEmit slices.
+const emitBatchSize = 512
+
+// FlatmapEmit returns a slice that applies the function fn to each
+// record in the slice, as Flatmap does, but fn emits its output rows
+// one at a time through an emit function that it is passed, rather
+// than returning them as Go slices. The function fn should be of the
+// form:
+//
+//	func(in1 inType1, in2 inType2, ..., emit func(out1 outType1, out2 outType2, ...))
+//
+// Schematically:
+//
+//	FlatmapEmit(Slice<t1, t2, ..., tn>, func(v1 t1, v2 t2, ..., vn tn, emit func(r1, r2, ..., rm))) Slice<r1, r2, ..., rm>
+//
+// Emitted rows are written in batches to the slice's readers as they
+// are emitted, so that records that expand to very many rows do not
+// require large intermediate slices to be allocated. The function is
+// run concurrently with the readers of its output. The emit function
+// must not be retained or called after fn returns.
+func FlatmapEmit(slice Slice, fn interface{}, prags ...Pragma) Slice {
+	arg, ret, ok := typecheck.Func(fn)
+	if !ok {
+		typecheck.Panicf(1, "flatmapemit: invalid flatmap function %T", fn)
+	}
+	if ret.NumOut() != 0 {
+		typecheck.Panicf(1, "flatmapemit: flatmap function %T must not return values", fn)
+	}
+	n := arg.NumOut() - 1
+	if n < 0 || !typecheck.Equal(slice, slicetype.Slice(arg, 0, n)) {
+		typecheck.Panicf(1, "flatmapemit: flatmap function %T does not match input slice type %s", fn, slicetype.String(slice))
+	}
+	emitType := arg.Out(n)
+	if emitType.Kind() != reflect.Func || emitType.IsVariadic() || emitType.NumIn() == 0 || emitType.NumOut() != 0 {
+		typecheck.Panicf(1, "flatmapemit: last argument of flatmap function %T must be an emit function func(r1, r2, ..., rm)", fn)
+	}
+	cols := make([]reflect.Type, emitType.NumIn())
+	for i := range cols {
+		cols[i] = emitType.In(i)
+	}
+	var (
+		out  = slicetype.New(cols...)
+		fval = slicefunc.Of(fn)
+	)
+	run := func(ctx context.Context, shard int, in sliceio.Reader, w sliceio.Writer) error {
+		var (
+			buf  = frame.Make(out, emitBatchSize, emitBatchSize)
+			nbuf int
+			err  error
+		)
+		emit := reflect.MakeFunc(emitType, func(row []reflect.Value) []reflect.Value {
+			if err != nil {
+				return nil
+			}
+			for j := range row {
+				buf.Index(j, nbuf).Set(row[j])
+			}
+			if nbuf++; nbuf == emitBatchSize {
+				err = w.Write(ctx, buf)
+				nbuf = 0
+			}
+			return nil
+		})
+		var (
+			inbuf = frame.Make(slice, emitBatchSize, emitBatchSize)
+			args  = make([]reflect.Value, n+1)
+		)
+		args[n] = emit
+		for {
+			m, readErr := in.Read(ctx, inbuf)
+			for i := 0; i < m && err == nil; i++ {
+				for j := 0; j < n; j++ {
+					args[j] = inbuf.Index(j, i)
+				}
+				fval.Call(ctx, args)
+			}
+			if err != nil {
+				return err
+			}
+			if readErr == sliceio.EOF {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+		return w.Write(ctx, buf.Slice(0, nbuf))
+	}
+	return &mapShardSlice{MakeName("flatmapemit"), slice, Pragmas(prags), out, run}
+}
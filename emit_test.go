@@ -0,0 +1,46 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestFlatmapEmit(t *testing.T) {
+	slice := bigslice.Const(3, []string{"a", "b", "c", "d"}, []int{0, 1, 10, 10000})
+	slice = bigslice.FlatmapEmit(slice, func(key string, n int, emit func(string, int)) {
+		for i := 0; i < n; i++ {
+			emit(strings.ToUpper(key), i)
+		}
+	})
+	if got, want := slice.NumOut(), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	counted := bigslice.Map(slice, func(key string, i int) (string, int, int) { return key, 1, i })
+	counted = bigslice.Prefixed(counted, 1)
+	counted = bigslice.AggregateByKey(counted,
+		func(acc [2]int, one, i int) [2]int { return [2]int{acc[0] + one, acc[1] + i} },
+		func(a, b [2]int) [2]int { return [2]int{a[0] + b[0], a[1] + b[1]} })
+	assertEqual(t, counted, true,
+		[]string{"B", "C", "D"},
+		[][2]int{{1, 0}, {10, 45}, {10000, 10000 * 9999 / 2}})
+}
+
+func TestFlatmapEmitError(t *testing.T) {
+	slice := bigslice.Const(1, []string{"a"}, []int{1})
+	expectTypeError(t, "flatmapemit: invalid flatmap function int", func() { bigslice.FlatmapEmit(slice, 1) })
+	expectTypeError(t, "flatmapemit: flatmap function func(string, int, func(int)) int must not return values", func() {
+		bigslice.FlatmapEmit(slice, func(string, int, func(int)) int { return 0 })
+	})
+	expectTypeError(t, "flatmapemit: flatmap function func(int, int, func(int)) does not match input slice type slice[1]string,int", func() {
+		bigslice.FlatmapEmit(slice, func(int, int, func(int)) {})
+	})
+	expectTypeError(t, "flatmapemit: last argument of flatmap function func(string, int, int) must be an emit function func(r1, r2, ..., rm)", func() {
+		bigslice.FlatmapEmit(slice, func(string, int, int) {})
+	})
+}
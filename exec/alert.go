@@ -0,0 +1,383 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/log"
+)
+
+const (
+	// alertWebhookTimeout is the timeout of each request made to deliver
+	// an alert to a webhook.
+	alertWebhookTimeout = 10 * time.Second
+	// minSlowTaskCheckInterval and maxSlowTaskCheckInterval bound the
+	// interval at which running tasks are checked against the slow task
+	// threshold.
+	minSlowTaskCheckInterval = 100 * time.Millisecond
+	maxSlowTaskCheckInterval = 10 * time.Second
+)
+
+// AlertKind is the kind of an Alert.
+type AlertKind int
+
+const (
+	// AlertSlowTask indicates that an attempt to run a task has been
+	// running for longer than the session's slow task threshold (see
+	// SlowTaskAlert). It is raised at most once per attempt.
+	AlertSlowTask AlertKind = iota
+	// AlertTaskLost indicates that a task was lost, e.g., because the
+	// machine on which it ran failed. Lost tasks are retried.
+	AlertTaskLost
+	// AlertInvocationFailed indicates that the evaluation of an
+	// invocation failed.
+	AlertInvocationFailed
+)
+
+var alertKinds = [...]string{
+	AlertSlowTask:         "slow_task",
+	AlertTaskLost:         "task_lost",
+	AlertInvocationFailed: "invocation_failed",
+}
+
+// String returns the alert kind's string representation.
+func (k AlertKind) String() string {
+	return alertKinds[k]
+}
+
+// MarshalText implements encoding.TextMarshaler, so that alert kinds
+// are encoded by their string representation.
+func (k AlertKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// An Alert describes an event in the evaluation of a session's
+// invocations to which orchestration systems may want to react: a
+// slow task, a lost task, or a failed invocation. Alerts are delivered
+// to the handlers configured by AlertFunc and AlertWebhook.
+type Alert struct {
+	// Kind is the kind of alert.
+	Kind AlertKind `json:"kind"`
+	// Time is the time at which the alert was raised.
+	Time time.Time `json:"time"`
+	// Invocation and Location are the index and source location of the
+	// invocation to which the alert pertains.
+	Invocation uint64 `json:"invocation"`
+	Location   string `json:"location,omitempty"`
+	// Task is the name of the task to which the alert pertains; it is
+	// empty for invocation alerts.
+	Task string `json:"task,omitempty"`
+	// Machine is the machine on which the task's latest attempt ran.
+	Machine string `json:"machine,omitempty"`
+	// Duration is, for slow task alerts, the time for which the task's
+	// attempt has been running.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Error is the error with which the task was lost or the invocation
+	// failed, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// String returns a description of the alert.
+func (a Alert) String() string {
+	s := fmt.Sprintf("%s: invocation %d (%s)", a.Kind, a.Invocation, a.Location)
+	if a.Task != "" {
+		s += " task " + a.Task
+	}
+	if a.Machine != "" {
+		s += " on " + a.Machine
+	}
+	if a.Duration > 0 {
+		s += fmt.Sprintf(" running for %s", a.Duration.Round(time.Second))
+	}
+	if a.Error != "" {
+		s += ": " + a.Error
+	}
+	return s
+}
+
+// AlertFunc configures the session to call fn with each alert that it
+// raises. AlertFunc may be provided more than once, in which case each
+// function is called. Alerts are delivered in the order in which they
+// are raised, from a single goroutine that is independent of
+// evaluation; a handler that blocks delays the delivery of subsequent
+// alerts, but not evaluation.
+func AlertFunc(fn func(Alert)) Option {
+	return func(s *Session) {
+		s.alertFuncs = append(s.alertFuncs, fn)
+	}
+}
+
+// AlertWebhook configures the session to deliver each alert that it
+// raises by POSTing it, encoded as JSON (see Alert), to the provided
+// URL. Delivery failures are logged, and are not retried.
+func AlertWebhook(url string) Option {
+	return func(s *Session) {
+		s.alertWebhook = url
+	}
+}
+
+// SlowTaskAlert configures the session to raise an AlertSlowTask alert
+// when an attempt to run a task has been running for longer than the
+// provided threshold. Slow task alerts are not raised if the threshold
+// is zero, the default.
+func SlowTaskAlert(threshold time.Duration) Option {
+	return func(s *Session) {
+		s.slowTaskAlert = threshold
+	}
+}
+
+// alerter delivers alerts to a set of handlers. Alerts are queued, and
+// delivered in order by a single goroutine, so that they may be posted
+// while holding task locks.
+type alerter struct {
+	handlers []func(Alert)
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []Alert
+	closed bool
+
+	done chan struct{}
+}
+
+// newAlerter returns a new alerter that delivers alerts to the
+// provided functions, and to the webhook at the provided URL, if it is
+// not empty. It returns nil if there are no handlers.
+func newAlerter(funcs []func(Alert), webhook string) *alerter {
+	handlers := append([]func(Alert){}, funcs...)
+	if webhook != "" {
+		client := &http.Client{Timeout: alertWebhookTimeout}
+		handlers = append(handlers, func(alert Alert) {
+			if err := postAlert(client, webhook, alert); err != nil {
+				log.Error.Printf("alert webhook %s: %v", webhook, err)
+			}
+		})
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+	a := &alerter{handlers: handlers, done: make(chan struct{})}
+	a.cond = sync.NewCond(&a.mu)
+	go a.loop()
+	return a
+}
+
+// post queues the provided alert for delivery. Alerts posted after the
+// alerter is closed are dropped.
+func (a *alerter) post(alert Alert) {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	a.queue = append(a.queue, alert)
+	a.cond.Signal()
+}
+
+func (a *alerter) loop() {
+	defer close(a.done)
+	a.mu.Lock()
+	for {
+		for len(a.queue) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		if len(a.queue) == 0 {
+			a.mu.Unlock()
+			return
+		}
+		alert := a.queue[0]
+		a.queue = a.queue[1:]
+		a.mu.Unlock()
+		for _, handler := range a.handlers {
+			handler(alert)
+		}
+		a.mu.Lock()
+	}
+}
+
+// Close delivers the alerts that remain queued, and then stops the
+// alerter.
+func (a *alerter) Close() {
+	a.mu.Lock()
+	a.closed = true
+	a.cond.Signal()
+	a.mu.Unlock()
+	<-a.done
+}
+
+// postAlert POSTs the JSON-encoded alert to the provided URL.
+func postAlert(client *http.Client, url string, alert Alert) error {
+	p, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// runningAttempt describes a running attempt of a task watched by an
+// invocationAlerts.
+type runningAttempt struct {
+	attempt int
+	machine string
+	start   time.Time
+	alerted bool
+}
+
+// invocationAlerts raises the alerts of an invocation: it watches the
+// invocation's tasks for lost and slow attempts, and raises an alert
+// if the invocation fails. It must be closed by Close.
+type invocationAlerts struct {
+	alerter *alerter
+	inv     execInvocation
+	slow    time.Duration
+
+	mu      sync.Mutex
+	running map[*Task]*runningAttempt
+
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// watchInvocation subscribes a new invocationAlerts to the provided
+// tasks of inv, posting alerts to a. Slow task alerts are raised for
+// attempts that run for longer than slow, unless it is zero.
+func watchInvocation(ctx context.Context, a *alerter, inv execInvocation, tasks []*Task, slow time.Duration) *invocationAlerts {
+	w := &invocationAlerts{
+		alerter: a,
+		inv:     inv,
+		slow:    slow,
+		running: make(map[*Task]*runningAttempt),
+	}
+	all := make(map[*Task]bool)
+	for _, task := range tasks {
+		task.all(all)
+	}
+	for task := range all {
+		task.Lock()
+		task.watch(w)
+		task.Unlock()
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+	if slow > 0 {
+		w.wg.Add(1)
+		go w.checkSlow(ctx)
+	}
+	return w
+}
+
+// Close unsubscribes the watcher from the provided tasks, and raises an
+// AlertInvocationFailed alert if err is non-nil.
+func (w *invocationAlerts) Close(tasks []*Task, err error) {
+	w.cancel()
+	w.wg.Wait()
+	all := make(map[*Task]bool)
+	for _, task := range tasks {
+		task.all(all)
+	}
+	for task := range all {
+		task.Lock()
+		task.unwatch(w)
+		task.Unlock()
+	}
+	if err != nil {
+		w.alerter.post(w.alert(AlertInvocationFailed, Alert{Error: err.Error()}))
+	}
+}
+
+// taskEvent tracks the running attempts of the provided task, and
+// raises an alert if it was lost. The caller must hold the task's
+// lock.
+func (w *invocationAlerts) taskEvent(task *Task) {
+	var last TaskAttempt
+	if n := len(task.attempts); n > 0 {
+		last = task.attempts[n-1]
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch task.state {
+	case TaskRunning:
+		attempt := len(task.attempts)
+		if r := w.running[task]; r != nil && r.attempt == attempt {
+			return
+		}
+		start := last.Start
+		if start.IsZero() {
+			start = time.Now()
+		}
+		w.running[task] = &runningAttempt{attempt: attempt, machine: last.Machine, start: start}
+	case TaskLost:
+		delete(w.running, task)
+		alert := Alert{Task: task.Name.String(), Machine: last.Machine}
+		if task.err != nil {
+			alert.Error = task.err.Error()
+		}
+		w.alerter.post(w.alert(AlertTaskLost, alert))
+	default:
+		delete(w.running, task)
+	}
+}
+
+// checkSlow periodically raises alerts for running attempts that have
+// exceeded the slow task threshold, until ctx is done.
+func (w *invocationAlerts) checkSlow(ctx context.Context) {
+	defer w.wg.Done()
+	interval := w.slow / 10
+	if interval < minSlowTaskCheckInterval {
+		interval = minSlowTaskCheckInterval
+	}
+	if interval > maxSlowTaskCheckInterval {
+		interval = maxSlowTaskCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			for task, r := range w.running {
+				if r.alerted || now.Sub(r.start) < w.slow {
+					continue
+				}
+				r.alerted = true
+				w.alerter.post(w.alert(AlertSlowTask, Alert{
+					Time:     now,
+					Task:     task.Name.String(),
+					Machine:  r.machine,
+					Duration: now.Sub(r.start),
+				}))
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// alert returns the provided alert, of the provided kind, populated
+// with the watcher's invocation.
+func (w *invocationAlerts) alert(kind AlertKind, alert Alert) Alert {
+	alert.Kind = kind
+	alert.Invocation = w.inv.Index
+	alert.Location = w.inv.Location
+	return alert
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestAlerts(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		alerts   []Alert
+		webhooks []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		webhooks = append(webhooks, alert)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	slow := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, state *int, out []int) (int, error) {
+			time.Sleep(500 * time.Millisecond)
+			return 0, sliceio.EOF
+		})
+	})
+	fail := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, state *int, out []int) (int, error) {
+			return 0, errors.New("read failed")
+		})
+	})
+	sess := Start(Local,
+		SlowTaskAlert(100*time.Millisecond),
+		AlertFunc(func(alert Alert) {
+			mu.Lock()
+			alerts = append(alerts, alert)
+			mu.Unlock()
+		}),
+		AlertWebhook(srv.URL),
+	)
+	ctx := context.Background()
+	if _, err := sess.Run(ctx, slow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.Run(ctx, fail); err == nil {
+		t.Fatal("expected error")
+	}
+	// Shutdown delivers the alerts that remain queued.
+	sess.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := len(alerts), 2; got != want {
+		t.Fatalf("got %v, want %v: %v", got, want, alerts)
+	}
+	if got, want := alerts[0].Kind, AlertSlowTask; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if alerts[0].Task == "" || alerts[0].Machine != "local" {
+		t.Errorf("bad slow task alert %v", alerts[0])
+	}
+	if alerts[0].Duration < 100*time.Millisecond {
+		t.Errorf("got %v, want >= 100ms", alerts[0].Duration)
+	}
+	if got, want := alerts[1].Kind, AlertInvocationFailed; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if alerts[1].Error == "" || alerts[1].Location == "" {
+		t.Errorf("bad invocation alert %v", alerts[1])
+	}
+	if got, want := len(webhooks), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, kind := range []string{"slow_task", "invocation_failed"} {
+		if got, want := webhooks[i]["kind"], kind; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTaskLostAlert(t *testing.T) {
+	alerts := make(chan Alert, 1)
+	a := newAlerter([]func(Alert){func(alert Alert) { alerts <- alert }}, "")
+	defer a.Close()
+	task := &Task{Name: TaskName{InvIndex: 1, Op: "op", NumShard: 1}}
+	inv := execInvocation{}
+	inv.Index = 1
+	w := watchInvocation(context.Background(), a, inv, []*Task{task}, 0)
+	task.setRunning("machine1")
+	task.Set(TaskLost)
+	alert := <-alerts
+	if got, want := alert.Kind, AlertTaskLost; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := alert.Task, task.Name.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := alert.Machine, "machine1"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	w.Close([]*Task{task}, nil)
+	// Unwatched tasks do not raise alerts.
+	task.Set(TaskLost)
+	select {
+	case alert := <-alerts:
+		t.Errorf("unexpected alert %v", alert)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
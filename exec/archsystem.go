@@ -0,0 +1,264 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigmachine"
+)
+
+// ArchPool describes a pool of machines of a single architecture, for
+// use with MixedArchSystem.
+type ArchPool struct {
+	// Arch is the architecture of the pool's machines, in the form
+	// "GOOS/GOARCH", e.g., "linux/arm64".
+	Arch string
+	// System is the bigmachine system that starts the pool's machines,
+	// e.g., an ec2system configured with Graviton instance types.
+	System bigmachine.System
+	// Weight is the pool's relative share of started machines. Pools
+	// with zero weight are weighted 1.
+	Weight int
+}
+
+// MixedArchSystem returns a bigmachine system that starts machines
+// from each of the provided pools, in proportion to their weights, so
+// that a single session may be served by machines of different
+// architectures. Each pool must have a distinct architecture. The
+// session's binary must contain an image for each architecture, e.g.,
+// as built by "bigslice build -targets"; see package
+// github.com/grailbio/base/fatbin.
+//
+// On machines, the returned system defers to the pool whose
+// architecture matches that of the running machine. On the driver,
+// machine communication is configured by the first pool, and so all
+// pools must be configured to share an HTTP client configuration (for
+// ec2system, the same certificate authority). Tasks are scheduled as if
+// every machine had the processors of the smallest pool's machines.
+func MixedArchSystem(pools ...ArchPool) bigmachine.System {
+	if len(pools) == 0 {
+		panic("exec.MixedArchSystem: no pools")
+	}
+	archs := make(map[string]bool)
+	pools = append([]ArchPool(nil), pools...)
+	for i := range pools {
+		if strings.Count(pools[i].Arch, "/") != 1 {
+			panic(fmt.Sprintf("exec.MixedArchSystem: invalid architecture %q", pools[i].Arch))
+		}
+		if archs[pools[i].Arch] {
+			panic(fmt.Sprintf("exec.MixedArchSystem: duplicate architecture %s", pools[i].Arch))
+		}
+		archs[pools[i].Arch] = true
+		if pools[i].Weight <= 0 {
+			pools[i].Weight = 1
+		}
+	}
+	return &mixedArchSystem{
+		pools:   pools,
+		started: make([]int, len(pools)),
+		owners:  make(map[string]bigmachine.System),
+	}
+}
+
+// mixedArchSystem implements bigmachine.System for MixedArchSystem.
+type mixedArchSystem struct {
+	pools []ArchPool
+	// local is the system of the pool serving the current process. It
+	// is set only on machines.
+	local bigmachine.System
+
+	mu sync.Mutex
+	// started is the number of machines started from each pool.
+	started []int
+	// owners maps machine addresses to the systems that started them.
+	owners map[string]bigmachine.System
+}
+
+// system returns the system to which process-wide operations are
+// delegated.
+func (s *mixedArchSystem) system() bigmachine.System {
+	if s.local != nil {
+		return s.local
+	}
+	return s.pools[0].System
+}
+
+func (s *mixedArchSystem) Name() string {
+	names := make([]string, len(s.pools))
+	for i, pool := range s.pools {
+		names[i] = pool.Arch + ":" + pool.System.Name()
+	}
+	return "mixedarch(" + strings.Join(names, ",") + ")"
+}
+
+func (s *mixedArchSystem) Init(b *bigmachine.B) error {
+	if !b.IsDriver() {
+		arch := runtime.GOOS + "/" + runtime.GOARCH
+		for _, pool := range s.pools {
+			if pool.Arch == arch {
+				s.local = pool.System
+				return s.local.Init(b)
+			}
+		}
+		return errors.E(errors.Precondition, "no machine pool for architecture ", arch)
+	}
+	for _, pool := range s.pools {
+		if err := pool.System.Init(b); err != nil {
+			return errors.E(err, "init pool ", pool.Arch)
+		}
+	}
+	return nil
+}
+
+// Region returns the region in which the pools' systems create their
+// machines, or empty if they do not all create them in the same
+// (known) region.
+func (s *mixedArchSystem) Region() string {
+	var region string
+	for i, pool := range s.pools {
+		r, err := systemRegion(pool.System)
+		if err != nil || i > 0 && r != region {
+			return ""
+		}
+		region = r
+	}
+	return region
+}
+
+func (s *mixedArchSystem) Main() error { return s.system().Main() }
+
+func (s *mixedArchSystem) Event(typ string, fieldPairs ...interface{}) {
+	s.system().Event(typ, fieldPairs...)
+}
+
+func (s *mixedArchSystem) HTTPClient() *http.Client { return s.system().HTTPClient() }
+
+func (s *mixedArchSystem) ListenAndServe(addr string, handle http.Handler) error {
+	return s.system().ListenAndServe(addr, handle)
+}
+
+// Start starts n machines, apportioned among the pools so that the
+// total number of machines started from each pool remains proportional
+// to its weight. Machines are started from the pools concurrently. If
+// some pools fail to start machines, Start returns the machines that
+// were started by the others.
+func (s *mixedArchSystem) Start(ctx context.Context, n int) ([]*bigmachine.Machine, error) {
+	counts := make([]int, len(s.pools))
+	s.mu.Lock()
+	for ; n > 0; n-- {
+		var (
+			best  = -1
+			share float64
+		)
+		for i, pool := range s.pools {
+			next := float64(s.started[i]+1) / float64(pool.Weight)
+			if best < 0 || next < share {
+				best, share = i, next
+			}
+		}
+		s.started[best]++
+		counts[best]++
+	}
+	s.mu.Unlock()
+	var (
+		wg       sync.WaitGroup
+		machines = make([][]*bigmachine.Machine, len(s.pools))
+		errs     = make([]error, len(s.pools))
+	)
+	for i := range s.pools {
+		if counts[i] == 0 {
+			continue
+		}
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machines[i], errs[i] = s.pools[i].System.Start(ctx, counts[i])
+		}()
+	}
+	wg.Wait()
+	var (
+		all []*bigmachine.Machine
+		err error
+	)
+	s.mu.Lock()
+	for i, pool := range s.pools {
+		if errs[i] != nil {
+			log.Error.Printf("error starting %d machines of pool %s: %v", counts[i], pool.Arch, errs[i])
+			if err == nil {
+				err = errors.E(errs[i], "pool ", pool.Arch)
+			}
+		}
+		for _, m := range machines[i] {
+			s.owners[m.Addr] = pool.System
+		}
+		all = append(all, machines[i]...)
+	}
+	s.mu.Unlock()
+	if len(all) > 0 {
+		err = nil
+	}
+	return all, err
+}
+
+func (s *mixedArchSystem) Exit(code int) { s.system().Exit(code) }
+
+func (s *mixedArchSystem) Shutdown() {
+	if s.local != nil {
+		s.local.Shutdown()
+		return
+	}
+	for _, pool := range s.pools {
+		pool.System.Shutdown()
+	}
+}
+
+// Maxprocs returns the smallest number of processors of any pool's
+// machines, or, on machines, the number of processors of the current
+// machine.
+func (s *mixedArchSystem) Maxprocs() int {
+	if s.local != nil {
+		return s.local.Maxprocs()
+	}
+	procs := s.pools[0].System.Maxprocs()
+	for _, pool := range s.pools[1:] {
+		if p := pool.System.Maxprocs(); p < procs {
+			procs = p
+		}
+	}
+	return procs
+}
+
+func (s *mixedArchSystem) KeepaliveConfig() (period, timeout, rpcTimeout time.Duration) {
+	return s.system().KeepaliveConfig()
+}
+
+func (s *mixedArchSystem) Tail(ctx context.Context, m *bigmachine.Machine) (io.Reader, error) {
+	return s.owner(m).Tail(ctx, m)
+}
+
+func (s *mixedArchSystem) Read(ctx context.Context, m *bigmachine.Machine, filename string) (io.Reader, error) {
+	return s.owner(m).Read(ctx, m, filename)
+}
+
+// owner returns the system that started machine m.
+func (s *mixedArchSystem) owner(m *bigmachine.Machine) bigmachine.System {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if system := s.owners[m.Addr]; system != nil {
+		return system
+	}
+	return s.system()
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/gob"
+	"runtime"
+	"testing"
+
+	"github.com/grailbio/bigmachine"
+	"github.com/grailbio/bigmachine/testsystem"
+)
+
+type archTestService struct{}
+
+func init() {
+	gob.Register(&archTestService{})
+}
+
+func (archTestService) Ping(ctx context.Context, _ struct{}, _ *struct{}) error { return nil }
+
+func TestMixedArchSystem(t *testing.T) {
+	var (
+		amd64 = testsystem.New()
+		arm64 = testsystem.New()
+	)
+	amd64.Machineprocs = 4
+	arm64.Machineprocs = 2
+	system := MixedArchSystem(
+		ArchPool{Arch: "linux/amd64", System: amd64},
+		ArchPool{Arch: "linux/arm64", System: arm64, Weight: 3},
+	)
+	b := bigmachine.Start(system)
+	defer b.Shutdown()
+	if got, want := system.Maxprocs(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	ctx := context.Background()
+	for _, c := range []struct{ n, amd64, arm64 int }{
+		{8, 2, 6},
+		{1, 2, 7},
+		{3, 3, 9},
+	} {
+		machines, err := b.Start(ctx, c.n, bigmachine.Services{"Test": &archTestService{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(machines), c.n; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := amd64.N(), c.amd64; got != want {
+			t.Errorf("amd64: got %v, want %v", got, want)
+		}
+		if got, want := arm64.N(), c.arm64; got != want {
+			t.Errorf("arm64: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSlicemachineArch(t *testing.T) {
+	_, _, mgr, cancel := startTestSystem(1, 1, 1.0)
+	defer cancel()
+	ms := getMachines(context.Background(), mgr, 1)
+	if got, want := ms[0].Arch, runtime.GOOS+"/"+runtime.GOARCH; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
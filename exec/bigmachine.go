@@ -17,6 +17,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grailbio/base/backgroundcontext"
@@ -35,6 +36,8 @@ import (
 	"github.com/grailbio/bigslice/metrics"
 	"github.com/grailbio/bigslice/sliceio"
 	"github.com/grailbio/bigslice/stats"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -64,7 +67,7 @@ var fatalErr = errors.E(errors.Fatal)
 // This should only be used in testing when deterministic ordering
 // matters.
 //
-// TODO(marius): make this a session option instead.
+// Deprecated: use the Deterministic session option instead.
 var DoShuffleReaders = true
 
 func init() {
@@ -80,6 +83,12 @@ func init() {
 type bigmachineExecutor struct {
 	system bigmachine.System
 	params []bigmachine.Param
+	// memLimit is the memory limit, in bytes, of each worker process,
+	// or zero if unlimited.
+	memLimit int64
+	// machprocs, if nonzero, is the number of procs that each machine
+	// offers to tasks, regardless of its size and the session's max load.
+	machprocs int
 
 	sess *Session
 	b    *bigmachine.B
@@ -91,21 +100,8 @@ type bigmachineExecutor struct {
 	locations map[*Task]*sliceMachine
 	stats     map[string]stats.Values
 
-	// Invocations and invocationDeps are used to track dependencies
-	// between invocations so that we can execute arbitrary graphs of
-	// slices on bigmachine workers. Note that this requires that we
-	// hold on to the invocations, which is somewhat unfortunate, but
-	// I don't see a clean way around it.
-	invocations    map[uint64]execInvocation
-	invocationDeps map[uint64]map[uint64]bool
-
-	// encodedInvocations holds the gob-encoded representations of the
-	// corresponding invocations. Because Func arguments, held in invocations,
-	// may be large, we memoize the encoded versions so that we don't pay the
-	// cost of gob-encoding the invocations for each worker (CPU to encode;
-	// memory for ephemeral buffers in gob). Instead, we do it once and reuse
-	// the result for each worker.
-	encodedInvocations map[uint64][]byte
+	// Invocations tracks the invocations compiled on workers.
+	invocations *invocationSet
 
 	// Worker is the (configured) worker service to instantiate on
 	// allocated machines.
@@ -122,6 +118,30 @@ type bigmachineExecutor struct {
 	// If the task is marked as exclusive, then one is added to their
 	// manager index.
 	managers []*machineManager
+
+	// gpuManager is the machine manager for the session's GPU machine
+	// profile. It is used for all tasks that need GPUs, and is created
+	// on first use.
+	gpuManager *machineManager
+
+	// budget is the budget of procs shared by the default manager and
+	// the GPU manager, so that GPU machines count against the session's
+	// parallelism.
+	budget *procBudget
+
+	// invManagers are the machine managers of the invocations that run
+	// on machines dedicated to them, keyed by invocation index. See
+	// RunMachine.
+	invManagers map[uint64]*machineManager
+
+	// counts counts the machines of all of the executor's managers.
+	counts machineCounts
+
+	// region is the region in which the executor's system creates its
+	// machines; regionErr is the error with which it could not be
+	// determined, if any.
+	region    string
+	regionErr error
 }
 
 func newBigmachineExecutor(system bigmachine.System, params ...bigmachine.Param) *bigmachineExecutor {
@@ -139,21 +159,36 @@ func (b *bigmachineExecutor) Name() string {
 func (b *bigmachineExecutor) Start(sess *Session) (shutdown func()) {
 	b.sess = sess
 	b.b = bigmachine.Start(b.system)
+	b.region, b.regionErr = systemRegion(b.system)
 	b.locations = make(map[*Task]*sliceMachine)
 	b.stats = make(map[string]stats.Values)
 	if status := sess.Status(); status != nil {
 		b.status = status.Group(BigmachineStatusGroup)
 	}
-	b.invocations = make(map[uint64]execInvocation)
-	b.invocationDeps = make(map[uint64]map[uint64]bool)
-	b.encodedInvocations = make(map[uint64][]byte)
+	b.invocations = newInvocationSet()
 	b.worker = &worker{
-		MachineCombiners: sess.machineCombiners,
+		MachineCombiners:    sess.machineCombiners,
+		Deterministic:       sess.deterministic,
+		MemoryLimit:         b.memLimit,
+		EvictionNoticeURL:   sess.evictionURL,
+		OrphanTimeout:       sess.orphanTimeout,
+		ShuffleFetchLimit:   sess.shuffleFetchLimit,
+		CombinerKeyDictSize: sess.combinerKeyDictSize,
+		DiskEviction:        sess.diskEviction,
+		regions:             b.regionErr == nil,
 	}
 
 	return b.b.Shutdown
 }
 
+// Region returns the region in which the executor's system creates its
+// machines. The region of each machine is also checked, as reported by
+// its instance metadata, before it runs the tasks of an invocation with
+// residency constraints.
+func (b *bigmachineExecutor) Region() (string, error) {
+	return b.region, b.regionErr
+}
+
 func (b *bigmachineExecutor) manager(i int) *machineManager {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -167,17 +202,143 @@ func (b *bigmachineExecutor) manager(i int) *machineManager {
 			// feasible value; i.e., one task may run on each machine.
 			maxLoad = 0
 		}
-		b.managers[i] = newMachineManager(b.b, b.params, b.status, b.sess.Parallelism(), maxLoad, b.worker)
+		b.managers[i] = b.newMachineManager(b.params, b.sess.Parallelism(), maxLoad)
+		if i == 0 {
+			b.managers[i].budget = b.procBudget()
+		}
+		b.managers[i].scale = b.sess.autoscale
+		b.managers[i].eventer = b.sess.eventer
+		b.managers[i].evict = b.evictFunc(b.managers[i])
+		b.managers[i].counts = &b.counts
 		go b.managers[i].Do(backgroundcontext.Get())
 	}
 	return b.managers[i]
 }
 
-type invocationRef struct{ Index uint64 }
+// newMachineManager returns a new manager of the executor's machines,
+// started with the provided params. If the executor fixes the procs
+// of its machines, they override the size computed from maxLoad.
+func (b *bigmachineExecutor) newMachineManager(params []bigmachine.Param, maxp int, maxLoad float64) *machineManager {
+	mgr := newMachineManager(b.b, params, b.status, maxp, maxLoad, b.worker)
+	if b.machprocs > 0 {
+		mgr.machprocs = b.machprocs
+		mgr.maxp = maxp
+	}
+	return mgr
+}
 
-func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv execInvocation) error {
+// gpuMachineManager returns the manager of the session's GPU machines, or
+// nil if the session does not have a GPU machine profile.
+func (b *bigmachineExecutor) gpuMachineManager() *machineManager {
 	b.mu.Lock()
-	if _, ok := b.invocations[inv.Index]; !ok {
+	defer b.mu.Unlock()
+	if b.sess.gpus == 0 {
+		return nil
+	}
+	if b.gpuManager == nil {
+		params := append(append([]bigmachine.Param{}, b.params...), b.sess.gpuParams...)
+		b.gpuManager = b.newMachineManager(params, b.sess.Parallelism(), b.sess.MaxLoad())
+		b.gpuManager.machgpus = b.sess.gpus
+		b.gpuManager.budget = b.procBudget()
+		b.gpuManager.scale = b.sess.autoscale
+		b.gpuManager.eventer = b.sess.eventer
+		b.gpuManager.evict = b.evictFunc(b.gpuManager)
+		b.gpuManager.counts = &b.counts
+		go b.gpuManager.Do(backgroundcontext.Get())
+	}
+	return b.gpuManager
+}
+
+// procBudget returns the executor's shared proc budget, creating it
+// on first use. It must be called with b.mu held.
+func (b *bigmachineExecutor) procBudget() *procBudget {
+	if b.budget == nil {
+		b.budget = newProcBudget()
+	}
+	return b.budget
+}
+
+// invocationManager returns the manager of the machines dedicated to
+// the provided invocation, or nil if the invocation runs on the
+// session's machines. Dedicated machines are started with the params of
+// the invocation's RunMachine option, and sized by its RunParallelism
+// option, if any.
+func (b *bigmachineExecutor) invocationManager(inv execInvocation) *machineManager {
+	if inv.opts == nil || len(inv.opts.machine) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if mgr := b.invManagers[inv.Index]; mgr != nil {
+		return mgr
+	}
+	if b.invManagers == nil {
+		b.invManagers = make(map[uint64]*machineManager)
+	}
+	parallelism := b.sess.Parallelism()
+	if inv.opts.parallelism > 0 {
+		parallelism = inv.opts.parallelism
+	}
+	params := append(append([]bigmachine.Param{}, b.params...), inv.opts.machine...)
+	mgr := b.newMachineManager(params, parallelism, b.sess.MaxLoad())
+	mgr.scale = b.sess.autoscale
+	mgr.eventer = b.sess.eventer
+	mgr.evict = b.evictFunc(mgr)
+	mgr.counts = &b.counts
+	go mgr.Do(backgroundcontext.Get())
+	b.invManagers[inv.Index] = mgr
+	return mgr
+}
+
+// evictFunc returns the function that handles the eviction of
+// machines managed by mgr, or nil if the session does not handle
+// evictions.
+func (b *bigmachineExecutor) evictFunc(mgr *machineManager) func(*sliceMachine, evictionNotice) {
+	if b.sess.evictionURL == "" {
+		return nil
+	}
+	return func(mach *sliceMachine, notice evictionNotice) {
+		b.evict(mgr, mach, notice)
+	}
+}
+
+type invocationRef struct{ Index uint64 }
+
+// An invocationSet tracks the invocations that have been compiled on
+// remote workers, and the dependencies between them, so that we can
+// execute arbitrary graphs of slices on workers. Note that this requires
+// that we hold on to the invocations, which is somewhat unfortunate, but
+// I don't see a clean way around it.
+type invocationSet struct {
+	mu          sync.Mutex
+	invocations map[uint64]execInvocation
+	deps        map[uint64]map[uint64]bool
+
+	// encoded holds the gob-encoded representations of the corresponding
+	// invocations. Because Func arguments, held in invocations, may be
+	// large, we memoize the encoded versions so that we don't pay the cost
+	// of gob-encoding the invocations for each worker (CPU to encode;
+	// memory for ephemeral buffers in gob). Instead, we do it once and
+	// reuse the result for each worker.
+	encoded map[uint64][]byte
+}
+
+func newInvocationSet() *invocationSet {
+	return &invocationSet{
+		invocations: make(map[uint64]execInvocation),
+		deps:        make(map[uint64]map[uint64]bool),
+		encoded:     make(map[uint64][]byte),
+	}
+}
+
+// Add adds the invocation inv to the set, if it is not already present.
+// It returns inv together with all of the invocations on which it
+// depends, and their gob-encoded representations, in the order in which
+// they must be compiled.
+func (s *invocationSet) Add(inv execInvocation) ([]execInvocation, [][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invocations[inv.Index]; !ok {
 		// This is the first time we are seeing this invocation.
 
 		// Substitute each *Result argument for an invocationRef and record the
@@ -188,24 +349,45 @@ func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv e
 				continue
 			}
 			inv.Args[i] = invocationRef{result.invIndex}
-			if _, ok := b.invocations[result.invIndex]; !ok {
-				b.mu.Unlock()
-				return fmt.Errorf("invalid result invocation %x", result.invIndex)
+			if _, ok := s.invocations[result.invIndex]; !ok {
+				return nil, nil, fmt.Errorf("invalid result invocation %x", result.invIndex)
+			}
+			if s.deps[inv.Index] == nil {
+				s.deps[inv.Index] = make(map[uint64]bool)
+			}
+			s.deps[inv.Index][result.invIndex] = true
+		}
+		// Record the dependencies on the invocations that computed the
+		// persisted slices that are read by the invocation.
+		for key, ref := range inv.Env.Persisted {
+			if _, ok := s.invocations[ref.InvIndex]; !ok {
+				return nil, nil, fmt.Errorf("invalid invocation %x of persisted slice %s", ref.InvIndex, key)
+			}
+			if s.deps[inv.Index] == nil {
+				s.deps[inv.Index] = make(map[uint64]bool)
+			}
+			s.deps[inv.Index][ref.InvIndex] = true
+		}
+		// Record the dependencies on the invocations whose completed
+		// tasks are reused by the invocation.
+		for _, name := range inv.Env.Reused {
+			if _, ok := s.invocations[name.InvIndex]; !ok {
+				return nil, nil, fmt.Errorf("invalid invocation %x of reused task %s", name.InvIndex, name)
 			}
-			if b.invocationDeps[inv.Index] == nil {
-				b.invocationDeps[inv.Index] = make(map[uint64]bool)
+			if s.deps[inv.Index] == nil {
+				s.deps[inv.Index] = make(map[uint64]bool)
 			}
-			b.invocationDeps[inv.Index][result.invIndex] = true
+			s.deps[inv.Index][name.InvIndex] = true
 		}
-		b.invocations[inv.Index] = inv
 
 		// gob-encode the invocation, so we can reuse the work of gob-encoding
 		// when sending the invocation to each worker.
 		var buf bytes.Buffer
 		if err := gob.NewEncoder(&buf).Encode(inv); err != nil {
-			return errors.E(errors.Fatal, errors.Invalid, "error gob-encoding invocation", err)
+			return nil, nil, errors.E(errors.Fatal, errors.Invalid, "error gob-encoding invocation", err)
 		}
-		b.encodedInvocations[inv.Index] = buf.Bytes()
+		s.invocations[inv.Index] = inv
+		s.encoded[inv.Index] = buf.Bytes()
 	}
 
 	// Now traverse the invocation graph bottom-up, making sure
@@ -214,22 +396,35 @@ func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv e
 	// TODO(marius): allow for parallel compilation as some users are
 	// performing expensive computations inside of bigslice.Funcs.
 	var (
-		todo               = []uint64{inv.Index}
-		invocations        []execInvocation
-		encodedInvocations [][]byte
+		todo        = []uint64{inv.Index}
+		invocations []execInvocation
+		encoded     [][]byte
 	)
 	for len(todo) > 0 {
 		var i uint64
 		i, todo = todo[0], todo[1:]
-		invocations = append(invocations, b.invocations[i])
-		encodedInvocations = append(encodedInvocations, b.encodedInvocations[i])
-		for j := range b.invocationDeps[i] {
+		invocations = append(invocations, s.invocations[i])
+		encoded = append(encoded, s.encoded[i])
+		for j := range s.deps[i] {
 			todo = append(todo, j)
 		}
 	}
-	b.mu.Unlock()
+	for i, j := 0, len(invocations)-1; i < j; i, j = i+1, j-1 {
+		invocations[i], invocations[j] = invocations[j], invocations[i]
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return invocations, encoded, nil
+}
 
-	for i := len(invocations) - 1; i >= 0; i-- {
+func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv execInvocation) error {
+	invocations, encodedInvocations, err := b.invocations.Add(inv)
+	if err != nil {
+		return err
+	}
+	if err := m.plugins.Sync(ctx, m, &processPlugins); err != nil {
+		return err
+	}
+	for i := range invocations {
 		err := m.Compiles.Do(invocations[i].Index, func() error {
 			inv := invocations[i]
 			// Flatten these into lists so that we don't capture further
@@ -240,8 +435,19 @@ func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv e
 				args[i] = truncatef(inv.Args[i])
 			}
 			b.sess.tracer.Event(m, inv, "B", "location", inv.Location, "args", args)
-			var invReader io.Reader = bytes.NewReader(encodedInvocations[i])
-			err := m.RetryCall(ctx, "Worker.Compile", invReader, nil)
+			// We cannot use RetryCall here: each attempt consumes the
+			// invocation reader, so retries must be given a fresh one.
+			var err error
+			for retries := 0; ; retries++ {
+				var invReader io.Reader = bytes.NewReader(encodedInvocations[i])
+				err = m.Call(ctx, "Worker.Compile", invReader, nil)
+				if err == nil || !errors.IsTemporary(err) {
+					break
+				}
+				if werr := retry.Wait(ctx, retryPolicy, retries); werr != nil {
+					break
+				}
+			}
 			if err != nil {
 				b.sess.tracer.Event(m, inv, "E", "error", err)
 			} else {
@@ -256,12 +462,32 @@ func (b *bigmachineExecutor) compile(ctx context.Context, m *sliceMachine, inv e
 	return nil
 }
 
+// commit starts committing the combine buffer with the provided key
+// on machine m. The combined output may be read while it is being
+// written, so consumers are not held up by the commit; they must await
+// it with awaitCommit before they are done.
 func (b *bigmachineExecutor) commit(ctx context.Context, m *sliceMachine, key string) error {
 	return m.Commits.Do(key, func() error {
-		return m.RetryCall(ctx, "Worker.CommitCombiner", TaskName{Op: key}, nil)
+		return m.RetryCall(ctx, "Worker.StartCommitCombiner", TaskName{Op: key}, nil)
 	})
 }
 
+// awaitCommit waits for the commit of the combine buffer with the
+// provided key on machine m, started by commit, to complete.
+func (b *bigmachineExecutor) awaitCommit(ctx context.Context, m *sliceMachine, key string) error {
+	err := m.RetryCall(ctx, "Worker.CommitCombiner", TaskName{Op: key}, nil)
+	if err != nil {
+		m.Commits.Forget(key)
+	}
+	return err
+}
+
+// A commitKey identifies a combine buffer on a machine.
+type commitKey struct {
+	m   *sliceMachine
+	key string
+}
+
 func (b *bigmachineExecutor) Run(task *Task) {
 	task.Status.Print("waiting for a machine")
 
@@ -270,23 +496,58 @@ func (b *bigmachineExecutor) Run(task *Task) {
 	if task.Invocation.Exclusive {
 		cluster = int(task.Invocation.Index)
 	}
-	mgr := b.manager(cluster)
+	var (
+		mgr  *machineManager
+		gpus = bigslice.PragmaGPUs(task.Pragma)
+	)
+	if gpus > 0 {
+		// Tasks that need GPUs are always placed on GPU machines,
+		// regardless of func exclusivity.
+		mgr = b.gpuMachineManager()
+		switch {
+		case mgr == nil:
+			task.Error(errors.E(errors.Fatal, errors.Precondition,
+				fmt.Sprintf("task %v needs %d GPUs, but the session has no GPU machines", task, gpus)))
+			return
+		case gpus > mgr.machgpus:
+			task.Error(errors.E(errors.Fatal, errors.Precondition,
+				fmt.Sprintf("task %v needs %d GPUs, but GPU machines have only %d", task, gpus, mgr.machgpus)))
+			return
+		}
+	} else if mgr = b.invocationManager(task.Invocation); mgr == nil {
+		mgr = b.manager(cluster)
+	}
 	procs := task.Pragma.Procs()
 	if task.Pragma.Exclusive() || procs > mgr.machprocs {
 		procs = mgr.machprocs
 	}
 	var (
-		ctx            = backgroundcontext.Get()
-		offerc, cancel = mgr.Offer(int(task.Invocation.Index), procs)
+		ctx = backgroundcontext.Get()
+		// evalCtx is canceled when the task's evaluation ends, which
+		// cancels the task's run, but not the compilations and combiner
+		// commits that it shares with other tasks.
+		evalCtx        = task.evalContext()
+		offerc, cancel = mgr.Offer(int(task.Invocation.Index), procs, gpus)
 		m              *sliceMachine
 	)
 	select {
-	case <-ctx.Done():
-		task.Error(ctx.Err())
+	case <-evalCtx.Done():
 		cancel()
+		if ctx.Err() != nil {
+			task.Error(ctx.Err())
+		} else {
+			task.Set(TaskLost)
+		}
 		return
 	case m = <-offerc:
 	}
+	if residency := task.Invocation.residency; residency != nil {
+		if err := residency.check(m.Addr, m.Region); err != nil {
+			task.Error(err)
+			m.Done(procs, gpus, nil)
+			return
+		}
+	}
 	numTasks := m.Stats.Int("tasks")
 	numTasks.Add(1)
 	m.UpdateStatus()
@@ -318,24 +579,32 @@ compile:
 			// involve dependencies other than potentially uploading data from
 			// the driver node, so we consider any error to be fatal to the task.
 			task.Errorf("failed to compile invocation on machine %s: %v", m.Addr, err)
-			m.Done(procs, err)
+			m.Done(procs, gpus, err)
 			return
 		default:
 			task.Status.Printf("task lost while compiling bigslice.Func: %v", err)
 			task.Set(TaskLost)
-			m.Done(procs, err)
+			m.Done(procs, gpus, err)
 			return
 		}
 	}
 
 	// Populate the run request. Include the locations of all dependent
 	// outputs so that the receiving worker can read from them.
+	task.Lock()
 	req := taskRunRequest{
 		Name:       task.Name,
 		Invocation: task.Invocation.Index,
+		Trace:      injectTrace(task.spanContext),
 	}
-	machineIndices := make(map[string]int)
-	g, _ := errgroup.WithContext(ctx)
+	task.Unlock()
+	var (
+		machineIndices = make(map[string]int)
+		g, _           = errgroup.WithContext(ctx)
+		// commits are the combine buffers that are committed for the
+		// task, which must complete before the task is done.
+		commits = make(map[commitKey]bool)
+	)
 	for _, dep := range task.Deps {
 		for i := 0; i < dep.NumTask(); i++ {
 			deptask := dep.Task(i)
@@ -344,7 +613,7 @@ compile:
 				// TODO(marius): make this a separate state, or a separate
 				// error type?
 				task.Errorf("task %v has no location", deptask)
-				m.Done(procs, nil)
+				m.Done(procs, gpus, nil)
 				return
 			}
 			j, ok := machineIndices[depm.Addr]
@@ -360,6 +629,7 @@ compile:
 			}
 			// Make sure that the result is committed.
 			g.Go(func() error { return b.commit(ctx, depm, key) })
+			commits[commitKey{depm, key}] = true
 		}
 	}
 
@@ -373,28 +643,81 @@ compile:
 	// TODO(marius): also aggregate stats across all tasks.
 	statsCtx, statsCancel := context.WithCancel(ctx)
 	go monitorTaskStats(statsCtx, m, task)
+	scopeDone := make(chan struct{})
+	go func() {
+		defer close(scopeDone)
+		// User metrics are polled only for display.
+		if b.sess.status != nil {
+			monitorTaskScope(statsCtx, m, task)
+		}
+	}()
 
 	b.sess.tracer.Event(m, task, "B")
-	task.Set(TaskRunning)
+	task.setRunning(m.Addr)
 	var reply taskRunReply
-	err := m.RetryCall(ctx, "Worker.Run", req, &reply)
+	start := time.Now()
+	err := runWorker(evalCtx, task, req, &reply, m.RetryCall)
+	elapsed := time.Since(start)
 	statsCancel()
-	m.Done(procs, err)
+	// Wait for the scope monitor so that it cannot clobber the task's
+	// final scope.
+	<-scopeDone
+	doneErr := err
+	if evalCtx.Err() != nil {
+		// The run was canceled; the machine is not to blame.
+		doneErr = nil
+	}
+	// The machine is returned only after the task has been assigned to
+	// it, so that machine drains account for the task's output.
+	defer m.RunDone(procs, gpus, elapsed, doneErr)
+	if err == nil && len(commits) > 0 {
+		// The task may have read its combined dependencies as they were
+		// being committed; it is done only once they are.
+		g, _ := errgroup.WithContext(ctx)
+		for c := range commits {
+			c := c
+			g.Go(func() error { return b.awaitCommit(ctx, c.m, c.key) })
+		}
+		if commitErr := g.Wait(); commitErr != nil {
+			b.sess.tracer.Event(m, task, "E", "error", commitErr, "error_type", "fatal")
+			task.Errorf("failed to commit combiner: %v", commitErr)
+			return
+		}
+	}
 	switch {
+	case err == nil && b.sess.verifies(task):
+		if err := verifyRemote(ctx, m, task, req); err != nil {
+			b.sess.tracer.Event(m, task, "E", "error", err, "error_type", "fatal")
+			task.Error(err)
+			return
+		}
+		fallthrough
 	case err == nil:
 		// Convert nanoseconds to microseconds to be same units as event durations.
 		b.sess.tracer.Event(m, task, "E",
 			"readDuration", reply.Vals["readDuration"]/1e3,
 			"writeDuration", reply.Vals["writeDuration"]/1e3,
 		)
+		for _, read := range reply.Reads {
+			b.sess.tracer.Read(m, task, start, read)
+		}
 		b.setLocation(task, m)
 		task.Status.Printf("done: %s", reply.Vals)
 		task.Scope.Reset(&reply.Scope)
+		task.Progress.Reset(reply.Progress)
+		task.setVals(reply.Vals)
 		task.Set(TaskOk)
 		m.Assign(task)
+		m.Evicted(reply.Evicted)
 	case ctx.Err() != nil:
 		b.sess.tracer.Event(m, task, "E", "error", ctx.Err())
 		task.Error(err)
+	case evalCtx.Err() != nil:
+		// The task's evaluation has ended; it may be resubmitted by a
+		// later evaluation.
+		b.sess.tracer.Event(m, task, "E", "error", evalCtx.Err(), "error_type", "lost")
+		task.Status.Printf("canceled: %v", evalCtx.Err())
+		task.Set(TaskLost)
 	case errors.Is(errors.Remote, err) && errors.Match(fatalErr, err):
 		b.sess.tracer.Event(m, task, "E", "error", err, "error_type", "fatal")
 		// Fatal errors aren't retryable.
@@ -425,11 +748,74 @@ func monitorTaskStats(ctx context.Context, m *sliceMachine, task *Task) {
 			wait()
 			continue
 		}
-		task.Status.Printf("%s: %s", m.Addr, *vals)
+		if report, ok := pollTaskProgress(ctx, m, task); ok && !report.IsZero() {
+			task.Status.Printf("%s: %s; progress: %s", m.Addr, *vals, report)
+		} else {
+			task.Status.Printf("%s: %s", m.Addr, *vals)
+		}
 		wait()
 	}
 }
 
+// pollTaskProgress retrieves the progress reported by the provided
+// task, as it runs on the worker reached by c, and updates the task's
+// progress accordingly. It returns false if progress could not be
+// retrieved.
+func pollTaskProgress(ctx context.Context, c workerClient, task *Task) (metrics.ProgressReport, bool) {
+	var report metrics.ProgressReport
+	if err := c.RetryCall(ctx, "Worker.TaskProgress", task.Name, &report); err != nil {
+		if ctx.Err() == nil {
+			log.Error.Printf("error getting progress of task %v: %v", task, err)
+		}
+		return report, false
+	}
+	if ctx.Err() != nil {
+		return report, false
+	}
+	task.Progress.Reset(report)
+	return report, true
+}
+
+// monitorTaskProgress periodically retrieves the progress reported by
+// the provided task, as it runs on the worker reached by c, until ctx
+// is done.
+func monitorTaskProgress(ctx context.Context, c workerClient, task *Task) {
+	for {
+		select {
+		case <-time.After(statsPollInterval):
+		case <-ctx.Done():
+			return
+		}
+		if report, ok := pollTaskProgress(ctx, c, task); ok && !report.IsZero() {
+			task.Status.Printf("progress: %s", report)
+		}
+	}
+}
+
+// monitorTaskScope periodically retrieves the metrics scope of the
+// provided task, as it runs on the worker reached by c, so that user
+// metrics are displayed while the task is running.
+func monitorTaskScope(ctx context.Context, c workerClient, task *Task) {
+	for {
+		select {
+		case <-time.After(statsPollInterval):
+		case <-ctx.Done():
+			return
+		}
+		var scope metrics.Scope
+		if err := c.RetryCall(ctx, "Worker.TaskScope", task.Name, &scope); err != nil {
+			if ctx.Err() == nil {
+				log.Error.Printf("error getting metrics of task %v: %v", task, err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		task.Scope.Reset(&scope)
+	}
+}
+
 func (b *bigmachineExecutor) Reader(task *Task, partition int) sliceio.ReadCloser {
 	m := b.location(task)
 	if m == nil {
@@ -467,14 +853,160 @@ func (b *bigmachineExecutor) Discard(ctx context.Context, task *Task) {
 	task.Set(TaskLost)
 }
 
+// Decommission drains the machine with the provided address,
+// replicates the outputs of its completed tasks to other machines in
+// the same pool, and then releases it. Outputs that cannot be
+// replicated, including those of shared combiners, are marked lost, and
+// are recomputed if they are needed again. If ctx is done before the
+// machine is released, it is returned to service.
+func (b *bigmachineExecutor) Decommission(ctx context.Context, addr string) error {
+	b.mu.Lock()
+	mgrs := append([]*machineManager{b.gpuManager}, b.managers...)
+	for _, mgr := range b.invManagers {
+		mgrs = append(mgrs, mgr)
+	}
+	b.mu.Unlock()
+	for _, mgr := range mgrs {
+		if mgr == nil {
+			continue
+		}
+		mach, err := mgr.Drain(ctx, addr, false)
+		if errors.Is(errors.NotExist, err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := mgr.Drain(ctx, addr, true); err != nil {
+			if ctx.Err() != nil {
+				mgr.Undrain(mach)
+			}
+			return err
+		}
+		b.replicate(ctx, mgr, mach)
+		if err := ctx.Err(); err != nil {
+			mgr.Undrain(mach)
+			return err
+		}
+		log.Printf("releasing decommissioned machine %s", mach.Addr)
+		mach.Release()
+		return nil
+	}
+	return errors.E(errors.NotExist, "machine ", addr)
+}
+
+// maxReplicaTargets is the maximum number of machines over which the
+// task outputs of a decommissioned machine are spread.
+const maxReplicaTargets = 4
+
+// replicate copies the outputs of the tasks on the drained machine mach
+// to other machines offered by mgr, and updates their locations. The
+// outputs are spread over up to maxReplicaTargets machines that have
+// procs free, or, if there are none, copied to the first machine that
+// mgr offers. Replication is best-effort: tasks that are not
+// replicated remain assigned to mach.
+func (b *bigmachineExecutor) replicate(ctx context.Context, mgr *machineManager, mach *sliceMachine) {
+	var tasks []*Task
+	for _, task := range mach.Tasks() {
+		switch {
+		case b.location(task) != mach:
+			// The task has since been recomputed elsewhere, so the output
+			// on mach is stale.
+			mach.Unassign(task)
+		case task.State() == TaskOk && task.CombineKey == "":
+			tasks = append(tasks, task)
+		}
+	}
+	if len(tasks) == 0 {
+		return
+	}
+	targets, err := mgr.OfferEach(ctx, 1, min(len(tasks), maxReplicaTargets))
+	if err != nil {
+		return
+	}
+	if len(targets) == 0 {
+		offerc, cancel := mgr.Offer(0, 1, 0)
+		select {
+		case <-ctx.Done():
+			cancel()
+			return
+		case target := <-offerc:
+			targets = append(targets, target)
+		}
+	}
+	taskc := make(chan *Task, len(tasks))
+	for _, task := range tasks {
+		taskc <- task
+	}
+	close(taskc)
+	var (
+		wg sync.WaitGroup
+		n  int64
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *sliceMachine) {
+			defer wg.Done()
+			// targetErr is the error, if any, that indicates that target
+			// itself failed. Errors from the application code of the
+			// call, e.g., because the output could not be read from mach,
+			// and errors due to cancellation do not implicate target.
+			var targetErr error
+			for task := range taskc {
+				req := replicateRequest{task.Name, task.NumPartition, mach.Addr}
+				err := target.RetryCall(ctx, "Worker.Replicate", req, nil)
+				if err == nil {
+					b.setLocation(task, target)
+					target.Assign(task)
+					mach.Unassign(task)
+					atomic.AddInt64(&n, 1)
+					continue
+				}
+				log.Error.Printf("failed to replicate %v from %s to %s: %v", task, mach.Addr, target.Addr, err)
+				if ctx.Err() != nil {
+					break
+				}
+				if !errors.Is(errors.Remote, err) {
+					// Leave the remaining tasks to the other targets.
+					targetErr = err
+					break
+				}
+			}
+			target.Done(1, 0, targetErr)
+		}(target)
+	}
+	wg.Wait()
+	log.Printf("replicated %d/%d task outputs from %s to %d machines", n, len(tasks), mach.Addr, len(targets))
+}
+
 func (b *bigmachineExecutor) Eventer() eventlog.Eventer {
 	return b.sess.eventer
 }
 
+func (b *bigmachineExecutor) machineCounts() machineCounts {
+	return b.counts.load()
+}
+
 func (b *bigmachineExecutor) HandleDebug(handler *http.ServeMux) {
 	b.b.HandleDebug(handler)
 }
 
+// profile implements profiler. The profile is captured by the worker
+// running on the bigmachine machine with the provided address.
+func (b *bigmachineExecutor) profile(ctx context.Context, addr string, p Profile) (io.ReadCloser, error) {
+	for _, m := range b.b.Machines() {
+		if m.Addr != addr {
+			continue
+		}
+		var rc io.ReadCloser
+		if err := m.Call(ctx, "Worker.Profile", p, &rc); err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}
+	return nil, errors.E(errors.NotExist, fmt.Sprintf("machine %s", addr))
+}
+
 // Location returns the machine on which the results of the provided
 // task resides.
 func (b *bigmachineExecutor) location(task *Task) *sliceMachine {
@@ -507,9 +1039,45 @@ type worker struct {
 	// MachineCombiners determines whether to use the MachineCombiners
 	// compilation option.
 	MachineCombiners bool
+	// Deterministic determines whether task dependencies are read in
+	// a fixed order.
+	Deterministic bool
+	// MemoryLimit is the limit, in bytes, imposed on the worker process's
+	// address space, or zero if unlimited. A worker that exceeds its
+	// limit crashes, and its tasks are lost.
+	MemoryLimit int64
+	// EvictionNoticeURL is the URL from which the worker retrieves
+	// notices of its machine's impending eviction, or empty if
+	// evictions are not handled. See SpotEvictions.
+	EvictionNoticeURL string
+	// OrphanTimeout is the amount of time after which a worker that has
+	// not received a heartbeat from its driver exits, or zero if workers
+	// do not watch for heartbeats. See OrphanTimeout.
+	OrphanTimeout time.Duration
+	// ShuffleFetchLimit is the maximum number of shuffle fetches that
+	// the worker's tasks may have in progress from a single producer
+	// machine, or zero if unlimited. See ShuffleFetchLimit.
+	ShuffleFetchLimit int
+	// CombinerKeyDictSize is the maximum number of keys interned by
+	// each of the worker's machine combiners, or zero if keys are not
+	// interned. See CombinerKeyDictionary.
+	CombinerKeyDictSize int
+	// DiskEviction is the policy by which the worker evicts the outputs
+	// of its completed tasks when its disk nears capacity. See
+	// DiskEviction.
+	DiskEviction DiskEvictionPolicy
 
-	b     *bigmachine.B
 	store Store
+	// memory holds the outputs of tasks that compute slices that are
+	// persisted in memory. See bigslice.PersistMemory.
+	memory *memoryStore
+	// dial returns a client for the worker at the provided address.
+	dial func(ctx context.Context, addr string) (workerClient, error)
+	// plugins and pluginDir override the registry of the worker's
+	// plugins and the directory in which they are stored; see
+	// (*worker).pluginRegistry.
+	plugins   *pluginRegistry
+	pluginDir string
 
 	mu        sync.Mutex
 	cond      *ctxsync.Cond
@@ -525,11 +1093,76 @@ type worker struct {
 	combinerStates map[TaskName]combinerState
 	combinerErrors map[TaskName]error
 	combiners      map[TaskName][]chan *combiner
+	// combinerDicts holds the key dictionary of each combine key that
+	// is being combined, if keys are interned.
+	combinerDicts map[TaskName]*keyDict
+	// combinerStreams holds, for each combine key that is being
+	// written, the streams through which its partitions may be read
+	// before they are committed.
+	combinerStreams map[TaskName][]*combinerStream
+
+	// replicas holds the number of partitions of the task outputs that
+	// were replicated to this worker from other workers.
+	replicas map[TaskName]int
+
+	// lastNeeded holds, for each task output that may be evicted, the
+	// time at which it was last needed. Evicted holds the names of the
+	// tasks whose outputs were evicted but not yet reported to the
+	// driver.
+	lastNeeded map[TaskName]time.Time
+	evicted    []TaskName
 
 	commitLimiter *limiter.Limiter
+
+	// fetches schedules the shuffle fetches of the worker's tasks.
+	fetches *fetchScheduler
+
+	// broadcasts ensures that the output of each task that is read as
+	// a broadcast dependency is replicated to the worker only once.
+	broadcasts once.Map
+
+	// eviction is the eviction notice issued for the worker's machine,
+	// if any.
+	eviction evictionNotice
+
+	// heartbeat is the time at which the worker last received a
+	// heartbeat from its driver.
+	heartbeat time.Time
+
+	// regions indicates whether the driver determines the regions of
+	// the worker's machines as they start, because the region of the
+	// executor's system is known. It is used only by the driver.
+	regions bool
+}
+
+// A workerClient issues calls to a (remote) worker. It is implemented by
+// *bigmachine.Machine, and by the clients of gRPC worker agents.
+type workerClient interface {
+	RetryCall(ctx context.Context, serviceMethod string, arg, reply interface{}) error
 }
 
 func (w *worker) Init(b *bigmachine.B) error {
+	if w.MemoryLimit > 0 {
+		if err := setMemoryLimit(w.MemoryLimit); err != nil {
+			return err
+		}
+	}
+	w.dial = func(ctx context.Context, addr string) (workerClient, error) {
+		return b.Dial(ctx, addr)
+	}
+	if w.EvictionNoticeURL != "" {
+		go w.watchEviction(context.Background())
+	}
+	if w.OrphanTimeout > 0 {
+		go w.watchDriver(context.Background())
+	}
+	return w.init(b.System().Maxprocs())
+}
+
+// init initializes the worker's state. Procs is the number of processors
+// available to the worker, or zero if it should be inferred from
+// GOMAXPROCS.
+func (w *worker) init(procs int) error {
 	w.cond = ctxsync.NewCond(&w.mu)
 	w.tasks = make(map[uint64]map[TaskName]*Task)
 	w.taskStats = make(map[uint64]map[TaskName]*stats.Map)
@@ -537,12 +1170,16 @@ func (w *worker) Init(b *bigmachine.B) error {
 	w.combiners = make(map[TaskName][]chan *combiner)
 	w.combinerStates = make(map[TaskName]combinerState)
 	w.combinerErrors = make(map[TaskName]error)
-	w.b = b
+	w.combinerStreams = make(map[TaskName][]*combinerStream)
+	w.combinerDicts = make(map[TaskName]*keyDict)
+	w.replicas = make(map[TaskName]int)
+	w.lastNeeded = make(map[TaskName]time.Time)
 	dir, err := ioutil.TempDir("", "bigslice")
 	if err != nil {
 		return err
 	}
 	w.store = &fileStore{Prefix: dir + "/"}
+	w.memory = newMemoryStore()
 	w.stats = stats.NewMap()
 	// Set up a limiter to limit the number of concurrent commits
 	// that are allowed to happen in the worker.
@@ -550,11 +1187,11 @@ func (w *worker) Init(b *bigmachine.B) error {
 	// TODO(marius): we should treat commits like tasks and apply
 	// load balancing/limiting instead.
 	w.commitLimiter = limiter.New()
-	procs := b.System().Maxprocs()
 	if procs == 0 {
 		procs = runtime.GOMAXPROCS(0)
 	}
 	w.commitLimiter.Release(procs)
+	w.fetches = newFetchScheduler(w.ShuffleFetchLimit)
 	return nil
 }
 
@@ -595,6 +1232,8 @@ func (w *worker) Compile(ctx context.Context, invReader io.Reader, _ *struct{})
 				return fmt.Errorf("worker.Compile: invalid invocation reference %x", ref.Index)
 			}
 		}
+		inv.persisted = w.persistedTasks
+		inv.reused = w.reusedTask
 		slice := inv.Invoke()
 		tasks, err := compile(inv, slice, w.MachineCombiners)
 		if err != nil {
@@ -621,6 +1260,48 @@ func (w *worker) Compile(ctx context.Context, invReader io.Reader, _ *struct{})
 	})
 }
 
+// persistedTasks returns the tasks of the persisted slice to which ref
+// refers. The executor must ensure that the invocation that computed
+// the slice has been compiled.
+func (w *worker) persistedTasks(ref persistRef) ([]*Task, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	named, ok := w.tasks[ref.InvIndex]
+	if !ok {
+		return nil, fmt.Errorf("worker.Compile: invalid invocation reference %x", ref.InvIndex)
+	}
+	tasks := make([]*Task, ref.NumShard)
+	for shard := range tasks {
+		if tasks[shard], ok = named[ref.Name(shard)]; !ok {
+			return nil, fmt.Errorf("worker.Compile: invalid persisted task %s", ref.Name(shard))
+		}
+	}
+	return tasks, nil
+}
+
+// reusedTask returns the named task of a previous invocation, which is
+// reused by a run of a resident invocation. The executor must ensure
+// that the previous invocation has been compiled.
+func (w *worker) reusedTask(name TaskName) (*Task, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	task, ok := w.tasks[name.InvIndex][name]
+	if !ok {
+		return nil, fmt.Errorf("worker.Compile: invalid reused task %s", name)
+	}
+	return task, nil
+}
+
+// storeOf returns the store that holds the outputs of the named task:
+// the worker's memory store for tasks that compute slices persisted in
+// memory, and its file store otherwise.
+func (w *worker) storeOf(name TaskName) Store {
+	if w.memory.contains(name) {
+		return w.memory
+	}
+	return w.store
+}
+
 // TaskRunRequest contains all data required to run an individual task.
 type taskRunRequest struct {
 	// Invocation is the invocation from which the task was compiled.
@@ -637,6 +1318,14 @@ type taskRunRequest struct {
 	// fact that the task graph is identical to all viewers: locations
 	// are stored in the order of task dependencies.
 	Locations []int
+
+	// Trace carries the OpenTelemetry trace context of the driver's
+	// attempt to run the task, if it is traced.
+	Trace map[string]string
+
+	// Truncated indicates that the task's output is not needed; the
+	// task produces an empty output. See Task.Limit.
+	Truncated bool
 }
 
 func (r *taskRunRequest) location(taskIndex int) string {
@@ -650,6 +1339,17 @@ type taskRunReply struct {
 	// Scope is the scope of the task at completion time.
 	// TODO(marius): unify scopes with values, above.
 	Scope metrics.Scope
+
+	// Progress is the progress reported by the task at completion time.
+	Progress metrics.ProgressReport
+
+	// Evicted names the tasks whose outputs were evicted from the worker
+	// since its last reply, e.g., to relieve disk pressure. See
+	// DiskEviction.
+	Evicted []TaskName
+
+	// Reads records the task's reads of its dependencies, for tracing.
+	Reads []taskRead
 }
 
 // maybeTaskFatalErr wraps errors in (*worker).Run that can cause fatal task
@@ -720,11 +1420,41 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 	}
 	taskStats := namedStats[req.Name]
 	ctx = metrics.ScopedContext(ctx, &task.Scope)
+	task.Progress.Reset(metrics.ProgressReport{})
+	ctx = metrics.ProgressContext(ctx, &task.Progress)
+	if len(req.Trace) > 0 {
+		var span trace.Span
+		ctx, span = otel.GetTracerProvider().Tracer(instrumentationName).Start(
+			extractTrace(ctx, req.Trace), "bigslice.worker.run", taskAttributes(task))
+		defer func() { endSpan(span, err) }()
+	}
 
+	var (
+		runStart = time.Now()
+		reads    []*tracedReader
+	)
+	// traced wraps r, which reads the provided partition of the
+	// dependency task name from the machine addr, so that the read is
+	// reported in the task's reply.
+	traced := func(r sliceio.Reader, name TaskName, addr string) sliceio.Reader {
+		tr := &tracedReader{Reader: r, start: runStart, read: taskRead{Task: name, Addr: addr}}
+		reads = append(reads, tr)
+		return tr
+	}
 	defer func() {
 		reply.Vals = make(stats.Values)
 		taskStats.AddAll(reply.Vals)
 		reply.Scope.Reset(&task.Scope)
+		reply.Progress = task.Progress.Report()
+		if err == nil {
+			// Evictions are reported only by replies that are delivered.
+			reply.Evicted = w.takeEvicted()
+			for _, r := range reads {
+				if r.started {
+					reply.Reads = append(reply.Reads, r.read)
+				}
+			}
+		}
 	}()
 
 	task.Lock()
@@ -742,6 +1472,12 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 				break
 			}
 		}
+		if err == nil && req.Truncated && task.state > TaskOk {
+			// The task's previous run was canceled because it was
+			// truncated while it ran (see runWorker).
+			log.Printf("Worker.Run: %s: reviving truncated task", task.Name)
+			break
+		}
 		task.Unlock()
 		if e := task.Err(); e != nil {
 			err = e
@@ -773,103 +1509,28 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 		totalRecordsIn = w.stats.Int("inrecords")
 		recordsIn = w.stats.Int("read")
 	}
-	var (
-		in        = make([]sliceio.Reader, 0, len(task.Deps))
-		taskIndex int
-	)
-	for _, dep := range task.Deps {
-		// If the dependency has a combine key, they are combined on the
-		// machine, and we de-dup the dependencies.
-		//
-		// The caller of has already ensured that the combiner buffers
-		// are committed on the machines.
-		if dep.CombineKey != "" {
-			locations := make(map[string]bool)
-			for i := 0; i < dep.NumTask(); i++ {
-				addr := req.location(taskIndex)
-				taskIndex++
-				// We only read the first combine key for each location.
-				//
-				// TODO(marius): compute some non-overlapping intersection of
-				// combine keys instead, so that we can handle error recovery
-				// properly. In particular, in the case of error recovery, we
-				// have to create new combiner keys so that they aren't written
-				// into previous combiner buffers. This suggests that combiner
-				// keys should be assigned by the executor, and not during
-				// compile time.
-				if locations[addr] {
-					continue
-				}
-				locations[addr] = true
-			}
-			for addr := range locations {
-				machine, err := w.b.Dial(ctx, addr)
-				if err != nil {
-					return err
-				}
-				r := newMachineReader(machine, taskPartition{TaskName{Op: dep.CombineKey}, dep.Partition})
-				in = append(in, &statsReader{r, []*stats.Int{taskRecordsIn, recordsIn}, taskReadDuration})
-				defer r.Close()
-			}
-		} else {
-			reader := new(multiReader)
-			reader.q = make([]sliceio.Reader, dep.NumTask())
-		Tasks:
-			for j := 0; j < dep.NumTask(); j++ {
-				deptask := dep.Task(j)
-				// If we have it locally, or if we're using a shared backend store
-				// (e.g., S3), then read it directly.
-				info, err := w.store.Stat(ctx, deptask.Name, dep.Partition)
-				if err == nil {
-					rc, openErr := w.store.Open(ctx, deptask.Name, dep.Partition, 0)
-					if openErr == nil {
-						defer rc.Close()
-						r := sliceio.NewDecodingReader(rc)
-						reader.q[j] = &statsReader{r, []*stats.Int{taskRecordsIn, recordsIn}, taskReadDuration}
-						taskTotalRecordsIn.Add(info.Records)
-						totalRecordsIn.Add(info.Records)
-						taskIndex++
-						continue Tasks
-					}
-				}
-				// Find the location of the task.
-				addr := req.location(taskIndex)
-				taskIndex++
-				machine, err := w.b.Dial(ctx, addr)
-				if err != nil {
-					return err
-				}
-				tp := taskPartition{deptask.Name, dep.Partition}
-				if err := machine.RetryCall(ctx, "Worker.Stat", tp, &info); err != nil {
-					return err
-				}
-				r := newMachineReader(machine, tp)
-				reader.q[j] = &statsReader{r, []*stats.Int{taskRecordsIn, recordsIn}, taskReadDuration}
-				taskTotalRecordsIn.Add(info.Records)
-				totalRecordsIn.Add(info.Records)
-				defer r.Close()
-			}
-			// We shuffle the tasks here so that we don't encounter
-			// "thundering herd" issues were partitions are read sequentially
-			// from the same (ordered) list of machines.
-			//
-			// TODO(marius): possibly we should perform proper load balancing
-			// here
-			if DoShuffleReaders {
-				rand.Shuffle(len(reader.q), func(i, j int) { reader.q[i], reader.q[j] = reader.q[j], reader.q[i] })
-			}
-			if dep.Expand {
-				in = append(in, reader.q...)
-			} else {
-				in = append(in, reader)
-			}
+	in, closers, err := w.taskInputs(ctx, task, req, inputStats{
+		read:         []*stats.Int{taskRecordsIn, recordsIn},
+		total:        []*stats.Int{taskTotalRecordsIn, totalRecordsIn},
+		readDuration: taskReadDuration,
+	}, traced)
+	defer func() {
+		for _, c := range closers {
+			c.Close() // nolint: errcheck
 		}
+	}()
+	if err != nil {
+		return err
+	}
+	do := task.Do
+	if req.Truncated {
+		do = truncatedDo
 	}
 
 	// If we have a combiner, then we partition globally for the machine
 	// into common combiners.
 	if !task.Combiner.IsNil() {
-		return w.runCombine(ctx, task, taskStats, task.Do(in))
+		return w.runCombine(ctx, task, taskStats, do(in))
 	}
 
 	// Stream partition output directly to the underlying store, but
@@ -879,14 +1540,20 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 	// TODO(marius): switch to using a monotasks-like arrangement
 	// instead once we also have memory management, in order to control
 	// buffer growth.
+	w.relieveDiskPressure(ctx, depNames(task))
 	type partition struct {
 		wc  writeCommitter
 		buf *bufio.Writer
 		sliceio.Writer
 	}
+	// Slices persisted in memory are stored in the worker's memory store.
+	store := w.store
+	if task.Storage == bigslice.PersistMemory {
+		store = w.memory
+	}
 	partitions := make([]*partition, task.NumPartition)
 	for p := range partitions {
-		wc, err := w.store.Create(ctx, task.Name, p)
+		wc, err := store.Create(ctx, task.Name, p)
 		if err != nil {
 			return err
 		}
@@ -905,7 +1572,7 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 			part.wc.Discard(ctx)
 		}
 	}()
-	out := task.Do(in)
+	out := do(in)
 	count := make([]int64, task.NumPartition)
 	switch {
 	case task.NumOut() == 0:
@@ -980,6 +1647,7 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 		}
 	}
 
+	taskBytesOut := taskStats.Int("writeBytes")
 	for i, part := range partitions {
 		if err := part.buf.Flush(); err != nil {
 			return err
@@ -988,15 +1656,31 @@ func (w *worker) Run(ctx context.Context, req taskRunRequest, reply *taskRunRepl
 		if err := part.wc.Commit(ctx, count[i]); err != nil {
 			return err
 		}
+		if info, err := w.storeOf(task.Name).Stat(ctx, task.Name, i); err == nil {
+			taskBytesOut.Add(info.Size)
+		}
 	}
 	partitions = nil
+	w.touchOutput(task.Name, true)
 	return nil
 }
 
 func (w *worker) Discard(ctx context.Context, taskName TaskName, _ *struct{}) (err error) {
 	w.mu.Lock()
 	named := w.tasks[taskName.InvIndex]
+	numPartition, replicated := w.replicas[taskName]
+	delete(w.replicas, taskName)
 	w.mu.Unlock()
+	if replicated {
+		w.broadcasts.Forget(taskName)
+		for partition := 0; partition < numPartition; partition++ {
+			err := w.storeOf(taskName).Discard(ctx, taskName, partition)
+			if err != nil {
+				log.Printf("warning: failed to discard replica %v:%d: %v", taskName, partition, err)
+			}
+		}
+		return nil
+	}
 	if named == nil {
 		return nil
 	}
@@ -1014,16 +1698,17 @@ func (w *worker) Discard(ctx context.Context, taskName TaskName, _ *struct{}) (e
 	task.state = TaskRunning
 	task.Unlock()
 	for partition := 0; partition < task.NumPartition; partition++ {
-		err := w.store.Discard(ctx, taskName, partition)
+		err := w.storeOf(taskName).Discard(ctx, taskName, partition)
 		if err != nil {
 			log.Printf("warning: failed to discard %v:%d: %v", taskName, partition, err)
 		}
 	}
+	w.mu.Lock()
+	delete(w.lastNeeded, taskName)
 	if !task.Combiner.IsNil() && task.CombineKey == "" {
-		w.mu.Lock()
 		w.combinerStates[task.Name] = combinerNone
-		w.mu.Unlock()
 	}
+	w.mu.Unlock()
 	task.Set(TaskLost)
 	return nil
 }
@@ -1039,6 +1724,169 @@ func (w *worker) TaskStats(ctx context.Context, taskName TaskName, vals *stats.V
 	return nil
 }
 
+// TaskScope returns the metrics scope of the current or most recent run
+// of a task on w. This can be polled to display user metrics.
+func (w *worker) TaskScope(ctx context.Context, taskName TaskName, scope *metrics.Scope) error {
+	w.mu.Lock()
+	named := w.tasks[taskName.InvIndex]
+	w.mu.Unlock()
+	task := named[taskName]
+	if task == nil {
+		return errors.E(errors.NotExist, fmt.Sprintf("task %s", taskName))
+	}
+	scope.Reset(&task.Scope)
+	return nil
+}
+
+// TaskProgress returns the progress reported by the current or most
+// recent run of a task on w.
+func (w *worker) TaskProgress(ctx context.Context, taskName TaskName, report *metrics.ProgressReport) error {
+	w.mu.Lock()
+	named := w.tasks[taskName.InvIndex]
+	w.mu.Unlock()
+	task := named[taskName]
+	if task == nil {
+		return errors.E(errors.NotExist, fmt.Sprintf("task %s", taskName))
+	}
+	*report = task.Progress.Report()
+	return nil
+}
+
+// inputStats are the stats that are updated as a task's inputs are
+// read.
+type inputStats struct {
+	// read counts the records that are read, and total the records
+	// that are to be read.
+	read, total  []*stats.Int
+	readDuration *stats.Int
+}
+
+func (s inputStats) addTotal(n int64) {
+	for _, total := range s.total {
+		total.Add(n)
+	}
+}
+
+// taskInputs returns readers of the dependencies of the provided task,
+// gathering them from the bigmachine cluster, as located by the run
+// request, and dialing machines as necessary. Reads are counted by the
+// provided stats, and wrapped by traced. The returned closers must be
+// closed once the readers are done, even if an error is returned.
+func (w *worker) taskInputs(ctx context.Context, task *Task, req taskRunRequest, st inputStats,
+	traced func(sliceio.Reader, TaskName, string) sliceio.Reader) (in []sliceio.Reader, closers []io.Closer, err error) {
+	in = make([]sliceio.Reader, 0, len(task.Deps))
+	var taskIndex int
+	for _, dep := range task.Deps {
+		// If the dependency has a combine key, they are combined on the
+		// machine, and we de-dup the dependencies.
+		//
+		// The caller of has already ensured that the combiner buffers
+		// are committed on the machines.
+		if dep.CombineKey != "" {
+			locations := make(map[string]bool)
+			for i := 0; i < dep.NumTask(); i++ {
+				addr := req.location(taskIndex)
+				taskIndex++
+				// We only read the first combine key for each location.
+				//
+				// TODO(marius): compute some non-overlapping intersection of
+				// combine keys instead, so that we can handle error recovery
+				// properly. In particular, in the case of error recovery, we
+				// have to create new combiner keys so that they aren't written
+				// into previous combiner buffers. This suggests that combiner
+				// keys should be assigned by the executor, and not during
+				// compile time.
+				if locations[addr] {
+					continue
+				}
+				locations[addr] = true
+			}
+			for addr := range locations {
+				machine, err := w.dial(ctx, addr)
+				if err != nil {
+					return nil, closers, err
+				}
+				r := newMachineReader(machine, addr, taskPartition{TaskName{Op: dep.CombineKey}, dep.Partition})
+				r.Columns = dep.Columns
+				in = append(in, &statsReader{traced(r, TaskName{Op: dep.CombineKey}, addr), st.read, st.readDuration})
+				closers = append(closers, r)
+			}
+		} else {
+			fetches := make([]fetch, dep.NumTask())
+		Tasks:
+			for j := 0; j < dep.NumTask(); j++ {
+				deptask := dep.Task(j)
+				if dep.Broadcast {
+					if err := w.replicateBroadcast(ctx, deptask, req.location(taskIndex)); err != nil {
+						return nil, closers, err
+					}
+				}
+				// If we have it locally, or if we're using a shared backend store
+				// (e.g., S3), then read it directly.
+				info, err := w.storeOf(deptask.Name).Stat(ctx, deptask.Name, dep.Partition)
+				if err == nil {
+					rc, openErr := w.storeOf(deptask.Name).Open(ctx, deptask.Name, dep.Partition, 0)
+					if openErr == nil {
+						w.touchOutput(deptask.Name, false)
+						closers = append(closers, rc)
+						r := sliceio.NewPartialDecodingReader(rc, dep.Columns)
+						fetches[j] = fetch{"", &statsReader{traced(r, deptask.Name, ""), st.read, st.readDuration}}
+						st.addTotal(info.Records)
+						taskIndex++
+						continue Tasks
+					}
+				}
+				// Find the location of the task.
+				addr := req.location(taskIndex)
+				taskIndex++
+				machine, err := w.dial(ctx, addr)
+				if err != nil {
+					return nil, closers, err
+				}
+				tp := taskPartition{deptask.Name, dep.Partition}
+				if err := machine.RetryCall(ctx, "Worker.Stat", tp, &info); err != nil {
+					return nil, closers, err
+				}
+				r := newMachineReader(machine, addr, tp)
+				r.Columns = dep.Columns
+				fetches[j] = fetch{addr, &statsReader{traced(r, deptask.Name, addr), st.read, st.readDuration}}
+				st.addTotal(info.Records)
+				closers = append(closers, r)
+			}
+			switch {
+			case !DoShuffleReaders || w.Deterministic:
+				reader := new(multiReader)
+				for _, f := range fetches {
+					reader.q = append(reader.q, f.Reader)
+				}
+				if dep.Expand {
+					in = append(in, reader.q...)
+				} else {
+					in = append(in, reader)
+				}
+			case dep.Expand:
+				// Expanded dependencies are read concurrently, so we
+				// shuffle them here so that we don't encounter "thundering
+				// herd" issues where partitions are opened in the same
+				// order from the same (ordered) list of machines.
+				rand.Shuffle(len(fetches), func(i, j int) { fetches[i], fetches[j] = fetches[j], fetches[i] })
+				for _, f := range fetches {
+					in = append(in, f.Reader)
+				}
+			default:
+				// Dependencies that are read one task at a time are
+				// scheduled across the worker's tasks so that reads are
+				// spread evenly across producer machines.
+				staggerFetches(fetches, dep.Partition)
+				reader := &fetchReader{sched: w.fetches, fetches: fetches}
+				closers = append(closers, reader)
+				in = append(in, reader)
+			}
+		}
+	}
+	return in, closers, nil
+}
+
 func (w *worker) runCombine(ctx context.Context, task *Task, taskStats *stats.Map,
 	in sliceio.Reader) (err error) {
 	combineKey := task.Name
@@ -1074,10 +1922,14 @@ func (w *worker) runCombine(ctx context.Context, task *Task, taskStats *stats.Ma
 			combiners[i] <- comb
 		}
 		w.combiners[combineKey] = combiners
+		if dict := newKeyDict(task, w.CombinerKeyDictSize); dict != nil {
+			w.combinerDicts[combineKey] = dict
+		}
 		w.combinerStates[combineKey] = combinerIdle
 	}
 	w.combinerStates[combineKey]++
 	combiners := w.combiners[combineKey]
+	dict := w.combinerDicts[combineKey]
 	w.mu.Unlock()
 
 	defer func() {
@@ -1092,12 +1944,21 @@ func (w *worker) runCombine(ctx context.Context, task *Task, taskStats *stats.Ma
 			// captured, as it does not happen within the context of a single
 			// task execution.
 			taskWriteDuration.Add(time.Since(start).Nanoseconds())
+			if err == nil {
+				taskBytesOut := taskStats.Int("writeBytes")
+				for p := 0; p < task.NumPartition; p++ {
+					if info, statErr := w.store.Stat(ctx, combineKey, p); statErr == nil {
+						taskBytesOut.Add(info.Size)
+					}
+				}
+			}
 		}
 	}()
 
 	var (
 		taskRecordsOut = taskStats.Int("write")
 		recordsOut     = w.stats.Int("write")
+		dictHits       = w.stats.Int("keydicthits")
 	)
 	// Now perform the partition-combine operation. We maintain a
 	// per-task combine buffer for each partition. When this buffer
@@ -1121,6 +1982,11 @@ func (w *worker) runCombine(ctx context.Context, task *Task, taskStats *stats.Ma
 		if err != nil && err != sliceio.EOF {
 			return maybeTaskFatalErr{err}
 		}
+		if dict != nil {
+			// Intern keys before they are buffered, so that buffers share
+			// copies of identical keys.
+			dictHits.Add(int64(dict.Intern(out.Slice(0, n))))
+		}
 		task.Partitioner(ctx, out, task.NumPartition, shards[:n])
 		for i := 0; i < n; i++ {
 			p := shards[i]
@@ -1180,12 +2046,86 @@ type taskPartition struct {
 	Partition int
 }
 
+// Region returns the region of the instance on which the worker runs,
+// as reported by its instance metadata.
+func (w *worker) Region(ctx context.Context, _ struct{}, region *string) (err error) {
+	*region, err = instanceRegion()
+	return err
+}
+
 // Stat returns the SliceInfo for a slice.
 func (w *worker) Stat(ctx context.Context, tp taskPartition, info *sliceInfo) (err error) {
-	*info, err = w.store.Stat(ctx, tp.Name, tp.Partition)
+	*info, err = w.storeOf(tp.Name).Stat(ctx, tp.Name, tp.Partition)
 	return
 }
 
+// replicateRequest is the request payload for Worker.Replicate.
+type replicateRequest struct {
+	// Name is the name of the task whose output is to be replicated.
+	Name TaskName
+	// NumPartition is the number of partitions of the task's output.
+	NumPartition int
+	// Addr is the address of the worker that holds the task's output.
+	Addr string
+}
+
+// Replicate copies the output of a task from another worker into w's
+// store, from which it may then be read. It is used to move task
+// outputs off of machines that are being decommissioned.
+func (w *worker) Replicate(ctx context.Context, req replicateRequest, _ *struct{}) error {
+	machine, err := w.dial(ctx, req.Addr)
+	if err != nil {
+		return err
+	}
+	for partition := 0; partition < req.NumPartition; partition++ {
+		tp := taskPartition{req.Name, partition}
+		var info sliceInfo
+		if err := machine.RetryCall(ctx, "Worker.Stat", tp, &info); err != nil {
+			return err
+		}
+		wc, err := w.store.Create(ctx, req.Name, partition)
+		if err != nil {
+			return err
+		}
+		r := newRetryReader(ctx, machineTaskPartition{machine, req.Addr, tp})
+		_, err = io.Copy(wc, r)
+		r.Close()
+		if err != nil {
+			wc.Discard(ctx)
+			return err
+		}
+		if err := wc.Commit(ctx, info.Records); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	w.replicas[req.Name] = req.NumPartition
+	w.mu.Unlock()
+	return nil
+}
+
+// replicateBroadcast replicates the output of the provided task, which
+// is read by the worker's tasks as a broadcast dependency, from the
+// worker at addr, unless it is already in w's store. Each output is
+// replicated at most once, so that the worker's tasks read broadcast
+// dependencies locally, and their producers serve each of them once
+// per machine rather than once per task.
+func (w *worker) replicateBroadcast(ctx context.Context, task *Task, addr string) error {
+	if _, err := w.storeOf(task.Name).Stat(ctx, task.Name, 0); err == nil {
+		return nil
+	}
+	err := w.broadcasts.Do(task.Name, func() error {
+		req := replicateRequest{Name: task.Name, NumPartition: task.NumPartition, Addr: addr}
+		return w.Replicate(ctx, req, nil)
+	})
+	if err != nil {
+		// Allow the replication to be retried, e.g., after the task is
+		// recomputed elsewhere.
+		w.broadcasts.Forget(task.Name)
+	}
+	return err
+}
+
 // CommitCombiner commits the current combiner buffer with the
 // provided key. After successful return, its results are available via
 // Read.
@@ -1205,23 +2145,68 @@ func (w *worker) CommitCombiner(ctx context.Context, key TaskName, _ *struct{})
 		case combinerError:
 			return maybeTaskFatalErr{errors.E("error while writing combiner", w.combinerErrors[key])}
 		case combinerIdle:
-			w.combinerStates[key] = combinerWriting
-			go w.writeCombiner(key)
+			w.startCombiner(key)
+		default:
+			return fmt.Errorf("combiner key %s busy", key)
+		}
+	}
+}
+
+// StartCommitCombiner starts committing the current combiner buffer
+// with the provided key, if it is not already being committed, and
+// returns without waiting for the commit to complete. The combiner's
+// partitions may be read while they are being written: Read streams
+// them to readers as they are flushed.
+func (w *worker) StartCommitCombiner(ctx context.Context, key TaskName, _ *struct{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		switch w.combinerStates[key] {
+		case combinerNone:
+			return fmt.Errorf("invalid combiner key %s", key)
+		case combinerWriting, combinerCommitted:
+			return nil
+		case combinerError:
+			return maybeTaskFatalErr{errors.E("error while writing combiner", w.combinerErrors[key])}
+		case combinerIdle:
+			w.startCombiner(key)
 		default:
 			return fmt.Errorf("combiner key %s busy", key)
 		}
 	}
 }
 
+// startCombiner starts writing the idle combiner with the provided key.
+// It must be called with w.mu held.
+func (w *worker) startCombiner(key TaskName) {
+	w.combinerStates[key] = combinerWriting
+	streams := make([]*combinerStream, len(w.combiners[key]))
+	for i := range streams {
+		part := i
+		streams[i] = newCombinerStream(func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+			if err := w.CommitCombiner(ctx, key, nil); err != nil {
+				return nil, err
+			}
+			return w.store.Open(ctx, key, part, offset)
+		})
+	}
+	w.combinerStreams[key] = streams
+	go w.writeCombiner(key)
+}
+
 func (w *worker) writeCombiner(key TaskName) {
 	g, ctx := errgroup.WithContext(backgroundcontext.Get())
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	streams := w.combinerStreams[key]
 	for part := range w.combiners[key] {
 		part := part
 		combiner := <-w.combiners[key][part]
-		g.Go(func() error {
-			err := w.commitLimiter.Acquire(ctx, 1)
+		g.Go(func() (err error) {
+			// Readers of the stream see the outcome of the write only once
+			// it has been committed (or failed).
+			defer func() { streams[part].Close(err) }()
+			err = w.commitLimiter.Acquire(ctx, 1)
 			if err != nil {
 				return err
 			}
@@ -1230,7 +2215,10 @@ func (w *worker) writeCombiner(key TaskName) {
 			if err != nil {
 				return err
 			}
-			buf := bufio.NewWriter(wc)
+			// Write through to the stream as the buffer is flushed, so
+			// that consumers may process the combined output while it is
+			// being written.
+			buf := bufio.NewWriter(io.MultiWriter(wc, streams[part]))
 			enc := sliceio.NewEncodingWriter(buf)
 			n, err := combiner.WriteTo(ctx, enc)
 			if err != nil {
@@ -1248,6 +2236,10 @@ func (w *worker) writeCombiner(key TaskName) {
 	err := g.Wait()
 	w.mu.Lock()
 	w.combiners[key] = nil
+	delete(w.combinerDicts, key)
+	// Subsequent reads are served by the store. Readers that are
+	// attached to the streams may continue to read from them.
+	delete(w.combinerStreams, key)
 	if err == nil {
 		w.combinerStates[key] = combinerCommitted
 	} else {
@@ -1262,7 +2254,19 @@ func (w *worker) writeCombiner(key TaskName) {
 //
 // TODO(marius): should we flush combined outputs explicitly?
 func (w *worker) Read(ctx context.Context, req readRequest, rc *io.ReadCloser) (err error) {
-	*rc, err = w.store.Open(ctx, req.Name, req.Partition, req.Offset)
+	if req.Name.IsCombiner() {
+		w.mu.Lock()
+		streams := w.combinerStreams[req.Name]
+		w.mu.Unlock()
+		if req.Partition < len(streams) {
+			*rc = streams[req.Partition].Reader(ctx, req.Offset)
+			return nil
+		}
+	}
+	*rc, err = w.storeOf(req.Name).Open(ctx, req.Name, req.Partition, req.Offset)
+	if err == nil {
+		w.touchOutput(req.Name, false)
+	}
 	return
 }
 
@@ -1370,6 +2374,9 @@ type openerAtReader struct {
 	// Read will be revised with respect to task errors (i.e. should errors be
 	// considered task-fatal?).
 	ReviseSeverity bool
+	// Columns indicates which columns are decoded; if nil, all are. See
+	// sliceio.NewPartialDecodingReader.
+	Columns []bool
 
 	readCloser    io.ReadCloser
 	sliceioReader sliceio.Reader
@@ -1379,7 +2386,7 @@ type openerAtReader struct {
 func (r *openerAtReader) Read(ctx context.Context, f frame.Frame) (int, error) {
 	if r.readCloser == nil {
 		r.readCloser = newRetryReader(ctx, r.OpenerAt)
-		r.sliceioReader = sliceio.NewDecodingReader(r.readCloser)
+		r.sliceioReader = sliceio.NewPartialDecodingReader(r.readCloser, r.Columns)
 	}
 	n, err := r.sliceioReader.Read(ctx, f)
 	if r.ReviseSeverity {
@@ -1403,7 +2410,9 @@ func (r *openerAtReader) Close() error {
 // the openerAt interface to provide an io.ReadCloser to read the task data.
 type machineTaskPartition struct {
 	// Machine is the machine from which task data is read.
-	Machine *bigmachine.Machine
+	Machine workerClient
+	// Addr is the address of Machine.
+	Addr string
 	// TaskPartition is the task and partition that should be read.
 	TaskPartition taskPartition
 }
@@ -1417,16 +2426,17 @@ func (m machineTaskPartition) OpenAt(ctx context.Context, offset int64) (io.Read
 }
 
 func (m machineTaskPartition) String() string {
-	return fmt.Sprintf("Worker.Read %s:%s:%d", m.Machine.Addr, m.TaskPartition.Name, m.TaskPartition.Partition)
+	return fmt.Sprintf("Worker.Read %s:%s:%d", m.Addr, m.TaskPartition.Name, m.TaskPartition.Partition)
 }
 
 // newMachineReader returns a reader that reads a taskPartition from a machine.
 // It issues the (streaming) read RPC on the first call to Read so that data
 // are not buffered unnecessarily.
-func newMachineReader(machine *bigmachine.Machine, taskPartition taskPartition) *openerAtReader {
+func newMachineReader(machine workerClient, addr string, taskPartition taskPartition) *openerAtReader {
 	return &openerAtReader{
 		OpenerAt: machineTaskPartition{
 			Machine:       machine,
+			Addr:          addr,
 			TaskPartition: taskPartition,
 		},
 		// This is how all slice operations read data to process and does not
@@ -1520,6 +2530,41 @@ func truncatef(v interface{}) string {
 	return b.String()
 }
 
+// A taskRead records a task's read of a partition of one of its
+// dependencies.
+type taskRead struct {
+	// Task names the dependency task whose output was read.
+	Task TaskName
+	// Addr is the address of the machine from which the partition was
+	// read, or empty if it was read from the worker's own store.
+	Addr string
+	// Start and End are the times at which the read began and ended,
+	// as offsets from the start of the task's run.
+	Start, End time.Duration
+	// Records is the number of records read.
+	Records int64
+}
+
+// tracedReader records the read of a dependency partition in a
+// taskRead.
+type tracedReader struct {
+	sliceio.Reader
+	start   time.Time
+	started bool
+	read    taskRead
+}
+
+func (r *tracedReader) Read(ctx context.Context, f frame.Frame) (int, error) {
+	if !r.started {
+		r.started = true
+		r.read.Start = time.Since(r.start)
+	}
+	n, err := r.Reader.Read(ctx, f)
+	r.read.Records += int64(n)
+	r.read.End = time.Since(r.start)
+	return n, err
+}
+
 type statsWriter struct {
 	writer          sliceio.Writer
 	writeDurationNs *stats.Int
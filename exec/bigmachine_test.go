@@ -7,15 +7,20 @@ package exec
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grailbio/base/errors"
 	"github.com/grailbio/base/retry"
+	"github.com/grailbio/bigmachine"
 	"github.com/grailbio/bigmachine/testsystem"
 	"github.com/grailbio/bigslice"
 	"github.com/grailbio/bigslice/metrics"
@@ -292,6 +297,159 @@ func TestBigmachineExecutorProcs(t *testing.T) {
 	}
 }
 
+// TestBigmachineExecutorGPUs verifies that tasks that need GPUs are placed
+// only on GPU machines, and that GPUs are not oversubscribed.
+func TestBigmachineExecutorGPUs(t *testing.T) {
+	// Set up the test with:
+	// - a slice with 4 tasks, each needing 1 GPU
+	// - a system with 4 procs per machine, each machine with 2 GPUs
+	system := testsystem.New()
+	system.Machineprocs = 4
+	ctx, cancel := context.WithCancel(context.Background())
+	x := newBigmachineExecutor(system)
+	shutdown := x.Start(&Session{
+		Context: ctx,
+		p:       16,
+		maxLoad: 1,
+		gpus:    2,
+	})
+	defer shutdown()
+	defer cancel()
+
+	blockc := make(chan struct{})
+	tasks, _, _ := compileFunc(func() bigslice.Slice {
+		slice := bigslice.ReaderFunc(4, func(shard int, x *int, xs []int) (int, error) {
+			<-blockc
+			return 0, sliceio.EOF
+		}, bigslice.GPUs(1))
+		return slice
+	})
+	for _, task := range tasks {
+		if got, want := bigslice.PragmaGPUs(task.Pragma), 1; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		go x.Run(task)
+	}
+	for _, task := range tasks {
+		state, err := task.WaitState(ctx, TaskRunning)
+		if err != nil || state != TaskRunning {
+			t.Fatal(state, err)
+		}
+	}
+	// The tasks would fit on a single machine by procs, but GPUs require
+	// that they are spread across two.
+	if got, want := system.N(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	close(blockc)
+	for _, task := range tasks {
+		state, err := task.WaitState(ctx, TaskOk)
+		if err != nil || state != TaskOk {
+			t.Fatal(state, err)
+		}
+	}
+
+	// Tasks that need more GPUs than a machine has fail.
+	tasks, _, _ = compileFunc(func() bigslice.Slice {
+		return bigslice.Map(bigslice.Const(1, []int{1}), func(i int) int { return i }, bigslice.GPUs(3))
+	})
+	run(t, x, tasks, TaskErr)
+	if err := tasks[0].Err(); !errors.Match(fatalErr, err) {
+		t.Errorf("expected fatal error, got %v", err)
+	}
+}
+
+// TestBigmachineExecutorGPUParallelism verifies that GPU machines count
+// against the session's parallelism.
+func TestBigmachineExecutorGPUParallelism(t *testing.T) {
+	system := testsystem.New()
+	system.Machineprocs = 4
+	ctx, cancel := context.WithCancel(context.Background())
+	x := newBigmachineExecutor(system)
+	shutdown := x.Start(&Session{
+		Context: ctx,
+		p:       8,
+		maxLoad: 1,
+		gpus:    1,
+	})
+	defer shutdown()
+	defer cancel()
+
+	blockc := make(chan struct{})
+	reader := func(shard int, x *int, xs []int) (int, error) {
+		<-blockc
+		return 0, sliceio.EOF
+	}
+	// The CPU tasks use the session's whole parallelism.
+	cpuTasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.ReaderFunc(2, reader, bigslice.Procs(4))
+	})
+	for _, task := range cpuTasks {
+		go x.Run(task)
+	}
+	for _, task := range cpuTasks {
+		state, err := task.WaitState(ctx, TaskRunning)
+		if err != nil || state != TaskRunning {
+			t.Fatal(state, err)
+		}
+	}
+	gpuTasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.ReaderFunc(2, reader, bigslice.GPUs(1))
+	})
+	for _, task := range gpuTasks {
+		go x.Run(task)
+	}
+	// A single GPU machine is nevertheless started, so that GPU tasks
+	// make progress, but no more.
+	for {
+		var running int
+		for _, task := range gpuTasks {
+			if task.State() == TaskRunning {
+				running++
+			}
+		}
+		if running > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got, want := system.N(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var running int
+	for _, task := range gpuTasks {
+		if task.State() == TaskRunning {
+			running++
+		}
+	}
+	if got, want := running, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	close(blockc)
+	for _, task := range append(cpuTasks, gpuTasks...) {
+		state, err := task.WaitState(ctx, TaskOk)
+		if err != nil || state != TaskOk {
+			t.Fatal(state, err)
+		}
+	}
+}
+
+// TestBigmachineExecutorNoGPUs verifies that tasks that need GPUs fail when the
+// session has no GPU machines.
+func TestBigmachineExecutorNoGPUs(t *testing.T) {
+	x, stop := bigmachineTestExecutor(1)
+	defer stop()
+
+	tasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Map(bigslice.Const(1, []int{1}), func(i int) int { return i }, bigslice.GPUs(1))
+	})
+	run(t, x, tasks, TaskErr)
+	if err := tasks[0].Err(); !errors.Match(fatalErr, err) {
+		t.Errorf("expected fatal error, got %v", err)
+	}
+}
+
 func TestBigmachineExecutorPanicRun(t *testing.T) {
 	x, stop := bigmachineTestExecutor(1)
 	defer stop()
@@ -405,6 +563,362 @@ func TestBigmachineExecutorLost(t *testing.T) {
 	}
 }
 
+func TestBigmachineExecutorDecommission(t *testing.T) {
+	system := testsystem.New()
+	system.Machineprocs = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	x := newBigmachineExecutor(system)
+	shutdown := x.Start(&Session{
+		Context: ctx,
+		p:       2,
+		maxLoad: 1,
+	})
+	defer shutdown()
+	defer cancel()
+
+	const N = 10000
+	tasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, n *int, col []int) (int, error) {
+			if *n >= N {
+				return 0, sliceio.EOF
+			}
+			col = col[:min(len(col), N-*n)]
+			for i := range col {
+				col[i] = *n + i
+			}
+			*n += len(col)
+			return len(col), nil
+		})
+	})
+	task := tasks[0]
+	run(t, x, tasks, TaskOk)
+	m := x.location(task)
+
+	if err := x.Decommission(ctx, "nonexistent:1234"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+	if err := x.Decommission(ctx, m.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Retired() {
+		t.Error("decommissioned machine was not released")
+	}
+	if got, want := task.State(), TaskOk; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	replica := x.location(task)
+	if replica == m {
+		t.Fatal("task output was not moved")
+	}
+	// The task's output must be served by the replica, and must survive
+	// the decommissioned machine's demise.
+	<-m.Wait(bigmachine.Stopped)
+	var col []int
+	r := x.Reader(task, 0)
+	defer r.Close()
+	if err := sliceio.ReadAll(ctx, r, &col); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(col), N; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, v := range col {
+		if v != i {
+			t.Fatalf("col[%d]: got %v, want %v", i, v, i)
+		}
+	}
+	if got, want := task.State(), TaskOk; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The decommissioned machine can no longer be decommissioned.
+	if err := x.Decommission(ctx, m.Addr); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+}
+
+func TestBigmachineMachineCombiners(t *testing.T) {
+	const (
+		N      = 10000
+		Nkey   = 100
+		Nshard = 8
+	)
+	sess := Start(Bigmachine(testsystem.New()), MachineCombiners)
+	defer sess.Shutdown()
+	fn := bigslice.Func(func() bigslice.Slice {
+		keys := make([]int, N)
+		vals := make([]int, N)
+		for i := range keys {
+			keys[i] = i % Nkey
+			vals[i] = 1
+		}
+		slice := bigslice.Const(Nshard, keys, vals)
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	res, err := sess.Run(ctx, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		keys, vals []int
+		r          = res.open()
+	)
+	defer r.Close()
+	if err := sliceio.ReadAll(ctx, r, &keys, &vals); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(keys), Nkey; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range keys {
+		if got, want := vals[i], N/Nkey; got != want {
+			t.Errorf("key %d: got %v, want %v", keys[i], got, want)
+		}
+	}
+}
+
+// decodeCounted is a value that counts the number of times it is
+// gob-decoded.
+type decodeCounted struct{ V int }
+
+var decodeCount int64
+
+func (v decodeCounted) GobEncode() ([]byte, error) {
+	return []byte(fmt.Sprint(v.V)), nil
+}
+
+func (v *decodeCounted) GobDecode(p []byte) error {
+	atomic.AddInt64(&decodeCount, 1)
+	_, err := fmt.Sscan(string(p), &v.V)
+	return err
+}
+
+func TestBigmachinePartialDecoding(t *testing.T) {
+	const (
+		N      = 1000
+		Nshard = 4
+	)
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(Nshard))
+	defer sess.Shutdown()
+	fn := bigslice.Func(func(selectCounted bool) bigslice.Slice {
+		keys := make([]int, N)
+		vals := make([]decodeCounted, N)
+		for i := range keys {
+			keys[i] = i
+			vals[i] = decodeCounted{i}
+		}
+		slice := bigslice.Const(Nshard, keys, vals)
+		slice = bigslice.Reshuffle(slice)
+		if selectCounted {
+			return bigslice.SelectColumns(slice, 1)
+		}
+		return bigslice.SelectColumns(slice, 0)
+	})
+	ctx := context.Background()
+	for _, selectCounted := range []bool{false, true} {
+		atomic.StoreInt64(&decodeCount, 0)
+		res, err := sess.Run(ctx, fn, selectCounted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The reshuffled column of counted values is decoded only if it
+		// is selected.
+		if got, want := atomic.LoadInt64(&decodeCount) > 0, selectCounted; got != want {
+			t.Errorf("selectCounted=%v: got %v, want %v", selectCounted, got, want)
+		}
+		var (
+			sum int
+			r   = res.open()
+		)
+		if selectCounted {
+			var vals []decodeCounted
+			err = sliceio.ReadAll(ctx, r, &vals)
+			for _, v := range vals {
+				sum += v.V
+			}
+		} else {
+			var keys []int
+			err = sliceio.ReadAll(ctx, r, &keys)
+			for _, k := range keys {
+				sum += k
+			}
+		}
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sum, N*(N-1)/2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBigmachineExecutorEviction(t *testing.T) {
+	savePoll, saveMargin := evictionPollInterval, evictionMargin
+	evictionPollInterval, evictionMargin = 10*time.Millisecond, time.Second
+	defer func() {
+		evictionPollInterval, evictionMargin = savePoll, saveMargin
+	}()
+	// The notice server issues a single eviction notice once armed, so
+	// that only the machine that first polls it is evicted.
+	var (
+		mu    sync.Mutex
+		armed bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !armed {
+			http.NotFound(w, r)
+			return
+		}
+		armed = false
+		fmt.Fprintf(w, `{"action": "terminate", "time": %q}`,
+			time.Now().Add(10*time.Second).UTC().Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	x := newBigmachineExecutor(testsystem.New())
+	shutdown := x.Start(&Session{
+		Context:     ctx,
+		p:           1,
+		maxLoad:     1,
+		evictionURL: srv.URL,
+	})
+	defer shutdown()
+	defer cancel()
+
+	tasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Const(1, []int{1, 2, 3})
+	})
+	task := tasks[0]
+	run(t, x, tasks, TaskOk)
+	m := x.location(task)
+	mu.Lock()
+	armed = true
+	mu.Unlock()
+
+	select {
+	case <-m.Wait(bigmachine.Stopped):
+	case <-time.After(10 * time.Second):
+		t.Fatal("evicted machine was not released")
+	}
+	if !m.Retired() {
+		t.Error("evicted machine was lost, not released")
+	}
+	if got, want := task.State(), TaskOk; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if x.location(task) == m {
+		t.Fatal("task output was not migrated")
+	}
+	var col []int
+	r := x.Reader(task, 0)
+	defer r.Close()
+	if err := sliceio.ReadAll(ctx, r, &col); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := col, []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBigmachineExecutorDiskEviction(t *testing.T) {
+	// The disk is always full, so that workers evict every output that
+	// they may before writing new ones.
+	saveUsage := diskUsage
+	diskUsage = func(string) (used, total uint64, err error) { return 99, 100, nil }
+	defer func() { diskUsage = saveUsage }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	x := newBigmachineExecutor(testsystem.New())
+	shutdown := x.Start(&Session{
+		Context:      ctx,
+		p:            1,
+		maxLoad:      1,
+		diskEviction: DiskEvictionPolicy{MaxUsage: 0.9},
+	})
+	defer shutdown()
+	defer cancel()
+
+	constTasks, constSlice, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Const(1, []int{1, 2, 3})
+	})
+	constResult := &Result{Slice: constSlice, tasks: constTasks}
+	run(t, x, constTasks, TaskOk)
+	// The outputs of a task's dependencies are not evicted.
+	mapTasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Map(constResult, func(v int) int { return v * 2 })
+	})
+	run(t, x, mapTasks, TaskOk)
+	if got, want := constTasks[0].State(), TaskOk; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// Other outputs are evicted, and marked lost.
+	otherTasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Const(1, []string{"a", "b"})
+	})
+	run(t, x, otherTasks, TaskOk)
+	for _, task := range []*Task{constTasks[0], mapTasks[0]} {
+		if got, want := task.State(), TaskLost; got != want {
+			t.Errorf("task %v: got %v, want %v", task, got, want)
+		}
+	}
+	// Evicted tasks are recomputed.
+	constTasks[0].Set(TaskInit)
+	run(t, x, constTasks, TaskOk)
+	var col []int
+	r := x.Reader(constTasks[0], 0)
+	defer r.Close()
+	if err := sliceio.ReadAll(ctx, r, &col); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := col, []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWorkerOrphanTimeout(t *testing.T) {
+	exitc := make(chan int, 1)
+	saveExit := orphanExit
+	orphanExit = func(code int) { exitc <- code }
+	defer func() { orphanExit = saveExit }()
+
+	const timeout = 100 * time.Millisecond
+	w := &worker{OrphanTimeout: timeout}
+	if err := w.init(1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		w.watchDriver(ctx)
+		close(done)
+	}()
+	// The worker survives as long as it receives heartbeats.
+	for deadline := time.Now().Add(5 * timeout); time.Now().Before(deadline); {
+		if err := w.Heartbeat(ctx, struct{}{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-exitc:
+			t.Fatal("worker exited while receiving heartbeats")
+		case <-time.After(timeout / 5):
+		}
+	}
+	select {
+	case code := <-exitc:
+		if code == 0 {
+			t.Error("orphaned worker exited successfully")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("orphaned worker did not exit")
+	}
+	<-done
+}
+
 type errorSlice struct {
 	bigslice.Slice
 	err error
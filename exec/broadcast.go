@@ -0,0 +1,58 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// pipelineDep returns the index of the dependency of the provided
+// slice through which it may be pipelined: its only dependency that
+// is not a broadcast dependency. PipelineDep returns false if the
+// slice has no such dependency, or several.
+func pipelineDep(slice bigslice.Slice) (int, bool) {
+	index := -1
+	for i := 0; i < slice.NumDep(); i++ {
+		if slice.Dep(i).Broadcast {
+			continue
+		}
+		if index >= 0 {
+			return -1, false
+		}
+		index = i
+	}
+	return index, index >= 0
+}
+
+// depReaders returns the readers of the dependencies of the provided
+// pipelined slice, given the reader of the dependency through which it
+// is pipelined and the readers of its broadcast dependencies, in order.
+func depReaders(slice bigslice.Slice, pipelined sliceio.Reader, bcast []sliceio.Reader) []sliceio.Reader {
+	if slice.NumDep() == 1 {
+		return []sliceio.Reader{pipelined}
+	}
+	readers := make([]sliceio.Reader, slice.NumDep())
+	for i := range readers {
+		if slice.Dep(i).Broadcast {
+			readers[i], bcast = bcast[0], bcast[1:]
+		} else {
+			readers[i] = pipelined
+		}
+	}
+	return readers
+}
+
+// broadcastDep compiles the provided slice, which is a broadcast
+// dependency, and returns the task dependency through which it is read
+// in full. The slice is compiled into tasks that each write a single
+// partition, which is read from all of them by every dependent task.
+func (c *compiler) broadcastDep(slice bigslice.Slice) (TaskDep, error) {
+	depTasks, err := c.compile(slice, partitioner{numPartition: 1})
+	if err != nil {
+		return TaskDep{}, err
+	}
+	return TaskDep{Head: depTasks[0], Broadcast: true}, nil
+}
@@ -44,6 +44,18 @@ func (b taskBuffer) Slice(partition, off int) (frame.Frame, int) {
 	return frame.Frame{}, -1
 }
 
+// rows returns the number of rows in the buffer, across all of its
+// partitions.
+func (b taskBuffer) rows() int64 {
+	var n int64
+	for _, frames := range b {
+		for _, f := range frames {
+			n += int64(f.Len())
+		}
+	}
+	return n
+}
+
 type taskBufferReader struct {
 	q       taskBuffer
 	i, j, k int
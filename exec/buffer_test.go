@@ -6,7 +6,6 @@ package exec
 
 import (
 	"context"
-	"reflect"
 	"testing"
 
 	fuzz "github.com/google/gofuzz"
@@ -15,8 +14,6 @@ import (
 	"github.com/grailbio/bigslice/slicetype"
 )
 
-var typeOfString = reflect.TypeOf("")
-
 func TestTaskBuffer(t *testing.T) {
 	var batches [][]string
 	fz := fuzz.New()
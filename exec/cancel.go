@@ -0,0 +1,127 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+)
+
+// A runningInvocation is an invocation that is being run by a session.
+type runningInvocation struct {
+	location string
+	start    time.Time
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// startRunning registers the running invocation with the provided
+// index, which is canceled by the provided function.
+func (s *Session) startRunning(index uint64, location string, cancel context.CancelFunc) {
+	s.mu.Lock()
+	s.running[index] = &runningInvocation{location: location, start: time.Now(), cancel: cancel}
+	s.mu.Unlock()
+}
+
+// stopRunning unregisters the running invocation with the provided
+// index.
+func (s *Session) stopRunning(index uint64) {
+	s.mu.Lock()
+	delete(s.running, index)
+	s.mu.Unlock()
+}
+
+// canceled returns whether the running invocation with the provided
+// index was canceled by Session.Cancel.
+func (s *Session) canceled(index uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.running[index]
+	return ok && run.canceled
+}
+
+// Cancel cancels the running invocation with the provided index (see
+// TaskName.InvIndex), without affecting the session's other
+// invocations. The invocation's context is canceled, which cancels the
+// runs of its tasks, including those on remote workers, and frees the
+// procs and machines that they hold; its call to Run returns an error
+// of kind errors.Canceled. Tasks that are shared with other invocations, e.g.,
+// through Result arguments, continue to run on their behalf. Cancel
+// returns an error of kind errors.NotExist if no such invocation is
+// running.
+func (s *Session) Cancel(index uint64) error {
+	s.mu.Lock()
+	run, ok := s.running[index]
+	if ok {
+		run.canceled = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return errors.E(errors.NotExist, fmt.Sprintf("invocation %d is not running", index))
+	}
+	log.Printf("%s: canceling invocation %d", run.location, index)
+	run.cancel()
+	return nil
+}
+
+// runningInvocations returns descriptions of the session's running
+// invocations, ordered by index.
+func (s *Session) runningInvocations() []SummaryInvocation {
+	s.mu.Lock()
+	invs := make([]SummaryInvocation, 0, len(s.running))
+	for index, run := range s.running {
+		invs = append(invs, SummaryInvocation{
+			Index:    index,
+			Location: run.location,
+			Start:    run.start,
+			Canceled: run.canceled,
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(invs, func(i, j int) bool { return invs[i].Index < invs[j].Index })
+	return invs
+}
+
+// CancelHeader is the header, with any value, that requests to the
+// session's /debug/cancel handler must carry. Browsers do not send
+// custom headers with cross-origin requests unless the server permits
+// them, which it does not, so the header guards the handler against
+// cross-site request forgery.
+const CancelHeader = "X-Bigslice-Cancel"
+
+// handleCancel cancels the invocation whose index is provided by the
+// "invocation" parameter of the (POST) request, which must carry
+// CancelHeader.
+func (s *Session) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "cancel requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get(CancelHeader) == "" {
+		http.Error(w, "cancel requires the "+CancelHeader+" header", http.StatusForbidden)
+		return
+	}
+	index, err := strconv.ParseUint(r.FormValue("invocation"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid invocation %q", r.FormValue("invocation")), http.StatusBadRequest)
+		return
+	}
+	if err := s.Cancel(index); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(errors.NotExist, err) {
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	fmt.Fprintf(w, "canceled invocation %d\n", index)
+}
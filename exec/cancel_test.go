@@ -0,0 +1,92 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+)
+
+func TestCancel(t *testing.T) {
+	var (
+		// started is signaled when the blocked task starts, and exited
+		// when it returns because its context was canceled.
+		started chan struct{}
+		exited  chan struct{}
+		release chan struct{}
+	)
+	blocked := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(1, []int{1})
+		return bigslice.Map(slice, func(ctx context.Context, i int) int {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				close(exited)
+			case <-release:
+			}
+			return i
+		})
+	})
+	ints := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Const(2, []int{1, 2, 3})
+	})
+	// The sessions are shut down, so they use their own test systems.
+	for name, opt := range map[string]func() Option{
+		"Local":           func() Option { return Local },
+		"Bigmachine.Test": func() Option { return Bigmachine(testsystem.New()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			started = make(chan struct{}, 1)
+			exited = make(chan struct{})
+			release = make(chan struct{})
+			defer close(release)
+			ctx := context.Background()
+			sess := Start(opt(), Parallelism(4))
+			defer sess.Shutdown()
+			if err := sess.Cancel(1); !errors.Is(errors.NotExist, err) {
+				t.Errorf("got %v, want NotExist", err)
+			}
+			errc := make(chan error)
+			go func() {
+				_, err := sess.Run(ctx, blocked)
+				errc <- err
+			}()
+			<-started
+			invs := sess.Summary().Invocations
+			if got, want := len(invs), 1; got != want {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+			// Other invocations are unaffected.
+			if _, err := sess.Run(ctx, ints); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.Cancel(invs[0].Index); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-errc:
+				if !errors.Is(errors.Canceled, err) {
+					t.Errorf("got %v, want Canceled", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("canceled invocation did not return")
+			}
+			// The blocked task itself is canceled.
+			select {
+			case <-exited:
+			case <-time.After(10 * time.Second):
+				t.Fatal("canceled task did not exit")
+			}
+			if got, want := len(sess.Summary().Invocations), 0; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/bloom"
+	"github.com/grailbio/bigslice/internal/slicecache"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// checkpointManifestName is the name of the file, within an invocation's
+// checkpoint directory, that records the set of checkpointed tasks.
+const checkpointManifestName = "MANIFEST"
+
+// checkpointManifest is the task-state manifest of a checkpointed
+// invocation. A task is listed in the manifest only once its output has
+// been completely written, so the manifest is always consistent with the
+// checkpointed data.
+type checkpointManifest struct {
+	// Location is the location of the invocation, for human consumption.
+	Location string
+	// Tasks maps the checkpoint key of each checkpointed task to its state.
+	Tasks map[string]string
+}
+
+// checkpointKey returns the key under which the output of the task named
+// n is checkpointed. Keys are independent of the invocation index, which
+// is not stable across driver processes.
+func checkpointKey(n TaskName) string {
+	op := strings.TrimPrefix(n.Op, fmt.Sprintf("inv%d_", n.InvIndex))
+	return fmt.Sprintf("%s-%04d-of-%04d", op, n.Shard, n.NumShard)
+}
+
+// checkpointFingerprint computes a fingerprint that identifies inv across
+// driver processes: it is derived from the invoked func's location and
+// index, and the invocation's arguments. Arguments that are results of
+// previous invocations are identified by the fingerprints of those
+// invocations, as recorded in results.
+func checkpointFingerprint(inv bigslice.Invocation, results map[uint64]string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "func %d", inv.Func)
+	if locs := bigslice.FuncLocations(); int(inv.Func) < len(locs) {
+		fmt.Fprintf(h, " %s", locs[inv.Func])
+	}
+	for i, arg := range inv.Args {
+		if result, ok := arg.(*Result); ok {
+			fp, ok := results[result.invIndex]
+			if !ok {
+				return "", fmt.Errorf("argument %d is a result of an invocation that was not checkpointed", i)
+			}
+			fmt.Fprintf(h, " result %s", fp)
+			continue
+		}
+		var b bytes.Buffer
+		if err := gob.NewEncoder(&b).Encode(arg); err != nil {
+			return "", fmt.Errorf("argument %d: %v", i, err)
+		}
+		fmt.Fprintf(h, " arg %d ", b.Len())
+		_, _ = h.Write(b.Bytes())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readCheckpointManifest reads the manifest in the checkpoint directory
+// dir. A missing manifest is treated as an empty one.
+func readCheckpointManifest(ctx context.Context, dir string) (checkpointManifest, error) {
+	m := checkpointManifest{Tasks: make(map[string]string)}
+	f, err := file.Open(ctx, file.Join(dir, checkpointManifestName))
+	if errors.Is(errors.NotExist, err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	defer f.Close(ctx) // nolint: errcheck
+	p, err := ioutil.ReadAll(f.Reader(ctx))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return m, errors.E(errors.Invalid, "corrupt checkpoint manifest", err)
+	}
+	if m.Tasks == nil {
+		m.Tasks = make(map[string]string)
+	}
+	return m, nil
+}
+
+// A checkpointer persists the outputs of completed tasks of an invocation,
+// together with a manifest of their states, so that a later run of the
+// same invocation can resume from them.
+type checkpointer struct {
+	// ctx is the context used for writing checkpoints.
+	ctx      context.Context
+	executor Executor
+	dir      string
+	// indexKeys indicates whether key index sidecars are written along
+	// with checkpointed outputs.
+	indexKeys bool
+
+	// key returns the key under which the output of a task is written,
+	// or "" if it should not be written.
+	key func(*Task) string
+	// manifested indicates whether the keys of the written outputs are
+	// recorded in a manifest.
+	manifested bool
+
+	mu       sync.Mutex
+	manifest checkpointManifest
+	// written is the set of tasks whose checkpointing has begun.
+	written map[*Task]bool
+
+	wg sync.WaitGroup
+}
+
+// newCheckpointer returns a checkpointer for the invocation inv, whose
+// checkpoints are stored under prefix. It populates inv's compilation
+// environment with the set of already-checkpointed tasks, so that these
+// are read from the checkpoint in lieu of being recomputed.
+func newCheckpointer(ctx context.Context, executor Executor, prefix string, inv *execInvocation, results map[uint64]string) (*checkpointer, string, error) {
+	fp, err := checkpointFingerprint(inv.Invocation, results)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := file.Join(prefix, fp)
+	manifest, err := readCheckpointManifest(ctx, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	manifest.Location = inv.Location
+	inv.Env.Checkpoint = dir
+	for key, state := range manifest.Tasks {
+		if state == TaskOk.String() {
+			inv.Env.Checkpointed[key] = true
+		}
+	}
+	return &checkpointer{
+		ctx:        ctx,
+		executor:   executor,
+		dir:        dir,
+		key:        func(task *Task) string { return checkpointKey(task.Name) },
+		manifested: true,
+		manifest:   manifest,
+		written:    make(map[*Task]bool),
+	}, fp, nil
+}
+
+// Watch checkpoints tasks as they complete. It returns when ctx is done;
+// checkpoints that are already being written are not interrupted.
+func (c *checkpointer) Watch(ctx context.Context, tasks []*Task) {
+	sub := NewTaskSubscriber()
+	_ = iterTasks(tasks, func(t *Task) error {
+		t.Subscribe(sub)
+		return nil
+	})
+	defer func() {
+		_ = iterTasks(tasks, func(t *Task) error {
+			t.Unsubscribe(sub)
+			return nil
+		})
+	}()
+	c.checkpointAll(tasks)
+	for {
+		select {
+		case <-sub.Ready():
+			for _, task := range sub.Tasks() {
+				if task.State() == TaskOk {
+					c.checkpoint(task)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Finish checkpoints any completed tasks that have not yet been
+// checkpointed, and waits for all pending checkpoints to be written.
+func (c *checkpointer) Finish(tasks []*Task) {
+	c.checkpointAll(tasks)
+	c.wg.Wait()
+}
+
+func (c *checkpointer) checkpointAll(tasks []*Task) {
+	_ = iterTasks(tasks, func(t *Task) error {
+		if t.State() == TaskOk {
+			c.checkpoint(t)
+		}
+		return nil
+	})
+}
+
+// checkpoint asynchronously writes the output of the (completed) task,
+// unless it has already been written. Failures to checkpoint are logged,
+// but do not otherwise affect evaluation.
+func (c *checkpointer) checkpoint(task *Task) {
+	key := c.key(task)
+	c.mu.Lock()
+	if key == "" || c.written[task] || c.manifest.Tasks[key] == TaskOk.String() || task.CombineKey != "" {
+		// Tasks that use machine combiners do not have individual outputs,
+		// so we cannot checkpoint them.
+		c.mu.Unlock()
+		return
+	}
+	c.written[task] = true
+	c.mu.Unlock()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if err := c.write(c.ctx, task, key); err != nil {
+			log.Error.Printf("checkpoint %s: %v", task, err)
+			c.mu.Lock()
+			delete(c.written, task)
+			c.mu.Unlock()
+		}
+	}()
+}
+
+// write writes the output of task, across all of its partitions, to the
+// checkpoint, and then records the task in the manifest, if any.
+func (c *checkpointer) write(ctx context.Context, task *Task, key string) (err error) {
+	f, err := file.Create(ctx, file.Join(c.dir, key))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Discard(ctx)
+		}
+	}()
+	var (
+		w     sliceio.Writer = sliceio.NewEncodingWriter(f.Writer(ctx))
+		buf                  = frame.Make(task, *defaultChunksize, *defaultChunksize)
+		index *bloom.Builder
+	)
+	if c.indexKeys {
+		index = new(bloom.Builder)
+		w = indexWriter{w, index}
+	}
+	for partition := 0; partition < task.NumPartition; partition++ {
+		r := c.executor.Reader(task, partition)
+		err = copyFrames(ctx, w, r, buf)
+		if closeErr := r.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = slicecache.WriteSchema(ctx, slicecache.SchemaPath(file.Join(c.dir, key)), slicecache.SchemaOf(task)); err != nil {
+		return err
+	}
+	if index != nil {
+		if err = slicecache.WriteIndex(ctx, slicecache.IndexPath(file.Join(c.dir, key)), index.Build()); err != nil {
+			return err
+		}
+	}
+	if err = f.Close(ctx); err != nil {
+		return err
+	}
+	if !c.manifested {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manifest.Tasks[key] = TaskOk.String()
+	return c.writeManifest(ctx)
+}
+
+// writeManifest writes the manifest to the checkpoint directory. It must
+// be called with c.mu held.
+func (c *checkpointer) writeManifest(ctx context.Context) error {
+	p, err := json.MarshalIndent(c.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := file.Create(ctx, file.Join(c.dir, checkpointManifestName))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Writer(ctx).Write(p); err != nil {
+		f.Discard(ctx)
+		return err
+	}
+	return f.Close(ctx)
+}
+
+// indexWriter is a sliceio.Writer that adds the keys of the frames
+// written through it to a key index.
+type indexWriter struct {
+	sliceio.Writer
+	index *bloom.Builder
+}
+
+func (w indexWriter) Write(ctx context.Context, f frame.Frame) error {
+	w.index.Add(f)
+	return w.Writer.Write(ctx, f)
+}
+
+// copyFrames copies all frames read from r to w, using buf as a buffer.
+func copyFrames(ctx context.Context, w sliceio.Writer, r sliceio.Reader, buf frame.Frame) error {
+	for {
+		n, err := r.Read(ctx, buf)
+		if err != nil && err != sliceio.EOF {
+			return err
+		}
+		if writeErr := w.Write(ctx, buf.Slice(0, n)); writeErr != nil {
+			return writeErr
+		}
+		if err == sliceio.EOF {
+			return nil
+		}
+	}
+}
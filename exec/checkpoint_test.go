@@ -0,0 +1,254 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/internal/slicecache"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestCheckpoint(t *testing.T) {
+	const (
+		Nshard = 4
+		N      = 100
+	)
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var nread, nmap int64
+	fn := bigslice.Func(func(k int) bigslice.Slice {
+		slice := bigslice.ReaderFunc(Nshard, func(shard int, state *int, out []int) (int, error) {
+			if *state == 0 {
+				atomic.AddInt64(&nread, 1)
+			}
+			beg, end := shardRange(N, Nshard, shard)
+			m := copy(out, rangeSlice(beg+*state, end))
+			*state += m
+			if beg+*state == end {
+				return m, sliceio.EOF
+			}
+			return m, nil
+		})
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			atomic.AddInt64(&nmap, 1)
+			return i % k, i
+		})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	run := func() []int {
+		t.Helper()
+		sess := Start(Local, Checkpoint(dir))
+		defer sess.Shutdown()
+		res, err := sess.Run(ctx, fn, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := res.Scanner()
+		defer scan.Close()
+		var (
+			sums []int
+			k, v int
+		)
+		for scan.Scan(ctx, &k, &v) {
+			sums = append(sums, v)
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(sums)
+		return sums
+	}
+	want := run()
+	if got, want := nread, int64(Nshard); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// A second run of the same invocation resumes from checkpoints, so
+	// nothing is recomputed.
+	if got := run(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nread, int64(Nshard); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Remove the checkpoint of the reduce tasks and one of the map tasks;
+	// only the corresponding tasks are recomputed.
+	var fp string
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(infos), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	fp = infos[0].Name()
+	manifest, err := readCheckpointManifest(ctx, dir+"/"+fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(manifest.Tasks), 2*Nshard; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for key := range manifest.Tasks {
+		if key == "reader_map-0001-of-0004" || key[:len("reduce")] == "reduce" {
+			delete(manifest.Tasks, key)
+		}
+	}
+	c := &checkpointer{dir: dir + "/" + fp, manifest: manifest}
+	if err := c.writeManifest(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nread, int64(Nshard+1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(N+N/Nshard); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCheckpointIndexKeys(t *testing.T) {
+	const (
+		Nshard = 4
+		N      = 100
+	)
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(Nshard, rangeSlice(0, N))
+		slice = bigslice.Map(slice, func(i int) (int, int) { return i % 10, i })
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	sess := Start(Local, Checkpoint(dir), CheckpointIndexKeys)
+	defer sess.Shutdown()
+	res, err := sess.Run(ctx, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(infos), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	ckptDir := file.Join(dir, infos[0].Name())
+	manifest, err := readCheckpointManifest(ctx, ckptDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var op string
+	for key := range manifest.Tasks {
+		if _, err := os.Stat(slicecache.IndexPath(file.Join(ckptDir, key))); err != nil {
+			t.Errorf("missing key index for %s: %v", key, err)
+		}
+		if strings.HasPrefix(key, "reduce") {
+			op = key[:len(key)-len("-0000-of-0004")]
+		}
+	}
+	if op == "" {
+		t.Fatalf("no reduce task in manifest %v", manifest.Tasks)
+	}
+
+	lookup := bigslice.ReadCacheKeys(ctx, res, Nshard, file.Join(ckptDir, op), []int{3})
+	res, err = sess.Run(ctx, bigslice.Func(func() bigslice.Slice { return lookup }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys, sums []int
+	if err := sliceio.ReadAll(ctx, res.open(), &keys, &sums); err != nil {
+		t.Fatal(err)
+	}
+	var want int
+	for i := 3; i < N; i += 10 {
+		want += i
+	}
+	if got, want := sums, []int{want}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCheckpointLineage(t *testing.T) {
+	const Nshard = 4
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	var nmap int64
+	step := bigslice.Func(func(state bigslice.Slice, i int) bigslice.Slice {
+		if state == nil {
+			state = bigslice.Const(Nshard, []int{1, 2, 3, 4, 5, 6, 7, 8})
+		}
+		state = bigslice.Map(state, func(x int) int {
+			atomic.AddInt64(&nmap, 1)
+			return x + 1
+		})
+		return bigslice.Checkpoint(ctx, state, file.Join(dir, "iter", fmt.Sprint(i)))
+	})
+	sess := Start(Local)
+	defer sess.Shutdown()
+	var state *Result
+	for i := 0; i < 3; i++ {
+		var arg bigslice.Slice
+		if state != nil {
+			arg = state
+		}
+		state, err = sess.Run(ctx, step, arg, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each invocation depends only on its own tasks, and not on the
+		// tasks of previous invocations.
+		_ = iterTasks(state.tasks, func(task *Task) error {
+			if task.Name.InvIndex != state.invIndex {
+				t.Errorf("iteration %d: task %s depends on previous invocation", i, task.Name)
+			}
+			return nil
+		})
+	}
+	if got, want := atomic.LoadInt64(&nmap), int64(3*8); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var vals []int
+	r := state.open()
+	defer r.Close()
+	if err := sliceio.ReadAll(ctx, r, &vals); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(vals)
+	if got, want := vals, []int{4, 5, 6, 7, 8, 9, 10, 11}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/sync/ctxsync"
+)
+
+// combinerStreamLimit is the maximum number of bytes that a
+// combinerStream buffers.
+var combinerStreamLimit = 4 << 20
+
+// A combinerStream tees the encoded output of a combiner partition
+// while it is being written to the store, so that it may be read
+// concurrently by consumers. Data are made available to readers as
+// they are written; readers observe the end of the stream only once
+// the partition has been committed.
+//
+// The stream's buffer is bounded by combinerStreamLimit. It retains
+// only the data that attached readers have yet to read, and, until
+// the limit is first reached, the head of the stream, so that readers
+// that attach as the commit starts need not wait for it. Readers that
+// fall behind the buffer (or attach after their data have been
+// dropped) wait for the commit and continue from the store.
+type combinerStream struct {
+	// open opens the committed partition at the provided offset,
+	// waiting for the commit to complete.
+	open func(ctx context.Context, offset int64) (io.ReadCloser, error)
+
+	mu   sync.Mutex
+	cond *ctxsync.Cond
+	// buf holds the stream's data from offset base.
+	buf  []byte
+	base int64
+	// head indicates whether the stream retains its head, i.e., no data
+	// have been dropped.
+	head    bool
+	readers map[*combinerStreamReader]bool
+	done    bool
+	err     error
+}
+
+func newCombinerStream(open func(ctx context.Context, offset int64) (io.ReadCloser, error)) *combinerStream {
+	s := &combinerStream{
+		open:    open,
+		head:    true,
+		readers: make(map[*combinerStreamReader]bool),
+	}
+	s.cond = ctxsync.NewCond(&s.mu)
+	return s
+}
+
+// Write implements io.Writer. Write never blocks: data that cannot be
+// buffered are dropped, to be read from the store.
+func (s *combinerStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	end := s.base + int64(len(s.buf))
+	if len(s.readers) == 0 && (!s.head || len(s.buf)+len(p) > combinerStreamLimit) {
+		// No reader is attached, so there is no need to tee.
+		s.head = false
+		s.buf = nil
+		s.base = end + int64(len(p))
+		return len(p), nil
+	}
+	s.buf = append(s.buf, p...)
+	s.trim()
+	s.cond.Broadcast()
+	return len(p), nil
+}
+
+// trim drops the buffered data that no reader needs, and then the
+// oldest data in excess of the limit. It must be called with s.mu held.
+func (s *combinerStream) trim() {
+	if len(s.readers) > 0 {
+		min := s.base + int64(len(s.buf))
+		for r := range s.readers {
+			if r.off < min {
+				min = r.off
+			}
+		}
+		if min > s.base {
+			s.drop(int(min - s.base))
+		}
+	}
+	if len(s.buf) > combinerStreamLimit {
+		s.drop(len(s.buf) - combinerStreamLimit)
+	}
+}
+
+// drop drops the first n buffered bytes. It must be called with s.mu
+// held.
+func (s *combinerStream) drop(n int) {
+	s.head = false
+	s.buf = s.buf[n:]
+	s.base += int64(n)
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+}
+
+// Close completes the stream. If err is non-nil, readers fail with
+// the error once they have consumed the data buffered so far.
+func (s *combinerStream) Close(err error) {
+	s.mu.Lock()
+	s.done = true
+	if err != nil {
+		s.err = errors.E("error while writing combiner", err)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Reader returns a reader of the stream, starting at the provided
+// byte offset. The reader must be closed.
+func (s *combinerStream) Reader(ctx context.Context, offset int64) io.ReadCloser {
+	r := &combinerStreamReader{ctx: ctx, stream: s, off: offset}
+	s.mu.Lock()
+	s.readers[r] = true
+	s.mu.Unlock()
+	return r
+}
+
+type combinerStreamReader struct {
+	ctx    context.Context
+	stream *combinerStream
+	off    int64
+	// rc reads the committed partition, once the reader has fallen
+	// behind the stream's buffer.
+	rc io.ReadCloser
+}
+
+// Read implements io.Reader. It blocks until data are available at
+// the reader's offset, or until the stream is closed.
+func (r *combinerStreamReader) Read(p []byte) (int, error) {
+	if r.rc != nil {
+		n, err := r.rc.Read(p)
+		r.off += int64(n)
+		return n, err
+	}
+	s := r.stream
+	s.mu.Lock()
+	for {
+		switch end := s.base + int64(len(s.buf)); {
+		case r.off < s.base && s.err == nil:
+			// The reader's data have been dropped.
+			delete(s.readers, r)
+			s.mu.Unlock()
+			var err error
+			if r.rc, err = s.open(r.ctx, r.off); err != nil {
+				return 0, err
+			}
+			return r.Read(p)
+		case r.off >= s.base && r.off < end:
+			n := copy(p, s.buf[r.off-s.base:])
+			r.off += int64(n)
+			s.trim()
+			s.mu.Unlock()
+			return n, nil
+		case s.done:
+			err := s.err
+			s.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if err := s.cond.Wait(r.ctx); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+	}
+}
+
+// Close implements io.Closer.
+func (r *combinerStreamReader) Close() error {
+	s := r.stream
+	s.mu.Lock()
+	delete(s.readers, r)
+	s.mu.Unlock()
+	if r.rc != nil {
+		return r.rc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinerStream(t *testing.T) {
+	ctx := context.Background()
+	s := newCombinerStream(nil)
+	if _, err := s.Write([]byte("hello, ")); err != nil {
+		t.Fatal(err)
+	}
+	r := s.Reader(ctx, 0)
+	p := make([]byte, 64)
+	n, err := r.Read(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(p[:n]), "hello, "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Readers block until more data are written.
+	readc := make(chan []byte)
+	go func() {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		readc <- b
+	}()
+	select {
+	case <-readc:
+		t.Fatal("read completed before stream was closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if _, err := s.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close(nil)
+	if got, want := string(<-readc), "world"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCombinerStreamBounded tests that the stream buffers at most
+// combinerStreamLimit bytes, and that readers whose data have been
+// dropped continue from the committed partition.
+func TestCombinerStreamBounded(t *testing.T) {
+	save := combinerStreamLimit
+	combinerStreamLimit = 4
+	defer func() { combinerStreamLimit = save }()
+	const data = "abcdefghijklmnopqrstuvwxyz"
+	var (
+		ctx    = context.Background()
+		opened = make(chan int64, 2)
+		s      = newCombinerStream(func(_ context.Context, offset int64) (io.ReadCloser, error) {
+			opened <- offset
+			return ioutil.NopCloser(strings.NewReader(data[offset:])), nil
+		})
+	)
+	// The head of the stream is retained until the limit is reached.
+	if _, err := s.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	early := s.Reader(ctx, 0)
+	p := make([]byte, 2)
+	if n, err := early.Read(p); err != nil || string(p[:n]) != "ab" {
+		t.Fatalf("got %q, %v, want %q", p[:n], err, "ab")
+	}
+	// The early reader has read past offset 2, so only its unread byte
+	// and the bytes written since are retained; bytes in excess of the
+	// limit are dropped.
+	if _, err := s.Write([]byte("defghi")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(s.buf), combinerStreamLimit; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// A reader that attaches after its data were dropped continues
+	// from the committed partition.
+	late := s.Reader(ctx, 0)
+	if _, err := s.Write([]byte(data[9:])); err != nil {
+		t.Fatal(err)
+	}
+	s.Close(nil)
+	for _, r := range []struct {
+		rc   io.ReadCloser
+		want string
+	}{{early, data[2:]}, {late, data}} {
+		b, err := ioutil.ReadAll(r.rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), r.want; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if got, want := <-opened, int64(2); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := <-opened, int64(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(s.readers) != 0 {
+		t.Errorf("got %d attached readers, want 0", len(s.readers))
+	}
+}
+
+// TestCombinerStreamDetached tests that the stream does not buffer its
+// data once they exceed the limit while no reader is attached.
+func TestCombinerStreamDetached(t *testing.T) {
+	save := combinerStreamLimit
+	combinerStreamLimit = 4
+	defer func() { combinerStreamLimit = save }()
+	s := newCombinerStream(nil)
+	for i := 0; i < 10; i++ {
+		if _, err := s.Write([]byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.buf != nil {
+		t.Errorf("got %q, want no buffered data", s.buf)
+	}
+	if got, want := s.base, int64(30); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCombinerStreamError(t *testing.T) {
+	ctx := context.Background()
+	s := newCombinerStream(nil)
+	if _, err := s.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close(errors.New("write failed"))
+	r := s.Reader(ctx, 0)
+	p := make([]byte, 64)
+	n, err := r.Read(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(p[:n]), "partial"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := r.Read(p); err == nil || err == io.EOF {
+		t.Errorf("got %v, want error", err)
+	}
+}
+
+func TestCombinerStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newCombinerStream(nil)
+	r := s.Reader(ctx, 0)
+	cancel()
+	if _, err := r.Read(make([]byte, 1)); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
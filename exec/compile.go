@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/grailbio/base/file"
 	"github.com/grailbio/base/log"
 	"github.com/grailbio/bigslice"
 	"github.com/grailbio/bigslice/frame"
 	"github.com/grailbio/bigslice/internal/slicecache"
 	"github.com/grailbio/bigslice/slicefunc"
 	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/sortio"
 )
 
 func defaultPartitioner(_ context.Context, frame frame.Frame, nshard int, shards []int) {
@@ -26,6 +28,9 @@ func defaultPartitioner(_ context.Context, frame frame.Frame, nshard int, shards
 // Pipeline returns the sequence of slices that may be pipelined
 // starting from slice. Slices that do not have shuffle dependencies
 // may be pipelined together: slices[0] depends on slices[1], and so on.
+// Broadcast dependencies do not prevent pipelining; they are read
+// separately by the pipeline's tasks. Shard coalescers end pipelines,
+// as their shards read ranges of their dependency's shards.
 func pipeline(slice bigslice.Slice) (slices []bigslice.Slice) {
 	for {
 		// Stop at *Results, so we can re-use previous tasks.
@@ -33,10 +38,14 @@ func pipeline(slice bigslice.Slice) (slices []bigslice.Slice) {
 			return
 		}
 		slices = append(slices, slice)
-		if slice.NumDep() != 1 {
+		if _, ok := bigslice.Unwrap(slice).(bigslice.ShardCoalescer); ok {
 			return
 		}
-		dep := slice.Dep(0)
+		i, ok := pipelineDep(slice)
+		if !ok {
+			return
+		}
+		dep := slice.Dep(i)
 		if dep.Shuffle {
 			return
 		}
@@ -47,6 +56,31 @@ func pipeline(slice bigslice.Slice) (slices []bigslice.Slice) {
 	}
 }
 
+// depColumns returns the columns of the dependencies of the last of
+// the provided pipelined slices that are used by the pipeline, or nil
+// if all of them are, as determined by propagating column usage from
+// the pipeline's output through slices that implement
+// bigslice.ColumnUser.
+func depColumns(slices []bigslice.Slice) []bool {
+	used := make([]bool, slices[0].NumOut())
+	for i := range used {
+		used[i] = true
+	}
+	for _, slice := range slices {
+		user, ok := slice.(bigslice.ColumnUser)
+		if !ok || slice.NumDep() != 1 {
+			return nil
+		}
+		used = user.DepColumns(used)
+	}
+	for _, ok := range used {
+		if !ok {
+			return used
+		}
+	}
+	return nil
+}
+
 // memoKey is the memo key for memoized slice compilations.
 type memoKey struct {
 	slice bigslice.Slice
@@ -109,17 +143,21 @@ func (p partitioner) NumPartition() int {
 // all other slices must be derived. This simplifies the
 // implementation but may make the API a little confusing.
 func compile(inv execInvocation, slice bigslice.Slice, machineCombiners bool) (tasks []*Task, err error) {
-	c := compiler{
+	return newCompiler(inv, machineCombiners).compile(slice, partitioner{})
+}
+
+// newCompiler returns a compiler for the invocation inv. Top-level
+// compilation (i.e., compiler.compile(slice, partitioner{})) always
+// produces tasks that write single partitions, as they are materialized
+// and will not be used as direct shuffle dependencies.
+func newCompiler(inv execInvocation, machineCombiners bool) *compiler {
+	return &compiler{
 		namer:            make(taskNamer),
 		inv:              inv,
 		machineCombiners: machineCombiners,
 		memo:             make(map[memoKey][]*Task),
+		persists:         make(map[string]persistedTasks),
 	}
-	// Top-level compilation always produces tasks that write single partitions,
-	// as they are materialized and will not be used as direct shuffle
-	// dependencies.
-	tasks, err = c.compile(slice, partitioner{})
-	return
 }
 
 // CompileEnv is the environment for compilation. This environment should
@@ -136,14 +174,69 @@ type CompileEnv struct {
 	// TaskCached indicates whether a task's results can be read from cache. It
 	// is only exported so that it can be gob-{en,dec}oded.
 	TaskCached map[TaskName]bool
+
+	// SmallJoinRows is the maximum number of rows in a join dependency
+	// that is collapsed into a lookup, or zero if none are. See
+	// SmallJoinRows. It is only exported so that it can be
+	// gob-{en,dec}oded.
+	SmallJoinRows int
+
+	// Checkpoint is the directory in which task outputs of the invocation
+	// are checkpointed, if checkpointing is enabled. It is only exported so
+	// that it can be gob-{en,dec}oded.
+	Checkpoint string
+
+	// AggregationFanIn is the maximum number of combiner outputs that
+	// are read by a single task, or zero if unlimited. See
+	// AggregationFanIn. It is only exported so that it can be
+	// gob-{en,dec}oded.
+	AggregationFanIn int
+
+	// Checkpointed indicates, by checkpoint key, whether a task's results
+	// can be read from its checkpoint. It is only exported so that it can
+	// be gob-{en,dec}oded.
+	Checkpointed map[string]bool
+
+	// Snapshots holds the resolved snapshot of each snapshot group that
+	// is read by the invocation. See bigslice.Snapshot. It is only
+	// exported so that it can be gob-{en,dec}oded.
+	Snapshots map[string]string
+
+	// Persisted holds, by key, the tasks of previous invocations that
+	// computed the persisted slices that are read by the invocation. See
+	// bigslice.Persist. It is only exported so that it can be
+	// gob-{en,dec}oded.
+	Persisted map[string]persistRef
+
+	// PersistPrefix is the prefix under which the outputs of slices that
+	// are persisted in the shared store are written, or empty if there
+	// is none. It is only exported so that it can be gob-{en,dec}oded.
+	PersistPrefix string
+
+	// Reused maps the names of the invocation's tasks that are not
+	// recomputed to the names of the completed tasks of a previous run
+	// of a resident invocation that are used in their stead. See
+	// Resident. It is only exported so that it can be gob-{en,dec}oded.
+	Reused map[TaskName]TaskName
+
+	// ResultCached holds the paths of the outputs, in the session's
+	// result cache, of the tasks that read them instead of computing
+	// them. See ResultCache. It is only exported so that it can be
+	// gob-{en,dec}oded.
+	ResultCached map[TaskName]string
 }
 
 // makeCompileEnv returns an empty and writable CompileEnv that can be passed to
 // compile.
 func makeCompileEnv() CompileEnv {
 	return CompileEnv{
-		Writable:   true,
-		TaskCached: make(map[TaskName]bool),
+		Writable:     true,
+		TaskCached:   make(map[TaskName]bool),
+		Checkpointed: make(map[string]bool),
+		Snapshots:    make(map[string]string),
+		Persisted:    make(map[string]persistRef),
+		Reused:       make(map[TaskName]TaskName),
+		ResultCached: make(map[TaskName]string),
 	}
 }
 
@@ -175,6 +268,9 @@ type compiler struct {
 	inv              execInvocation
 	machineCombiners bool
 	memo             map[memoKey][]*Task
+	// persists holds, by key, the tasks of the persisted slices that are
+	// computed by the invocation.
+	persists map[string]persistedTasks
 }
 
 // compile compiles the provided slice into a set of task graphs, memoizing the
@@ -211,41 +307,78 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 	}()
 	// Reuse tasks from a previous invocation.
 	if result, ok := bigslice.Unwrap(slice).(*Result); ok {
-		for _, task := range result.tasks {
-			if !task.Combiner.IsNil() {
-				// TODO(marius): we may consider supporting this, but it should
-				// be very rare, since it requires the user to explicitly reuse
-				// an intermediate slice, which is impossible via the current
-				// API.
-				return nil, fmt.Errorf("cannot reuse task %s with combine key %s", task, task.CombineKey)
-			}
+		// Checkpointed results are read from their stored outputs, so
+		// that the tasks that compute them, and thus their lineage, are
+		// not depended upon.
+		if checkpointer, ok := bigslice.Unwrap(result.Slice).(bigslice.Checkpointer); ok {
+			return c.compileSlice(checkpointer.Checkpointed(), part)
 		}
-		if !part.IsShuffle() {
-			tasks = result.tasks
-			return
+		return c.reuse(slice, result.tasks, part)
+	}
+	// Persisted slices are computed once, into single partitions, and
+	// their tasks are reused by the slices that read them.
+	if persister, ok := bigslice.Unwrap(slice).(bigslice.Persister); ok {
+		persisted, err := c.persist(slice, persister)
+		if err != nil {
+			return nil, err
 		}
-		// We now insert a set of tasks whose only purpose is (re-)shuffling
-		// the output from the previously completed task.
-		shuffleOpName := c.namer.New(fmt.Sprintf("%s_shuffle", result.tasks[0].Name.Op))
-		tasks = make([]*Task, len(result.tasks))
-		for shard, task := range result.tasks {
-			tasks[shard] = &Task{
-				Type:       slice,
-				Invocation: c.inv,
-				Name: TaskName{
-					InvIndex: c.inv.Index,
-					Op:       shuffleOpName,
-					Shard:    shard,
-					NumShard: len(result.tasks),
-				},
-				Do:     func(readers []sliceio.Reader) sliceio.Reader { return readers[0] },
-				Deps:   []TaskDep{{task, 0, false, ""}},
-				Pragma: task.Pragma,
-				Slices: task.Slices,
-			}
+		return c.reuse(slice, persisted, part)
+	}
+	if tasks, err = c.compileSlice(slice, part); err != nil {
+		return nil, err
+	}
+	return c.reuseCompleted(tasks, part)
+}
+
+// reuse returns the tasks through which the provided slice, which is
+// computed by the provided tasks (e.g., of a previous invocation), is
+// read with the provided partitioning.
+func (c *compiler) reuse(slice bigslice.Slice, prev []*Task, part partitioner) (tasks []*Task, err error) {
+	for _, task := range prev {
+		if !task.Combiner.IsNil() {
+			// TODO(marius): we may consider supporting this, but it should
+			// be very rare, since it requires the user to explicitly reuse
+			// an intermediate slice, which is impossible via the current
+			// API.
+			return nil, fmt.Errorf("cannot reuse task %s with combine key %s", task, task.CombineKey)
 		}
-		return
 	}
+	if !part.IsShuffle() {
+		return prev, nil
+	}
+	// We now insert a set of tasks whose only purpose is (re-)shuffling
+	// the output from the previously completed task.
+	shuffleOpName := c.namer.New(fmt.Sprintf("%s_shuffle", prev[0].Name.Op))
+	tasks = make([]*Task, len(prev))
+	for shard, task := range prev {
+		tasks[shard] = &Task{
+			Type:       slice,
+			Invocation: c.inv,
+			Name: TaskName{
+				InvIndex: c.inv.Index,
+				Op:       shuffleOpName,
+				Shard:    shard,
+				NumShard: len(prev),
+			},
+			Do:           func(readers []sliceio.Reader) sliceio.Reader { return readers[0] },
+			Deps:         []TaskDep{{Head: task}},
+			Pragma:       task.Pragma,
+			Slices:       task.Slices,
+			NumPartition: part.NumPartition(),
+			Partitioner:  part.Partitioner(),
+			Combiner:     part.Combiner,
+			CombineKey:   part.CombineKey,
+		}
+		if c.inv.completed != nil || c.inv.cachedResults != nil {
+			tasks[shard].lineage = c.reshuffleLineage(tasks[shard], task)
+		}
+	}
+	return tasks, nil
+}
+
+// compileSlice compiles the provided slice, which is not computed by
+// previous tasks, pipelining it with its eligible dependencies.
+func (c *compiler) compileSlice(slice bigslice.Slice, part partitioner) (tasks []*Task, err error) {
 	// Pipeline slices and create a task for each underlying shard, pipelining
 	// the eligible computations.
 	slices := pipeline(slice)
@@ -281,12 +414,56 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 			Combiner:     part.Combiner,
 			CombineKey:   part.CombineKey,
 		}
+		if limiter, ok := slices[0].(bigslice.Limiter); ok && part.IsShuffle() {
+			tasks[i].Limit = limiter.Limit()
+		}
 	}
 	// Capture the dependencies for this task set; they are encoded in the last
 	// slice.
 	lastSlice := slices[len(slices)-1]
-	for i := 0; i < lastSlice.NumDep(); i++ {
+	cols := depColumns(slices)
+	// The dependencies of shard mappers are mapped to their shards
+	// individually.
+	numDep := lastSlice.NumDep()
+	// Small dependencies of joins are collapsed into lookups that are
+	// computed within the tasks themselves.
+	lookups := lookupDeps(lastSlice, c.inv.Env.SmallJoinRows)
+	if lookups != nil {
+		names := lookupNames(lookups)
+		for _, task := range tasks {
+			task.Lookups = names
+		}
+		if c.inv.Env.IsWritable() {
+			log.Printf("%s: collapsed small join dependencies %v into lookups", opName, names)
+		}
+	}
+	if mapper, ok := bigslice.Unwrap(lastSlice).(bigslice.ShardMapper); ok {
+		if err := c.mapDeps(tasks, lastSlice, mapper, cols); err != nil {
+			return nil, err
+		}
+		numDep = 0
+	}
+	if coalescer, ok := bigslice.Unwrap(lastSlice).(bigslice.ShardCoalescer); ok {
+		if err := c.coalesceDeps(tasks, lastSlice, coalescer, cols); err != nil {
+			return nil, err
+		}
+		numDep = 0
+	}
+	for i := 0; i < numDep; i++ {
 		dep := lastSlice.Dep(i)
+		if lookups != nil && lookups[i] != nil {
+			continue
+		}
+		if dep.Broadcast {
+			bcastDep, err := c.broadcastDep(dep.Slice)
+			if err != nil {
+				return nil, err
+			}
+			for _, task := range tasks {
+				task.Deps = append(task.Deps, bcastDep)
+			}
+			continue
+		}
 		if !dep.Shuffle {
 			depTasks, err := c.compile(dep.Slice, partitioner{})
 			if err != nil {
@@ -297,7 +474,7 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 			}
 			for shard := range tasks {
 				tasks[shard].Deps = append(tasks[shard].Deps,
-					TaskDep{depTasks[shard], 0, dep.Expand, ""})
+					TaskDep{Head: depTasks[shard], Expand: dep.Expand, Columns: cols})
 			}
 			continue
 		}
@@ -313,10 +490,42 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 		if err != nil {
 			return nil, err
 		}
-		// Each shard reads different partitions from all of the previous slice's shards.
+		// Each shard reads different partitions from all of the previous
+		// slice's shards, unless they are aggregated in a tree.
+		fanIn := c.inv.Env.AggregationFanIn
+		if fanIn > 0 && len(depTasks) > fanIn && combineKey == "" && dep.Expand && !lastSlice.Combiner().IsNil() {
+			for partition, aggDep := range c.aggregate(depTasks, len(tasks), fanIn, lastSlice.Combiner()) {
+				tasks[partition].Deps = append(tasks[partition].Deps, aggDep)
+			}
+			continue
+		}
 		for partition := range tasks {
 			tasks[partition].Deps = append(tasks[partition].Deps,
-				TaskDep{depTasks[0], partition, dep.Expand, combineKey})
+				TaskDep{Head: depTasks[0], Partition: partition, Expand: dep.Expand, CombineKey: combineKey, Columns: cols})
+		}
+	}
+	// Broadcast dependencies of the other pipelined slices are read
+	// after those of the last slice. bcastOffsets holds, for each
+	// slice, the offset of its first broadcast reader among them.
+	var (
+		bcastOffsets = make([]int, len(slices))
+		numBcast     int
+	)
+	for i := len(slices) - 2; i >= 0; i-- {
+		bcastOffsets[i] = numBcast
+		for j := 0; j < slices[i].NumDep(); j++ {
+			dep := slices[i].Dep(j)
+			if !dep.Broadcast {
+				continue
+			}
+			bcastDep, err := c.broadcastDep(dep.Slice)
+			if err != nil {
+				return nil, err
+			}
+			for _, task := range tasks {
+				task.Deps = append(task.Deps, bcastDep)
+			}
+			numBcast++
 		}
 	}
 	// Pipeline execution, folding multiple frame operations
@@ -331,6 +540,20 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 		if c, ok := bigslice.Unwrap(slices[i]).(slicecache.Cacheable); ok {
 			shardCache = c.Cache()
 		}
+		if p, ok := bigslice.Unwrap(slices[i]).(bigslice.Persister); ok {
+			shardCache = c.persistCache(slices[i], p)
+		}
+		if i == len(slices)-1 && lookups != nil {
+			reader = lookupDepReaders(reader, lastSlice, lookups)
+		}
+		if s, ok := slices[i].(bigslice.Snapshotter); ok {
+			group := s.SnapshotGroup()
+			snapshot, ok := c.inv.Env.Snapshots[group]
+			if !ok {
+				return nil, fmt.Errorf("slice %s: snapshot of group %s is not resolved", slices[i].Name(), group)
+			}
+			reader = snapshotReaderFunc(reader, group, snapshot)
+		}
 		if c.inv.Env.IsWritable() {
 			for shard := range tasks {
 				if shardCache.IsCached(shard) {
@@ -338,6 +561,10 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 				}
 			}
 		}
+		var (
+			slice       = slices[i]
+			bcastOffset = bcastOffsets[i]
+		)
 		for shard := range tasks {
 			var (
 				shard = shard
@@ -356,23 +583,114 @@ func (c *compiler) compile(slice bigslice.Slice, part partitioner) (tasks []*Tas
 			if prev == nil {
 				// First, read the input directly.
 				tasks[shard].Do = func(readers []sliceio.Reader) sliceio.Reader {
-					r := reader(shard, readers)
+					r := reader(shard, readers[:len(readers)-numBcast])
 					r = shardCache.WritethroughReader(shard, r)
 					return &sliceio.PprofReader{Reader: r, Label: pprofLabel}
 				}
 			} else {
 				// Subsequently, read the previous pipelined slice's output.
 				tasks[shard].Do = func(readers []sliceio.Reader) sliceio.Reader {
-					r := reader(shard, []sliceio.Reader{prev(readers)})
+					bcast := readers[len(readers)-numBcast+bcastOffset:]
+					r := reader(shard, depReaders(slice, prev(readers), bcast))
 					r = shardCache.WritethroughReader(shard, r)
 					return &sliceio.PprofReader{Reader: r, Label: pprofLabel}
 				}
 			}
 		}
 	}
+	// Read checkpointed tasks from their checkpoints instead of recomputing
+	// them.
+	if dir := c.inv.Env.Checkpoint; dir != "" {
+		for _, task := range tasks {
+			key := checkpointKey(task.Name)
+			if !c.inv.Env.Checkpointed[key] {
+				continue
+			}
+			var (
+				path = file.Join(dir, key)
+				typ  = task.Type
+			)
+			task.Do = func([]sliceio.Reader) sliceio.Reader {
+				return slicecache.NewCheckedFileReader(path, typ)
+			}
+			task.Deps = nil
+		}
+	}
+	// Compute the lineage of tasks of resident invocations, so that
+	// later runs may reuse them, and of invocations whose results are
+	// cached, by which their outputs are keyed.
+	if c.inv.completed != nil || c.inv.cachedResults != nil {
+		for _, task := range tasks {
+			task.lineage = c.lineage(task, slices, part)
+		}
+	}
+	// Read tasks whose outputs are in the result cache from the cache
+	// instead of recomputing them.
+	for _, task := range tasks {
+		if c.inv.Env.IsWritable() && task.lineage != "" && c.inv.cachedResults[task.lineage] {
+			c.inv.Env.ResultCached[task.Name] = file.Join(c.inv.resultCache, task.lineage)
+		}
+		path, ok := c.inv.Env.ResultCached[task.Name]
+		if !ok {
+			continue
+		}
+		typ := task.Type
+		task.Do = func([]sliceio.Reader) sliceio.Reader {
+			return slicecache.NewCheckedFileReader(path, typ)
+		}
+		task.Deps = nil
+	}
 	return
 }
 
+// mapDeps compiles the dependencies of the shard mapper slice, and
+// adds to each of the provided tasks, which compute the slice's shards,
+// a dependency on the dependency task of the shard to which it is
+// mapped.
+func (c *compiler) mapDeps(tasks []*Task, slice bigslice.Slice, mapper bigslice.ShardMapper, cols []bool) error {
+	depTasks := make([][]*Task, slice.NumDep())
+	for i := range depTasks {
+		dep := slice.Dep(i)
+		if dep.Shuffle {
+			return fmt.Errorf("slice %s: shard mappers cannot have shuffle dependencies", slice.Name())
+		}
+		var err error
+		if depTasks[i], err = c.compile(dep.Slice, partitioner{}); err != nil {
+			return err
+		}
+	}
+	for shard, task := range tasks {
+		dep, depShard := mapper.DepShard(shard)
+		task.Deps = append(task.Deps, TaskDep{Head: depTasks[dep][depShard], Columns: cols})
+	}
+	return nil
+}
+
+// coalesceDeps compiles the dependency of the shard coalescer slice,
+// and adds to each of the provided tasks, which compute the slice's
+// shards, a dependency on the range of dependency tasks that it
+// coalesces. The dependency is compiled into a phase of tasks that
+// each write a single partition, so that ranges of the phase may be
+// read without repartitioning it.
+func (c *compiler) coalesceDeps(tasks []*Task, slice bigslice.Slice, coalescer bigslice.ShardCoalescer, cols []bool) error {
+	if slice.NumDep() != 1 || slice.Dep(0).Shuffle {
+		return fmt.Errorf("slice %s: shard coalescers must have a single, non-shuffle dependency", slice.Name())
+	}
+	depTasks, err := c.compile(slice.Dep(0).Slice, partitioner{numPartition: 1})
+	if err != nil {
+		return err
+	}
+	for shard, task := range tasks {
+		start, end := coalescer.DepShards(shard)
+		if start >= end || end > len(depTasks) {
+			return fmt.Errorf("slice %s: shard %d coalesces invalid range [%d, %d) of %d shards",
+				slice.Name(), shard, start, end, len(depTasks))
+		}
+		task.Deps = append(task.Deps, TaskDep{Head: depTasks[0], Offset: start, Count: end - start, Columns: cols})
+	}
+	return nil
+}
+
 type taskNamer map[string]int
 
 func (n taskNamer) New(name string) string {
@@ -383,3 +701,63 @@ func (n taskNamer) New(name string) string {
 	}
 	return fmt.Sprintf("%s%d", name, c)
 }
+
+// aggregate inserts levels of intermediate aggregation tasks between
+// the combiner tasks depTasks, whose outputs have numPartition
+// partitions, and the tasks that read and reduce them, so that no task
+// reads more than fanIn of their outputs. Each aggregation task reduces
+// one partition of up to fanIn tasks of the level below it into a
+// single sorted and combined output. Aggregate returns, for each
+// partition, the dependency through which it is read from the top
+// level.
+func (c *compiler) aggregate(depTasks []*Task, numPartition, fanIn int, combiner slicefunc.Func) []TaskDep {
+	deps := make([]TaskDep, numPartition)
+	for partition := range deps {
+		deps[partition] = TaskDep{Head: depTasks[0], Partition: partition, Expand: true}
+	}
+	typ := depTasks[0].Type
+	for level, n := 1, len(depTasks); n > fanIn; level++ {
+		var (
+			m      = (n + fanIn - 1) / fanIn
+			opName = c.namer.New(fmt.Sprintf("%s_agg%d", depTasks[0].Name.Op, level))
+			tasks  = make([]*Task, numPartition*m)
+		)
+		for partition, dep := range deps {
+			for j := 0; j < m; j++ {
+				shard := partition*m + j
+				aggDep := dep
+				aggDep.Offset = dep.Offset + j*fanIn
+				aggDep.Count = min(fanIn, n-j*fanIn)
+				name := fmt.Sprintf("%s-%d", opName, shard)
+				tasks[shard] = &Task{
+					Type: typ,
+					Name: TaskName{
+						InvIndex: c.inv.Index,
+						Op:       opName,
+						Shard:    shard,
+						NumShard: len(tasks),
+					},
+					Invocation:   c.inv,
+					Pragma:       bigslice.Pragmas(nil),
+					NumPartition: 1,
+					Partitioner:  defaultPartitioner,
+					Do: func(readers []sliceio.Reader) sliceio.Reader {
+						if len(readers) == 1 {
+							return readers[0]
+						}
+						return sortio.Reduce(typ, name, readers, combiner)
+					},
+					Deps: []TaskDep{aggDep},
+				}
+			}
+		}
+		for _, task := range tasks {
+			task.Group = tasks
+		}
+		for partition := range deps {
+			deps[partition] = TaskDep{Head: tasks[0], Expand: true, Offset: partition * m, Count: m}
+		}
+		n = m
+	}
+	return deps
+}
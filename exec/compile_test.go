@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -408,3 +409,262 @@ func (c *fakeCacheSlice) Cache() slicecache.ShardCache
 func fakeCache(slice bigslice.Slice, shardIsCached []bool) bigslice.Slice {
 	return &fakeCacheSlice{bigslice.MakeName("testcache"), slice, fakeShardCache{shardIsCached}}
 }
+
+func TestCompileAggregationTree(t *testing.T) {
+	f := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(10, []int{}, []int{})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	inv := makeExecInvocation(f.Invocation("<unknown>"))
+	inv.Env.AggregationFanIn = 3
+	tasks, err := compile(inv, inv.Invoke(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tasks), 10; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// 10 combiner tasks are aggregated by 4, then 2, tasks per partition.
+	for partition, task := range tasks {
+		if got, want := len(task.Deps), 1; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		dep := task.Deps[0]
+		if got, want := dep.NumTask(), 2; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		var (
+			counts = make(map[int]int)
+			seen   = make(map[*Task]bool)
+		)
+		for i := 0; i < dep.NumTask(); i++ {
+			agg := dep.Task(i)
+			if got, want := agg.Name.NumShard, 10*2; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := agg.Deps[0].NumTask(), []int{3, 1}[i]; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			for j := 0; j < agg.Deps[0].NumTask(); j++ {
+				agg1 := agg.Deps[0].Task(j)
+				if got, want := agg1.Name.NumShard, 10*4; got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				for k := 0; k < agg1.Deps[0].NumTask(); k++ {
+					combiner := agg1.Deps[0].Task(k)
+					if combiner.Combiner.IsNil() {
+						t.Errorf("task %v is not a combiner", combiner)
+					}
+					if seen[combiner] {
+						t.Errorf("task %v read twice", combiner)
+					}
+					seen[combiner] = true
+					counts[agg1.Deps[0].Partition]++
+				}
+			}
+		}
+		if got, want := counts, map[int]int{partition: 10}; !reflect.DeepEqual(got, want) {
+			t.Errorf("partition %d: got %v, want %v", partition, got, want)
+		}
+	}
+}
+
+func TestCompileDepColumns(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		f    func() bigslice.Slice
+		want []bool
+	}{
+		{
+			"select",
+			func() bigslice.Slice {
+				slice := bigslice.Const(3, []int{}, []string{}, []float64{})
+				slice = bigslice.Reshuffle(slice)
+				return bigslice.SelectColumns(slice, 2, 0)
+			},
+			[]bool{true, false, true},
+		},
+		{
+			"cast-add",
+			func() bigslice.Slice {
+				slice := bigslice.Const(3, []int{}, []string{}, []int32{})
+				slice = bigslice.Reshard(slice, 2)
+				slice = bigslice.CastColumn(slice, 2, reflect.TypeOf(int64(0)))
+				slice = bigslice.AddConstantColumn(slice, "x")
+				return bigslice.SelectColumns(slice, 0, 3)
+			},
+			[]bool{true, false, false},
+		},
+		{
+			"all",
+			func() bigslice.Slice {
+				slice := bigslice.Const(3, []int{}, []string{})
+				slice = bigslice.Reshuffle(slice)
+				return bigslice.SelectColumns(slice, 1, 0)
+			},
+			nil,
+		},
+		{
+			"map",
+			func() bigslice.Slice {
+				slice := bigslice.Const(3, []int{}, []string{})
+				slice = bigslice.Reshuffle(slice)
+				slice = bigslice.Map(slice, func(i int, s string) int { return i })
+				return bigslice.SelectColumns(slice, 0)
+			},
+			nil,
+		},
+		{
+			// Slices that do not declare their column usage use all columns.
+			"opaque",
+			func() bigslice.Slice {
+				slice := bigslice.Const(3, []int{}, []string{})
+				slice = fakeCache(bigslice.Reshuffle(slice), []bool{false, false, false})
+				return bigslice.SelectColumns(slice, 0)
+			},
+			nil,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			inv := makeExecInvocation(bigslice.Func(c.f).Invocation("<unknown>"))
+			tasks, err := compile(inv, inv.Invoke(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range tasks {
+				if got, want := len(task.Deps), 1; got != want {
+					t.Fatalf("got %v, want %v", got, want)
+				}
+				if got, want := task.Deps[0].Columns, c.want; !reflect.DeepEqual(got, want) {
+					t.Errorf("%v: got %v, want %v", task, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileLookups(t *testing.T) {
+	var small bigslice.Slice
+	f := bigslice.Func(func() bigslice.Slice {
+		large := bigslice.Const(4, []int{1, 2, 3, 4, 5}, []string{"a", "b", "c", "d", "e"})
+		large = bigslice.Reshuffle(large)
+		small = bigslice.Const(2, []int{1, 3}, []float64{1, 3})
+		return bigslice.Cogroup(large, small)
+	})
+	inv := makeExecInvocation(f.Invocation("<unknown>"))
+	inv.Env.SmallJoinRows = 2
+	tasks, err := compile(inv, inv.Invoke(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		// Only the large (reshuffled) side is read through a shuffle.
+		if got, want := len(task.Deps), 1; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if got, want := task.Lookups, []bigslice.Name{small.Name()}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Dependencies larger than SmallJoinRows are shuffled.
+	inv = makeExecInvocation(f.Invocation("<unknown>"))
+	inv.Env.SmallJoinRows = 1
+	tasks, err = compile(inv, inv.Invoke(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		if got, want := len(task.Deps), 2; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if task.Lookups != nil {
+			t.Errorf("%v: unexpected lookups %v", task, task.Lookups)
+		}
+	}
+}
+
+func TestCompileBroadcast(t *testing.T) {
+	f := bigslice.Func(func() bigslice.Slice {
+		large := bigslice.ReaderFunc(4, func(shard int, n *int, keys []int, vals []string) (int, error) {
+			return 0, sliceio.EOF
+		})
+		small := bigslice.Const(2, []int{1, 3}, []float64{1, 3})
+		slice := bigslice.Join(large, small)
+		return bigslice.Map(slice, func(k int, v string, w float64) int { return k })
+	})
+	inv := makeExecInvocation(f.Invocation("<unknown>"))
+	tasks, err := compile(inv, inv.Invoke(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tasks), 4; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, task := range tasks {
+		// The large side is pipelined with the join and the map, so the
+		// tasks' only dependency is the broadcast small side, which is
+		// read in full.
+		if got, want := len(task.Slices), 3; got != want {
+			t.Errorf("%v: got %v, want %v", task, got, want)
+		}
+		if got, want := len(task.Deps), 1; got != want {
+			t.Fatalf("%v: got %v, want %v", task, got, want)
+		}
+		dep := task.Deps[0]
+		if !dep.Broadcast {
+			t.Errorf("%v: dependency is not a broadcast", task)
+		}
+		if got, want := dep.NumTask(), 2; got != want {
+			t.Errorf("%v: got %v, want %v", task, got, want)
+		}
+		if got, want := dep.Head.NumPartition, 1; got != want {
+			t.Errorf("%v: got %v, want %v", task, got, want)
+		}
+	}
+}
+
+func TestCompileCoalesce(t *testing.T) {
+	f := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(10, []int{}, []string{})
+		slice = bigslice.Filter(slice, func(int, string) bool { return true })
+		slice = bigslice.Coalesce(slice, 3)
+		return bigslice.Map(slice, func(k int, v string) int { return k })
+	})
+	inv := makeExecInvocation(f.Invocation("<unknown>"))
+	tasks, err := compile(inv, inv.Invoke(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tasks), 3; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var shard int
+	for i, task := range tasks {
+		// The map is pipelined with the coalesced slice, which reads a
+		// range of the tasks of the filter, without a shuffle.
+		if got, want := len(task.Slices), 2; got != want {
+			t.Errorf("%v: got %v, want %v", task, got, want)
+		}
+		if got, want := len(task.Deps), 1; got != want {
+			t.Fatalf("%v: got %v, want %v", task, got, want)
+		}
+		dep := task.Deps[0]
+		if got, want := dep.NumTask(), []int{3, 3, 4}[i]; got != want {
+			t.Errorf("%v: got %v, want %v", task, got, want)
+		}
+		for j := 0; j < dep.NumTask(); j++ {
+			depTask := dep.Task(j)
+			if got, want := depTask.Name.Shard, shard; got != want {
+				t.Errorf("%v: got %v, want %v", depTask, got, want)
+			}
+			if got, want := depTask.NumPartition, 1; got != want {
+				t.Errorf("%v: got %v, want %v", depTask, got, want)
+			}
+			shard++
+		}
+	}
+	if got, want := shard, 10; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
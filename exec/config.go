@@ -21,6 +21,8 @@ func init() {
 		constr.InstanceVar(&sess.eventer, "eventer", "", "the eventer used to log bigslice events")
 		constr.FloatVar(&sess.maxLoad, "max-load", DefaultMaxLoad, "per-machine maximum load")
 		constr.StringVar(&sess.tracePath, "trace-path", "", "path at which to write trace event file")
+		constr.StringVar(&sess.taskEventLog, "task-event-log", "", "prefix under which to write task event logs")
+		constr.StringVar(&sess.alertWebhook, "alert-webhook", "", "URL to which alerts about lost tasks and failed invocations are posted")
 		constr.Doc = "bigslice configures the bigslice runtime"
 		constr.New = func() (interface{}, error) {
 			if system != nil {
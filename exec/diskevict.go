@@ -0,0 +1,150 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/grailbio/base/log"
+)
+
+// A DiskEvictionPolicy determines when, and which, task outputs are
+// evicted from workers whose disks near capacity. See DiskEviction.
+type DiskEvictionPolicy struct {
+	// MaxUsage is the fraction of a worker's disk, in (0, 1], above
+	// which the worker evicts task outputs before writing new ones.
+	// Outputs are not evicted if MaxUsage is zero.
+	MaxUsage float64
+	// MinIdle is the minimum amount of time since an output was last
+	// needed, i.e., written or read, before it may be evicted.
+	MinIdle time.Duration
+}
+
+// diskUsage returns the number of bytes used and the total number of
+// bytes of the file system that contains path. It is overridden in
+// tests.
+var diskUsage = statDisk
+
+// touchOutput records that the output of the named task, which is held
+// in the worker's store, was needed, so that outputs that were needed
+// less recently are evicted first. Outputs become eligible for
+// eviction once they are written by the worker's own tasks, as
+// indicated by written; reads of other outputs, e.g., of replicas, are
+// not tracked.
+func (w *worker) touchOutput(name TaskName, written bool) {
+	if w.DiskEviction.MaxUsage <= 0 {
+		return
+	}
+	w.mu.Lock()
+	if _, ok := w.lastNeeded[name]; ok || written {
+		w.lastNeeded[name] = time.Now()
+	}
+	w.mu.Unlock()
+}
+
+// relieveDiskPressure evicts task outputs from the worker's store,
+// least recently needed first, while the worker's disk use exceeds
+// the limit set by its eviction policy. Outputs of the tasks in keep,
+// e.g., those that are being read by the task that is about to write
+// its own outputs, are never evicted. Evicted tasks are marked LOST,
+// and are reported to the driver by takeEvicted.
+func (w *worker) relieveDiskPressure(ctx context.Context, keep map[TaskName]bool) {
+	policy := w.DiskEviction
+	if policy.MaxUsage <= 0 {
+		return
+	}
+	// Outputs in shared stores are not subject to the worker's disk
+	// pressure.
+	store, ok := w.store.(*fileStore)
+	if !ok {
+		return
+	}
+	pressured := func() bool {
+		used, total, err := diskUsage(store.Prefix)
+		if err != nil {
+			log.Debug.Printf("disk usage %s: %v", store.Prefix, err)
+			return false
+		}
+		return total > 0 && float64(used) > policy.MaxUsage*float64(total)
+	}
+	if !pressured() {
+		return
+	}
+	for _, name := range w.evictionCandidates(keep, policy.MinIdle) {
+		log.Printf("disk pressure: evicting output of task %s", name)
+		if err := w.Discard(ctx, name, nil); err != nil {
+			log.Error.Printf("evicting %s: %v", name, err)
+			continue
+		}
+		w.mu.Lock()
+		w.evicted = append(w.evicted, name)
+		w.mu.Unlock()
+		w.stats.Int("evictions").Add(1)
+		if !pressured() {
+			return
+		}
+	}
+	log.Error.Printf("disk pressure: no more task outputs may be evicted")
+}
+
+// evictionCandidates returns the names of the tasks whose outputs may
+// be evicted, i.e., those of completed tasks that are not in keep and
+// that have not been needed for at least minIdle, ordered from least
+// to most recently needed.
+func (w *worker) evictionCandidates(keep map[TaskName]bool, minIdle time.Duration) []TaskName {
+	type candidate struct {
+		name TaskName
+		last time.Time
+		task *Task
+	}
+	var (
+		candidates []candidate
+		now        = time.Now()
+	)
+	w.mu.Lock()
+	for name, last := range w.lastNeeded {
+		if keep[name] || now.Sub(last) < minIdle {
+			continue
+		}
+		if task := w.tasks[name.InvIndex][name]; task != nil {
+			candidates = append(candidates, candidate{name, last, task})
+		}
+	}
+	w.mu.Unlock()
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].last.Before(candidates[j].last)
+	})
+	var names []TaskName
+	for _, c := range candidates {
+		if c.task.State() == TaskOk {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// depNames returns the names of the tasks on which the provided task
+// depends.
+func depNames(task *Task) map[TaskName]bool {
+	names := make(map[TaskName]bool)
+	for _, dep := range task.Deps {
+		for i := 0; i < dep.NumTask(); i++ {
+			names[dep.Task(i).Name] = true
+		}
+	}
+	return names
+}
+
+// takeEvicted returns the names of the tasks whose outputs were
+// evicted since the last call to takeEvicted.
+func (w *worker) takeEvicted() []TaskName {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	evicted := w.evicted
+	w.evicted = nil
+	return evicted
+}
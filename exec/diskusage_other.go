@@ -0,0 +1,18 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package exec
+
+import (
+	"runtime"
+
+	"github.com/grailbio/base/errors"
+)
+
+func statDisk(path string) (used, total uint64, err error) {
+	return 0, 0, errors.E(errors.NotSupported, "disk usage is not supported on "+runtime.GOOS)
+}
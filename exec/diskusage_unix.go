@@ -0,0 +1,22 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package exec
+
+import "syscall"
+
+// statDisk returns the number of bytes used and the total number of
+// bytes of the file system that contains path.
+func statDisk(path string) (used, total uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	total = fs.Blocks * uint64(fs.Bsize)
+	used = total - fs.Bfree*uint64(fs.Bsize)
+	return used, total, nil
+}
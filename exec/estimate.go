@@ -0,0 +1,326 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"sort"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// DefaultThroughput is the default throughput, in bytes per second
+// per processor, at which the cost of evaluation is estimated.
+const DefaultThroughput = 32 << 20
+
+// An Estimate is an estimate of the size and cost of evaluating an
+// invocation, made before it runs. Estimates are computed from the
+// statistics of the invocation's sources (see bigslice.ShardStats),
+// and from the declared sizes of its slices (see bigslice.Sizer): the
+// data are presumed to be divided evenly among the partitions of
+// shuffles, and operations are presumed to output as many rows as they
+// read, so that, except for operations (e.g., flatmaps) that output
+// more rows than they read, estimates are upper bounds. The sizes of
+// the outputs of tasks that have already run, e.g., of the results of
+// previous invocations, are those that they reported.
+//
+// Sizes are -1 where they cannot be estimated, e.g., because a source
+// does not provide statistics.
+type Estimate struct {
+	// Stages are the estimates of the stages of the invocation, in
+	// dependency order: stages appear after the stages on which they
+	// depend.
+	Stages []StageEstimate
+	// Tasks is the total number of tasks.
+	Tasks int
+	// SourceBytes is the total size of the invocation's input, and
+	// ShuffleBytes the total size of the data moved between its tasks.
+	SourceBytes, ShuffleBytes int64
+	// Partial indicates whether the sizes of some stages could not be
+	// estimated, and thus are not included in the totals.
+	Partial bool
+}
+
+// A StageEstimate is an estimate of the size and cost of a stage of an
+// invocation, i.e., of the tasks that compute the shards of a
+// (pipelined) operation.
+type StageEstimate struct {
+	// Invocation is the index of the invocation to which the stage
+	// belongs, and Op is the name of the stage's operation, as in
+	// TaskName.
+	Invocation uint64
+	Op         string
+	// Tasks is the number of tasks in the stage, each of which
+	// requires Procs processors.
+	Tasks, Procs int
+	// SourceBytes is the size of the input that the stage reads from
+	// its sources, and ShuffleBytes the size of the data that it reads
+	// from other stages.
+	SourceBytes, ShuffleBytes int64
+	// Rows and Bytes are the number of rows and encoded size of the
+	// stage's output.
+	Rows, Bytes int64
+}
+
+// ProcSeconds returns the estimated processor time required to run the
+// stage at the provided throughput, in bytes per second per processor,
+// or -1 if it cannot be estimated. Each task is presumed to process its
+// input and its output at the throughput.
+func (s StageEstimate) ProcSeconds(throughput float64) float64 {
+	var work int64
+	for _, n := range []int64{s.SourceBytes, s.ShuffleBytes, s.Bytes} {
+		if n < 0 {
+			return -1
+		}
+		work += n
+	}
+	return float64(work) / throughput * float64(s.Procs)
+}
+
+// MachineHours returns the estimated number of machine-hours required
+// to evaluate the invocation at the provided throughput, in bytes per
+// second per processor, on machines with the provided number of
+// processors. Stages whose costs cannot be estimated are not counted.
+func (e *Estimate) MachineHours(throughput float64, procsPerMachine int) float64 {
+	var secs float64
+	for _, stage := range e.Stages {
+		if s := stage.ProcSeconds(throughput); s > 0 {
+			secs += s
+		}
+	}
+	return secs / float64(procsPerMachine) / 3600
+}
+
+// Estimate compiles the invocation of funcv with the provided
+// arguments, and estimates the size and cost of its evaluation,
+// without running anything. See Estimate for details.
+func (s *Session) Estimate(ctx context.Context, funcv *bigslice.FuncValue, args ...interface{}) (*Estimate, error) {
+	_, file, line, ok := runtime.Caller(1)
+	if !ok {
+		file = ""
+	}
+	inv, _, tasks, err := s.compileOnly(ctx, file, line, funcv, args...)
+	if err != nil {
+		return nil, err
+	}
+	return estimate(inv, tasks), nil
+}
+
+// taskSize is the estimated size of the output of a task.
+type taskSize struct {
+	rows, bytes int64
+}
+
+// estimate estimates the size and cost of the evaluation of the
+// provided invocation, whose task graph is rooted at the provided
+// tasks.
+func estimate(inv execInvocation, roots []*Task) *Estimate {
+	all := make(map[*Task]bool)
+	for _, task := range roots {
+		task.all(all)
+	}
+	var (
+		sizes  = make(map[*Task]taskSize)
+		stages = make(map[string]*StageEstimate)
+		depths = make(map[*Task]int)
+		depth  = make(map[string]int)
+		e      = new(Estimate)
+	)
+	for task := range all {
+		if task.Invocation.Index != inv.Index {
+			continue
+		}
+		stage := stages[task.Name.Op]
+		if stage == nil {
+			stage = &StageEstimate{Invocation: inv.Index, Op: task.Name.Op}
+			stages[task.Name.Op] = stage
+		}
+		if d := taskDepth(task, depths); d > depth[task.Name.Op] {
+			depth[task.Name.Op] = d
+		}
+		stage.Tasks++
+		if procs := task.Pragma.Procs(); procs > stage.Procs {
+			stage.Procs = procs
+		}
+		source, shuffle := taskInput(task, sizes)
+		stage.SourceBytes = addSize(stage.SourceBytes, source, stage.Tasks == 1)
+		stage.ShuffleBytes = addSize(stage.ShuffleBytes, shuffle, stage.Tasks == 1)
+		size := estimateTask(task, sizes)
+		stage.Rows = addSize(stage.Rows, size.rows, stage.Tasks == 1)
+		stage.Bytes = addSize(stage.Bytes, size.bytes, stage.Tasks == 1)
+	}
+	for _, stage := range stages {
+		e.Stages = append(e.Stages, *stage)
+	}
+	sort.Slice(e.Stages, func(i, j int) bool {
+		di, dj := depth[e.Stages[i].Op], depth[e.Stages[j].Op]
+		if di != dj {
+			return di < dj
+		}
+		return e.Stages[i].Op < e.Stages[j].Op
+	})
+	for _, stage := range e.Stages {
+		e.Tasks += stage.Tasks
+		if stage.SourceBytes < 0 || stage.ShuffleBytes < 0 || stage.Bytes < 0 {
+			e.Partial = true
+		}
+		if stage.SourceBytes > 0 {
+			e.SourceBytes += stage.SourceBytes
+		}
+		if stage.ShuffleBytes > 0 {
+			e.ShuffleBytes += stage.ShuffleBytes
+		}
+	}
+	return e
+}
+
+// addSize adds n to the sum, either of which may be unknown (-1), in
+// which case the sum is unknown. The sum is initialized to n if first
+// is true.
+func addSize(sum, n int64, first bool) int64 {
+	switch {
+	case first:
+		return n
+	case sum < 0 || n < 0:
+		return -1
+	default:
+		return sum + n
+	}
+}
+
+// taskInput returns the estimated sizes of the input that the provided
+// task reads from its sources and from other tasks.
+func taskInput(task *Task, sizes map[*Task]taskSize) (source, shuffle int64) {
+	if len(task.Deps) == 0 {
+		source = -1
+		for _, slice := range task.Slices {
+			if statter, ok := slice.(bigslice.ShardStatter); ok {
+				source = statter.ShardStats(task.Name.Shard).Bytes
+			}
+		}
+		// Sources that provide only their row counts (e.g., constant
+		// slices) are sized by their output.
+		if size := estimateTask(task, sizes); source < 0 && size.bytes >= 0 {
+			source = size.bytes
+		}
+		return source, 0
+	}
+	in := depSize(task, sizes)
+	return 0, in.bytes
+}
+
+// depSize returns the estimated size of the data that the provided
+// task reads from its dependencies. Task outputs are presumed to be
+// divided evenly among their partitions.
+func depSize(task *Task, sizes map[*Task]taskSize) taskSize {
+	var in taskSize
+	for _, dep := range task.Deps {
+		for i := 0; i < dep.NumTask(); i++ {
+			depTask := dep.Task(i)
+			size := estimateTask(depTask, sizes)
+			if n := int64(depTask.NumPartition); n > 1 {
+				size.rows = divSize(size.rows, n)
+				size.bytes = divSize(size.bytes, n)
+			}
+			in.rows = addSize(in.rows, size.rows, false)
+			in.bytes = addSize(in.bytes, size.bytes, false)
+		}
+	}
+	return in
+}
+
+func divSize(n, d int64) int64 {
+	if n < 0 {
+		return n
+	}
+	return (n + d - 1) / d
+}
+
+// estimateTask returns the estimated size of the output of the
+// provided task, memoized in sizes.
+func estimateTask(task *Task, sizes map[*Task]taskSize) taskSize {
+	if size, ok := sizes[task]; ok {
+		return size
+	}
+	// Tasks that have already run report the size of their outputs.
+	task.Lock()
+	var (
+		vals     = task.vals
+		complete = task.state == TaskOk
+	)
+	task.Unlock()
+	if complete && vals != nil {
+		size := taskSize{vals["write"], vals["writeBytes"]}
+		sizes[task] = size
+		return size
+	}
+	size := taskSize{-1, -1}
+	if len(task.Deps) > 0 {
+		size = depSize(task, sizes)
+	}
+	// Apply the statistics and declared sizes of the task's slices, in
+	// pipeline order.
+	for i := len(task.Slices) - 1; i >= 0; i-- {
+		slice := task.Slices[i]
+		if statter, ok := slice.(bigslice.ShardStatter); ok {
+			stats := statter.ShardStats(task.Name.Shard)
+			if stats.Rows >= 0 {
+				size.rows = stats.Rows
+			}
+			if stats.Bytes >= 0 {
+				size.bytes = stats.Bytes
+			}
+		}
+		if sizer, ok := slice.(bigslice.Sizer); ok {
+			if max := int64(sizer.MaxRows()); max >= 0 {
+				size = capRows(size, max)
+			}
+		}
+	}
+	if task.Limit > 0 {
+		size = capRows(size, int64(task.Limit))
+	}
+	if size.bytes < 0 && size.rows >= 0 {
+		size.bytes = size.rows * rowWidth(task)
+	}
+	sizes[task] = size
+	return size
+}
+
+// capRows caps the number of rows of the provided size, scaling its
+// bytes accordingly.
+func capRows(size taskSize, max int64) taskSize {
+	if size.rows >= 0 && size.rows <= max {
+		return size
+	}
+	if size.rows > 0 && size.bytes >= 0 {
+		size.bytes = size.bytes * max / size.rows
+	}
+	size.rows = max
+	return size
+}
+
+// variableWidth is the presumed encoded size of columns of types whose
+// values vary in size, e.g., strings and slices.
+const variableWidth = 32
+
+// rowWidth returns the estimated encoded size of a row of the provided
+// type.
+func rowWidth(typ slicetype.Type) int64 {
+	var width int64
+	for i := 0; i < typ.NumOut(); i++ {
+		t := typ.Out(i)
+		switch t.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+			width += variableWidth
+		default:
+			width += int64(t.Size())
+		}
+	}
+	return width
+}
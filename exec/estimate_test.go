@@ -0,0 +1,74 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestEstimate(t *testing.T) {
+	var nread int64
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.ReaderFunc(4, func(shard int, _ *int, out []int) (int, error) {
+			atomic.AddInt64(&nread, 1)
+			return 0, sliceio.EOF
+		})
+		stats := make([]bigslice.ShardStats, 4)
+		for i := range stats {
+			stats[i] = bigslice.ShardStats{Rows: 100, Bytes: 1000}
+		}
+		slice = bigslice.WithShardStats(slice, stats)
+		slice = bigslice.Map(slice, func(i int) (int, int) { return i % 3, i })
+		slice = bigslice.Reshard(slice, 2)
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	sess := Start(Local)
+	defer sess.Shutdown()
+	est, err := sess.Estimate(ctx, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt64(&nread), int64(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(est.Stages), 3; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := est.Tasks, 8; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := est.Partial, false; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	source := est.Stages[0]
+	if got, want := source.SourceBytes, int64(4000); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := source.Rows, int64(400); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Outputs are presumed to be divided evenly among partitions.
+	for _, stage := range est.Stages[1:] {
+		if got, want := stage.ShuffleBytes, int64(4000); got != want {
+			t.Errorf("%s: got %v, want %v", stage.Op, got, want)
+		}
+		if got, want := stage.Rows, int64(400); got != want {
+			t.Errorf("%s: got %v, want %v", stage.Op, got, want)
+		}
+	}
+	if got, want := est.ShuffleBytes, int64(8000); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Each stage reads 4000 bytes and writes 4000 bytes.
+	if got, want := est.MachineHours(1000, 2), 24000./1000/2/3600; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -25,7 +25,8 @@ var defaultChunksize = &defaultsize.Chunk
 // maxConsecutiveLost is the maximum number of times a task can be run and lost
 // consecutively before we give up and consider it an error. This helps catch
 // persistent errors that prevent meaningful progress from being made in an
-// evaluation (e.g. an error that causes worker processes to exit).
+// evaluation (e.g. an error that causes worker processes to exit). It may be
+// overridden for an invocation by RunRetries.
 const maxConsecutiveLost = 5
 
 // enableMaxConsecutiveLost enables the use of the maxConsecutiveLost value to
@@ -80,6 +81,8 @@ func Eval(ctx context.Context, executor Executor, roots []*Task, group *status.G
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	tracer := newEvalTracer(ctx)
+	defer tracer.Finish()
 	state := newState()
 	for _, task := range roots {
 		state.Enqueue(task)
@@ -88,7 +91,83 @@ func Eval(ctx context.Context, executor Executor, roots []*Task, group *status.G
 		donec   = make(chan *Task, 8)
 		errc    = make(chan error)
 		running int
+		limits  = newLimitScheduler()
 	)
+	// run marks the provided ready task as runnable and keeps track of
+	// it. The executor manages parallelism.
+	run := func(task *Task) {
+		task.Lock()
+		if task.state == TaskLost {
+			log.Printf("evaluator: resubmitting lost task %v", task)
+			task.state = TaskInit
+		}
+		status := group.Start(task.Name)
+		// runner is true if this evaluator is going to execute the task.
+		runner := task.state == TaskInit
+		var (
+			startRunTime time.Time
+			attempt      attemptSpan
+		)
+		if runner {
+			task.state = TaskWaiting
+			task.Status = status
+			task.evalCtx = ctx
+			startRunTime = time.Now()
+			attempt = tracer.StartAttempt(task)
+			go runTask(ctx, executor, task)
+		} else {
+			status.Print("running in another invocation")
+		}
+		running++
+		go func(task *Task) {
+			var err error
+			for task.state < TaskOk && err == nil {
+				err = task.Wait(ctx)
+			}
+			if runner {
+				if enableMaxConsecutiveLost {
+					// Only the runner bookkeeps consecutiveLost to avoid
+					// double-counting task loss.
+					switch task.state {
+					case TaskOk:
+						task.consecutiveLost = 0
+					case TaskLost:
+						task.consecutiveLost++
+						if task.consecutiveLost >= task.Invocation.maxLost() {
+							// We've lost this task too many times, so we
+							// consider it in error.
+							task.state = TaskErr
+							task.err = fmt.Errorf("lost on %d consecutive attempts", task.consecutiveLost)
+							task.Status.Printf(task.err.Error())
+							task.Broadcast()
+						}
+					}
+				}
+				tracer.EndAttempt(task, attempt)
+				d := time.Since(startRunTime)
+				executor.Eventer().Event("bigslice:taskComplete",
+					"name", task.Name.String(),
+					"state", task.state.String(),
+					"duration", d.Nanoseconds()/1e6)
+			}
+			task.Unlock()
+			status.Done()
+			// Eval may have returned (e.g., because another task
+			// failed), in which case nobody is listening: don't leak
+			// the goroutine.
+			if err != nil {
+				select {
+				case errc <- err:
+				case <-ctx.Done():
+				}
+			} else {
+				select {
+				case donec <- task:
+				case <-ctx.Done():
+				}
+			}
+		}(task)
+	}
 	for !state.Done() {
 		group.Printf("tasks: runnable: %d", running)
 		for !state.Done() && !state.Todo() {
@@ -101,68 +180,19 @@ func Eval(ctx context.Context, executor Executor, roots []*Task, group *status.G
 			case task := <-donec:
 				running--
 				state.Return(task)
+				tracer.Done(task)
+				for _, task := range limits.Done(task) {
+					run(task)
+				}
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 
-		// Mark each ready task as runnable and keep track of them.
-		// The executor manages parallelism.
 		for _, task := range state.Runnable() {
-			task.Lock()
-			if task.state == TaskLost {
-				log.Printf("evaluator: resubmitting lost task %v", task)
-				task.state = TaskInit
-			}
-			status := group.Start(task.Name)
-			// runner is true if this evaluator is going to execute the task.
-			runner := task.state == TaskInit
-			var startRunTime time.Time
-			if runner {
-				task.state = TaskWaiting
-				task.Status = status
-				startRunTime = time.Now()
-				go executor.Run(task)
-			} else {
-				status.Print("running in another invocation")
+			if limits.Admit(task) {
+				run(task)
 			}
-			running++
-			go func(task *Task) {
-				var err error
-				for task.state < TaskOk && err == nil {
-					err = task.Wait(ctx)
-				}
-				if runner {
-					if enableMaxConsecutiveLost {
-						// Only the runner bookkeeps consecutiveLost to avoid
-						// double-counting task loss.
-						switch task.state {
-						case TaskOk:
-							task.consecutiveLost = 0
-						case TaskLost:
-							task.consecutiveLost++
-							if task.consecutiveLost >= maxConsecutiveLost {
-								// We've lost this task too many times, so we
-								// consider it in error.
-								task.state = TaskErr
-								task.err = fmt.Errorf("lost on %d consecutive attempts", task.consecutiveLost)
-								task.Status.Printf(task.err.Error())
-								task.Broadcast()
-							}
-						}
-					}
-					d := time.Since(startRunTime)
-					executor.Eventer().Event("bigslice:taskComplete",
-						"name", task.Name.String(),
-						"state", task.state.String(),
-						"duration", d.Nanoseconds()/1e6)
-				}
-				task.Unlock()
-				status.Done()
-				if err != nil {
-					errc <- err
-				} else {
-					donec <- task
-				}
-			}(task)
 		}
 	}
 	return state.Err()
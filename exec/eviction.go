@@ -0,0 +1,168 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/grailbio/base/backgroundcontext"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigmachine"
+)
+
+// ec2InstanceActionURL is the EC2 instance metadata endpoint that
+// serves spot instance interruption notices. See
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-interruptions.html.
+const ec2InstanceActionURL = "http://169.254.169.254/latest/meta-data/spot/instance-action"
+
+var (
+	// evictionPollInterval is the period at which workers poll for
+	// eviction notices, and at which the driver polls workers for them.
+	// EC2 issues spot interruption notices two minutes ahead of time.
+	evictionPollInterval = 5 * time.Second
+
+	// evictionMargin is the amount of time before a machine's eviction
+	// at which we stop waiting for its running tasks to complete, so
+	// that there is time left to replicate their outputs.
+	evictionMargin = 30 * time.Second
+)
+
+// An evictionNotice announces that a machine is about to be evicted,
+// e.g., because it is a spot instance that is being reclaimed. Its
+// JSON encoding is that of EC2 spot instance interruption notices.
+type evictionNotice struct {
+	// Action is the action that is to be taken on the machine, e.g.,
+	// "terminate" or "stop".
+	Action string `json:"action"`
+	// Time is the time at which the action is to be taken. It is zero
+	// if no eviction has been announced.
+	Time time.Time `json:"time"`
+}
+
+// fetchEvictionNotice retrieves an eviction notice from the provided
+// URL. It returns a zero notice if none has been issued, as indicated
+// by a 404 response.
+func fetchEvictionNotice(ctx context.Context, url string) (evictionNotice, error) {
+	var notice evictionNotice
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return notice, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return notice, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return notice, nil
+	default:
+		return notice, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<10)).Decode(&notice); err != nil {
+		return notice, errors.E(errors.Invalid, "decoding eviction notice", err)
+	}
+	return notice, nil
+}
+
+// watchEviction polls w.EvictionNoticeURL until an eviction notice
+// is issued, which is then served by Eviction.
+func (w *worker) watchEviction(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(evictionPollInterval):
+		case <-ctx.Done():
+			return
+		}
+		notice, err := fetchEvictionNotice(ctx, w.EvictionNoticeURL)
+		if err != nil {
+			log.Debug.Printf("fetching eviction notice: %v", err)
+			continue
+		}
+		if notice.Time.IsZero() {
+			continue
+		}
+		log.Printf("machine is to be evicted: %s at %s", notice.Action, notice.Time)
+		w.mu.Lock()
+		w.eviction = notice
+		w.mu.Unlock()
+		return
+	}
+}
+
+// Eviction returns the eviction notice that has been issued for the
+// worker's machine, or a zero notice if there is none.
+func (w *worker) Eviction(ctx context.Context, _ struct{}, notice *evictionNotice) error {
+	w.mu.Lock()
+	*notice = w.eviction
+	w.mu.Unlock()
+	return nil
+}
+
+// watchEviction polls machine mach for an eviction notice until the
+// machine is stopped, handing the first notice to m.evict.
+func (m *machineManager) watchEviction(ctx context.Context, mach *sliceMachine) {
+	stopped := mach.Wait(bigmachine.Stopped)
+	for {
+		select {
+		case <-time.After(evictionPollInterval):
+		case <-stopped:
+			return
+		case <-ctx.Done():
+			return
+		}
+		var notice evictionNotice
+		if err := mach.Call(ctx, "Worker.Eviction", struct{}{}, &notice); err != nil {
+			log.Debug.Printf("eviction %s: %v", mach.Addr, err)
+			continue
+		}
+		if !notice.Time.IsZero() {
+			m.evict(mach, notice)
+			return
+		}
+	}
+}
+
+// evict migrates machine mach, managed by mgr, which is to be evicted
+// as announced by the provided notice. No new tasks are scheduled on
+// the machine and the outputs of its completed tasks are replicated to
+// other machines. Its running tasks are allowed to complete until
+// shortly before the eviction, and their outputs are replicated as
+// well. The machine is then released. Thus task outputs are migrated
+// instead of being lost, and need not be recomputed.
+func (b *bigmachineExecutor) evict(mgr *machineManager, mach *sliceMachine, notice evictionNotice) {
+	log.Printf("machine %s is to be evicted (%s at %s): migrating its task outputs",
+		mach.Addr, notice.Action, notice.Time)
+	if b.sess.eventer != nil {
+		b.sess.eventer.Event("bigslice:machineEvict",
+			"addr", mach.Addr,
+			"action", notice.Action,
+			"time", notice.Time.String())
+	}
+	ctx, cancel := context.WithDeadline(backgroundcontext.Get(), notice.Time)
+	defer cancel()
+	if _, err := mgr.Drain(ctx, mach.Addr, false); err != nil {
+		log.Error.Printf("evict %s: %v", mach.Addr, err)
+		return
+	}
+	b.replicate(ctx, mgr, mach)
+	waitCtx, waitCancel := context.WithDeadline(ctx, notice.Time.Add(-evictionMargin))
+	_, err := mgr.Drain(waitCtx, mach.Addr, true)
+	waitCancel()
+	if err == nil {
+		b.replicate(ctx, mgr, mach)
+	} else {
+		log.Error.Printf("evict %s: tasks did not complete before eviction: %v", mach.Addr, err)
+	}
+	log.Printf("releasing evicted machine %s", mach.Addr)
+	mach.Release()
+}
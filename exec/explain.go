@@ -0,0 +1,292 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Explain compiles the invocation of funcv with the provided arguments
+// and writes its physical plan to w, without running anything: the
+// stages of the invocation, i.e., the tasks that compute the shards of
+// a pipeline of operations; the number of shards of each; the
+// boundaries between them, across which data are shuffled or
+// broadcast; the number of partitions that are thus moved between
+// tasks; and the estimated sizes of the stages' inputs and outputs
+// (see Estimate). The Func is invoked, and the snapshots of the slices
+// that it reads are resolved, but no task is run.
+func (s *Session) Explain(ctx context.Context, w io.Writer, funcv *bigslice.FuncValue, args ...interface{}) error {
+	_, file, line, ok := runtime.Caller(1)
+	if !ok {
+		file = ""
+	}
+	_, err := s.explain(ctx, w, file, line, funcv, args...)
+	return err
+}
+
+// DryRun configures the session to explain, rather than run, the
+// invocations that it is asked to run: each is compiled, and its plan
+// written to w, as by Session.Explain. The results of dry runs may be
+// passed to other invocations, which are explained in turn, but they
+// cannot be read.
+func DryRun(w io.Writer) Option {
+	return func(s *Session) {
+		s.dryRun = w
+	}
+}
+
+// explain explains the invocation of funcv with the provided arguments,
+// which is made at the provided source location, and returns its
+// result, whose tasks are compiled but not run.
+func (s *Session) explain(ctx context.Context, w io.Writer, file string, line int, funcv *bigslice.FuncValue, args ...interface{}) (*Result, error) {
+	inv, slice, tasks, err := s.compileOnly(ctx, file, line, funcv, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePlan(w, inv, tasks); err != nil {
+		return nil, err
+	}
+	return &Result{
+		Slice:     slice,
+		sess:      s,
+		invIndex:  inv.Index,
+		tasks:     tasks,
+		snapshots: inv.Env.Snapshots,
+	}, nil
+}
+
+// compileOnly invokes funcv with the provided arguments, which is made
+// at the provided source location, and compiles the resulting slice
+// into a task graph, which is not run.
+func (s *Session) compileOnly(ctx context.Context, file string, line int, funcv *bigslice.FuncValue, args ...interface{}) (execInvocation, bigslice.Slice, []*Task, error) {
+	location := "<unknown>"
+	if file != "" {
+		location = fmt.Sprintf("%s:%d", file, line)
+		defer typecheck.Location(file, line)
+	}
+	// RunOptions do not affect the invocation's plan.
+	args, _ = splitRunOptions(args)
+	inv := makeExecInvocation(funcv.Invocation(location, args...))
+	inv.Env.AggregationFanIn = s.aggregationFanIn
+	inv.Env.SmallJoinRows = s.smallJoinRows
+	slice := inv.Invoke()
+	if err := resolveSnapshots(ctx, &inv, slice); err != nil {
+		return inv, nil, nil, err
+	}
+	s.mu.Lock()
+	err := resolvePersisted(&inv, slice, func(key string) (persistedTasks, bool) {
+		persisted, ok := s.persisted[key]
+		return persisted, ok
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return inv, nil, nil, err
+	}
+	inv.Env.PersistPrefix = s.persistPrefix
+	inv.persisted = s.persistedTasks
+	tasks, err := newCompiler(inv, s.machineCombiners).compile(slice, partitioner{})
+	if err != nil {
+		return inv, nil, nil, err
+	}
+	inv.Env.Freeze()
+	return inv, slice, tasks, nil
+}
+
+// planStage is a stage of a plan: the tasks of an invocation that
+// perform the same operation.
+type planStage struct {
+	op    string
+	index int
+	depth int
+	tasks []*Task
+}
+
+// writePlan writes the plan of the provided invocation, whose task
+// graph is rooted at the provided tasks, to w.
+func writePlan(w io.Writer, inv execInvocation, roots []*Task) error {
+	all := make(map[*Task]bool)
+	for _, task := range roots {
+		task.all(all)
+	}
+	var (
+		stages = make(map[string]*planStage)
+		depths = make(map[*Task]int)
+		sorted []*planStage
+	)
+	for task := range all {
+		if task.Invocation.Index != inv.Index {
+			continue
+		}
+		stage := stages[task.Name.Op]
+		if stage == nil {
+			stage = &planStage{op: task.Name.Op}
+			stages[task.Name.Op] = stage
+			sorted = append(sorted, stage)
+		}
+		if depth := taskDepth(task, depths); depth > stage.depth {
+			stage.depth = depth
+		}
+		stage.tasks = append(stage.tasks, task)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].depth != sorted[j].depth {
+			return sorted[i].depth < sorted[j].depth
+		}
+		return sorted[i].op < sorted[j].op
+	})
+	var (
+		ntask, nboundary, ntransfer int
+		est                         = estimate(inv, roots)
+		estimates                   = make(map[string]StageEstimate)
+	)
+	for _, stage := range est.Stages {
+		estimates[stage.Op] = stage
+	}
+	for i, stage := range sorted {
+		stage.index = i + 1
+		sort.Slice(stage.tasks, func(i, j int) bool {
+			return stage.tasks[i].Name.Shard < stage.tasks[j].Name.Shard
+		})
+		ntask += len(stage.tasks)
+	}
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "invocation %d at %s\n", inv.Index, inv.Location)
+	for _, stage := range sorted {
+		task := stage.tasks[0]
+		fmt.Fprintf(b, "stage %d: %s, %d tasks\n", stage.index, stage.op, len(stage.tasks))
+		ops := make([]string, len(task.Slices))
+		for i, slice := range task.Slices {
+			ops[len(ops)-1-i] = slice.Name().String()
+		}
+		fmt.Fprintf(b, "\tpipeline: %s\n", strings.Join(ops, " -> "))
+		for _, lookup := range task.Lookups {
+			fmt.Fprintf(b, "\tlookup: %s\n", lookup)
+		}
+		for _, in := range planInputs(stage, stages) {
+			fmt.Fprintf(b, "\tinput: %s\n", in.String())
+			nboundary++
+			ntransfer += in.transfers
+		}
+		cols := make([]string, task.NumOut())
+		for i := range cols {
+			cols[i] = task.Out(i).String()
+		}
+		fmt.Fprintf(b, "\toutput: (%s), %d partitions", strings.Join(cols, ", "), task.NumPartition)
+		if !task.Combiner.IsNil() {
+			fmt.Fprint(b, ", combined")
+			if task.CombineKey != "" {
+				fmt.Fprint(b, " by machine")
+			}
+		}
+		if task.Limit > 0 {
+			fmt.Fprintf(b, ", limited to %d rows", task.Limit)
+		}
+		fmt.Fprintln(b)
+		e := estimates[stage.op]
+		fmt.Fprintf(b, "\testimated: %s rows, %s output", formatCount(e.Rows), formatSize(e.Bytes))
+		if e.SourceBytes > 0 {
+			fmt.Fprintf(b, ", %s read", data.Size(e.SourceBytes))
+		}
+		if e.ShuffleBytes > 0 {
+			fmt.Fprintf(b, ", %s shuffled", data.Size(e.ShuffleBytes))
+		}
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintf(b, "total: %d stages, %d tasks, %d stage boundaries, %d partitions moved\n",
+		len(sorted), ntask, nboundary, ntransfer)
+	fmt.Fprintf(b, "estimated: %s read, %s shuffled, %.2f proc-hours at %s/s per proc",
+		data.Size(est.SourceBytes), data.Size(est.ShuffleBytes),
+		est.MachineHours(DefaultThroughput, 1), data.Size(DefaultThroughput))
+	if est.Partial {
+		fmt.Fprint(b, " (partial: some sizes are unknown)")
+	}
+	fmt.Fprintln(b)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// A planInput describes the data read by a stage from another stage.
+type planInput struct {
+	// from describes the stage that is read.
+	from string
+	// broadcast indicates whether the stage's output is broadcast to
+	// each reading task.
+	broadcast bool
+	// transfers is the number of task output partitions read by the
+	// reading stage.
+	transfers int
+	// partitions is the number of partitions of the stage's output.
+	partitions int
+}
+
+func (in planInput) String() string {
+	kind := "shuffle"
+	if in.broadcast {
+		kind = "broadcast"
+	}
+	return fmt.Sprintf("%s from %s of %d partitions, %d partitions moved", kind, in.from, in.partitions, in.transfers)
+}
+
+// planInputs returns the inputs of the provided stage, in the order in
+// which they appear as dependencies of its tasks.
+func planInputs(stage *planStage, stages map[string]*planStage) []planInput {
+	var (
+		inputs []planInput
+		index  = make(map[string]int)
+	)
+	for _, task := range stage.tasks {
+		for _, dep := range task.Deps {
+			if dep.NumTask() == 0 {
+				continue
+			}
+			head := dep.Task(0)
+			from := head.Name.Op
+			if depStage := stages[from]; depStage != nil {
+				from = fmt.Sprintf("stage %d", depStage.index)
+			} else {
+				from = fmt.Sprintf("%s (invocation %d)", from, head.Invocation.Index)
+			}
+			i, ok := index[from]
+			if !ok {
+				i = len(inputs)
+				index[from] = i
+				inputs = append(inputs, planInput{
+					from:       from,
+					broadcast:  dep.Broadcast,
+					partitions: head.NumPartition,
+				})
+			}
+			inputs[i].transfers += dep.NumTask()
+		}
+	}
+	return inputs
+}
+
+// formatCount formats the provided count, which is unknown if it is
+// negative.
+func formatCount(n int64) string {
+	if n < 0 {
+		return "?"
+	}
+	return fmt.Sprint(n)
+}
+
+// formatSize formats the provided size, which is unknown if it is
+// negative.
+func formatSize(n int64) string {
+	if n < 0 {
+		return "?"
+	}
+	return data.Size(n).String()
+}
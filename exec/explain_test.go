@@ -0,0 +1,88 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestExplain(t *testing.T) {
+	var nmap int64
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, 100))
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			atomic.AddInt64(&nmap, 1)
+			return i % 3, i
+		})
+		slice = bigslice.Reshard(slice, 2)
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	sess := Start(Local)
+	defer sess.Shutdown()
+	var b bytes.Buffer
+	if err := sess.Explain(ctx, &b, fn); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt64(&nmap), int64(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	plan := b.String()
+	for _, want := range []string{
+		"stage 1: ",
+		"const@",
+		" -> map@",
+		"stage 3: ",
+		"input: shuffle from stage 1 of 2 partitions, 8 partitions moved",
+		"output: (int, int), 2 partitions, combined",
+		"total: 3 stages, 8 tasks, 2 stage boundaries, 12 partitions moved",
+	} {
+		if !strings.Contains(plan, want) {
+			t.Errorf("plan does not contain %q:\n%s", want, plan)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var nmap int64
+	ints := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Map(bigslice.Const(2, rangeSlice(0, 10)), func(i int) int {
+			atomic.AddInt64(&nmap, 1)
+			return i
+		})
+	})
+	double := bigslice.Func(func(slice bigslice.Slice) bigslice.Slice {
+		return bigslice.Map(slice, func(i int) int { return 2 * i })
+	})
+	ctx := context.Background()
+	var b bytes.Buffer
+	sess := Start(Local, DryRun(&b))
+	defer sess.Shutdown()
+	res := sess.Must(ctx, double, sess.Must(ctx, ints))
+	if got, want := atomic.LoadInt64(&nmap), int64(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := strings.Count(b.String(), "invocation "), 3; got != want {
+		t.Errorf("got %v, want %v:\n%s", got, want, b.String())
+	}
+	if !strings.Contains(b.String(), "input: shuffle from inv") {
+		t.Errorf("plan does not read the result argument:\n%s", b.String())
+	}
+	scan := res.Scanner()
+	defer scan.Close()
+	var i int
+	if scan.Scan(ctx, &i) {
+		t.Error("dry run result was read")
+	}
+	if scan.Err() == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/grailbio/base/sync/ctxsync"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// A fetchScheduler schedules the shuffle fetches of the tasks that run
+// on a worker, so that tasks that start at the same time, e.g., the
+// reducers of a wide shuffle, spread their fetches evenly across the
+// producer machines from which they read, rather than stampeding the
+// same producers. Each fetch is scheduled from the producer machine
+// with the fewest fetches in progress from the worker; the number of
+// fetches in progress from each producer may also be limited.
+type fetchScheduler struct {
+	// limit is the maximum number of fetches in progress from a single
+	// producer machine, or zero if unlimited.
+	limit int
+
+	mu     sync.Mutex
+	cond   *ctxsync.Cond
+	active map[string]int
+}
+
+// newFetchScheduler returns a new fetch scheduler that allows at most
+// limit fetches in progress from each producer machine, or an
+// unlimited number if limit is zero.
+func newFetchScheduler(limit int) *fetchScheduler {
+	s := &fetchScheduler{limit: limit, active: make(map[string]int)}
+	s.cond = ctxsync.NewCond(&s.mu)
+	return s
+}
+
+// Acquire chooses the fetch to perform next from the provided fetches,
+// returning its index, and marks it as in progress. Fetches from the
+// least loaded producer are chosen first, and, among those, the ones
+// that appear first in fetches. Fetches of local data, with an empty
+// address, are always chosen immediately. Acquire blocks while every
+// producer of the provided fetches is at its limit.
+func (s *fetchScheduler) Acquire(ctx context.Context, fetches []fetch) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		best := -1
+		for i, f := range fetches {
+			if f.addr == "" {
+				return i, nil
+			}
+			n := s.active[f.addr]
+			if s.limit > 0 && n >= s.limit {
+				continue
+			}
+			if best < 0 || n < s.active[fetches[best].addr] {
+				best = i
+			}
+		}
+		if best >= 0 {
+			s.active[fetches[best].addr]++
+			return best, nil
+		}
+		if err := s.cond.Wait(ctx); err != nil {
+			return -1, err
+		}
+	}
+}
+
+// Release marks the provided fetch, previously returned by Acquire, as
+// completed.
+func (s *fetchScheduler) Release(f fetch) {
+	if f.addr == "" {
+		return
+	}
+	s.mu.Lock()
+	if s.active[f.addr]--; s.active[f.addr] == 0 {
+		delete(s.active, f.addr)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// A fetch is a reader of a task's output partition, and the address of
+// the machine from which it is read, or the empty string if it is read
+// from local (or shared) storage.
+type fetch struct {
+	addr string
+	sliceio.Reader
+}
+
+// staggerFetches reorders the provided fetches, which are read by the
+// given partition, so that consecutive fetches are from different
+// producer machines wherever possible, and so that different
+// partitions start reading from different producers. Local fetches are
+// placed first.
+func staggerFetches(fetches []fetch, partition int) {
+	var (
+		n      = len(fetches)
+		byAddr = make(map[string][]fetch)
+		addrs  []string
+		local  []fetch
+	)
+	for _, f := range fetches {
+		if f.addr == "" {
+			local = append(local, f)
+			continue
+		}
+		if _, ok := byAddr[f.addr]; !ok {
+			addrs = append(addrs, f.addr)
+		}
+		byAddr[f.addr] = append(byAddr[f.addr], f)
+	}
+	sort.Strings(addrs)
+	if len(addrs) > 0 {
+		off := partition % len(addrs)
+		addrs = append(addrs[off:], addrs[:off]...)
+	}
+	fetches = append(fetches[:0], local...)
+	for len(fetches) < n {
+		for _, addr := range addrs {
+			if q := byAddr[addr]; len(q) > 0 {
+				fetches = append(fetches, q[0])
+				byAddr[addr] = q[1:]
+			}
+		}
+	}
+}
+
+// fetchReader is a sliceio.Reader that reads the concatenation of a
+// set of fetches, in the order in which they are scheduled by a fetch
+// scheduler.
+type fetchReader struct {
+	sched   *fetchScheduler
+	fetches []fetch
+	cur     *fetch
+	err     error
+}
+
+func (r *fetchReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for {
+		if r.cur == nil {
+			if len(r.fetches) == 0 {
+				r.err = sliceio.EOF
+				return 0, r.err
+			}
+			i, err := r.sched.Acquire(ctx, r.fetches)
+			if err != nil {
+				r.err = err
+				return 0, err
+			}
+			f := r.fetches[i]
+			r.cur = &f
+			r.fetches = append(r.fetches[:i], r.fetches[i+1:]...)
+		}
+		n, err := r.cur.Read(ctx, out)
+		switch {
+		case err == sliceio.EOF:
+			r.sched.Release(*r.cur)
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+		case err != nil:
+			r.sched.Release(*r.cur)
+			r.cur = nil
+			r.err = err
+			return n, err
+		case n > 0:
+			return n, nil
+		}
+	}
+}
+
+// Close releases the reader's fetch in progress, if any. It does not
+// close the underlying readers.
+func (r *fetchReader) Close() error {
+	if r.cur != nil {
+		r.sched.Release(*r.cur)
+		r.cur = nil
+	}
+	return nil
+}
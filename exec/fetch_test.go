@@ -0,0 +1,95 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func fetchAddrs(fetches []fetch) []string {
+	addrs := make([]string, len(fetches))
+	for i, f := range fetches {
+		addrs[i] = f.addr
+	}
+	return addrs
+}
+
+func TestStaggerFetches(t *testing.T) {
+	makeFetches := func() []fetch {
+		var fetches []fetch
+		for _, addr := range []string{"a", "a", "a", "b", "", "b", "c"} {
+			fetches = append(fetches, fetch{addr: addr})
+		}
+		return fetches
+	}
+	for partition, want := range [][]string{
+		{"", "a", "b", "c", "a", "b", "a"},
+		{"", "b", "c", "a", "b", "a", "a"},
+		{"", "c", "a", "b", "a", "b", "a"},
+		{"", "a", "b", "c", "a", "b", "a"},
+	} {
+		fetches := makeFetches()
+		staggerFetches(fetches, partition)
+		if got := fetchAddrs(fetches); !reflect.DeepEqual(got, want) {
+			t.Errorf("partition %d: got %v, want %v", partition, got, want)
+		}
+	}
+}
+
+func TestFetchScheduler(t *testing.T) {
+	ctx := context.Background()
+	s := newFetchScheduler(2)
+	fetches := []fetch{{addr: "a"}, {addr: "a"}, {addr: "b"}, {addr: "a"}}
+	var acquired []string
+	for i := 0; i < 4; i++ {
+		j, err := s.Acquire(ctx, fetches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acquired = append(acquired, fetches[j].addr)
+		fetches = append(fetches[:j], fetches[j+1:]...)
+		if len(fetches) == 0 {
+			break
+		}
+		if i == 2 {
+			// Both producers are now at their limit.
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			if _, err := s.Acquire(ctx, fetches); err != context.DeadlineExceeded {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+			cancel()
+			s.Release(fetch{addr: "a"})
+		}
+	}
+	// Fetches are taken from the least loaded producer first.
+	if got, want := acquired, []string{"a", "b", "a", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchReader(t *testing.T) {
+	s := newFetchScheduler(1)
+	var fetches []fetch
+	for i, addr := range []string{"a", "b", "a", ""} {
+		fetches = append(fetches, fetch{addr, sliceio.FrameReader(frame.Slices([]int{i, i}))})
+	}
+	r := &fetchReader{sched: s, fetches: fetches}
+	var got []int
+	if err := sliceio.ReadAll(context.Background(), r, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 3, 0, 0, 1, 1, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(s.active) != 0 {
+		t.Errorf("fetches still in progress: %v", s.active)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/grailbio/base/log"
 )
@@ -31,6 +32,16 @@ var debugIndexHtml = `<!DOCTYPE html>
 <dd>bigslice task and machine status</dd>
 <dt><a href="/debug/tasks">/debug/tasks</a></dt>
 <dd>bigslice task graph</dd>
+<dt><a href="/debug/dag">/debug/dag</a></dt>
+<dd>bigslice task graph, by invocation and phase, with task details</dd>
+<dt><a href="/debug/timeline">/debug/timeline</a></dt>
+<dd>bigslice task attempts over time, by machine</dd>
+<dt>/debug/profile?machine=<i>addr</i>|task=<i>name</i>&amp;name=<i>profile</i></dt>
+<dd>CPU, heap, goroutine, and other profiles of a worker machine, or of the machine running a task</dd>
+<dt><a href="/debug/summary">/debug/summary</a></dt>
+<dd>bigslice progress, running invocations, machines, and recent task errors, as JSON</dd>
+<dt>/debug/cancel?invocation=<i>index</i> (POST, with header X-Bigslice-Cancel)</dt>
+<dd>cancel a running invocation</dd>
 <dt><a href="/debug/trace">/debug/trace</a></dt>
 <dd>Chrome-compatible event trace</dd>
 </dl>
@@ -209,3 +220,582 @@ function dragended(d) {
 </script>
 
 `
+
+// handleDAGGraph serves a snapshot of the session's task graph as
+// returned by Session.Graph, encoded as JSON.
+func (s *Session) handleDAGGraph(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(s.Graph()); err != nil {
+		log.Error.Printf("Session.handleDAGGraph: json.Encode: %v", err)
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// handleDAG serves a page that renders the session's live task graph.
+// Graphs are drawn per invocation, with the tasks of each phase (i.e.,
+// the shards of a pipelined operation) collapsed into a single node
+// that summarizes their states, so that graphs with many thousands of
+// tasks remain legible. Phases may be expanded into their tasks, and
+// tasks into their details.
+func (s *Session) handleDAG(w http.ResponseWriter, r *http.Request) {
+	writeStatePage(w, dagHtml)
+}
+
+// writeStatePage writes the HTML page html to w, substituting the
+// colors with which task states are rendered for "{{COLORS}}". Colors
+// are shared with WriteDOT.
+func writeStatePage(w http.ResponseWriter, html string) {
+	colors := make(map[string]string, len(dotColors))
+	for state, color := range dotColors {
+		colors[TaskState(state).String()] = color
+	}
+	p, err := json.Marshal(colors)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Add("content-type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, strings.Replace(html, "{{COLORS}}", string(p), 1))
+}
+
+var dagHtml = `<!DOCTYPE html>
+<meta charset="utf-8">
+<head>
+<title>bigslice task graph</title>
+<style>
+body { font-family: sans-serif; font-size: 12px; margin: 0; }
+#toolbar { padding: 6px 10px; border-bottom: 1px solid #ccc; background: #f6f6f6; }
+#main { display: flex; height: calc(100vh - 36px); }
+#graph { flex: 3; overflow: auto; }
+#details { flex: 2; overflow: auto; border-left: 1px solid #ccc; padding: 0 10px; }
+.phase rect.box { fill: #fff; stroke: #888; cursor: pointer; }
+.phase.selected rect.box { stroke: #000; stroke-width: 2px; }
+.phase text { font-family: monospace; font-size: 11px; pointer-events: none; }
+path.edge { fill: none; stroke: #999; stroke-opacity: 0.7; }
+table { border-collapse: collapse; font-family: monospace; font-size: 11px; }
+td, th { padding: 2px 6px; text-align: left; border-bottom: 1px solid #eee; }
+tr.task { cursor: pointer; }
+tr.task:hover { background: #eef; }
+a { cursor: pointer; color: #00c; }
+.legend span { display: inline-block; padding: 1px 6px; margin-right: 4px; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<div id="toolbar">
+invocation <select id="invocation"></select>
+<label><input type="checkbox" id="live" checked> live</label>
+<span class="legend" id="legend"></span>
+<span id="summary"></span>
+</div>
+<div id="main">
+<div id="graph"><svg id="svg"></svg></div>
+<div id="details"><p>Select a phase to list its tasks.</p></div>
+</div>
+<script>
+var colors = {{COLORS}};
+var states = ["INIT", "WAITING", "RUNNING", "OK", "ERROR", "LOST"];
+var graph = null, selectedInv = null, selectedPhase = null, selectedTask = null;
+var boxWidth = 240, boxHeight = 54, colGap = 80, rowGap = 16;
+
+function el(tag, attrs, text) {
+  var svg = ["svg", "rect", "text", "path", "g", "title"].indexOf(tag) >= 0;
+  var e = svg ? document.createElementNS("http://www.w3.org/2000/svg", tag) : document.createElement(tag);
+  for (var k in attrs || {}) e.setAttribute(k, attrs[k]);
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function fmtBytes(n) {
+  if (n < 0) return "";
+  var units = ["B", "KiB", "MiB", "GiB", "TiB"], i = 0;
+  while (n >= 1024 && i < units.length-1) { n /= 1024; i++; }
+  return n.toFixed(i ? 1 : 0) + units[i];
+}
+
+function fmtCount(n) { return n < 0 ? "" : String(n); }
+
+document.getElementById("legend").innerHTML = states.map(function(s) {
+  return '<span style="background:' + colors[s] + '">' + s + '</span>';
+}).join("");
+
+// phases groups the tasks of invocation inv by op, and computes the
+// dependencies between the resulting phases.
+function phases(inv) {
+  var byName = {}, byOp = {}, order = [];
+  graph.tasks.forEach(function(t) { byName[t.name] = t; });
+  graph.tasks.forEach(function(t) {
+    if (t.invocation != inv) return;
+    var p = byOp[t.op];
+    if (!p) {
+      p = byOp[t.op] = {op: t.op, tasks: [], counts: {}, deps: {}, records: 0, bytes: 0};
+      order.push(p);
+    }
+    p.tasks.push(t);
+    p.counts[t.state] = (p.counts[t.state] || 0) + 1;
+    if (t.records > 0) p.records += t.records;
+    if (t.bytes > 0) p.bytes += t.bytes;
+    (t.deps || []).forEach(function(d) {
+      d.tasks.forEach(function(name) {
+        var dt = byName[name];
+        if (dt && dt.op != t.op) p.deps[dt.op] = dt.invocation == inv;
+      });
+    });
+  });
+  return {byName: byName, byOp: byOp, order: order};
+}
+
+// layout assigns each phase to a column given by its longest distance
+// from a source phase.
+function layout(ps) {
+  var depth = {};
+  function visit(p) {
+    if (depth[p.op] !== undefined) return depth[p.op];
+    depth[p.op] = 0;
+    var d = 0;
+    for (var op in p.deps) {
+      if (ps.byOp[op]) d = Math.max(d, visit(ps.byOp[op]) + 1);
+    }
+    return depth[p.op] = d;
+  }
+  var columns = [];
+  ps.order.forEach(function(p) {
+    var d = visit(p);
+    (columns[d] = columns[d] || []).push(p);
+  });
+  columns.forEach(function(col, i) {
+    col.sort(function(a, b) { return a.op < b.op ? -1 : 1; });
+    col.forEach(function(p, j) {
+      p.x = 10 + i*(boxWidth+colGap);
+      p.y = 10 + j*(boxHeight+rowGap);
+    });
+  });
+  return columns;
+}
+
+function renderGraph() {
+  var svg = document.getElementById("svg");
+  while (svg.firstChild) svg.removeChild(svg.firstChild);
+  var ps = phases(selectedInv);
+  layout(ps);
+  var width = 20, height = 20;
+  ps.order.forEach(function(p) {
+    width = Math.max(width, p.x + boxWidth + 10);
+    height = Math.max(height, p.y + boxHeight + 10);
+  });
+  svg.setAttribute("width", width);
+  svg.setAttribute("height", height);
+  var edges = el("g");
+  svg.appendChild(edges);
+  ps.order.forEach(function(p) {
+    for (var op in p.deps) {
+      var d = ps.byOp[op];
+      if (!d) continue;
+      var x1 = d.x + boxWidth, y1 = d.y + boxHeight/2, x2 = p.x, y2 = p.y + boxHeight/2;
+      var mx = (x1 + x2) / 2;
+      edges.appendChild(el("path", {"class": "edge",
+        d: "M" + x1 + "," + y1 + " C" + mx + "," + y1 + " " + mx + "," + y2 + " " + x2 + "," + y2}));
+    }
+  });
+  var total = {};
+  ps.order.forEach(function(p) {
+    var g = el("g", {"class": "phase" + (p.op == selectedPhase ? " selected" : ""),
+      transform: "translate(" + p.x + "," + p.y + ")"});
+    g.appendChild(el("rect", {"class": "box", width: boxWidth, height: boxHeight}));
+    // The state bar shows the fraction of the phase's tasks in each state.
+    var x = 1, barWidth = boxWidth - 2;
+    states.forEach(function(s) {
+      var n = p.counts[s] || 0;
+      total[s] = (total[s] || 0) + n;
+      if (!n) return;
+      var w = barWidth * n / p.tasks.length;
+      g.appendChild(el("rect", {x: x, y: boxHeight-13, width: w, height: 12, fill: colors[s]}));
+      x += w;
+    });
+    var label = p.op.length > 32 ? p.op.substr(0, 31) + "…" : p.op;
+    g.appendChild(el("text", {x: 6, y: 15}, label));
+    g.appendChild(el("text", {x: 6, y: 29},
+      p.tasks.length + " tasks  " + p.records + " rec  " + fmtBytes(p.bytes)));
+    g.appendChild(el("title", {}, p.op + "\n" + states.filter(function(s) { return p.counts[s]; })
+      .map(function(s) { return s + ": " + p.counts[s]; }).join("\n")));
+    g.addEventListener("click", function() {
+      selectedPhase = p.op;
+      selectedTask = null;
+      render();
+    });
+    svg.appendChild(g);
+  });
+  document.getElementById("summary").textContent = " " + states.filter(function(s) { return total[s]; })
+    .map(function(s) { return s + " " + total[s]; }).join("  ");
+  return ps;
+}
+
+function taskLink(name) {
+  var a = el("a", {}, name);
+  a.addEventListener("click", function() {
+    var t = graph.tasks.filter(function(t) { return t.name == name; })[0];
+    if (!t) return;
+    selectedInv = t.invocation;
+    selectedPhase = t.op;
+    selectedTask = name;
+    render();
+  });
+  return a;
+}
+
+function renderTask(ps, t) {
+  var div = el("div");
+  div.appendChild(el("h3", {}, t.name));
+  var back = el("a", {}, "« " + t.op);
+  back.addEventListener("click", function() { selectedTask = null; render(); });
+  div.appendChild(back);
+  var table = el("table");
+  function row(k, v) {
+    var tr = el("tr");
+    tr.appendChild(el("th", {}, k));
+    var td = el("td");
+    if (v instanceof Node) td.appendChild(v); else td.textContent = v;
+    tr.appendChild(td);
+    table.appendChild(tr);
+  }
+  var state = el("span", {style: "background:" + colors[t.state]}, t.state);
+  row("state", state);
+  if (t.error) row("error", t.error);
+  row("shard", t.shard + " of " + t.numShard);
+  row("partitions", t.numPartition);
+  row("records", fmtCount(t.records));
+  row("bytes", fmtBytes(t.bytes));
+  row("columns", (t.columns || []).join(", "));
+  row("slices", (t.slices || []).join(", "));
+  row("resources", t.procs + " procs, " + t.gpus + " gpus" + (t.exclusive ? ", exclusive" : ""));
+  if (t.combineKey) row("combine key", t.combineKey);
+  if (t.progress) {
+    row("progress", t.progress.records + " records" + (t.progress.message ? "; " + t.progress.message : "") +
+      " (reported " + new Date(t.progress.updated).toLocaleTimeString() + ")");
+  }
+  var attempts = t.attempts || [];
+  if (attempts.length) {
+    var last = attempts[attempts.length-1];
+    row("machine", last.machine + " (attempt " + attempts.length + ")");
+    // Profiles are captured from the machine that is running the
+    // task, or that last ran it.
+    var profiles = el("span");
+    [["cpu", "cpu (10s)", "&seconds=10"], ["heap", "heap", "&gc=1"], ["goroutine", "goroutines", "&debug=2"]].forEach(function(p) {
+      profiles.appendChild(el("a", {href: "/debug/profile?task=" + encodeURIComponent(t.name) +
+        "&name=" + p[0] + p[2], target: "_blank"}, p[1]));
+      profiles.appendChild(document.createTextNode(" "));
+    });
+    row("profile", profiles);
+  }
+  div.appendChild(table);
+  div.appendChild(el("h4", {}, "dependencies"));
+  (t.deps || []).forEach(function(d) {
+    var p = el("p", {}, "partition " + d.partition + (d.expand ? " (expanded)" : "") +
+      (d.combineKey ? " combine key " + d.combineKey : "") + ":");
+    d.tasks.forEach(function(name) {
+      p.appendChild(el("br"));
+      var dt = ps.byName[name];
+      if (dt) p.appendChild(el("span", {style: "background:" + colors[dt.state]}, " "));
+      p.appendChild(document.createTextNode(" "));
+      p.appendChild(taskLink(name));
+    });
+    div.appendChild(p);
+  });
+  div.appendChild(el("h4", {}, "dependents"));
+  var dependents = el("p");
+  graph.tasks.forEach(function(c) {
+    var uses = (c.deps || []).some(function(d) { return d.tasks.indexOf(t.name) >= 0; });
+    if (!uses) return;
+    dependents.appendChild(taskLink(c.name));
+    dependents.appendChild(el("br"));
+  });
+  div.appendChild(dependents);
+  return div;
+}
+
+function renderPhase(ps, p) {
+  var div = el("div");
+  div.appendChild(el("h3", {}, p.op));
+  var table = el("table");
+  var hdr = el("tr");
+  ["task", "state", "records", "bytes", "error"].forEach(function(h) { hdr.appendChild(el("th", {}, h)); });
+  table.appendChild(hdr);
+  p.tasks.slice().sort(function(a, b) { return a.shard - b.shard; }).forEach(function(t) {
+    var tr = el("tr", {"class": "task"});
+    tr.appendChild(el("td", {}, t.name));
+    tr.appendChild(el("td", {style: "background:" + colors[t.state]}, t.state));
+    tr.appendChild(el("td", {}, fmtCount(t.records)));
+    tr.appendChild(el("td", {}, fmtBytes(t.bytes)));
+    tr.appendChild(el("td", {}, t.error || ""));
+    tr.addEventListener("click", function() { selectedTask = t.name; render(); });
+    table.appendChild(tr);
+  });
+  div.appendChild(table);
+  return div;
+}
+
+function render() {
+  var select = document.getElementById("invocation");
+  var invs = {};
+  graph.tasks.forEach(function(t) { invs[t.invocation] = true; });
+  var keys = Object.keys(invs).map(Number).sort(function(a, b) { return a - b; });
+  if (selectedInv === null || !invs[selectedInv]) selectedInv = keys.length ? keys[keys.length-1] : null;
+  select.innerHTML = "";
+  var jobs = {};
+  (graph.jobs || []).forEach(function(j) { if (j.invocation) jobs[j.invocation] = j; });
+  keys.forEach(function(k) {
+    var o = el("option", {value: k}, "invocation " + k + (jobs[k] ? " (job " + jobs[k].id + ")" : ""));
+    if (k == selectedInv) o.selected = true;
+    select.appendChild(o);
+  });
+  if (selectedInv === null) return;
+  var ps = renderGraph();
+  var details = document.getElementById("details");
+  details.innerHTML = "";
+  var task = selectedTask && ps.byName[selectedTask];
+  if (task) {
+    details.appendChild(renderTask(ps, task));
+  } else if (selectedPhase && ps.byOp[selectedPhase]) {
+    details.appendChild(renderPhase(ps, ps.byOp[selectedPhase]));
+  } else {
+    details.appendChild(el("p", {}, "Select a phase to list its tasks."));
+  }
+}
+
+document.getElementById("invocation").addEventListener("change", function(e) {
+  selectedInv = Number(e.target.value);
+  selectedPhase = selectedTask = null;
+  render();
+});
+
+function refresh() {
+  fetch("/debug/dag/graph").then(function(r) { return r.json(); }).then(function(g) {
+    graph = g;
+    render();
+  }).catch(function(err) { console.log(err); });
+}
+
+refresh();
+setInterval(function() {
+  if (document.getElementById("live").checked) refresh();
+}, 2000);
+</script>
+</body>
+</html>
+`
+
+// handleTimeline serves a page that renders the attempts of the
+// session's tasks over time, by machine, so that stragglers and
+// scheduling gaps are easily spotted. Attempts whose duration is much
+// longer than is typical for their phase are outlined.
+func (s *Session) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	writeStatePage(w, timelineHtml)
+}
+
+var timelineHtml = `<!DOCTYPE html>
+<meta charset="utf-8">
+<head>
+<title>bigslice task timeline</title>
+<style>
+body { font-family: sans-serif; font-size: 12px; margin: 0; }
+#toolbar { padding: 6px 10px; border-bottom: 1px solid #ccc; background: #f6f6f6; }
+#timeline { overflow: auto; padding: 10px; }
+text { font-family: monospace; font-size: 11px; }
+rect.attempt { stroke: #888; stroke-width: 0.5px; }
+rect.straggler { stroke: #d00; stroke-width: 2px; }
+rect.progressing { stroke: #d80; stroke-width: 2px; stroke-dasharray: 3,2; }
+line.tick { stroke: #ddd; }
+line.lane { stroke: #eee; }
+.legend span { display: inline-block; padding: 1px 6px; margin-right: 4px; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<div id="toolbar">
+<select id="invocation"><option value="">all invocations</option></select>
+<label><input type="checkbox" id="live" checked> live</label>
+<span class="legend" id="legend"></span>
+<span class="legend"><span style="border: 2px solid #d00">straggler</span><span style="border: 2px dashed #d80">slow, progressing</span></span>
+<span id="summary"></span>
+</div>
+<div id="timeline"><svg id="svg"></svg></div>
+<script>
+var colors = {{COLORS}};
+var states = ["RUNNING", "OK", "ERROR", "LOST"];
+var graph = null, selectedInv = "";
+var labelWidth = 220, rowHeight = 14, laneGap = 6, axisHeight = 20;
+// An attempt is a straggler if it takes more than stragglerFactor times
+// the median duration of its phase's completed attempts, and at least
+// stragglerMin milliseconds.
+var stragglerFactor = 2, stragglerMin = 1000;
+// A running straggler is still progressing if its task has reported
+// progress within the last progressWindow milliseconds; otherwise it may
+// be hung.
+var progressWindow = 30000;
+
+function el(tag, attrs, text) {
+  var e = document.createElementNS("http://www.w3.org/2000/svg", tag);
+  for (var k in attrs || {}) e.setAttribute(k, attrs[k]);
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function fmtDuration(ms) {
+  if (ms < 1000) return ms.toFixed(0) + "ms";
+  if (ms < 60000) return (ms/1000).toFixed(1) + "s";
+  return (ms/60000).toFixed(1) + "m";
+}
+
+document.getElementById("legend").innerHTML = states.map(function(s) {
+  return '<span style="background:' + colors[s] + '">' + s + '</span>';
+}).join("");
+
+// attempts flattens the attempts of the selected invocation's tasks.
+function attempts(now) {
+  var list = [];
+  graph.tasks.forEach(function(t) {
+    if (selectedInv !== "" && t.invocation != selectedInv) return;
+    (t.attempts || []).forEach(function(a, i) {
+      var start = Date.parse(a.start), end = Date.parse(a.end);
+      // Running attempts have a zero end time.
+      var running = !(end > 0);
+      list.push({task: t, index: i, machine: a.machine, state: a.state, error: a.error,
+        start: start, end: running ? now : end, running: running});
+    });
+  });
+  return list;
+}
+
+// markStragglers marks attempts that take much longer than is typical
+// for their phase.
+function markStragglers(list) {
+  var durations = {};
+  list.forEach(function(a) {
+    if (a.running || a.state != "OK") return;
+    (durations[a.task.op] = durations[a.task.op] || []).push(a.end - a.start);
+  });
+  var medians = {};
+  for (var op in durations) {
+    var d = durations[op].sort(function(a, b) { return a - b; });
+    medians[op] = d[Math.floor(d.length/2)];
+  }
+  list.forEach(function(a) {
+    var median = medians[a.task.op], dur = a.end - a.start;
+    var slow = median !== undefined && dur >= stragglerMin && dur > stragglerFactor*median;
+    var p = a.task.progress;
+    a.progressing = slow && a.running && a.index == a.task.attempts.length-1 &&
+      p !== undefined && a.end - Date.parse(p.updated) < progressWindow;
+    a.straggler = slow && !a.progressing;
+  });
+}
+
+function render() {
+  var select = document.getElementById("invocation");
+  var invs = {};
+  graph.tasks.forEach(function(t) { invs[t.invocation] = true; });
+  Object.keys(invs).map(Number).sort(function(a, b) { return a - b; }).forEach(function(k) {
+    if (select.querySelector('option[value="' + k + '"]')) return;
+    var o = document.createElement("option");
+    o.value = k;
+    o.textContent = "invocation " + k;
+    select.appendChild(o);
+  });
+
+  var now = Date.now(), list = attempts(now);
+  markStragglers(list);
+  var svg = document.getElementById("svg");
+  while (svg.firstChild) svg.removeChild(svg.firstChild);
+  if (!list.length) {
+    svg.appendChild(el("text", {x: 0, y: 14}, "No task attempts."));
+    return;
+  }
+  var t0 = Math.min.apply(null, list.map(function(a) { return a.start; }));
+  var t1 = Math.max.apply(null, list.map(function(a) { return a.end; }));
+  var span = Math.max(t1 - t0, 1);
+  var width = Math.max(document.getElementById("timeline").clientWidth - 20 - labelWidth, 400);
+  function x(t) { return labelWidth + (t - t0) / span * width; }
+
+  // Pack each machine's attempts into rows, so that concurrent
+  // attempts do not overlap.
+  var machines = {};
+  list.sort(function(a, b) { return a.start - b.start; }).forEach(function(a) {
+    var m = machines[a.machine] = machines[a.machine] || {rows: [], busy: 0, lastEnd: 0};
+    var row = 0;
+    while (row < m.rows.length && m.rows[row] > a.start) row++;
+    m.rows[row] = a.end;
+    a.row = row;
+    // Accumulate the time during which the machine was running any
+    // attempt, to compute its utilization.
+    if (a.end > m.lastEnd) {
+      m.busy += a.end - Math.max(a.start, m.lastEnd);
+      m.lastEnd = a.end;
+    }
+  });
+  var names = Object.keys(machines).sort();
+  var y = axisHeight;
+  names.forEach(function(name) {
+    machines[name].y = y;
+    y += machines[name].rows.length*rowHeight + laneGap;
+  });
+  svg.setAttribute("width", labelWidth + width + 10);
+  svg.setAttribute("height", y + 10);
+
+  for (var i = 0; i <= 10; i++) {
+    var tx = labelWidth + i*width/10;
+    svg.appendChild(el("line", {"class": "tick", x1: tx, x2: tx, y1: axisHeight - 4, y2: y}));
+    svg.appendChild(el("text", {x: tx + 2, y: axisHeight - 8}, fmtDuration(i*span/10)));
+  }
+  names.forEach(function(name) {
+    var m = machines[name];
+    svg.appendChild(el("line", {"class": "lane", x1: 0, x2: labelWidth + width, y1: m.y - laneGap/2, y2: m.y - laneGap/2}));
+    var label = name.length > 24 ? "…" + name.substr(name.length - 23) : name;
+    var text = el("text", {x: 0, y: m.y + 11}, label + " " + Math.round(100*m.busy/span) + "%");
+    text.appendChild(el("title", {}, name + ": busy " + fmtDuration(m.busy) + " of " + fmtDuration(span)));
+    svg.appendChild(text);
+  });
+  var counts = {}, stragglers = 0, progressing = 0;
+  list.forEach(function(a) {
+    counts[a.state] = (counts[a.state] || 0) + 1;
+    if (a.straggler) stragglers++;
+    if (a.progressing) progressing++;
+    var m = machines[a.machine];
+    var cls = a.straggler ? " straggler" : a.progressing ? " progressing" : "";
+    var p = a.running && a.task.progress;
+    var rect = el("rect", {"class": "attempt" + cls,
+      x: x(a.start), y: m.y + a.row*rowHeight + 1,
+      width: Math.max(x(a.end) - x(a.start), 1), height: rowHeight - 2,
+      fill: colors[a.state] || "#ccc"});
+    rect.appendChild(el("title", {}, a.task.name + " (attempt " + (a.index + 1) + ")\n" +
+      a.machine + "\n" + a.state + " " + fmtDuration(a.end - a.start) +
+      (a.straggler ? " (straggler)" : "") + (a.progressing ? " (slow, progressing)" : "") +
+      (p ? "\nprogress: " + p.records + " records" + (p.message ? "; " + p.message : "") +
+        " (" + fmtDuration(now - Date.parse(p.updated)) + " ago)" : "") +
+      (a.error ? "\n" + a.error : "")));
+    svg.appendChild(rect);
+  });
+  document.getElementById("summary").textContent = " " + list.length + " attempts on " +
+    names.length + " machines over " + fmtDuration(span) + "; " +
+    states.filter(function(s) { return counts[s]; }).map(function(s) { return s + " " + counts[s]; }).join("  ") +
+    (stragglers ? "; " + stragglers + " stragglers" : "") +
+    (progressing ? "; " + progressing + " slow but progressing" : "");
+}
+
+document.getElementById("invocation").addEventListener("change", function(e) {
+  selectedInv = e.target.value;
+  render();
+});
+
+function refresh() {
+  fetch("/debug/dag/graph").then(function(r) { return r.json(); }).then(function(g) {
+    graph = g;
+    render();
+  }).catch(function(err) { console.log(err); });
+}
+
+refresh();
+setInterval(function() {
+  if (document.getElementById("live").checked) refresh();
+}, 2000);
+window.addEventListener("resize", function() { if (graph) render(); });
+</script>
+</body>
+</html>
+`
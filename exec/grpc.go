@@ -0,0 +1,1177 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/backgroundcontext"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/eventlog"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/base/retry"
+	"github.com/grailbio/base/status"
+	"github.com/grailbio/base/sync/ctxsync"
+	"github.com/grailbio/base/sync/once"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// The gRPC executor runs tasks on a static set of pre-provisioned worker
+// agents. Agents are processes, started out-of-band (e.g., by systemd or
+// Nomad), that run the same binary as the driver and serve a bigslice
+// worker over gRPC; see RegisterGRPCAgent. Agents read task dependencies
+// directly from each other, so every agent must be able to dial every
+// other agent at the address by which the driver knows it.
+//
+// The wire protocol piggybacks on the worker service used by the
+// bigmachine executor: calls carry gob-encoded arguments and replies of
+// the worker's methods, so that no protocol buffer definitions are
+// required.
+
+const (
+	grpcServiceName = "bigslice.Worker"
+	// grpcDetachTimeout bounds the time that a session spends releasing
+	// its agents when it shuts down.
+	grpcDetachTimeout = 10 * time.Second
+	// grpcChunkSize is the size of the chunks in which task outputs are
+	// streamed from agents.
+	grpcChunkSize = 1 << 20
+)
+
+var (
+	typeOfReader        = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	typeOfReadCloserPtr = reflect.TypeOf((*io.ReadCloser)(nil))
+)
+
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+// GobCodec is a gRPC codec that gob-encodes messages.
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	return b.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(p []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(p)).Decode(v)
+}
+
+func (gobCodec) Name() string { return "bigslice-gob" }
+
+// GRPCRequest is the request message of gRPC agent calls.
+type grpcRequest struct {
+	// Method is the name of the called method, e.g., "Worker.Run".
+	Method string
+	// Arg is the gob-encoded argument of the call. Arguments of type
+	// io.Reader are sent verbatim.
+	Arg []byte
+	// Session is the key of the session on whose behalf the call is
+	// made. It is checked by shared agents.
+	Session string
+}
+
+// GRPCReply is the reply message of unary gRPC agent calls.
+type grpcReply struct {
+	// Reply is the gob-encoded reply of the call.
+	Reply []byte
+	// Err is the error returned by the call, if any.
+	Err *errors.Error
+}
+
+// GRPCChunk is a message in the stream of a streaming call, e.g., a
+// read, to a gRPC agent.
+type grpcChunk struct {
+	Data []byte
+	// Err is the error that terminated the stream, if any.
+	Err *errors.Error
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Call", Handler: grpcCallHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Stream", Handler: grpcStreamHandler, ServerStreams: true},
+	},
+}
+
+// GRPCAgentConfig is the argument to Agent.Attach.
+type grpcAgentConfig struct {
+	MachineCombiners    bool
+	Deterministic       bool
+	ShuffleFetchLimit   int
+	CombinerKeyDictSize int
+	DiskEviction        DiskEvictionPolicy
+
+	// Session is a key that identifies the attaching session. Sessions
+	// present the same key to all of their agents, which present it in
+	// turn to their peers.
+	Session string
+	// User and Token are the credentials of the session's user, which
+	// are checked by shared agents.
+	User, Token string
+}
+
+// GRPCAgentInfo is the reply to Agent.Attach.
+type grpcAgentInfo struct {
+	// Procs is the number of processors available to the agent.
+	Procs int
+}
+
+// A grpcAgent serves a bigslice worker over gRPC.
+type grpcAgent struct {
+	procs    int
+	dialOpts []grpc.DialOption
+	// governor enforces the agent's policy, if it is shared.
+	governor *grpcGovernor
+
+	mu      sync.Mutex
+	worker  *worker
+	session string
+	clients map[string]*grpcClient
+}
+
+// RegisterGRPCAgent registers a bigslice worker agent with the provided
+// gRPC server. Procs is the number of processors the agent makes available
+// for running tasks; if zero, GOMAXPROCS is used. The dial options are
+// used to dial peer agents; if none are provided, connections are
+// insecure.
+//
+// Agents are used by sessions configured with the GRPC option; they must
+// run the same binary as the session's driver. An agent serves a single
+// session at a time: a session that attaches to an agent discards the
+// state left by previous sessions.
+//
+// For example, a binary may serve an agent when given a flag:
+//
+//	if *agentAddr != "" {
+//		lis, err := net.Listen("tcp", *agentAddr)
+//		...
+//		server := grpc.NewServer()
+//		if err := exec.RegisterGRPCAgent(server, 0); err != nil {
+//			log.Fatal(err)
+//		}
+//		log.Fatal(server.Serve(lis))
+//	}
+func RegisterGRPCAgent(server *grpc.Server, procs int, dialOpts ...grpc.DialOption) error {
+	return registerGRPCAgent(server, procs, nil, dialOpts)
+}
+
+// RegisterSharedGRPCAgent registers a bigslice worker agent, like
+// RegisterGRPCAgent, that is shared by the sessions of many users
+// according to the provided policy: sessions must present credentials
+// (see GRPCCredentials) and may not attach to an agent that is held by
+// another session. Shared agents should be dialed with transport
+// security, both by sessions and by each other.
+func RegisterSharedGRPCAgent(server *grpc.Server, procs int, policy GRPCPolicy, dialOpts ...grpc.DialOption) error {
+	return registerGRPCAgent(server, procs, newGRPCGovernor(policy), dialOpts)
+}
+
+func registerGRPCAgent(server *grpc.Server, procs int, governor *grpcGovernor, dialOpts []grpc.DialOption) error {
+	if procs == 0 {
+		procs = runtime.GOMAXPROCS(0)
+	}
+	a := &grpcAgent{
+		procs:    procs,
+		dialOpts: dialOpts,
+		governor: governor,
+	}
+	if _, err := a.reset(grpcAgentConfig{}); err != nil {
+		return err
+	}
+	server.RegisterService(&grpcServiceDesc, a)
+	return nil
+}
+
+// Reset replaces the agent's worker with a new one, configured by
+// config, and removes the storage held by the previous worker. Peer
+// connections are redialed on behalf of the new session.
+func (a *grpcAgent) reset(config grpcAgentConfig) (*worker, error) {
+	w := &worker{
+		MachineCombiners:    config.MachineCombiners,
+		Deterministic:       config.Deterministic,
+		ShuffleFetchLimit:   config.ShuffleFetchLimit,
+		CombinerKeyDictSize: config.CombinerKeyDictSize,
+		DiskEviction:        config.DiskEviction,
+		dial:                a.dial,
+	}
+	if err := w.init(a.procs); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	prev, clients := a.worker, a.clients
+	a.worker = w
+	a.session = config.Session
+	a.clients = make(map[string]*grpcClient)
+	a.mu.Unlock()
+	for _, c := range clients {
+		c.Close() // nolint: errcheck
+	}
+	if prev != nil {
+		if store, ok := prev.store.(*fileStore); ok {
+			if err := os.RemoveAll(store.Prefix); err != nil {
+				log.Error.Printf("grpc agent: removing %s: %v", store.Prefix, err)
+			}
+		}
+	}
+	return w, nil
+}
+
+// Dial returns a client for the peer agent at addr.
+func (a *grpcAgent) dial(ctx context.Context, addr string) (workerClient, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c := a.clients[addr]; c != nil {
+		return c, nil
+	}
+	c, err := dialGRPC(ctx, addr, a.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	c.session = a.session
+	a.clients[addr] = c
+	return c, nil
+}
+
+// Attach resets the agent for use by a new session.
+func (a *grpcAgent) Attach(ctx context.Context, config grpcAgentConfig, info *grpcAgentInfo) error {
+	if a.governor != nil {
+		if err := a.governor.Attach(ctx, config); err != nil {
+			return err
+		}
+	}
+	if _, err := a.reset(config); err != nil {
+		return err
+	}
+	info.Procs = a.procs
+	return nil
+}
+
+// Detach releases the agent from the session on whose behalf it is
+// called, discarding the session's state.
+func (a *grpcAgent) Detach(ctx context.Context, session string, _ *struct{}) error {
+	a.mu.Lock()
+	current := a.session
+	a.mu.Unlock()
+	if session != current {
+		return nil
+	}
+	if a.governor != nil {
+		a.governor.Detach(ctx, session)
+	}
+	_, err := a.reset(grpcAgentConfig{})
+	return err
+}
+
+// authorize admits a call on behalf of the provided session. All calls
+// are admitted by agents that are not shared.
+func (a *grpcAgent) authorize(ctx context.Context, method, session string) error {
+	if a.governor == nil {
+		return nil
+	}
+	switch method {
+	case "Agent.Attach", "Agent.Detach", "Worker.FuncLocations":
+		// Attach authenticates the session; Detach checks its key.
+		// Func locations are checked before sessions attach.
+		return nil
+	}
+	return a.governor.Authorize(ctx, session)
+}
+
+// method returns the method named by the provided service method, e.g.,
+// "Worker.Run" or "Agent.Attach".
+func (a *grpcAgent) method(serviceMethod string) (reflect.Value, bool) {
+	parts := strings.SplitN(serviceMethod, ".", 2)
+	if len(parts) != 2 {
+		return reflect.Value{}, false
+	}
+	var rcvr interface{}
+	switch parts[0] {
+	case "Agent":
+		rcvr = a
+	case "Worker":
+		a.mu.Lock()
+		rcvr = a.worker
+		a.mu.Unlock()
+	default:
+		return reflect.Value{}, false
+	}
+	m := reflect.ValueOf(rcvr).MethodByName(parts[1])
+	if !m.IsValid() || m.Type().NumIn() != 3 || m.Type().In(2).Kind() != reflect.Ptr {
+		return reflect.Value{}, false
+	}
+	return m, true
+}
+
+func (a *grpcAgent) call(ctx context.Context, req *grpcRequest) (reply *grpcReply) {
+	if err := a.authorize(ctx, req.Method, req.Session); err != nil {
+		return &grpcReply{Err: errors.Recover(err)}
+	}
+	if a.governor != nil && req.Method == "Worker.LoadPlugins" {
+		// Plugins are arbitrary code, and would be shared by all of the
+		// agent's sessions.
+		return &grpcReply{Err: errors.Recover(errors.E(errors.NotAllowed, "shared agents do not load plugins"))}
+	}
+	if a.governor != nil && req.Method == "Worker.Compile" {
+		defer func() {
+			var err error
+			if reply.Err != nil {
+				err = reply.Err
+			}
+			a.governor.AuditCompile(req.Session, req.Arg, err)
+		}()
+	}
+	m, ok := a.method(req.Method)
+	if !ok {
+		return &grpcReply{Err: errors.Recover(errors.E(errors.NotSupported, "no such method "+req.Method))}
+	}
+	typ := m.Type()
+	if typ.In(2) == typeOfReadCloserPtr {
+		return &grpcReply{Err: errors.Recover(errors.E(errors.NotSupported, req.Method+" must be called as a stream"))}
+	}
+	arg, err := decodeGRPCArg(req, typ.In(1))
+	if err != nil {
+		return &grpcReply{Err: errors.Recover(err)}
+	}
+	rep := reflect.New(typ.In(2).Elem())
+	out := m.Call([]reflect.Value{reflect.ValueOf(ctx), arg, rep})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return &grpcReply{Err: errors.Recover(err)}
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(rep.Interface()); err != nil {
+		return &grpcReply{Err: errors.Recover(errors.E(errors.Invalid, "encoding reply of "+req.Method, err))}
+	}
+	return &grpcReply{Reply: b.Bytes()}
+}
+
+func grpcCallHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(grpcRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	return srv.(*grpcAgent).call(ctx, req), nil
+}
+
+// decodeGRPCArg decodes the argument of the call req to a method whose
+// argument is of type typ.
+func decodeGRPCArg(req *grpcRequest, typ reflect.Type) (reflect.Value, error) {
+	if typ == typeOfReader {
+		return reflect.ValueOf(bytes.NewReader(req.Arg)), nil
+	}
+	ptr := reflect.New(typ)
+	if err := gob.NewDecoder(bytes.NewReader(req.Arg)).Decode(ptr.Interface()); err != nil {
+		return reflect.Value{}, errors.E(errors.Invalid, "decoding argument to "+req.Method, err)
+	}
+	return ptr.Elem(), nil
+}
+
+// grpcStreamHandler serves calls to methods whose reply is an
+// *io.ReadCloser, e.g., Worker.Read. The reply is streamed to the caller
+// in chunks.
+func grpcStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	a := srv.(*grpcAgent)
+	var req grpcRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	if err := a.authorize(stream.Context(), req.Method, req.Session); err != nil {
+		return stream.SendMsg(&grpcChunk{Err: errors.Recover(err)})
+	}
+	m, ok := a.method(req.Method)
+	if !ok || m.Type().In(2) != typeOfReadCloserPtr {
+		return stream.SendMsg(&grpcChunk{Err: errors.Recover(errors.E(errors.NotSupported, "no such streaming method "+req.Method))})
+	}
+	arg, err := decodeGRPCArg(&req, m.Type().In(1))
+	if err != nil {
+		return stream.SendMsg(&grpcChunk{Err: errors.Recover(err)})
+	}
+	var rc io.ReadCloser
+	out := m.Call([]reflect.Value{reflect.ValueOf(stream.Context()), arg, reflect.ValueOf(&rc)})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return stream.SendMsg(&grpcChunk{Err: errors.Recover(err)})
+	}
+	defer rc.Close() // nolint: errcheck
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if sendErr := stream.SendMsg(&grpcChunk{Data: buf[:n]}); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return stream.SendMsg(&grpcChunk{Err: errors.Recover(err)})
+		}
+	}
+}
+
+// A grpcClient is a workerClient for a gRPC agent.
+type grpcClient struct {
+	addr string
+	conn *grpc.ClientConn
+	// session is the session key presented with each call.
+	session string
+}
+
+func dialGRPC(ctx context.Context, addr string, opts ...grpc.DialOption) (*grpcClient, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	opts = append(opts, grpc.WithDefaultCallOptions(
+		grpc.CallContentSubtype(gobCodec{}.Name()),
+		grpc.MaxCallRecvMsgSize(math.MaxInt32),
+		grpc.MaxCallSendMsgSize(math.MaxInt32),
+	))
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return nil, errors.E(errors.Net, "dialing "+addr, err)
+	}
+	return &grpcClient{addr: addr, conn: conn}, nil
+}
+
+// grpcError translates gRPC transport errors. Unavailable agents are
+// considered temporary failures.
+func grpcError(serviceMethod string, err error) error {
+	switch grpcstatus.Code(err) {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Unavailable:
+		return errors.E(errors.Net, errors.Temporary, serviceMethod, err)
+	default:
+		return errors.E(errors.Net, serviceMethod, err)
+	}
+}
+
+// Call calls the provided service method on the agent. If the reply is
+// an *io.ReadCloser, as it is for "Worker.Read", the method's reply is
+// streamed through it. Errors returned by the method itself are
+// marked errors.Remote.
+func (c *grpcClient) Call(ctx context.Context, serviceMethod string, arg, reply interface{}) error {
+	var req grpcRequest
+	req.Method = serviceMethod
+	req.Session = c.session
+	if r, ok := arg.(io.Reader); ok {
+		p, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		req.Arg = p
+	} else {
+		var b bytes.Buffer
+		if err := gob.NewEncoder(&b).Encode(arg); err != nil {
+			return errors.E(errors.Invalid, "encoding argument to "+serviceMethod, err)
+		}
+		req.Arg = b.Bytes()
+	}
+	if rc, ok := reply.(*io.ReadCloser); ok {
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := c.conn.NewStream(ctx, &grpcServiceDesc.Streams[0], "/"+grpcServiceName+"/Stream")
+		if err == nil {
+			err = stream.SendMsg(&req)
+		}
+		if err == nil {
+			err = stream.CloseSend()
+		}
+		if err != nil {
+			cancel()
+			return grpcError(serviceMethod, err)
+		}
+		*rc = &grpcStreamReader{method: serviceMethod, stream: stream, cancel: cancel}
+		return nil
+	}
+	var rep grpcReply
+	if err := c.conn.Invoke(ctx, "/"+grpcServiceName+"/Call", &req, &rep); err != nil {
+		return grpcError(serviceMethod, err)
+	}
+	if rep.Err != nil {
+		return errors.E(errors.Remote, rep.Err)
+	}
+	if reply == nil {
+		return nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(rep.Reply)).Decode(reply); err != nil {
+		return errors.E(errors.Invalid, "decoding reply of "+serviceMethod, err)
+	}
+	return nil
+}
+
+// RetryCall calls the provided service method, retrying temporary
+// failures according to the default retry policy.
+func (c *grpcClient) RetryCall(ctx context.Context, serviceMethod string, arg, reply interface{}) error {
+	for retries := 0; ; retries++ {
+		if err := c.Call(ctx, serviceMethod, arg, reply); err == nil || !errors.IsTemporary(err) {
+			return err
+		}
+		if err := retry.Wait(ctx, retryPolicy, retries); err != nil {
+			return errors.E(errors.Fatal, err)
+		}
+	}
+}
+
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
+
+// grpcStreamReader is an io.ReadCloser that reads a stream of
+// grpcChunks.
+type grpcStreamReader struct {
+	method string
+	stream grpc.ClientStream
+	cancel func()
+	buf    []byte
+	err    error
+}
+
+func (r *grpcStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 && r.err == nil {
+		var chunk grpcChunk
+		switch err := r.stream.RecvMsg(&chunk); {
+		case err == io.EOF:
+			r.err = io.EOF
+		case err != nil:
+			r.err = grpcError(r.method, err)
+		case chunk.Err != nil:
+			r.err = errors.E(errors.Remote, chunk.Err)
+		default:
+			r.buf = chunk.Data
+		}
+	}
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *grpcStreamReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// GRPCStatusGroup is the name of the group used by the gRPC executor to
+// report the status of its agents.
+const GRPCStatusGroup = "grpc"
+
+// A grpcMachine is a gRPC agent used by the executor.
+type grpcMachine struct {
+	*grpcClient
+	status *status.Task
+
+	// The following are guarded by the executor's mutex.
+
+	// procs is the number of processors available on the agent.
+	procs int
+	// load is the number of processors used by tasks running on the
+	// agent.
+	load int
+	// attached indicates whether the agent is attached to the session.
+	// Agents are detached when they are lost, and reattached before
+	// they are used again.
+	attached bool
+
+	// compiles and commits are reset whenever the agent is attached.
+	compiles *once.Map
+	commits  *once.Map
+
+	// plugins tracks the driver's plugins that have been loaded by the
+	// agent. It is reset whenever the agent is attached, as the agent
+	// may have restarted.
+	plugins pluginSync
+}
+
+// grpcExecutor is an executor that runs tasks on a static set of gRPC
+// agents.
+type grpcExecutor struct {
+	addrs    []string
+	dialOpts []grpc.DialOption
+	// session is the key that identifies the session to its agents.
+	session string
+
+	sess        *Session
+	invocations *invocationSet
+	status      *status.Group
+
+	mu        sync.Mutex
+	cond      *ctxsync.Cond
+	machines  []*grpcMachine
+	locations map[*Task]*grpcMachine
+}
+
+func newGRPCExecutor(addrs []string, dialOpts ...grpc.DialOption) *grpcExecutor {
+	return &grpcExecutor{addrs: addrs, dialOpts: dialOpts}
+}
+
+func (g *grpcExecutor) Name() string {
+	return "grpc"
+}
+
+// Start dials each of the executor's agents. It panics if any agent runs
+// a binary with a different set of Funcs than the driver.
+func (g *grpcExecutor) Start(sess *Session) (shutdown func()) {
+	g.sess = sess
+	g.invocations = newInvocationSet()
+	g.cond = ctxsync.NewCond(&g.mu)
+	g.locations = make(map[*Task]*grpcMachine)
+	if status := sess.Status(); status != nil {
+		g.status = status.Group(GRPCStatusGroup)
+	}
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		log.Panicf("exec.GRPC: generating session key: %v", err)
+	}
+	g.session = hex.EncodeToString(key[:])
+	ctx := backgroundcontext.Get()
+	for _, addr := range g.addrs {
+		c, err := dialGRPC(ctx, addr, g.dialOpts...)
+		if err != nil {
+			log.Panicf("exec.GRPC: %v", err)
+		}
+		c.session = g.session
+		m := &grpcMachine{grpcClient: c}
+		if g.status != nil {
+			m.status = g.status.Start(addr)
+		}
+		g.machines = append(g.machines, m)
+	}
+	var group errgroup.Group
+	for _, m := range g.machines {
+		m := m
+		group.Go(func() error {
+			// Plugins are loaded first, so that the agent's Funcs may be
+			// compared with those of the driver.
+			if err := m.plugins.Sync(ctx, m, &processPlugins); err != nil {
+				log.Error.Printf("agent %s: loading plugins: %v", m.addr, err)
+			}
+			var funcLocs []string
+			if err := m.RetryCall(ctx, "Worker.FuncLocations", struct{}{}, &funcLocs); err != nil {
+				// The agent may become available later; it is attached on
+				// first use.
+				log.Error.Printf("agent %s: %v", m.addr, err)
+				return nil
+			}
+			if diff := bigslice.FuncLocationsDiff(bigslice.FuncLocations(), funcLocs); len(diff) > 0 {
+				for _, edit := range diff {
+					log.Printf("[funcsdiff] %s", edit)
+				}
+				return fmt.Errorf("agent %s has different funcs; check for local or non-deterministic Func creation", m.addr)
+			}
+			err := g.attach(ctx, m)
+			if hasGRPCError(err, errGRPCInUse) {
+				// The shared agent may be released later; it is attached
+				// on first use.
+				log.Error.Printf("agent %s: %v", m.addr, err)
+				return nil
+			}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		log.Panicf("exec.GRPC: %v", err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(ctx, grpcDetachTimeout)
+		defer cancel()
+		for _, m := range g.machines {
+			g.mu.Lock()
+			attached := m.attached
+			g.mu.Unlock()
+			if attached {
+				// Release the agent so that it may be used by other
+				// sessions.
+				if err := m.Call(ctx, "Agent.Detach", g.session, nil); err != nil {
+					log.Error.Printf("agent %s: detach: %v", m.addr, err)
+				}
+			}
+			m.Close() // nolint: errcheck
+			if m.status != nil {
+				m.status.Done()
+			}
+		}
+	}
+}
+
+// attach attaches the agent m to the session, unless it is already
+// attached.
+func (g *grpcExecutor) attach(ctx context.Context, m *grpcMachine) error {
+	g.mu.Lock()
+	attached := m.attached
+	g.mu.Unlock()
+	if attached {
+		return nil
+	}
+	config := grpcAgentConfig{
+		MachineCombiners:    g.sess.machineCombiners,
+		Deterministic:       g.sess.deterministic,
+		ShuffleFetchLimit:   g.sess.shuffleFetchLimit,
+		CombinerKeyDictSize: g.sess.combinerKeyDictSize,
+		DiskEviction:        g.sess.diskEviction,
+		Session:             g.session,
+		User:                g.sess.grpcUser,
+		Token:               g.sess.grpcToken,
+	}
+	var info grpcAgentInfo
+	if err := m.RetryCall(ctx, "Agent.Attach", config, &info); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	m.procs = info.Procs
+	m.attached = true
+	m.compiles = new(once.Map)
+	m.commits = new(once.Map)
+	g.mu.Unlock()
+	m.plugins.Reset()
+	g.updateStatus(m)
+	g.cond.Broadcast()
+	return nil
+}
+
+// lost detaches the agent m, and marks all tasks whose outputs reside
+// on it as lost, so that they are recomputed.
+func (g *grpcExecutor) lost(m *grpcMachine) {
+	var tasks []*Task
+	g.mu.Lock()
+	m.attached = false
+	for task, loc := range g.locations {
+		if loc == m {
+			tasks = append(tasks, task)
+			delete(g.locations, task)
+		}
+	}
+	g.mu.Unlock()
+	for _, task := range tasks {
+		task.Set(TaskLost)
+	}
+	if m.status != nil {
+		m.status.Print("lost")
+	}
+}
+
+// evicted marks the named tasks, whose outputs were evicted from the
+// agent m, as lost, so that they are recomputed if they are needed
+// again.
+func (g *grpcExecutor) evicted(m *grpcMachine, names []TaskName) {
+	if len(names) == 0 {
+		return
+	}
+	evicted := make(map[TaskName]bool)
+	for _, name := range names {
+		evicted[name] = true
+	}
+	var tasks []*Task
+	g.mu.Lock()
+	for task, loc := range g.locations {
+		if loc == m && evicted[task.Name] {
+			tasks = append(tasks, task)
+			delete(g.locations, task)
+		}
+	}
+	g.mu.Unlock()
+	for _, task := range tasks {
+		task.Set(TaskLost)
+	}
+}
+
+func (g *grpcExecutor) updateStatus(m *grpcMachine) {
+	if m.status == nil {
+		return
+	}
+	g.mu.Lock()
+	load, procs := m.load, m.procs
+	g.mu.Unlock()
+	m.status.Printf("procs %d/%d", load, procs)
+}
+
+// acquire waits for an agent with capacity for a task that needs the
+// provided number of processors, and reserves that capacity. Lost agents
+// are retried when no other agent is available. It returns the agent
+// and the number of processors reserved.
+func (g *grpcExecutor) acquire(ctx context.Context, procs int, exclusive bool) (*grpcMachine, int, error) {
+	maxLoad := g.sess.MaxLoad()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for retries := 0; ; {
+		var (
+			best     *grpcMachine
+			bestNeed int
+			attached bool
+			detached []*grpcMachine
+		)
+		for _, m := range g.machines {
+			if !m.attached {
+				detached = append(detached, m)
+				continue
+			}
+			attached = true
+			need := procs
+			if exclusive || need > m.procs {
+				need = m.procs
+			}
+			capacity := int(math.Ceil(float64(m.procs) * maxLoad))
+			if m.load+need > capacity {
+				continue
+			}
+			if best == nil || m.load < best.load {
+				best, bestNeed = m, need
+			}
+		}
+		if best != nil {
+			best.load += bestNeed
+			return best, bestNeed, nil
+		}
+		if len(detached) > 0 {
+			// Try to reattach lost agents. Other callers may use an agent
+			// once it is attached.
+			g.mu.Unlock()
+			var err error
+			for _, m := range detached {
+				if err = g.attach(ctx, m); err == nil {
+					break
+				}
+				log.Error.Printf("agent %s: %v", m.addr, err)
+			}
+			if err != nil && !attached {
+				// No agents are available: back off before retrying.
+				if err = retry.Wait(ctx, retryPolicy, retries); err != nil {
+					err = errors.E(errors.Unavailable, "no gRPC agents are available", err)
+				}
+				retries++
+			}
+			g.mu.Lock()
+			switch {
+			case err == nil:
+				continue
+			case !attached:
+				return nil, 0, err
+			}
+		}
+		if err := g.cond.Wait(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (g *grpcExecutor) release(m *grpcMachine, procs int) {
+	g.mu.Lock()
+	m.load -= procs
+	g.mu.Unlock()
+	g.cond.Broadcast()
+	g.updateStatus(m)
+}
+
+func (g *grpcExecutor) compile(ctx context.Context, m *grpcMachine, inv execInvocation) error {
+	invocations, encoded, err := g.invocations.Add(inv)
+	if err != nil {
+		return err
+	}
+	if err := m.plugins.Sync(ctx, m, &processPlugins); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	compiles := m.compiles
+	g.mu.Unlock()
+	for i := range invocations {
+		err := compiles.Do(invocations[i].Index, func() error {
+			// Each attempt consumes its reader, so we retry with fresh ones.
+			for retries := 0; ; retries++ {
+				err := m.Call(ctx, "Worker.Compile", bytes.NewReader(encoded[i]), nil)
+				if err == nil || !errors.IsTemporary(err) {
+					return err
+				}
+				if err := retry.Wait(ctx, retryPolicy, retries); err != nil {
+					return errors.E(errors.Fatal, err)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *grpcExecutor) Run(task *Task) {
+	ctx := backgroundcontext.Get()
+	if gpus := bigslice.PragmaGPUs(task.Pragma); gpus > 0 {
+		task.Error(errors.E(errors.Fatal, errors.NotSupported,
+			fmt.Sprintf("task %v needs %d GPUs, but the gRPC executor does not support GPUs", task, gpus)))
+		return
+	}
+	task.Status.Print("waiting for an agent")
+	// evalCtx is canceled when the task's evaluation ends, which cancels
+	// the task's run, but not the compilations and combiner commits that
+	// it shares with other tasks.
+	evalCtx := task.evalContext()
+	m, procs, err := g.acquire(evalCtx, task.Pragma.Procs(), task.Pragma.Exclusive())
+	if err != nil {
+		if evalCtx.Err() != nil && ctx.Err() == nil {
+			task.Set(TaskLost)
+		} else {
+			task.Error(err)
+		}
+		return
+	}
+	defer g.release(m, procs)
+	g.updateStatus(m)
+
+	if err := g.compile(ctx, m, task.Invocation); err != nil {
+		switch {
+		case hasGRPCError(err, errGRPCDetached):
+			task.Status.Printf("lost agent %s: %v", m.addr, err)
+			g.lost(m)
+			task.Set(TaskLost)
+		case errors.Is(errors.Remote, err), errors.Is(errors.Invalid, err) && errors.Match(fatalErr, err):
+			task.Errorf("failed to compile invocation on agent %s: %v", m.addr, err)
+		default:
+			task.Status.Printf("task lost while compiling bigslice.Func: %v", err)
+			if g.confirmLost(ctx, m) {
+				g.lost(m)
+			}
+			task.Set(TaskLost)
+		}
+		return
+	}
+
+	task.Lock()
+	req := taskRunRequest{
+		Name:       task.Name,
+		Invocation: task.Invocation.Index,
+		Trace:      injectTrace(task.spanContext),
+	}
+	task.Unlock()
+	var (
+		machineIndices = make(map[string]int)
+		group          errgroup.Group
+	)
+	for _, dep := range task.Deps {
+		for i := 0; i < dep.NumTask(); i++ {
+			deptask := dep.Task(i)
+			depm := g.location(deptask)
+			if depm == nil {
+				task.Errorf("task %v has no location", deptask)
+				return
+			}
+			j, ok := machineIndices[depm.addr]
+			if !ok {
+				j = len(machineIndices)
+				machineIndices[depm.addr] = j
+				req.Machines = append(req.Machines, depm.addr)
+			}
+			req.Locations = append(req.Locations, j)
+			if key := dep.CombineKey; key != "" {
+				g.mu.Lock()
+				commits := depm.commits
+				g.mu.Unlock()
+				group.Go(func() error {
+					return commits.Do(key, func() error {
+						return depm.RetryCall(ctx, "Worker.CommitCombiner", TaskName{Op: key}, nil)
+					})
+				})
+			}
+		}
+	}
+	if err := group.Wait(); err != nil {
+		task.Errorf("failed to commit combiner: %v", err)
+		return
+	}
+
+	task.Status.Print(m.addr)
+	task.setRunning(m.addr)
+	var reply taskRunReply
+	progressCtx, progressCancel := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		monitorTaskProgress(progressCtx, m, task)
+		close(progressDone)
+	}()
+	if g.sess.status != nil {
+		scopeCtx, scopeCancel := context.WithCancel(ctx)
+		scopeDone := make(chan struct{})
+		go func() {
+			monitorTaskScope(scopeCtx, m, task)
+			close(scopeDone)
+		}()
+		err = runWorker(evalCtx, task, req, &reply, m.RetryCall)
+		scopeCancel()
+		<-scopeDone
+	} else {
+		err = runWorker(evalCtx, task, req, &reply, m.RetryCall)
+	}
+	progressCancel()
+	<-progressDone
+	switch {
+	case err == nil && g.sess.verifies(task):
+		if err := verifyRemote(ctx, m, task, req); err != nil {
+			task.Error(err)
+			return
+		}
+		fallthrough
+	case err == nil:
+		g.mu.Lock()
+		g.locations[task] = m
+		g.mu.Unlock()
+		task.Status.Printf("done: %s", reply.Vals)
+		task.Scope.Reset(&reply.Scope)
+		task.Progress.Reset(reply.Progress)
+		task.setVals(reply.Vals)
+		task.Set(TaskOk)
+		g.evicted(m, reply.Evicted)
+	case ctx.Err() != nil:
+		task.Error(err)
+	case evalCtx.Err() != nil:
+		// The task's evaluation has ended; it may be resubmitted by a
+		// later evaluation.
+		task.Status.Printf("canceled: %v", evalCtx.Err())
+		task.Set(TaskLost)
+	case hasGRPCError(err, errGRPCDetached):
+		// The session's lease on the shared agent expired; its outputs
+		// are lost, and it must be reattached before it is used again.
+		task.Status.Printf("lost agent %s: %v", m.addr, err)
+		g.lost(m)
+		task.Set(TaskLost)
+	case errors.Is(errors.Remote, err) && errors.Match(fatalErr, err):
+		// Fatal errors aren't retryable.
+		task.Error(err)
+	case errors.Is(errors.Remote, err):
+		// The task failed, e.g., because one of its dependencies could
+		// not be read. It is resubmitted by the evaluator.
+		task.Status.Printf("lost task during task evaluation: %v", err)
+		task.Set(TaskLost)
+	default:
+		// We could not reach the agent, so its outputs are presumed lost,
+		// unless a quorum of vantage points can still reach it; the task
+		// itself is lost either way.
+		task.Status.Printf("lost agent %s during task evaluation: %v", m.addr, err)
+		if g.confirmLost(ctx, m) {
+			g.lost(m)
+		}
+		task.Set(TaskLost)
+	}
+}
+
+func (g *grpcExecutor) location(task *Task) *grpcMachine {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.locations[task]
+}
+
+func (g *grpcExecutor) Reader(task *Task, partition int) sliceio.ReadCloser {
+	if g.location(task) == nil {
+		return sliceio.NopCloser(sliceio.ErrReader(errors.E(errors.NotExist, fmt.Sprintf("task %s", task.Name))))
+	}
+	if task.CombineKey != "" {
+		return sliceio.NopCloser(sliceio.ErrReader(fmt.Errorf("read %s: cannot read tasks with combine keys", task.Name)))
+	}
+	return &openerAtReader{
+		OpenerAt: &grpcEvalOpenerAt{executor: g, task: task, partition: partition},
+	}
+}
+
+// grpcEvalOpenerAt is an openerAt that evaluates a task before opening a
+// reader for one of its partitions, so that reads of lost outputs are
+// recomputed.
+type grpcEvalOpenerAt struct {
+	executor  *grpcExecutor
+	task      *Task
+	partition int
+	addr      string
+}
+
+// OpenAt implements openerAt.
+func (e *grpcEvalOpenerAt) OpenAt(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	if err := Eval(ctx, e.executor, []*Task{e.task}, nil); err != nil {
+		return nil, err
+	}
+	m := e.executor.location(e.task)
+	if m == nil {
+		return nil, errors.E(errors.NotExist, fmt.Sprintf("task %s", e.task.Name))
+	}
+	e.addr = m.addr
+	var r io.ReadCloser
+	err := m.RetryCall(ctx, "Worker.Read", readRequest{e.task.Name, e.partition, offset}, &r)
+	return r, err
+}
+
+func (e *grpcEvalOpenerAt) String() string {
+	return fmt.Sprintf("Worker.Read %s:%s:%d", e.addr, e.task.Name, e.partition)
+}
+
+func (g *grpcExecutor) Discard(ctx context.Context, task *Task) {
+	if !task.Combiner.IsNil() && task.CombineKey != "" {
+		// We do not yet handle tasks with shared combiners.
+		return
+	}
+	task.Lock()
+	if task.state != TaskOk {
+		task.Unlock()
+		return
+	}
+	task.state = TaskRunning
+	task.Unlock()
+	g.mu.Lock()
+	m := g.locations[task]
+	delete(g.locations, task)
+	g.mu.Unlock()
+	if m != nil {
+		if err := m.RetryCall(ctx, "Worker.Discard", task.Name, nil); err != nil {
+			log.Error.Printf("error discarding %v: %v", task, err)
+		}
+	}
+	task.Set(TaskLost)
+}
+
+// profile implements profiler.
+func (g *grpcExecutor) profile(ctx context.Context, addr string, p Profile) (io.ReadCloser, error) {
+	for _, m := range g.machines {
+		if m.addr != addr {
+			continue
+		}
+		var rc io.ReadCloser
+		if err := m.Call(ctx, "Worker.Profile", p, &rc); err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}
+	return nil, errors.E(errors.NotExist, fmt.Sprintf("agent %s", addr))
+}
+
+func (g *grpcExecutor) Eventer() eventlog.Eventer {
+	return g.sess.eventer
+}
+
+func (g *grpcExecutor) HandleDebug(handler *http.ServeMux) {}
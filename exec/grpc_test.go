@@ -0,0 +1,222 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice"
+	"google.golang.org/grpc"
+)
+
+// startGRPCAgents starts n gRPC agents on local ports, returning their
+// addresses.
+func startGRPCAgents(t *testing.T, n int) (addrs []string, stop func()) {
+	t.Helper()
+	return serveGRPCAgents(t, n, func(server *grpc.Server) error {
+		return RegisterGRPCAgent(server, 2)
+	})
+}
+
+// serveGRPCAgents starts n gRPC servers on local ports, registering an
+// agent with each by the provided function, and returns their
+// addresses.
+func serveGRPCAgents(t *testing.T, n int, register func(*grpc.Server) error) (addrs []string, stop func()) {
+	t.Helper()
+	var servers []*grpc.Server
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := grpc.NewServer()
+		if err := register(server); err != nil {
+			t.Fatal(err)
+		}
+		go server.Serve(lis) // nolint: errcheck
+		servers = append(servers, server)
+		addrs = append(addrs, lis.Addr().String())
+	}
+	return addrs, func() {
+		for _, server := range servers {
+			server.Stop()
+		}
+	}
+}
+
+var grpcTestFunc = bigslice.Func(func(nshard, n int) bigslice.Slice {
+	slice := bigslice.Const(nshard, rangeSlice(0, n))
+	slice = bigslice.Map(slice, func(i int) (int, int) { return i % 7, i })
+	return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+})
+
+func TestGRPCExecutor(t *testing.T) {
+	const N = 10000
+	addrs, stop := startGRPCAgents(t, 3)
+	defer stop()
+	want := make(map[int]int)
+	for i := 0; i < N; i++ {
+		want[i%7] += i
+	}
+	// Run twice, each time with a new session, to make sure that agents
+	// are properly reset between sessions.
+	for i := 0; i < 2; i++ {
+		sess := Start(GRPC(addrs), Parallelism(6))
+		ctx := context.Background()
+		res, err := sess.Run(ctx, grpcTestFunc, 10, N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[int]int)
+		scan := res.Scanner()
+		var k, v int
+		for scan.Scan(ctx, &k, &v) {
+			got[k] = v
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("key %d: got %v, want %v", k, got[k], v)
+			}
+		}
+		sess.Shutdown()
+	}
+}
+
+func TestGRPCExecutorError(t *testing.T) {
+	addrs, stop := startGRPCAgents(t, 2)
+	defer stop()
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, 100))
+		return bigslice.Map(slice, func(i int) int {
+			if i == 50 {
+				panic("fifty")
+			}
+			return i
+		})
+	})
+	sess := Start(GRPC(addrs))
+	defer sess.Shutdown()
+	_, err := sess.Run(context.Background(), fn)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "fifty") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent writes.
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func TestGRPCSharedAgents(t *testing.T) {
+	var audit syncBuffer
+	policy := GRPCPolicy{
+		Authenticate: func(ctx context.Context, user, token string) error {
+			if token != user+"-token" {
+				return fmt.Errorf("bad token for user %s", user)
+			}
+			return nil
+		},
+		Quota: func(user string) time.Duration {
+			if user == "bob" {
+				return time.Nanosecond
+			}
+			return 0
+		},
+		Audit: &audit,
+	}
+	addrs, stop := serveGRPCAgents(t, 2, func(server *grpc.Server) error {
+		return RegisterSharedGRPCAgent(server, 2, policy)
+	})
+	defer stop()
+	ctx := context.Background()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected unauthenticated session to panic")
+			}
+		}()
+		Start(GRPC(addrs), GRPCCredentials("mallory", "guess"))
+	}()
+
+	alice := Start(GRPC(addrs), GRPCCredentials("alice", "alice-token"))
+	if _, err := alice.Run(ctx, grpcTestFunc, 4, 1000); err != nil {
+		t.Fatal(err)
+	}
+	// The agents are held by alice, so carol's session attaches to them
+	// only once alice's session shuts down.
+	carol := Start(GRPC(addrs), GRPCCredentials("carol", "carol-token"))
+	alice.Shutdown()
+	if _, err := carol.Run(ctx, grpcTestFunc, 4, 1000); err != nil {
+		t.Fatal(err)
+	}
+	carol.Shutdown()
+
+	bob := Start(GRPC(addrs), GRPCCredentials("bob", "bob-token"))
+	_, err := bob.Run(ctx, grpcTestFunc, 4, 1000)
+	if err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("expected quota error, got %v", err)
+	}
+	bob.Shutdown()
+
+	events := make(map[string]map[string]bool)
+	scan := bufio.NewScanner(&audit)
+	for scan.Scan() {
+		var rec GRPCAuditRecord
+		if err := json.Unmarshal(scan.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if events[rec.User] == nil {
+			events[rec.User] = make(map[string]bool)
+		}
+		events[rec.User][rec.Event] = true
+		if rec.Event != "compile" {
+			continue
+		}
+		if !strings.Contains(rec.Func, "grpc_test.go") {
+			t.Errorf("unexpected func %s", rec.Func)
+		}
+		if got, want := rec.Args, []string{"4", "1000"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	for user, want := range map[string]map[string]bool{
+		"mallory": {"deny": true},
+		"alice":   {"attach": true, "compile": true, "detach": true},
+		// Carol's session was denied the agents while alice held them.
+		"carol": {"deny": true, "attach": true, "compile": true, "detach": true},
+		"bob":   {"attach": true, "deny": true, "detach": true},
+	} {
+		if got := events[user]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", user, got, want)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice"
+)
+
+// A GRPCPolicy governs the use of gRPC agents that form a standing
+// cluster shared by the sessions of many users. Such agents serve one
+// session at a time: a session holds an agent from the time it
+// attaches until it shuts down, or until it has made no calls to the
+// agent for the policy's lease timeout, after which another session
+// may take the agent over. Each user is charged for the machine time
+// of the agents held by their sessions, and the sessions of users who
+// have exhausted their quotas are refused.
+//
+// Users are identified by the credentials that sessions present with
+// the GRPCCredentials option. Credentials are sent in the clear unless
+// the agents are dialed with transport security.
+type GRPCPolicy struct {
+	// Authenticate returns an error if the provided token does not
+	// authenticate the named user. If nil, users are trusted to identify
+	// themselves.
+	Authenticate func(ctx context.Context, user, token string) error
+
+	// Quota returns the amount of machine time (i.e., machine-hours)
+	// that the named user may use, or zero if the user's use is
+	// unlimited. If nil, use is unlimited.
+	Quota func(user string) time.Duration
+
+	// Ledger accounts for the machine time used by each user. If nil,
+	// each agent keeps its own accounts, in memory, so that quotas apply
+	// separately to each agent, and are reset when the agent restarts.
+	Ledger GRPCLedger
+
+	// Audit, if not nil, is written the agent's audit log: a
+	// JSON-encoded GRPCAuditRecord per line.
+	Audit io.Writer
+
+	// LeaseTimeout is the amount of time after its last call that a
+	// session holds an agent. If zero, DefaultGRPCLeaseTimeout is used.
+	LeaseTimeout time.Duration
+}
+
+// DefaultGRPCLeaseTimeout is the default amount of time for which
+// sessions hold shared gRPC agents after their last call.
+const DefaultGRPCLeaseTimeout = 10 * time.Minute
+
+// A GRPCLedger accounts for the machine time used by the users of
+// shared gRPC agents. A ledger that is shared by all of a cluster's
+// agents, e.g., one that is backed by a database, enforces quotas
+// across the cluster. Ledgers must be safe for concurrent use.
+type GRPCLedger interface {
+	// Charge adds the provided amount of machine time to the named
+	// user's usage, and returns the user's total usage.
+	Charge(ctx context.Context, user string, d time.Duration) (time.Duration, error)
+}
+
+// memLedger is a GRPCLedger that keeps its accounts in memory.
+type memLedger struct {
+	mu    sync.Mutex
+	usage map[string]time.Duration
+}
+
+func (l *memLedger) Charge(ctx context.Context, user string, d time.Duration) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.usage == nil {
+		l.usage = make(map[string]time.Duration)
+	}
+	l.usage[user] += d
+	return l.usage[user], nil
+}
+
+// A GRPCAuditRecord is an entry in the audit log of a shared gRPC
+// agent.
+type GRPCAuditRecord struct {
+	// Time is the time of the audited event.
+	Time time.Time `json:"time"`
+	// Event is the kind of event: "attach" when a session attaches to
+	// the agent, "detach" when it shuts down or its lease expires,
+	// "deny" when a session or call is refused, and "compile" when a
+	// session invokes a Func.
+	Event string `json:"event"`
+	// User is the user on whose behalf the event occurred.
+	User string `json:"user"`
+	// Session identifies the session on whose behalf the event
+	// occurred.
+	Session string `json:"session,omitempty"`
+	// Func is the location of the definition of the invoked Func, and
+	// Location is the location of its invocation.
+	Func     string `json:"func,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Invocation is the index of the invocation.
+	Invocation uint64 `json:"invocation,omitempty"`
+	// Args holds the formatted arguments of the invocation.
+	Args []string `json:"args,omitempty"`
+	// Usage is the user's total machine time, as of the event.
+	Usage time.Duration `json:"usage,omitempty"`
+	// Error is the reason that a session or call was denied, or the
+	// error returned by a compilation.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	// errGRPCDetached is the message of errors returned for calls on
+	// behalf of sessions that do not hold a shared agent, e.g., because
+	// their leases expired.
+	errGRPCDetached = "shared agent: session is not attached"
+	// errGRPCInUse is the message of errors returned to sessions that
+	// attach to a shared agent that is held by another session.
+	errGRPCInUse = "shared agent: in use by another session"
+)
+
+// hasGRPCError tells whether err, as returned by a call to an agent,
+// carries an error with the provided message.
+func hasGRPCError(err error, message string) bool {
+	var found bool
+	errors.Visit(err, func(err error) {
+		if e, ok := err.(*errors.Error); ok && e.Message == message {
+			found = true
+		}
+	})
+	return found
+}
+
+// grpcLease is the hold of a session on a shared agent.
+type grpcLease struct {
+	session, user string
+	// last is the time of the session's last call; charged is the time
+	// up to which its user has been charged.
+	last, charged time.Time
+}
+
+// grpcGovernor enforces a GRPCPolicy on behalf of an agent.
+type grpcGovernor struct {
+	GRPCPolicy
+
+	auditMu sync.Mutex
+
+	mu    sync.Mutex
+	lease grpcLease
+}
+
+func newGRPCGovernor(policy GRPCPolicy) *grpcGovernor {
+	if policy.Ledger == nil {
+		policy.Ledger = new(memLedger)
+	}
+	if policy.LeaseTimeout == 0 {
+		policy.LeaseTimeout = DefaultGRPCLeaseTimeout
+	}
+	return &grpcGovernor{GRPCPolicy: policy}
+}
+
+// Attach authenticates the session described by config and grants it
+// a lease on the agent, unless the agent is held by another session or
+// the session's user has exhausted their quota.
+func (g *grpcGovernor) Attach(ctx context.Context, config grpcAgentConfig) error {
+	deny := func(err error) error {
+		g.audit(GRPCAuditRecord{Event: "deny", User: config.User, Session: config.Session, Error: err.Error()})
+		return err
+	}
+	if config.Session == "" {
+		return deny(errors.E(errors.NotAllowed, "shared agent: session has no key"))
+	}
+	if g.Authenticate != nil {
+		if err := g.Authenticate(ctx, config.User, config.Token); err != nil {
+			return deny(errors.E(errors.NotAllowed, fmt.Sprintf("shared agent: authenticating user %q", config.User), err))
+		}
+	}
+	now := time.Now()
+	g.mu.Lock()
+	prev := g.lease
+	if prev.session != "" && prev.session != config.Session && now.Sub(prev.last) < g.LeaseTimeout {
+		g.mu.Unlock()
+		return deny(errors.E(errors.Unavailable, errGRPCInUse, fmt.Errorf("held by user %q", prev.user)))
+	}
+	g.lease = grpcLease{session: config.Session, user: config.User, last: now, charged: now}
+	g.mu.Unlock()
+	switch prev.session {
+	case "":
+	case config.Session:
+		// The session is reattaching, e.g., after it lost contact with
+		// the agent.
+		g.charge(ctx, prev, now) // nolint: errcheck
+	default:
+		// The previous session's lease expired: charge it up to its
+		// last call.
+		g.charge(ctx, prev, prev.last) // nolint: errcheck
+		g.audit(GRPCAuditRecord{Event: "detach", User: prev.user, Session: prev.session})
+	}
+	usage, err := g.Ledger.Charge(ctx, config.User, 0)
+	if err == nil {
+		err = g.checkQuota(config.User, usage)
+	}
+	if err != nil {
+		g.mu.Lock()
+		if g.lease.session == config.Session {
+			g.lease = grpcLease{}
+		}
+		g.mu.Unlock()
+		return deny(err)
+	}
+	g.audit(GRPCAuditRecord{Event: "attach", User: config.User, Session: config.Session, Usage: usage})
+	return nil
+}
+
+// Authorize admits a call made on behalf of the provided session,
+// charging the session's user for the machine time used since the last
+// call. Calls are refused if the session does not hold the agent, or
+// if its user has exhausted their quota.
+func (g *grpcGovernor) Authorize(ctx context.Context, session string) error {
+	now := time.Now()
+	g.mu.Lock()
+	lease := g.lease
+	if session == "" || session != lease.session {
+		g.mu.Unlock()
+		return errors.E(errors.NotAllowed, errGRPCDetached)
+	}
+	g.lease.last, g.lease.charged = now, now
+	g.mu.Unlock()
+	usage, err := g.charge(ctx, lease, now)
+	if err != nil {
+		return err
+	}
+	if err := g.checkQuota(lease.user, usage); err != nil {
+		g.audit(GRPCAuditRecord{Event: "deny", User: lease.user, Session: session, Usage: usage, Error: err.Error()})
+		return errors.E(errors.Fatal, err)
+	}
+	return nil
+}
+
+// Detach releases the lease of the provided session.
+func (g *grpcGovernor) Detach(ctx context.Context, session string) {
+	now := time.Now()
+	g.mu.Lock()
+	lease := g.lease
+	if session != lease.session {
+		g.mu.Unlock()
+		return
+	}
+	g.lease = grpcLease{}
+	g.mu.Unlock()
+	usage, _ := g.charge(ctx, lease, now)
+	g.audit(GRPCAuditRecord{Event: "detach", User: lease.user, Session: session, Usage: usage})
+}
+
+// AuditCompile records the invocation encoded in the argument to a
+// Worker.Compile call, and the call's outcome.
+func (g *grpcGovernor) AuditCompile(session string, arg []byte, err error) {
+	if g.Audit == nil {
+		return
+	}
+	g.mu.Lock()
+	user := g.lease.user
+	g.mu.Unlock()
+	rec := GRPCAuditRecord{Event: "compile", User: user, Session: session}
+	var inv execInvocation
+	if decodeErr := gob.NewDecoder(bytes.NewReader(arg)).Decode(&inv); decodeErr != nil {
+		rec.Error = decodeErr.Error()
+		g.audit(rec)
+		return
+	}
+	if locs := bigslice.FuncLocations(); inv.Func < uint64(len(locs)) {
+		rec.Func = locs[inv.Func]
+	}
+	rec.Location = inv.Location
+	rec.Invocation = inv.Index
+	for _, arg := range inv.Args {
+		if ref, ok := arg.(invocationRef); ok {
+			rec.Args = append(rec.Args, fmt.Sprintf("<invocation %d>", ref.Index))
+			continue
+		}
+		rec.Args = append(rec.Args, fmt.Sprint(arg))
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	g.audit(rec)
+}
+
+// charge charges the user of the provided lease for the machine time
+// since the lease was last charged, up to the provided time.
+func (g *grpcGovernor) charge(ctx context.Context, lease grpcLease, until time.Time) (time.Duration, error) {
+	d := until.Sub(lease.charged)
+	if d < 0 {
+		d = 0
+	}
+	usage, err := g.Ledger.Charge(ctx, lease.user, d)
+	if err != nil {
+		log.Error.Printf("shared agent: charging user %q for %s: %v", lease.user, d, err)
+	}
+	return usage, err
+}
+
+func (g *grpcGovernor) checkQuota(user string, usage time.Duration) error {
+	if g.Quota == nil {
+		return nil
+	}
+	if quota := g.Quota(user); quota > 0 && usage >= quota {
+		return errors.E(errors.NotAllowed, fmt.Sprintf("shared agent: user %q exhausted their quota of %s machine time", user, quota))
+	}
+	return nil
+}
+
+func (g *grpcGovernor) audit(rec GRPCAuditRecord) {
+	if g.Audit == nil {
+		return
+	}
+	rec.Time = time.Now()
+	p, err := json.Marshal(rec)
+	if err != nil {
+		log.Error.Printf("shared agent: audit: %v", err)
+		return
+	}
+	g.auditMu.Lock()
+	defer g.auditMu.Unlock()
+	if _, err := g.Audit.Write(append(p, '\n')); err != nil {
+		log.Error.Printf("shared agent: audit: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/status"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// JobsStatusGroup is the name of the status group in which sessions
+// report the states of their jobs.
+const JobsStatusGroup = "jobs"
+
+// JobState describes the state of a Job.
+type JobState int
+
+const (
+	// JobWaiting indicates that the job is waiting for its
+	// dependencies to complete.
+	JobWaiting JobState = iota
+	// JobRunning indicates that the job's invocation is being run.
+	JobRunning
+	// JobOk indicates that the job's invocation completed successfully.
+	JobOk
+	// JobErr indicates that the job's invocation failed.
+	JobErr
+	// JobSkipped indicates that the job was not run, because one of its
+	// dependencies failed or was skipped, or because its context was
+	// done before its dependencies completed.
+	JobSkipped
+)
+
+var jobStates = [...]string{
+	JobWaiting: "WAITING",
+	JobRunning: "RUNNING",
+	JobOk:      "OK",
+	JobErr:     "ERROR",
+	JobSkipped: "SKIPPED",
+}
+
+// String returns the job state's string representation.
+func (s JobState) String() string {
+	return jobStates[s]
+}
+
+// A Job is an invocation that is submitted to a session by
+// Session.Submit, and that runs once the jobs on which it depends have
+// completed successfully. Jobs provide simple orchestration of
+// dependent computations within a session: for example, job B may be
+// run after job A succeeds, and job C after both A and B.
+type Job struct {
+	// ID is the job's identifier, unique within its session. IDs are
+	// assigned in order of submission, beginning with 1.
+	ID int
+	// Location is the source location at which the job was submitted.
+	Location string
+	// Deps are the jobs on which this job depends, including those
+	// whose results are passed as arguments.
+	Deps []*Job
+
+	status *status.Task
+	done   chan struct{}
+
+	mu         sync.Mutex
+	state      JobState
+	invocation uint64
+	start, end time.Time
+	result     *Result
+	err        error
+}
+
+// Submit submits the invocation of funcv with the provided arguments
+// as a job that runs in the background once each of the jobs in deps
+// has completed successfully. If a dependency fails or is skipped, the
+// job is skipped, and fails with an error of kind errors.Precondition.
+//
+// Arguments of type *Job are replaced by the result of the
+// corresponding job when the invocation is made, so that jobs may
+// consume the results of other jobs; such jobs are implicit
+// dependencies. The job runs with the provided context, which must
+// remain valid until the job completes.
+func (s *Session) Submit(ctx context.Context, deps []*Job, funcv *bigslice.FuncValue, args ...interface{}) *Job {
+	_, file, line, ok := runtime.Caller(1)
+	if !ok {
+		file = ""
+	}
+	job := &Job{
+		Location: "<unknown>",
+		done:     make(chan struct{}),
+	}
+	if file != "" {
+		job.Location = fmt.Sprintf("%s:%d", file, line)
+	}
+	seen := make(map[*Job]bool)
+	addDep := func(dep *Job) {
+		if dep == nil || seen[dep] {
+			return
+		}
+		seen[dep] = true
+		job.Deps = append(job.Deps, dep)
+	}
+	for _, dep := range deps {
+		addDep(dep)
+	}
+	for _, arg := range args {
+		if dep, ok := arg.(*Job); ok {
+			addDep(dep)
+		}
+	}
+	s.mu.Lock()
+	s.jobs = append(s.jobs, job)
+	job.ID = len(s.jobs)
+	if s.status != nil {
+		if s.jobGroup == nil {
+			s.jobGroup = s.status.Group(JobsStatusGroup)
+		}
+		job.status = s.jobGroup.Startf("job %d %s", job.ID, job.Location)
+	}
+	s.mu.Unlock()
+	go job.run(ctx, s, file, line, funcv, args)
+	return job
+}
+
+// Jobs returns the jobs that have been submitted to the session, in
+// order of submission.
+func (s *Session) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Job(nil), s.jobs...)
+}
+
+func (j *Job) run(ctx context.Context, sess *Session, file string, line int, funcv *bigslice.FuncValue, args []interface{}) {
+	if len(j.Deps) > 0 {
+		j.printf("waiting for %s", jobList(j.Deps))
+	}
+	for _, dep := range j.Deps {
+		select {
+		case <-dep.done:
+		case <-ctx.Done():
+			j.finish(JobSkipped, nil, ctx.Err())
+			return
+		}
+		if _, err := dep.Wait(ctx); err != nil {
+			j.finish(JobSkipped, nil, errors.E(errors.Precondition, fmt.Sprintf("dependency %s failed", dep), err))
+			return
+		}
+	}
+	invArgs := make([]interface{}, len(args))
+	for i, arg := range args {
+		if dep, ok := arg.(*Job); ok {
+			// Dependencies have completed successfully, so their results
+			// are available.
+			invArgs[i] = dep.result
+		} else {
+			invArgs[i] = arg
+		}
+	}
+	j.mu.Lock()
+	j.state = JobRunning
+	j.start = time.Now()
+	j.mu.Unlock()
+	j.printf("running")
+	res, err := j.invoke(ctx, sess, file, line, funcv, invArgs)
+	if err != nil {
+		j.finish(JobErr, res, err)
+	} else {
+		j.finish(JobOk, res, nil)
+	}
+}
+
+// invoke runs the job's invocation, returning typechecking errors,
+// which are reported by panics, as errors.
+func (j *Job) invoke(ctx context.Context, sess *Session, file string, line int, funcv *bigslice.FuncValue, args []interface{}) (res *Result, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			typeErr, ok := e.(*typecheck.Error)
+			if !ok {
+				panic(e)
+			}
+			err = errors.E(errors.Invalid, typeErr)
+		}
+	}()
+	return sess.runAt(ctx, file, line, funcv, args...)
+}
+
+func (j *Job) finish(state JobState, res *Result, err error) {
+	j.mu.Lock()
+	j.state = state
+	j.end = time.Now()
+	j.result = res
+	if res != nil {
+		j.invocation = res.invIndex
+	}
+	j.err = err
+	j.mu.Unlock()
+	if err != nil {
+		j.printf("%s: %v", state, err)
+	} else {
+		j.printf("%s", state)
+	}
+	if j.status != nil {
+		j.status.Done()
+	}
+	close(j.done)
+}
+
+func (j *Job) printf(format string, args ...interface{}) {
+	if j.status != nil {
+		j.status.Printf(format, args...)
+	}
+}
+
+// Done returns a channel that is closed when the job completes,
+// successfully or not.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job to complete, and returns its result. Wait
+// returns an error if the job failed or was skipped, or if ctx is done
+// before the job completes.
+func (j *Job) Wait(ctx context.Context) (*Result, error) {
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result, j.err
+}
+
+// State returns the job's current state.
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+func (j *Job) String() string {
+	return fmt.Sprintf("job %d", j.ID)
+}
+
+// jobList returns a description of the provided jobs, e.g., "jobs 1, 2".
+func jobList(jobs []*Job) string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = fmt.Sprint(job.ID)
+	}
+	if len(jobs) == 1 {
+		return "job " + ids[0]
+	}
+	return "jobs " + strings.Join(ids, ", ")
+}
+
+// snapshotJob returns a snapshot of the provided job.
+func snapshotJob(job *Job) GraphJob {
+	g := GraphJob{
+		ID:       job.ID,
+		Location: job.Location,
+	}
+	for _, dep := range job.Deps {
+		g.Deps = append(g.Deps, dep.ID)
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	g.State = job.state.String()
+	g.Invocation = job.invocation
+	if !job.start.IsZero() {
+		g.Start = job.start.UTC()
+	}
+	if !job.end.IsZero() {
+		g.End = job.end.UTC()
+	}
+	if job.err != nil {
+		g.Error = job.err.Error()
+	}
+	return g
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/status"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func scanInts(t *testing.T, res *Result) []int {
+	t.Helper()
+	var (
+		ctx  = context.Background()
+		scan = res.Scanner()
+		ints []int
+		x    int
+	)
+	defer scan.Close()
+	for scan.Scan(ctx, &x) {
+		ints = append(ints, x)
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(ints)
+	return ints
+}
+
+func TestJobs(t *testing.T) {
+	values := bigslice.Func(func(n int) bigslice.Slice {
+		return bigslice.Const(2, rangeSlice(0, n))
+	})
+	add := bigslice.Func(func(x int, slice bigslice.Slice) bigslice.Slice {
+		return bigslice.Map(slice, func(i int) int { return i + x })
+	})
+	ctx := context.Background()
+	testSession(t, func(t *testing.T, sess *Session) {
+		a := sess.Submit(ctx, nil, values, 4)
+		b := sess.Submit(ctx, nil, add, 10, a)
+		c := sess.Submit(ctx, []*Job{a, b}, values, 2)
+		res, err := b.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := scanInts(t, res), []int{10, 11, 12, 13}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if res, err = c.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := scanInts(t, res), []int{0, 1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := sess.Jobs(), []*Job{a, b, c}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		g := sess.Graph()
+		if got, want := len(g.Jobs), 3; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		invs := make(map[uint64]bool)
+		for _, task := range g.Tasks {
+			invs[task.Invocation] = true
+		}
+		for i, wantDeps := range [][]int{nil, {1}, {1, 2}} {
+			job := g.Jobs[i]
+			if got, want := job.ID, i+1; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := job.Deps, wantDeps; !reflect.DeepEqual(got, want) {
+				t.Errorf("job %d: got %v, want %v", job.ID, got, want)
+			}
+			if got, want := job.State, "OK"; got != want {
+				t.Errorf("job %d: got %v, want %v", job.ID, got, want)
+			}
+			if !invs[job.Invocation] {
+				t.Errorf("job %d: invocation %d has no tasks", job.ID, job.Invocation)
+			}
+			// Jobs start only after their dependencies have completed.
+			for _, dep := range job.Deps {
+				if job.Start.Before(g.Jobs[dep-1].End) {
+					t.Errorf("job %d started before job %d completed", job.ID, dep)
+				}
+			}
+		}
+	})
+}
+
+func TestJobsError(t *testing.T) {
+	fail := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, state *int, out []int) (int, error) {
+			return 0, errors.New("read failed")
+		})
+	})
+	values := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, state *int, out []int) (int, error) {
+			return 0, sliceio.EOF
+		})
+	})
+	ctx := context.Background()
+	sess := Start(Local, Status(new(status.Status)))
+	a := sess.Submit(ctx, nil, fail)
+	b := sess.Submit(ctx, []*Job{a}, values)
+	c := sess.Submit(ctx, []*Job{b}, values)
+	d := sess.Submit(ctx, nil, values, "unexpected argument")
+	if _, err := c.Wait(ctx); !errors.Is(errors.Precondition, err) {
+		t.Errorf("got %v, want precondition error", err)
+	}
+	for _, c := range []struct {
+		job   *Job
+		state JobState
+	}{
+		{a, JobErr}, {b, JobSkipped}, {c, JobSkipped},
+	} {
+		if got, want := c.job.State(), c.state; got != want {
+			t.Errorf("%s: got %v, want %v", c.job, got, want)
+		}
+	}
+	if _, err := d.Wait(ctx); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got %v, want typecheck error", err)
+	}
+	if got, want := d.State(), JobErr; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestJobsCanceled(t *testing.T) {
+	block := make(chan struct{})
+	wait := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, state *int, out []int) (int, error) {
+			<-block
+			return 0, sliceio.EOF
+		})
+	})
+	sess := Start(Local)
+	a := sess.Submit(context.Background(), nil, wait)
+	ctx, cancel := context.WithCancel(context.Background())
+	b := sess.Submit(ctx, []*Job{a}, wait)
+	cancel()
+	if _, err := b.Wait(context.Background()); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if got, want := b.State(), JobSkipped; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	select {
+	case <-a.Done():
+		t.Error("job completed prematurely")
+	default:
+	}
+	close(block)
+	if _, err := a.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+var typeOfString = reflect.TypeOf("")
+
+// A keyDict is a dictionary of interned keys that is shared by the
+// tasks that combine into the same machine combiner. Tasks intern the
+// string key columns of the rows that they combine, so that the
+// combiner's buffers share a single copy of each distinct key, and
+// the many copies of identical keys that are decoded from task inputs
+// are released promptly. The dictionary holds a bounded number of
+// keys: it is meant for enum-like keys, and keys beyond the bound are
+// left as they are. KeyDicts are safe for concurrent use.
+type keyDict struct {
+	// cols are the indices of the string key columns.
+	cols    []int
+	maxKeys int
+
+	mu   sync.RWMutex
+	keys map[string]string
+}
+
+// newKeyDict returns a new dictionary for rows of the provided type
+// that holds at most maxKeys keys. NewKeyDict returns nil if maxKeys
+// is zero, or if the type has no string key columns.
+func newKeyDict(typ slicetype.Type, maxKeys int) *keyDict {
+	if maxKeys <= 0 {
+		return nil
+	}
+	d := &keyDict{maxKeys: maxKeys, keys: make(map[string]string)}
+	for col := 0; col < typ.Prefix(); col++ {
+		if typ.Out(col) == typeOfString {
+			d.cols = append(d.cols, col)
+		}
+	}
+	if len(d.cols) == 0 {
+		return nil
+	}
+	return d
+}
+
+// Intern replaces the string keys of the rows in f with their interned
+// copies, adding keys to the dictionary while it has room. Intern
+// returns the number of keys that were found in the dictionary.
+func (d *keyDict) Intern(f frame.Frame) (hits int) {
+	var missed bool
+	d.mu.RLock()
+	for _, col := range d.cols {
+		keys := f.Interface(col).([]string)
+		for i, key := range keys {
+			if interned, ok := d.keys[key]; ok {
+				keys[i] = interned
+				hits++
+			} else {
+				missed = true
+			}
+		}
+	}
+	full := len(d.keys) >= d.maxKeys
+	d.mu.RUnlock()
+	if !missed || full {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, col := range d.cols {
+		keys := f.Interface(col).([]string)
+		for i, key := range keys {
+			if interned, ok := d.keys[key]; ok {
+				keys[i] = interned
+				continue
+			}
+			if len(d.keys) >= d.maxKeys {
+				return
+			}
+			d.keys[key] = key
+		}
+	}
+	return
+}
+
+// Len returns the number of keys in the dictionary.
+func (d *keyDict) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.keys)
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func TestKeyDict(t *testing.T) {
+	typ := slicetype.New(typeOfString, reflect.TypeOf(0))
+	if newKeyDict(typ, 0) != nil {
+		t.Error("expected no dictionary")
+	}
+	if newKeyDict(slicetype.New(reflect.TypeOf(0), typeOfString), 10) != nil {
+		t.Error("expected no dictionary for non-string keys")
+	}
+	d := newKeyDict(typ, 3)
+	f := frame.Slices([]string{"a", "b", "a", "c", "d"}, []int{1, 2, 3, 4, 5})
+	if got, want := d.Intern(f), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The dictionary holds at most three keys.
+	if got, want := d.Len(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	g := frame.Slices([]string{"a", "d", "c", "c"}, []int{1, 2, 3, 4})
+	if got, want := d.Intern(g), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := g.Interface(0).([]string), []string{"a", "d", "c", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := d.Len(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
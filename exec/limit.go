@@ -0,0 +1,218 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"math"
+
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// truncatedDo is the Do of truncated tasks: they produce empty outputs.
+func truncatedDo([]sliceio.Reader) sliceio.Reader { return sliceio.EmptyReader{} }
+
+// A limitScheduler admits the tasks of limited phases, i.e., those
+// whose tasks have a nonzero Limit, in waves: a single task is run
+// first, and each subsequent wave is sized by the number of rows that
+// the previous ones produced, as estimated from their outputs. Once
+// the phase has produced enough rows, its remaining tasks are
+// truncated: those that have not yet been run produce empty outputs,
+// and those that are running are canceled and run again to produce
+// empty outputs (see runContext). Other tasks are admitted immediately.
+//
+// The limit scheduler is used only by the evaluator's goroutine.
+type limitScheduler struct {
+	phases map[*Task]*limitPhase
+}
+
+// limitPhase is the state of a limited phase, keyed by its head task.
+type limitPhase struct {
+	// limit is the number of rows needed from the phase.
+	limit int
+	// width is the number of the phase's tasks that may be admitted.
+	width int
+	// admitted is the set of tasks that have been admitted, and
+	// running is the set of those that have not yet completed.
+	admitted map[*Task]bool
+	running  map[*Task]bool
+	// counted is the set of tasks whose rows are counted in rows.
+	counted map[*Task]bool
+	rows    int64
+	// held are the tasks that are waiting to be admitted.
+	held []*Task
+	// truncated indicates that the phase has produced enough rows, and
+	// that its remaining tasks are truncated.
+	truncated bool
+}
+
+func newLimitScheduler() *limitScheduler {
+	return &limitScheduler{phases: make(map[*Task]*limitPhase)}
+}
+
+// Admit returns whether the provided runnable task may be run; if not,
+// the task is held until it is returned by a subsequent call to Done.
+func (s *limitScheduler) Admit(task *Task) bool {
+	if task.Limit == 0 {
+		return true
+	}
+	p := s.phases[task.Head()]
+	if p == nil {
+		p = &limitPhase{
+			limit:    task.Limit,
+			width:    1,
+			admitted: make(map[*Task]bool),
+			running:  make(map[*Task]bool),
+			counted:  make(map[*Task]bool),
+		}
+		s.phases[task.Head()] = p
+	}
+	if p.truncated && !p.counted[task] {
+		// Tasks whose rows were counted must reproduce them if they are
+		// run again, e.g., because they were lost.
+		truncate(task)
+	}
+	if !p.truncated && !p.admitted[task] && len(p.admitted) >= p.width {
+		p.held = append(p.held, task)
+		return false
+	}
+	p.admitted[task] = true
+	p.running[task] = true
+	return true
+}
+
+// Done records the completion of the provided admitted task, and
+// returns the held tasks that may consequently be run.
+func (s *limitScheduler) Done(task *Task) (admitted []*Task) {
+	p := s.phases[task.Head()]
+	if p == nil {
+		return nil
+	}
+	delete(p.running, task)
+	if task.State() == TaskOk && !task.truncated && !p.counted[task] {
+		p.counted[task] = true
+		p.rows += task.Vals()["write"]
+	}
+	switch {
+	case p.truncated:
+		return nil
+	case p.rows >= int64(p.limit):
+		p.truncated = true
+		for _, task := range p.held {
+			truncate(task)
+		}
+		for task := range p.running {
+			truncateRunning(task)
+		}
+	case len(p.running) == 0:
+		p.grow()
+	default:
+		return nil
+	}
+	for len(p.held) > 0 && (p.truncated || len(p.admitted) < p.width) {
+		task := p.held[0]
+		p.held = p.held[1:]
+		p.admitted[task] = true
+		p.running[task] = true
+		admitted = append(admitted, task)
+	}
+	return admitted
+}
+
+// grow grows the phase's width once all of its admitted tasks have
+// completed without producing enough rows. The width is estimated
+// from the rows produced by the completed tasks, with a margin, and
+// at most quadruples.
+func (p *limitPhase) grow() {
+	width := 4 * p.width
+	if p.rows > 0 {
+		estimate := math.Ceil(1.5 * float64(p.limit) * float64(len(p.counted)) / float64(p.rows))
+		if estimate < float64(width) {
+			width = int(estimate)
+		}
+	}
+	if width <= p.width {
+		width = p.width + 1
+	}
+	p.width = width
+}
+
+// truncate marks the provided task, which has not yet been run, as
+// truncated.
+func truncate(task *Task) {
+	task.Lock()
+	task.truncated = true
+	task.Unlock()
+}
+
+// truncateRunning truncates the provided task, which has been admitted
+// to run, unless it has already completed. If the task is running, its
+// run is canceled.
+func truncateRunning(task *Task) {
+	task.Lock()
+	if task.state >= TaskOk {
+		task.Unlock()
+		return
+	}
+	task.truncated = true
+	cancel := task.cancelRun
+	task.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// runContext returns the context, derived from ctx, in which the
+// executor runs the provided task, and whether the task is truncated.
+// If the task is not truncated, the context is canceled if the task is
+// truncated while it runs, so that the executor may stop computing
+// rows that are no longer needed and run the task again to produce an
+// empty output. Tasks with combiners are never canceled, as their rows
+// may already have been combined into shared combiners. The returned
+// func must be called once the run is done.
+func runContext(ctx context.Context, task *Task) (context.Context, bool, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	task.Lock()
+	truncated := task.truncated
+	if !truncated && task.Limit > 0 && task.Combiner.IsNil() {
+		task.cancelRun = cancel
+	}
+	task.Unlock()
+	return ctx, truncated, func() {
+		task.Lock()
+		task.cancelRun = nil
+		task.Unlock()
+		cancel()
+	}
+}
+
+// truncatedDuring returns whether the provided task, whose run was
+// not truncated, was truncated while it ran, in which case its run
+// should be retried to produce an empty output.
+func truncatedDuring(ctx context.Context, task *Task, truncated bool) bool {
+	if truncated || ctx.Err() != nil {
+		return false
+	}
+	task.Lock()
+	defer task.Unlock()
+	return task.truncated
+}
+
+// runWorker runs the provided task by calling Worker.Run with req
+// through call, which is the RetryCall of the machine on which the task
+// is placed. If the task is truncated while it runs, its run is
+// canceled and it is run again to produce an empty output.
+func runWorker(ctx context.Context, task *Task, req taskRunRequest, reply *taskRunReply, call func(context.Context, string, interface{}, interface{}) error) error {
+	runCtx, truncated, done := runContext(ctx, task)
+	req.Truncated = truncated
+	err := call(runCtx, "Worker.Run", req, reply)
+	done()
+	if err != nil && truncatedDuring(ctx, task, truncated) {
+		req.Truncated = true
+		*reply = taskRunReply{}
+		err = call(ctx, "Worker.Run", req, reply)
+	}
+	return err
+}
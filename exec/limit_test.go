@@ -0,0 +1,162 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestLimit(t *testing.T) {
+	const (
+		N      = 10000
+		Nshard = 100
+		Nrow   = 50
+	)
+	var calls int64
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(Nshard, rangeSlice(0, N))
+		// Only one in five rows is retained.
+		slice = bigslice.Filter(slice, func(i int) bool {
+			atomic.AddInt64(&calls, 1)
+			return i%5 == 0
+		})
+		return bigslice.Limit(slice, Nrow)
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt64(&calls, 0)
+			sess := Start(opt)
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scanner := res.Scanner()
+			defer scanner.Close()
+			var n, i int
+			for scanner.Scan(ctx, &i) {
+				n++
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := n, Nrow; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			// Each shard produces 20 rows: the first wave of one shard is
+			// followed by a wave of at most 4, and the remaining shards
+			// are truncated.
+			if got, max := atomic.LoadInt64(&calls), int64(5*N/Nshard); got > max {
+				t.Errorf("filtered %d rows, want at most %d", got, max)
+			}
+			var truncated int
+			for _, task := range res.tasks[0].Deps[0].Head.Group {
+				if task.truncated {
+					truncated++
+				}
+			}
+			if got, want := truncated, Nshard-5; got < want {
+				t.Errorf("got %v truncated tasks, want at least %v", got, want)
+			}
+		})
+	}
+}
+
+// TestLimitCancel verifies that the running tasks of a limited phase are
+// canceled once the phase has produced enough rows.
+func TestLimitCancel(t *testing.T) {
+	const (
+		N      = 300
+		Nshard = 3
+		Nrow   = 10
+	)
+	var (
+		first, second int64
+		canceled      int64
+		// started is closed once the third shard is running, so that
+		// it is still running when the second completes.
+		started     chan struct{}
+		startedOnce *sync.Once
+	)
+	fn := bigslice.Func(func(head bool) bigslice.Slice {
+		slice := bigslice.Const(Nshard, rangeSlice(0, N))
+		// The first shard to run produces no rows, so that the next wave
+		// admits both of the others: one of them produces enough rows,
+		// while the other runs until it is canceled.
+		slice = bigslice.Map(slice, func(ctx context.Context, i int) (int, bool) {
+			// Const places N/Nshard+1 rows in each shard.
+			shard := int64(i/(N/Nshard+1)) + 1
+			atomic.CompareAndSwapInt64(&first, 0, shard)
+			if atomic.LoadInt64(&first) == shard {
+				return i, false
+			}
+			atomic.CompareAndSwapInt64(&second, 0, shard)
+			if atomic.LoadInt64(&second) == shard {
+				select {
+				case <-started:
+				case <-time.After(time.Minute):
+				}
+				return i, true
+			}
+			startedOnce.Do(func() { close(started) })
+			select {
+			case <-ctx.Done():
+				atomic.AddInt64(&canceled, 1)
+			case <-time.After(time.Minute):
+			}
+			return i, true
+		})
+		slice = bigslice.Filter(slice, func(i int, keep bool) bool { return keep })
+		// Head limits the slice as Limit does.
+		if head {
+			return bigslice.Head(slice, Nrow)
+		}
+		return bigslice.Limit(slice, Nrow)
+	})
+	for name, opt := range executors {
+		for op, head := range map[string]bool{"Limit": false, "Head": true} {
+			t.Run(name+"/"+op, func(t *testing.T) {
+				atomic.StoreInt64(&first, 0)
+				atomic.StoreInt64(&second, 0)
+				atomic.StoreInt64(&canceled, 0)
+				started, startedOnce = make(chan struct{}), new(sync.Once)
+				sess := Start(opt, Parallelism(Nshard))
+				ctx := context.Background()
+				start := time.Now()
+				res, err := sess.Run(ctx, fn, head)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if elapsed := time.Since(start); elapsed >= time.Minute {
+					t.Errorf("running task was not canceled: took %s", elapsed)
+				}
+				if atomic.LoadInt64(&canceled) == 0 {
+					t.Error("running task was not canceled")
+				}
+				scanner := res.Scanner()
+				defer scanner.Close()
+				var (
+					n, i int
+					keep bool
+				)
+				for scanner.Scan(ctx, &i, &keep) {
+					n++
+				}
+				if err := scanner.Err(); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := n, Nrow; got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
@@ -5,20 +5,24 @@
 package exec
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"runtime/debug"
 	"sync"
 
-	"github.com/grailbio/base/backgroundcontext"
 	"github.com/grailbio/base/errors"
 	"github.com/grailbio/base/eventlog"
 	"github.com/grailbio/base/limiter"
 	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice"
 	"github.com/grailbio/bigslice/frame"
 	"github.com/grailbio/bigslice/metrics"
 	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/stats"
 )
 
 // LocalExecutor is an executor that runs tasks in-process in
@@ -28,7 +32,16 @@ type localExecutor struct {
 	state   map[*Task]TaskState
 	buffers map[*Task]taskBuffer
 	limiter *limiter.Limiter
-	sess    *Session
+	// gpus limits the number of GPUs in use by concurrently running
+	// tasks to the number configured for the session.
+	gpus *limiter.Limiter
+	sess *Session
+
+	// regionOnce guards the computation of region and regionErr, the
+	// region of the instance on which the driver runs.
+	regionOnce sync.Once
+	region     string
+	regionErr  error
 }
 
 func newLocalExecutor() *localExecutor {
@@ -36,6 +49,7 @@ func newLocalExecutor() *localExecutor {
 		state:   make(map[*Task]TaskState),
 		buffers: make(map[*Task]taskBuffer),
 		limiter: limiter.New(),
+		gpus:    limiter.New(),
 	}
 }
 
@@ -46,45 +60,114 @@ func (*localExecutor) Name() string {
 func (l *localExecutor) Start(sess *Session) (shutdown func()) {
 	l.sess = sess
 	l.limiter.Release(sess.p)
+	if sess.gpus > 0 {
+		l.gpus.Release(sess.gpus)
+	}
 	return
 }
 
+// Region returns the region of the instance on which the driver, and
+// thus every task, runs, as reported by its instance metadata.
+func (l *localExecutor) Region() (string, error) {
+	l.regionOnce.Do(func() {
+		l.region, l.regionErr = instanceRegion()
+	})
+	return l.region, l.regionErr
+}
+
 func (l *localExecutor) Run(task *Task) {
-	ctx := backgroundcontext.Get()
+	ctx := task.evalContext()
+	if residency := task.Invocation.residency; residency != nil {
+		region, _ := l.Region()
+		if err := residency.check("local", region); err != nil {
+			task.Error(err)
+			return
+		}
+	}
 	n := 1
 	if task.Pragma.Exclusive() {
 		n = l.sess.p
 	}
 	if err := l.limiter.Acquire(ctx, n); err != nil {
 		// The only errors we should encounter here are context errors,
-		// in which case there is no more work to do.
+		// in which case the task's evaluation has ended; the task may be
+		// resubmitted by a later evaluation.
 		if err != context.Canceled && err != context.DeadlineExceeded {
 			log.Panicf("exec.Local: unexpected error: %v", err)
 		}
+		task.Set(TaskLost)
 		return
 	}
 	defer l.limiter.Release(n)
-	in, err := l.depReaders(ctx, task)
-	if err != nil {
-		if errors.Match(fatalErr, err) {
-			task.Error(err)
-		} else {
+	if gpus := bigslice.PragmaGPUs(task.Pragma); gpus > 0 {
+		if gpus > l.sess.gpus {
+			task.Error(errors.E(errors.Fatal, errors.Precondition,
+				fmt.Sprintf("task %v needs %d GPUs, but only %d are available", task, gpus, l.sess.gpus)))
+			return
+		}
+		if err := l.gpus.Acquire(ctx, gpus); err != nil {
 			task.Set(TaskLost)
+			return
+		}
+		defer l.gpus.Release(gpus)
+	}
+	var (
+		in []sliceio.Reader
+		do = task.Do
+
+		runCtx, truncated, runDone = runContext(ctx, task)
+	)
+	defer runDone()
+	if truncated {
+		do = truncatedDo
+	} else {
+		var err error
+		if in, err = l.depReaders(runCtx, task); err != nil && !truncatedDuring(ctx, task, truncated) {
+			if errors.Match(fatalErr, err) {
+				task.Error(err)
+			} else {
+				task.Set(TaskLost)
+			}
+			return
 		}
-		return
 	}
-	task.Set(TaskRunning)
+	l.sess.tracer.Event(nil, task, "B")
+	task.setRunning("local")
 
 	// Start execution, then place output in a task buffer. We also plumb a
 	// metrics scope in here so we can store and aggregate metrics.
 	task.Scope.Reset(nil)
-	out := task.Do(in)
-	buf, err := bufferOutput(metrics.ScopedContext(ctx, &task.Scope), task, out)
+	ctx = metrics.ProgressContext(metrics.ScopedContext(ctx, &task.Scope), &task.Progress)
+	var (
+		buf taskBuffer
+		err = runCtx.Err()
+	)
+	if err == nil {
+		out := do(in)
+		runCtx = metrics.ProgressContext(metrics.ScopedContext(runCtx, &task.Scope), &task.Progress)
+		buf, err = bufferOutput(runCtx, task, out)
+	}
+	runDone()
+	if err != nil && truncatedDuring(ctx, task, truncated) {
+		// The task was truncated while it ran: its rows are no longer
+		// needed.
+		task.Scope.Reset(nil)
+		buf, err = bufferOutput(ctx, task, truncatedDo(nil))
+	}
+	if err == nil && l.sess.verifies(task) {
+		err = l.verify(ctx, task, buf)
+	}
+	if err != nil {
+		l.sess.tracer.Event(nil, task, "E", "error", err)
+	} else {
+		l.sess.tracer.Event(nil, task, "E")
+	}
 	task.Lock()
 	if err == nil {
 		l.mu.Lock()
 		l.buffers[task] = buf
 		l.mu.Unlock()
+		task.vals = stats.Values{"write": buf.rows()}
 		task.state = TaskOk
 	} else {
 		if errors.Match(fatalErr, err) {
@@ -98,6 +181,28 @@ func (l *localExecutor) Run(task *Task) {
 	task.Unlock()
 }
 
+// verify re-executes the task, whose output is buffered in buf, and
+// returns an error if the output of the re-execution differs.
+func (l *localExecutor) verify(ctx context.Context, task *Task, buf taskBuffer) error {
+	task.Status.Print("verifying determinism")
+	stored, err := digest(ctx, task, &taskBufferReader{q: buf})
+	if err != nil {
+		return err
+	}
+	in, err := l.depReaders(ctx, task)
+	if err != nil {
+		return err
+	}
+	rerun, err := digest(ctx, task, task.Do(in))
+	if err != nil {
+		return err
+	}
+	if stored != rerun {
+		return errNondeterministic(task, stored, rerun)
+	}
+	return nil
+}
+
 func (l *localExecutor) depReaders(ctx context.Context, task *Task) ([]sliceio.Reader, error) {
 	in := make([]sliceio.Reader, 0, len(task.Deps))
 	for _, dep := range task.Deps {
@@ -175,6 +280,19 @@ func (l *localExecutor) Discard(_ context.Context, task *Task) {
 	task.Unlock()
 }
 
+// profile implements profiler. The local executor runs tasks in the
+// driver's process, which is profiled as machine "local".
+func (l *localExecutor) profile(ctx context.Context, addr string, p Profile) (io.ReadCloser, error) {
+	if addr != "local" {
+		return nil, errors.E(errors.NotExist, fmt.Sprintf("machine %s", addr))
+	}
+	var b bytes.Buffer
+	if err := writeProfile(ctx, &b, p); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&b), nil
+}
+
 func (l *localExecutor) Eventer() eventlog.Eventer {
 	return l.sess.eventer
 }
@@ -0,0 +1,198 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/slicecache"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// DefaultSmallJoinRows is the default maximum number of rows in a
+// join dependency that is collapsed into a lookup. See SmallJoinRows.
+const DefaultSmallJoinRows = 1 << 14
+
+// lookupDeps returns, for each dependency of the provided slice, the
+// pipeline of slices that computes it if the dependency is collapsed
+// into a lookup, and nil otherwise. A dependency is collapsed if the
+// slice joins it (i.e., the slice has multiple shuffle dependencies
+// and no combiner), it is declared to contain at most maxRows rows
+// (see bigslice.Sizer), and it can be computed within another task.
+// Collapsed dependencies are computed in full by each of the slice's
+// tasks, which then read only the rows that are partitioned to their
+// shard, so that the dependencies are neither shuffled nor computed
+// by tasks of their own. At least one dependency, the large side of the
+// join, is always left to be shuffled. LookupDeps returns nil if no
+// dependency is collapsed.
+func lookupDeps(slice bigslice.Slice, maxRows int) [][]bigslice.Slice {
+	if maxRows <= 0 || slice.NumDep() < 2 || !slice.Combiner().IsNil() {
+		return nil
+	}
+	var (
+		lookups = make([][]bigslice.Slice, slice.NumDep())
+		n       int
+	)
+	for i := range lookups {
+		dep := slice.Dep(i)
+		if !dep.Shuffle || dep.Expand {
+			return nil
+		}
+		sizer, ok := bigslice.Unwrap(dep.Slice).(bigslice.Sizer)
+		if !ok {
+			continue
+		}
+		if rows := sizer.MaxRows(); rows < 0 || rows > maxRows {
+			continue
+		}
+		if lookups[i] = inlinePipeline(dep.Slice); lookups[i] != nil {
+			n++
+		}
+	}
+	// Joins of only small slices are cheap enough as they are.
+	if n == 0 || n == len(lookups) {
+		return nil
+	}
+	return lookups
+}
+
+// inlinePipeline returns the pipeline of slices that computes the
+// provided slice if it can be computed within another task: it must
+// not read any dependencies, including broadcast dependencies, nor be
+// cached, nor require placement of its own. Otherwise inlinePipeline
+// returns nil.
+func inlinePipeline(slice bigslice.Slice) []bigslice.Slice {
+	slices := pipeline(slice)
+	if len(slices) == 0 || slices[len(slices)-1].NumDep() != 0 {
+		return nil
+	}
+	for _, slice := range slices {
+		if slice.NumDep() > 1 {
+			return nil
+		}
+		if _, ok := bigslice.Unwrap(slice).(slicecache.Cacheable); ok {
+			return nil
+		}
+		if pragma, ok := slice.(bigslice.Pragma); ok {
+			if pragma.Exclusive() || bigslice.PragmaGPUs(pragma) > 0 || pragma.Materialize() {
+				return nil
+			}
+		}
+	}
+	return slices
+}
+
+// lookupReader returns a reader of the rows of every shard of the
+// slice computed by the provided pipeline that are partitioned by
+// partitioner to the given partition of numPartition partitions. The
+// rows read are thus those that the partition would read from a
+// shuffle of the slice.
+func lookupReader(slices []bigslice.Slice, partitioner bigslice.Partitioner, partition, numPartition int) sliceio.Reader {
+	readers := make([]sliceio.Reader, slices[0].NumShard())
+	for shard := range readers {
+		r := slices[len(slices)-1].Reader(shard, nil)
+		for i := len(slices) - 2; i >= 0; i-- {
+			r = slices[i].Reader(shard, []sliceio.Reader{r})
+		}
+		readers[shard] = r
+	}
+	return &partitionReader{
+		readers:      readers,
+		typ:          slices[0],
+		partitioner:  partitioner,
+		partition:    partition,
+		numPartition: numPartition,
+	}
+}
+
+// partitionReader reads the rows of a sequence of underlying readers
+// that are partitioned to a single partition.
+type partitionReader struct {
+	readers      []sliceio.Reader
+	typ          slicetype.Type
+	partitioner  bigslice.Partitioner
+	partition    int
+	numPartition int
+
+	buf    frame.Frame
+	shards []int
+	err    error
+}
+
+func (r *partitionReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if out.Len() == 0 {
+		return 0, r.err
+	}
+	var n int
+	for n == 0 && r.err == nil {
+		if r.buf.IsZero() {
+			r.buf = frame.Make(r.typ, out.Len(), out.Len())
+		}
+		r.buf = r.buf.Ensure(out.Len())
+		if len(r.shards) < out.Len() {
+			r.shards = make([]int, out.Len())
+		}
+		if len(r.readers) == 0 {
+			r.err = sliceio.EOF
+			break
+		}
+		m, err := r.readers[0].Read(ctx, r.buf)
+		switch {
+		case err == sliceio.EOF:
+			r.readers = r.readers[1:]
+		case err != nil:
+			r.err = err
+		}
+		r.partitioner(ctx, r.buf.Slice(0, m), r.numPartition, r.shards[:m])
+		for i := 0; i < m; i++ {
+			if r.shards[i] == r.partition {
+				frame.Copy(out.Slice(n, n+1), r.buf.Slice(i, i+1))
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// lookupDepReaders returns a reader func that calls the provided
+// reader func of slice with readers for all of the slice's
+// dependencies: those for shuffled dependencies are passed in by the
+// task, and those for dependencies that are collapsed into the
+// provided lookups are computed in place.
+func lookupDepReaders(reader func(int, []sliceio.Reader) sliceio.Reader, slice bigslice.Slice, lookups [][]bigslice.Slice) func(int, []sliceio.Reader) sliceio.Reader {
+	return func(shard int, readers []sliceio.Reader) sliceio.Reader {
+		deps := make([]sliceio.Reader, len(lookups))
+		for i := range deps {
+			if lookups[i] == nil {
+				deps[i], readers = readers[0], readers[1:]
+				continue
+			}
+			partitioner := slice.Dep(i).Partitioner
+			if partitioner == nil {
+				partitioner = defaultPartitioner
+			}
+			deps[i] = lookupReader(lookups[i], partitioner, shard, slice.NumShard())
+		}
+		return reader(shard, deps)
+	}
+}
+
+// lookupNames returns the names of the slices computed by the provided
+// lookups.
+func lookupNames(lookups [][]bigslice.Slice) []bigslice.Name {
+	var names []bigslice.Name
+	for _, slices := range lookups {
+		if slices != nil {
+			names = append(names, slices[0].Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice"
+)
+
+// A memoRun is the run of a memoized invocation. Its result and error
+// are set before done is closed.
+type memoRun struct {
+	key  string
+	done chan struct{}
+	res  *Result
+	err  error
+}
+
+// invocationKey returns the key by which inv is memoized. Invocations are
+// keyed by their checkpoint fingerprints, in which *Result arguments
+// are identified by their invocation indices, as these are unique
+// within the session.
+func invocationKey(inv bigslice.Invocation) (string, error) {
+	results := make(map[uint64]string)
+	for _, arg := range inv.Args {
+		if result, ok := arg.(*Result); ok {
+			results[result.invIndex] = fmt.Sprintf("inv%d", result.invIndex)
+		}
+	}
+	return checkpointFingerprint(inv, results)
+}
+
+// memoized returns the result of the earlier run of an invocation that
+// is identical to inv, waiting for it to complete if it is still
+// running. If there is none, memoized returns a new memoRun for inv,
+// which the caller must finish with finishMemo. Both are nil if inv
+// cannot be memoized.
+func (s *Session) memoized(ctx context.Context, inv bigslice.Invocation) (*memoRun, *Result, error) {
+	key, err := invocationKey(inv)
+	if err != nil {
+		log.Debug.Printf("%s: not memoizing invocation: %v", inv.Location, err)
+		return nil, nil, nil
+	}
+	for {
+		s.mu.Lock()
+		memo, ok := s.memo[key]
+		if !ok {
+			memo = &memoRun{key: key, done: make(chan struct{})}
+			s.memo[key] = memo
+			s.mu.Unlock()
+			return memo, nil, nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-memo.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if memo.err == nil && memo.res != nil {
+			return nil, memo.res, nil
+		}
+		// The run failed (or panicked), and is no longer memoized; run
+		// the invocation anew.
+	}
+}
+
+// finishMemo completes the memoized run with the provided result and
+// error. Failed runs, including runs that panicked and thus have no
+// result, are forgotten, so that they may be retried.
+func (s *Session) finishMemo(memo *memoRun, res *Result, err error) {
+	s.mu.Lock()
+	memo.res, memo.err = res, err
+	if err != nil || res == nil {
+		delete(s.memo, memo.key)
+	}
+	s.mu.Unlock()
+	close(memo.done)
+}
+
+// forgetMemo forgets the memoized run, if any, that computed res, so
+// that later identical invocations are run anew.
+func (s *Session) forgetMemo(res *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, memo := range s.memo {
+		if memo.res == res {
+			delete(s.memo, key)
+		}
+	}
+}
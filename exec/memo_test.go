@@ -0,0 +1,99 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestMemoize(t *testing.T) {
+	var ninv int64
+	ints := bigslice.Func(func(n int) bigslice.Slice {
+		atomic.AddInt64(&ninv, 1)
+		return bigslice.Const(2, rangeSlice(0, n))
+	})
+	double := bigslice.Func(func(slice bigslice.Slice) bigslice.Slice {
+		atomic.AddInt64(&ninv, 1)
+		return bigslice.Map(slice, func(i int) int { return 2 * i })
+	})
+	ctx := context.Background()
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, Memoize)
+			x := sess.Must(ctx, ints, 10)
+			y := sess.Must(ctx, double, x)
+			// Memoized invocations are not invoked again, neither by the
+			// driver nor by workers.
+			n := atomic.LoadInt64(&ninv)
+			if got, want := sess.Must(ctx, ints, 10), x; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := sess.Must(ctx, double, x), y; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := sess.Must(ctx, double, sess.Must(ctx, ints, 10)), y; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := atomic.LoadInt64(&ninv), n; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := len(readFrame(t, y, 10).Interface(0).([]int)), 10; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			// Different arguments are invoked anew.
+			if sess.Must(ctx, ints, 11) == x {
+				t.Error("invocations with different arguments were memoized")
+			}
+			// Discarded results are forgotten.
+			x.Discard(ctx)
+			if sess.Must(ctx, ints, 10) == x {
+				t.Error("discarded result was memoized")
+			}
+		})
+	}
+}
+
+func TestMemoizeConcurrent(t *testing.T) {
+	var ninv int64
+	ints := bigslice.Func(func() bigslice.Slice {
+		atomic.AddInt64(&ninv, 1)
+		return bigslice.Const(2, rangeSlice(0, 100))
+	})
+	const N = 10
+	var (
+		ctx     = context.Background()
+		sess    = Start(Local, Memoize)
+		results = make([]*Result, N)
+		wg      sync.WaitGroup
+	)
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = sess.Must(ctx, ints)
+		}()
+	}
+	wg.Wait()
+	for _, res := range results[1:] {
+		if res != results[0] {
+			t.Fatal("concurrent invocations were not memoized")
+		}
+	}
+	if got, want := atomic.LoadInt64(&ninv), int64(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Without memoization, each invocation is run.
+	sess = Start(Local)
+	if sess.Must(ctx, ints) == sess.Must(ctx, ints) {
+		t.Error("invocations were memoized")
+	}
+}
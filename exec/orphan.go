@@ -0,0 +1,76 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigmachine"
+)
+
+// orphanExit is called to terminate an orphaned worker's process. It
+// is overridden in tests.
+var orphanExit = os.Exit
+
+// heartbeatPeriod returns the period at which the driver sends
+// heartbeats to workers that are reaped after the provided orphan
+// timeout, so that a few heartbeats may be lost before a worker
+// considers itself orphaned.
+func heartbeatPeriod(timeout time.Duration) time.Duration {
+	return timeout / 4
+}
+
+// watchDriver terminates the worker's process once it has not received
+// a heartbeat from its driver for w.OrphanTimeout. It returns when ctx
+// is done.
+func (w *worker) watchDriver(ctx context.Context) {
+	w.mu.Lock()
+	w.heartbeat = time.Now()
+	w.mu.Unlock()
+	for {
+		select {
+		case <-time.After(heartbeatPeriod(w.OrphanTimeout)):
+		case <-ctx.Done():
+			return
+		}
+		w.mu.Lock()
+		since := time.Since(w.heartbeat)
+		w.mu.Unlock()
+		if since >= w.OrphanTimeout {
+			log.Error.Printf("no heartbeat from driver in %s: worker is orphaned; exiting", since)
+			orphanExit(1)
+			return
+		}
+	}
+}
+
+// Heartbeat records that the worker's driver is alive.
+func (w *worker) Heartbeat(ctx context.Context, _ struct{}, _ *struct{}) error {
+	w.mu.Lock()
+	w.heartbeat = time.Now()
+	w.mu.Unlock()
+	return nil
+}
+
+// sendHeartbeats sends heartbeats to machine mach until the machine is
+// stopped, so that its worker does not consider itself orphaned.
+func (m *machineManager) sendHeartbeats(ctx context.Context, mach *sliceMachine) {
+	stopped := mach.Wait(bigmachine.Stopped)
+	for {
+		select {
+		case <-time.After(heartbeatPeriod(m.worker.OrphanTimeout)):
+		case <-stopped:
+			return
+		case <-ctx.Done():
+			return
+		}
+		if err := mach.Call(ctx, "Worker.Heartbeat", struct{}{}, nil); err != nil {
+			log.Debug.Printf("heartbeat %s: %v", mach.Addr, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// This file implements OpenTelemetry tracing of evaluations. Each
+// invocation is traced by a span, which parents a span for each of the
+// stages (the shards of an operation) that are run for it, which in
+// turn parent a span for each task. A task span parents a span for
+// each attempt to run the task. Attempt spans propagate to workers,
+// which trace their runs of the task with a span that is parented by
+// the attempt.
+
+// instrumentationName names the tracer that emits bigslice spans.
+const instrumentationName = "github.com/grailbio/bigslice/exec"
+
+// traceProp propagates trace contexts from the driver to workers.
+var traceProp = propagation.TraceContext{}
+
+// tracerFromContext returns the tracer with which to trace operations
+// of the provided context: the tracer of the provider of the context's
+// span, if it has one, or else the tracer of the global provider.
+func tracerFromContext(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(instrumentationName)
+	}
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// endSpan ends the provided span, recording err, if it is non-nil, as
+// the span's status.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTrace returns the encoding of the trace context of the span
+// with the provided span context, to be carried to a worker. It
+// returns nil if the span context is invalid.
+func injectTrace(sc trace.SpanContext) map[string]string {
+	if !sc.IsValid() {
+		return nil
+	}
+	carrier := make(propagation.MapCarrier)
+	traceProp.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier
+}
+
+// extractTrace returns ctx with the remote span context that is
+// encoded in the provided carrier, as injected by injectTrace.
+func extractTrace(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return traceProp.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+func taskAttributes(task *Task) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("bigslice.task", task.Name.String()),
+		attribute.Int("bigslice.shard", task.Name.Shard),
+		attribute.Int("bigslice.num_shard", task.Name.NumShard),
+	)
+}
+
+// evalTracer traces the stages, tasks, and task attempts of an
+// evaluation. Stages comprise the shards of an operation, and are
+// keyed by the name of their first shard. It is not safe for
+// concurrent use, except for EndAttempt.
+type evalTracer struct {
+	ctx    context.Context
+	tracer trace.Tracer
+	// stages holds the stages that are being traced.
+	stages map[TaskName]*stageSpan
+	// tasks holds the spans of the tasks that are being traced.
+	tasks map[*Task]trace.Span
+}
+
+type stageSpan struct {
+	ctx  context.Context
+	span trace.Span
+	// open is the number of the stage's task spans that have yet to end.
+	open int
+	// done is the set of the stage's tasks that have completed.
+	done map[*Task]bool
+}
+
+func newEvalTracer(ctx context.Context) *evalTracer {
+	return &evalTracer{
+		ctx:    ctx,
+		tracer: tracerFromContext(ctx),
+		stages: make(map[TaskName]*stageSpan),
+		tasks:  make(map[*Task]trace.Span),
+	}
+}
+
+// stageName returns the key of the provided task's stage.
+func stageName(task *Task) TaskName {
+	name := task.Name
+	name.Shard = 0
+	return name
+}
+
+// An attemptSpan is the span of an attempt to run a task.
+type attemptSpan struct {
+	trace.Span
+	// index is the index of the attempt among the task's attempts.
+	index int
+}
+
+// StartAttempt starts the span of an attempt to run the provided task,
+// starting the spans of the task and its stage if needed, and records
+// it in the task, so that executors may propagate it. The caller must
+// hold the task's lock.
+func (e *evalTracer) StartAttempt(task *Task) attemptSpan {
+	stage := e.stages[stageName(task)]
+	if stage == nil {
+		stage = &stageSpan{done: make(map[*Task]bool)}
+		stage.ctx, stage.span = e.tracer.Start(e.ctx, "bigslice.stage",
+			trace.WithAttributes(
+				attribute.String("bigslice.op", task.Name.Op),
+				attribute.Int("bigslice.num_shard", task.Name.NumShard),
+			))
+		e.stages[stageName(task)] = stage
+	}
+	taskSpan, ok := e.tasks[task]
+	if !ok {
+		_, taskSpan = e.tracer.Start(stage.ctx, "bigslice.task", taskAttributes(task))
+		e.tasks[task] = taskSpan
+		stage.open++
+	}
+	index := len(task.attempts)
+	_, span := e.tracer.Start(trace.ContextWithSpan(stage.ctx, taskSpan), "bigslice.attempt",
+		taskAttributes(task),
+		trace.WithAttributes(attribute.Int("bigslice.attempt", index+1)))
+	task.spanContext = span.SpanContext()
+	return attemptSpan{span, index}
+}
+
+// EndAttempt ends the provided attempt span of the provided task, which
+// has completed. The caller must hold the task's lock.
+func (e *evalTracer) EndAttempt(task *Task, span attemptSpan) {
+	if span.index < len(task.attempts) {
+		span.SetAttributes(attribute.String("bigslice.machine", task.attempts[span.index].Machine))
+	}
+	span.SetAttributes(attribute.String("bigslice.state", task.state.String()))
+	switch task.state {
+	case TaskOk:
+	case TaskLost:
+		span.SetStatus(codes.Error, "task lost")
+	default:
+		endSpan(span, task.err)
+		return
+	}
+	span.End()
+}
+
+// Done ends the span of the provided task if it has completed, and the
+// span of its stage if all of the stage's tasks have completed.
+func (e *evalTracer) Done(task *Task) {
+	span, ok := e.tasks[task]
+	if !ok {
+		return
+	}
+	state, err := task.State(), task.Err()
+	if state != TaskOk && state != TaskErr {
+		return
+	}
+	endSpan(span, err)
+	delete(e.tasks, task)
+	stage := e.stages[stageName(task)]
+	stage.open--
+	stage.done[task] = true
+	if stage.open > 0 || len(stage.done) < task.Name.NumShard {
+		return
+	}
+	stage.span.End()
+	delete(e.stages, stageName(task))
+}
+
+// Finish ends all spans that are still being traced, as when the
+// evaluation is abandoned.
+func (e *evalTracer) Finish() {
+	for task, span := range e.tasks {
+		span.End()
+		delete(e.tasks, task)
+	}
+	for name, stage := range e.stages {
+		stage.span.End()
+		delete(e.stages, name)
+	}
+}
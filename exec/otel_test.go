@@ -0,0 +1,219 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testTracerProvider is a trace.TracerProvider that records the spans
+// that it starts.
+type testTracerProvider struct {
+	mu     sync.Mutex
+	nextID uint64
+	spans  []*testSpan
+}
+
+func (p *testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return testTracer{p}
+}
+
+// Spans returns the recorded spans with the provided name.
+func (p *testTracerProvider) Spans(name string) []*testSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var spans []*testSpan
+	for _, span := range p.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+type testTracer struct{ p *testTracerProvider }
+
+func (t testTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	t.p.mu.Lock()
+	t.p.nextID++
+	var (
+		traceID trace.TraceID
+		spanID  trace.SpanID
+	)
+	if parent.IsValid() {
+		traceID = parent.TraceID()
+	} else {
+		binary.BigEndian.PutUint64(traceID[:], t.p.nextID)
+	}
+	binary.BigEndian.PutUint64(spanID[:], t.p.nextID)
+	span := &testSpan{
+		provider: t.p,
+		name:     name,
+		parent:   parent,
+		attrs:    make(map[attribute.Key]attribute.Value),
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+	for _, kv := range config.Attributes() {
+		span.attrs[kv.Key] = kv.Value
+	}
+	t.p.spans = append(t.p.spans, span)
+	t.p.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type testSpan struct {
+	trace.Span
+	provider *testTracerProvider
+	name     string
+	sc       trace.SpanContext
+	parent   trace.SpanContext
+
+	mu    sync.Mutex
+	attrs map[attribute.Key]attribute.Value
+	code  codes.Code
+	ended bool
+}
+
+func (s *testSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *testSpan) TracerProvider() trace.TracerProvider { return s.provider }
+
+func (s *testSpan) IsRecording() bool { return true }
+
+func (s *testSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *testSpan) SetStatus(code codes.Code, _ string) {
+	s.mu.Lock()
+	s.code = code
+	s.mu.Unlock()
+}
+
+func (s *testSpan) RecordError(error, ...trace.EventOption) {}
+
+func (s *testSpan) End(...trace.SpanEndOption) {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
+
+func (s *testSpan) Ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+func (s *testSpan) Attr(key attribute.Key) attribute.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attrs[key]
+}
+
+func TestTracing(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	tp := new(testTracerProvider)
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(2), TracerProvider(tp))
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	invs := tp.Spans("bigslice.invocation")
+	if got, want := len(invs), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	inv := invs[0]
+	if inv.parent.IsValid() {
+		t.Error("invocation span has a parent")
+	}
+	if got, want := inv.Attr("bigslice.executor").AsString(), sess.executor.Name(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Each span must be parented by a span of the next higher level.
+	spans := make(map[trace.SpanID]*testSpan)
+	for _, span := range tp.spans {
+		spans[span.sc.SpanID()] = span
+	}
+	for _, c := range []struct {
+		name, parent string
+		n            int
+	}{
+		{"bigslice.stage", "bigslice.invocation", 2},
+		{"bigslice.task", "bigslice.stage", 8},
+		{"bigslice.attempt", "bigslice.task", 8},
+		{"bigslice.worker.run", "bigslice.attempt", 8},
+	} {
+		levelSpans := tp.Spans(c.name)
+		if got, want := len(levelSpans), c.n; got != want {
+			t.Errorf("%s: got %v, want %v", c.name, got, want)
+		}
+		for _, span := range levelSpans {
+			if got, want := span.sc.TraceID(), inv.sc.TraceID(); got != want {
+				t.Errorf("%s: got %v, want %v", c.name, got, want)
+			}
+			parent := spans[span.parent.SpanID()]
+			if parent == nil || parent.name != c.parent {
+				t.Errorf("%s: not parented by %s", c.name, c.parent)
+			}
+		}
+	}
+	for _, span := range tp.Spans("bigslice.attempt") {
+		if got, want := span.Attr("bigslice.state").AsString(), "OK"; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	for _, span := range tp.spans {
+		// Worker spans end asynchronously with respect to the driver.
+		if span.name != "bigslice.worker.run" && !span.Ended() {
+			t.Errorf("span %s not ended", span.name)
+		}
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	if carrier := injectTrace(trace.SpanContext{}); carrier != nil {
+		t.Errorf("got %v, want nil", carrier)
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := extractTrace(context.Background(), injectTrace(sc))
+	got := trace.SpanContextFromContext(ctx)
+	if !got.IsRemote() {
+		t.Error("span context is not remote")
+	}
+	if got, want := got.WithRemote(false), sc; !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
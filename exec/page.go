@@ -0,0 +1,373 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+const (
+	// DefaultPageSize is the number of rows in a page of a result when
+	// no page size is requested.
+	DefaultPageSize = 1000
+	// maxPageCursors is the maximum number of positioned readers that a
+	// result retains to resume reading subsequent pages.
+	maxPageCursors = 16
+)
+
+// A PageRequest specifies a page of a result to read with
+// Result.ReadPage.
+type PageRequest struct {
+	// Token is the token of the page to read, as returned in Page.Next
+	// by a previous call to ReadPage with the same Start and End. The
+	// first page is read if Token is empty.
+	Token string
+	// Size is the maximum number of rows in the page. DefaultPageSize
+	// is used if Size is not positive.
+	Size int
+	// Start and End, if not nil, restrict the rows that are read to
+	// those whose key (the result's first column) is at least Start and
+	// less than End, respectively. They must have the type of the
+	// result's first column, which must be sortable.
+	Start, End interface{}
+}
+
+// A Page is a page of the rows of a result.
+type Page struct {
+	// Frame holds the rows of the page. It has the result's type, and
+	// fewer rows than were requested only if it is the last page.
+	frame.Frame
+	// Next is the token of the next page, or empty if there are no more
+	// rows to read.
+	Next string
+}
+
+// ReadPage reads the page of the result r specified by the provided
+// request. Pages are read directly from the stored outputs of r's
+// tasks, so that serving layers may page through a finished result, or
+// read a range of its keys, without rescanning all of it: the readers
+// of recently read pages are retained, so that reading the next page
+// resumes where the previous one ended.
+//
+// Key ranges are read most efficiently from results whose shard type
+// is bigslice.RangeShard: reading skips the shards that precede the
+// range, and ends at the first key past it. Key ranges of other
+// results are read by filtering all of their rows.
+//
+// ReadPage returns an error of kind errors.Invalid if the token or key
+// range is invalid for r.
+func (r *Result) ReadPage(ctx context.Context, req PageRequest) (*Page, error) {
+	size := req.Size
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	bounds, err := r.pageBounds(req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+	cur := r.cursors.take(req.Token)
+	if cur == nil {
+		var shard, offset int
+		if req.Token != "" {
+			if shard, offset, err = r.decodePageToken(req.Token); err != nil {
+				return nil, err
+			}
+		} else if bounds.start && r.ShardType() == bigslice.RangeShard {
+			if shard, err = r.findShard(ctx, bounds); err != nil {
+				return nil, err
+			}
+		}
+		cur = &pageCursor{shard: shard}
+		if err := cur.seek(ctx, r, offset); err != nil {
+			cur.close()
+			return nil, err
+		}
+	}
+	page := &Page{Frame: frame.Make(r, size, size)}
+	n, done, err := cur.read(ctx, r, page.Frame, bounds)
+	if err != nil {
+		cur.close()
+		return nil, err
+	}
+	page.Frame = page.Frame.Slice(0, n)
+	if done {
+		cur.close()
+		return page, nil
+	}
+	page.Next = r.encodePageToken(cur.shard, cur.offset)
+	r.cursors.put(page.Next, cur)
+	return page, nil
+}
+
+func (r *Result) encodePageToken(shard, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d.%d", r.invIndex, shard, offset)))
+}
+
+func (r *Result) decodePageToken(token string) (shard, offset int, err error) {
+	p, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, 0, errors.E(errors.Invalid, "invalid page token", err)
+	}
+	var inv uint64
+	if _, err := fmt.Sscanf(string(p), "%d.%d.%d", &inv, &shard, &offset); err != nil {
+		return 0, 0, errors.E(errors.Invalid, "invalid page token", err)
+	}
+	if inv != r.invIndex || shard < 0 || shard > len(r.tasks) || offset < 0 {
+		return 0, 0, errors.E(errors.Invalid, fmt.Sprintf("page token %s is not valid for invocation %d", token, r.invIndex))
+	}
+	return shard, offset, nil
+}
+
+// pageBounds holds the key range of a page request. Keys holds the
+// range's bounds in rows 0 (start) and 1 (end), followed by scratch
+// space into which the keys of rows are copied to be compared.
+type pageBounds struct {
+	start, end bool
+	keys       frame.Frame
+}
+
+// pageBoundsScratch is the number of scratch rows in pageBounds.keys.
+const pageBoundsScratch = 1024
+
+func (r *Result) pageBounds(start, end interface{}) (pageBounds, error) {
+	var b pageBounds
+	if start == nil && end == nil {
+		return b, nil
+	}
+	typ := r.Out(0)
+	if !frame.CanCompare(typ) {
+		return b, errors.E(errors.Invalid, fmt.Sprintf("keys of type %s cannot be compared", typ))
+	}
+	b.keys = frame.Make(slicetype.New(typ), 2+pageBoundsScratch, 2+pageBoundsScratch)
+	for i, bound := range []interface{}{start, end} {
+		if bound == nil {
+			continue
+		}
+		v := reflect.ValueOf(bound)
+		if v.Type() != typ {
+			return b, errors.E(errors.Invalid, fmt.Sprintf("key range bound %v has type %s, not %s", bound, v.Type(), typ))
+		}
+		b.keys.Index(0, i).Set(v)
+	}
+	b.start, b.end = start != nil, end != nil
+	return b, nil
+}
+
+// IsZero tells whether the bounds do not restrict keys.
+func (b *pageBounds) IsZero() bool {
+	return !b.start && !b.end
+}
+
+// load copies the keys of the provided rows into scratch space, so
+// that they may be compared by before and after.
+func (b *pageBounds) load(rows frame.Frame) {
+	reflect.Copy(b.keys.Value(0).Slice(2, 2+rows.Len()), rows.Value(0))
+}
+
+// before tells whether the key of loaded row i precedes the range.
+func (b *pageBounds) before(i int) bool {
+	return b.start && b.keys.LessColumn(0, 2+i, 0)
+}
+
+// after tells whether the key of loaded row i follows the range.
+func (b *pageBounds) after(i int) bool {
+	return b.end && !b.keys.LessColumn(0, 2+i, 1)
+}
+
+// findShard returns the first shard of the range-sharded result r
+// that may contain keys in the provided bounds. Shards are identified
+// by their first keys, so that only the first row of each shard is
+// read.
+func (r *Result) findShard(ctx context.Context, bounds pageBounds) (int, error) {
+	first := frame.Make(r, 1, 1)
+	var shard int
+	for i := range r.tasks {
+		reader := r.sess.executor.Reader(r.tasks[i], 0)
+		n, err := reader.Read(ctx, first)
+		reader.Close()
+		if err != nil && err != sliceio.EOF {
+			return 0, err
+		}
+		if n == 0 {
+			continue
+		}
+		bounds.load(first)
+		if bounds.keys.LessColumn(0, 0, 2) {
+			// The shard's first key follows the start of the range, so the
+			// range begins in an earlier shard, if any.
+			break
+		}
+		shard = i
+	}
+	return shard, nil
+}
+
+// pageCursor is a positioned reader of a result's rows: reader reads
+// the rows of shard beginning at offset.
+type pageCursor struct {
+	shard, offset int
+	reader        sliceio.ReadCloser
+}
+
+// seek positions the cursor at the provided offset of its shard.
+func (c *pageCursor) seek(ctx context.Context, r *Result, offset int) error {
+	if c.shard >= len(r.tasks) {
+		return nil
+	}
+	c.reader = r.sess.executor.Reader(r.tasks[c.shard], 0)
+	c.offset = 0
+	if offset == 0 {
+		return nil
+	}
+	skip := frame.Make(r, *defaultChunksize, *defaultChunksize)
+	for c.offset < offset {
+		m := offset - c.offset
+		if m > skip.Len() {
+			m = skip.Len()
+		}
+		n, err := c.reader.Read(ctx, skip.Slice(0, m))
+		c.offset += n
+		if err == sliceio.EOF {
+			return errors.E(errors.Invalid, fmt.Sprintf("page offset %d is past the end of shard %d", offset, c.shard))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads the rows within bounds into out, advancing the cursor. It
+// returns the number of rows read, and whether the cursor has reached
+// the end of the rows in bounds.
+func (c *pageCursor) read(ctx context.Context, r *Result, out frame.Frame, bounds pageBounds) (n int, done bool, err error) {
+	sorted := r.ShardType() == bigslice.RangeShard
+	var buf frame.Frame
+	if !bounds.IsZero() {
+		buf = frame.Make(r, pageBoundsScratch, pageBoundsScratch)
+	}
+	for n < out.Len() {
+		if c.shard >= len(r.tasks) {
+			return n, true, nil
+		}
+		var (
+			m    int
+			rerr error
+		)
+		if bounds.IsZero() {
+			m, rerr = c.reader.Read(ctx, out.Slice(n, out.Len()))
+			c.offset += m
+			n += m
+		} else {
+			max := out.Len() - n
+			if max > buf.Len() {
+				max = buf.Len()
+			}
+			m, rerr = c.reader.Read(ctx, buf.Slice(0, max))
+			bounds.load(buf.Slice(0, m))
+			for i := 0; i < m; i++ {
+				c.offset++
+				if bounds.before(i) {
+					continue
+				}
+				if bounds.after(i) {
+					if sorted {
+						// Keys of range-sharded results increase, so there are
+						// no more keys in range.
+						return n, true, nil
+					}
+					continue
+				}
+				frame.Copy(out.Slice(n, n+1), buf.Slice(i, i+1))
+				n++
+			}
+		}
+		if rerr == sliceio.EOF {
+			c.reader.Close()
+			c.reader = nil
+			c.shard++
+			if err := c.seek(ctx, r, 0); err != nil {
+				return n, false, err
+			}
+			continue
+		}
+		if rerr != nil {
+			return n, false, rerr
+		}
+	}
+	return n, false, nil
+}
+
+func (c *pageCursor) close() {
+	if c.reader != nil {
+		c.reader.Close()
+		c.reader = nil
+	}
+}
+
+// pageCursors retains the cursors of recently read pages, keyed by the
+// token of the next page.
+type pageCursors struct {
+	mu      sync.Mutex
+	cursors map[string]*pageCursor
+	order   []string
+}
+
+// take removes and returns the cursor for the provided token, or nil
+// if there is none.
+func (p *pageCursors) take(token string) *pageCursor {
+	if token == "" {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur := p.cursors[token]
+	delete(p.cursors, token)
+	return cur
+}
+
+// put retains the provided cursor for the provided token, closing the
+// least recently retained cursor if there are too many.
+func (p *pageCursors) put(token string, cur *pageCursor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cursors == nil {
+		p.cursors = make(map[string]*pageCursor)
+	}
+	if old := p.cursors[token]; old != nil {
+		old.close()
+	}
+	p.cursors[token] = cur
+	p.order = append(p.order, token)
+	for len(p.cursors) > maxPageCursors {
+		oldest := p.order[0]
+		p.order = p.order[1:]
+		if cur := p.cursors[oldest]; cur != nil {
+			cur.close()
+			delete(p.cursors, oldest)
+		}
+	}
+	// Tokens of cursors that have since been taken are dropped from the
+	// order as it is compacted.
+	if len(p.order) > 2*maxPageCursors {
+		order := p.order[:0]
+		for _, token := range p.order {
+			if p.cursors[token] != nil {
+				order = append(order, token)
+			}
+		}
+		p.order = order
+	}
+}
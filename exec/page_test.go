@@ -0,0 +1,118 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+)
+
+// rangeShardSlice declares its underlying slice to be range-sharded.
+type rangeShardSlice struct {
+	bigslice.Slice
+}
+
+func (rangeShardSlice) ShardType() bigslice.ShardType { return bigslice.RangeShard }
+
+// readPages reads all of the pages of res with the provided request,
+// returning the values of the first column.
+func readPages(t *testing.T, res *Result, req PageRequest) []int {
+	t.Helper()
+	var ints []int
+	for {
+		page, err := res.ReadPage(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Len() > req.Size {
+			t.Fatalf("got page of %d rows, want at most %d", page.Len(), req.Size)
+		}
+		ints = append(ints, page.Interface(0).([]int)...)
+		if page.Next == "" {
+			return ints
+		}
+		req.Token = page.Next
+	}
+}
+
+func TestReadPage(t *testing.T) {
+	const N = 100
+	fn := bigslice.Func(func(rangeShard bool) bigslice.Slice {
+		// Const assigns consecutive ranges of rows to its shards.
+		slice := bigslice.Const(4, rangeSlice(0, N))
+		if rangeShard {
+			return rangeShardSlice{slice}
+		}
+		return slice
+	})
+	ctx := context.Background()
+	testSession(t, func(t *testing.T, sess *Session) {
+		res, err := sess.Run(ctx, fn, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ints := readPages(t, res, PageRequest{Size: 7})
+		sort.Ints(ints)
+		if got, want := ints, rangeSlice(0, N); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		// Pages may be reread from their tokens.
+		page, err := res.ReadPage(ctx, PageRequest{Size: 30})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pages [2][]int
+		for i := range pages {
+			next, err := res.ReadPage(ctx, PageRequest{Token: page.Next, Size: 30})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages[i] = next.Interface(0).([]int)
+		}
+		if !reflect.DeepEqual(pages[0], pages[1]) {
+			t.Errorf("pages differ: %v, %v", pages[0], pages[1])
+		}
+
+		// Key ranges are filtered.
+		ints = readPages(t, res, PageRequest{Size: 8, Start: 30, End: 60})
+		sort.Ints(ints)
+		if got, want := ints, rangeSlice(30, 60); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		// Range-sharded results are read in order.
+		res, err = sess.Run(ctx, fn, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range []struct {
+			start, end interface{}
+			want       []int
+		}{
+			{30, 60, rangeSlice(30, 60)},
+			{nil, 10, rangeSlice(0, 10)},
+			{90, nil, rangeSlice(90, N)},
+			{-10, 1000, rangeSlice(0, N)},
+			{200, 300, nil},
+		} {
+			ints = readPages(t, res, PageRequest{Size: 8, Start: c.start, End: c.end})
+			if got, want := ints, c.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("[%v, %v): got %v, want %v", c.start, c.end, got, want)
+			}
+		}
+
+		if _, err := res.ReadPage(ctx, PageRequest{Token: "bad"}); !errors.Is(errors.Invalid, err) {
+			t.Errorf("got %v, want invalid token error", err)
+		}
+		if _, err := res.ReadPage(ctx, PageRequest{Start: "x"}); !errors.Is(errors.Invalid, err) {
+			t.Errorf("got %v, want invalid key error", err)
+		}
+	})
+}
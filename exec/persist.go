@@ -0,0 +1,140 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/internal/slicecache"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A persistRef refers to the tasks of a previous invocation that
+// computed a persisted slice. Because task names are identical across
+// the driver and workers, the reference is sufficient to find the
+// tasks wherever the invocation has been compiled.
+type persistRef struct {
+	// InvIndex is the index of the invocation that computed the slice.
+	InvIndex uint64
+	// Op is the name of the operation of the tasks that computed the
+	// slice.
+	Op string
+	// NumShard is the number of shards of the slice.
+	NumShard int
+}
+
+// Name returns the name of the ref's task for the provided shard.
+func (r persistRef) Name(shard int) TaskName {
+	return TaskName{InvIndex: r.InvIndex, Op: r.Op, Shard: shard, NumShard: r.NumShard}
+}
+
+// persistedTasks holds the tasks that compute a persisted slice.
+type persistedTasks struct {
+	slice bigslice.Slice
+	tasks []*Task
+}
+
+// ref returns a reference to the tasks.
+func (p persistedTasks) ref() persistRef {
+	return persistRef{
+		InvIndex: p.tasks[0].Name.InvIndex,
+		Op:       p.tasks[0].Name.Op,
+		NumShard: len(p.tasks),
+	}
+}
+
+// persist returns the tasks that compute the provided persisted slice.
+// If the slice's key was persisted by a previous invocation, the
+// previous invocation's tasks are returned; otherwise the slice is
+// compiled into single-partition tasks of its own, which are shared by
+// all of the slices in the invocation that read the key.
+func (c *compiler) persist(slice bigslice.Slice, p bigslice.Persister) ([]*Task, error) {
+	key := p.PersistKey()
+	if ref, ok := c.inv.Env.Persisted[key]; ok {
+		if c.inv.persisted == nil {
+			return nil, fmt.Errorf("persist %s: previous invocation %d is not available", key, ref.InvIndex)
+		}
+		return c.inv.persisted(ref)
+	}
+	if persisted, ok := c.persists[key]; ok {
+		if persisted.slice != slice {
+			return nil, fmt.Errorf("persist %s: key is persisted by multiple slices (%s, %s)", key, persisted.slice.Name(), slice.Name())
+		}
+		return persisted.tasks, nil
+	}
+	tasks, err := c.compileSlice(slice, partitioner{})
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		task.Storage = p.StorageLevel()
+	}
+	c.persists[key] = persistedTasks{slice, tasks}
+	return tasks, nil
+}
+
+// persistCache returns the shard cache through which the provided
+// persisted slice is written to and read from the shared store. It is
+// empty unless the slice is persisted in the shared store and the
+// invocation's environment has a persist prefix.
+func (c *compiler) persistCache(slice bigslice.Slice, p bigslice.Persister) slicecache.ShardCache {
+	if p.StorageLevel() != bigslice.PersistShared || c.inv.Env.PersistPrefix == "" {
+		return slicecache.Empty
+	}
+	cache := slicecache.NewFileShardCache(context.Background(), persistPath(c.inv.Env.PersistPrefix, p.PersistKey()), slice.NumShard())
+	cache.SetType(slice)
+	return cache
+}
+
+// persistPath returns the path prefix of the files in which the slice
+// persisted under the provided key is stored in the shared store.
+func persistPath(prefix, key string) string {
+	return file.Join(prefix, key, "shard")
+}
+
+// resolvePersisted records, in the compilation environment of the
+// invocation inv, which computes the provided slice, the tasks of
+// previous invocations that computed the persisted slices read by the
+// invocation, as provided by the function lookup. It checks that the
+// previously persisted slices are compatible with the slices that read
+// them.
+func resolvePersisted(inv *execInvocation, slice bigslice.Slice, lookup func(key string) (persistedTasks, bool)) error {
+	visited := make(map[bigslice.Slice]bool)
+	var walk func(bigslice.Slice) error
+	walk = func(slice bigslice.Slice) error {
+		if visited[slice] {
+			return nil
+		}
+		visited[slice] = true
+		if _, ok := bigslice.Unwrap(slice).(*Result); ok {
+			return nil
+		}
+		if p, ok := bigslice.Unwrap(slice).(bigslice.Persister); ok {
+			key := p.PersistKey()
+			if prev, ok := lookup(key); ok {
+				if !typecheck.Equal(prev.slice, slice) {
+					return fmt.Errorf("persist %s: slice type %s does not match persisted type %s", key, slicetype.String(slice), slicetype.String(prev.slice))
+				}
+				if got, want := slice.NumShard(), len(prev.tasks); got != want {
+					return fmt.Errorf("persist %s: slice has %d shards, persisted slice has %d", key, got, want)
+				}
+				inv.Env.Persisted[key] = prev.ref()
+				// The slice's dependencies are not computed.
+				return nil
+			}
+		}
+		for i := 0; i < slice.NumDep(); i++ {
+			if err := walk(slice.Dep(i).Slice); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(slice)
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// persistComputed counts the rows computed by the slices persisted by
+// persistFunc.
+var persistComputed int64
+
+var persistFunc = bigslice.Func(func(level bigslice.StorageLevel, add int) bigslice.Slice {
+	slice := bigslice.Const(4, []int{1, 2, 3, 4, 5, 6, 7, 8})
+	slice = bigslice.Map(slice, func(x int) int {
+		atomic.AddInt64(&persistComputed, 1)
+		return x * 10
+	})
+	slice = bigslice.Persist(slice, fmt.Sprint("tens-", level), level)
+	// Read the persisted slice twice within the invocation.
+	plus := bigslice.Map(slice, func(x int) int { return x + add })
+	return bigslice.Union(slice, plus)
+})
+
+func TestPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	for _, level := range []bigslice.StorageLevel{bigslice.PersistDisk, bigslice.PersistMemory, bigslice.PersistShared} {
+		for name, opt := range map[string]Option{
+			"local":      Local,
+			"bigmachine": Bigmachine(testsystem.New()),
+		} {
+			level, name, opt := level, name, opt
+			t.Run(fmt.Sprint(name, "/", level), func(t *testing.T) {
+				atomic.StoreInt64(&persistComputed, 0)
+				sess := Start(opt, PersistPrefix(dir+"/"+name))
+				defer sess.Shutdown()
+				for add := 1; add <= 3; add++ {
+					res, err := sess.Run(ctx, persistFunc, level, add)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var vals []int
+					r := res.open()
+					err = sliceio.ReadAll(ctx, r, &vals)
+					r.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+					var sum int
+					for _, v := range vals {
+						sum += v
+					}
+					if got, want := sum, 2*360+8*add; got != want {
+						t.Errorf("add %d: got %v, want %v", add, got, want)
+					}
+					// Discarding a result retains the persisted slice.
+					res.Discard(ctx)
+				}
+				if got, want := atomic.LoadInt64(&persistComputed), int64(8); got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				key := fmt.Sprint("tens-", level)
+				if got, want := sess.Persisted(), []string{key}; !reflect.DeepEqual(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				if err := sess.Unpersist(ctx, key); err != nil {
+					t.Fatal(err)
+				}
+				if err := sess.Unpersist(ctx, key); !errors.Is(errors.NotExist, err) {
+					t.Errorf("expected NotExist, got %v", err)
+				}
+				// The evicted slice is computed again.
+				if _, err := sess.Run(ctx, persistFunc, level, 0); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := atomic.LoadInt64(&persistComputed), int64(16); got != want {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestPersistMismatch(t *testing.T) {
+	fn := bigslice.Func(func(nshard int) bigslice.Slice {
+		return bigslice.Persist(bigslice.Const(nshard, []int{1, 2, 3, 4}), "mismatch", bigslice.PersistDisk)
+	})
+	ctx := context.Background()
+	sess := Start(Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(ctx, fn, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sess.Run(ctx, fn, 4); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+)
+
+// Plugins allow a long-lived driver to register new Funcs after its
+// session has started: Funcs that are created when a plugin is opened,
+// e.g., by its package-level variables, are appended to the process's
+// Func registry. Because Funcs are identified by their index in the
+// registry, every worker must load the same plugins, in the same order,
+// as the driver. Executors ensure this before they compile invocations
+// on a worker: workers report the plugins, identified by the
+// fingerprints of their contents, that they have not yet loaded, and
+// only the contents of these are sent to them.
+
+// openPlugin opens the Go plugin at the provided path. It is
+// overridden in tests.
+var openPlugin = func(path string) error {
+	_, err := plugin.Open(path)
+	return err
+}
+
+// A loadedPlugin is a plugin that was loaded by the process.
+type loadedPlugin struct {
+	// Fingerprint is the SHA-256 digest of the plugin's contents.
+	Fingerprint string
+	// Path is the path of the file from which the plugin was loaded.
+	Path string
+}
+
+// A pluginRegistry holds the plugins loaded by a process, in the order
+// in which they were loaded.
+type pluginRegistry struct {
+	mu      sync.Mutex
+	plugins []loadedPlugin
+}
+
+// processPlugins is the registry of the plugins loaded by this process.
+var processPlugins pluginRegistry
+
+// List returns the registry's plugins.
+func (r *pluginRegistry) List() []loadedPlugin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]loadedPlugin(nil), r.plugins...)
+}
+
+// Load loads the plugin at path, whose fingerprint is fp, unless a
+// plugin with the same fingerprint was already loaded.
+func (r *pluginRegistry) Load(fp, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.plugins {
+		if p.Fingerprint == fp {
+			return nil
+		}
+	}
+	if err := openPlugin(path); err != nil {
+		return errors.E(errors.Fatal, fmt.Sprintf("loading plugin %s", path), err)
+	}
+	r.plugins = append(r.plugins, loadedPlugin{fp, path})
+	return nil
+}
+
+// pluginFingerprint returns the fingerprint of the plugin at path.
+func pluginFingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LoadPlugin loads the Go plugin at the provided path into the driver,
+// so that the Funcs it registers may be run by the session. The plugin
+// is loaded by each worker before it next compiles an invocation; its
+// contents are sent only to workers that do not already hold a plugin
+// with the same fingerprint.
+//
+// Go plugins cannot be unloaded, and plugins that are rebuilt with the
+// same plugin path cannot both be loaded by one process. Iterating on
+// plugin code against a warm cluster thus requires that each build be
+// given a distinct plugin path, e.g., by linking it with
+// -ldflags=-pluginpath=<unique name>. A worker whose plugins are not a
+// prefix of those of the driver, e.g., a gRPC agent that was used by a
+// driver that loaded other plugins, cannot be used by the session.
+func (s *Session) LoadPlugin(path string) error {
+	fp, err := pluginFingerprint(path)
+	if err != nil {
+		return err
+	}
+	return processPlugins.Load(fp, path)
+}
+
+// pluginRequest is the argument to Worker.LoadPlugins.
+type pluginRequest struct {
+	// Fingerprints are the fingerprints of the driver's plugins, in the
+	// order in which they were loaded.
+	Fingerprints []string
+	// Contents holds the contents of the plugins that the worker
+	// previously reported missing, keyed by fingerprint.
+	Contents map[string][]byte
+}
+
+// LoadPlugins loads the plugins of the driver that have not yet been
+// loaded by the worker's process, in order. Plugins whose contents are
+// neither provided nor stored in the worker's plugin directory are
+// reported missing, and no plugins are loaded; the driver should retry
+// with their contents.
+func (w *worker) LoadPlugins(ctx context.Context, req pluginRequest, missing *[]string) error {
+	registry, dir := w.pluginRegistry()
+	loaded := registry.List()
+	for i, p := range loaded {
+		if i < len(req.Fingerprints) && req.Fingerprints[i] != p.Fingerprint {
+			return errors.E(errors.Precondition,
+				fmt.Sprintf("worker loaded plugin %s where the driver loaded %s; the worker must be restarted", p.Fingerprint, req.Fingerprints[i]))
+		}
+	}
+	if len(loaded) >= len(req.Fingerprints) {
+		return nil
+	}
+	todo := req.Fingerprints[len(loaded):]
+	for _, fp := range todo {
+		path := filepath.Join(dir, fp+".so")
+		if contents, ok := req.Contents[fp]; ok {
+			if err := writePlugin(dir, path, contents); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			*missing = append(*missing, fp)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(*missing) > 0 {
+		return nil
+	}
+	for _, fp := range todo {
+		path := filepath.Join(dir, fp+".so")
+		log.Printf("loading plugin %s", path)
+		if err := registry.Load(fp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pluginRegistry returns the registry of the worker's plugins, and the
+// directory in which their contents are stored.
+func (w *worker) pluginRegistry() (*pluginRegistry, string) {
+	registry, dir := w.plugins, w.pluginDir
+	if registry == nil {
+		registry = &processPlugins
+	}
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "bigslice-plugins")
+	}
+	return registry, dir
+}
+
+// writePlugin atomically writes the provided plugin contents to path,
+// in directory dir.
+func writePlugin(dir, path string, contents []byte) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "plugin")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// A pluginSync tracks the number of the driver's plugins that have
+// been loaded by a worker, so that workers are asked to load plugins
+// only when the driver has loaded new ones.
+type pluginSync struct {
+	mu sync.Mutex
+	n  int
+}
+
+// Sync ensures that the worker behind the provided client has loaded
+// the plugins of the provided registry.
+func (p *pluginSync) Sync(ctx context.Context, client workerClient, registry *pluginRegistry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plugins := registry.List()
+	if len(plugins) == p.n {
+		return nil
+	}
+	req := pluginRequest{Fingerprints: make([]string, len(plugins))}
+	for i, plugin := range plugins {
+		req.Fingerprints[i] = plugin.Fingerprint
+	}
+	var missing []string
+	if err := client.RetryCall(ctx, "Worker.LoadPlugins", req, &missing); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		req.Contents = make(map[string][]byte)
+		for _, fp := range missing {
+			for _, plugin := range plugins {
+				if plugin.Fingerprint != fp {
+					continue
+				}
+				contents, err := ioutil.ReadFile(plugin.Path)
+				if err != nil {
+					return err
+				}
+				req.Contents[fp] = contents
+			}
+		}
+		missing = nil
+		if err := client.RetryCall(ctx, "Worker.LoadPlugins", req, &missing); err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return errors.E(errors.Invalid, fmt.Sprintf("worker is missing plugins %v", missing))
+		}
+	}
+	p.n = len(plugins)
+	return nil
+}
+
+// Reset resets the sync, so that the worker is asked to load the
+// driver's plugins again, e.g., because it may have restarted.
+func (p *pluginSync) Reset() {
+	p.mu.Lock()
+	p.n = 0
+	p.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grailbio/base/errors"
+)
+
+// pluginClient is a workerClient that calls Worker.LoadPlugins on a
+// worker directly, counting the plugin contents it sends.
+type pluginClient struct {
+	worker *worker
+	calls  int
+	sent   int
+}
+
+func (c *pluginClient) RetryCall(ctx context.Context, method string, arg, reply interface{}) error {
+	if method != "Worker.LoadPlugins" {
+		return errors.E(errors.NotSupported, method)
+	}
+	req := arg.(pluginRequest)
+	c.calls++
+	c.sent += len(req.Contents)
+	return c.worker.LoadPlugins(ctx, req, reply.(*[]string))
+}
+
+func TestPluginSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opened := make(map[string]int)
+	save := openPlugin
+	openPlugin = func(path string) error {
+		opened[filepath.Base(filepath.Dir(path))]++
+		return nil
+	}
+	defer func() { openPlugin = save }()
+
+	var driver pluginRegistry
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, "driver", name+".so")
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		fp, err := pluginFingerprint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := driver.Load(fp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	workerDir := filepath.Join(dir, "worker")
+	client := &pluginClient{worker: &worker{plugins: new(pluginRegistry), pluginDir: workerDir}}
+	var sync pluginSync
+	if err := sync.Sync(ctx, client, &driver); err != nil {
+		t.Fatal(err)
+	}
+	// The worker reports both plugins missing, and they are sent.
+	if got, want := client.calls, 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := client.sent, 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := opened["worker"], 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The worker is not called again until the driver loads new plugins.
+	if err := sync.Sync(ctx, client, &driver); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.calls, 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A restarted worker loads its stored plugins, which are not sent
+	// again.
+	client = &pluginClient{worker: &worker{plugins: new(pluginRegistry), pluginDir: workerDir}}
+	sync.Reset()
+	if err := sync.Sync(ctx, client, &driver); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := client.calls, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := client.sent, 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := opened["worker"], 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Workers that loaded other plugins cannot be used.
+	conflict := new(pluginRegistry)
+	if err := conflict.Load("other", filepath.Join(dir, "other.so")); err != nil {
+		t.Fatal(err)
+	}
+	client = &pluginClient{worker: &worker{plugins: conflict, pluginDir: workerDir}}
+	var fresh pluginSync
+	if err := fresh.Sync(ctx, client, &driver); !errors.Is(errors.Precondition, err) {
+		t.Errorf("got %v, want precondition error", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// DefaultPreviewRows is the number of rows in a preview of a result
+// when no number is requested.
+const DefaultPreviewRows = 20
+
+// A Preview holds the first rows of a result, formatted for display,
+// e.g., by notebook kernels and web tools that embed bigslice.
+type Preview struct {
+	// Columns are the names of the result's columns. Unnamed columns
+	// are named by their index, as "col0", "col1", etc.
+	Columns []string `json:"columns"`
+	// Types are the Go types of the result's columns.
+	Types []string `json:"types"`
+	// Rows are the previewed rows, whose values are formatted with
+	// fmt.Sprint.
+	Rows [][]string `json:"rows"`
+	// More indicates whether the result has more rows than were
+	// previewed.
+	More bool `json:"more"`
+}
+
+// Preview returns a preview of the first n rows of the result r, or of
+// DefaultPreviewRows rows if n is not positive. Rows are read as by
+// ReadPage, so previewing a large result reads only the beginning of
+// it.
+func (r *Result) Preview(ctx context.Context, n int) (*Preview, error) {
+	if n <= 0 {
+		n = DefaultPreviewRows
+	}
+	page, err := r.ReadPage(ctx, PageRequest{Size: n})
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{
+		Columns: make([]string, r.NumOut()),
+		Types:   make([]string, r.NumOut()),
+		Rows:    make([][]string, page.Len()),
+		More:    page.Next != "",
+	}
+	for i := range p.Columns {
+		if p.Columns[i] = slicetype.ColumnName(r.Slice, i); p.Columns[i] == "" {
+			p.Columns[i] = fmt.Sprintf("col%d", i)
+		}
+		p.Types[i] = r.Out(i).String()
+	}
+	for i := range p.Rows {
+		p.Rows[i] = make([]string, len(p.Columns))
+		for j := range p.Columns {
+			p.Rows[i][j] = fmt.Sprint(page.Index(j, i).Interface())
+		}
+	}
+	return p, nil
+}
+
+// WriteText writes the preview p to w as a table of aligned text
+// columns, headed by the columns' names. A final line notes whether
+// the result has more rows.
+func (p *Preview) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(p.Columns, "\t"))
+	for _, row := range p.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if p.More {
+		_, err := fmt.Fprintf(w, "(more than %d rows)\n", len(p.Rows))
+		return err
+	}
+	return nil
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<table class="bigslice-preview">
+<thead><tr>{{range $i, $col := .Columns}}<th title="{{index $.Types $i}}">{{$col}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{if .More}}<p>(more than {{len .Rows}} rows)</p>
+{{end}}`))
+
+// WriteHTML writes the preview p to w as an HTML table, suitable for
+// display by notebook kernels and web tools.
+func (p *Preview) WriteHTML(w io.Writer) error {
+	return previewTemplate.Execute(w, p)
+}
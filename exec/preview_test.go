@@ -0,0 +1,89 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestPreview(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(1, []int{1, 2, 3}, []string{"a", "<b>", "c"})
+		return bigslice.NameColumns(slice, "n", "")
+	})
+	ctx := context.Background()
+	sess := Start(Local)
+	defer sess.Shutdown()
+	res, err := sess.Run(ctx, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := res.Preview(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(p.Columns, " "), "n col1"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := strings.Join(p.Types, " "), "int string"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(p.Rows), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !p.More {
+		t.Error("expected more rows")
+	}
+	var b bytes.Buffer
+	if err := p.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "n  col1\n1  a\n2  <b>\n(more than 2 rows)\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	b.Reset()
+	if err := p.WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	if html := b.String(); !strings.Contains(html, "<td>&lt;b&gt;</td>") || !strings.Contains(html, `<th title="int">n</th>`) {
+		t.Errorf("unexpected HTML %q", html)
+	}
+
+	if p, err = res.Preview(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(p.Rows), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if p.More {
+		t.Error("expected no more rows")
+	}
+}
+
+func TestSummaryWriteHTML(t *testing.T) {
+	ctx := context.Background()
+	sess := Start(Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(ctx, bigslice.Func(func() bigslice.Slice {
+		return bigslice.Const(2, []int{1, 2, 3})
+	})); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := sess.Summary().WriteHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	html := b.String()
+	for _, want := range []string{"local executor: 2/2 tasks done (100%)", `<progress max="2" value="2">`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML %q does not contain %q", html, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+)
+
+// defaultCPUProfileDuration is the duration of CPU profiles that do not
+// specify one.
+const defaultCPUProfileDuration = 30 * time.Second
+
+// A Profile describes a profile to be captured from a worker by
+// Session.Profile or Session.ProfileTask.
+type Profile struct {
+	// Name is the name of the profile: "cpu", or the name of a profile
+	// maintained by package runtime/pprof, e.g., "heap", "goroutine",
+	// "mutex", or "block".
+	Name string
+	// Duration is the duration over which a CPU profile is collected.
+	// If zero, CPU profiles are collected for 30 seconds.
+	Duration time.Duration
+	// Debug is the debug level with which the profile is written, as
+	// interpreted by (*pprof.Profile).WriteTo. Profiles written with
+	// debug level 0 are gzip-compressed protocol buffers that may be
+	// read by "go tool pprof"; other levels produce text. Debug is
+	// ignored for CPU profiles.
+	Debug int
+	// GC indicates whether to run a garbage collection before capturing
+	// a heap profile, so that it reflects the current live heap.
+	GC bool
+}
+
+// writeProfile captures the profile p of the current process and
+// writes it to w.
+func writeProfile(ctx context.Context, w io.Writer, p Profile) error {
+	if p.Name != "cpu" {
+		prof := pprof.Lookup(p.Name)
+		if prof == nil {
+			return errors.E(errors.NotExist, fmt.Sprintf("profile %s", p.Name))
+		}
+		if p.GC && p.Name == "heap" {
+			runtime.GC()
+		}
+		return prof.WriteTo(w, p.Debug)
+	}
+	dur := p.Duration
+	if dur <= 0 {
+		dur = defaultCPUProfileDuration
+	}
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return errors.E(errors.Unavailable, "starting CPU profile", err)
+	}
+	var err error
+	select {
+	case <-time.After(dur):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	pprof.StopCPUProfile()
+	return err
+}
+
+// Profile captures the requested profile of the worker's process. The
+// profile is streamed to the caller through rc once it has been
+// captured.
+func (w *worker) Profile(ctx context.Context, p Profile, rc *io.ReadCloser) error {
+	var b bytes.Buffer
+	if err := writeProfile(ctx, &b, p); err != nil {
+		return err
+	}
+	*rc = ioutil.NopCloser(&b)
+	return nil
+}
+
+// A profiler is an executor that can capture profiles from the
+// machines on which it runs tasks.
+type profiler interface {
+	// profile captures the profile p from the machine with the
+	// provided address.
+	profile(ctx context.Context, addr string, p Profile) (io.ReadCloser, error)
+}
+
+// Profile captures the profile p from the worker machine with the
+// provided address, and writes it to w. Profile returns an error of
+// kind errors.NotSupported if the session's executor cannot profile its
+// machines, and of kind errors.NotExist if it does not manage the
+// machine.
+func (s *Session) Profile(ctx context.Context, w io.Writer, addr string, p Profile) error {
+	// Workers run the same binary as the driver, so unknown profiles
+	// are rejected here.
+	if p.Name != "cpu" && pprof.Lookup(p.Name) == nil {
+		return errors.E(errors.NotExist, fmt.Sprintf("profile %s", p.Name))
+	}
+	prof, ok := s.executor.(profiler)
+	if !ok {
+		return errors.E(errors.NotSupported, fmt.Sprintf("executor %s does not support profiling machines", s.executor.Name()))
+	}
+	rc, err := prof.profile(ctx, addr, p)
+	if err != nil {
+		return err
+	}
+	defer rc.Close() // nolint: errcheck
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// ProfileTask captures the profile p from the worker machine that is
+// running the named task, or that last ran it, and writes it to w.
+// Tasks are named as in the session's task graph (see Session.Graph).
+func (s *Session) ProfileTask(ctx context.Context, w io.Writer, task string, p Profile) error {
+	addr, err := s.taskMachine(task)
+	if err != nil {
+		return err
+	}
+	return s.Profile(ctx, w, addr, p)
+}
+
+// taskMachine returns the address of the machine on which the named
+// task's latest attempt was run.
+func (s *Session) taskMachine(name string) (string, error) {
+	s.mu.Lock()
+	tasks := make(map[*Task]bool, len(s.roots))
+	for task := range s.roots {
+		task.all(tasks)
+	}
+	s.mu.Unlock()
+	for task := range tasks {
+		if task.Name.String() != name {
+			continue
+		}
+		attempts := task.Attempts()
+		if len(attempts) == 0 {
+			return "", errors.E(errors.NotExist, fmt.Sprintf("task %s has not been run", name))
+		}
+		return attempts[len(attempts)-1].Machine, nil
+	}
+	return "", errors.E(errors.NotExist, fmt.Sprintf("task %s", name))
+}
+
+// handleProfile serves profiles of worker machines. The machine is
+// given by the "machine" parameter, or by the "task" parameter, in
+// which case the machine that ran the named task is profiled. The
+// profile is named by the "name" parameter, and is further described
+// by the optional parameters "seconds", "debug", and "gc", as in
+// net/http/pprof.
+func (s *Session) handleProfile(w http.ResponseWriter, r *http.Request) {
+	var (
+		p    = Profile{Name: r.FormValue("name")}
+		addr = r.FormValue("machine")
+		err  error
+	)
+	if p.Name == "" {
+		p.Name = "cpu"
+	}
+	if sec := r.FormValue("seconds"); sec != "" {
+		n, parseErr := strconv.Atoi(sec)
+		if parseErr != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid seconds %q", sec), http.StatusBadRequest)
+			return
+		}
+		p.Duration = time.Duration(n) * time.Second
+	}
+	if debug := r.FormValue("debug"); debug != "" {
+		if p.Debug, err = strconv.Atoi(debug); err != nil {
+			http.Error(w, fmt.Sprintf("invalid debug %q", debug), http.StatusBadRequest)
+			return
+		}
+	}
+	p.GC = r.FormValue("gc") != "" && r.FormValue("gc") != "0"
+	if task := r.FormValue("task"); task != "" {
+		if addr, err = s.taskMachine(task); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	if addr == "" {
+		http.Error(w, "no machine or task specified", http.StatusBadRequest)
+		return
+	}
+	// Capture the profile before writing the response, so that
+	// errors are reported with an appropriate status code.
+	var b bytes.Buffer
+	if err = s.Profile(r.Context(), &b, addr, p); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(errors.NotExist, err):
+			code = http.StatusNotFound
+		case errors.Is(errors.NotSupported, err):
+			code = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if p.Name == "cpu" || p.Debug == 0 {
+		w.Header().Set("content-type", "application/octet-stream")
+		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=%q", p.Name+".pprof"))
+	} else {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+	}
+	if _, err := b.WriteTo(w); err != nil {
+		log.Error.Printf("exec.Session: /debug/profile: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigmachine/testsystem"
+)
+
+// isGzip tells whether p is gzip-compressed, as are profiles in the
+// protocol buffer format.
+func isGzip(p []byte) bool {
+	return len(p) > 2 && p[0] == 0x1f && p[1] == 0x8b
+}
+
+// testProfileTask runs grpcTestFunc in the provided session, and then
+// captures profiles from the machine that ran one of its tasks.
+func testProfileTask(t *testing.T, sess *Session) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := sess.Run(ctx, grpcTestFunc, 4, 100); err != nil {
+		t.Fatal(err)
+	}
+	task := sess.Graph().Tasks[0].Name
+	var b bytes.Buffer
+	if err := sess.ProfileTask(ctx, &b, task, Profile{Name: "goroutine", Debug: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "goroutine profile:") {
+		t.Errorf("got %.64q, want goroutine profile", b.String())
+	}
+	b.Reset()
+	if err := sess.ProfileTask(ctx, &b, task, Profile{Name: "heap", GC: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !isGzip(b.Bytes()) {
+		t.Errorf("got %.16q, want gzip-compressed heap profile", b.Bytes())
+	}
+	b.Reset()
+	if err := sess.ProfileTask(ctx, &b, task, Profile{Name: "cpu", Duration: 100 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if !isGzip(b.Bytes()) {
+		t.Errorf("got %.16q, want gzip-compressed CPU profile", b.Bytes())
+	}
+	if err := sess.ProfileTask(ctx, &b, task, Profile{Name: "nonexistent"}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+	if err := sess.ProfileTask(ctx, &b, "nonexistent", Profile{Name: "heap"}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+	if err := sess.Profile(ctx, &b, "nonexistent:1234", Profile{Name: "heap"}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+}
+
+func TestProfileTaskBigmachine(t *testing.T) {
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(2))
+	defer sess.Shutdown()
+	testProfileTask(t, sess)
+}
+
+func TestProfileTaskGRPC(t *testing.T) {
+	addrs, stop := startGRPCAgents(t, 2)
+	defer stop()
+	sess := Start(GRPC(addrs), Parallelism(4))
+	defer sess.Shutdown()
+	testProfileTask(t, sess)
+}
+
+func TestProfileHandler(t *testing.T) {
+	sess := Start(Local)
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), grpcTestFunc, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	sess.HandleDebug(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	task := url.QueryEscape(sess.Graph().Tasks[0].Name)
+	for _, c := range []struct {
+		query       string
+		code        int
+		contentType string
+	}{
+		{"task=" + task + "&name=goroutine&debug=1", 200, "text/plain; charset=utf-8"},
+		{"machine=local&name=heap", 200, "application/octet-stream"},
+		{"task=nonexistent&name=heap", 404, ""},
+		{"machine=other&name=heap", 404, ""},
+		{"machine=local&name=nonexistent", 404, ""},
+		{"machine=local&seconds=x", 400, ""},
+		{"name=heap", 400, ""},
+	} {
+		resp, err := http.Get(server.URL + "/debug/profile?" + c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, c.code; got != want {
+			t.Errorf("%s: got %v, want %v", c.query, got, want)
+		}
+		if c.contentType == "" {
+			continue
+		}
+		if got, want := resp.Header.Get("content-type"), c.contentType; got != want {
+			t.Errorf("%s: got %v, want %v", c.query, got, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"sort"
+	"time"
+)
+
+// StageProgress describes the progress of a stage of an invocation,
+// i.e., the tasks that compute the shards of a (pipelined) operation.
+type StageProgress struct {
+	// Invocation is the index of the invocation to which the stage
+	// belongs, and Op is the name of the stage's operation, as in
+	// TaskName.
+	Invocation uint64
+	Op         string
+	// Tasks is the number of tasks in the stage. Done, Running, and
+	// Failed are the numbers of tasks that have completed successfully,
+	// that are running, and that have failed, respectively.
+	Tasks, Done, Running, Failed int
+	// Records and Bytes are the number and encoded size of the records
+	// written by the stage's completed tasks.
+	Records, Bytes int64
+	// TaskDuration is the mean duration of the stage's successful task
+	// attempts; it is zero if no task has yet completed.
+	TaskDuration time.Duration
+	// ETA is the estimated time at which the stage will complete. It is
+	// zero if the stage is complete, or if there is not yet enough
+	// information to estimate it.
+	ETA time.Time
+}
+
+// Fraction returns the fraction of the stage's tasks that are done.
+func (s StageProgress) Fraction() float64 {
+	if s.Tasks == 0 {
+		return 1
+	}
+	return float64(s.Done) / float64(s.Tasks)
+}
+
+// Progress describes the progress of the evaluation of one or more
+// invocations. Progress is estimated from the observed throughput of
+// the tasks that have run so far: the duration of each remaining task
+// is estimated from that of the completed tasks of its stage (or of all
+// stages, if none of its stage's tasks have completed), and the rate at
+// which the remaining work is done is estimated from the rate at which
+// work has been done since evaluation began.
+type Progress struct {
+	// Stages describes the progress of each stage, in dependency order:
+	// stages appear after the stages on which they depend.
+	Stages []StageProgress
+	// Tasks, Done, Running, and Failed are the totals of the
+	// corresponding stage fields.
+	Tasks, Done, Running, Failed int
+	// Records and Bytes are the number and encoded size of the records
+	// written by completed tasks.
+	Records, Bytes int64
+	// Start is the time at which the first task attempt began; it is
+	// zero if no task has been run.
+	Start time.Time
+	// ETA is the estimated time of completion. It is zero if evaluation
+	// is complete, or if there is not yet enough information to estimate
+	// it.
+	ETA time.Time
+}
+
+// Fraction returns the fraction of tasks that are done.
+func (p *Progress) Fraction() float64 {
+	if p.Tasks == 0 {
+		return 1
+	}
+	return float64(p.Done) / float64(p.Tasks)
+}
+
+// Remaining returns the estimated time remaining until completion,
+// relative to now, or zero if it is not known.
+func (p *Progress) Remaining(now time.Time) time.Duration {
+	if p.ETA.IsZero() || p.ETA.Before(now) {
+		return 0
+	}
+	return p.ETA.Sub(now)
+}
+
+// Progress returns the progress of the evaluation of all of the
+// invocations that have been run by the session, and that have not
+// since been discarded, including those that are currently being
+// evaluated.
+func (s *Session) Progress() *Progress {
+	s.mu.Lock()
+	roots := make([]*Task, 0, len(s.roots))
+	for task := range s.roots {
+		roots = append(roots, task)
+	}
+	s.mu.Unlock()
+	return computeProgress(roots, time.Now())
+}
+
+// Progress returns the progress of the evaluation of r's task graph.
+// Tasks whose outputs are lost after r is computed, e.g., because their
+// machines failed, are recomputed when r is read, and are reported as
+// not done until then.
+func (r *Result) Progress() *Progress {
+	return computeProgress(r.tasks, time.Now())
+}
+
+// stageKey identifies a stage.
+type stageKey struct {
+	inv uint64
+	op  string
+}
+
+// stageEstimate accumulates the state of a stage from which its
+// progress is estimated.
+type stageEstimate struct {
+	StageProgress
+	depth int
+	// done is the total duration of the stage's successful task
+	// attempts; running is the time elapsed so far by its running
+	// attempts.
+	done, running time.Duration
+	// nrunning is the number of running tasks whose attempts are
+	// accounted for in running.
+	nrunning int
+}
+
+// computeProgress computes the progress of the task graphs rooted at
+// the provided tasks as of now.
+func computeProgress(roots []*Task, now time.Time) *Progress {
+	all := make(map[*Task]bool)
+	for _, task := range roots {
+		task.all(all)
+	}
+	var (
+		stages = make(map[stageKey]*stageEstimate)
+		depths = make(map[*Task]int)
+		p      = new(Progress)
+	)
+	for task := range all {
+		key := stageKey{task.Invocation.Index, task.Name.Op}
+		stage := stages[key]
+		if stage == nil {
+			stage = &stageEstimate{StageProgress: StageProgress{Invocation: key.inv, Op: key.op}}
+			stages[key] = stage
+		}
+		if depth := taskDepth(task, depths); depth > stage.depth {
+			stage.depth = depth
+		}
+		stage.Tasks++
+		task.Lock()
+		state := task.state
+		var last TaskAttempt
+		if n := len(task.attempts); n > 0 {
+			last = task.attempts[n-1]
+			if p.Start.IsZero() || task.attempts[0].Start.Before(p.Start) {
+				p.Start = task.attempts[0].Start
+			}
+		}
+		var records, bytes int64
+		if task.vals != nil {
+			records, bytes = task.vals["write"], task.vals["writeBytes"]
+		}
+		task.Unlock()
+		switch state {
+		case TaskOk:
+			stage.Done++
+			stage.Records += records
+			stage.Bytes += bytes
+			if !last.End.IsZero() && last.State == TaskOk {
+				stage.done += last.End.Sub(last.Start)
+			}
+		case TaskRunning:
+			stage.Running++
+			if !last.Start.IsZero() && last.End.IsZero() {
+				stage.running += now.Sub(last.Start)
+				stage.nrunning++
+			}
+		case TaskErr:
+			stage.Failed++
+		}
+	}
+	// Compute the mean task duration of each stage, and of all stages,
+	// from the successful attempts of completed tasks.
+	var (
+		total time.Duration
+		ndone int
+	)
+	for _, stage := range stages {
+		if stage.Done > 0 {
+			stage.TaskDuration = stage.done / time.Duration(stage.Done)
+		}
+		total += stage.done
+		ndone += stage.Done
+	}
+	var mean time.Duration
+	if ndone > 0 {
+		mean = total / time.Duration(ndone)
+	}
+	// The rate at which work (in task time) has been done since
+	// evaluation began approximates the effective parallelism of
+	// evaluation.
+	var (
+		worked    = total
+		remaining time.Duration
+		rate      float64
+	)
+	for _, stage := range stages {
+		worked += stage.running
+	}
+	if elapsed := now.Sub(p.Start); !p.Start.IsZero() && elapsed > 0 {
+		rate = float64(worked) / float64(elapsed)
+	}
+	for _, stage := range stages {
+		d := stage.TaskDuration
+		if d == 0 {
+			d = mean
+		}
+		work := stage.remaining(d)
+		remaining += work
+		if work > 0 && rate > 0 {
+			stage.ETA = now.Add(time.Duration(float64(work) / rate))
+		}
+		p.Tasks += stage.Tasks
+		p.Done += stage.Done
+		p.Running += stage.Running
+		p.Failed += stage.Failed
+		p.Records += stage.Records
+		p.Bytes += stage.Bytes
+	}
+	if remaining > 0 && rate > 0 {
+		p.ETA = now.Add(time.Duration(float64(remaining) / rate))
+	}
+	keys := make([]stageKey, 0, len(stages))
+	for key := range stages {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := stages[keys[i]], stages[keys[j]]
+		switch {
+		case si.Invocation != sj.Invocation:
+			return si.Invocation < sj.Invocation
+		case si.depth != sj.depth:
+			return si.depth < sj.depth
+		default:
+			return si.Op < sj.Op
+		}
+	})
+	for _, key := range keys {
+		p.Stages = append(p.Stages, stages[key].StageProgress)
+	}
+	return p
+}
+
+// remaining returns the estimated amount of task time that remains to
+// complete the stage, given the estimated duration d of its tasks.
+func (s *stageEstimate) remaining(d time.Duration) time.Duration {
+	// Failed tasks are not counted: the evaluation fails with them.
+	pending := s.Tasks - s.Done - s.Running - s.Failed
+	work := time.Duration(pending) * d
+	// Running tasks are expected to take at least as long as they
+	// already have.
+	if left := time.Duration(s.nrunning)*d - s.running; left > 0 {
+		work += left
+	}
+	return work
+}
+
+// taskDepth returns the length of the longest dependency path from task
+// to a task with no dependencies, memoizing depths in the provided map.
+func taskDepth(task *Task, depths map[*Task]int) int {
+	if depth, ok := depths[task]; ok {
+		return depth
+	}
+	var depth int
+	for _, dep := range task.Deps {
+		for i := 0; i < dep.NumTask(); i++ {
+			if d := taskDepth(dep.Task(i), depths) + 1; d > depth {
+				depth = d
+			}
+		}
+	}
+	depths[task] = depth
+	return depth
+}
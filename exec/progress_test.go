@@ -0,0 +1,168 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/metrics"
+	"github.com/grailbio/bigslice/stats"
+)
+
+func TestProgress(t *testing.T) {
+	var (
+		t0  = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+		now = t0.Add(100 * time.Second)
+		at  = func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+		a   = make([]*Task, 4)
+		b   = &Task{Name: TaskName{Op: "b", NumShard: 1}}
+	)
+	for i := range a {
+		a[i] = &Task{Name: TaskName{Op: "a", NumShard: len(a), Shard: i}}
+	}
+	for _, task := range a {
+		task.Group = a
+	}
+	b.Deps = []TaskDep{{Head: a[0]}}
+	a[0].attempts = []TaskAttempt{{Start: at(0), End: at(10), State: TaskOk}}
+	a[0].state = TaskOk
+	a[0].setVals(stats.Values{"write": 100, "writeBytes": 2048})
+	a[1].attempts = []TaskAttempt{
+		{Start: at(0), End: at(5), State: TaskLost},
+		{Start: at(10), End: at(30), State: TaskOk},
+	}
+	a[1].state = TaskOk
+	a[2].attempts = []TaskAttempt{{Start: at(90), State: TaskRunning}}
+	a[2].state = TaskRunning
+
+	p := computeProgress([]*Task{b}, now)
+	if got, want := len(p.Stages), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	sa, sb := p.Stages[0], p.Stages[1]
+	if got, want := sa.Op, "a"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := [4]int{sa.Tasks, sa.Done, sa.Running, sa.Failed}, [4]int{4, 2, 1, 0}; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := [2]int64{sa.Records, sa.Bytes}, [2]int64{100, 2048}; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := sa.Fraction(), 0.5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The mean duration of a's successful attempts is 15s. 30s of
+	// task time has been completed and 10s is in progress in the 100s
+	// since evaluation began, giving a rate of 0.4. Stage a's remaining
+	// task has 15s of work left, and its running task 5s.
+	if got, want := sa.TaskDuration, 15*time.Second; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := sa.ETA, now.Add(50*time.Second); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Stage b has not run; its task is estimated from the mean of all
+	// tasks.
+	if got, want := sb.Op, "b"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if sb.TaskDuration != 0 {
+		t.Errorf("got %v, want 0", sb.TaskDuration)
+	}
+	if got, want := sb.ETA, now.Add(37500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := [4]int{p.Tasks, p.Done, p.Running, p.Failed}, [4]int{5, 2, 1, 0}; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.Start, t0; !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.ETA, now.Add(87500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.Remaining(now), 87500*time.Millisecond; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Without completed tasks, there is no basis for an estimate.
+	p = computeProgress([]*Task{a[2], a[3]}, now)
+	if !p.ETA.IsZero() {
+		t.Errorf("got %v, want no estimate", p.ETA)
+	}
+}
+
+func TestResultProgress(t *testing.T) {
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(2))
+	defer sess.Shutdown()
+	res, err := sess.Run(context.Background(), grpcTestFunc, 4, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := res.Progress()
+	if p.Tasks == 0 || p.Done != p.Tasks {
+		t.Errorf("got %d/%d tasks done, want all", p.Done, p.Tasks)
+	}
+	if got, want := p.Fraction(), 1.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !p.ETA.IsZero() {
+		t.Errorf("got %v, want no ETA", p.ETA)
+	}
+	if p.Records == 0 {
+		t.Error("no records reported")
+	}
+	if got, want := len(sess.Progress().Stages), len(p.Stages); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTaskProgressReport(t *testing.T) {
+	const N = 100
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, N))
+		return bigslice.Map(slice, func(ctx context.Context, i int) int {
+			p := metrics.ContextProgress(ctx)
+			p.Add(1)
+			p.Printf("mapping")
+			return i
+		})
+	})
+	addrs, stop := startGRPCAgents(t, 2)
+	defer stop()
+	for name, opt := range map[string]Option{
+		"Local":      Local,
+		"Bigmachine": Bigmachine(testsystem.New()),
+		"GRPC":       GRPC(addrs),
+	} {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, Parallelism(2))
+			defer sess.Shutdown()
+			res, err := sess.Run(context.Background(), fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var records int64
+			for _, task := range res.Graph().Tasks {
+				if task.Progress == nil {
+					t.Errorf("%s: no progress reported", task.Name)
+					continue
+				}
+				if got, want := task.Progress.Message, "mapping"; got != want {
+					t.Errorf("%s: got %v, want %v", task.Name, got, want)
+				}
+				records += task.Progress.Records
+			}
+			if got, want := records, int64(N); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
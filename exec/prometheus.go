@@ -0,0 +1,118 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/grailbio/base/log"
+)
+
+// machineCounts counts the machines managed by an executor. Its fields
+// are accessed atomically.
+type machineCounts struct {
+	started, startFailures, lost, retired int64
+}
+
+// A machineCounter is an executor that counts the machines that it
+// manages.
+type machineCounter interface {
+	machineCounts() machineCounts
+}
+
+func (c *machineCounts) load() machineCounts {
+	return machineCounts{
+		started:       atomic.LoadInt64(&c.started),
+		startFailures: atomic.LoadInt64(&c.startFailures),
+		lost:          atomic.LoadInt64(&c.lost),
+		retired:       atomic.LoadInt64(&c.retired),
+	}
+}
+
+// WriteMetrics writes the session's executor and task metrics to w in
+// the Prometheus text exposition format. Task metrics are aggregated
+// over all of the tasks that the session has compiled; record and byte
+// counts are those of the most recent successful run of each task.
+// Machine metrics are written only for executors that manage
+// machines.
+func (s *Session) WriteMetrics(w io.Writer) error {
+	s.mu.Lock()
+	all := make(map[*Task]bool)
+	for task := range s.roots {
+		task.all(all)
+	}
+	s.mu.Unlock()
+
+	var (
+		byState                     [maxState]int64
+		attempts, retries           int64
+		recordsRead, recordsWritten int64
+		bytesWritten, shuffleBytes  int64
+	)
+	for task := range all {
+		task.Lock()
+		byState[task.state]++
+		attempts += int64(len(task.attempts))
+		if n := len(task.attempts); n > 1 {
+			retries += int64(n - 1)
+		}
+		if task.vals != nil {
+			recordsRead += task.vals["read"]
+			recordsWritten += task.vals["write"]
+			bytesWritten += task.vals["writeBytes"]
+			if task.NumPartition > 1 || task.CombineKey != "" {
+				shuffleBytes += task.vals["writeBytes"]
+			}
+		}
+		task.Unlock()
+	}
+
+	b := bufio.NewWriter(w)
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("bigslice_tasks", "gauge", "Number of tasks by state.")
+	for state, n := range byState {
+		fmt.Fprintf(b, "bigslice_tasks{state=%q} %d\n", TaskState(state).String(), n)
+	}
+	metric("bigslice_task_attempts_total", "counter", "Number of times tasks were run.")
+	fmt.Fprintf(b, "bigslice_task_attempts_total %d\n", attempts)
+	metric("bigslice_task_retries_total", "counter", "Number of times tasks were rerun after they were lost or failed.")
+	fmt.Fprintf(b, "bigslice_task_retries_total %d\n", retries)
+	metric("bigslice_records_read_total", "counter", "Number of records read by tasks.")
+	fmt.Fprintf(b, "bigslice_records_read_total %d\n", recordsRead)
+	metric("bigslice_records_written_total", "counter", "Number of records written by tasks.")
+	fmt.Fprintf(b, "bigslice_records_written_total %d\n", recordsWritten)
+	metric("bigslice_written_bytes_total", "counter", "Encoded size of task outputs, in bytes.")
+	fmt.Fprintf(b, "bigslice_written_bytes_total %d\n", bytesWritten)
+	metric("bigslice_shuffle_bytes_total", "counter", "Encoded size of partitioned and combined task outputs, in bytes.")
+	fmt.Fprintf(b, "bigslice_shuffle_bytes_total %d\n", shuffleBytes)
+
+	if counter, ok := s.executor.(machineCounter); ok {
+		c := counter.machineCounts()
+		metric("bigslice_machines", "gauge", "Number of running machines.")
+		fmt.Fprintf(b, "bigslice_machines %d\n", c.started-c.lost-c.retired)
+		metric("bigslice_machines_started_total", "counter", "Number of machines started.")
+		fmt.Fprintf(b, "bigslice_machines_started_total %d\n", c.started)
+		metric("bigslice_machine_start_failures_total", "counter", "Number of machines that failed to start.")
+		fmt.Fprintf(b, "bigslice_machine_start_failures_total %d\n", c.startFailures)
+		metric("bigslice_machines_lost_total", "counter", "Number of machines that stopped unexpectedly.")
+		fmt.Fprintf(b, "bigslice_machines_lost_total %d\n", c.lost)
+		metric("bigslice_machines_retired_total", "counter", "Number of machines that were released.")
+		fmt.Fprintf(b, "bigslice_machines_retired_total %d\n", c.retired)
+	}
+	return b.Flush()
+}
+
+func (s *Session) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.WriteMetrics(w); err != nil {
+		log.Error.Printf("exec.Session: /metrics: %v", err)
+	}
+}
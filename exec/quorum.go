@@ -0,0 +1,135 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/log"
+)
+
+// probeRequest is the request payload for Worker.Probe.
+type probeRequest struct {
+	// Addr is the address of the worker to be probed.
+	Addr string
+	// Probes is the number of probes made over Window.
+	Probes int
+	Window time.Duration
+}
+
+// Ping does nothing; it is called to check that the worker is
+// reachable.
+func (w *worker) Ping(ctx context.Context, _ struct{}, _ *struct{}) error {
+	return nil
+}
+
+// Probe probes the worker at req.Addr, on behalf of a driver that could
+// not reach it, and reports whether it is reachable from w.
+func (w *worker) Probe(ctx context.Context, req probeRequest, reachable *bool) error {
+	machine, err := w.dial(ctx, req.Addr)
+	if err != nil {
+		*reachable = false
+		return nil
+	}
+	*reachable = probe(ctx, machine, req.Probes, req.Window)
+	return nil
+}
+
+// probe pings the provided worker up to n times, evenly spaced over the
+// provided window, and reports whether any ping succeeded. Each ping
+// must complete within its share of the window.
+func probe(ctx context.Context, c workerClient, n int, window time.Duration) bool {
+	interval := window / time.Duration(n)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := c.RetryCall(pingCtx, "Worker.Ping", struct{}{}, nil)
+		cancel()
+		if err == nil {
+			return true
+		}
+		if i == n-1 {
+			break
+		}
+		select {
+		case <-time.After(interval - time.Since(start)):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return false
+}
+
+// confirmLost reports whether the agent m, which the driver failed to
+// reach, should be declared lost. Unless the session configures a loss
+// quorum, it always is. Otherwise the driver and up to quorum attached
+// peer agents each probe m repeatedly over the quorum's window; m is
+// lost only if at least quorum of them fail every probe. Peers that the
+// driver cannot itself reach abstain, and if fewer than quorum vantage
+// points remain, all of them must agree. Thus a transient partition
+// between the driver and m, or between m and a few of its peers, does
+// not cause all of m's outputs to be recomputed.
+func (g *grpcExecutor) confirmLost(ctx context.Context, m *grpcMachine) bool {
+	quorum, probes, window := g.sess.lossQuorum, g.sess.lossProbes, g.sess.lossWindow
+	if quorum == 0 {
+		return true
+	}
+	var peers []*grpcMachine
+	g.mu.Lock()
+	for _, peer := range g.machines {
+		if len(peers) == quorum {
+			break
+		}
+		if peer != m && peer.attached {
+			peers = append(peers, peer)
+		}
+	}
+	g.mu.Unlock()
+
+	var (
+		mu              sync.Mutex
+		voters, failing int
+		wg              sync.WaitGroup
+	)
+	vote := func(reachable bool) {
+		mu.Lock()
+		voters++
+		if !reachable {
+			failing++
+		}
+		mu.Unlock()
+	}
+	wg.Add(1 + len(peers))
+	go func() {
+		defer wg.Done()
+		vote(probe(ctx, m, probes, window))
+	}()
+	for _, peer := range peers {
+		peer := peer
+		go func() {
+			defer wg.Done()
+			// Allow the peer the full window, and then some, to complete
+			// its probes.
+			ctx, cancel := context.WithTimeout(ctx, 2*window)
+			defer cancel()
+			var reachable bool
+			req := probeRequest{Addr: m.addr, Probes: probes, Window: window}
+			if err := peer.Call(ctx, "Worker.Probe", req, &reachable); err != nil {
+				log.Debug.Printf("agent %s: probe %s: %v", peer.addr, m.addr, err)
+				return
+			}
+			vote(reachable)
+		}()
+	}
+	wg.Wait()
+	if voters < quorum {
+		quorum = voters
+	}
+	lost := failing > 0 && failing >= quorum
+	log.Printf("agent %s: %d of %d vantage points failed to reach it; lost: %v", m.addr, failing, voters, lost)
+	return lost
+}
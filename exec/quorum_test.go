@@ -0,0 +1,64 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLossQuorum(t *testing.T) {
+	addrs, stop := startGRPCAgents(t, 3)
+	defer stop()
+	sess := Start(GRPC(addrs), LossQuorum(2, 3, 300*time.Millisecond))
+	defer sess.Shutdown()
+	g := sess.executor.(*grpcExecutor)
+	ctx := context.Background()
+
+	if g.confirmLost(ctx, g.machines[0]) {
+		t.Errorf("reachable agent %s declared lost", g.machines[0].addr)
+	}
+
+	// An agent that is reachable by no one is lost.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	c, err := dialGRPC(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.session = g.session
+	if !g.confirmLost(ctx, &grpcMachine{grpcClient: c}) {
+		t.Errorf("unreachable agent %s not declared lost", addr)
+	}
+}
+
+func TestLossQuorumDefault(t *testing.T) {
+	addrs, stop := startGRPCAgents(t, 1)
+	defer stop()
+	sess := Start(GRPC(addrs))
+	defer sess.Shutdown()
+	g := sess.executor.(*grpcExecutor)
+	// Without a quorum, agents are lost as soon as the driver fails to
+	// reach them.
+	if !g.confirmLost(context.Background(), g.machines[0]) {
+		t.Error("agent not declared lost")
+	}
+}
+
+func TestLossQuorumExecutor(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected loss quorum with the local executor to panic")
+		}
+	}()
+	Start(Local, LossQuorum(2, 3, time.Second))
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigmachine"
+	"github.com/grailbio/bigmachine/ec2system"
+	"github.com/grailbio/bigslice"
+)
+
+// An Attestation records that an invocation with residency constraints
+// was run on machines in permitted regions. See bigslice.Residency.
+type Attestation struct {
+	// Permitted are the regions in which the invocation was permitted
+	// to run, in sorted order.
+	Permitted []string
+	// Region is the region in which the executor is configured to
+	// create its machines, e.g., by its bigmachine system.
+	Region string
+	// Machines maps the address of each machine that ran the
+	// invocation's tasks to its region, as reported by the machine's
+	// instance metadata.
+	Machines map[string]string
+	// Executor is the name of the executor that ran the invocation.
+	Executor string
+	// Time is the time at which the invocation was admitted.
+	Time time.Time
+}
+
+func (a *Attestation) String() string {
+	addrs := make([]string, 0, len(a.Machines))
+	for addr := range a.Machines {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	machines := make([]string, len(addrs))
+	for i, addr := range addrs {
+		machines[i] = addr + " (" + a.Machines[addr] + ")"
+	}
+	return fmt.Sprintf("run in region %s by %s executor at %s on machines %s; permitted regions: %s",
+		a.Region, a.Executor, a.Time.Format(time.RFC3339), strings.Join(machines, ", "), strings.Join(a.Permitted, ", "))
+}
+
+// A regionExecutor is an executor that determines the regions of the
+// machines on which it runs tasks. Only regionExecutors run invocations
+// with residency constraints.
+type regionExecutor interface {
+	// Region returns the region in which the executor creates its
+	// machines, or an error if it cannot be determined.
+	Region() (string, error)
+}
+
+// instanceRegion returns the region of the EC2 instance on which the
+// process runs, from its instance metadata. It is a variable so that it
+// may be overridden by tests.
+var instanceRegion = func() (string, error) {
+	sess, err := session.NewSession(&aws.Config{
+		HTTPClient: &http.Client{Timeout: 2 * time.Second},
+		MaxRetries: aws.Int(0),
+	})
+	if err != nil {
+		return "", err
+	}
+	region, err := ec2metadata.New(sess).Region()
+	if err != nil {
+		return "", errors.E(errors.Unavailable, "instance metadata", err)
+	}
+	return region, nil
+}
+
+// systemRegion returns the region in which the provided bigmachine
+// system creates its machines: the configured region of ec2system
+// systems, the region of the instance on which the driver runs for
+// bigmachine.Local, or the region reported by systems that implement
+// Region() string.
+func systemRegion(system bigmachine.System) (string, error) {
+	switch system := system.(type) {
+	case interface{ Region() string }:
+		if region := system.Region(); region != "" {
+			return region, nil
+		}
+	case *ec2system.System:
+		if system.AWSConfig != nil && system.AWSConfig.Region != nil {
+			return *system.AWSConfig.Region, nil
+		}
+	case localProcessSystem:
+		return instanceRegion()
+	default:
+		if system == bigmachine.Local {
+			return instanceRegion()
+		}
+	}
+	return "", errors.E(errors.NotSupported, "the region of bigmachine system ", system.Name(), " cannot be determined")
+}
+
+// A residency tracks the machines that run the tasks of an invocation
+// with residency constraints, each of which must be in a permitted
+// region.
+type residency struct {
+	permitted []string
+	region    string
+	admitted  time.Time
+
+	mu       sync.Mutex
+	machines map[string]string
+}
+
+// permits returns whether the residency permits the provided region.
+func (r *residency) permits(region string) bool {
+	i := sort.SearchStrings(r.permitted, region)
+	return i < len(r.permitted) && r.permitted[i] == region
+}
+
+// check checks that the machine at the provided address, which is in
+// the provided region (empty if it is unknown), may run the
+// invocation's tasks, and records it.
+func (r *residency) check(addr, region string) error {
+	if region == "" {
+		return errors.E(errors.Fatal, errors.Precondition, fmt.Sprintf(
+			"residency: the invocation may only be run in regions %s, but the region of machine %s is unknown",
+			strings.Join(r.permitted, ", "), addr))
+	}
+	if !r.permits(region) {
+		return errors.E(errors.Fatal, errors.Precondition, fmt.Sprintf(
+			"residency: the invocation may only be run in regions %s, but machine %s is in region %s",
+			strings.Join(r.permitted, ", "), addr, region))
+	}
+	r.mu.Lock()
+	r.machines[addr] = region
+	r.mu.Unlock()
+	return nil
+}
+
+// attest returns the attestation of the invocation's residency, or nil
+// if no machine was checked, e.g., because all of the invocation's
+// tasks were reused.
+func (r *residency) attest(executor string) *Attestation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.machines) == 0 {
+		return nil
+	}
+	machines := make(map[string]string, len(r.machines))
+	for addr, region := range r.machines {
+		machines[addr] = region
+	}
+	return &Attestation{
+		Permitted: r.permitted,
+		Region:    r.region,
+		Machines:  machines,
+		Executor:  executor,
+		Time:      r.admitted,
+	}
+}
+
+// permittedRegions returns the regions in which the invocation inv,
+// which computes the provided slice, may be run: the intersection of
+// the regions permitted by its func, by the Residents that it reads,
+// and by the results of previous invocations that it reads. It returns
+// false if the invocation has no residency constraints.
+func permittedRegions(inv execInvocation, slice bigslice.Slice) ([]string, bool) {
+	var (
+		permitted   map[string]bool
+		constrained bool
+	)
+	restrict := func(regions []string) {
+		allowed := make(map[string]bool, len(regions))
+		for _, region := range regions {
+			if !constrained || permitted[region] {
+				allowed[region] = true
+			}
+		}
+		permitted, constrained = allowed, true
+	}
+	if len(inv.Regions) > 0 {
+		restrict(inv.Regions)
+	}
+	visited := make(map[bigslice.Slice]bool)
+	var walk func(bigslice.Slice)
+	walk = func(slice bigslice.Slice) {
+		if visited[slice] {
+			return
+		}
+		visited[slice] = true
+		if result, ok := bigslice.Unwrap(slice).(*Result); ok {
+			if result.permitted != nil {
+				restrict(result.permitted)
+			}
+			return
+		}
+		if r, ok := slice.(bigslice.Resident); ok {
+			restrict(r.Regions())
+		}
+		for i := 0; i < slice.NumDep(); i++ {
+			walk(slice.Dep(i).Slice)
+		}
+	}
+	walk(slice)
+	if !constrained {
+		return nil, false
+	}
+	regions := make([]string, 0, len(permitted))
+	for region := range permitted {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions, true
+}
+
+// checkResidency checks that the invocation inv, which computes the
+// provided slice, may be run by the session, and returns the residency
+// by which the executor checks the machines that run its tasks; it
+// returns nil if the invocation has no residency constraints.
+// Invocations with residency constraints are refused unless the
+// session's executor creates its machines in a permitted region.
+func (s *Session) checkResidency(inv execInvocation, slice bigslice.Slice) (*residency, error) {
+	permitted, ok := permittedRegions(inv, slice)
+	if !ok {
+		return nil, nil
+	}
+	if len(permitted) == 0 {
+		return nil, errors.E(errors.Fatal, errors.Precondition,
+			"residency: the invocation's residency constraints do not permit any region")
+	}
+	executor, ok := s.executor.(regionExecutor)
+	if !ok {
+		return nil, errors.E(errors.Fatal, errors.Precondition, fmt.Sprintf(
+			"residency: the invocation may only be run in regions %s, but the %s executor cannot determine the regions of its machines",
+			strings.Join(permitted, ", "), s.executor.Name()))
+	}
+	region, err := executor.Region()
+	if err != nil {
+		return nil, errors.E(errors.Fatal, errors.Precondition, fmt.Sprintf(
+			"residency: the invocation may only be run in regions %s, but the region of the session's machines cannot be determined",
+			strings.Join(permitted, ", ")), err)
+	}
+	r := &residency{
+		permitted: permitted,
+		region:    region,
+		admitted:  time.Now(),
+		machines:  make(map[string]string),
+	}
+	if !r.permits(region) {
+		return nil, errors.E(errors.Fatal, errors.Precondition, fmt.Sprintf(
+			"residency: the invocation may only be run in regions %s, but the session's machines are created in region %s",
+			strings.Join(permitted, ", "), region))
+	}
+	return r, nil
+}
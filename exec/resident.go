@@ -0,0 +1,328 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// A Resident is an invocation that is kept resident in its session so
+// that it can be run repeatedly, e.g., as new input arrives, without
+// recomputing from scratch: each run reuses the completed tasks of the
+// previous run whose outputs are unaffected by changes to the
+// invocation's input, and computes only the rest. This supports
+// near-real-time pipelines that process their input in micro-batches.
+//
+// Each run invokes the Func anew, and tasks are matched to those of the
+// previous run by their lineage: the operations that they perform, and
+// the lineage of their dependencies. Sources whose shards change
+// between runs must say so by versioning their shards with
+// bigslice.Versioned; the shards of unversioned sources are presumed
+// to be unchanged. For example, a pipeline that maps over a versioned
+// slice of input files, and then reduces by key, maps only the files
+// that are new in each run; the (full) reduction of each run reads the
+// reused outputs of the previous runs' mappers.
+//
+// The number of partitions of a shuffle is part of the lineage of the
+// tasks that write it, so shuffles that follow versioned sources
+// should have a fixed number of shards (e.g., by bigslice.Reshard)
+// rather than one that follows the number of input shards.
+//
+// Tasks with shared (machine) combiners and tasks that collapse small
+// join dependencies into lookups are always recomputed.
+type Resident struct {
+	sess   *Session
+	funcv  *bigslice.FuncValue
+	args   []interface{}
+	file   string
+	line   int
+	mu     sync.Mutex
+	result *Result
+	// completed holds, by lineage, the completed tasks of the most
+	// recent successful run that may be reused by the next run.
+	completed map[string]*Task
+	// named holds all of the tasks of the most recent successful run's
+	// graph, by name.
+	named map[TaskName]*Task
+}
+
+// Resident returns a resident invocation of funcv with the provided
+// arguments. It is not run until Resident.Run is called.
+func (s *Session) Resident(funcv *bigslice.FuncValue, args ...interface{}) *Resident {
+	_, file, line, ok := runtime.Caller(1)
+	if !ok {
+		file = ""
+	}
+	return &Resident{sess: s, funcv: funcv, args: args, file: file, line: line}
+}
+
+// Run runs the resident invocation, reusing the completed tasks of its
+// previous successful run whose outputs are unaffected by changes in
+// its input. Runs are serialized. The returned result is valid until
+// the next run completes successfully, after which the storage of the
+// tasks that are no longer needed is discarded.
+func (r *Resident) Run(ctx context.Context) (*Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, err := r.sess.runInvocation(ctx, r, r.file, r.line, r.funcv, r.args...)
+	if err != nil {
+		return res, err
+	}
+	var (
+		all       = make(map[*Task]bool)
+		completed = make(map[string]*Task)
+		named     = make(map[TaskName]*Task)
+	)
+	for _, task := range res.tasks {
+		task.all(all)
+	}
+	for task := range all {
+		named[task.Name] = task
+		if task.lineage == "" || task.CombineKey != "" || task.State() != TaskOk {
+			continue
+		}
+		completed[task.lineage] = task
+	}
+	if r.result != nil {
+		r.sess.discard(ctx, r.result.tasks, all)
+	}
+	r.result, r.completed, r.named = res, completed, named
+	return res, nil
+}
+
+// Result returns the result of the most recent successful run, or nil
+// if the invocation has not yet run successfully.
+func (r *Resident) Result() *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result
+}
+
+// Discard discards the storage held by the resident invocation's
+// tasks, so that its next run computes from scratch.
+func (r *Resident) Discard(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.result == nil {
+		return
+	}
+	r.sess.discard(ctx, r.result.tasks, nil)
+	r.result, r.completed, r.named = nil, nil, nil
+}
+
+// completedTask returns the completed task of the previous run with
+// the provided lineage, or nil if there is none.
+func (r *Resident) completedTask(lineage string) *Task {
+	return r.completed[lineage]
+}
+
+// reusedTask returns the named task of the previous run.
+func (r *Resident) reusedTask(name TaskName) (*Task, error) {
+	task, ok := r.named[name]
+	if !ok {
+		return nil, errors.E(errors.NotExist, fmt.Sprintf("reused task %s", name))
+	}
+	return task, nil
+}
+
+// lineage returns the lineage of the provided task, which is compiled
+// to compute the provided (pipelined) slices with the provided
+// partitioning, or "" if the task's output cannot be identified.
+func (c *compiler) lineage(task *Task, slices []bigslice.Slice, part partitioner) string {
+	if len(task.Lookups) > 0 || task.CombineKey != "" {
+		return ""
+	}
+	h := sha256.New()
+	// The operation is named independently of the invocation.
+	op := strings.TrimPrefix(task.Name.Op, fmt.Sprintf("inv%d_", task.Name.InvIndex))
+	fmt.Fprintf(h, "%s %d %t %t %d\n", op, task.NumPartition, part.IsShuffle(), !task.Combiner.IsNil(), task.Limit)
+	if c.inv.fingerprint != "" {
+		fmt.Fprintf(h, "invocation %s\n", c.inv.fingerprint)
+	}
+	var versioned bool
+	for _, slice := range slices {
+		fmt.Fprintln(h, slice.Name())
+		if v, ok := slice.(bigslice.ShardVersioner); ok {
+			fmt.Fprintf(h, "version %q\n", v.ShardVersion(task.Name.Shard))
+			versioned = true
+		}
+		if s, ok := slice.(bigslice.Snapshotter); ok {
+			group := s.SnapshotGroup()
+			fmt.Fprintf(h, "snapshot %q %q\n", group, c.inv.Env.Snapshots[group])
+		}
+	}
+	// Versioned shards are identified by their versions alone, so that
+	// they may be reused even if other shards are added.
+	if !versioned {
+		fmt.Fprintf(h, "shard %d of %d\n", task.Name.Shard, task.Name.NumShard)
+	}
+	for _, dep := range task.Deps {
+		if dep.CombineKey != "" {
+			return ""
+		}
+		fmt.Fprintf(h, "dep %d %t %t %d %d\n", dep.Partition, dep.Expand, dep.Broadcast, dep.Offset, dep.Count)
+		for i := 0; i < dep.NumTask(); i++ {
+			depTask := dep.Task(i)
+			switch {
+			case depTask.lineage != "":
+				fmt.Fprintln(h, depTask.lineage)
+			case depTask.Name.InvIndex != c.inv.Index && c.inv.cachedResults == nil:
+				// Tasks of other invocations (e.g., of *Result arguments)
+				// are fixed across runs, but their names are not stable
+				// across sessions.
+				fmt.Fprintln(h, depTask.Name)
+			default:
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// reshuffleLineage returns the lineage of task, which reshuffles the
+// output of prev. See compiler.reuse.
+func (c *compiler) reshuffleLineage(task, prev *Task) string {
+	id := prev.lineage
+	if id == "" {
+		if c.inv.cachedResults != nil {
+			return ""
+		}
+		id = prev.Name.String()
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "reshuffle %s %d\n", id, task.NumPartition)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// reuseCompleted substitutes for the provided tasks, which compute a
+// slice with the provided partitioning, the completed tasks of the
+// previous run of a resident invocation that have the same lineage.
+// The substitutions are decided by the driver, which records them in
+// the invocation's environment, so that workers compile the same task
+// graph.
+func (c *compiler) reuseCompleted(tasks []*Task, part partitioner) ([]*Task, error) {
+	if c.inv.completed != nil && c.inv.Env.IsWritable() {
+		for _, task := range tasks {
+			if task.lineage == "" {
+				continue
+			}
+			if prev := c.inv.completed(task.lineage); prev != nil {
+				c.inv.Env.Reused[task.Name] = prev.Name
+			}
+		}
+	}
+	if len(c.inv.Env.Reused) == 0 {
+		return tasks, nil
+	}
+	var (
+		reused = make([]*Task, len(tasks))
+		n      int
+	)
+	for i, task := range tasks {
+		name, ok := c.inv.Env.Reused[task.Name]
+		if !ok {
+			continue
+		}
+		prev, err := c.inv.reused(name)
+		if err != nil {
+			return nil, err
+		}
+		reused[i] = prev
+		n++
+	}
+	if n == 0 {
+		return tasks, nil
+	}
+	// Tasks that write shuffles are read as groups, so previous tasks
+	// can be substituted only for a whole group; otherwise their outputs
+	// are replayed by the new group's tasks.
+	if part.IsShuffle() && !sameGroup(reused) {
+		for i, prev := range reused {
+			if prev != nil {
+				replay(tasks[i], prev)
+			}
+		}
+		return tasks, nil
+	}
+	substituted := make([]*Task, len(tasks))
+	for i := range tasks {
+		if substituted[i] = reused[i]; substituted[i] == nil {
+			substituted[i] = tasks[i]
+		}
+	}
+	return substituted, nil
+}
+
+// sameGroup returns whether the provided tasks constitute, in order,
+// the whole of a task group.
+func sameGroup(tasks []*Task) bool {
+	if tasks[0] == nil || len(tasks[0].Group) != len(tasks) {
+		return false
+	}
+	for i, task := range tasks {
+		if task != tasks[0].Group[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// replay sets up task, which writes a shuffle, to read and
+// repartition the output of prev, a completed task with the same
+// lineage, instead of computing it anew.
+func replay(task, prev *Task) {
+	var (
+		head  = prev
+		index int
+	)
+	if len(prev.Group) > 0 {
+		head = prev.Group[0]
+		for i, peer := range prev.Group {
+			if peer == prev {
+				index = i
+			}
+		}
+	}
+	task.Deps = make([]TaskDep, prev.NumPartition)
+	for p := range task.Deps {
+		task.Deps[p] = TaskDep{Head: head, Partition: p, Offset: index, Count: 1}
+	}
+	task.Do = func(readers []sliceio.Reader) sliceio.Reader {
+		return &concatReader{q: readers}
+	}
+	task.Lookups = nil
+	task.lineage = prev.lineage
+}
+
+// concatReader reads the concatenation of its readers. Unlike
+// sliceio.MultiReader, it retains rows that are returned together with
+// EOF, as they are, e.g., by combiners' readers.
+type concatReader struct {
+	q []sliceio.Reader
+}
+
+func (r *concatReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	for len(r.q) > 0 {
+		n, err := r.q[0].Read(ctx, out)
+		if err == sliceio.EOF {
+			r.q = r.q[1:]
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, sliceio.EOF
+}
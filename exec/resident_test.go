@@ -0,0 +1,170 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestResident(t *testing.T) {
+	var (
+		batches [][]int
+		nmap    int64
+	)
+	sums := bigslice.Func(func() bigslice.Slice {
+		versions := make([]string, len(batches))
+		for i := range versions {
+			versions[i] = fmt.Sprintf("batch%d", i)
+		}
+		slice := bigslice.ReaderFunc(len(batches), func(shard int, n *int, out []int) (int, error) {
+			m := copy(out, batches[shard][*n:])
+			*n += m
+			if *n == len(batches[shard]) {
+				return m, sliceio.EOF
+			}
+			return m, nil
+		})
+		slice = bigslice.Versioned(slice, versions)
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			atomic.AddInt64(&nmap, 1)
+			return i % 3, i
+		})
+		slice = bigslice.Reshard(slice, 4)
+		return bigslice.Reduce(slice, func(a, e int) int { return a + e })
+	})
+	// sum returns the sums, by key, of the result of res.
+	sum := func(t *testing.T, res *Result) map[int]int {
+		t.Helper()
+		var (
+			ctx    = context.Background()
+			scan   = res.Scanner()
+			k, v   int
+			actual = make(map[int]int)
+		)
+		defer scan.Close()
+		for scan.Scan(ctx, &k, &v) {
+			actual[k] = v
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return actual
+	}
+	ctx := context.Background()
+	testSession(t, func(t *testing.T, sess *Session) {
+		batches = [][]int{rangeSlice(0, 100), rangeSlice(100, 200)}
+		atomic.StoreInt64(&nmap, 0)
+		r := sess.Resident(sums)
+		res, err := r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sum(t, res), map[int]int{0: 6633, 1: 6700, 2: 6567}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := atomic.LoadInt64(&nmap), int64(200); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		// Only the new batch is mapped.
+		batches = append(batches, rangeSlice(200, 250))
+		res, err = r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sum(t, res), map[int]int{0: 10458, 1: 10292, 2: 10375}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := atomic.LoadInt64(&nmap), int64(250); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		// Without new input, the previous run's result is reused.
+		prev := res
+		res, err = r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := res.tasks, prev.tasks; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := atomic.LoadInt64(&nmap), int64(250); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		// After the resident invocation is discarded, it is computed
+		// from scratch.
+		r.Discard(ctx)
+		res, err = r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := sum(t, res), map[int]int{0: 10458, 1: 10292, 2: 10375}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := atomic.LoadInt64(&nmap), int64(500); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestResidentReplay(t *testing.T) {
+	var (
+		batches  [][]int
+		versions []string
+		nmap     int64
+	)
+	sums := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.ReaderFunc(len(batches), func(shard int, n *int, out []int) (int, error) {
+			m := copy(out, batches[shard][*n:])
+			*n += m
+			if *n == len(batches[shard]) {
+				return m, sliceio.EOF
+			}
+			return m, nil
+		})
+		slice = bigslice.Versioned(slice, versions)
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			atomic.AddInt64(&nmap, 1)
+			return i % 3, i
+		})
+		return bigslice.Reduce(slice, func(a, e int) int { return a + e })
+	})
+	ctx := context.Background()
+	testSession(t, func(t *testing.T, sess *Session) {
+		batches = [][]int{rangeSlice(0, 100), rangeSlice(100, 200)}
+		versions = []string{"a", "b"}
+		atomic.StoreInt64(&nmap, 0)
+		r := sess.Resident(sums)
+		if _, err := r.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// Replace the second batch. The combined output of the first
+		// batch's mapper is replayed into the new shuffle.
+		batches[1], versions[1] = rangeSlice(100, 150), "c"
+		res, err := r.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := readFrame(t, res, 3)
+		actual := make(map[int]int)
+		for i, k := range f.Interface(0).([]int) {
+			actual[k] = f.Interface(1).([]int)[i]
+		}
+		if got, want := actual, map[int]int{0: 3675, 1: 3725, 2: 3775}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := atomic.LoadInt64(&nmap), int64(250); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/file"
+)
+
+// resultKeyRE matches the keys of outputs in a result cache, which are
+// the (hex-encoded SHA-256) lineages of the tasks that computed them.
+var resultKeyRE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// newResultCacher returns a checkpointer that writes the outputs of the
+// tasks of invocation inv to the result cache with the provided prefix,
+// keyed by their lineage. It populates inv with the keys of the outputs
+// already in the cache, so that the tasks that computed them are read
+// from the cache in lieu of being recomputed.
+func newResultCacher(ctx context.Context, executor Executor, prefix string, inv *execInvocation) (*checkpointer, error) {
+	// Arguments that are results of previous invocations are identified
+	// by the lineage of their tasks, on which the invocation's tasks
+	// depend.
+	results := make(map[uint64]string)
+	for _, arg := range inv.Args {
+		if result, ok := arg.(*Result); ok {
+			results[result.invIndex] = "result"
+		}
+	}
+	fp, err := checkpointFingerprint(inv.Invocation, results)
+	if err != nil {
+		return nil, err
+	}
+	code, err := codeDigest()
+	if err != nil {
+		return nil, err
+	}
+	cached, err := listResultCache(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	inv.resultCache = prefix
+	inv.cachedResults = cached
+	inv.fingerprint = fp + " code " + code
+	index := inv.Index
+	return &checkpointer{
+		ctx:      ctx,
+		executor: executor,
+		dir:      prefix,
+		key: func(task *Task) string {
+			// Tasks of other invocations are written by their own
+			// invocations.
+			if task.Name.InvIndex != index || task.lineage == "" || cached[task.lineage] {
+				return ""
+			}
+			return task.lineage
+		},
+		written: make(map[*Task]bool),
+	}, nil
+}
+
+var (
+	executableDigestOnce sync.Once
+	executableDigestHex  string
+	executableDigestErr  error
+)
+
+// executableDigest returns the hex-encoded SHA-256 digest of the
+// contents of the running executable. It is computed once per process,
+// and is overridden in tests.
+var executableDigest = func() (string, error) {
+	executableDigestOnce.Do(func() {
+		executableDigestHex, executableDigestErr = func() (string, error) {
+			path, err := os.Executable()
+			if err != nil {
+				return "", err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}()
+	})
+	if executableDigestErr != nil {
+		return "", errors.E("digesting executable", executableDigestErr)
+	}
+	return executableDigestHex, nil
+}
+
+// codeDigest returns a digest of the code that the process may run:
+// the contents of its executable and of the plugins it has loaded. Any
+// change to the code, even one that does not move the operations of a
+// pipeline, thus changes the lineage of its tasks.
+func codeDigest() (string, error) {
+	exe, err := executableDigest()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "executable %s\n", exe)
+	for _, p := range processPlugins.List() {
+		fmt.Fprintf(h, "plugin %s\n", p.Fingerprint)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listResultCache returns the set of keys of the outputs in the result
+// cache with the provided prefix. A missing cache is empty.
+func listResultCache(ctx context.Context, prefix string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	list := file.List(ctx, prefix, false)
+	for list.Scan() {
+		if key := path.Base(list.Path()); !list.IsDir() && resultKeyRE.MatchString(key) {
+			keys[key] = true
+		}
+	}
+	if err := list.Err(); err != nil && !errors.Is(errors.NotExist, err) && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return keys, nil
+}
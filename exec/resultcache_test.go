@@ -0,0 +1,127 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestResultCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resultcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		nmap   int64
+		negate bool
+	)
+	fn := bigslice.Func(func(k int) bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, 100))
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			atomic.AddInt64(&nmap, 1)
+			return i % k, i
+		})
+		slice = bigslice.Reduce(slice, func(a, b int) int { return a + b })
+		if negate {
+			slice = bigslice.Map(slice, func(k, v int) (int, int) { return k, -v })
+		}
+		return slice
+	})
+	ctx := context.Background()
+	run := func(mod int) []int {
+		t.Helper()
+		sess := Start(Local, ResultCache(dir))
+		defer sess.Shutdown()
+		res, err := sess.Run(ctx, fn, mod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := res.Scanner()
+		defer scan.Close()
+		var (
+			sums []int
+			k, v int
+		)
+		for scan.Scan(ctx, &k, &v) {
+			sums = append(sums, v)
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(sums)
+		return sums
+	}
+	want := run(3)
+	if got, want := want, []int{1617, 1650, 1683}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(100); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// A new session reads the cached results.
+	if got := run(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(100); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Changing a later stage reuses the cached outputs of earlier ones.
+	negate = true
+	got := run(3)
+	for i := range got {
+		got[i] = -got[i]
+	}
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(100); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Different arguments are computed anew.
+	negate = false
+	run(4)
+	if got, want := nmap, int64(200); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Changed code, even if no operation moves, is computed anew.
+	defer func(digest func() (string, error)) { executableDigest = digest }(executableDigest)
+	executableDigest = func() (string, error) { return "changed", nil }
+	if got := run(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := nmap, int64(300); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCodeDigest(t *testing.T) {
+	digest, err := codeDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resultKeyRE.MatchString(digest) {
+		t.Errorf("invalid digest %q", digest)
+	}
+	defer func(digest func() (string, error)) { executableDigest = digest }(executableDigest)
+	executableDigest = func() (string, error) { return "changed", nil }
+	changed, err := codeDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == digest {
+		t.Errorf("digest %s did not change with the executable", digest)
+	}
+}
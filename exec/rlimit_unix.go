@@ -0,0 +1,18 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package exec
+
+import "syscall"
+
+// setMemoryLimit limits the address space of the current process to n
+// bytes. Allocations beyond the limit fail, causing the Go runtime to
+// abort the process.
+func setMemoryLimit(n int64) error {
+	lim := syscall.Rlimit{Cur: uint64(n), Max: uint64(n)}
+	return syscall.Setrlimit(syscall.RLIMIT_AS, &lim)
+}
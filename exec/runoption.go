@@ -0,0 +1,173 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grailbio/base/limiter"
+	"github.com/grailbio/bigmachine"
+)
+
+// A RunOption overrides a session setting for a single invocation, so
+// that, e.g., a driver may run a small interactive query and a large
+// batch job in the same session with the resources appropriate to each.
+// RunOptions are passed to Run and Must along with the invocation's
+// arguments, from which they are separated:
+//
+//	sess.Run(ctx, query, table, exec.RunParallelism(8))
+//
+// RunOptions do not affect the results of an invocation, and so they
+// are not considered by memoization, checkpoints, or result caches.
+type RunOption func(*runOptions)
+
+// RunParallelism limits the number of procs that the invocation's tasks
+// occupy concurrently to p, in lieu of the session's parallelism (see
+// Parallelism). Exclusive tasks occupy all p procs. Machines started
+// for the invocation by RunMachine are sized to p procs.
+func RunParallelism(p int) RunOption {
+	if p <= 0 {
+		panic("exec.RunParallelism: p <= 0")
+	}
+	return func(o *runOptions) {
+		o.parallelism = p
+	}
+}
+
+// RunMachine runs the invocation's tasks on machines dedicated to it,
+// which are started with the session's bigmachine params followed by
+// the provided ones (e.g., to select an instance type). Tasks that
+// need GPUs are still placed on the session's GPU machines (see GPUs).
+// RunMachine is ignored by executors that do not manage machines.
+func RunMachine(params ...bigmachine.Param) RunOption {
+	return func(o *runOptions) {
+		o.machine = append(o.machine, params...)
+	}
+}
+
+// RunRetries configures the number of times that the invocation's tasks
+// may be lost consecutively (e.g., because the machines on which they
+// run fail) before they are considered to have failed, in lieu of the
+// session's default of 5. Retrying a task more is appropriate for long
+// batch jobs on preemptible machines; less, for interactive queries
+// that should fail fast.
+func RunRetries(n int) RunOption {
+	if n <= 0 {
+		panic("exec.RunRetries: n <= 0")
+	}
+	return func(o *runOptions) {
+		o.maxLost = n
+	}
+}
+
+// runOptions are the overrides with which an invocation is run. They
+// are used only by the driver.
+type runOptions struct {
+	parallelism int
+	machine     []bigmachine.Param
+	maxLost     int
+	tenant      string
+
+	// procs limits the procs occupied by the invocation's tasks if
+	// parallelism is set.
+	procs *limiter.Limiter
+	// fair shares the session's procs among tenants, if the session is
+	// configured with Tenants.
+	fair *fairScheduler
+}
+
+// splitRunOptions separates the RunOptions in args from the
+// invocation's arguments. It returns nil options if there are none.
+func splitRunOptions(args []interface{}) ([]interface{}, *runOptions) {
+	var (
+		opts *runOptions
+		rest = args[:0:0]
+	)
+	for _, arg := range args {
+		opt, ok := arg.(RunOption)
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if opts == nil {
+			opts = new(runOptions)
+		}
+		opt(opts)
+	}
+	if opts == nil {
+		return args, nil
+	}
+	if opts.parallelism > 0 {
+		opts.procs = limiter.New()
+		opts.procs.Release(opts.parallelism)
+	}
+	return rest, opts
+}
+
+// String describes the overrides in opts.
+func (o *runOptions) String() string {
+	var overrides []string
+	if o.parallelism > 0 {
+		overrides = append(overrides, fmt.Sprintf("parallelism=%d", o.parallelism))
+	}
+	if len(o.machine) > 0 {
+		overrides = append(overrides, fmt.Sprintf("machine=%v", o.machine))
+	}
+	if o.maxLost > 0 {
+		overrides = append(overrides, fmt.Sprintf("retries=%d", o.maxLost))
+	}
+	if o.tenant != DefaultTenant {
+		overrides = append(overrides, fmt.Sprintf("tenant=%s", o.tenant))
+	}
+	return strings.Join(overrides, " ")
+}
+
+// maxLost returns the number of times that the tasks of the invocation
+// may be lost consecutively.
+func (inv execInvocation) maxLost() int {
+	if inv.opts != nil && inv.opts.maxLost > 0 {
+		return inv.opts.maxLost
+	}
+	return maxConsecutiveLost
+}
+
+// runTask runs the provided task with executor, within the parallelism
+// of its invocation and the fair share of its invocation's tenant.
+func runTask(ctx context.Context, executor Executor, task *Task) {
+	opts := task.Invocation.opts
+	if opts == nil || opts.procs == nil && opts.fair == nil {
+		executor.Run(task)
+		return
+	}
+	n := task.Pragma.Procs()
+	if n < 1 {
+		n = 1
+	}
+	if opts.procs != nil {
+		if task.Pragma.Exclusive() || n > opts.parallelism {
+			n = opts.parallelism
+		}
+		task.Status.Print("waiting for the invocation's parallelism")
+		if err := opts.procs.Acquire(ctx, n); err != nil {
+			// Evaluation has ended; the task may be resubmitted by a later
+			// evaluation.
+			task.Set(TaskLost)
+			return
+		}
+		defer opts.procs.Release(n)
+	}
+	if opts.fair != nil {
+		task.Status.Printf("waiting for procs of tenant %q", opts.tenant)
+		granted, err := opts.fair.acquire(ctx, opts.tenant, n)
+		if err != nil {
+			task.Set(TaskLost)
+			return
+		}
+		defer opts.fair.release(opts.tenant, granted)
+	}
+	executor.Run(task)
+}
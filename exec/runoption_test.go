@@ -0,0 +1,102 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestRunParallelism(t *testing.T) {
+	var (
+		mu             sync.Mutex
+		running, maxed int
+	)
+	fn := bigslice.Func(func(n int) bigslice.Slice {
+		slice := bigslice.Const(8, rangeSlice(0, n))
+		return bigslice.Map(slice, func(i int) int {
+			mu.Lock()
+			running++
+			if running > maxed {
+				maxed = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return i
+		})
+	})
+	ctx := context.Background()
+	sess := Start(Local, Parallelism(4))
+	defer sess.Shutdown()
+	for _, test := range []struct {
+		opts []interface{}
+		max  int
+	}{
+		{[]interface{}{RunParallelism(1)}, 1},
+		{[]interface{}{RunParallelism(2), RunRetries(3)}, 2},
+		{nil, 4},
+	} {
+		maxed = 0
+		res, err := sess.Run(ctx, fn, append([]interface{}{80}, test.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(readFrame(t, res, 80).Interface(0).([]int)), 80; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		res.Discard(ctx)
+		if maxed > test.max || test.opts != nil && maxed != test.max {
+			t.Errorf("%v: got %v concurrent tasks, want %v", test.opts, maxed, test.max)
+		}
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	tasks, _, _ := compileFunc(func() bigslice.Slice {
+		return bigslice.Const(1, []int{1, 2, 3})
+	})
+	_, opts := splitRunOptions([]interface{}{RunRetries(2)})
+	tasks[0].Invocation.opts = opts
+	var (
+		ctx  = context.Background()
+		errc = make(chan error)
+	)
+	go func() { errc <- Eval(ctx, testExecutor{}, tasks, nil) }()
+	for i := 0; i < 2; i++ {
+		waitState(t, tasks[0], TaskRunning)
+		tasks[0].Set(TaskLost)
+	}
+	err := <-errc
+	if err == nil || !strings.Contains(err.Error(), "lost on 2 consecutive attempts") {
+		t.Errorf("got %v, want lost on 2 consecutive attempts", err)
+	}
+}
+
+func TestSplitRunOptions(t *testing.T) {
+	args, opts := splitRunOptions([]interface{}{1, RunParallelism(3), "x", RunRetries(7)})
+	if got, want := len(args), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if args[0] != 1 || args[1] != "x" {
+		t.Errorf("got %v, want [1 x]", args)
+	}
+	if got, want := opts.String(), "parallelism=3 retries=7"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, opts := splitRunOptions([]interface{}{1}); opts != nil {
+		t.Errorf("got %v, want nil", opts)
+	}
+	if got, want := (execInvocation{}).maxLost(), maxConsecutiveLost; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
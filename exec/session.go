@@ -12,12 +12,17 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/grailbio/base/backgroundcontext"
 	"github.com/grailbio/base/diagnostic/dump"
+	"github.com/grailbio/base/errors"
 	"github.com/grailbio/base/eventlog"
+	"github.com/grailbio/base/file"
 	"github.com/grailbio/base/limiter"
 	"github.com/grailbio/base/log"
 	"github.com/grailbio/base/status"
@@ -26,6 +31,9 @@ import (
 	"github.com/grailbio/bigslice/metrics"
 	"github.com/grailbio/bigslice/sliceio"
 	"github.com/grailbio/bigslice/typecheck"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 // DefaultMaxLoad is the default machine max load.
@@ -75,7 +83,117 @@ type Session struct {
 	eventer   eventlog.Eventer
 	tracePath string
 
+	// taskEventLog is the prefix under which task event logs are
+	// written; it is empty if they are not.
+	taskEventLog string
+
 	machineCombiners bool
+	autoscale        autoscaleConfig
+
+	// evictionURL is the URL from which workers retrieve eviction
+	// notices; it is empty if evictions are not handled.
+	evictionURL string
+
+	// orphanTimeout is the amount of time after which workers that have
+	// not heard from the driver exit; zero if they never do.
+	orphanTimeout time.Duration
+
+	// verifyFraction is the fraction of tasks that are re-executed to
+	// verify that they are deterministic.
+	verifyFraction float64
+
+	// lossQuorum is the number of vantage points that must fail to
+	// reach a gRPC agent, with lossProbes probes over lossWindow, for
+	// it to be declared lost; zero if agents are declared lost on the
+	// first failed call.
+	lossQuorum, lossProbes int
+	lossWindow             time.Duration
+
+	// aggregationFanIn is the maximum number of combiner outputs read by
+	// a single task; zero if unlimited.
+	aggregationFanIn int
+
+	// shuffleFetchLimit is the maximum number of shuffle fetches that
+	// each machine has in progress from a single producer machine; zero
+	// if unlimited.
+	shuffleFetchLimit int
+
+	// combinerKeyDictSize is the maximum number of keys interned by each
+	// machine combiner; zero if keys are not interned.
+	combinerKeyDictSize int
+
+	// diskEviction is the policy by which workers evict task outputs
+	// when their disks near capacity.
+	diskEviction DiskEvictionPolicy
+
+	// smallJoinRows is the maximum number of rows in a join dependency
+	// that is collapsed into a lookup; zero if none are.
+	smallJoinRows int
+
+	// grpcUser and grpcToken are the credentials presented to gRPC
+	// agents.
+	grpcUser, grpcToken string
+
+	// tracerProvider provides the tracer with which invocations are
+	// traced; if nil, it is inferred from the run's context.
+	tracerProvider trace.TracerProvider
+
+	// deterministic indicates that dependency partitions are read in a
+	// fixed order, so that evaluation is reproducible.
+	deterministic bool
+
+	// maxRuns is the maximum number of concurrently evaluating
+	// invocations, or zero if unbounded. Runs limits concurrent
+	// invocations accordingly; it is nil if unbounded.
+	maxRuns int
+	runs    *limiter.Limiter
+
+	// tenantQuotas are the quotas of the session's tenants, and fair the
+	// scheduler that shares the session's procs among them; fair is nil
+	// if the session is not configured with Tenants.
+	tenantQuotas map[string]TenantQuota
+	fair         *fairScheduler
+
+	// memoize indicates that identical invocations are memoized. See
+	// Memoize.
+	memoize bool
+
+	// checkpoint is the prefix under which task outputs are checkpointed;
+	// it is empty if checkpointing is disabled.
+	checkpoint string
+	// checkpointIndexKeys indicates whether key index sidecars are
+	// written along with checkpointed task outputs.
+	checkpointIndexKeys bool
+
+	// dryRun, if non-nil, is the writer to which the plans of
+	// invocations are written in lieu of running them. See DryRun.
+	dryRun io.Writer
+
+	// resultCache is the prefix of the result cache, in which task
+	// outputs are stored by lineage; it is empty if results are not
+	// cached.
+	resultCache string
+
+	// persistPrefix is the prefix under which the outputs of slices
+	// persisted in the shared store are written; it is empty if they
+	// are stored only by workers.
+	persistPrefix string
+
+	// gpus is the number of GPUs available on each machine of the
+	// session's GPU machine profile; gpuParams are the bigmachine
+	// parameters used to start such machines.
+	gpus      int
+	gpuParams []bigmachine.Param
+
+	// alertFuncs and alertWebhook are the handlers to which alerts are
+	// delivered; slowTaskAlert is the duration after which running
+	// task attempts are reported as slow, or zero if they are not.
+	// Alerter delivers the session's alerts; it is nil if there are no
+	// handlers.
+	alertFuncs    []func(Alert)
+	alertWebhook  string
+	slowTaskAlert time.Duration
+	alerter       *alerter
 
 	tracer *tracer
 
@@ -83,6 +201,24 @@ type Session struct {
 	// roots stores all task roots compiled by this session;
 	// used for debugging.
 	roots map[*Task]struct{}
+	// fingerprints stores the checkpoint fingerprints of invocations run
+	// by this session, keyed by invocation index.
+	fingerprints map[uint64]string
+	// persisted stores, by key, the tasks of the persisted slices
+	// computed by the session's invocations, until they are evicted by
+	// Unpersist. See bigslice.Persist.
+	persisted map[string]persistedTasks
+	// memo stores the runs of memoized invocations, keyed by their
+	// fingerprints. See Memoize.
+	memo map[string]*memoRun
+	// running holds the invocations that are currently running, by
+	// index, so that they may be canceled. See Session.Cancel.
+	running map[uint64]*runningInvocation
+	// jobs are the jobs submitted to the session, in order of
+	// submission; jobGroup is the status group in which they are
+	// reported.
+	jobs     []*Job
+	jobGroup *status.Group
 }
 
 func newSession() *Session {
@@ -91,6 +227,13 @@ func newSession() *Session {
 		index:   atomic.AddInt32(&nextSessionIndex, 1) - 1,
 		roots:   make(map[*Task]struct{}),
 		eventer: eventlog.Nop{},
+
+		fingerprints: make(map[uint64]string),
+		persisted:    make(map[string]persistedTasks),
+		memo:         make(map[string]*memoRun),
+		running:      make(map[uint64]*runningInvocation),
+
+		smallJoinRows: DefaultSmallJoinRows,
 	}
 }
 
@@ -111,6 +254,76 @@ func Bigmachine(system bigmachine.System, params ...bigmachine.Param) Option {
 	}
 }
 
+// LocalProcesses configures a session that runs tasks on the local
+// machine, but in separate processes, each of which is limited to
+// memLimit bytes of address space (unlimited if memLimit is zero). A
+// task that panics fails without affecting the driver; a task that
+// exhausts its process's memory crashes the process, and is lost and
+// retried (see RunRetries) without affecting the driver. This makes the
+// mode useful for local testing of pipelines that are run at scale.
+// Note that the Go runtime reserves address space well in excess of the
+// memory that it uses (over a gigabyte, even for small processes), so
+// memLimit must allow for it.
+//
+// Processes are started by re-executing the driver binary, which thus
+// must call Start (or sliceconfig.Parse) before doing any other work, as
+// with the Bigmachine executor. Each process runs one task at a time,
+// regardless of MaxLoad, and tasks that request more procs (see
+// bigslice.Procs) are granted one. The session's parallelism is thus
+// the maximum number of processes. Processes that hold machine
+// combiners (see MachineCombiners) also retain the combined output of
+// the tasks that they have run.
+func LocalProcesses(memLimit int64) Option {
+	if memLimit < 0 {
+		panic("exec.LocalProcesses: memLimit < 0")
+	}
+	return func(s *Session) {
+		x := newBigmachineExecutor(localProcessSystem{bigmachine.Local})
+		x.memLimit = memLimit
+		x.machprocs = 1
+		s.executor = x
+	}
+}
+
+// LocalProcessSystem is the bigmachine system of LocalProcesses: it
+// starts local processes, as bigmachine.Local, but keeps them alive
+// with short timeouts, so that tasks are promptly lost when their
+// processes crash.
+type localProcessSystem struct {
+	bigmachine.System
+}
+
+// KeepaliveConfig implements bigmachine.System.
+func (localProcessSystem) KeepaliveConfig() (period, timeout, rpcTimeout time.Duration) {
+	return 5 * time.Second, 15 * time.Second, 5 * time.Second
+}
+
+// GRPC configures a session using the gRPC executor, which runs tasks
+// on the agents at the provided addresses. Agents are pre-provisioned
+// processes running the same binary as the driver; see
+// RegisterGRPCAgent. The dial options are used to connect to agents;
+// if none are provided, connections are insecure. Agents must be able
+// to reach each other at the provided addresses.
+func GRPC(addrs []string, opts ...grpc.DialOption) Option {
+	if len(addrs) == 0 {
+		panic("exec.GRPC: no agent addresses")
+	}
+	return func(s *Session) {
+		s.executor = newGRPCExecutor(addrs, opts...)
+	}
+}
+
+// GRPCCredentials configures a session that uses the gRPC executor to
+// present the provided credentials to its agents. Shared agents (see
+// RegisterSharedGRPCAgent) authenticate sessions by their credentials,
+// and charge their users for the machine time that they use.
+func GRPCCredentials(user, token string) Option {
+	return func(s *Session) {
+		s.grpcUser = user
+		s.grpcToken = token
+	}
+}
+
 // Parallelism configures the session with the provided target
 // parallelism.
 func Parallelism(p int) Option {
@@ -122,6 +335,33 @@ func Parallelism(p int) Option {
 	}
 }
 
+// Autoscale configures the session to size its machine pools
+// elastically, in place of the fixed capacity implied by Parallelism.
+// Each pool is kept between minMachines and maxMachines machines. It
+// grows as tasks become runnable, but only if the queued tasks are not
+// expected to complete on existing machines sooner than new machines
+// could be started, as estimated from observed task run times and
+// machine start times. A machine that has been idle for idleTimeout is
+// retired, so long as it does not hold task results that may still be
+// needed. If idleTimeout is zero, machines are never retired.
+//
+// Autoscale applies only to the Bigmachine executor.
+func Autoscale(minMachines, maxMachines int, idleTimeout time.Duration) Option {
+	switch {
+	case minMachines < 0:
+		panic("exec.Autoscale: minMachines < 0")
+	case maxMachines <= 0:
+		panic("exec.Autoscale: maxMachines <= 0")
+	case minMachines > maxMachines:
+		panic("exec.Autoscale: minMachines > maxMachines")
+	case idleTimeout < 0:
+		panic("exec.Autoscale: idleTimeout < 0")
+	}
+	return func(s *Session) {
+		s.autoscale = autoscaleConfig{minMachines, maxMachines, idleTimeout}
+	}
+}
+
 // MaxLoad configures the session with the provided max
 // machine load.
 func MaxLoad(maxLoad float64) Option {
@@ -155,13 +395,27 @@ func Eventer(e eventlog.Eventer) Option {
 }
 
 // TracePath configures the path to which a trace event file for the session
-// will be written on shutdown.
+// will be written on shutdown. The file is in the Chrome tracing format,
+// which may be viewed with chrome://tracing or Perfetto; see tracer.
 func TracePath(path string) Option {
 	return func(s *Session) {
 		s.tracePath = path
 	}
 }
 
+// TaskEventLog configures the session to write, for each invocation, an
+// append-only log of the lifecycle events of the invocation's tasks:
+// their state transitions, attempts, machine assignments, errors, and
+// output sizes. Logs are written as JSON lines (see TaskEvent and
+// ReadTaskEvents) under the provided prefix, which may be a URL
+// understood by GRAIL's file library (e.g., an S3 path). Each
+// invocation's log is named by the invocation's start time and index.
+func TaskEventLog(prefix string) Option {
+	return func(s *Session) {
+		s.taskEventLog = prefix
+	}
+}
+
 // MachineCombiners is a session option that turns on machine-local
 // combine buffers. If turned on, each combiner task that belongs to
 // the same shard-set and runs on the same machine combines values
@@ -174,6 +428,326 @@ var MachineCombiners Option = func(s *Session) {
 	s.machineCombiners = true
 }
 
+// SpotEvictions configures the bigmachine executor to handle the
+// preemption of spot instances gracefully. (Ec2system uses spot
+// instances unless it is configured to use on-demand instances.)
+// Workers watch for the interruption notices that EC2 issues two
+// minutes before it reclaims a spot instance. When a machine receives
+// a notice, the session stops scheduling tasks on it and replicates
+// the task outputs it holds to other machines, giving its running
+// tasks as much time to complete as is possible. Thus an eviction
+// results in a migration of task outputs, rather than in the loss
+// and recomputation of the machine's tasks.
+var SpotEvictions Option = func(s *Session) {
+	s.evictionURL = ec2InstanceActionURL
+}
+
+// AggregationFanIn configures the session to reduce the outputs of
+// combiners (e.g., of bigslice.Reduce) in a tree of intermediate
+// aggregation tasks, each of which reads at most fanIn outputs, when
+// there are more than fanIn of them. By default, each reducer reads
+// and merges one partition of the output of every upstream task at
+// once, so that its memory use and the burst of shuffle reads at its
+// start grow with the number of upstream tasks. A tree bounds both at
+// the cost of an extra pass over the data per level.
+//
+// Aggregation trees are not used with MachineCombiners, which already
+// combine outputs on each machine.
+func AggregationFanIn(fanIn int) Option {
+	if fanIn < 2 {
+		panic("exec.AggregationFanIn: fanIn < 2")
+	}
+	return func(s *Session) {
+		s.aggregationFanIn = fanIn
+	}
+}
+
+// ShuffleFetchLimit limits the number of shuffle fetches that the
+// tasks on each machine may have in progress from any single producer
+// machine. Shuffle reads are always scheduled per machine so that
+// tasks that start together, e.g., the reducers of a wide shuffle,
+// fetch first from the least loaded producers, and start from
+// different producers, rather than stampeding the same ones. The
+// limit additionally bounds the load that each machine places on each
+// producer, improving the tail latency of wide reduce stages. By
+// default, the number of fetches is unlimited. Dependencies that are
+// read concurrently by a single task, e.g., by bigslice.Reduce, are
+// not limited.
+func ShuffleFetchLimit(n int) Option {
+	if n < 0 {
+		panic("exec.ShuffleFetchLimit: n < 0")
+	}
+	return func(s *Session) {
+		s.shuffleFetchLimit = n
+	}
+}
+
+// CombinerKeyDictionary configures the machine combiners of
+// bigmachine workers to intern up to maxKeys distinct string keys in a
+// dictionary that is shared by all of the tasks on a machine that
+// combine into the same combiner. The combiner's buffers then share a
+// single copy of each interned key, reducing allocation and memory
+// use in aggregation-heavy jobs whose keys are enum-like, i.e., that
+// have few distinct values across many rows. Keys beyond the first
+// maxKeys are combined as they are. By default, keys are not
+// interned.
+func CombinerKeyDictionary(maxKeys int) Option {
+	if maxKeys < 0 {
+		panic("exec.CombinerKeyDictionary: maxKeys < 0")
+	}
+	return func(s *Session) {
+		s.combinerKeyDictSize = maxKeys
+	}
+}
+
+// DiskEviction configures workers to evict the outputs of completed
+// tasks when their disks near capacity, as determined by the provided
+// policy. Rather than failing new tasks with write errors, a worker
+// whose disk use exceeds policy.MaxUsage discards the outputs that it
+// least recently needed, i.e., wrote or served, before it writes new
+// ones. The outputs of the tasks that are read by the task being run
+// are never evicted. Evicted tasks are marked LOST, and are recomputed
+// if they are needed again. By default, outputs are not evicted.
+func DiskEviction(policy DiskEvictionPolicy) Option {
+	if policy.MaxUsage < 0 || policy.MaxUsage > 1 {
+		panic("exec.DiskEviction: policy.MaxUsage not in [0, 1]")
+	}
+	return func(s *Session) {
+		s.diskEviction = policy
+	}
+}
+
+// SmallJoinRows configures the maximum number of rows in a small
+// dependency of a join (e.g., of bigslice.Cogroup) that is collapsed
+// into a lookup. Rather than being shuffled by tasks of its own, a
+// collapsed dependency is computed in full within each of the join's
+// tasks, each of which keeps the rows with the keys of its own shard.
+// Only dependencies whose size is known at compile time are collapsed:
+// those that declare it through bigslice.Sizer, e.g., bigslice.Const
+// and bigslice.Sized slices, and maps and filters of them, that do not
+// themselves read other slices. Collapsed dependencies are reported in
+// the log, and in the task graph (see Session.Graph). By default,
+// dependencies of at most DefaultSmallJoinRows rows are collapsed;
+// rows <= 0 disables collapsing.
+func SmallJoinRows(rows int) Option {
+	return func(s *Session) {
+		s.smallJoinRows = rows
+	}
+}
+
+// TracerProvider configures the session to emit OpenTelemetry spans
+// for its invocations with tracers provided by tp. By default, spans
+// are emitted with the provider of the span in the context of the
+// run, if any, or else with the globally registered provider.
+//
+// Each invocation's span parents a span for each stage of tasks that
+// it runs, which parents a span for each task, which in turn parents a
+// span for each attempt to run the task. Bigmachine workers continue
+// the trace of each attempt that they run, using their globally
+// registered provider.
+func TracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Session) {
+		s.tracerProvider = tp
+	}
+}
+
+// OrphanTimeout configures bigmachine workers to exit once they have
+// not received a heartbeat from the session's driver for the provided
+// duration, e.g., because the driver process crashed, was killed, or
+// lost its network connection. The driver sends heartbeats several
+// times per timeout. Machines whose worker exits are torn down by
+// their system; ec2system terminates their instances. Thus clusters
+// are not leaked beyond the timeout when their driver disappears.
+//
+// OrphanTimeout applies only to the Bigmachine executor.
+func OrphanTimeout(timeout time.Duration) Option {
+	if timeout <= 0 {
+		panic("exec.OrphanTimeout: timeout <= 0")
+	}
+	return func(s *Session) {
+		s.orphanTimeout = timeout
+	}
+}
+
+// VerifyDeterminism configures the session to verify that a fraction of
+// its tasks, which are sampled by name, are deterministic: once a
+// sampled task completes, it is re-executed on the same inputs, and the
+// two executions' outputs, which are summarized by order-insensitive
+// digests, are compared. The task fails with a fatal error if they
+// differ. Non-deterministic funcs, e.g., those that depend on map
+// iteration order or on time.Now, otherwise cause retried tasks to
+// produce outputs that are subtly inconsistent with those of their
+// dependents. Verification is meant for testing and validation, as
+// the verified tasks are computed twice.
+//
+// Tasks whose outputs are combined, or that have columns that cannot
+// be hashed, are not verified.
+func VerifyDeterminism(fraction float64) Option {
+	if fraction < 0 || fraction > 1 {
+		panic("exec.VerifyDeterminism: fraction not in [0, 1]")
+	}
+	return func(s *Session) {
+		s.verifyFraction = fraction
+	}
+}
+
+// LossQuorum configures the gRPC executor to declare an agent, and
+// thus the outputs of all of the tasks that it ran, lost only once its
+// loss has been confirmed by a quorum of vantage points. When the
+// driver fails to reach an agent, the driver and up to quorum peer
+// agents each probe it the provided number of times over the provided
+// window; the agent is declared lost if at least quorum of them failed
+// every probe. Otherwise, only the task that was being run is retried.
+// This prevents transient network partitions from causing storms of
+// lost tasks. By default, agents are declared lost as soon as the
+// driver fails to reach them.
+//
+// LossQuorum applies only to the GRPC executor, and Start panics if it
+// is used with any other. The bigmachine executor declares machines
+// lost as bigmachine's keepalives fail, without confirmation.
+func LossQuorum(quorum, probes int, window time.Duration) Option {
+	if quorum <= 0 {
+		panic("exec.LossQuorum: quorum <= 0")
+	}
+	if probes <= 0 {
+		panic("exec.LossQuorum: probes <= 0")
+	}
+	if window <= 0 {
+		panic("exec.LossQuorum: window <= 0")
+	}
+	return func(s *Session) {
+		s.lossQuorum = quorum
+		s.lossProbes = probes
+		s.lossWindow = window
+	}
+}
+
+// Deterministic configures the session so that, provided that user code
+// is itself deterministic, repeated runs of an invocation produce
+// bit-for-bit identical outputs. Task dependencies are read in a fixed
+// order (by default, the bigmachine executor shuffles them to avoid
+// thundering herds), and machine-local combine buffers, which combine
+// values in the order in which tasks happen to complete, are disabled:
+// Deterministic overrides MachineCombiners.
+//
+// Records with equal keys are always merged in dependency order, so that
+// operations like Reduce and Cogroup observe them in a stable order.
+var Deterministic Option = func(s *Session) {
+	s.deterministic = true
+}
+
+// MaxConcurrentRuns configures the session to evaluate at most n
+// invocations concurrently. Calls to Run beyond this limit wait, subject
+// to their contexts, for a running invocation to complete, much like a
+// connection pool. This is useful for bounding the resources used by
+// servers that drive a shared session from many goroutines.
+func MaxConcurrentRuns(n int) Option {
+	if n <= 0 {
+		panic("exec.MaxConcurrentRuns: n <= 0")
+	}
+	return func(s *Session) {
+		s.maxRuns = n
+	}
+}
+
+// Memoize configures the session to memoize invocations: running an
+// invocation that is identical to one that was run before, i.e., of the
+// same Func with the same arguments, returns the Result of the earlier
+// run instead of compiling and computing its graph again. Concurrent
+// runs of identical invocations share a single run. Arguments are
+// compared by their gob encodings, except for *Results, which are
+// compared by identity; invocations with arguments that cannot be
+// gob-encoded are not memoized.
+//
+// Funcs must thus be pure: their slices must depend only on their
+// arguments. The Results of memoized invocations are retained for the
+// life of the session, until they are discarded by Result.Discard;
+// failed runs are not memoized.
+var Memoize Option = func(s *Session) {
+	s.memoize = true
+}
+
+// Checkpoint configures the session to checkpoint task outputs under the
+// provided prefix, which may be a URL understood by GRAIL's file library
+// (e.g., an S3 path). As tasks complete, their outputs are persisted
+// together with a manifest of completed tasks. If the driver process dies,
+// re-running the same invocation (the same Func with the same arguments)
+// in a new session with the same checkpoint prefix resumes from the
+// completed tasks instead of recomputing them.
+//
+// As with bigslice.CachePartial, the user is responsible for ensuring that
+// computations are deterministic across runs and for removing checkpoints
+// that are invalidated, e.g., by code changes.
+func Checkpoint(prefix string) Option {
+	return func(s *Session) {
+		s.checkpoint = prefix
+	}
+}
+
+// ResultCache configures the session to cache task outputs under the
+// provided prefix, which may be a URL understood by GRAIL's file
+// library (e.g., an S3 path), across sessions. Outputs are keyed by a
+// hash of the lineage of the tasks that compute them: the Func and
+// arguments of their invocation, a digest of the driver's code (its
+// executable and loaded plugins), the operations of the tasks, and,
+// recursively, the lineage of the tasks on which they depend. Tasks
+// whose outputs are in the cache read them instead of computing them,
+// so that a pipeline that is re-run by the same binary, e.g., after the
+// driver restarts, or with different arguments to its later stages,
+// reuses the outputs of its earlier stages. A cache may be shared by
+// any number of sessions.
+//
+// Any change to the driver's code invalidates the cached outputs, even
+// a change that does not move the changed operations. Sources are
+// presumed to be unchanged unless their shards are versioned (see
+// bigslice.Versioned); as with Checkpoint, the user is responsible for
+// removing outputs that are invalidated by changes to unversioned
+// inputs. Tasks that use machine combiners, and tasks of invocations
+// whose arguments cannot be gob-encoded, are not cached.
+func ResultCache(prefix string) Option {
+	return func(s *Session) {
+		s.resultCache = prefix
+	}
+}
+
+// PersistPrefix configures the session to write the outputs of slices
+// that are persisted in the shared store (see bigslice.PersistShared)
+// under the provided prefix, which may be a URL understood by GRAIL's
+// file library (e.g., an S3 path). Later sessions with the same prefix
+// read the stored outputs instead of recomputing them. Without a
+// prefix, such slices are stored only on the workers' disks.
+func PersistPrefix(prefix string) Option {
+	return func(s *Session) {
+		s.persistPrefix = prefix
+	}
+}
+
+// CheckpointIndexKeys configures the session to write, along with each
+// checkpointed task output, a key index sidecar as written by
+// bigslice.IndexKeys. Checkpointed outputs may then be looked up by key
+// with bigslice.ReadCacheKeys without scanning all of them.
+var CheckpointIndexKeys Option = func(s *Session) {
+	s.checkpointIndexKeys = true
+}
+
+// GPUs configures the session's GPU machine profile. Each machine in the
+// profile advertises the provided number of GPUs, and is started with the
+// provided bigmachine params (e.g., to select a GPU instance type). Tasks
+// that request GPUs through bigslice.GPUs are placed only on such machines.
+// The procs of GPU machines count against the session's parallelism, though
+// GPU tasks may always start one GPU machine, even if the session's other
+// machines use all of it. When the session uses the local executor, gpus is the number of GPUs
+// available to the local process, and params are ignored.
+func GPUs(gpus int, params ...bigmachine.Param) Option {
+	if gpus <= 0 {
+		panic("exec.GPUs: gpus <= 0")
+	}
+	return func(s *Session) {
+		s.gpus = gpus
+		s.gpuParams = params
+	}
+}
+
 // nextSessionIndex is the index of the next session that will be started by
 // Start. In general, there should be only one session per process, but we
 // violate this in some tests.
@@ -201,6 +775,19 @@ func Start(options ...Option) *Session {
 	if s.executor == nil {
 		s.executor = newBigmachineExecutor(bigmachine.Local)
 	}
+	if _, ok := s.executor.(*grpcExecutor); !ok && s.lossQuorum > 0 {
+		panic("exec.LossQuorum: loss quorums apply only to the GRPC executor")
+	}
+	if s.deterministic {
+		s.machineCombiners = false
+	}
+	if s.maxRuns > 0 {
+		s.runs = limiter.New()
+		s.runs.Release(s.maxRuns)
+	}
+	if s.tenantQuotas != nil {
+		s.fair = newFairScheduler(s.p, s.tenantQuotas)
+	}
 	s.start()
 	return s
 }
@@ -208,8 +795,16 @@ func Start(options ...Option) *Session {
 // Run evaluates the slice returned by the bigslice func funcv
 // applied to the provided arguments. Tasks are run by the session's
 // executor. Run returns when the computation has completed, or else
-// on error. It is safe to make concurrent calls to Run; the
-// underlying computation will be performed in parallel.
+// on error. RunOptions among the arguments override the session's
+// settings for this invocation; see RunOption.
+//
+// It is safe to make concurrent calls to Run from many goroutines; the
+// underlying computations are performed in parallel. Each invocation is
+// compiled and evaluated independently, with its own status groups and
+// its own error: a failure in one invocation does not affect others,
+// except where they share tasks through Result arguments. The number of
+// concurrently evaluating invocations may be bounded with
+// MaxConcurrentRuns.
 func (s *Session) Run(ctx context.Context, funcv *bigslice.FuncValue, args ...interface{}) (*Result, error) {
 	return s.run(ctx, 1, funcv, args...)
 }
@@ -228,13 +823,31 @@ func (s *Session) Must(ctx context.Context, funcv *bigslice.FuncValue, args ...i
 // the task results are needed by another computation, they will be recomputed.
 // Discarding is best-effort, so no error is returned.
 func (s *Session) Discard(ctx context.Context, roots []*Task) {
+	s.discard(ctx, roots, nil)
+}
+
+// discard discards the subgraph given by roots, except for the tasks in
+// retain.
+func (s *Session) discard(ctx context.Context, roots []*Task, retain map[*Task]bool) {
 	var (
 		limiter = limiter.New()
 		wg      sync.WaitGroup
 	)
 	limiter.Release(64)
+	// The discarded roots no longer need to be retained for debugging.
+	s.mu.Lock()
+	for _, task := range roots {
+		if !retain[task] {
+			delete(s.roots, task)
+		}
+	}
+	s.mu.Unlock()
 	// Best effort, so discard error.
 	_ = iterTasks(roots, func(task *Task) error {
+		// Persisted outputs are retained until they are unpersisted.
+		if retain[task] || s.isPersisted(task) {
+			return nil
+		}
 		if err := limiter.Acquire(ctx, 1); err != nil {
 			return err
 		}
@@ -249,6 +862,54 @@ func (s *Session) Discard(ctx context.Context, roots []*Task) {
 	wg.Wait()
 }
 
+// Decommission gracefully removes the machine with the provided
+// address from the session: no new tasks are scheduled on it, tasks
+// that are running on it are allowed to complete, and the outputs it
+// holds are replicated to other machines before it is stopped. It is
+// intended for controlled scale-down and host maintenance.
+// Decommission returns an error of kind errors.NotSupported if the
+// session's executor does not manage machines.
+func (s *Session) Decommission(ctx context.Context, addr string) error {
+	d, ok := s.executor.(interface {
+		Decommission(ctx context.Context, addr string) error
+	})
+	if !ok {
+		return errors.E(errors.NotSupported, "executor ", s.executor.Name(), " does not support decommissioning machines")
+	}
+	return d.Decommission(ctx, addr)
+}
+
+// WriteDOT writes the task graphs of all the invocations that have
+// been run by the session, and that have not since been discarded, into
+// w in the DOT graph description language. See Task.WriteDOT.
+func (s *Session) WriteDOT(w io.Writer) error {
+	s.mu.Lock()
+	roots := make([]*Task, 0, len(s.roots))
+	for task := range s.roots {
+		roots = append(roots, task)
+	}
+	s.mu.Unlock()
+	return writeDOT(w, roots)
+}
+
+// Graph returns a snapshot of the task graphs of all the invocations
+// that have been run by the session, and that have not since been
+// discarded, along with the session's jobs. See Graph for details.
+func (s *Session) Graph() *Graph {
+	s.mu.Lock()
+	roots := make([]*Task, 0, len(s.roots))
+	for task := range s.roots {
+		roots = append(roots, task)
+	}
+	jobs := append([]*Job(nil), s.jobs...)
+	s.mu.Unlock()
+	g := snapshotGraph(roots)
+	for _, job := range jobs {
+		g.Jobs = append(g.Jobs, snapshotJob(job))
+	}
+	return g
+}
+
 func (s *Session) start() {
 	s.shutdown = s.executor.Start(s)
 	s.eventer.Event("bigslice:sessionStart",
@@ -258,6 +919,7 @@ func (s *Session) start() {
 		"maxLoad", s.maxLoad,
 		"machineCombiners", s.machineCombiners)
 	s.tracer = newTracer()
+	s.alerter = newAlerter(s.alertFuncs, s.alertWebhook)
 
 	name := fmt.Sprintf("bigslice-%02d-trace", s.index)
 	dump.Register(name, func(ctx context.Context, w io.Writer) error {
@@ -271,6 +933,44 @@ type execInvocation struct {
 	bigslice.Invocation
 	// Env is the compilation environment
 	Env CompileEnv
+
+	// persisted returns the tasks of a previous invocation that are
+	// referred to by Env.Persisted. It is provided by the driver and
+	// workers, which hold the previous invocations' tasks, and is not
+	// gob-encoded.
+	persisted func(persistRef) ([]*Task, error)
+
+	// completed returns the completed task of a previous run of a
+	// resident invocation that has the provided lineage, or nil if
+	// there is none. It is provided only by the driver, and only for
+	// resident invocations; it is not gob-encoded.
+	completed func(lineage string) *Task
+
+	// reused returns the task of a previous invocation that is named by
+	// a value of Env.Reused. It is provided by the driver and workers,
+	// and is not gob-encoded.
+	reused func(TaskName) (*Task, error)
+
+	// resultCache is the prefix of the session's result cache, and
+	// cachedResults the set of keys (task lineages) of the outputs that
+	// it holds, if the invocation's results are cached. fingerprint
+	// identifies the invocation, and the code that runs it, across
+	// sessions; it is part of the
+	// lineage of the invocation's tasks. They are provided only by the
+	// driver, and are not gob-encoded. See ResultCache.
+	resultCache   string
+	cachedResults map[string]bool
+	fingerprint   string
+
+	// opts are the overrides of session settings with which the
+	// invocation is run, or nil if there are none. They are provided
+	// only by the driver, and are not gob-encoded. See RunOption.
+	opts *runOptions
+
+	// residency checks the machines that run the invocation's tasks, if
+	// the invocation has residency constraints; it is nil otherwise. It
+	// is provided only by the driver, and is not gob-encoded.
+	residency *residency
 }
 
 func makeExecInvocation(inv bigslice.Invocation) execInvocation {
@@ -286,56 +986,193 @@ func makeExecInvocation(inv bigslice.Invocation) execInvocation {
 var statusMu sync.Mutex
 
 func (s *Session) run(ctx context.Context, calldepth int, funcv *bigslice.FuncValue, args ...interface{}) (*Result, error) {
+	_, file, line, ok := runtime.Caller(calldepth + 1)
+	if !ok {
+		file = ""
+	}
+	return s.runAt(ctx, file, line, funcv, args...)
+}
+
+// runAt runs the invocation of funcv with the provided arguments, which
+// is made at the provided source location. The location is unknown if
+// file is empty.
+func (s *Session) runAt(ctx context.Context, file string, line int, funcv *bigslice.FuncValue, args ...interface{}) (*Result, error) {
+	return s.runInvocation(ctx, nil, file, line, funcv, args...)
+}
+
+// runInvocation is runAt for a run of the provided resident
+// invocation, whose completed tasks may be reused, or for a one-off
+// invocation if r is nil.
+func (s *Session) runInvocation(ctx context.Context, r *Resident, file string, line int, funcv *bigslice.FuncValue, args ...interface{}) (res *Result, err error) {
+	args, opts := splitRunOptions(args)
+	if s.dryRun != nil {
+		return s.explain(ctx, s.dryRun, file, line, funcv, args...)
+	}
 	location := "<unknown>"
-	if _, file, line, ok := runtime.Caller(calldepth + 1); ok {
+	if file != "" {
 		location = fmt.Sprintf("%s:%d", file, line)
 		defer typecheck.Location(file, line)
 	}
 	var (
 		inv        execInvocation
 		slice      bigslice.Slice
-		tasks      []*Task
 		sliceGroup *status.Group
 		taskGroup  *status.Group
+		ckpt       *checkpointer
 	)
-	// Make invocation and status setup atomic so that status displays in
-	// invocation index order.
-	//
-	// TODO(jcharumilind): Add functionality to status package to control
-	// ordering.
-	err := func() error {
-		statusMu.Lock()
-		defer statusMu.Unlock()
-		inv = makeExecInvocation(funcv.Invocation(location, args...))
-		slice = inv.Invoke()
-		var err error
-		tasks, err = compile(inv, slice, s.machineCombiners)
+	inv = makeExecInvocation(funcv.Invocation(location, args...))
+	if opts != nil {
+		log.Printf("%s: invocation %d: overriding %s", location, inv.Index, opts)
+	}
+	if s.fair != nil {
+		if opts == nil {
+			opts = new(runOptions)
+		}
+		opts.fair = s.fair
+	}
+	inv.opts = opts
+	if r == nil && s.memoize {
+		memo, memoized, memoErr := s.memoized(ctx, inv.Invocation)
+		if memoErr != nil {
+			return nil, memoErr
+		}
+		if memoized != nil {
+			log.Printf("%s: reusing memoized result of invocation %d", location, memoized.invIndex)
+			return memoized, nil
+		}
+		if memo != nil {
+			defer func() { s.finishMemo(memo, res, err) }()
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.startRunning(inv.Index, location, cancel)
+	defer s.stopRunning(inv.Index)
+	if s.runs != nil {
+		// Bound the number of concurrently evaluating invocations.
+		if err := s.runs.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		defer s.runs.Release(1)
+	}
+	if s.fair != nil {
+		// Bound the number of the tenant's concurrently evaluating
+		// invocations.
+		if err := s.fair.startRun(ctx, opts.tenant); err != nil {
+			return nil, err
+		}
+		defer s.fair.endRun(opts.tenant)
+	}
+	if r != nil {
+		inv.completed = r.completedTask
+		inv.reused = r.reusedTask
+	}
+	tracer := tracerFromContext(ctx)
+	if s.tracerProvider != nil {
+		tracer = s.tracerProvider.Tracer(instrumentationName)
+	}
+	ctx, span := tracer.Start(ctx, "bigslice.invocation", trace.WithAttributes(
+		attribute.String("bigslice.func", location),
+		attribute.Int64("bigslice.invocation", int64(inv.Index)),
+		attribute.String("bigslice.executor", s.executor.Name()),
+	))
+	defer func() { endSpan(span, err) }()
+	if s.checkpoint != "" {
+		s.mu.Lock()
+		fingerprints := make(map[uint64]string, len(s.fingerprints))
+		for index, fp := range s.fingerprints {
+			fingerprints[index] = fp
+		}
+		s.mu.Unlock()
+		var (
+			fp  string
+			err error
+		)
+		ckpt, fp, err = newCheckpointer(ctx, s.executor, s.checkpoint, &inv, fingerprints)
 		if err != nil {
-			return err
+			log.Error.Printf("%s: not checkpointing invocation: %v", location, err)
+			ckpt = nil
+		} else {
+			ckpt.indexKeys = s.checkpointIndexKeys
+			s.mu.Lock()
+			s.fingerprints[inv.Index] = fp
+			s.mu.Unlock()
 		}
-		// Freeze the environment to ensure that compilations are consistent
-		// (e.g. across workers).
-		inv.Env.Freeze()
-		// TODO(marius): give a way to provide names for these groups
-		if s.status != nil {
-			// Make the slice status group come before the more granular task
-			// status group, as we generally want increasing level of detail
-			// when observing status.
-			sliceGroup = s.status.Groupf("run %s [%d] slices", location, inv.Index)
-			_ = s.status.Groups()
-			// taskGroup is managed by Eval.
-			taskGroup = s.status.Groupf("run %s [%d] tasks", location, inv.Index)
-			_ = s.status.Groups()
+	}
+	var cacher *checkpointer
+	if s.resultCache != "" && r == nil {
+		var err error
+		if cacher, err = newResultCacher(ctx, s.executor, s.resultCache, &inv); err != nil {
+			log.Error.Printf("%s: not caching results: %v", location, err)
+			cacher = nil
 		}
-		return nil
-	}()
+	}
+	// Invocation and compilation are performed outside of any
+	// session-wide lock so that concurrent runs do not serialize on
+	// (potentially expensive) Func invocations.
+	inv.Env.AggregationFanIn = s.aggregationFanIn
+	inv.Env.SmallJoinRows = s.smallJoinRows
+	slice = inv.Invoke()
+	if inv.residency, err = s.checkResidency(inv, slice); err != nil {
+		return nil, err
+	}
+	if inv.residency != nil {
+		log.Printf("%s: residency: running in region %s; permitted regions: %s",
+			location, inv.residency.region, strings.Join(inv.residency.permitted, ", "))
+		span.SetAttributes(
+			attribute.String("bigslice.residency.region", inv.residency.region),
+			attribute.String("bigslice.residency.permitted", strings.Join(inv.residency.permitted, ",")),
+		)
+	}
+	if err := resolveSnapshots(ctx, &inv, slice); err != nil {
+		return nil, err
+	}
+	for group, snapshot := range inv.Env.Snapshots {
+		log.Printf("%s: reading snapshot %s of group %s", location, snapshot, group)
+		span.SetAttributes(attribute.String("bigslice.snapshot."+group, snapshot))
+	}
+	s.mu.Lock()
+	err = resolvePersisted(&inv, slice, func(key string) (persistedTasks, bool) {
+		persisted, ok := s.persisted[key]
+		return persisted, ok
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	inv.Env.PersistPrefix = s.persistPrefix
+	inv.persisted = s.persistedTasks
+	c := newCompiler(inv, s.machineCombiners)
+	tasks, err := c.compile(slice, partitioner{})
 	if err != nil {
 		return nil, err
 	}
+	// Freeze the environment to ensure that compilations are consistent
+	// (e.g. across workers).
+	inv.Env.Freeze()
+	// TODO(marius): give a way to provide names for these groups
+	if s.status != nil {
+		// Make status setup atomic so that the slice and task groups of an
+		// invocation are adjacent.
+		//
+		// TODO(jcharumilind): Add functionality to status package to control
+		// ordering.
+		statusMu.Lock()
+		// Make the slice status group come before the more granular task
+		// status group, as we generally want increasing level of detail
+		// when observing status.
+		sliceGroup = s.status.Groupf("run %s [%d] slices", location, inv.Index)
+		_ = s.status.Groups()
+		// taskGroup is managed by Eval.
+		taskGroup = s.status.Groupf("run %s [%d] tasks", location, inv.Index)
+		_ = s.status.Groups()
+		statusMu.Unlock()
+	}
 	if sliceGroup != nil {
 		maintainCtx, cancel := context.WithCancel(ctx)
 		defer cancel()
 		go maintainSliceGroup(maintainCtx, tasks, sliceGroup)
+		go maintainMetrics(maintainCtx, tasks, sliceGroup)
 	}
 	// Register all the tasks so they may be used in visualization.
 	s.mu.Lock()
@@ -343,12 +1180,137 @@ func (s *Session) run(ctx context.Context, calldepth int, funcv *bigslice.FuncVa
 		s.roots[task] = struct{}{}
 	}
 	s.mu.Unlock()
-	return &Result{
-		Slice:    slice,
-		sess:     s,
-		invIndex: inv.Index,
-		tasks:    tasks,
-	}, Eval(ctx, s.executor, tasks, taskGroup)
+	if ckpt != nil {
+		watchCtx, cancel := context.WithCancel(ctx)
+		go ckpt.Watch(watchCtx, tasks)
+		defer func() {
+			cancel()
+			ckpt.Finish(tasks)
+		}()
+	}
+	if cacher != nil {
+		watchCtx, cancel := context.WithCancel(ctx)
+		go cacher.Watch(watchCtx, tasks)
+		defer func() {
+			cancel()
+			cacher.Finish(tasks)
+		}()
+	}
+	if s.alerter != nil {
+		alerts := watchInvocation(ctx, s.alerter, inv, tasks, s.slowTaskAlert)
+		defer func() { alerts.Close(tasks, err) }()
+	}
+	if s.taskEventLog != "" {
+		elog, elogErr := startTaskEventLog(s.Context, s.taskEventLog, inv, s.executor, tasks)
+		if elogErr != nil {
+			log.Error.Printf("%s: not logging task events: %v", location, elogErr)
+		} else {
+			defer func() {
+				if closeErr := elog.Close(s.Context, tasks, err); closeErr != nil {
+					log.Error.Printf("%s: task event log %s: %v", location, elog.path, closeErr)
+				}
+			}()
+		}
+	}
+	res = &Result{
+		Slice:     slice,
+		sess:      s,
+		invIndex:  inv.Index,
+		tasks:     tasks,
+		snapshots: inv.Env.Snapshots,
+	}
+	if inv.residency != nil {
+		res.permitted = inv.residency.permitted
+	}
+	if err = Eval(ctx, s.executor, tasks, taskGroup); err != nil {
+		if s.canceled(inv.Index) {
+			err = errors.E(errors.Canceled, fmt.Sprintf("invocation %d canceled", inv.Index), err)
+		}
+		return res, err
+	}
+	if inv.residency != nil {
+		if res.attestation = inv.residency.attest(s.executor.Name()); res.attestation != nil {
+			log.Printf("%s: residency: %s", location, res.attestation)
+		} else {
+			log.Printf("%s: residency: no machines ran the invocation's tasks; not attesting", location)
+		}
+	}
+	// The slices persisted by the invocation are now available to later
+	// invocations.
+	s.mu.Lock()
+	for key, persisted := range c.persists {
+		if _, ok := s.persisted[key]; !ok {
+			s.persisted[key] = persisted
+		}
+	}
+	s.mu.Unlock()
+	return res, nil
+}
+
+// persistedTasks returns the tasks of the persisted slice to which ref
+// refers.
+func (s *Session) persistedTasks(ref persistRef) ([]*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, persisted := range s.persisted {
+		if persisted.ref() == ref {
+			return persisted.tasks, nil
+		}
+	}
+	return nil, errors.E(errors.NotExist, fmt.Sprintf("persisted tasks %s are evicted", ref.Name(0)))
+}
+
+// Persisted returns the keys of the slices that are persisted by the
+// session, in sorted order. See bigslice.Persist.
+func (s *Session) Persisted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.persisted))
+	for key := range s.persisted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Unpersist evicts the slice persisted under the provided key: its
+// stored outputs are discarded, including those in the shared store,
+// and later invocations that persist a slice under the key compute it
+// again. Unpersist returns an error of kind errors.NotExist if no slice
+// is persisted under the key. Results that read the evicted slice may
+// recompute it if they are read again.
+func (s *Session) Unpersist(ctx context.Context, key string) error {
+	s.mu.Lock()
+	persisted, ok := s.persisted[key]
+	delete(s.persisted, key)
+	s.mu.Unlock()
+	if !ok {
+		return errors.E(errors.NotExist, fmt.Sprintf("unpersist %s: key is not persisted", key))
+	}
+	for _, task := range persisted.tasks {
+		s.executor.Discard(ctx, task)
+	}
+	if persisted.tasks[0].Storage == bigslice.PersistShared && s.persistPrefix != "" {
+		if err := file.RemoveAll(ctx, file.Join(s.persistPrefix, key)); err != nil {
+			return errors.E(fmt.Sprintf("unpersist %s", key), err)
+		}
+	}
+	return nil
+}
+
+// isPersisted returns whether the provided task computes a slice that
+// is persisted by the session.
+func (s *Session) isPersisted(task *Task) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, persisted := range s.persisted {
+		for _, t := range persisted.tasks {
+			if t == task {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Parallelism returns the desired amount of evaluation parallelism.
@@ -370,6 +1332,9 @@ func (s *Session) Shutdown() {
 	if s.tracePath != "" {
 		writeTraceFile(s.tracer, s.tracePath)
 	}
+	if s.alerter != nil {
+		s.alerter.Close()
+	}
 }
 
 // Status returns the session's status aggregator.
@@ -382,6 +1347,13 @@ func (s *Session) HandleDebug(handler *http.ServeMux) {
 	handler.Handle("/debug", http.HandlerFunc(s.handleDebug))
 	handler.Handle("/debug/tasks/graph", http.HandlerFunc(s.handleTasksGraph))
 	handler.Handle("/debug/tasks", http.HandlerFunc(s.handleTasks))
+	handler.Handle("/debug/dag/graph", http.HandlerFunc(s.handleDAGGraph))
+	handler.Handle("/debug/dag", http.HandlerFunc(s.handleDAG))
+	handler.Handle("/debug/timeline", http.HandlerFunc(s.handleTimeline))
+	handler.Handle("/debug/profile", http.HandlerFunc(s.handleProfile))
+	handler.Handle("/debug/summary", http.HandlerFunc(s.handleSummary))
+	handler.Handle("/debug/cancel", http.HandlerFunc(s.handleCancel))
+	handler.Handle("/metrics", http.HandlerFunc(s.handleMetrics))
 	if s.tracer != nil {
 		handler.HandleFunc("/debug/trace", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add("content-type", "application/json; charset=utf-8")
@@ -402,6 +1374,50 @@ type Result struct {
 	tasks     []*Task
 	initScope sync.Once
 	scope     metrics.Scope
+	// cursors retains the readers of pages read by ReadPage.
+	cursors pageCursors
+	// snapshots holds the snapshots at which the result's sources were
+	// read.
+	snapshots map[string]string
+	// permitted are the regions in which the invocation that computed
+	// the result was permitted to run; it is nil if the invocation had
+	// no residency constraints. They constrain the invocations that
+	// read the result.
+	permitted []string
+	// attestation records the residency of the invocation that computed
+	// the result; it is nil if the invocation had no residency
+	// constraints, or if no machine ran its tasks.
+	attestation *Attestation
+}
+
+// Residency returns the attestation that the machines that ran the
+// tasks of the invocation that computed r are in regions permitted by
+// its residency constraints, and whether there is one. There is none if
+// the invocation had no residency constraints, or if none of its tasks
+// were run, e.g., because they were all reused from previous
+// invocations. See bigslice.Residency.
+func (r *Result) Residency() (Attestation, bool) {
+	if r.attestation == nil {
+		return Attestation{}, false
+	}
+	a := *r.attestation
+	a.Permitted = append([]string(nil), a.Permitted...)
+	a.Machines = make(map[string]string, len(r.attestation.Machines))
+	for addr, region := range r.attestation.Machines {
+		a.Machines[addr] = region
+	}
+	return a, true
+}
+
+// Snapshots returns the snapshot at which each snapshot group read by
+// the invocation that computed r was read, keyed by group. See
+// bigslice.Snapshot.
+func (r *Result) Snapshots() map[string]string {
+	snapshots := make(map[string]string, len(r.snapshots))
+	for group, snapshot := range r.snapshots {
+		snapshots[group] = snapshot
+	}
+	return snapshots
 }
 
 // Scanner returns a scanner that scans the output. If the output contains
@@ -437,11 +1453,19 @@ func (r *Result) open() sliceio.ReadCloser {
 	return sliceio.MultiReader(readers...)
 }
 
+// Graph returns a snapshot of the task graph used to compute r,
+// including the current state of each of its tasks. See Graph for
+// details.
+func (r *Result) Graph() *Graph {
+	return snapshotGraph(r.tasks)
+}
+
 // Discard discards the storage resources held by the subgraph of tasks used to
 // compute r. This should be used to discard results that are no longer needed.
 // If the results are needed by another computation, they will be recomputed.
 // Discarding is best-effort, so no error is returned.
 func (r *Result) Discard(ctx context.Context) {
+	r.sess.forgetMemo(r)
 	r.sess.Discard(ctx, r.tasks)
 }
 
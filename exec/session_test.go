@@ -5,16 +5,27 @@
 package exec
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	osexec "os/exec"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigmachine"
 	"github.com/grailbio/bigmachine/testsystem"
 	"github.com/grailbio/bigslice"
 	"github.com/grailbio/bigslice/frame"
@@ -372,6 +383,364 @@ var executors = map[string]Option{
 	"Bigmachine.Test": Bigmachine(testsystem.New()),
 }
 
+// TestSessionConcurrentRuns verifies that many goroutines may drive a shared
+// session concurrently, and that invocation errors are isolated.
+func TestSessionConcurrentRuns(t *testing.T) {
+	const N = 32
+	sum := bigslice.Func(func(k int) bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, 100))
+		slice = bigslice.Map(slice, func(i int) (int, int) {
+			if k < 0 {
+				panic("negative k")
+			}
+			return 0, i * k
+		})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	ctx := context.Background()
+	testSession(t, func(t *testing.T, sess *Session) {
+		var wg sync.WaitGroup
+		errs := make([]error, N)
+		sums := make([]int, N)
+		for i := 0; i < N; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				k := i
+				if i%8 == 7 {
+					k = -1
+				}
+				res, err := sess.Run(ctx, sum, k)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				scan := res.Scanner()
+				defer scan.Close()
+				var key int
+				for scan.Scan(ctx, &key, &sums[i]) {
+				}
+				errs[i] = scan.Err()
+			}()
+		}
+		wg.Wait()
+		for i := 0; i < N; i++ {
+			if i%8 == 7 {
+				if errs[i] == nil {
+					t.Errorf("run %d: expected error", i)
+				}
+				continue
+			}
+			if errs[i] != nil {
+				t.Errorf("run %d: %v", i, errs[i])
+				continue
+			}
+			if got, want := sums[i], 4950*i; got != want {
+				t.Errorf("run %d: got %v, want %v", i, got, want)
+			}
+		}
+	})
+}
+
+func TestSessionMaxConcurrentRuns(t *testing.T) {
+	const (
+		N        = 16
+		MaxRuns  = 3
+		Parallel = 16
+	)
+	var running, maxRunning int32
+	fn := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, _ *int, out []int) (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return 0, sliceio.EOF
+		})
+	})
+	sess := Start(Local, Parallelism(Parallel), MaxConcurrentRuns(MaxRuns))
+	defer sess.Shutdown()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sess.Run(ctx, fn); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := atomic.LoadInt32(&maxRunning), int32(MaxRuns); got > want {
+		t.Errorf("got %v, want <= %v", got, want)
+	}
+	// Runs waiting for a slot respect their contexts.
+	startc, blockc := make(chan struct{}), make(chan struct{})
+	block := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(1, func(shard int, _ *int, out []int) (int, error) {
+			close(startc)
+			<-blockc
+			return 0, sliceio.EOF
+		})
+	})
+	sess = Start(Local, MaxConcurrentRuns(1))
+	defer sess.Shutdown()
+	go func() { _, _ = sess.Run(ctx, block) }()
+	<-startc
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := sess.Run(waitCtx, fn); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(blockc)
+}
+
+func TestDeterministic(t *testing.T) {
+	const (
+		N      = 1000
+		Nshard = 8
+	)
+	fn := bigslice.Func(func() bigslice.Slice {
+		keys := make([]int, N)
+		vals := rangeSlice(0, N)
+		slice := bigslice.Const(Nshard, keys, vals)
+		return bigslice.Reshuffle(slice)
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, Deterministic, MachineCombiners)
+			if sess.machineCombiners {
+				t.Error("machine combiners enabled in deterministic session")
+			}
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// All records have the same key, and thus are read by a single
+			// shard, in the order of their source shards.
+			f := readFrame(t, res, N)
+			if got, want := f.Interface(1).([]int), rangeSlice(0, N); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSessionWriteDOT(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	testSession(t, func(t *testing.T, sess *Session) {
+		ctx := context.Background()
+		res, err := sess.Run(ctx, fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := sess.WriteDOT(&b); err != nil {
+			t.Fatal(err)
+		}
+		dot := b.String()
+		if !strings.HasPrefix(dot, "digraph tasks {") {
+			t.Errorf("invalid DOT: %s", dot)
+		}
+		for _, task := range res.tasks {
+			for _, task := range task.All() {
+				if !strings.Contains(dot, "\""+task.Name.String()+"\" [") {
+					t.Errorf("task %s missing from DOT: %s", task.Name, dot)
+				}
+			}
+		}
+		if got, want := strings.Count(dot, "->"), 4*4; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestSessionGraph(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	testSession(t, func(t *testing.T, sess *Session) {
+		ctx := context.Background()
+		res, err := sess.Run(ctx, fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := res.Graph()
+		if got, want := g.Version, GraphVersion; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(g.Roots), 4; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if got, want := len(g.Tasks), 8; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for _, name := range g.Roots {
+			task, ok := g.Task(name)
+			if !ok {
+				t.Fatalf("root %s missing from graph", name)
+			}
+			if got, want := task.State, "OK"; got != want {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+			if got, want := task.Columns, []string{"int", "int"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+			if got, want := len(task.Deps), 1; got != want {
+				t.Fatalf("%s: got %v, want %v", name, got, want)
+			}
+			dep := task.Deps[0]
+			if got, want := dep.Partition, task.Shard; got != want {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+			if got, want := len(dep.Tasks), 4; got != want {
+				t.Fatalf("%s: got %v, want %v", name, got, want)
+			}
+			for _, depName := range dep.Tasks {
+				dep, ok := g.Task(depName)
+				if !ok {
+					t.Fatalf("dependency %s missing from graph", depName)
+				}
+				if got, want := dep.NumPartition, 4; got != want {
+					t.Errorf("%s: got %v, want %v", depName, got, want)
+				}
+				if !dep.Combiner {
+					t.Errorf("%s: expected combiner", depName)
+				}
+				if got, want := len(g.Dependents(depName)), 4; got != want {
+					t.Errorf("%s: got %v, want %v", depName, got, want)
+				}
+			}
+		}
+		if got, want := sess.Graph(), g; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		// Graphs are snapshots: they do not track subsequent changes to
+		// task state.
+		res.tasks[0].Set(TaskLost)
+		if task, _ := g.Task(g.Roots[0]); task.State != "OK" {
+			t.Errorf("graph changed after snapshot: %v", task.State)
+		}
+		if got, want := countState(res.Graph(), "LOST"), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		b, err := json.Marshal(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Graph
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&decoded, g) {
+			t.Errorf("got %v, want %v", decoded, g)
+		}
+	})
+}
+
+func TestSessionHandleDAG(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	sess := Start(Local)
+	defer sess.Shutdown()
+	ctx := context.Background()
+	if _, err := sess.Run(ctx, fn); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	sess.HandleDebug(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/dag/graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g Graph
+	err = json.NewDecoder(resp.Body).Decode(&g)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(g.Tasks), 8; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := countState(&g, "OK"), 8; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, task := range g.Tasks {
+		if got, want := len(task.Attempts), 1; got != want {
+			t.Fatalf("%s: got %v, want %v", task.Name, got, want)
+		}
+		attempt := task.Attempts[0]
+		if got, want := attempt.Machine, "local"; got != want {
+			t.Errorf("%s: got %v, want %v", task.Name, got, want)
+		}
+		if got, want := attempt.State, "OK"; got != want {
+			t.Errorf("%s: got %v, want %v", task.Name, got, want)
+		}
+		if attempt.End.Before(attempt.Start) {
+			t.Errorf("%s: invalid attempt times %v, %v", task.Name, attempt.Start, attempt.End)
+		}
+	}
+
+	resp, err = http.Get(srv.URL + "/debug/dag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(p)
+	if strings.Contains(page, "{{COLORS}}") {
+		t.Error("state colors missing from page")
+	}
+	if !strings.Contains(page, `"OK":"palegreen"`) {
+		t.Errorf("state colors missing from page: %s", page)
+	}
+
+	resp, err = http.Get(srv.URL + "/debug/timeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page := string(p); !strings.Contains(page, `"OK":"palegreen"`) || !strings.Contains(page, "/debug/dag/graph") {
+		t.Errorf("invalid timeline page: %s", page)
+	}
+}
+
+func countState(g *Graph, state string) int {
+	var n int
+	for _, task := range g.Tasks {
+		if task.State == state {
+			n++
+		}
+	}
+	return n
+}
+
 func testSession(t *testing.T, run func(t *testing.T, sess *Session)) {
 	t.Helper()
 	for name, opt := range executors {
@@ -412,3 +781,496 @@ func readFrame(t *testing.T, res *Result, n int) frame.Frame {
 	}
 	return f.Slice(0, n)
 }
+
+// localProcessesFunc is registered at package initialization, so that
+// it is also registered in the processes started by LocalProcesses,
+// which do not run the tests that register other funcs.
+var localProcessesFunc = bigslice.Func(func(mode string) bigslice.Slice {
+	slice := bigslice.Const(2, []int{1, 2, 3, 4})
+	return bigslice.Map(slice, func(i int) int {
+		switch mode {
+		case "panic":
+			panic("task panic")
+		case "oom":
+			var bufs [][]byte
+			for len(bufs) < 1<<20 {
+				buf := make([]byte, 64<<20)
+				buf[len(buf)-1] = 1
+				bufs = append(bufs, buf)
+			}
+			return len(bufs)
+		}
+		return i
+	})
+})
+
+// TestMain runs the test binary as a bigmachine worker when it is
+// started by bigmachine.Local, as it is by LocalProcesses.
+func TestMain(m *testing.M) {
+	if os.Getenv("BIGMACHINE_MODE") != "" {
+		bigmachine.Start(bigmachine.Local)
+		panic("not reached")
+	}
+	os.Exit(m.Run())
+}
+
+func TestLocalProcesses(t *testing.T) {
+	// Workers must register the same funcs as the driver, and so the
+	// driver cannot be this process, in which other tests have
+	// registered funcs. Instead, the test runs itself in a new process.
+	if os.Getenv("BIGSLICE_TEST_LOCAL_PROCESSES") == "" {
+		cmd := osexec.Command(os.Args[0], "-test.run=^TestLocalProcesses$")
+		cmd.Env = append(os.Environ(), "BIGSLICE_TEST_LOCAL_PROCESSES=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+	sess := Start(LocalProcesses(4<<30), Parallelism(2), MaxLoad(4))
+	defer sess.Shutdown()
+	ctx := context.Background()
+
+	_, err := sess.Run(ctx, localProcessesFunc, "panic")
+	if err == nil || !strings.Contains(err.Error(), "task panic") {
+		t.Fatalf("expected panic error, got %v", err)
+	}
+	// The task exhausts its process's memory, which crashes the
+	// process; the task is lost, and then fails.
+	_, err = sess.Run(ctx, localProcessesFunc, "oom", RunRetries(1))
+	if err == nil || !strings.Contains(err.Error(), "lost on 1 consecutive attempts") {
+		t.Fatalf("expected lost task error, got %v", err)
+	}
+	// The driver is unaffected, and runs tasks on new processes.
+	res, err := sess.Run(ctx, localProcessesFunc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := readFrame(t, res, 4)
+	sort.Sort(f)
+	if got, want := f.Interface(0).([]int), []int{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Each process runs one task at a time, regardless of MaxLoad.
+	x := sess.executor.(*bigmachineExecutor)
+	if got, want := x.manager(0).machprocs, 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSessionMetrics(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(2))
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	sess.HandleDebug(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	metrics := make(map[string]int64)
+	for _, line := range strings.Split(strings.TrimSpace(string(p)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		var (
+			name  string
+			value int64
+		)
+		if _, err := fmt.Sscan(line, &name, &value); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		metrics[name] = value
+	}
+	for name, want := range map[string]int64{
+		`bigslice_tasks{state="OK"}`:     8,
+		`bigslice_tasks{state="LOST"}`:   0,
+		"bigslice_task_attempts_total":   8,
+		"bigslice_task_retries_total":    0,
+		"bigslice_records_written_total": 8,
+		"bigslice_machines_lost_total":   0,
+	} {
+		if got, ok := metrics[name]; !ok || got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	for _, name := range []string{"bigslice_records_read_total", "bigslice_shuffle_bytes_total", "bigslice_machines", "bigslice_machines_started_total"} {
+		if metrics[name] <= 0 {
+			t.Errorf("%s: got %v, want > 0", name, metrics[name])
+		}
+	}
+}
+
+func TestSessionAggregationFanIn(t *testing.T) {
+	const (
+		N      = 1000
+		Nshard = 9
+	)
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(Nshard, rangeSlice(0, N))
+		slice = bigslice.Map(slice, func(i int) (int, int) { return i % 17, i })
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	want := make(map[int]int)
+	for i := 0; i < N; i++ {
+		want[i%17] += i
+	}
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, AggregationFanIn(2))
+			defer sess.Shutdown()
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// One partition of each of the 9 combiner tasks is aggregated
+			// by 5, 3, and then 2 tasks before it is read by its reducer.
+			if got, want := len(res.Graph().Tasks), 9+9*5+9*3+9*2+9; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			got := make(map[int]int)
+			scan := res.Scanner()
+			defer scan.Close()
+			var k, v int
+			for scan.Scan(ctx, &k, &v) {
+				if _, ok := got[k]; ok {
+					t.Errorf("duplicate key %d", k)
+				}
+				got[k] = v
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSessionSmallJoinRows(t *testing.T) {
+	const N = 1000
+	fn := bigslice.Func(func() bigslice.Slice {
+		large := bigslice.ReaderFunc(7, func(shard int, n *int, out []int) (int, error) {
+			beg, end := shardRange(N, 7, shard)
+			beg += *n
+			if beg >= end {
+				return 0, sliceio.EOF
+			}
+			m := copy(out, rangeSlice(beg, end))
+			*n += m
+			return m, nil
+		})
+		large = bigslice.Map(large, func(i int) (int, int) { return i % 100, i })
+		small := bigslice.Const(3, []int{1, 50, 500}, []string{"one", "fifty", "five hundred"})
+		small = bigslice.Filter(small, func(k int, _ string) bool { return k != 50 })
+		return bigslice.Cogroup(large, bigslice.Sized(small, 3))
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, SmallJoinRows(10))
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range res.Graph().Tasks {
+				if strings.Contains(task.Op, "const") {
+					t.Errorf("small dependency computed by task %s", task.Name)
+				}
+			}
+			got := make(map[int][]string)
+			scan := res.Scanner()
+			defer scan.Close()
+			var (
+				k    int
+				vals []int
+				strs []string
+			)
+			for scan.Scan(ctx, &k, &vals, &strs) {
+				if _, ok := got[k]; ok {
+					t.Errorf("duplicate key %d", k)
+				}
+				if k < 100 && len(vals) != N/100 {
+					t.Errorf("key %d: got %d values, want %d", k, len(vals), N/100)
+				}
+				got[k] = strs
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(got), 101; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			for k, want := range map[int][]string{1: {"one"}, 50: nil, 500: {"five hundred"}} {
+				if !reflect.DeepEqual(got[k], want) {
+					t.Errorf("key %d: got %v, want %v", k, got[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionShuffleFetchLimit(t *testing.T) {
+	const N = 1000
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(8, rangeSlice(0, N))
+		slice = bigslice.Map(slice, func(i int) (int, int) { return i % 10, i })
+		return bigslice.Cogroup(slice)
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			sess := Start(opt, ShuffleFetchLimit(1))
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scan := res.Scanner()
+			defer scan.Close()
+			var (
+				k, total int
+				vals     []int
+			)
+			for scan.Scan(ctx, &k, &vals) {
+				for _, v := range vals {
+					total += v
+				}
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := total, N*(N-1)/2; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSessionCombinerKeyDictionary(t *testing.T) {
+	const N = 10000
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(8, rangeSlice(0, N))
+		slice = bigslice.Map(slice, func(i int) (string, int) { return fmt.Sprint(i % 20), 1 })
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			// The dictionary holds only some of the keys.
+			sess := Start(opt, CombinerKeyDictionary(10))
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scan := res.Scanner()
+			defer scan.Close()
+			var (
+				key   string
+				count int
+				got   = make(map[string]int)
+			)
+			for scan.Scan(ctx, &key, &count) {
+				got[key] += count
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(got), 20; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			for key, count := range got {
+				if count != N/20 {
+					t.Errorf("key %s: got %v, want %v", key, count, N/20)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionSnapshots(t *testing.T) {
+	var (
+		resolved int32
+		fail     bool
+	)
+	resolve := func(ctx context.Context) (string, error) {
+		if fail {
+			return "", errors.New("unavailable")
+		}
+		atomic.AddInt32(&resolved, 1)
+		return "2019-10-01", nil
+	}
+	fn := bigslice.Func(func() bigslice.Slice {
+		events := bigslice.Snapshot(bigslice.Const(2, []int{1, 2, 3}), "warehouse", resolve)
+		dims := bigslice.Snapshot(bigslice.Const(1, []int{1, 2}), "warehouse", resolve)
+		return bigslice.Union(events, dims)
+	})
+	for name, opt := range executors {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&resolved, 0)
+			fail = false
+			sess := Start(opt)
+			ctx := context.Background()
+			res, err := sess.Run(ctx, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := res.Snapshots(), map[string]string{"warehouse": "2019-10-01"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			// The group's snapshot is resolved once, for both sources.
+			if got, want := atomic.LoadInt32(&resolved), int32(1); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			fail = true
+			if _, err := sess.Run(ctx, fn); err == nil || !strings.Contains(err.Error(), "unavailable") {
+				t.Errorf("expected resolution error, got %v", err)
+			}
+		})
+	}
+}
+
+// regionSystem is a test system whose machines are created in a
+// region.
+type regionSystem struct {
+	*testsystem.System
+	region string
+}
+
+func (s regionSystem) Region() string { return s.region }
+
+func TestSessionResidency(t *testing.T) {
+	eu := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Residency(bigslice.Const(2, []int{1, 2, 3}), "eu-west-1", "eu-central-1")
+	})
+	unconstrained := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Const(1, []int{1, 2})
+	})
+	reduce := bigslice.Func(func(r *Result) bigslice.Slice {
+		return bigslice.Map(r, func(i int) int { return i + 1 })
+	})
+	// The region of the instances on which the driver and the machines
+	// run.
+	var instance string
+	save := instanceRegion
+	defer func() { instanceRegion = save }()
+	instanceRegion = func() (string, error) {
+		if instance == "" {
+			return "", errors.New("no instance metadata")
+		}
+		return instance, nil
+	}
+	// Each session needs its own bigmachine system. The Local executor
+	// runs tasks on the driver's instance, whose region is that of the
+	// system.
+	for name, executor := range map[string]func(region string) Option{
+		"Local": func(region string) Option {
+			instance = region
+			return Local
+		},
+		"Bigmachine.Test": func(region string) Option {
+			return Bigmachine(regionSystem{testsystem.New(), region})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			// Sessions whose region cannot be determined refuse
+			// constrained invocations.
+			instance = ""
+			sess := Start(executor(""))
+			if _, err := sess.Run(ctx, eu); err == nil || !strings.Contains(err.Error(), "cannot be determined") {
+				t.Errorf("got %v, want undetermined region error", err)
+			}
+			res, err := sess.Run(ctx, unconstrained)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := res.Residency(); ok {
+				t.Error("unexpected attestation")
+			}
+			sess.Shutdown()
+
+			sess = Start(executor("us-west-2"))
+			if _, err := sess.Run(ctx, eu); err == nil || !strings.Contains(err.Error(), "created in region us-west-2") {
+				t.Errorf("got %v, want residency error", err)
+			}
+			sess.Shutdown()
+
+			instance = "eu-west-1"
+			sess = Start(executor("eu-west-1"))
+			defer sess.Shutdown()
+			res, err = sess.Run(ctx, eu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attestation, ok := res.Residency()
+			if !ok {
+				t.Fatal("missing attestation")
+			}
+			if got, want := attestation.Permitted, []string{"eu-central-1", "eu-west-1"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := attestation.Region, "eu-west-1"; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if len(attestation.Machines) == 0 {
+				t.Error("no machines attested")
+			}
+			for addr, region := range attestation.Machines {
+				if got, want := region, "eu-west-1"; got != want {
+					t.Errorf("%s: got %v, want %v", addr, got, want)
+				}
+			}
+			// Constraints are inherited from results, and intersected
+			// with those of funcs.
+			derived, err := sess.Run(ctx, reduce, res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := derived.Residency(); !ok {
+				t.Error("missing attestation")
+			}
+			if _, err := sess.Run(ctx, reduce.Residency("eu-central-1"), res); err == nil || !strings.Contains(err.Error(), "eu-west-1") {
+				t.Errorf("got %v, want residency error", err)
+			}
+			if _, err := sess.Run(ctx, reduce.Residency("us-west-2"), res); err == nil || !strings.Contains(err.Error(), "do not permit any region") {
+				t.Errorf("got %v, want residency error", err)
+			}
+		})
+	}
+}
+
+// TestSessionResidencyMachines tests that each machine that runs the
+// tasks of a constrained invocation must be in a permitted region, even
+// if the system is configured to create machines in one.
+func TestSessionResidencyMachines(t *testing.T) {
+	eu := bigslice.Func(func() bigslice.Slice {
+		return bigslice.Residency(bigslice.Const(2, []int{1, 2, 3}), "eu-west-1")
+	})
+	save := instanceRegion
+	defer func() { instanceRegion = save }()
+	instanceRegion = func() (string, error) { return "us-west-2", nil }
+	sess := Start(Bigmachine(regionSystem{testsystem.New(), "eu-west-1"}))
+	defer sess.Shutdown()
+	_, err := sess.Run(context.Background(), eu)
+	if err == nil || !strings.Contains(err.Error(), "is in region us-west-2") {
+		t.Errorf("got %v, want machine residency error", err)
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"container/heap"
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grailbio/base/backgroundcontext"
 	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/eventlog"
 	"github.com/grailbio/base/log"
 	"github.com/grailbio/base/status"
 	"github.com/grailbio/base/sync/once"
@@ -39,8 +42,31 @@ const (
 	machineOk machineHealth = iota
 	machineProbation
 	machineLost
+	// machineRetired indicates that the machine was stopped by the
+	// machineManager because it was no longer needed.
+	machineRetired
+	// machineDraining indicates that the machine is being decommissioned:
+	// it is assigned no new tasks, and is handed to the decommissioner
+	// once its running tasks have completed.
+	machineDraining
 )
 
+// autoscaleConfig parameterizes the elastic sizing of a machine pool.
+// See the Autoscale session option.
+type autoscaleConfig struct {
+	// minMachines and maxMachines bound the size of the pool. The pool
+	// is sized elastically only if maxMachines is nonzero.
+	minMachines, maxMachines int
+	// idleTimeout is the amount of time after which an idle machine may
+	// be retired from the pool; machines are never retired if it is zero.
+	idleTimeout time.Duration
+}
+
+// Enabled tells whether autoscaling is enabled.
+func (c autoscaleConfig) Enabled() bool {
+	return c.maxMachines > 0
+}
+
 // SliceMachine manages a single bigmachine.Machine instance.
 type sliceMachine struct {
 	*bigmachine.Machine
@@ -53,9 +79,20 @@ type sliceMachine struct {
 	// on the machine, so that they are run exactly once on the machine.
 	Commits once.Map
 
+	// plugins tracks the driver's plugins that have been loaded on the
+	// machine.
+	plugins pluginSync
+
 	Stats  *stats.Map
 	Status *status.Task
 
+	// Arch is the machine's architecture, in the form "GOOS/GOARCH".
+	Arch string
+
+	// Region is the region of the machine, as reported by its instance
+	// metadata, or empty if it is unknown. See bigslice.Residency.
+	Region string
+
 	// maxTaskProcs is the maximum number of procs on the machine to which tasks
 	// can be assigned. This can be different from Maxprocs, as it is attenuated
 	// by (*machineManager).Maxload.
@@ -65,12 +102,24 @@ type sliceMachine struct {
 	// assigned. taskProcs is managed by the machineManager.
 	taskProcs int
 
+	// maxTaskGPUs is the number of GPUs the machine advertises. It is zero
+	// for machines that are not part of a GPU profile.
+	maxTaskGPUs int
+
+	// taskGPUs is the current number of GPUs on the machine that have tasks
+	// assigned. taskGPUs is managed by the machineManager.
+	taskGPUs int
+
 	// health is managed by the machineManager.
 	health machineHealth
 
 	// lastFailure is managed by the machineManager.
 	lastFailure time.Time
 
+	// idleSince is the time at which the machine last became idle, i.e.,
+	// had no tasks assigned. It is managed by the machineManager.
+	idleSince time.Time
+
 	// index is the machine's index in the executor's priority queue.
 	index int
 
@@ -82,6 +131,10 @@ type sliceMachine struct {
 	// bigmachine.
 	lost bool
 
+	// Retired indicates whether the machine was deliberately stopped
+	// by Retire.
+	retired bool
+
 	// Tasks is the set of tasks that have been run on this machine.
 	// It is used to mark tasks lost when a machine fails.
 	tasks []*Task
@@ -101,14 +154,109 @@ func (s *sliceMachine) String() string {
 		health = "probation"
 	case machineLost:
 		health = "lost"
+	case machineRetired:
+		health = "retired"
+	case machineDraining:
+		health = "draining"
 	}
 	return fmt.Sprintf("%s (%s)", s.Addr, health)
 }
 
-// Done returns procs on the machine, and reports any error observed while
-// running tasks.
-func (s *sliceMachine) Done(procs int, err error) {
-	s.donec <- machineDone{s, procs, err}
+// Done returns procs and gpus on the machine, and reports any error observed
+// while running tasks.
+func (s *sliceMachine) Done(procs, gpus int, err error) {
+	s.donec <- machineDone{sliceMachine: s, procs: procs, gpus: gpus, Err: err}
+}
+
+// RunDone is like Done, but is used when a task was run to completion,
+// taking elapsed time. Task run times inform autoscaling decisions.
+func (s *sliceMachine) RunDone(procs, gpus int, elapsed time.Duration, err error) {
+	s.donec <- machineDone{sliceMachine: s, procs: procs, gpus: gpus, elapsed: elapsed, Err: err}
+}
+
+// Retire stops the machine if it does not hold the results of any
+// task that may still be needed, i.e., if all of its tasks have either
+// failed or been discarded. Retire reports whether the machine was
+// stopped.
+func (s *sliceMachine) Retire() bool {
+	s.mu.Lock()
+	for _, task := range s.tasks {
+		if state := task.State(); state != TaskErr && state != TaskLost {
+			s.mu.Unlock()
+			return false
+		}
+	}
+	s.lost = true
+	s.retired = true
+	s.tasks = nil
+	s.mu.Unlock()
+	s.Cancel()
+	return true
+}
+
+// Release stops a drained machine whose task outputs have been
+// replicated elsewhere. The outputs of its remaining tasks are
+// unavailable, and so these tasks are marked LOST.
+func (s *sliceMachine) Release() {
+	s.mu.Lock()
+	tasks := s.tasks
+	s.lost = true
+	s.retired = true
+	s.tasks = nil
+	s.mu.Unlock()
+	for _, task := range tasks {
+		task.Set(TaskLost)
+	}
+	s.Cancel()
+}
+
+// Unassign removes the provided task from this machine, so that it is
+// not marked LOST when the machine is stopped. It is used when the
+// task's output has been replicated to another machine.
+func (s *sliceMachine) Unassign(task *Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tasks {
+		if s.tasks[i] == task {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Evicted marks the named tasks, whose outputs were evicted from the
+// machine, as LOST, so that they are recomputed if they are needed
+// again.
+func (s *sliceMachine) Evicted(names []TaskName) {
+	if len(names) == 0 {
+		return
+	}
+	evicted := make(map[TaskName]bool)
+	for _, name := range names {
+		evicted[name] = true
+	}
+	var lost []*Task
+	s.mu.Lock()
+	tasks := s.tasks[:0]
+	for _, task := range s.tasks {
+		if evicted[task.Name] {
+			lost = append(lost, task)
+		} else {
+			tasks = append(tasks, task)
+		}
+	}
+	s.tasks = tasks
+	s.mu.Unlock()
+	for _, task := range lost {
+		task.Set(TaskLost)
+	}
+}
+
+// Tasks returns the tasks that have been run on this machine.
+func (s *sliceMachine) Tasks() []*Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Task(nil), s.tasks...)
 }
 
 // Assign assigns the provided task to this machine. If the machine
@@ -199,7 +347,11 @@ loop:
 	s.lost = true
 	tasks := s.tasks
 	s.tasks = nil
+	retired := s.retired
 	s.mu.Unlock()
+	if retired {
+		return
+	}
 	log.Error.Printf("lost machine %s: marking its %d tasks as LOST", s.Machine.Addr, len(tasks))
 	for _, task := range tasks {
 		task.Set(TaskLost)
@@ -214,6 +366,15 @@ func (s *sliceMachine) Lost() bool {
 	return lost
 }
 
+// Retired reports whether this machine was deliberately stopped, by
+// either Retire or Release.
+func (s *sliceMachine) Retired() bool {
+	s.mu.Lock()
+	retired := s.retired
+	s.mu.Unlock()
+	return retired
+}
+
 // UpdateStatus updates the machine's status.
 func (s *sliceMachine) UpdateStatus() {
 	s.mu.Lock()
@@ -227,12 +388,20 @@ func (s *sliceMachine) UpdateStatus() {
 		health = " (probation)"
 	case machineLost:
 		health = " (lost)"
+	case machineRetired:
+		health = " (retired)"
+	case machineDraining:
+		health = " (draining)"
+	}
+	var gpus string
+	if s.maxTaskGPUs > 0 {
+		gpus = fmt.Sprintf(" gpus %d/%d", s.taskGPUs, s.maxTaskGPUs)
 	}
-	s.Status.Printf("mem %s/%s disk %s/%s load %.1f/%.1f/%.1f counters %s%s",
+	s.Status.Printf("mem %s/%s disk %s/%s load %.1f/%.1f/%.1f%s counters %s%s",
 		data.Size(s.mem.System.Used), data.Size(s.mem.System.Total),
 		data.Size(s.disk.Usage.Used), data.Size(s.disk.Usage.Total),
 		s.load.Averages.Load1, s.load.Averages.Load5, s.load.Averages.Load15,
-		values, health,
+		gpus, values, health,
 	)
 }
 
@@ -322,7 +491,13 @@ type machineDone struct {
 	// procs is the number of procs to be returned to the pool available for
 	// task assignment on the machine.
 	procs int
-	Err   error
+	// gpus is the number of GPUs to be returned to the pool available for
+	// task assignment on the machine.
+	gpus int
+	// elapsed is the run time of the task, if the machine was returned
+	// after running a task to completion.
+	elapsed time.Duration
+	Err     error
 }
 
 // startResult is used to signal the result of attempts to start machines.
@@ -332,6 +507,32 @@ type startResult struct {
 	// nFailures is the number of machines that we attempted but failed to
 	// start.
 	nFailures int
+	// elapsed is the amount of time it took to start the machines.
+	elapsed time.Duration
+}
+
+// drainRequest is used to request that a machine be drained. See
+// machineManager.Drain.
+type drainRequest struct {
+	addr string
+	// wait indicates whether the reply should be deferred until the
+	// machine's running tasks have completed.
+	wait   bool
+	replyc chan drainResult
+}
+
+// drainResult is the result of a drainRequest.
+type drainResult struct {
+	// mach is the drained machine.
+	mach *sliceMachine
+	err  error
+}
+
+// offerEachRequest is used to request procs on each of a number of
+// distinct machines. See machineManager.OfferEach.
+type offerEachRequest struct {
+	procs, n int
+	replyc   chan []*sliceMachine
 }
 
 // MachineManager manages a cluster of sliceMachines, load balancing requests
@@ -344,12 +545,83 @@ type machineManager struct {
 	// machprocs is the number of procs each managed machine has available for
 	// tasks, taking into account max load.
 	machprocs int
-	worker    *worker
+	// machgpus is the number of GPUs each managed machine advertises. It is
+	// nonzero only for managers of GPU machine profiles.
+	machgpus int
+	// scale configures autoscaling of the managed pool. When enabled, it
+	// supersedes maxp.
+	scale autoscaleConfig
+	// budget, if non-nil, is shared with other managers, so that
+	// together they start no more than maxp procs.
+	budget *procBudget
+	worker *worker
+	// eventer receives events about managed machines, if non-nil.
+	eventer eventlog.Eventer
+	// counts counts the managed machines, if non-nil.
+	counts *machineCounts
+	// evict handles notices of the impending eviction of managed
+	// machines. Machines are not watched for evictions if it is nil.
+	evict func(*sliceMachine, evictionNotice)
 	// schedQ is the priority queue of scheduling requests, which determines the
 	// order in which requests are satisfied. See Offer.
 	schedQ   scheduleRequestQ
 	schedc   chan scheduleRequest
 	unschedc chan scheduleRequest
+	// drainc and undrainc are used to begin and abandon the draining of
+	// machines. See Drain.
+	drainc   chan drainRequest
+	undrainc chan *sliceMachine
+	// offereachc is used to request procs on distinct machines. See
+	// OfferEach.
+	offereachc chan offerEachRequest
+}
+
+// A procBudget accounts for the procs of the machines, running or
+// pending, of the machine managers that share it, so that together
+// they do not exceed their (common) maxp.
+type procBudget struct {
+	mu   sync.Mutex
+	held map[*machineManager]int
+}
+
+// newProcBudget returns a new, empty budget.
+func newProcBudget() *procBudget {
+	return &procBudget{held: make(map[*machineManager]int)}
+}
+
+// Hold records that manager m holds the provided number of procs.
+func (b *procBudget) Hold(m *machineManager, procs int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if procs == 0 {
+		delete(b.held, m)
+	} else {
+		b.held[m] = procs
+	}
+}
+
+// Grant returns the number of machines, of at most n, that manager m,
+// which holds the provided number of procs, may start within the
+// budget's limit, and holds their procs for m. A manager that holds no
+// procs may always start a machine, so that managers do not deadlock
+// when other managers hold the whole budget.
+func (b *procBudget) Grant(m *machineManager, held, n, limit int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	avail := limit - held
+	for other, procs := range b.held {
+		if other != m {
+			avail -= procs
+		}
+	}
+	if free := avail / m.machprocs; free < n {
+		n = max(free, 0)
+	}
+	if held == 0 && n == 0 {
+		n = 1
+	}
+	b.held[m] = held + n*m.machprocs
+	return n
 }
 
 // NewMachineManager returns a new machineManager paramterized by the
@@ -366,7 +638,8 @@ func newMachineManager(b *bigmachine.B, params []bigmachine.Param, group *status
 	// with internal parallelism, and the maxp should count towards
 	// that.
 	//
-	// TODO(marius): maxp is still applied on a per-manager basis. It
+	// TODO(marius): maxp is still applied on a per-manager basis, except
+	// among managers that share a procBudget. It
 	// should be shared across all managers, though this complicates
 	// matters because, without de-allocating machines from one cluster
 	// to another, or at least draining them and transferring them, we
@@ -387,18 +660,23 @@ func newMachineManager(b *bigmachine.B, params []bigmachine.Param, group *status
 		worker:    worker,
 		schedc:    make(chan scheduleRequest),
 		unschedc:  make(chan scheduleRequest),
+		drainc:    make(chan drainRequest),
+		undrainc:  make(chan *sliceMachine),
+
+		offereachc: make(chan offerEachRequest),
 	}
 }
 
-// Offer asks m to offer a machine on which to run work with the given priority
-// and number of procs. When m schedules the request, the machine is sent to the
+// Offer asks m to offer a machine on which to run work with the given priority,
+// number of procs, and number of GPUs. When m schedules the request, the machine is sent to the
 // returned channel. The second return value is a function that cancels the
 // request when called. If the request has already been serviced (i.e. a machine
 // has already been delivered), calling the cancel function is a no-op.
-func (m *machineManager) Offer(priority, procs int) (<-chan *sliceMachine, func()) {
+func (m *machineManager) Offer(priority, procs, gpus int) (<-chan *sliceMachine, func()) {
 	machc := make(chan *sliceMachine)
 	s := scheduleRequest{
 		procs:    procs,
+		gpus:     gpus,
 		priority: priority,
 		machc:    machc,
 	}
@@ -409,6 +687,53 @@ func (m *machineManager) Offer(priority, procs int) (<-chan *sliceMachine, func(
 	return machc, cancel
 }
 
+// OfferEach offers up to n distinct machines, each with the given
+// number of procs free, among the machines that are in service. Unlike
+// Offer, OfferEach neither waits for procs to become free nor starts
+// machines: it returns only the machines that have the procs
+// available, least loaded first, and may return none. The procs are
+// occupied on each returned machine until they are returned with
+// Done.
+func (m *machineManager) OfferEach(ctx context.Context, procs, n int) ([]*sliceMachine, error) {
+	req := offerEachRequest{procs, n, make(chan []*sliceMachine, 1)}
+	select {
+	case m.offereachc <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return <-req.replyc, nil
+}
+
+// Drain drains the managed machine with the provided address: no new
+// tasks are scheduled on the machine and, if wait is true, Drain
+// returns the machine once the tasks that are currently running on it
+// have completed. The machine is no longer counted toward the pool's
+// capacity, so a replacement may be started if there is demand for
+// it. Draining a machine that is already draining is permitted, e.g.,
+// to wait for its tasks after having drained it without waiting. The
+// caller must either Release the drained machine or return it to
+// service with Undrain. Drain returns an error if the machine is not
+// managed by m, or if it is lost while draining.
+func (m *machineManager) Drain(ctx context.Context, addr string, wait bool) (*sliceMachine, error) {
+	req := drainRequest{addr, wait, make(chan drainResult, 1)}
+	select {
+	case m.drainc <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case result := <-req.replyc:
+		return result.mach, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Undrain returns a drained (or draining) machine to service.
+func (m *machineManager) Undrain(mach *sliceMachine) {
+	m.undrainc <- mach
+}
+
 // Do starts machine management. The user typically calls this
 // asynchronously. Do services requests for machine capacity and
 // monitors machine health: stopped machines are considered lost and
@@ -418,20 +743,40 @@ func (m *machineManager) Offer(priority, procs int) (<-chan *sliceMachine, func(
 // needed (as indicated by client's calls to Need); thus when a
 // machine is lost, it may be replaced with another should it be
 // needed.
+//
+// If autoscaling is configured, the pool is kept within its bounds,
+// new machines are started only if the queued work cannot be
+// completed sooner by the existing machines, and machines that have
+// been idle for the configured timeout are retired.
 func (m *machineManager) Do(ctx context.Context) {
 	var (
 		need, pending  int
+		needGPUs       int
 		startc         = make(chan startResult)
 		stoppedc       = make(chan *sliceMachine)
 		donec          = make(chan machineDone)
 		machines       []*sliceMachine
 		probation      machineFailureQ
 		probationTimer timer
+		idleTimer      timer
 		// We track consecutive failures to start machines as a heuristic to
 		// decide that there might be a systematic problem preventing machines
 		// from starting.
 		consecutiveStartFailures int
+		// draining holds the machines that are being drained, along with
+		// the reply channels of the requests waiting for them to become
+		// idle.
+		draining = make(map[*sliceMachine][]chan drainResult)
+		// taskDuration and startDuration are moving averages of task run
+		// times and machine start times, respectively. They are used to
+		// make autoscaling decisions.
+		taskDuration, startDuration time.Duration
+		maxp, minp                  = m.maxp, 0
 	)
+	if m.scale.Enabled() {
+		maxp = m.scale.maxMachines * m.machprocs
+		minp = m.scale.minMachines * m.machprocs
+	}
 	for {
 		var (
 			mach  *sliceMachine
@@ -445,9 +790,15 @@ func (m *machineManager) Do(ctx context.Context) {
 		} else {
 			probationTimer.Set(probation[0].lastFailure.Add(ProbationTimeout))
 		}
+		if idle := m.idlest(machines, len(probation)); idle == nil {
+			idleTimer.Clear()
+		} else {
+			idleTimer.Set(idle.idleSince.Add(m.scale.idleTimeout))
+		}
 		select {
 		case machc <- mach:
 			mach.taskProcs += m.schedQ[0].procs
+			mach.taskGPUs += m.schedQ[0].gpus
 			heap.Pop(&m.schedQ)
 		case <-probationTimer.C():
 			mach := probation[0]
@@ -456,10 +807,40 @@ func (m *machineManager) Do(ctx context.Context) {
 			heap.Remove(&probation, 0)
 			machines = appendMachine(machines, mach)
 			probationTimer.Clear()
+		case <-idleTimer.C():
+			idleTimer.Clear()
+			mach := m.idlest(machines, len(probation))
+			if mach == nil || time.Since(mach.idleSince) < m.scale.idleTimeout {
+				break
+			}
+			if !mach.Retire() {
+				// The machine holds results that may yet be needed. We'll
+				// reconsider it after another timeout.
+				mach.idleSince = time.Now()
+				break
+			}
+			log.Printf("retiring idle machine %s", mach)
+			machines = removeMachine(machines, mach)
+			mach.health = machineRetired
 		case done := <-donec:
 			need -= done.procs
+			needGPUs -= done.gpus
 			mach := done.sliceMachine
 			mach.taskProcs -= done.procs
+			mach.taskGPUs -= done.gpus
+			if mach.taskProcs == 0 && mach.taskGPUs == 0 {
+				mach.idleSince = time.Now()
+				if replycs := draining[mach]; len(replycs) > 0 {
+					log.Printf("machine %s drained", mach)
+					for _, replyc := range replycs {
+						replyc <- drainResult{mach: mach}
+					}
+					draining[mach] = nil
+				}
+			}
+			if done.Err == nil && done.elapsed > 0 {
+				taskDuration = movingAverage(taskDuration, done.elapsed)
+			}
 			switch {
 			case done.Err != nil && !errors.Is(errors.Remote, done.Err) && mach.health == machineOk:
 				// We only consider probation if we have problems with RPC
@@ -480,7 +861,7 @@ func (m *machineManager) Do(ctx context.Context) {
 				mach.health = machineOk
 				heap.Remove(&probation, mach.index)
 				machines = appendMachine(machines, mach)
-			case mach.health == machineLost:
+			case mach.health == machineLost, mach.health == machineDraining:
 				// In this case, the machine has already been removed from the heap.
 			case mach.health == machineProbation:
 				log.Error.Printf("keeping machine %s on probation after error: %v", mach, done.Err)
@@ -491,26 +872,116 @@ func (m *machineManager) Do(ctx context.Context) {
 			default:
 				panic("invalid machine state")
 			}
+		case req := <-m.drainc:
+			var mach *sliceMachine
+			for _, ms := range [][]*sliceMachine{machines, probation} {
+				for _, candidate := range ms {
+					if candidate.Addr == req.addr {
+						mach = candidate
+					}
+				}
+			}
+			for candidate := range draining {
+				if candidate.Addr == req.addr {
+					mach = candidate
+				}
+			}
+			if mach == nil {
+				req.replyc <- drainResult{err: errors.E(errors.NotExist, "machine ", req.addr)}
+				break
+			}
+			switch mach.health {
+			case machineProbation:
+				heap.Remove(&probation, mach.index)
+			case machineOk:
+				machines = removeMachine(machines, mach)
+			}
+			if mach.health != machineDraining {
+				log.Printf("draining machine %s", mach)
+				mach.health = machineDraining
+				mach.UpdateStatus()
+				draining[mach] = nil
+			}
+			if !req.wait || mach.taskProcs == 0 && mach.taskGPUs == 0 {
+				req.replyc <- drainResult{mach: mach}
+			} else {
+				draining[mach] = append(draining[mach], req.replyc)
+			}
+		case mach := <-m.undrainc:
+			if mach.health != machineDraining {
+				break
+			}
+			for _, replyc := range draining[mach] {
+				replyc <- drainResult{err: errors.E(errors.Canceled, "drain of machine ", mach.Addr, " abandoned")}
+			}
+			delete(draining, mach)
+			log.Printf("returning machine %s to service", mach)
+			mach.health = machineOk
+			mach.UpdateStatus()
+			machines = appendMachine(machines, mach)
+		case req := <-m.offereachc:
+			var offered []*sliceMachine
+			for _, mach := range machines {
+				if mach.maxTaskProcs-mach.taskProcs >= req.procs {
+					offered = append(offered, mach)
+				}
+			}
+			sort.SliceStable(offered, func(i, j int) bool {
+				return offered[i].taskProcs < offered[j].taskProcs
+			})
+			if len(offered) > req.n {
+				offered = offered[:req.n]
+			}
+			for _, mach := range offered {
+				mach.taskProcs += req.procs
+				need += req.procs
+			}
+			req.replyc <- offered
 		case s := <-m.schedc:
 			heap.Push(&m.schedQ, s)
 			need += s.procs
+			needGPUs += s.gpus
 		case s := <-m.unschedc:
-			if s.index < 0 {
-				// The scheduling request is no longer queued, which means
-				// scheduling request has already been serviced.
-				break
+			// The canceled request is a copy, so we find it in the queue by
+			// its channel. If it is no longer queued, it has already been
+			// serviced.
+			for i := range m.schedQ {
+				if m.schedQ[i].machc == s.machc {
+					need -= s.procs
+					needGPUs -= s.gpus
+					heap.Remove(&m.schedQ, i)
+					break
+				}
 			}
-			need -= s.procs
-			heap.Remove(&m.schedQ, s.index)
 		case result := <-startc:
 			pending -= m.machprocs * (len(result.machines) + result.nFailures)
+			if m.counts != nil {
+				atomic.AddInt64(&m.counts.started, int64(len(result.machines)))
+				atomic.AddInt64(&m.counts.startFailures, int64(result.nFailures))
+			}
+			if len(result.machines) > 0 {
+				startDuration = movingAverage(startDuration, result.elapsed)
+			}
 			for _, mach := range result.machines {
+				if m.eventer != nil {
+					m.eventer.Event("bigslice:machineStart",
+						"addr", mach.Addr,
+						"arch", mach.Arch)
+				}
 				machines = appendMachine(machines, mach)
+				mach.maxTaskGPUs = m.machgpus
+				mach.idleSince = time.Now()
 				mach.donec = donec
 				go func(mach *sliceMachine) {
 					<-mach.Wait(bigmachine.Stopped)
 					stoppedc <- mach
 				}(mach)
+				if m.evict != nil {
+					go m.watchEviction(ctx, mach)
+				}
+				if m.worker.OrphanTimeout > 0 {
+					go m.sendHeartbeats(ctx, mach)
+				}
 			}
 			if len(result.machines) > 0 {
 				consecutiveStartFailures = 0
@@ -521,6 +992,21 @@ func (m *machineManager) Do(ctx context.Context) {
 				}
 			}
 		case mach := <-stoppedc:
+			for _, replyc := range draining[mach] {
+				replyc <- drainResult{err: errors.E(errors.Unavailable, "machine ", mach.Addr, " stopped while draining")}
+			}
+			delete(draining, mach)
+			if mach.health == machineDraining && mach.Retired() {
+				// The machine was released after it was drained.
+				mach.health = machineRetired
+			}
+			if mach.health == machineRetired {
+				if m.counts != nil {
+					atomic.AddInt64(&m.counts.retired, 1)
+				}
+				mach.Status.Done()
+				break
+			}
 			// Remove the machine from management. We let the sliceMachine
 			// instance deal with failing the tasks.
 			log.Error.Printf("machine %s stopped with error %s", mach, mach.Err())
@@ -531,33 +1017,111 @@ func (m *machineManager) Do(ctx context.Context) {
 				heap.Remove(&probation, mach.index)
 			}
 			mach.health = machineLost
+			if m.counts != nil {
+				atomic.AddInt64(&m.counts.lost, 1)
+			}
 			mach.Status.Done()
 		case <-ctx.Done():
+			if m.budget != nil {
+				m.budget.Hold(m, 0)
+			}
 			return
 		}
 
-		// TODO(marius): consider scaling down when we don't need as many
-		// resources any more; his would involve moving results to other
-		// machines or to another storage medium.
-		if have := (len(machines) + len(probation)) * m.machprocs; have+pending < need && have+pending < m.maxp {
+		// TODO(marius): consider scaling down machines that hold results
+		// that are still needed; this would involve moving results to
+		// other machines or to another storage medium.
+		demand := need
+		if m.machgpus > 0 {
+			// GPU machines may run out of GPUs before they run out of
+			// procs, so we express GPU demand in terms of the procs of the
+			// machines needed to satisfy it.
+			demand = max(demand, (needGPUs+m.machgpus-1)/m.machgpus*m.machprocs)
+		}
+		have := (len(machines) + len(probation)) * m.machprocs
+		if m.budget != nil {
+			m.budget.Hold(m, have+pending)
+		}
+		if m.scale.Enabled() && !worthScaling(demand-have-pending, have, taskDuration, startDuration) {
+			demand = have + pending
+		}
+		demand = max(demand, minp)
+		if have+pending < demand && have+pending < maxp {
 			var (
-				needProcs    = min(need, m.maxp) - have - pending
+				needProcs    = min(demand, maxp) - have - pending
 				needMachines = min((needProcs+m.machprocs-1)/m.machprocs, maxStartMachines)
 			)
+			if m.budget != nil {
+				needMachines = m.budget.Grant(m, have+pending, needMachines, maxp)
+				if needMachines == 0 {
+					continue
+				}
+			}
 			pending += needMachines * m.machprocs
 			log.Printf("slicemachine: %d machines (%d procs); %d machines pending (%d procs)",
 				have/m.machprocs, have, pending/m.machprocs, pending)
 			go func() {
+				start := time.Now()
 				machines := startMachines(ctx, m.b, m.group, m.machprocs, needMachines, m.worker, m.params...)
 				startc <- startResult{
 					machines:  machines,
 					nFailures: needMachines - len(machines),
+					elapsed:   time.Since(start),
 				}
 			}()
 		}
 	}
 }
 
+// idlest returns the machine in machines that has been idle the longest,
+// if it is eligible for retirement. Nprobation is the number of
+// machines on probation, which count towards the pool's minimum size.
+func (m *machineManager) idlest(machines []*sliceMachine, nprobation int) *sliceMachine {
+	if !m.scale.Enabled() || m.scale.idleTimeout == 0 || len(machines)+nprobation <= m.scale.minMachines {
+		return nil
+	}
+	var idlest *sliceMachine
+	for _, mach := range machines {
+		if mach.taskProcs > 0 || mach.taskGPUs > 0 {
+			continue
+		}
+		if idlest == nil || mach.idleSince.Before(idlest.idleSince) {
+			idlest = mach
+		}
+	}
+	return idlest
+}
+
+// worthScaling tells whether it is worth starting new machines to
+// accommodate excess procs of demand beyond the have procs that are
+// available or pending, given the average task run time and the average
+// machine start time. It is not worth it if the existing machines are
+// expected to work through the excess before new machines could be
+// started. Zero averages indicate that no observations have been made
+// yet, in which case we always scale.
+func worthScaling(excess, have int, taskDuration, startDuration time.Duration) bool {
+	if excess <= 0 {
+		return false
+	}
+	if have == 0 || taskDuration == 0 || startDuration == 0 {
+		return true
+	}
+	// Each round of tasks on the existing machines takes roughly
+	// taskDuration to complete.
+	rounds := float64(excess) / float64(have)
+	return time.Duration(rounds*float64(taskDuration)) > startDuration
+}
+
+// movingAverage returns the exponentially weighted moving average avg
+// updated with observation x. A zero avg indicates no prior
+// observations.
+func movingAverage(avg, x time.Duration) time.Duration {
+	if avg == 0 {
+		return x
+	}
+	return avg + (x-avg)/5
+}
+
 // schedule attempts to schedule s on a machine in machines, returning the
 // machine and the channel on which to send the machine. If no machine can
 // satisfy the request, it returns (nil, nil).
@@ -566,7 +1130,8 @@ func schedule(s scheduleRequest, machines []*sliceMachine) (*sliceMachine, chan<
 	// priority, so this implements a first fit decreasing scheduling strategy.
 	for _, m := range machines {
 		freeProcs := m.maxTaskProcs - m.taskProcs
-		if s.procs <= freeProcs {
+		freeGPUs := m.maxTaskGPUs - m.taskGPUs
+		if s.procs <= freeProcs && s.gpus <= freeGPUs {
 			return m, s.machc
 		}
 	}
@@ -613,6 +1178,16 @@ func startMachines(ctx context.Context, b *bigmachine.B, group *status.Group, ma
 				status.Done()
 				return
 			}
+			// Plugins are loaded first, so that the machine's Funcs may be
+			// compared with those of the driver.
+			var plugins pluginSync
+			if err := plugins.Sync(ctx, m, &processPlugins); err != nil {
+				log.Error.Printf("machine %s failed to load plugins: %v", m.Addr, err)
+				status.Printf("failed to load plugins")
+				status.Done()
+				m.Cancel()
+				return
+			}
 			var workerFuncLocs []string
 			if err := m.RetryCall(ctx, "Worker.FuncLocations", struct{}{}, &workerFuncLocs); err != nil {
 				status.Printf("failed to verify funcs")
@@ -627,14 +1202,34 @@ func startMachines(ctx context.Context, b *bigmachine.B, group *status.Group, ma
 				}
 				log.Panicf("machine %s has different funcs; check for local or non-deterministic Func creation", m.Addr)
 			}
-			status.Title(m.Addr)
+			var info bigmachine.Info
+			if err := m.RetryCall(ctx, "Supervisor.Info", struct{}{}, &info); err != nil {
+				status.Printf("failed to get machine info")
+				status.Done()
+				m.Cancel()
+				return
+			}
+			arch := info.Goos + "/" + info.Goarch
+			// The region of the machine is determined only if that of the
+			// system is; otherwise no invocation with residency
+			// constraints may run on it.
+			var region string
+			if worker.regions {
+				if err := m.RetryCall(ctx, "Worker.Region", struct{}{}, &region); err != nil {
+					log.Error.Printf("machine %s: failed to determine region: %v", m.Addr, err)
+				}
+			}
+			status.Titlef("%s %s", m.Addr, arch)
 			status.Print("running")
-			log.Printf("machine %v is ready", m.Addr)
+			log.Printf("machine %v (%s) is ready", m.Addr, arch)
 			sm := &sliceMachine{
 				Machine:      m,
 				Stats:        stats.NewMap(),
 				Status:       status,
+				Arch:         arch,
+				Region:       region,
 				maxTaskProcs: maxTaskProcs,
+				plugins:      pluginSync{n: plugins.n},
 			}
 			// TODO(marius): pass a context that's tied to the evaluation
 			// lifetime, or lifetime of the machine.
@@ -660,6 +1255,8 @@ type scheduleRequest struct {
 	priority int
 	// procs is the number of procs being requested.
 	procs int
+	// gpus is the number of GPUs being requested.
+	gpus  int
 	machc chan *sliceMachine
 	// index is the index of this request in the request heap.
 	index int
@@ -708,3 +1305,10 @@ func min(x, y int) int {
 	}
 	return y
 }
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -95,12 +96,12 @@ func TestSlicemachineProbation(t *testing.T) {
 	if got, want := system.N(), 2; got != want {
 		t.Errorf("got %v, want %v", got, want)
 	}
-	ms[0].Done(1, errors.New("some error"))
+	ms[0].Done(1, 0, errors.New("some error"))
 	mustUnavailable(t, mgr)
 	if got, want := ms[0].health, machineProbation; got != want {
 		t.Errorf("got %v, want %v", got, want)
 	}
-	ms[1].Done(1, nil)
+	ms[1].Done(1, 0, nil)
 	ns := getMachines(ctx, mgr, 2)
 	if got, want := ns[0], ms[0]; got != want {
 		t.Errorf("got %v, want %v", got, want)
@@ -136,12 +137,12 @@ func TestSlicemachineProbationTimeout(t *testing.T) {
 		if i%machinep != 0 {
 			continue
 		}
-		ms[i].Done(1, errors.New("some error"))
+		ms[i].Done(1, 0, errors.New("some error"))
 	}
 	// Bring two machines back from probation with successful completions to
 	// make sure there's no surprising interaction with timeouts.
-	ms[0*machinep].Done(1, nil)
-	ms[2*machinep].Done(1, nil)
+	ms[0*machinep].Done(1, 0, nil)
+	ms[2*machinep].Done(1, 0, nil)
 	ctx, ctxcancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer ctxcancel()
 	for {
@@ -205,7 +206,7 @@ func TestSlicemachinePriority(t *testing.T) {
 	for i := (maxp * 4) - 1; i >= 0; i-- {
 		i := i
 		go func() {
-			offerc, _ := mgr.Offer(i, 1)
+			offerc, _ := mgr.Offer(i, 1, 0)
 			sema <- struct{}{}
 			select {
 			case <-offerc:
@@ -220,7 +221,7 @@ func TestSlicemachinePriority(t *testing.T) {
 	// Return the original machines/procs to allow the machines to be offered to
 	// our blocked requests.
 	for _, m := range ms {
-		m.Done(1, nil)
+		m.Done(1, 0, nil)
 	}
 	for j := 0; j < maxp; j++ {
 		i := <-c
@@ -230,7 +231,209 @@ func TestSlicemachinePriority(t *testing.T) {
 	}
 }
 
+func TestSlicemachineOfferCancel(t *testing.T) {
+	_, _, mgr, cancel := startTestSystem(1, 1, 1.0)
+	defer cancel()
+
+	ms := getMachines(context.Background(), mgr, 1)
+	offerc, _ := mgr.Offer(0, 1, 0)
+	_, cancelOffer := mgr.Offer(1, 1, 0)
+	// Canceling an offer that is queued behind another leaves the other
+	// in the queue.
+	cancelOffer()
+	ms[0].Done(1, 0, nil)
+	select {
+	case m := <-offerc:
+		m.Done(1, 0, nil)
+	case <-time.After(10 * time.Second):
+		t.Fatal("queued offer was not serviced")
+	}
+}
+
+func TestSlicemachineAutoscaleBounds(t *testing.T) {
+	system, _, mgr, cancel := startAutoscaleTestSystem(1, autoscaleConfig{minMachines: 3, maxMachines: 4})
+	defer cancel()
+	ctx := context.Background()
+	getMachines(ctx, mgr, 1)
+	// The pool is grown to its minimum size even though only one proc
+	// is needed.
+	if got, want := system.Wait(3), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	getMachines(ctx, mgr, 3)
+	mustUnavailable(t, mgr)
+	if got, want := system.N(), 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSlicemachineAutoscaleRetire(t *testing.T) {
+	const idleTimeout = 100 * time.Millisecond
+	_, _, mgr, cancel := startAutoscaleTestSystem(1, autoscaleConfig{
+		minMachines: 1,
+		maxMachines: 3,
+		idleTimeout: idleTimeout,
+	})
+	defer cancel()
+	ctx := context.Background()
+	ms := getMachines(ctx, mgr, 3)
+	// The first machine holds a result that may still be needed, and
+	// so cannot be retired.
+	task := &Task{}
+	task.Set(TaskOk)
+	ms[0].Assign(task)
+	for _, m := range ms {
+		m.Done(1, 0, nil)
+	}
+	for _, m := range ms[1:] {
+		select {
+		case <-m.Wait(bigmachine.Stopped):
+		case <-time.After(10 * time.Second):
+			t.Fatal("idle machine was not retired")
+		}
+	}
+	if got, want := ms[0].State(), bigmachine.Running; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Once the result is discarded, the machine could be retired, but
+	// the pool is at its minimum size.
+	task.Set(TaskLost)
+	time.Sleep(5 * idleTimeout)
+	if got, want := ms[0].State(), bigmachine.Running; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSlicemachineDrain(t *testing.T) {
+	system, _, mgr, cancel := startTestSystem(2, 2, 1.0)
+	defer cancel()
+
+	ctx := context.Background()
+	ms := getMachines(ctx, mgr, 2)
+	if _, err := mgr.Drain(ctx, "nonexistent:1234", true); err == nil {
+		t.Error("expected error")
+	}
+	type result struct {
+		mach *sliceMachine
+		err  error
+	}
+	drainc := make(chan result)
+	go func() {
+		mach, err := mgr.Drain(ctx, ms[0].Addr, true)
+		drainc <- result{mach, err}
+	}()
+	// The draining machine no longer counts toward the pool's capacity,
+	// so a replacement is started.
+	system.Wait(2)
+	// The machine is drained only once all of its tasks are done. In the
+	// meantime, new work is scheduled on the replacement.
+	ms[0].Done(1, 0, nil)
+	replacement := getMachines(ctx, mgr, 1)[0]
+	if replacement == ms[0] {
+		t.Error("work scheduled on draining machine")
+	}
+	select {
+	case <-drainc:
+		t.Fatal("machine drained with running tasks")
+	case <-time.After(100 * time.Millisecond):
+	}
+	ms[1].Done(1, 0, nil)
+	r := <-drainc
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if got, want := r.mach, ms[0]; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Once returned to service, the machine is again schedulable.
+	mgr.Undrain(r.mach)
+	ns := getMachines(ctx, mgr, 3)
+	if got, want := ns[0], replacement; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, n := range ns[1:] {
+		if got, want := n, ms[0]; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSlicemachineOfferEach(t *testing.T) {
+	_, _, mgr, cancel := startTestSystem(2, 4, 1.0)
+	defer cancel()
+
+	ctx := context.Background()
+	ms := getMachines(ctx, mgr, 3)
+	if ms[0] != ms[1] || ms[0] == ms[2] {
+		t.Fatalf("unexpected placement %v", ms)
+	}
+	// Only machines with free procs are offered.
+	offered, err := mgr.OfferEach(ctx, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offered, ms[2:]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	offered, err = mgr.OfferEach(ctx, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(offered), 0; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, m := range append(ms, ms[2]) {
+		m.Done(1, 0, nil)
+	}
+	// Each machine is offered at most once.
+	offered, err = mgr.OfferEach(ctx, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(offered), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if offered[0] == offered[1] {
+		t.Errorf("machine %v offered twice", offered[0])
+	}
+	offered, err = mgr.OfferEach(ctx, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(offered), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWorthScaling(t *testing.T) {
+	for _, c := range []struct {
+		excess, have                int
+		taskDuration, startDuration time.Duration
+		want                        bool
+	}{
+		{0, 10, time.Minute, time.Minute, false},
+		{10, 0, time.Minute, time.Minute, true},
+		{10, 10, 0, time.Minute, true},
+		{10, 10, time.Second, time.Minute, false},
+		{10, 10, time.Hour, time.Minute, true},
+		{1000, 10, time.Second, time.Minute, true},
+	} {
+		if got := worthScaling(c.excess, c.have, c.taskDuration, c.startDuration); got != c.want {
+			t.Errorf("worthScaling(%d, %d, %s, %s): got %v, want %v",
+				c.excess, c.have, c.taskDuration, c.startDuration, got, c.want)
+		}
+	}
+}
+
 func startTestSystem(machinep, maxp int, maxLoad float64) (system *testsystem.System, b *bigmachine.B, m *machineManager, cancel func()) {
+	return startScaleTestSystem(machinep, maxp, maxLoad, autoscaleConfig{})
+}
+
+func startAutoscaleTestSystem(machinep int, scale autoscaleConfig) (system *testsystem.System, b *bigmachine.B, m *machineManager, cancel func()) {
+	return startScaleTestSystem(machinep, 0, 1.0, scale)
+}
+
+func startScaleTestSystem(machinep, maxp int, maxLoad float64, scale autoscaleConfig) (system *testsystem.System, b *bigmachine.B, m *machineManager, cancel func()) {
 	system = testsystem.New()
 	system.Machineprocs = machinep
 	// Customize timeouts so that tests run faster.
@@ -240,6 +443,7 @@ func startTestSystem(machinep, maxp int, maxLoad float64) (system *testsystem.Sy
 	b = bigmachine.Start(system)
 	ctx, ctxcancel := context.WithCancel(context.Background())
 	m = newMachineManager(b, nil, nil, maxp, maxLoad, &worker{MachineCombiners: false})
+	m.scale = scale
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -257,7 +461,7 @@ func startTestSystem(machinep, maxp int, maxLoad float64) (system *testsystem.Sy
 func getMachines(ctx context.Context, mgr *machineManager, n int) []*sliceMachine {
 	ms := make([]*sliceMachine, n)
 	for i := range ms {
-		offerc, _ := mgr.Offer(0, 1)
+		offerc, _ := mgr.Offer(0, 1, 0)
 		ms[i] = <-offerc
 	}
 	return ms
@@ -268,7 +472,7 @@ func mustUnavailable(t *testing.T, mgr *machineManager) {
 	t.Helper()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
 	defer cancel()
-	offerc, cancel := mgr.Offer(0, 1)
+	offerc, cancel := mgr.Offer(0, 1, 0)
 	select {
 	case <-offerc:
 		t.Fatal("unexpected machine available")
@@ -276,3 +480,30 @@ func mustUnavailable(t *testing.T, mgr *machineManager) {
 		cancel()
 	}
 }
+
+func TestProcBudget(t *testing.T) {
+	var (
+		b      = newProcBudget()
+		m1, m2 = &machineManager{machprocs: 4}, &machineManager{machprocs: 4}
+	)
+	if got, want := b.Grant(m1, 0, 3, 16), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := b.Grant(m2, 0, 3, 16), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := b.Grant(m2, 4, 1, 16), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// A manager that holds no procs may always start a machine.
+	b.Hold(m2, 0)
+	b.Grant(m1, 12, 1, 16)
+	if got, want := b.Grant(m2, 0, 2, 16), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Procs that are released are available to other managers.
+	b.Hold(m1, 0)
+	if got, want := b.Grant(m2, 4, 5, 16), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
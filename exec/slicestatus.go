@@ -6,11 +6,20 @@ package exec
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/grailbio/base/status"
 	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/metrics"
 )
 
+// metricsDisplayInterval is the period at which the display of user
+// metrics is updated.
+const metricsDisplayInterval = 5 * time.Second
+
 // sliceStatus is the information directly used to print a slice's status (in a
 // *status.Task).
 type sliceStatus struct {
@@ -155,3 +164,55 @@ func monitorSliceStatus(ctx context.Context, tasks []*Task, group *status.Group,
 		}
 	}
 }
+
+// maintainMetrics maintains a status.Task in group that displays the
+// values of the named metrics of the provided task graph, aggregated
+// over its tasks. The task is started once there are values to
+// display. It returns when ctx is done, after a final update.
+func maintainMetrics(ctx context.Context, tasks []*Task, group *status.Group) {
+	var statusTask *status.Task
+	update := func() {
+		var scope metrics.Scope
+		_ = iterTasks(tasks, func(task *Task) error {
+			scope.Merge(&task.Scope)
+			return nil
+		})
+		named := scope.Named()
+		if len(named) == 0 {
+			return
+		}
+		if statusTask == nil {
+			statusTask = group.Start("metrics")
+		}
+		statusTask.Print(formatMetrics(named))
+	}
+	ticker := time.NewTicker(metricsDisplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			update()
+		case <-ctx.Done():
+			update()
+			if statusTask != nil {
+				statusTask.Done()
+			}
+			return
+		}
+	}
+}
+
+// formatMetrics formats the provided named metric values, ordered by
+// name.
+func formatMetrics(named map[string]interface{}) string {
+	keys := make([]string, 0, len(named))
+	for name := range named {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, name := range keys {
+		values[i] = fmt.Sprintf("%s: %v", name, named[name])
+	}
+	return strings.Join(values, ", ")
+}
@@ -7,10 +7,13 @@ package exec
 import (
 	"context"
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/grailbio/base/status"
+	"github.com/grailbio/bigmachine/testsystem"
 	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/metrics"
 )
 
 // sample returns a slice of task sets randomly chosen from tasks, without
@@ -179,3 +182,46 @@ func TestMonitorSliceStatus(t *testing.T) {
 		}
 	}
 }
+
+var (
+	testRecords = metrics.NewNamedCounter("test.exec.records")
+	testValues  = metrics.NewHistogram("test.exec.values", 10, 100)
+)
+
+func TestMaintainMetrics(t *testing.T) {
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, 100))
+		return bigslice.Map(slice, func(ctx context.Context, i int) int {
+			scope := metrics.ContextScope(ctx)
+			testRecords.Incr(scope, 1)
+			testValues.Observe(scope, float64(i))
+			return i
+		})
+	})
+	var s status.Status
+	sess := Start(Bigmachine(testsystem.New()), Status(&s))
+	defer sess.Shutdown()
+	res, err := sess.Run(context.Background(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := res.Scope().Named()
+	if got, want := named["test.exec.records"], int64(100); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := named["test.exec.values"].(metrics.HistogramValue).Counts, []int64{11, 89, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	group := s.Group("test")
+	maintainMetrics(ctx, res.tasks, group)
+	tasks := group.Tasks()
+	if got, want := len(tasks), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := tasks[0].Value().Status, "test.exec.records: 100, test.exec.values: n=100 mean=49.5 p50<=100 p99<=100"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
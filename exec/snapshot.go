@@ -0,0 +1,71 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// resolveSnapshots resolves the snapshot of each snapshot group that
+// is read by the provided slice, which is computed by the invocation
+// inv, and records them in the invocation's compilation environment.
+// The snapshot of each group is resolved once, by the first
+// Snapshotter of the group that is found. Slices computed by previous
+// invocations (i.e., *Results) retain the snapshots at which they
+// were computed.
+func resolveSnapshots(ctx context.Context, inv *execInvocation, slice bigslice.Slice) error {
+	visited := make(map[bigslice.Slice]bool)
+	var walk func(bigslice.Slice) error
+	walk = func(slice bigslice.Slice) error {
+		if visited[slice] {
+			return nil
+		}
+		visited[slice] = true
+		if _, ok := bigslice.Unwrap(slice).(*Result); ok {
+			return nil
+		}
+		if s, ok := slice.(bigslice.Snapshotter); ok {
+			group := s.SnapshotGroup()
+			if _, ok := inv.Env.Snapshots[group]; !ok {
+				snapshot, err := s.ResolveSnapshot(ctx)
+				if err != nil {
+					return fmt.Errorf("resolving snapshot of group %s: %v", group, err)
+				}
+				inv.Env.Snapshots[group] = snapshot
+			}
+		}
+		for i := 0; i < slice.NumDep(); i++ {
+			if err := walk(slice.Dep(i).Slice); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(slice)
+}
+
+// snapshotReaderFunc returns a reader func that wraps the readers
+// returned by the provided reader func, so that they, and the readers
+// of the dependencies that they read, are passed contexts that carry
+// the provided snapshot of the named group.
+func snapshotReaderFunc(reader func(int, []sliceio.Reader) sliceio.Reader, group, snapshot string) func(int, []sliceio.Reader) sliceio.Reader {
+	return func(shard int, deps []sliceio.Reader) sliceio.Reader {
+		return &snapshotReader{reader(shard, deps), group, snapshot}
+	}
+}
+
+type snapshotReader struct {
+	sliceio.Reader
+	group, snapshot string
+}
+
+func (r *snapshotReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	return r.Reader.Read(bigslice.WithSnapshot(ctx, r.group, r.snapshot), out)
+}
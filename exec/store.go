@@ -89,6 +89,15 @@ func (m *memoryStore) get(task TaskName, partition int) ([]byte, int64) {
 	return m.tasks[task][partition], m.counts[task][partition]
 }
 
+// contains returns whether the store holds, or has held, outputs of
+// the named task.
+func (m *memoryStore) contains(task TaskName) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.tasks[task]
+	return ok
+}
+
 func (m *memoryStore) put(task TaskName, partition int, p []byte, count int64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -0,0 +1,210 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/grailbio/base/data"
+	"github.com/grailbio/base/log"
+)
+
+// maxSummaryErrors is the maximum number of errors reported in a
+// summary.
+const maxSummaryErrors = 20
+
+// A Summary is a snapshot of the state of a session, suitable for
+// rendering by tools that monitor running jobs (e.g., "bigslice
+// status"). Summaries are served as JSON by the session's debug
+// handler at /debug/summary.
+type Summary struct {
+	// Time is the time at which the summary was taken.
+	Time time.Time `json:"time"`
+	// Executor is the name of the session's executor.
+	Executor string `json:"executor"`
+	// Progress is the progress of the session's invocations.
+	Progress *Progress `json:"progress"`
+	// Invocations are the invocations that are running, which may be
+	// canceled (see Session.Cancel).
+	Invocations []SummaryInvocation `json:"invocations,omitempty"`
+	// Tenants describes the use of the session's procs by its tenants,
+	// if the session is configured with Tenants.
+	Tenants []SummaryTenant `json:"tenants,omitempty"`
+	// Machines describes the machines used by the session, if any.
+	Machines []SummaryMachine `json:"machines,omitempty"`
+	// Errors are the most recent task errors, latest first.
+	Errors []SummaryError `json:"errors,omitempty"`
+}
+
+// A SummaryInvocation describes a running invocation.
+type SummaryInvocation struct {
+	// Index is the index of the invocation.
+	Index uint64 `json:"index"`
+	// Location is the source location at which the invocation was made.
+	Location string `json:"location"`
+	// Start is the time at which the invocation began running.
+	Start time.Time `json:"start"`
+	// Canceled indicates whether the invocation has been canceled, but
+	// has not yet stopped.
+	Canceled bool `json:"canceled,omitempty"`
+}
+
+// A SummaryTenant describes a tenant's use of a session's procs.
+type SummaryTenant struct {
+	// Name is the name of the tenant.
+	Name string `json:"name"`
+	// Procs is the number of procs occupied by the tenant's tasks, and
+	// Waiting the number of its tasks that are waiting for procs.
+	Procs   int `json:"procs"`
+	Waiting int `json:"waiting"`
+	// Runs is the number of the tenant's invocations that are
+	// evaluating.
+	Runs int `json:"runs"`
+}
+
+// A SummaryMachine describes a machine used by a session, as reported
+// by the session's status.
+type SummaryMachine struct {
+	// Addr is the address of the machine.
+	Addr string `json:"addr"`
+	// Status describes the machine's state and resource usage.
+	Status string `json:"status"`
+}
+
+// A SummaryError describes a failed task attempt.
+type SummaryError struct {
+	// Task is the name of the task.
+	Task string `json:"task"`
+	// Machine is the machine on which the attempt ran.
+	Machine string `json:"machine"`
+	// Time is the time at which the attempt failed.
+	Time time.Time `json:"time"`
+	// Error is the error with which the attempt failed.
+	Error string `json:"error"`
+}
+
+// Summary returns a summary of the current state of the session.
+func (s *Session) Summary() *Summary {
+	s.mu.Lock()
+	roots := make([]*Task, 0, len(s.roots))
+	for task := range s.roots {
+		roots = append(roots, task)
+	}
+	s.mu.Unlock()
+	now := time.Now()
+	sum := &Summary{
+		Time:        now,
+		Executor:    s.executor.Name(),
+		Progress:    computeProgress(roots, now),
+		Invocations: s.runningInvocations(),
+	}
+	if s.fair != nil {
+		sum.Tenants = s.fair.summary()
+	}
+	if s.status != nil {
+		for _, group := range s.status.Groups() {
+			if group.Value().Title != BigmachineStatusGroup {
+				continue
+			}
+			for _, task := range group.Tasks() {
+				v := task.Value()
+				sum.Machines = append(sum.Machines, SummaryMachine{Addr: v.Title, Status: v.Status})
+			}
+		}
+		sort.Slice(sum.Machines, func(i, j int) bool {
+			return sum.Machines[i].Addr < sum.Machines[j].Addr
+		})
+	}
+	all := make(map[*Task]bool)
+	for _, task := range roots {
+		task.all(all)
+	}
+	for task := range all {
+		task.Lock()
+		for _, attempt := range task.attempts {
+			if attempt.State != TaskErr || attempt.Err == nil {
+				continue
+			}
+			sum.Errors = append(sum.Errors, SummaryError{
+				Task:    task.Name.String(),
+				Machine: attempt.Machine,
+				Time:    attempt.End,
+				Error:   attempt.Err.Error(),
+			})
+		}
+		task.Unlock()
+	}
+	sort.Slice(sum.Errors, func(i, j int) bool {
+		return sum.Errors[i].Time.After(sum.Errors[j].Time)
+	})
+	if len(sum.Errors) > maxSummaryErrors {
+		sum.Errors = sum.Errors[:maxSummaryErrors]
+	}
+	return sum
+}
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.0f%%", 100*f) },
+	"size":    func(n int64) string { return data.Size(n).String() },
+	"round":   func(d time.Duration) time.Duration { return d.Round(time.Second) },
+	"since":   func(now, t time.Time) time.Duration { return now.Sub(t).Round(time.Second) },
+	"clock":   func(t time.Time) string { return t.Local().Format("15:04:05") },
+}).Parse(`<div class="bigslice-status">
+<p>{{.Executor}} executor: {{.Progress.Done}}/{{.Progress.Tasks}} tasks done ({{percent .Progress.Fraction}}),
+{{.Progress.Running}} running, {{.Progress.Failed}} failed; {{.Progress.Records}} records, {{size .Progress.Bytes}} written{{with .Progress.Remaining .Time}}; ETA {{round .}}{{end}}</p>
+<progress max="{{.Progress.Tasks}}" value="{{.Progress.Done}}"></progress>
+{{if .Invocations}}<table>
+<thead><tr><th>inv</th><th>location</th><th>running</th></tr></thead>
+<tbody>
+{{range .Invocations}}<tr><td>{{.Index}}</td><td>{{.Location}}</td><td>{{since $.Time .Start}}{{if .Canceled}} (canceled){{end}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .Progress.Stages}}<table>
+<thead><tr><th>inv</th><th>stage</th><th>done</th><th>running</th><th>failed</th><th>records</th><th>bytes</th></tr></thead>
+<tbody>
+{{range .Progress.Stages}}<tr><td>{{.Invocation}}</td><td>{{.Op}}</td><td>{{.Done}}/{{.Tasks}}</td><td>{{.Running}}</td><td>{{.Failed}}</td><td>{{.Records}}</td><td>{{size .Bytes}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .Tenants}}<table>
+<thead><tr><th>tenant</th><th>procs</th><th>waiting</th><th>runs</th></tr></thead>
+<tbody>
+{{range .Tenants}}<tr><td>{{or .Name "(default)"}}</td><td>{{.Procs}}</td><td>{{.Waiting}}</td><td>{{.Runs}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .Machines}}<table>
+<thead><tr><th>machine</th><th>status</th></tr></thead>
+<tbody>
+{{range .Machines}}<tr><td>{{.Addr}}</td><td>{{.Status}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .Errors}}<table>
+<thead><tr><th>time</th><th>task</th><th>machine</th><th>error</th></tr></thead>
+<tbody>
+{{range .Errors}}<tr><td>{{clock .Time}}</td><td>{{.Task}}</td><td>{{.Machine}}</td><td><pre>{{.Error}}</pre></td></tr>
+{{end}}</tbody>
+</table>
+{{end}}</div>
+`))
+
+// WriteHTML writes the summary to w as a self-contained HTML fragment,
+// so that the status of a session may be rendered in-process, e.g., by
+// notebook kernels and web tools that embed bigslice, without serving
+// the session's debug handlers.
+func (sum *Summary) WriteHTML(w io.Writer) error {
+	return summaryTemplate.Execute(w, sum)
+}
+
+func (s *Session) handleSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(s.Summary()); err != nil {
+		log.Error.Printf("exec.Session: /debug/summary: marshal: %v", err)
+	}
+}
@@ -14,7 +14,10 @@ import (
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"time"
 
+	"github.com/grailbio/base/backgroundcontext"
+	"github.com/grailbio/base/data"
 	"github.com/grailbio/base/status"
 	"github.com/grailbio/base/sync/ctxsync"
 	"github.com/grailbio/bigslice"
@@ -22,6 +25,8 @@ import (
 	"github.com/grailbio/bigslice/slicefunc"
 	"github.com/grailbio/bigslice/sliceio"
 	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/stats"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func init() {
@@ -106,6 +111,23 @@ type TaskDep struct {
 	//
 	// CombineKeys must be provided to tasks that contain combiners.
 	CombineKey string
+
+	// Offset and Count restrict the dependency to the Count tasks of
+	// Head's phase that start at index Offset. If Count is zero, the
+	// dependency comprises the whole phase.
+	Offset, Count int
+
+	// Columns indicates which of the dependency's columns are used by
+	// the task; the others need not be decoded when the dependency is
+	// read. If nil, all columns are used.
+	Columns []bool
+
+	// Broadcast indicates that the dependency is a broadcast
+	// dependency, which is read in full by each of the tasks that
+	// depend on it. Workers replicate broadcast dependencies locally
+	// so that they are read from their producers only once per
+	// machine.
+	Broadcast bool
 }
 
 // NumTask returns the number of tasks that are comprised by this dependency.
@@ -113,6 +135,9 @@ func (d TaskDep) NumTask() int {
 	if d.Head == nil {
 		return 0
 	}
+	if d.Count > 0 {
+		return d.Count
+	}
 	if n := len(d.Head.Group); n > 0 {
 		return n
 	}
@@ -121,6 +146,7 @@ func (d TaskDep) NumTask() int {
 
 // Task returns the i'th task comprised by this dependency.
 func (d TaskDep) Task(i int) *Task {
+	i += d.Offset
 	if i == 0 {
 		return d.Head
 	}
@@ -254,6 +280,27 @@ type Task struct {
 	// Slices is the set of slices to which this task directly contributes.
 	Slices []bigslice.Slice
 
+	// Storage is the storage level of the task's output, if the task
+	// computes a persisted slice. See bigslice.Persist.
+	Storage bigslice.StorageLevel
+
+	// Limit is the total number of rows that are needed from the
+	// outputs of the task's phase; it is zero if they are needed in
+	// full. See bigslice.Limiter.
+	Limit int
+
+	// Lookups are the names of the small join dependencies that are
+	// computed within this task, and thus are not read through its
+	// Deps. See SmallJoinRows.
+	Lookups []bigslice.Name
+
+	// lineage identifies the computation of the task's output, if the
+	// task is compiled for a resident invocation: tasks of successive
+	// runs that have the same lineage compute the same output. It is
+	// empty if the task's output cannot be identified, and for tasks
+	// of other invocations. See Resident.
+	lineage string
+
 	// Group stores an ordered list of peer tasks. If Group is nonempty,
 	// it is guaranteed that these sets of tasks constitute a shuffle
 	// dependency, and share a set of shuffle dependencies. This allows
@@ -265,10 +312,34 @@ type Task struct {
 	// metrics produced during execution of this task.
 	Scope metrics.Scope
 
+	// Progress is the progress reported by the task's operations during
+	// its current or most recent run. It is reset when the task starts
+	// to run.
+	Progress metrics.Progress
+
+	// vals holds the stat values of the task's most recent successful
+	// run, e.g., the number of records and bytes written, if they are
+	// reported by the executor. It is protected by the task's lock.
+	vals stats.Values
+
+	// attempts records the task's attempts to run, in order. It is
+	// protected by the task's lock.
+	attempts []TaskAttempt
+
+	// spanContext is the OpenTelemetry span context of the task's
+	// current attempt, which executors propagate to workers. It is
+	// protected by the task's lock.
+	spanContext trace.SpanContext
+
 	// subs is the set of subscribers to which this task will be sent whenever
 	// its state changes.
 	subs []*TaskSubscriber
 
+	// watchers is the set of watchers, e.g., task event logs, that are
+	// notified of this task's state transitions. It is protected by the
+	// task's lock.
+	watchers []taskWatcher
+
 	// The following are used to coordinate runtime execution.
 
 	sync.Mutex
@@ -281,6 +352,21 @@ type Task struct {
 	// Err is defines when state == TaskErr.
 	err error
 
+	// truncated indicates that the task's output is not needed, because
+	// the other tasks of its phase have produced enough rows (see
+	// Limit): the task is run to produce an empty output, without
+	// reading its dependencies. It is set before the task is run, or
+	// while it runs, in which case its run is canceled.
+	truncated bool
+	// cancelRun cancels the task's current run, if it may be canceled
+	// by truncation. See runContext.
+	cancelRun context.CancelFunc
+	// evalCtx is the context of the evaluation that submitted the task's
+	// current run. It is canceled when the evaluation ends, e.g., because
+	// its invocation is canceled by Session.Cancel, which cancels the
+	// run. See evalContext.
+	evalCtx context.Context
+
 	// consecutiveLost is the number of times this task has been run and lost
 	// consecutively. See maxConsecutiveLost.
 	consecutiveLost int
@@ -289,6 +375,27 @@ type Task struct {
 	Status *status.Task
 }
 
+// setVals sets the stat values of the task's most recent run.
+func (t *Task) setVals(vals stats.Values) {
+	t.Lock()
+	t.vals = vals
+	t.Unlock()
+}
+
+// Vals returns a copy of the stat values of the task's most recent
+// successful run, as reported by the executor. Vals is nil if the
+// executor does not report task stats. Values include "write", the
+// number of records written, and "writeBytes", the encoded size of
+// the task's output.
+func (t *Task) Vals() stats.Values {
+	t.Lock()
+	defer t.Unlock()
+	if t.vals == nil {
+		return nil
+	}
+	return t.vals.Copy()
+}
+
 // Phase returns the phase to which this task belongs.
 func (t *Task) Phase() []*Task {
 	if len(t.Group) == 0 {
@@ -375,13 +482,101 @@ func (t *Task) State() TaskState {
 	return state
 }
 
+// evalContext returns the context in which executors run the task:
+// that of the evaluation that submitted it or, if it was not submitted
+// by an evaluation, the background context.
+func (t *Task) evalContext() context.Context {
+	t.Lock()
+	defer t.Unlock()
+	if t.evalCtx == nil {
+		return backgroundcontext.Get()
+	}
+	return t.evalCtx
+}
+
+// A TaskAttempt records an attempt to run a task.
+type TaskAttempt struct {
+	// Machine is the address of the machine on which the task was run,
+	// or "local" if it was run by the local executor.
+	Machine string
+	// Start is the time at which the attempt began; End is the time at
+	// which it completed. End is zero while the attempt is running.
+	Start, End time.Time
+	// State is the state of the task at the end of the attempt, or
+	// TaskRunning while it is running.
+	State TaskState
+	// Err is the error with which the attempt failed, if any.
+	Err error
+}
+
+// setRunning sets the task's state to TaskRunning, and records the
+// beginning of an attempt to run it on the provided machine. The
+// attempt ends with the task's next state change.
+func (t *Task) setRunning(machine string) {
+	t.Progress.Reset(metrics.ProgressReport{})
+	t.Lock()
+	t.state = TaskRunning
+	t.attempts = append(t.attempts, TaskAttempt{
+		Machine: machine,
+		Start:   time.Now(),
+		State:   TaskRunning,
+	})
+	t.Broadcast()
+	t.Unlock()
+}
+
+// Attempts returns the task's attempts to run, in order.
+func (t *Task) Attempts() []TaskAttempt {
+	t.Lock()
+	defer t.Unlock()
+	attempts := make([]TaskAttempt, len(t.attempts))
+	copy(attempts, t.attempts)
+	return attempts
+}
+
+// A taskWatcher is notified of each of the state transitions of the
+// tasks that it watches (see Task.watch).
+type taskWatcher interface {
+	// taskEvent is called after the provided task transitions to a new
+	// state, while the task's lock is held.
+	taskEvent(task *Task)
+}
+
+// watch adds w to the task's watchers. The caller must hold the task's
+// lock.
+func (t *Task) watch(w taskWatcher) {
+	t.watchers = append(t.watchers, w)
+}
+
+// unwatch removes w from the task's watchers. The caller must hold the
+// task's lock.
+func (t *Task) unwatch(w taskWatcher) {
+	for i, other := range t.watchers {
+		if other == w {
+			t.watchers = append(t.watchers[:i], t.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
 // Broadcast notifies waiters of a state change. Broadcast must only
 // be called while the task's lock is held.
 func (t *Task) Broadcast() {
+	if n := len(t.attempts); n > 0 && t.state != TaskRunning && t.attempts[n-1].End.IsZero() {
+		attempt := &t.attempts[n-1]
+		attempt.End = time.Now()
+		attempt.State = t.state
+		if t.state != TaskOk {
+			attempt.Err = t.err
+		}
+	}
 	if t.waitc != nil {
 		close(t.waitc)
 		t.waitc = nil
 	}
+	for _, w := range t.watchers {
+		w.taskEvent(t)
+	}
 	for _, sub := range t.subs {
 		sub.Notify(t)
 	}
@@ -472,6 +667,89 @@ func (t *Task) WriteGraph(w io.Writer) {
 	tw.Flush()
 }
 
+// dotColors maps task states to the fill colors used to render tasks
+// in DOT.
+var dotColors = [...]string{
+	TaskInit:    "white",
+	TaskWaiting: "lightyellow",
+	TaskRunning: "lightblue",
+	TaskOk:      "palegreen",
+	TaskErr:     "salmon",
+	TaskLost:    "orange",
+}
+
+// WriteDOT writes the task graph rooted at t into w in the DOT
+// graph description language, so that it may be rendered by Graphviz.
+// Tasks are colored by state, and are labeled with their number of
+// partitions and, once they have been run, the number of records and
+// bytes they output. Edges point from dependencies to the tasks that
+// depend on them, and are labeled with the partition they read.
+func (t *Task) WriteDOT(w io.Writer) error {
+	return writeDOT(w, []*Task{t})
+}
+
+// writeDOT writes the union of the task graphs rooted at the provided
+// tasks into w in DOT.
+func writeDOT(w io.Writer, roots []*Task) error {
+	all := make(map[*Task]bool)
+	for _, root := range roots {
+		root.all(all)
+	}
+	tasks := make([]*Task, 0, len(all))
+	for task := range all {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name.String() < tasks[j].Name.String()
+	})
+	var b bytes.Buffer
+	b.WriteString("digraph tasks {\n")
+	b.WriteString("\tnode [shape=box, style=filled, fontname=monospace];\n")
+	for _, task := range tasks {
+		state := task.State()
+		label := []string{task.Name.String(), state.String()}
+		if task.NumPartition > 1 {
+			label = append(label, fmt.Sprintf("%d partitions", task.NumPartition))
+		}
+		if task.CombineKey != "" {
+			label = append(label, "combine key "+task.CombineKey)
+		}
+		for _, name := range task.Lookups {
+			label = append(label, "lookup "+name.String())
+		}
+		if vals := task.Vals(); vals != nil {
+			// Output sizes are not known for tasks that write to machine
+			// combiners.
+			if size, ok := vals["writeBytes"]; ok {
+				label = append(label, fmt.Sprintf("%d records, %s", vals["write"], data.Size(size)))
+			} else {
+				label = append(label, fmt.Sprintf("%d records", vals["write"]))
+			}
+		}
+		color := "white"
+		if int(state) < len(dotColors) {
+			color = dotColors[state]
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q, fillcolor=%q];\n",
+			task.Name.String(), strings.Join(label, "\n"), color)
+	}
+	for _, task := range tasks {
+		for _, dep := range task.Deps {
+			for i := 0; i < dep.NumTask(); i++ {
+				deptask := dep.Task(i)
+				var attrs string
+				if deptask.NumPartition > 1 {
+					attrs = fmt.Sprintf(" [label=\"p%d\"]", dep.Partition)
+				}
+				fmt.Fprintf(&b, "\t%q -> %q%s;\n", deptask.Name.String(), task.Name.String(), attrs)
+			}
+		}
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
 func (t *Task) writeDeps(w io.Writer) {
 	for _, dep := range t.Deps {
 		for i := 0; i < dep.NumTask(); i++ {
@@ -5,10 +5,13 @@
 package exec
 
 import (
+	"bytes"
 	"math/rand"
 	"reflect"
 	"sync"
 	"testing"
+
+	"github.com/grailbio/bigslice/stats"
 )
 
 // TestTaskSubscriber verifies that task subscribers receive all tasks whose
@@ -91,3 +94,83 @@ func TestTaskSubscriber(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestWriteDOT(t *testing.T) {
+	var (
+		a  = &Task{Name: TaskName{Op: "a", NumShard: 2, Shard: 0}, NumPartition: 2}
+		a1 = &Task{Name: TaskName{Op: "a", NumShard: 2, Shard: 1}, NumPartition: 2}
+		b  = &Task{Name: TaskName{Op: "b", NumShard: 1}, NumPartition: 1}
+	)
+	a.Group = []*Task{a, a1}
+	a1.Group = a.Group
+	b.Deps = []TaskDep{{Head: a, Partition: 1}}
+	a.setVals(stats.Values{"write": 100, "writeBytes": 2048})
+	a.Set(TaskOk)
+	a1.Set(TaskLost)
+	b.Set(TaskRunning)
+
+	var buf bytes.Buffer
+	if err := b.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = `digraph tasks {
+	node [shape=box, style=filled, fontname=monospace];
+	"a@2:0" [label="a@2:0\nOK\n2 partitions\n100 records, 2.0KiB", fillcolor="palegreen"];
+	"a@2:1" [label="a@2:1\nLOST\n2 partitions", fillcolor="orange"];
+	"b@1:0" [label="b@1:0\nRUNNING", fillcolor="lightblue"];
+	"a@2:0" -> "b@1:0" [label="p1"];
+	"a@2:1" -> "b@1:0" [label="p1"];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTaskAttempts(t *testing.T) {
+	task := &Task{Name: TaskName{Op: "a", NumShard: 1}}
+	task.Set(TaskWaiting)
+	if got, want := len(task.Attempts()), 0; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	task.setRunning("m1")
+	attempts := task.Attempts()
+	if got, want := len(attempts), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := attempts[0].State, TaskRunning; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !attempts[0].End.IsZero() {
+		t.Errorf("running attempt has end time %v", attempts[0].End)
+	}
+	task.Set(TaskLost)
+	task.Set(TaskWaiting)
+	task.setRunning("m2")
+	task.Set(TaskOk)
+	// State changes after the attempt has ended do not affect it.
+	task.Set(TaskLost)
+
+	attempts = task.Attempts()
+	if got, want := len(attempts), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, want := range []struct {
+		machine string
+		state   TaskState
+	}{{"m1", TaskLost}, {"m2", TaskOk}} {
+		attempt := attempts[i]
+		if got := attempt.Machine; got != want.machine {
+			t.Errorf("attempt %d: got %v, want %v", i, got, want.machine)
+		}
+		if got := attempt.State; got != want.state {
+			t.Errorf("attempt %d: got %v, want %v", i, got, want.state)
+		}
+		if attempt.Start.IsZero() || attempt.End.Before(attempt.Start) {
+			t.Errorf("attempt %d: invalid times %v, %v", i, attempt.Start, attempt.End)
+		}
+	}
+	if attempts[1].Start.Before(attempts[0].End) {
+		t.Errorf("attempts overlap: %v", attempts)
+	}
+}
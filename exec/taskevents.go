@@ -0,0 +1,281 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/base/log"
+)
+
+// taskEventFlushInterval is the interval at which task events are
+// flushed to the event log.
+const taskEventFlushInterval = 5 * time.Second
+
+// A TaskEvent is an entry in an invocation's task event log, as
+// written by sessions configured with TaskEventLog. The log begins with
+// a "start" event, followed by a "task" event for each of the
+// invocation's tasks, which describes the task and its state at the
+// time the invocation began. Each subsequent state transition of a
+// task is logged with a "state" event. The log ends with an "end"
+// event.
+type TaskEvent struct {
+	// Time is the time of the event.
+	Time time.Time `json:"time"`
+	// Kind is the kind of event: "start", "task", "state", or "end".
+	Kind string `json:"kind"`
+	// Invocation is the index of the invocation.
+	Invocation uint64 `json:"invocation"`
+	// Location and Executor are the location of the invocation and the
+	// name of the executor that evaluates it. They are set for "start"
+	// events.
+	Location string `json:"location,omitempty"`
+	Executor string `json:"executor,omitempty"`
+	// Task is the name of the task.
+	Task string `json:"task,omitempty"`
+	// Deps describes the dependencies of the task. It is set for "task"
+	// events.
+	Deps []TaskEventDep `json:"deps,omitempty"`
+	// NumPartition is the number of partitions of the task's output. It
+	// is set for "task" events.
+	NumPartition int `json:"num_partition,omitempty"`
+	// State is the task's (new) state.
+	State string `json:"state,omitempty"`
+	// Attempt is the number of the task's attempts to run so far, and
+	// Machine is the machine on which the latest attempt was run.
+	Attempt int    `json:"attempt,omitempty"`
+	Machine string `json:"machine,omitempty"`
+	// Duration is the duration of the attempt that ended with the
+	// event, if any.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Error is the error with which the task or invocation failed.
+	Error string `json:"error,omitempty"`
+	// Records and Bytes are the number and encoded size of the records
+	// written by the task, as reported by the executor when the task
+	// completes successfully.
+	Records int64 `json:"records,omitempty"`
+	Bytes   int64 `json:"bytes,omitempty"`
+}
+
+// A TaskEventDep describes a dependency of a task in a task event log.
+type TaskEventDep struct {
+	// Task is the name of the first task of the dependency, and NumTask
+	// is the number of tasks that it comprises.
+	Task    string `json:"task"`
+	NumTask int    `json:"num_task"`
+	// Partition is the partition of the tasks' outputs that is read.
+	Partition int `json:"partition"`
+}
+
+// ReadTaskEvents reads the task events of the event log read from r.
+func ReadTaskEvents(r io.Reader) ([]TaskEvent, error) {
+	var (
+		dec    = json.NewDecoder(r)
+		events []TaskEvent
+	)
+	for {
+		var event TaskEvent
+		if err := dec.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+// taskEventLog writes the task event log of an invocation. Events are
+// buffered, and written to the log's file periodically.
+type taskEventLog struct {
+	inv  uint64
+	path string
+	file file.File
+	w    io.Writer
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	enc *json.Encoder
+	err error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// taskEventLogPath returns the path of the event log of the provided
+// invocation, which begins at the provided time.
+func taskEventLogPath(prefix string, inv uint64, start time.Time) string {
+	return file.Join(prefix, fmt.Sprintf("%s-inv%d.jsonl", start.UTC().Format("20060102T150405.000000Z"), inv))
+}
+
+// startTaskEventLog creates the event log of the provided invocation
+// under prefix, logs its start event and the initial state of its
+// tasks, and subscribes the log to the tasks' state transitions. The
+// log must be closed by Close.
+func startTaskEventLog(ctx context.Context, prefix string, inv execInvocation, executor Executor, tasks []*Task) (*taskEventLog, error) {
+	start := time.Now()
+	path := taskEventLogPath(prefix, inv.Index, start)
+	f, err := file.Create(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	l := &taskEventLog{
+		inv:  inv.Index,
+		path: path,
+		file: f,
+		w:    f.Writer(ctx),
+		done: make(chan struct{}),
+	}
+	l.enc = json.NewEncoder(&l.buf)
+	l.log(TaskEvent{Time: start, Kind: "start", Location: inv.Location, Executor: executor.Name()})
+	all := make(map[*Task]bool)
+	for _, task := range tasks {
+		task.all(all)
+	}
+	sorted := make([]*Task, 0, len(all))
+	for task := range all {
+		sorted = append(sorted, task)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name.String() < sorted[j].Name.String()
+	})
+	for _, task := range sorted {
+		event := TaskEvent{Kind: "task", Task: task.Name.String(), NumPartition: task.NumPartition}
+		for _, dep := range task.Deps {
+			event.Deps = append(event.Deps, TaskEventDep{
+				Task:      dep.Task(0).Name.String(),
+				NumTask:   dep.NumTask(),
+				Partition: dep.Partition,
+			})
+		}
+		task.Lock()
+		l.describe(task, &event)
+		task.watch(l)
+		l.log(event)
+		task.Unlock()
+	}
+	l.wg.Add(1)
+	go l.flushLoop()
+	return l, nil
+}
+
+// Close unsubscribes the log from the provided tasks, logs the end of
+// the invocation with the provided error, and writes the remainder of
+// the log.
+func (l *taskEventLog) Close(ctx context.Context, tasks []*Task, err error) error {
+	all := make(map[*Task]bool)
+	for _, task := range tasks {
+		task.all(all)
+	}
+	for task := range all {
+		task.Lock()
+		task.unwatch(l)
+		task.Unlock()
+	}
+	close(l.done)
+	l.wg.Wait()
+	event := TaskEvent{Kind: "end"}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.log(event)
+	if err := l.flush(); err != nil {
+		l.file.Discard(ctx)
+		return err
+	}
+	return l.file.Close(ctx)
+}
+
+// taskEvent logs the current state of the provided task, which has
+// just transitioned. The caller must hold the task's lock.
+func (l *taskEventLog) taskEvent(task *Task) {
+	event := TaskEvent{Kind: "state", Task: task.Name.String()}
+	l.describe(task, &event)
+	if n := len(task.attempts); n > 0 && task.state != TaskRunning {
+		if attempt := task.attempts[n-1]; !attempt.End.IsZero() && attempt.State == task.state {
+			event.Duration = attempt.End.Sub(attempt.Start)
+		}
+	}
+	l.log(event)
+}
+
+// describe sets the state-related fields of the provided event from
+// the task. The caller must hold the task's lock.
+func (l *taskEventLog) describe(task *Task, event *TaskEvent) {
+	event.State = task.state.String()
+	if n := len(task.attempts); n > 0 {
+		event.Attempt = n
+		event.Machine = task.attempts[n-1].Machine
+	}
+	switch task.state {
+	case TaskOk:
+		if task.vals != nil {
+			event.Records = task.vals["write"]
+			event.Bytes = task.vals["writeBytes"]
+		}
+	case TaskErr:
+		if task.err != nil {
+			event.Error = task.err.Error()
+		}
+	}
+}
+
+func (l *taskEventLog) log(event TaskEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Invocation = l.inv
+	l.mu.Lock()
+	if err := l.enc.Encode(event); err != nil && l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+}
+
+// flush writes buffered events to the log's file.
+func (l *taskEventLog) flush() error {
+	l.mu.Lock()
+	p := append([]byte(nil), l.buf.Bytes()...)
+	l.buf.Reset()
+	err := l.err
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	_, err = l.w.Write(p)
+	if err != nil {
+		l.mu.Lock()
+		l.err = err
+		l.mu.Unlock()
+	}
+	return err
+}
+
+func (l *taskEventLog) flushLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(taskEventFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.flush(); err != nil {
+				log.Error.Printf("task event log %s: %v", l.path, err)
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+)
+
+// readTaskEventLogs reads the task event logs written under dir.
+func readTaskEventLogs(t *testing.T, dir string) [][]TaskEvent {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*-inv*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs [][]TaskEvent
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := ReadTaskEvents(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, events)
+	}
+	return logs
+}
+
+func TestTaskEventLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskevents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, []int{1, 2, 3, 4}, []int{1, 1, 1, 1})
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	sess := Start(Bigmachine(testsystem.New()), Parallelism(2), TaskEventLog(dir))
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	logs := readTaskEventLogs(t, dir)
+	if got, want := len(logs), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	events := logs[0]
+	if got, want := events[0].Kind, "start"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := events[0].Executor, sess.executor.Name(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	end := events[len(events)-1]
+	if got, want := end.Kind, "end"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if end.Error != "" {
+		t.Errorf("unexpected error %s", end.Error)
+	}
+	var (
+		described = make(map[string]TaskEvent)
+		last      = make(map[string]TaskEvent)
+	)
+	for i, event := range events {
+		if i > 0 && event.Time.Before(events[i-1].Time) {
+			t.Errorf("event %d: out of order", i)
+		}
+		switch event.Kind {
+		case "task":
+			described[event.Task] = event
+		case "state":
+			if _, ok := described[event.Task]; !ok {
+				t.Errorf("state of undescribed task %s", event.Task)
+			}
+			last[event.Task] = event
+		}
+	}
+	if got, want := len(described), 8; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var (
+		nreduce int
+		nrecord int64
+	)
+	for name, event := range described {
+		if got, want := event.State, "INIT"; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if len(event.Deps) > 0 {
+			nreduce++
+			if got, want := event.Deps[0].NumTask, 4; got != want {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+		}
+		final := last[name]
+		if got, want := final.State, "OK"; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if got, want := final.Attempt, 1; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		if final.Machine == "" {
+			t.Errorf("%s: no machine", name)
+		}
+		if final.Duration <= 0 {
+			t.Errorf("%s: got %v, want > 0", name, final.Duration)
+		}
+		if final.Bytes <= 0 {
+			t.Errorf("%s: got %v, want > 0", name, final.Bytes)
+		}
+		nrecord += final.Records
+	}
+	if got, want := nreduce, 4; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Each of the 4 records is written once by Const and once by Reduce.
+	if got, want := nrecord, int64(8); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTaskEventLogError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "taskevents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := bigslice.Func(func() bigslice.Slice {
+		return bigslice.ReaderFunc(2, func(shard int, state *int, out []int) (int, error) {
+			return 0, errors.New("read failed")
+		})
+	})
+	sess := Start(Local, TaskEventLog(dir))
+	defer sess.Shutdown()
+	if _, err := sess.Run(context.Background(), fn); err == nil {
+		t.Fatal("expected error")
+	}
+	logs := readTaskEventLogs(t, dir)
+	if got, want := len(logs), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	events := logs[0]
+	var nerr int
+	for _, event := range events {
+		if event.Kind == "state" && event.State == "ERROR" {
+			nerr++
+			if event.Error == "" || event.Machine != "local" {
+				t.Errorf("got %+v, want error on local machine", event)
+			}
+		}
+	}
+	if nerr == 0 {
+		t.Error("no task errors logged")
+	}
+	if end := events[len(events)-1]; end.Kind != "end" || end.Error == "" {
+		t.Errorf("got %+v, want end with error", end)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grailbio/bigslice"
+)
+
+// GraphVersion is the version of the schema of Graph. It is
+// incremented only when a change is made to the schema that is not
+// backwards compatible, i.e., when fields are removed or their meaning
+// is changed; new fields may be added without changing the version.
+const GraphVersion = 1
+
+// A Graph is a read-only snapshot of a compiled task graph, suitable
+// for use by external tooling such as custom user interfaces, lineage
+// systems, and schedulers. Unlike Task, whose structure reflects the
+// current implementation of the evaluator and changes across
+// releases, Graph is plain data whose schema is stable, as described
+// by GraphVersion. Graphs are self-contained: they do not refer to the
+// tasks from which they were made, and thus do not change as the tasks
+// are evaluated. Graphs may be serialized, e.g., as JSON.
+type Graph struct {
+	// Version is the version of the graph's schema. It is GraphVersion
+	// for graphs produced by this package.
+	Version int `json:"version"`
+	// Roots are the names of the graph's root tasks, i.e., those that
+	// compute the graph's result.
+	Roots []string `json:"roots"`
+	// Tasks are the tasks in the graph, ordered by name.
+	Tasks []GraphTask `json:"tasks"`
+	// Jobs are the jobs submitted to the session (see Session.Submit),
+	// ordered by ID. Jobs are included only in session graphs.
+	Jobs []GraphJob `json:"jobs,omitempty"`
+}
+
+// Task returns the graph task with the provided name, and whether it
+// was found.
+func (g *Graph) Task(name string) (GraphTask, bool) {
+	i := sort.Search(len(g.Tasks), func(i int) bool { return g.Tasks[i].Name >= name })
+	if i < len(g.Tasks) && g.Tasks[i].Name == name {
+		return g.Tasks[i], true
+	}
+	return GraphTask{}, false
+}
+
+// Dependents returns the names of the tasks that depend on the task
+// with the provided name.
+func (g *Graph) Dependents(name string) []string {
+	var names []string
+	for _, task := range g.Tasks {
+	deps:
+		for _, dep := range task.Deps {
+			for _, depName := range dep.Tasks {
+				if depName == name {
+					names = append(names, task.Name)
+					break deps
+				}
+			}
+		}
+	}
+	return names
+}
+
+// A GraphTask describes a single task in a Graph.
+type GraphTask struct {
+	// Name is the task's unique name, formatted as described by
+	// TaskName.String.
+	Name string `json:"name"`
+	// Op is the name of the (pipelined) operations performed by the
+	// task.
+	Op string `json:"op"`
+	// Shard and NumShard describe the shard computed by the task, and
+	// the total number of shards computed by its phase.
+	Shard    int `json:"shard"`
+	NumShard int `json:"numShard"`
+	// Invocation is the index of the Func invocation from which the
+	// task was compiled.
+	Invocation uint64 `json:"invocation"`
+	// Slices are the names of the slices to which the task contributes,
+	// formatted as "op@file:line".
+	Slices []string `json:"slices"`
+	// Lookups are the names of the small join dependencies, formatted
+	// as "op@file:line", that are computed within the task rather than
+	// shuffled.
+	Lookups []string `json:"lookups,omitempty"`
+	// Columns are the types of the task's output columns.
+	Columns []string `json:"columns"`
+	// NumPartition is the number of partitions of the task's output.
+	NumPartition int `json:"numPartition"`
+	// CombineKey names the machine-local combine buffer to which the
+	// task's output is written, if any.
+	CombineKey string `json:"combineKey,omitempty"`
+	// Combiner indicates whether the task's output is combined.
+	Combiner bool `json:"combiner"`
+	// Procs and GPUs are the number of processors and GPUs that the
+	// task requires to run. Exclusive indicates whether the task
+	// requires exclusive use of a machine.
+	Procs     int  `json:"procs"`
+	GPUs      int  `json:"gpus"`
+	Exclusive bool `json:"exclusive"`
+	// State is the state of the task at the time the snapshot was
+	// taken: one of "INIT", "WAITING", "RUNNING", "OK", "ERROR", or
+	// "LOST".
+	State string `json:"state"`
+	// Error is the error that caused the task to fail, if its state is
+	// "ERROR".
+	Error string `json:"error,omitempty"`
+	// Records and Bytes are the number of records and encoded bytes
+	// output by the task's most recent successful run. They are -1 if
+	// unknown, e.g., because the task has not been run, or because the
+	// executor does not report them.
+	Records int64 `json:"records"`
+	Bytes   int64 `json:"bytes"`
+	// Deps are the task's dependencies.
+	Deps []GraphDep `json:"deps"`
+	// Attempts are the task's attempts to run, in order.
+	Attempts []GraphAttempt `json:"attempts"`
+	// Progress is the progress reported by the task's operations during
+	// its current or most recent attempt (see metrics.Progress). It is
+	// nil if no progress was reported.
+	Progress *GraphProgress `json:"progress,omitempty"`
+}
+
+// GraphProgress describes the progress reported by a task.
+type GraphProgress struct {
+	// Records is the number of records reported as processed.
+	Records int64 `json:"records"`
+	// Message is the most recently reported stage message.
+	Message string `json:"message,omitempty"`
+	// Updated is the time, in UTC, of the most recent report.
+	Updated time.Time `json:"updated"`
+}
+
+// A GraphAttempt describes an attempt to run a task.
+type GraphAttempt struct {
+	// Machine is the address of the machine on which the attempt ran,
+	// or "local" if it was run by the local executor.
+	Machine string `json:"machine"`
+	// Start and End are the times, in UTC, at which the attempt began
+	// and completed. End is zero while the attempt is running.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// State is the state of the task at the end of the attempt, as in
+	// GraphTask.State; it is "RUNNING" while the attempt is running.
+	State string `json:"state"`
+	// Error is the error with which the attempt failed, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// A GraphDep describes a dependency of a task on (a partition of) the
+// outputs of a set of tasks.
+type GraphDep struct {
+	// Tasks are the names of the tasks on whose outputs the dependency
+	// is.
+	Tasks []string `json:"tasks"`
+	// Partition is the partition of the tasks' outputs that is read.
+	Partition int `json:"partition"`
+	// Expand indicates that the tasks' outputs are read individually,
+	// rather than merged into a single stream.
+	Expand bool `json:"expand"`
+	// CombineKey names the combine buffer from which the dependency is
+	// read, if any.
+	CombineKey string `json:"combineKey,omitempty"`
+}
+
+// A GraphJob describes a job submitted to a session, and its
+// dependencies on other jobs.
+type GraphJob struct {
+	// ID is the job's identifier; see Job.ID.
+	ID int `json:"id"`
+	// Location is the source location at which the job was submitted.
+	Location string `json:"location"`
+	// Deps are the IDs of the jobs on which the job depends.
+	Deps []int `json:"deps,omitempty"`
+	// State is the job's state, formatted as described by
+	// JobState.String.
+	State string `json:"state"`
+	// Invocation is the index of the job's invocation, which identifies
+	// its tasks (see GraphTask.Invocation). It is zero until the job has
+	// completed.
+	Invocation uint64 `json:"invocation,omitempty"`
+	// Start is the time at which the job began to run, and End the time
+	// at which it completed. They are zero if the job has not started or
+	// completed, respectively.
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+	// Error is the error with which the job failed or was skipped, if
+	// any.
+	Error string `json:"error,omitempty"`
+}
+
+// snapshotGraph returns a snapshot of the union of the task graphs rooted
+// at the provided tasks.
+func snapshotGraph(roots []*Task) *Graph {
+	all := make(map[*Task]bool)
+	g := &Graph{Version: GraphVersion}
+	for _, root := range roots {
+		root.all(all)
+		g.Roots = append(g.Roots, root.Name.String())
+	}
+	sort.Strings(g.Roots)
+	for task := range all {
+		g.Tasks = append(g.Tasks, snapshotTask(task))
+	}
+	sort.Slice(g.Tasks, func(i, j int) bool {
+		return g.Tasks[i].Name < g.Tasks[j].Name
+	})
+	return g
+}
+
+func snapshotTask(task *Task) GraphTask {
+	t := GraphTask{
+		Name:         task.Name.String(),
+		Op:           task.Name.Op,
+		Shard:        task.Name.Shard,
+		NumShard:     task.Name.NumShard,
+		Invocation:   task.Invocation.Index,
+		NumPartition: task.NumPartition,
+		CombineKey:   task.CombineKey,
+		Combiner:     !task.Combiner.IsNil(),
+		Procs:        1,
+		Records:      -1,
+		Bytes:        -1,
+	}
+	for _, slice := range task.Slices {
+		t.Slices = append(t.Slices, slice.Name().String())
+	}
+	for _, name := range task.Lookups {
+		t.Lookups = append(t.Lookups, name.String())
+	}
+	if task.Type != nil {
+		for i := 0; i < task.NumOut(); i++ {
+			t.Columns = append(t.Columns, task.Out(i).String())
+		}
+	}
+	if task.Pragma != nil {
+		t.Procs = task.Procs()
+		t.GPUs = bigslice.PragmaGPUs(task.Pragma)
+		t.Exclusive = task.Exclusive()
+	}
+	task.Lock()
+	t.State = task.state.String()
+	if task.err != nil {
+		t.Error = task.err.Error()
+	}
+	if task.vals != nil {
+		t.Records = task.vals["write"]
+		if size, ok := task.vals["writeBytes"]; ok {
+			t.Bytes = size
+		}
+	}
+	for _, attempt := range task.attempts {
+		a := GraphAttempt{
+			Machine: attempt.Machine,
+			Start:   attempt.Start.UTC(),
+			State:   attempt.State.String(),
+		}
+		if !attempt.End.IsZero() {
+			a.End = attempt.End.UTC()
+		}
+		if attempt.Err != nil {
+			a.Error = attempt.Err.Error()
+		}
+		t.Attempts = append(t.Attempts, a)
+	}
+	task.Unlock()
+	if report := task.Progress.Report(); !report.IsZero() {
+		t.Progress = &GraphProgress{
+			Records: report.Records,
+			Message: report.Message,
+			Updated: report.Updated.UTC(),
+		}
+	}
+	for _, dep := range task.Deps {
+		d := GraphDep{
+			Partition:  dep.Partition,
+			Expand:     dep.Expand,
+			CombineKey: dep.CombineKey,
+		}
+		for i := 0; i < dep.NumTask(); i++ {
+			d.Tasks = append(d.Tasks, dep.Task(i).Name.String())
+		}
+		t.Deps = append(t.Deps, d)
+	}
+	return t
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/limiter"
+)
+
+// DefaultTenant is the tenant of invocations that are not attributed to
+// a tenant by RunTenant.
+const DefaultTenant = ""
+
+// A TenantQuota is the share of a session's resources that is allotted
+// to a tenant. See Tenants.
+type TenantQuota struct {
+	// Weight is the tenant's weight in fair sharing: when the session's
+	// procs are contended, each tenant is granted procs in proportion to
+	// its weight. Weights that are not positive are taken to be 1.
+	Weight float64
+	// MaxProcs is the maximum number of procs that the tenant's tasks
+	// may occupy concurrently, or zero if it is limited only by the
+	// session's parallelism.
+	MaxProcs int
+	// MaxRuns is the maximum number of the tenant's invocations that may
+	// evaluate concurrently, or zero if unlimited. Calls to Run beyond
+	// this limit wait, as with MaxConcurrentRuns.
+	MaxRuns int
+}
+
+// Tenants configures the session to share its procs (see Parallelism)
+// among tenants, so that when one long-lived driver serves many users'
+// invocations, a single heavy user cannot monopolize the session's
+// machines. Invocations are attributed to tenants by RunTenant. Runnable
+// tasks wait for procs in per-tenant queues, and as procs become free,
+// they are granted to the tenant whose queued task fits and whose usage,
+// relative to its weight, is least. Tenants are also limited by their
+// quotas. Tenants that are not in quotas, including DefaultTenant, have
+// weight 1 and no limits.
+func Tenants(quotas map[string]TenantQuota) Option {
+	return func(s *Session) {
+		s.tenantQuotas = make(map[string]TenantQuota, len(quotas))
+		for name, quota := range quotas {
+			if quota.MaxProcs < 0 || quota.MaxRuns < 0 {
+				panic("exec.Tenants: negative quota for tenant " + name)
+			}
+			s.tenantQuotas[name] = quota
+		}
+	}
+}
+
+// RunTenant attributes the invocation to the provided tenant, whose
+// quota, as configured by Tenants, then applies to it. RunTenant has no
+// effect in sessions that are not configured with Tenants.
+func RunTenant(name string) RunOption {
+	return func(o *runOptions) {
+		o.tenant = name
+	}
+}
+
+// A fairScheduler shares a session's procs among tenants by weighted
+// fair sharing.
+type fairScheduler struct {
+	mu       sync.Mutex
+	capacity int
+	used     int
+	quotas   map[string]TenantQuota
+	tenants  map[string]*tenant
+}
+
+// A tenant is the scheduling state of a tenant.
+type tenant struct {
+	name  string
+	quota TenantQuota
+	// procs is the number of procs in use by the tenant's tasks.
+	procs int
+	// waiters are the tenant's tasks that wait for procs, in order.
+	waiters []*procWaiter
+	// runs limits the tenant's concurrent invocations; it is nil if they
+	// are unlimited. nruns is the number of its running invocations.
+	runs  *limiter.Limiter
+	nruns int
+}
+
+// A procWaiter is a task that waits for n procs; c is closed once they
+// are granted.
+type procWaiter struct {
+	n int
+	c chan struct{}
+}
+
+func newFairScheduler(capacity int, quotas map[string]TenantQuota) *fairScheduler {
+	return &fairScheduler{
+		capacity: capacity,
+		quotas:   quotas,
+		tenants:  make(map[string]*tenant),
+	}
+}
+
+// tenant returns the state of the named tenant. It must be called with
+// f.mu held.
+func (f *fairScheduler) tenant(name string) *tenant {
+	t := f.tenants[name]
+	if t == nil {
+		t = &tenant{name: name, quota: f.quotas[name]}
+		if t.quota.Weight <= 0 {
+			t.quota.Weight = 1
+		}
+		if t.quota.MaxRuns > 0 {
+			t.runs = limiter.New()
+			t.runs.Release(t.quota.MaxRuns)
+		}
+		f.tenants[name] = t
+	}
+	return t
+}
+
+// limit returns the number of procs that a task of the tenant that
+// needs n procs is granted.
+func (f *fairScheduler) limit(t *tenant, n int) int {
+	if n < 1 {
+		n = 1
+	}
+	if n > f.capacity {
+		n = f.capacity
+	}
+	if t.quota.MaxProcs > 0 && n > t.quota.MaxProcs {
+		n = t.quota.MaxProcs
+	}
+	return n
+}
+
+// acquire acquires procs for a task of the named tenant that needs n
+// of them, waiting for its fair share. It returns the number of procs
+// acquired, which must be released with release.
+func (f *fairScheduler) acquire(ctx context.Context, name string, n int) (int, error) {
+	f.mu.Lock()
+	t := f.tenant(name)
+	w := &procWaiter{n: f.limit(t, n), c: make(chan struct{})}
+	t.waiters = append(t.waiters, w)
+	f.dispatch()
+	f.mu.Unlock()
+	select {
+	case <-w.c:
+		return w.n, nil
+	case <-ctx.Done():
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-w.c:
+		// The procs were granted concurrently with cancellation.
+		f.releaseLocked(t, w.n)
+	default:
+		for i := range t.waiters {
+			if t.waiters[i] == w {
+				t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+	return 0, ctx.Err()
+}
+
+// release releases n procs acquired for a task of the named tenant.
+func (f *fairScheduler) release(name string, n int) {
+	f.mu.Lock()
+	f.releaseLocked(f.tenant(name), n)
+	f.mu.Unlock()
+}
+
+func (f *fairScheduler) releaseLocked(t *tenant, n int) {
+	t.procs -= n
+	f.used -= n
+	f.dispatch()
+}
+
+// dispatch grants procs to waiting tasks while any fit: each grant goes
+// to the head of the queue of the tenant with the least weighted usage
+// among those whose head fits. It must be called with f.mu held.
+func (f *fairScheduler) dispatch() {
+	for {
+		var next *tenant
+		for _, t := range f.tenants {
+			if len(t.waiters) == 0 {
+				continue
+			}
+			n := t.waiters[0].n
+			if f.used+n > f.capacity || t.quota.MaxProcs > 0 && t.procs+n > t.quota.MaxProcs {
+				continue
+			}
+			if next == nil || t.share() < next.share() || t.share() == next.share() && t.name < next.name {
+				next = t
+			}
+		}
+		if next == nil {
+			return
+		}
+		w := next.waiters[0]
+		next.waiters = next.waiters[1:]
+		next.procs += w.n
+		f.used += w.n
+		close(w.c)
+	}
+}
+
+// share returns the tenant's usage relative to its weight.
+func (t *tenant) share() float64 {
+	return float64(t.procs) / t.quota.Weight
+}
+
+// startRun waits until an invocation of the named tenant may run
+// within the tenant's quota. endRun must be called once it is done.
+func (f *fairScheduler) startRun(ctx context.Context, name string) error {
+	f.mu.Lock()
+	t := f.tenant(name)
+	f.mu.Unlock()
+	if t.runs != nil {
+		if err := t.runs.Acquire(ctx, 1); err != nil {
+			return errors.E(err, "waiting for a run of tenant ", name)
+		}
+	}
+	f.mu.Lock()
+	t.nruns++
+	f.mu.Unlock()
+	return nil
+}
+
+// endRun ends a run of the named tenant started by startRun.
+func (f *fairScheduler) endRun(name string) {
+	f.mu.Lock()
+	t := f.tenant(name)
+	t.nruns--
+	f.mu.Unlock()
+	if t.runs != nil {
+		t.runs.Release(1)
+	}
+}
+
+// summary describes the tenants that have used the scheduler, ordered
+// by name.
+func (f *fairScheduler) summary() []SummaryTenant {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tenants := make([]SummaryTenant, 0, len(f.tenants))
+	for _, t := range f.tenants {
+		tenants = append(tenants, SummaryTenant{
+			Name:    t.name,
+			Procs:   t.procs,
+			Waiting: len(t.waiters),
+			Runs:    t.nruns,
+		})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestFairScheduler(t *testing.T) {
+	ctx := context.Background()
+	f := newFairScheduler(4, map[string]TenantQuota{
+		"a": {Weight: 1},
+		"b": {Weight: 3},
+		"c": {MaxProcs: 1},
+	})
+	// Tenant a occupies all procs.
+	for i := 0; i < 4; i++ {
+		if n, err := f.acquire(ctx, "a", 1); err != nil || n != 1 {
+			t.Fatalf("got %v, %v, want 1, nil", n, err)
+		}
+	}
+	var (
+		mu      sync.Mutex
+		granted []string
+		wg      sync.WaitGroup
+	)
+	wait := func(name string, n int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.acquire(ctx, name, n); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			granted = append(granted, name)
+			mu.Unlock()
+		}()
+	}
+	waiting := func(want int) {
+		t.Helper()
+		for {
+			var n int
+			for _, tenant := range f.summary() {
+				n += tenant.Waiting
+			}
+			if n == want {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		wait("a", 1)
+		wait("b", 1)
+		wait("b", 1)
+		wait("c", 1)
+	}
+	waiting(8)
+	// Each released proc is granted to the tenant with the least weighted
+	// usage whose next task fits: b (0/3, before c by name), c (0/1), b
+	// (1/3, as c is at its quota), and then a (0/1), whose usage has
+	// dropped as its procs were released.
+	for i := 0; i < 4; i++ {
+		f.release("a", 1)
+		for {
+			mu.Lock()
+			n := len(granted)
+			mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if got, want := granted, []string{"b", "c", "b", "a"}; !equalStrings(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	sum := f.summary()
+	if got, want := len(sum), 3; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := sum[2], (SummaryTenant{Name: "c", Procs: 1, Waiting: 1}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Canceled waiters are dequeued.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := f.acquire(cctx, "c", 1); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	waiting(4)
+	for _, name := range []string{"a", "b", "b", "c"} {
+		f.release(name, 1)
+	}
+	wg.Wait()
+}
+
+func TestTenants(t *testing.T) {
+	var (
+		mu             sync.Mutex
+		running, maxed int
+	)
+	fn := bigslice.Func(func(n int) bigslice.Slice {
+		slice := bigslice.Const(8, rangeSlice(0, n))
+		return bigslice.Map(slice, func(i int) int {
+			mu.Lock()
+			running++
+			if running > maxed {
+				maxed = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return i
+		})
+	})
+	ctx := context.Background()
+	sess := Start(Local, Parallelism(4), Tenants(map[string]TenantQuota{
+		"heavy": {MaxProcs: 1, MaxRuns: 1},
+	}))
+	defer sess.Shutdown()
+	res, err := sess.Run(ctx, fn, 80, RunTenant("heavy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(readFrame(t, res, 80).Interface(0).([]int)), 80; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := maxed, 1; got != want {
+		t.Errorf("got %v concurrent tasks, want %v", got, want)
+	}
+	maxed = 0
+	if _, err := sess.Run(ctx, fn, 80); err != nil {
+		t.Fatal(err)
+	}
+	if maxed < 2 {
+		t.Errorf("got %v concurrent tasks, want more than 1", maxed)
+	}
+	sum := sess.Summary()
+	if got, want := len(sum.Tenants), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := sum.Tenants[1], (SummaryTenant{Name: "heavy"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func equalStrings(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -17,9 +17,13 @@ import (
 // A tracer tracks a set of trace events associated with objects in
 // Bigslice. Trace events are logged in the Chrome tracing format and
 // can be visualized using its built-in visualization tool
-// (chrome://tracing). Each machine is represented as a Chrome "process",
-// and individual task or invocation events are tracked by the machine
-// they are run on.
+// (chrome://tracing) or Perfetto (ui.perfetto.dev). Each machine is
+// represented as a Chrome "process", and individual task or invocation
+// events are tracked by the machine they are run on. Tasks run by the
+// local executor are tracked by the evaluator's process. Retried tasks
+// are shown once for each attempt, and each task's reads of its
+// dependencies are shown as nested events, so that scheduling gaps,
+// stragglers, and slow shuffles can be seen.
 //
 // To produce easier to interpret visualizations, tracer assigns generated
 // virtual "thread IDs" to trace events, and events are also coalesced into
@@ -115,6 +119,19 @@ func (t *tracer) Event(mach *sliceMachine, subject interface{}, ph string, args
 	case *Task:
 		event.Name = arg.Name.String()
 		event.Cat = "task"
+		if ph == "B" {
+			attempt := 1
+			for _, e := range t.taskEvents[arg] {
+				if e.Ph == "B" {
+					attempt++
+				}
+			}
+			event.Args["attempt"] = attempt
+			if attempt > 1 {
+				event.Name = fmt.Sprintf("%s (attempt %d)", event.Name, attempt)
+				event.Cat = "task,retry"
+			}
+		}
 		t.assignTid(mach, ph, t.taskEvents[arg], &event)
 		t.taskEvents[arg] = append(t.taskEvents[arg], event)
 	case execInvocation:
@@ -133,6 +150,48 @@ func (t *tracer) Event(mach *sliceMachine, subject interface{}, ph string, args
 	}
 }
 
+// Read logs the provided read by a task of one of its dependencies as
+// a complete event on the thread of the task's most recent attempt on
+// the provided machine. The read's offsets are relative to start, the
+// time at which the attempt was started. Offsets are measured by the
+// worker, and so are skewed by the latency of starting the task.
+func (t *tracer) Read(mach *sliceMachine, task *Task, start time.Time, read taskRead) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var tid int
+	for _, e := range t.taskEvents[task] {
+		if e.Ph == "B" {
+			tid = e.Tid
+		}
+	}
+	source := read.Addr
+	if source == "" {
+		source = "store"
+	}
+	event := trace.Event{
+		Tid:  tid,
+		Ts:   start.Add(read.Start).Sub(t.firstEvent).Nanoseconds() / 1e3,
+		Dur:  (read.End - read.Start).Nanoseconds() / 1e3,
+		Ph:   "X",
+		Name: "read " + read.Task.String(),
+		Cat:  "read",
+		Args: map[string]interface{}{
+			"source":  source,
+			"records": read.Records,
+		},
+	}
+	if event.Dur == 0 {
+		event.Dur = 1
+	}
+	if mach != nil {
+		event.Pid = t.machinePids[mach]
+	}
+	t.events = append(t.events, event)
+}
+
 // assignTid assigns a thread ID to event, using mach's tid pool and type of
 // event. events is the slices of existing relevant events, e.g.
 // t.taskEvents[arg].
@@ -0,0 +1,113 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/internal/trace"
+)
+
+func runTrace(t *testing.T, sess *Session, fn *bigslice.FuncValue) trace.T {
+	t.Helper()
+	if _, err := sess.Run(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		b  bytes.Buffer
+		tr trace.T
+	)
+	if err := sess.tracer.Marshal(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestTrace(t *testing.T) {
+	const (
+		N      = 1000
+		Nshard = 4
+	)
+	fn := bigslice.Func(func() bigslice.Slice {
+		vals := make([]int, N)
+		for i := range vals {
+			vals[i] = i
+		}
+		return bigslice.Reshuffle(bigslice.Const(Nshard, vals))
+	})
+	for _, executor := range []Option{Local, Bigmachine(testsystem.New())} {
+		sess := Start(executor, Parallelism(Nshard))
+		tr := runTrace(t, sess, fn)
+		sess.Shutdown()
+		var (
+			tasks   int
+			records int64
+		)
+		for _, e := range tr.Events {
+			switch e.Cat {
+			case "task":
+				tasks++
+				if e.Ph != "X" {
+					t.Errorf("task event %s: got %v, want X", e.Name, e.Ph)
+				}
+				if got, want := e.Args["attempt"], 1.0; got != want {
+					t.Errorf("task event %s: got %v, want %v", e.Name, got, want)
+				}
+			case "read":
+				if !strings.HasPrefix(e.Name, "read ") {
+					t.Errorf("bad read event name %s", e.Name)
+				}
+				records += int64(e.Args["records"].(float64))
+			}
+		}
+		if got, want := tasks, 2*Nshard; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		// Shuffle reads are traced only by workers.
+		if _, ok := sess.executor.(*bigmachineExecutor); ok {
+			if got, want := records, int64(N); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestTraceRetries(t *testing.T) {
+	var (
+		tr   = newTracer()
+		task = &Task{Name: TaskName{Op: "op", Shard: 1, NumShard: 2}}
+		b    bytes.Buffer
+	)
+	tr.Event(nil, task, "B")
+	tr.Event(nil, task, "E", "error_type", "lost")
+	tr.Event(nil, task, "B")
+	tr.Event(nil, task, "E")
+	if err := tr.Marshal(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded trace.T
+	if err := decoded.Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(decoded.Events), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, want := range []string{task.Name.String(), task.Name.String() + " (attempt 2)"} {
+		if got := decoded.Events[i].Name; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if got, want := decoded.Events[1].Cat, "task,retry"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
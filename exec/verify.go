@@ -0,0 +1,148 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"runtime/debug"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/metrics"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// An outputDigest summarizes the rows of a task's output, regardless
+// of their order, so that the outputs of two executions of a task may
+// be compared cheaply.
+type outputDigest struct {
+	// Rows is the number of rows in the output.
+	Rows int64
+	// Sum is the sum of the 64-bit hashes of the output's rows.
+	Sum uint64
+}
+
+// verifyReply is the reply payload for Worker.Verify.
+type verifyReply struct {
+	// Stored is the digest of the task's stored output; Rerun is the
+	// digest of the output of its re-execution.
+	Stored, Rerun outputDigest
+}
+
+// verifies returns whether the session verifies that the provided
+// task is deterministic. Tasks are sampled by name, so that the same
+// tasks are verified by every run of an invocation. Tasks whose
+// outputs are combined or truncated, or have columns that cannot be
+// hashed, are never verified.
+func (s *Session) verifies(task *Task) bool {
+	if s.verifyFraction <= 0 || !task.Combiner.IsNil() || task.NumOut() == 0 || task.truncated {
+		return false
+	}
+	for i := 0; i < task.NumOut(); i++ {
+		if !frame.CanHash(task.Out(i)) {
+			return false
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(task.Name.String())) // nolint: errcheck
+	return float64(h.Sum64())/math.MaxUint64 < s.verifyFraction
+}
+
+// digest reads the output of task from the provided reader and returns
+// its digest.
+func digest(ctx context.Context, task *Task, r sliceio.Reader) (outputDigest, error) {
+	var (
+		d  outputDigest
+		in = frame.Make(task, *defaultChunksize, *defaultChunksize)
+	)
+	// Rows are hashed in full.
+	in = in.Prefixed(in.NumOut())
+	for {
+		n, err := r.Read(ctx, in)
+		for i := 0; i < n; i++ {
+			d.Sum += uint64(in.HashWithSeed(i, 0x9e3779b9))<<32 | uint64(in.HashWithSeed(i, 0x85ebca6b))
+		}
+		d.Rows += int64(n)
+		if err == sliceio.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return d, err
+		}
+	}
+}
+
+// errNondeterministic returns the error with which a task fails when
+// the outputs of two of its executions differ.
+func errNondeterministic(task *Task, first, second outputDigest) error {
+	return errors.E(errors.Fatal, errors.Invalid, fmt.Sprintf(
+		"task %v is not deterministic: re-execution produced %d rows with digest %x, but its output has %d rows with digest %x; "+
+			"check its funcs for, e.g., map iteration order, time.Now, or unseeded random numbers",
+		task, second.Rows, second.Sum, first.Rows, first.Sum))
+}
+
+// verifyRemote verifies that the task, run by the provided request on
+// machine m, is deterministic, by re-executing it on m. Failures to
+// verify the task are logged, and are not otherwise errors.
+func verifyRemote(ctx context.Context, m workerClient, task *Task, req taskRunRequest) error {
+	task.Status.Print("verifying determinism")
+	var reply verifyReply
+	if err := m.RetryCall(ctx, "Worker.Verify", req, &reply); err != nil {
+		log.Error.Printf("task %v: could not verify determinism: %v", task, err)
+		return nil
+	}
+	if reply.Stored != reply.Rerun {
+		return errNondeterministic(task, reply.Stored, reply.Rerun)
+	}
+	return nil
+}
+
+// Verify re-executes the completed task of the provided run request,
+// and returns the digests of its stored output and of the output of
+// its re-execution, which is discarded.
+func (w *worker) Verify(ctx context.Context, req taskRunRequest, reply *verifyReply) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.E(errors.Fatal, fmt.Sprintf("panic while verifying task %s: %v\n%s", req.Name, e, debug.Stack()))
+		}
+	}()
+	w.mu.Lock()
+	named := w.tasks[req.Invocation]
+	w.mu.Unlock()
+	task := named[req.Name]
+	if task == nil || task.State() != TaskOk {
+		return errors.E(errors.NotExist, fmt.Sprintf("task %s has not completed", req.Name))
+	}
+	// Metrics updated by the re-execution are discarded with it.
+	ctx = metrics.ScopedContext(ctx, new(metrics.Scope))
+	untraced := func(r sliceio.Reader, _ TaskName, _ string) sliceio.Reader { return r }
+	in, closers, err := w.taskInputs(ctx, task, req, inputStats{}, untraced)
+	defer func() {
+		for _, c := range closers {
+			c.Close() // nolint: errcheck
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	if reply.Rerun, err = digest(ctx, task, task.Do(in)); err != nil {
+		return err
+	}
+	stored := new(multiReader)
+	for p := 0; p < task.NumPartition; p++ {
+		rc, err := w.storeOf(task.Name).Open(ctx, task.Name, p, 0)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, rc)
+		stored.q = append(stored.q, sliceio.NewDecodingReader(rc))
+	}
+	reply.Stored, err = digest(ctx, task, stored)
+	return err
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package exec
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigmachine/testsystem"
+	"github.com/grailbio/bigslice"
+)
+
+func TestVerifyDeterminism(t *testing.T) {
+	const N = 1000
+	var calls int64
+	deterministic := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, N))
+		slice = bigslice.Map(slice, func(i int) (int, int) { return i % 7, i })
+		return bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	})
+	nondeterministic := bigslice.Func(func() bigslice.Slice {
+		slice := bigslice.Const(4, rangeSlice(0, N))
+		return bigslice.Map(slice, func(i int) int { return i + int(atomic.AddInt64(&calls, 1)) })
+	})
+	for _, executor := range []Option{Local, Bigmachine(testsystem.New())} {
+		sess := Start(executor, VerifyDeterminism(1))
+		ctx := context.Background()
+		if _, err := sess.Run(ctx, deterministic); err != nil {
+			t.Errorf("%s: %v", sess.executor.Name(), err)
+		}
+		_, err := sess.Run(ctx, nondeterministic)
+		if err == nil || !strings.Contains(err.Error(), "is not deterministic") {
+			t.Errorf("%s: got %v, want non-determinism error", sess.executor.Name(), err)
+		}
+		sess.Shutdown()
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package frame
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// The typed column accessors in accessors_builtin.go provide direct
+// access to columns of builtin kinds, bypassing the overhead of
+// reflect.Value in hot loops: XCol returns a column as a typed slice
+// that shares the frame's storage, and XAt and SetXAt read and write a
+// single row without any checks, except in debug builds (those built
+// with the tag bigslice_debug), in which column types and row indices
+// are checked. Accessors apply to columns whose underlying type is the
+// accessor's type, so that, e.g., Int64Col may be used with a column of
+// type time.Duration. TimeCol and DecimalCol similarly provide typed
+// access to columns of the natively supported types time.Time and
+// slicetype.Decimal.
+
+// checkKind panics if column col of f is not of the provided kind. The
+// name of the calling accessor is used in the panic message.
+func (f Frame) checkKind(col int, kind reflect.Kind, name string) {
+	if col < 0 || col >= len(f.data) {
+		panic(fmt.Sprintf("frame.%s: column %d is out of range for frame with %d columns", name, col, len(f.data)))
+	}
+	if typ := f.data[col].typ.Type; typ.Kind() != kind {
+		panic(fmt.Sprintf("frame.%s: column %d has type %s, not %s", name, col, typ, kind))
+	}
+}
+
+// checkIndex performs checkKind, and panics also if row i is out of
+// the frame's range.
+func (f Frame) checkIndex(col, i int, kind reflect.Kind, name string) {
+	f.checkKind(col, kind, name)
+	if i < 0 || i >= f.len {
+		panic(fmt.Sprintf("frame.%s: index %d out of range [0:%d]", name, i, f.len))
+	}
+}
+
+// sliceHeader returns the header of the slice that represents column
+// col of f.
+func (f Frame) sliceHeader(col int) sliceHeader {
+	return sliceHeader{
+		Data: add(f.data[col].ptr, uintptr(f.off)*f.data[col].typ.size),
+		Len:  f.len,
+		Cap:  f.cap,
+	}
+}
+
+// addr returns the address of row i of column col of f.
+func (f Frame) addr(col, i int) unsafe.Pointer {
+	return add(f.data[col].ptr, uintptr(f.off+i)*f.data[col].typ.size)
+}
+
+var (
+	typeOfTime    = reflect.TypeOf(time.Time{})
+	typeOfDecimal = reflect.TypeOf(slicetype.Decimal{})
+)
+
+// checkType panics if column col of f is not of the provided type.
+func (f Frame) checkType(col int, typ reflect.Type, name string) {
+	if col < 0 || col >= len(f.data) {
+		panic(fmt.Sprintf("frame.%s: column %d is out of range for frame with %d columns", name, col, len(f.data)))
+	}
+	if t := f.data[col].typ.Type; t != typ {
+		panic(fmt.Sprintf("frame.%s: column %d has type %s, not %s", name, col, t, typ))
+	}
+}
+
+// TimeCol returns column col of frame f as a []time.Time that shares
+// f's storage. It panics if the column is not of type time.Time.
+func TimeCol(f Frame, col int) []time.Time {
+	f.checkType(col, typeOfTime, "TimeCol")
+	h := f.sliceHeader(col)
+	return *(*[]time.Time)(unsafe.Pointer(&h))
+}
+
+// DecimalCol returns column col of frame f as a []slicetype.Decimal
+// that shares f's storage. It panics if the column is not of type
+// slicetype.Decimal.
+func DecimalCol(f Frame, col int) []slicetype.Decimal {
+	f.checkType(col, typeOfDecimal, "DecimalCol")
+	h := f.sliceHeader(col)
+	return *(*[]slicetype.Decimal)(unsafe.Pointer(&h))
+}
+
+// String columns are stored as Go strings, so that they may be passed
+// to, and retained by, user functions without conversion.
+// SetStringsFromBytes sets a column's values from their concatenated
+// bytes, e.g., when they are decoded.
+
+// SetStringsFromBytes sets the first len(lens) rows of column col of
+// frame f, whose underlying type must be string, to consecutive
+// substrings of b with the provided lengths, which must sum to len(b).
+// Each row is set to its own copy, so that retaining a row does not
+// retain the memory of the others.
+func SetStringsFromBytes(f Frame, col int, b []byte, lens []int) {
+	vals := StringCol(f, col)
+	if len(lens) > len(vals) {
+		panic(fmt.Sprintf("frame.SetStringsFromBytes: %d lengths for frame of length %d", len(lens), len(vals)))
+	}
+	var off int
+	for i, n := range lens {
+		if n < 0 || off+n > len(b) {
+			panic("frame.SetStringsFromBytes: lengths exceed bytes")
+		}
+		vals[i] = string(b[off : off+n])
+		off += n
+	}
+	if off != len(b) {
+		panic("frame.SetStringsFromBytes: lengths do not cover bytes")
+	}
+}
@@ -0,0 +1,400 @@
+// THIS FILE WAS AUTOMATICALLY GENERATED. DO NOT EDIT.
+
+package frame
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// StringCol returns column col of frame f as a []string that shares
+// f's storage. It panics if the column's underlying type is not string.
+func StringCol(f Frame, col int) []string {
+	f.checkKind(col, reflect.String, "StringCol")
+	h := f.sliceHeader(col)
+	return *(*[]string)(unsafe.Pointer(&h))
+}
+
+// StringAt returns row i of column col of frame f, whose underlying
+// type must be string. The column's type and the row index are checked
+// only in debug builds.
+func StringAt(f Frame, col, i int) string {
+	if debug {
+		f.checkIndex(col, i, reflect.String, "StringAt")
+	}
+	return *(*string)(f.addr(col, i))
+}
+
+// SetStringAt sets row i of column col of frame f, whose underlying
+// type must be string, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetStringAt(f Frame, col, i int, v string) {
+	if debug {
+		f.checkIndex(col, i, reflect.String, "SetStringAt")
+	}
+	*(*string)(f.addr(col, i)) = v
+}
+
+// UintCol returns column col of frame f as a []uint that shares
+// f's storage. It panics if the column's underlying type is not uint.
+func UintCol(f Frame, col int) []uint {
+	f.checkKind(col, reflect.Uint, "UintCol")
+	h := f.sliceHeader(col)
+	return *(*[]uint)(unsafe.Pointer(&h))
+}
+
+// UintAt returns row i of column col of frame f, whose underlying
+// type must be uint. The column's type and the row index are checked
+// only in debug builds.
+func UintAt(f Frame, col, i int) uint {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint, "UintAt")
+	}
+	return *(*uint)(f.addr(col, i))
+}
+
+// SetUintAt sets row i of column col of frame f, whose underlying
+// type must be uint, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUintAt(f Frame, col, i int, v uint) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint, "SetUintAt")
+	}
+	*(*uint)(f.addr(col, i)) = v
+}
+
+// Uint8Col returns column col of frame f as a []uint8 that shares
+// f's storage. It panics if the column's underlying type is not uint8.
+func Uint8Col(f Frame, col int) []uint8 {
+	f.checkKind(col, reflect.Uint8, "Uint8Col")
+	h := f.sliceHeader(col)
+	return *(*[]uint8)(unsafe.Pointer(&h))
+}
+
+// Uint8At returns row i of column col of frame f, whose underlying
+// type must be uint8. The column's type and the row index are checked
+// only in debug builds.
+func Uint8At(f Frame, col, i int) uint8 {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint8, "Uint8At")
+	}
+	return *(*uint8)(f.addr(col, i))
+}
+
+// SetUint8At sets row i of column col of frame f, whose underlying
+// type must be uint8, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUint8At(f Frame, col, i int, v uint8) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint8, "SetUint8At")
+	}
+	*(*uint8)(f.addr(col, i)) = v
+}
+
+// Uint16Col returns column col of frame f as a []uint16 that shares
+// f's storage. It panics if the column's underlying type is not uint16.
+func Uint16Col(f Frame, col int) []uint16 {
+	f.checkKind(col, reflect.Uint16, "Uint16Col")
+	h := f.sliceHeader(col)
+	return *(*[]uint16)(unsafe.Pointer(&h))
+}
+
+// Uint16At returns row i of column col of frame f, whose underlying
+// type must be uint16. The column's type and the row index are checked
+// only in debug builds.
+func Uint16At(f Frame, col, i int) uint16 {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint16, "Uint16At")
+	}
+	return *(*uint16)(f.addr(col, i))
+}
+
+// SetUint16At sets row i of column col of frame f, whose underlying
+// type must be uint16, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUint16At(f Frame, col, i int, v uint16) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint16, "SetUint16At")
+	}
+	*(*uint16)(f.addr(col, i)) = v
+}
+
+// Uint32Col returns column col of frame f as a []uint32 that shares
+// f's storage. It panics if the column's underlying type is not uint32.
+func Uint32Col(f Frame, col int) []uint32 {
+	f.checkKind(col, reflect.Uint32, "Uint32Col")
+	h := f.sliceHeader(col)
+	return *(*[]uint32)(unsafe.Pointer(&h))
+}
+
+// Uint32At returns row i of column col of frame f, whose underlying
+// type must be uint32. The column's type and the row index are checked
+// only in debug builds.
+func Uint32At(f Frame, col, i int) uint32 {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint32, "Uint32At")
+	}
+	return *(*uint32)(f.addr(col, i))
+}
+
+// SetUint32At sets row i of column col of frame f, whose underlying
+// type must be uint32, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUint32At(f Frame, col, i int, v uint32) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint32, "SetUint32At")
+	}
+	*(*uint32)(f.addr(col, i)) = v
+}
+
+// Uint64Col returns column col of frame f as a []uint64 that shares
+// f's storage. It panics if the column's underlying type is not uint64.
+func Uint64Col(f Frame, col int) []uint64 {
+	f.checkKind(col, reflect.Uint64, "Uint64Col")
+	h := f.sliceHeader(col)
+	return *(*[]uint64)(unsafe.Pointer(&h))
+}
+
+// Uint64At returns row i of column col of frame f, whose underlying
+// type must be uint64. The column's type and the row index are checked
+// only in debug builds.
+func Uint64At(f Frame, col, i int) uint64 {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint64, "Uint64At")
+	}
+	return *(*uint64)(f.addr(col, i))
+}
+
+// SetUint64At sets row i of column col of frame f, whose underlying
+// type must be uint64, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUint64At(f Frame, col, i int, v uint64) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uint64, "SetUint64At")
+	}
+	*(*uint64)(f.addr(col, i)) = v
+}
+
+// IntCol returns column col of frame f as a []int that shares
+// f's storage. It panics if the column's underlying type is not int.
+func IntCol(f Frame, col int) []int {
+	f.checkKind(col, reflect.Int, "IntCol")
+	h := f.sliceHeader(col)
+	return *(*[]int)(unsafe.Pointer(&h))
+}
+
+// IntAt returns row i of column col of frame f, whose underlying
+// type must be int. The column's type and the row index are checked
+// only in debug builds.
+func IntAt(f Frame, col, i int) int {
+	if debug {
+		f.checkIndex(col, i, reflect.Int, "IntAt")
+	}
+	return *(*int)(f.addr(col, i))
+}
+
+// SetIntAt sets row i of column col of frame f, whose underlying
+// type must be int, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetIntAt(f Frame, col, i int, v int) {
+	if debug {
+		f.checkIndex(col, i, reflect.Int, "SetIntAt")
+	}
+	*(*int)(f.addr(col, i)) = v
+}
+
+// Int8Col returns column col of frame f as a []int8 that shares
+// f's storage. It panics if the column's underlying type is not int8.
+func Int8Col(f Frame, col int) []int8 {
+	f.checkKind(col, reflect.Int8, "Int8Col")
+	h := f.sliceHeader(col)
+	return *(*[]int8)(unsafe.Pointer(&h))
+}
+
+// Int8At returns row i of column col of frame f, whose underlying
+// type must be int8. The column's type and the row index are checked
+// only in debug builds.
+func Int8At(f Frame, col, i int) int8 {
+	if debug {
+		f.checkIndex(col, i, reflect.Int8, "Int8At")
+	}
+	return *(*int8)(f.addr(col, i))
+}
+
+// SetInt8At sets row i of column col of frame f, whose underlying
+// type must be int8, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetInt8At(f Frame, col, i int, v int8) {
+	if debug {
+		f.checkIndex(col, i, reflect.Int8, "SetInt8At")
+	}
+	*(*int8)(f.addr(col, i)) = v
+}
+
+// Int16Col returns column col of frame f as a []int16 that shares
+// f's storage. It panics if the column's underlying type is not int16.
+func Int16Col(f Frame, col int) []int16 {
+	f.checkKind(col, reflect.Int16, "Int16Col")
+	h := f.sliceHeader(col)
+	return *(*[]int16)(unsafe.Pointer(&h))
+}
+
+// Int16At returns row i of column col of frame f, whose underlying
+// type must be int16. The column's type and the row index are checked
+// only in debug builds.
+func Int16At(f Frame, col, i int) int16 {
+	if debug {
+		f.checkIndex(col, i, reflect.Int16, "Int16At")
+	}
+	return *(*int16)(f.addr(col, i))
+}
+
+// SetInt16At sets row i of column col of frame f, whose underlying
+// type must be int16, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetInt16At(f Frame, col, i int, v int16) {
+	if debug {
+		f.checkIndex(col, i, reflect.Int16, "SetInt16At")
+	}
+	*(*int16)(f.addr(col, i)) = v
+}
+
+// Int32Col returns column col of frame f as a []int32 that shares
+// f's storage. It panics if the column's underlying type is not int32.
+func Int32Col(f Frame, col int) []int32 {
+	f.checkKind(col, reflect.Int32, "Int32Col")
+	h := f.sliceHeader(col)
+	return *(*[]int32)(unsafe.Pointer(&h))
+}
+
+// Int32At returns row i of column col of frame f, whose underlying
+// type must be int32. The column's type and the row index are checked
+// only in debug builds.
+func Int32At(f Frame, col, i int) int32 {
+	if debug {
+		f.checkIndex(col, i, reflect.Int32, "Int32At")
+	}
+	return *(*int32)(f.addr(col, i))
+}
+
+// SetInt32At sets row i of column col of frame f, whose underlying
+// type must be int32, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetInt32At(f Frame, col, i int, v int32) {
+	if debug {
+		f.checkIndex(col, i, reflect.Int32, "SetInt32At")
+	}
+	*(*int32)(f.addr(col, i)) = v
+}
+
+// Int64Col returns column col of frame f as a []int64 that shares
+// f's storage. It panics if the column's underlying type is not int64.
+func Int64Col(f Frame, col int) []int64 {
+	f.checkKind(col, reflect.Int64, "Int64Col")
+	h := f.sliceHeader(col)
+	return *(*[]int64)(unsafe.Pointer(&h))
+}
+
+// Int64At returns row i of column col of frame f, whose underlying
+// type must be int64. The column's type and the row index are checked
+// only in debug builds.
+func Int64At(f Frame, col, i int) int64 {
+	if debug {
+		f.checkIndex(col, i, reflect.Int64, "Int64At")
+	}
+	return *(*int64)(f.addr(col, i))
+}
+
+// SetInt64At sets row i of column col of frame f, whose underlying
+// type must be int64, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetInt64At(f Frame, col, i int, v int64) {
+	if debug {
+		f.checkIndex(col, i, reflect.Int64, "SetInt64At")
+	}
+	*(*int64)(f.addr(col, i)) = v
+}
+
+// Float32Col returns column col of frame f as a []float32 that shares
+// f's storage. It panics if the column's underlying type is not float32.
+func Float32Col(f Frame, col int) []float32 {
+	f.checkKind(col, reflect.Float32, "Float32Col")
+	h := f.sliceHeader(col)
+	return *(*[]float32)(unsafe.Pointer(&h))
+}
+
+// Float32At returns row i of column col of frame f, whose underlying
+// type must be float32. The column's type and the row index are checked
+// only in debug builds.
+func Float32At(f Frame, col, i int) float32 {
+	if debug {
+		f.checkIndex(col, i, reflect.Float32, "Float32At")
+	}
+	return *(*float32)(f.addr(col, i))
+}
+
+// SetFloat32At sets row i of column col of frame f, whose underlying
+// type must be float32, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetFloat32At(f Frame, col, i int, v float32) {
+	if debug {
+		f.checkIndex(col, i, reflect.Float32, "SetFloat32At")
+	}
+	*(*float32)(f.addr(col, i)) = v
+}
+
+// Float64Col returns column col of frame f as a []float64 that shares
+// f's storage. It panics if the column's underlying type is not float64.
+func Float64Col(f Frame, col int) []float64 {
+	f.checkKind(col, reflect.Float64, "Float64Col")
+	h := f.sliceHeader(col)
+	return *(*[]float64)(unsafe.Pointer(&h))
+}
+
+// Float64At returns row i of column col of frame f, whose underlying
+// type must be float64. The column's type and the row index are checked
+// only in debug builds.
+func Float64At(f Frame, col, i int) float64 {
+	if debug {
+		f.checkIndex(col, i, reflect.Float64, "Float64At")
+	}
+	return *(*float64)(f.addr(col, i))
+}
+
+// SetFloat64At sets row i of column col of frame f, whose underlying
+// type must be float64, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetFloat64At(f Frame, col, i int, v float64) {
+	if debug {
+		f.checkIndex(col, i, reflect.Float64, "SetFloat64At")
+	}
+	*(*float64)(f.addr(col, i)) = v
+}
+
+// UintptrCol returns column col of frame f as a []uintptr that shares
+// f's storage. It panics if the column's underlying type is not uintptr.
+func UintptrCol(f Frame, col int) []uintptr {
+	f.checkKind(col, reflect.Uintptr, "UintptrCol")
+	h := f.sliceHeader(col)
+	return *(*[]uintptr)(unsafe.Pointer(&h))
+}
+
+// UintptrAt returns row i of column col of frame f, whose underlying
+// type must be uintptr. The column's type and the row index are checked
+// only in debug builds.
+func UintptrAt(f Frame, col, i int) uintptr {
+	if debug {
+		f.checkIndex(col, i, reflect.Uintptr, "UintptrAt")
+	}
+	return *(*uintptr)(f.addr(col, i))
+}
+
+// SetUintptrAt sets row i of column col of frame f, whose underlying
+// type must be uintptr, to v. The column's type and the row index are
+// checked only in debug builds.
+func SetUintptrAt(f Frame, col, i int, v uintptr) {
+	if debug {
+		f.checkIndex(col, i, reflect.Uintptr, "SetUintptrAt")
+	}
+	*(*uintptr)(f.addr(col, i)) = v
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package frame
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func TestColumnAccessors(t *testing.T) {
+	f := Slices([]int64{0, 1, 2, 3, 4}, []string{"a", "b", "c", "d", "e"}, []time.Duration{0, 1, 2, 3, 4})
+	g := f.Slice(2, 4)
+	ints := Int64Col(g, 0)
+	if got, want := ints, []int64{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Columns share the frame's storage.
+	ints[0] = 100
+	if got, want := f.Index(0, 2).Int(), int64(100); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := StringCol(g, 1), []string{"c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := StringAt(g, 1, 1), "d"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	SetStringAt(g, 1, 1, "x")
+	if got, want := f.Index(1, 3).String(), "x"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Accessors apply to columns by their underlying type.
+	if got, want := Int64At(g, 2, 1), int64(3); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(Int64Col(f, 2)), 5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestColumnAccessorTypeCheck(t *testing.T) {
+	f := Slices([]int32{1, 2, 3})
+	defer func() {
+		if e := recover(); e == nil {
+			t.Error("expected panic")
+		}
+	}()
+	Int64Col(f, 0)
+}
+
+func BenchmarkColumnAccess(b *testing.B) {
+	const N = 1 << 12
+	f := Make(testType, N, N)
+	b.Run("reflect", func(b *testing.B) {
+		var sum int64
+		for k := 0; k < b.N; k++ {
+			for i := 0; i < N; i++ {
+				sum += f.Index(1, i).Int()
+			}
+		}
+	})
+	b.Run("Col", func(b *testing.B) {
+		var sum int
+		for k := 0; k < b.N; k++ {
+			for _, x := range IntCol(f, 1) {
+				sum += x
+			}
+		}
+	})
+	b.Run("At", func(b *testing.B) {
+		var sum int
+		for k := 0; k < b.N; k++ {
+			for i := 0; i < N; i++ {
+				sum += IntAt(f, 1, i)
+			}
+		}
+	})
+}
+
+func TestStringsFromBytes(t *testing.T) {
+	f := Make(slicetype.New(reflect.TypeOf("")), 4, 4)
+	SetStringsFromBytes(f, 0, []byte("abcdef"), []int{1, 0, 2, 3})
+	if got, want := StringCol(f, 0), []string{"a", "", "bc", "def"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		SetStringsFromBytes(f, 0, []byte("abc"), []int{1, 1})
+	}()
+}
@@ -0,0 +1,12 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !bigslice_debug
+// +build !bigslice_debug
+
+package frame
+
+// debug tells whether the package is built in debug mode, in which the
+// unchecked typed accessors check their arguments.
+const debug = false
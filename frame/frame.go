@@ -59,6 +59,9 @@ type data struct {
 	val reflect.Value
 	// Ops is a set of operators on the column's data.
 	ops Ops
+	// Nulls is the column's null bitmap, or nil if the column holds no
+	// nulls. See nulls.go.
+	nulls []uint64
 }
 
 // NewData constructs a new data from the provided reflect.Value.
@@ -107,6 +110,9 @@ func Make(types slicetype.Type, len, cap int) Frame {
 	for i := range f.data {
 		v := reflect.MakeSlice(reflect.SliceOf(types.Out(i)), cap, cap)
 		f.data[i] = newData(v)
+		if slicetype.Nullable(types, i) {
+			f.data[i].nulls = makeNulls(cap)
+		}
 	}
 	return f
 }
@@ -163,7 +169,8 @@ func Values(cols []reflect.Value) Frame {
 }
 
 // Copy copies the contents of src until either dst has been filled
-// or src exhausted. It returns the number of elements copied.
+// or src exhausted. It returns the number of elements copied. Nulls
+// are copied along with the values.
 func Copy(dst, src Frame) (n int) {
 	if !Compatible(dst, src) {
 		panic("frame.Copy: incompatible frames dst=" + dst.String() + " src=" + src.String())
@@ -179,6 +186,7 @@ func Copy(dst, src Frame) (n int) {
 				add(dst.data[i].ptr, uintptr(dst.off)*typ.size),
 				add(src.data[i].ptr, uintptr(src.off)*typ.size))
 		}
+		dst.copyNulls(src, 1)
 		return 1
 	}
 	for i := range dst.data {
@@ -195,6 +203,7 @@ func Copy(dst, src Frame) (n int) {
 		}
 		n = typedslicecopy(typ.ptr, dh, sh)
 	}
+	dst.copyNulls(src, n)
 	return
 }
 
@@ -350,13 +359,23 @@ func (f Frame) Prefixed(prefix int) Frame {
 func (f Frame) Swap(i, j int) {
 	for k := range f.data {
 		f.data[k].ops.swap(i-f.off, j-f.off)
+		if nulls := f.data[k].nulls; nulls != nil {
+			ni, nj := nullAt(nulls, i-f.off), nullAt(nulls, j-f.off)
+			setNullAt(nulls, i-f.off, nj)
+			setNullAt(nulls, j-f.off, ni)
+		}
 	}
 }
 
-// Zero zeros the memory all columnns.
+// Zero zeros the memory all columnns, and clears their nulls.
 func (f Frame) Zero() {
 	for _, col := range f.data {
 		zero.Unsafe(col.typ.Type, uintptr(col.ptr)+uintptr(f.off)*col.typ.size, f.len)
+		if col.nulls != nil {
+			for i := f.off; i < f.off+f.len; i++ {
+				setNullAt(col.nulls, i, false)
+			}
+		}
 	}
 }
 
@@ -379,6 +398,13 @@ func (f Frame) Less(i, j int) bool {
 	return f.data[f.prefix].ops.Less(i+f.off, j+f.off)
 }
 
+// LessColumn reports whether the value at row i of column col should sort
+// before the value at row j. It is available only if the operation is
+// defined for the column's type. See RegisterOps for more details.
+func (f Frame) LessColumn(col, i, j int) bool {
+	return f.data[col].ops.Less(i+f.off, j+f.off)
+}
+
 // Hash returns a 32-bit hash of the prefix columns of frame f with
 // a seed of 0.
 func (f Frame) Hash(i int) uint32 {
@@ -436,7 +462,11 @@ func (f Frame) WriteTab(w io.Writer) {
 	values := make([]string, f.NumOut())
 	for i := 0; i < f.Len(); i++ {
 		for j := range values {
-			values[j] = fmt.Sprint(f.Index(j, i))
+			if f.IsNull(j, i) {
+				values[j] = "null"
+			} else {
+				values[j] = fmt.Sprint(f.Index(j, i))
+			}
 		}
 		fmt.Fprintln(&tw, strings.Join(values, "\t"))
 	}
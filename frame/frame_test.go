@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"sort"
 	"testing"
+	"time"
 	"unsafe"
 
 	fuzz "github.com/google/gofuzz"
@@ -375,3 +376,38 @@ func BenchmarkSortFrameSlice(b *testing.B) {
 		shuffle()
 	}
 }
+
+func TestTimeOps(t *testing.T) {
+	utc := time.Unix(100, 5).UTC()
+	local := utc.In(time.FixedZone("X", 3600))
+	f := Slices([]time.Time{utc, local, utc.Add(time.Nanosecond)})
+	if f.Less(0, 1) || f.Less(1, 0) {
+		t.Error("equal instants in different locations are ordered")
+	}
+	if !f.Less(1, 2) {
+		t.Error("times are not ordered by instant")
+	}
+	if got, want := f.HashWithSeed(1, 0), f.HashWithSeed(0, 0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDecimalOps(t *testing.T) {
+	f := Slices([]slicetype.Decimal{
+		slicetype.NewDecimal(15, 1),
+		slicetype.NewDecimal(150, 2),
+		slicetype.NewDecimal(-2, 0),
+	})
+	if f.Less(0, 1) || f.Less(1, 0) {
+		t.Error("equal decimals with different scales are ordered")
+	}
+	if !f.Less(2, 0) {
+		t.Error("decimals are not ordered by value")
+	}
+	if got, want := f.HashWithSeed(1, 0), f.HashWithSeed(0, 0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := DecimalCol(f, 0)[2], slicetype.NewDecimal(-2, 0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
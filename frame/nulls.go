@@ -0,0 +1,144 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package frame
+
+import "math/bits"
+
+// Nulls are represented by a per-column bitmap, indexed in the same
+// manner as the column's underlying slice: bit i is set if row i of
+// the underlying slice is null. Columns without a bitmap hold no
+// nulls. Bitmaps are allocated when a frame is made with a nullable
+// type (see slicetype.NullableType) or lazily, when a null is first
+// set or copied into a column; like the column data, they are shared
+// between frames that are sliced from the same frame.
+
+// makeNulls returns a bitmap for n rows.
+func makeNulls(n int) []uint64 {
+	return make([]uint64, (n+63)/64)
+}
+
+// nullAt tells whether bit i of the provided bitmap is set.
+func nullAt(nulls []uint64, i int) bool {
+	return nulls[i/64]&(1<<uint(i%64)) != 0
+}
+
+// setNullAt sets bit i of the provided bitmap to null.
+func setNullAt(nulls []uint64, i int, null bool) {
+	if null {
+		nulls[i/64] |= 1 << uint(i%64)
+	} else {
+		nulls[i/64] &^= 1 << uint(i%64)
+	}
+}
+
+// Nullable tells whether column col may hold nulls. Frames that are
+// made from nullable types have nullable columns; other columns become
+// nullable once a null is set or copied into them. Nullable implements
+// slicetype.NullableType, so that frames made from a frame retain its
+// nullable columns.
+func (f Frame) Nullable(col int) bool {
+	return f.data[col].nulls != nil
+}
+
+// IsNull tells whether the i'th row of the col'th column is null.
+// The values of null rows are undefined, and are typically the zero
+// value of the column's type.
+func (f Frame) IsNull(col, i int) bool {
+	nulls := f.data[col].nulls
+	return nulls != nil && nullAt(nulls, f.off+i)
+}
+
+// SetNull sets whether the i'th row of the col'th column is null. The
+// row's value is left unchanged. Since bitmaps may be allocated by
+// SetNull, it should not be called concurrently for frames that share
+// columns.
+func (f Frame) SetNull(col, i int, null bool) {
+	if i < 0 || i >= f.len {
+		panic("frame.SetNull: index out of range")
+	}
+	d := &f.data[col]
+	if d.nulls == nil {
+		if !null {
+			return
+		}
+		d.nulls = makeNulls(d.val.Cap())
+	}
+	setNullAt(d.nulls, f.off+i, null)
+}
+
+// NullCount returns the number of null rows in column col.
+func (f Frame) NullCount(col int) int {
+	nulls := f.data[col].nulls
+	if nulls == nil {
+		return 0
+	}
+	var n int
+	for i := f.off; i < f.off+f.len; {
+		if i%64 == 0 && i+64 <= f.off+f.len {
+			n += bits.OnesCount64(nulls[i/64])
+			i += 64
+			continue
+		}
+		if nullAt(nulls, i) {
+			n++
+		}
+		i++
+	}
+	return n
+}
+
+// copyNulls copies the nulls of the first n rows of src to dst,
+// allocating bitmaps in dst only if src has nulls to copy.
+func (f Frame) copyNulls(src Frame, n int) {
+	for col := range f.data {
+		dst, srcNulls := &f.data[col], src.data[col].nulls
+		if srcNulls == nil && dst.nulls == nil {
+			continue
+		}
+		if dst.nulls == nil {
+			if src.Slice(0, n).NullCount(col) == 0 {
+				continue
+			}
+			dst.nulls = makeNulls(dst.val.Cap())
+		}
+		// Copy backwards if dst follows src, as the two may be the same
+		// column.
+		if f.off > src.off {
+			for i := n - 1; i >= 0; i-- {
+				setNullAt(dst.nulls, f.off+i, srcNulls != nil && nullAt(srcNulls, src.off+i))
+			}
+		} else {
+			for i := 0; i < n; i++ {
+				setNullAt(dst.nulls, f.off+i, srcNulls != nil && nullAt(srcNulls, src.off+i))
+			}
+		}
+	}
+}
+
+// NullWords returns a bitmap of the nulls in column col, whose bit i
+// is set if row i of the frame is null, or nil if the column has no
+// nulls. It is used to encode a column's nulls.
+func (f Frame) NullWords(col int) []uint64 {
+	if f.NullCount(col) == 0 {
+		return nil
+	}
+	words := makeNulls(f.len)
+	for i := 0; i < f.len; i++ {
+		if f.IsNull(col, i) {
+			setNullAt(words, i, true)
+		}
+	}
+	return words
+}
+
+// SetNullWords sets the nulls of column col from a bitmap as returned
+// by NullWords.
+func (f Frame) SetNullWords(col int, words []uint64) {
+	for i := 0; i < f.len && i/64 < len(words); i++ {
+		if nullAt(words, i) {
+			f.SetNull(col, i, true)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package frame
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func nullRows(f Frame, col int) []int {
+	var rows []int
+	for i := 0; i < f.Len(); i++ {
+		if f.IsNull(col, i) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+func TestNulls(t *testing.T) {
+	f := Make(slicetype.WithNullable(testType, 1), 200, 200)
+	if f.Nullable(0) || !f.Nullable(1) {
+		t.Fatal("wrong nullable columns")
+	}
+	if got, want := slicetype.String(f), "slice[1]string,int?"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i := 0; i < f.Len(); i += 3 {
+		f.SetNull(1, i, true)
+	}
+	if got, want := f.NullCount(1), 67; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Nulls are copied into columns that are not nullable.
+	g := Make(testType, 100, 100)
+	if g.Nullable(1) {
+		t.Fatal("column should not be nullable")
+	}
+	if got, want := Copy(g, f.Slice(100, 200)), 100; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !g.Nullable(1) {
+		t.Fatal("column should be nullable")
+	}
+	for i := 0; i < g.Len(); i++ {
+		if got, want := g.IsNull(1, i), (i+100)%3 == 0; got != want {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+	}
+	if got, want := f.Slice(100, 200).NullCount(1), g.NullCount(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Copying a frame without nulls clears them.
+	Copy(g.Slice(0, 10), Make(testType, 10, 10))
+	if got, want := g.Slice(0, 10).NullCount(1), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Nulls are retained when frames are grown and swapped.
+	h := Make(testType, 2, 2)
+	h.SetNull(1, 0, true)
+	h = h.Grow(100)
+	if got, want := nullRows(h, 1), []int{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	h.Swap(0, 50)
+	if got, want := nullRows(h, 1), []int{50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	h.Zero()
+	if got, want := h.NullCount(1), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNullWords(t *testing.T) {
+	f := Make(testType, 130, 130)
+	if f.NullWords(0) != nil {
+		t.Error("expected no nulls")
+	}
+	f.SetNull(0, 1, true)
+	f.SetNull(0, 129, true)
+	g := Make(testType, 129, 129)
+	g.SetNullWords(0, f.Slice(1, 130).NullWords(0))
+	if got, want := nullRows(g, 0), []int{0, 128}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -6,11 +6,14 @@ package frame
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"reflect"
 	"runtime"
 	"sync"
+	"time"
 
+	"github.com/grailbio/bigslice/slicetype"
 	"github.com/spaolacci/murmur3"
 )
 
@@ -123,6 +126,38 @@ func init() {
 			},
 		}
 	})
+	// Times are ordered and hashed by the instant they represent,
+	// regardless of their locations. They are encoded by their instants
+	// and zone offsets; see encodeTimes.
+	RegisterOps(func(slice []time.Time) Ops {
+		return Ops{
+			Less: func(i, j int) bool { return slice[i].Before(slice[j]) },
+			HashWithSeed: func(i int, seed uint32) uint32 {
+				var b [12]byte
+				binary.LittleEndian.PutUint64(b[:8], uint64(slice[i].Unix()))
+				binary.LittleEndian.PutUint32(b[8:], uint32(slice[i].Nanosecond()))
+				return murmur3.Sum32WithSeed(b[:], seed)
+			},
+			Encode: func(e Encoder, i, j int) error { return encodeTimes(e, slice[i:j]) },
+			Decode: func(d Decoder, i, j int) error { return decodeTimes(d, slice[i:j]) },
+		}
+	})
+	// Decimals are ordered and hashed by their values, regardless of
+	// their scales.
+	RegisterOps(func(slice []slicetype.Decimal) Ops {
+		return Ops{
+			Less: func(i, j int) bool { return slice[i].Cmp(slice[j]) < 0 },
+			HashWithSeed: func(i int, seed uint32) uint32 {
+				d := slice[i].Normalize()
+				var b [12]byte
+				binary.LittleEndian.PutUint64(b[:8], uint64(d.Unscaled))
+				binary.LittleEndian.PutUint32(b[8:], uint32(d.Scale))
+				return murmur3.Sum32WithSeed(b[:], seed)
+			},
+			Encode: func(e Encoder, i, j int) error { return encodeDecimals(e, slice[i:j]) },
+			Decode: func(d Decoder, i, j int) error { return decodeDecimals(d, slice[i:j]) },
+		}
+	})
 	RegisterOps(func(slice []struct{}) Ops {
 		return Ops{
 			Less: func(i, j int) bool { return false },
@@ -132,3 +167,127 @@ func init() {
 		}
 	})
 }
+
+// EncodeTimes encodes times as vectors of their Unix seconds,
+// nanoseconds, and zone offsets. The offsets are encoded as a single
+// value if all of the times have the same offset, as is typical.
+// Unlike gob's encoding of times, which decodes times whose offsets
+// match the decoding machine's local zone into time.Local, times are
+// always decoded into UTC (if their offset is 0) or a fixed zone with
+// their offset, so that decoded times do not depend on the local zone
+// of the machine on which they are decoded.
+func encodeTimes(e Encoder, times []time.Time) error {
+	var (
+		secs    = make([]int64, len(times))
+		nsecs   = make([]int32, len(times))
+		offsets = make([]int32, len(times))
+		uniform = true
+	)
+	for i, t := range times {
+		secs[i] = t.Unix()
+		nsecs[i] = int32(t.Nanosecond())
+		_, offset := t.Zone()
+		offsets[i] = int32(offset)
+		uniform = uniform && offsets[i] == offsets[0]
+	}
+	if uniform && len(offsets) > 0 {
+		offsets = offsets[:1]
+	}
+	for _, v := range []interface{}{secs, nsecs, offsets} {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeTimes decodes times encoded by encodeTimes into the provided
+// slice.
+func decodeTimes(d Decoder, times []time.Time) error {
+	var (
+		secs    []int64
+		nsecs   []int32
+		offsets []int32
+	)
+	for _, v := range []interface{}{&secs, &nsecs, &offsets} {
+		if err := d.Decode(v); err != nil {
+			return err
+		}
+	}
+	if len(times) == 0 {
+		return nil
+	}
+	if len(secs) != len(times) || len(nsecs) != len(times) || (len(offsets) != 1 && len(offsets) != len(times)) {
+		return fmt.Errorf("frame: decoded %d times, expected %d", len(secs), len(times))
+	}
+	zones := make(map[int32]*time.Location)
+	for i := range times {
+		offset := offsets[0]
+		if len(offsets) > 1 {
+			offset = offsets[i]
+		}
+		t := time.Unix(secs[i], int64(nsecs[i]))
+		if offset == 0 {
+			times[i] = t.UTC()
+			continue
+		}
+		zone, ok := zones[offset]
+		if !ok {
+			zone = time.FixedZone("", int(offset))
+			zones[offset] = zone
+		}
+		times[i] = t.In(zone)
+	}
+	return nil
+}
+
+// EncodeDecimals encodes decimals as a vector of their unscaled values
+// and a vector of their scales, which is encoded as a single value if
+// all of the decimals have the same scale, as is typical.
+func encodeDecimals(e Encoder, decimals []slicetype.Decimal) error {
+	var (
+		unscaled = make([]int64, len(decimals))
+		scales   = make([]int32, len(decimals))
+		uniform  = true
+	)
+	for i, d := range decimals {
+		unscaled[i], scales[i] = d.Unscaled, d.Scale
+		uniform = uniform && scales[i] == scales[0]
+	}
+	if uniform && len(scales) > 0 {
+		scales = scales[:1]
+	}
+	if err := e.Encode(unscaled); err != nil {
+		return err
+	}
+	return e.Encode(scales)
+}
+
+// DecodeDecimals decodes decimals encoded by encodeDecimals into the
+// provided slice.
+func decodeDecimals(d Decoder, decimals []slicetype.Decimal) error {
+	var (
+		unscaled []int64
+		scales   []int32
+	)
+	if err := d.Decode(&unscaled); err != nil {
+		return err
+	}
+	if err := d.Decode(&scales); err != nil {
+		return err
+	}
+	if len(decimals) == 0 {
+		return nil
+	}
+	if len(unscaled) != len(decimals) || (len(scales) != 1 && len(scales) != len(decimals)) {
+		return fmt.Errorf("frame: decoded %d decimals, expected %d", len(unscaled), len(decimals))
+	}
+	for i := range decimals {
+		scale := scales[0]
+		if len(scales) > 1 {
+			scale = scales[i]
+		}
+		decimals[i] = slicetype.Decimal{Unscaled: unscaled[i], Scale: scale}
+	}
+	return nil
+}
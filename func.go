@@ -38,6 +38,7 @@ type FuncValue struct {
 	args      []reflect.Type
 	index     int
 	exclusive bool
+	regions   []string
 
 	// file and line are the location at which the function was defined.
 	file string
@@ -55,6 +56,19 @@ func (f *FuncValue) Exclusive() *FuncValue {
 	return fv
 }
 
+// Residency restricts the invocations of this func to sessions whose
+// machines are created in one of the provided regions, regardless of
+// the slices that it reads. See Residency.
+func (f *FuncValue) Residency(regions ...string) *FuncValue {
+	if len(regions) == 0 {
+		typecheck.Panic(1, "residency: no regions provided")
+	}
+	fv := new(FuncValue)
+	*fv = *f
+	fv.regions = append([]string(nil), regions...)
+	return fv
+}
+
 // NumIn returns the number of input arguments to f.
 func (f *FuncValue) NumIn() int { return len(f.args) }
 
@@ -70,7 +84,9 @@ func (f *FuncValue) Invocation(location string, args ...interface{}) Invocation
 		argTypes[i] = reflect.TypeOf(arg)
 	}
 	f.typecheck(argTypes...)
-	return newInvocation(location, uint64(f.index), f.exclusive, args...)
+	inv := newInvocation(location, uint64(f.index), f.exclusive, args...)
+	inv.Regions = f.regions
+	return inv
 }
 
 // Apply invokes the function f with the provided arguments,
@@ -208,6 +224,9 @@ type Invocation struct {
 	Args      []interface{}
 	Exclusive bool
 	Location  string
+	// Regions, if nonempty, are the regions in which the invocation
+	// may be run. See FuncValue.Residency.
+	Regions []string
 }
 
 func (inv Invocation) String() string {
@@ -4,10 +4,14 @@ go 1.12
 
 require (
 	github.com/aws/aws-sdk-go v1.29.24
+	github.com/golang/protobuf v1.3.2
 	github.com/google/gofuzz v1.0.0
 	github.com/grailbio/base v0.0.9
 	github.com/grailbio/bigmachine v0.5.7
 	github.com/grailbio/testutil v0.0.3
 	github.com/spaolacci/murmur3 v1.1.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
+	google.golang.org/grpc v1.27.0
 )
@@ -0,0 +1,212 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package bloom implements Bloom filters over the keys of bigslice
+// frames. Filters are used as compact indexes of written datasets: a
+// filter built from a file's keys can be used to determine that a key
+// is not present in the file without reading it.
+package bloom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/grailbio/bigslice/frame"
+)
+
+const (
+	// magic identifies encoded filters.
+	magic = 0xb1005bf1
+
+	// seed0 and seed1 are the seeds of the two key hashes from which
+	// filter probes are derived.
+	seed0 = 0x9e3779b9
+	seed1 = 0x85ebca6b
+
+	// maxWords bounds the size of decoded filters, so that corrupt
+	// filters do not cause unbounded allocations.
+	maxWords = 1 << 30
+)
+
+// FalsePositiveRate is the target false positive rate of filters built
+// by a Builder.
+const FalsePositiveRate = 0.01
+
+// Hash returns the hash of the key (prefix columns) of row i of frame
+// f from which filter probes are derived.
+func Hash(f frame.Frame, i int) uint64 {
+	return uint64(f.HashWithSeed(i, seed0))<<32 | uint64(f.HashWithSeed(i, seed1))
+}
+
+// A Filter is a Bloom filter of frame keys.
+type Filter struct {
+	k    uint32
+	bits []uint64
+}
+
+// New returns a filter sized to hold n keys with a false positive
+// rate of p.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		k:    uint32(k),
+		bits: make([]uint64, (int(m)+63)/64),
+	}
+}
+
+// AddHash adds the key with the provided hash (see Hash) to the
+// filter.
+func (f *Filter) AddHash(h uint64) {
+	m := uint64(len(f.bits)) * 64
+	h0, h1 := h>>32, h&0xffffffff
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h0 + i*h1) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Add adds the key of row i of frame fr to the filter.
+func (f *Filter) Add(fr frame.Frame, i int) {
+	f.AddHash(Hash(fr, i))
+}
+
+// MayContainHash returns false if the key with the provided hash is
+// definitely not in the filter.
+func (f *Filter) MayContainHash(h uint64) bool {
+	m := uint64(len(f.bits)) * 64
+	h0, h1 := h>>32, h&0xffffffff
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h0 + i*h1) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MayContain returns false if the key of row i of frame fr is
+// definitely not in the filter.
+func (f *Filter) MayContain(fr frame.Frame, i int) bool {
+	return f.MayContainHash(Hash(fr, i))
+}
+
+// MergeFrom adds the keys of filter g to f, which is modified in
+// place. Filters must be created with the same size and false positive
+// rate to be merged; MergeFrom panics if they are not.
+func (f *Filter) MergeFrom(g *Filter) {
+	if f.k != g.k || len(f.bits) != len(g.bits) {
+		panic(fmt.Sprintf("bloom: cannot merge filters of %d and %d bits", 64*len(f.bits), 64*len(g.bits)))
+	}
+	for i, bits := range g.bits {
+		f.bits[i] |= bits
+	}
+}
+
+// GobEncode implements gob.GobEncoder, so that filters may be carried
+// in slices.
+func (f *Filter) GobEncode() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := f.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder.
+func (f *Filter) GobDecode(p []byte) error {
+	g, err := Read(bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	*f = *g
+	return nil
+}
+
+// WriteTo writes the encoded filter to w.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var hdr [16]byte
+	binary.LittleEndian.PutUint32(hdr[0:], magic)
+	binary.LittleEndian.PutUint32(hdr[4:], f.k)
+	binary.LittleEndian.PutUint64(hdr[8:], uint64(len(f.bits)))
+	if _, err := bw.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	var word [8]byte
+	for _, bits := range f.bits {
+		binary.LittleEndian.PutUint64(word[:], bits)
+		if _, err := bw.Write(word[:]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(hdr) + 8*len(f.bits)), bw.Flush()
+}
+
+// Read decodes a filter, as written by Filter.WriteTo, from r.
+func Read(r io.Reader) (*Filter, error) {
+	br := bufio.NewReader(r)
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[0:]) != magic {
+		return nil, fmt.Errorf("bloom: invalid filter")
+	}
+	f := &Filter{k: binary.LittleEndian.Uint32(hdr[4:])}
+	n := binary.LittleEndian.Uint64(hdr[8:])
+	if n == 0 || n > maxWords || f.k == 0 {
+		return nil, fmt.Errorf("bloom: invalid filter size")
+	}
+	f.bits = make([]uint64, n)
+	var word [8]byte
+	for i := range f.bits {
+		if _, err := io.ReadFull(br, word[:]); err != nil {
+			return nil, err
+		}
+		f.bits[i] = binary.LittleEndian.Uint64(word[:])
+	}
+	return f, nil
+}
+
+// A Builder accumulates keys of a dataset whose size is not known in
+// advance, and builds a filter sized to hold them.
+type Builder struct {
+	hashes []uint64
+}
+
+// Add adds the keys of all the rows of frame f to the builder.
+func (b *Builder) Add(f frame.Frame) {
+	for i := 0; i < f.Len(); i++ {
+		b.hashes = append(b.hashes, Hash(f, i))
+	}
+}
+
+// Build returns a filter that contains the keys added to the builder,
+// with a false positive rate of FalsePositiveRate.
+func (b *Builder) Build() *Filter {
+	sort.Slice(b.hashes, func(i, j int) bool { return b.hashes[i] < b.hashes[j] })
+	var n int
+	for i, h := range b.hashes {
+		if i == 0 || h != b.hashes[n-1] {
+			b.hashes[n] = h
+			n++
+		}
+	}
+	b.hashes = b.hashes[:n]
+	f := New(n, FalsePositiveRate)
+	for _, h := range b.hashes {
+		f.AddHash(h)
+	}
+	return f
+}
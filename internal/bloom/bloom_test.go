@@ -0,0 +1,101 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice/frame"
+)
+
+func TestFilter(t *testing.T) {
+	const N = 10000
+	keys := make([]string, 2*N)
+	for i := range keys {
+		keys[i] = fmt.Sprint("key", i)
+	}
+	present := frame.Slices(keys[:N])
+	var b Builder
+	b.Add(present)
+	// Duplicate keys do not affect the filter's size.
+	b.Add(present)
+	f := b.Build()
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < N; i++ {
+		if !f.MayContain(present, i) {
+			t.Fatalf("key %s missing from filter", keys[i])
+		}
+	}
+	absent := frame.Slices(keys[N:])
+	var falsePositives int
+	for i := 0; i < N; i++ {
+		if f.MayContain(absent, i) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / N; rate > 2*FalsePositiveRate {
+		t.Errorf("false positive rate %v exceeds %v", rate, 2*FalsePositiveRate)
+	}
+}
+
+func TestFilterMultiColumnKey(t *testing.T) {
+	keys := frame.Slices([]int{1, 2, 3}, []string{"a", "b", "c"}, []float64{1, 2, 3}).Prefixed(2)
+	var b Builder
+	b.Add(keys)
+	f := b.Build()
+	for i := 0; i < keys.Len(); i++ {
+		if !f.MayContain(keys, i) {
+			t.Errorf("key %d missing from filter", i)
+		}
+	}
+	// Only the key columns are indexed.
+	other := frame.Slices([]int{1}, []string{"a"}, []float64{100}).Prefixed(2)
+	if !f.MayContain(other, 0) {
+		t.Error("key missing from filter")
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	if _, err := Read(bytes.NewReader(make([]byte, 32))); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFilterMerge(t *testing.T) {
+	keys := frame.Slices([]string{"a", "b", "c", "d"})
+	f, g := New(4, FalsePositiveRate), New(4, FalsePositiveRate)
+	f.Add(keys, 0)
+	f.Add(keys, 1)
+	g.Add(keys, 2)
+	f.MergeFrom(g)
+	for i := 0; i < 3; i++ {
+		if !f.MayContain(keys, i) {
+			t.Errorf("key %d missing from merged filter", i)
+		}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	var h *Filter
+	if err := gob.NewDecoder(&buf).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, h) {
+		t.Errorf("got %v, want %v", h, f)
+	}
+}
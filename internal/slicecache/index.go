@@ -0,0 +1,138 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicecache
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/base/log"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/bloom"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// indexSuffix is the suffix of the paths of key index sidecars.
+const indexSuffix = ".bloom"
+
+// IndexPath returns the path of the key index sidecar of the data file
+// at path. The sidecar contains a Bloom filter of the keys of the
+// records in the data file.
+func IndexPath(path string) string {
+	return path + indexSuffix
+}
+
+// WriteIndex writes the key index filter to the sidecar at path.
+func WriteIndex(ctx context.Context, path string, filter *bloom.Filter) error {
+	f, err := file.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := filter.WriteTo(f.Writer(ctx)); err != nil {
+		f.Discard(ctx)
+		return err
+	}
+	return f.Close(ctx)
+}
+
+// ReadIndex reads the key index filter from the sidecar at path.
+func ReadIndex(ctx context.Context, path string) (*bloom.Filter, error) {
+	f, err := file.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close(ctx) // nolint: errcheck
+	return bloom.Read(f.Reader(ctx))
+}
+
+type lookupReader struct {
+	path string
+	keys frame.Frame
+	// candidates maps key hashes to the indices of the keys in keys with
+	// that hash.
+	candidates map[uint64][]int
+
+	reader sliceio.Reader
+	buf    frame.Frame
+	// check, if not nil, checks the schema of the data file.
+	check *schemaCheck
+}
+
+// NewLookupReader returns a reader of the records in the data file at
+// path, as written by a writethrough reader, whose keys are among the
+// keys (prefix columns) of the frame keys. If the file has a key index
+// sidecar (see IndexPath), the reader consults it first, and does not
+// read the file at all if it contains none of the keys.
+func NewLookupReader(path string, keys frame.Frame) sliceio.Reader {
+	return &lookupReader{path: path, keys: keys}
+}
+
+func (r *lookupReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.reader == nil {
+		if !r.mayContain(ctx) {
+			r.reader = sliceio.EmptyReader{}
+		} else {
+			r.reader = &fileReader{path: r.path, check: r.check}
+		}
+	}
+	if r.buf.IsZero() {
+		r.buf = frame.Make(out, out.Len(), out.Len())
+	}
+	for {
+		r.buf = r.buf.Ensure(out.Len())
+		n, err := r.reader.Read(ctx, r.buf)
+		var m int
+		for i := 0; i < n; i++ {
+			if r.match(i) {
+				frame.Copy(out.Slice(m, m+1), r.buf.Slice(i, i+1))
+				m++
+			}
+		}
+		if m > 0 || err != nil {
+			return m, err
+		}
+	}
+}
+
+// mayContain returns false if the index sidecar of the data file shows
+// that it contains none of the reader's keys. It also initializes
+// r.candidates.
+func (r *lookupReader) mayContain(ctx context.Context) bool {
+	r.candidates = make(map[uint64][]int, r.keys.Len())
+	for i := 0; i < r.keys.Len(); i++ {
+		h := bloom.Hash(r.keys, i)
+		r.candidates[h] = append(r.candidates[h], i)
+	}
+	filter, err := ReadIndex(ctx, IndexPath(r.path))
+	if err != nil {
+		// The index is only an optimization: we can always scan the data.
+		if !errors.Is(errors.NotExist, err) {
+			log.Error.Printf("%s: reading key index: %v", r.path, err)
+		}
+		return true
+	}
+	for h := range r.candidates {
+		if filter.MayContainHash(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns whether the key of row i of r.buf is one of r.keys.
+func (r *lookupReader) match(i int) bool {
+	for _, j := range r.candidates[bloom.Hash(r.buf, i)] {
+		equal := true
+		for col := 0; col < r.keys.Prefix() && equal; col++ {
+			equal = reflect.DeepEqual(r.keys.Index(col, j).Interface(), r.buf.Index(col, i).Interface())
+		}
+		if equal {
+			return true
+		}
+	}
+	return false
+}
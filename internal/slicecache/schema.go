@@ -0,0 +1,242 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicecache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// schemaSuffix is the suffix of the paths of schema sidecars.
+const schemaSuffix = ".schema"
+
+// A Schema describes the columns of the data stored in a cache file.
+// Schemas are stored in sidecars alongside the data files, so that
+// data that were stored for a slice of a different type, e.g., by an
+// earlier version of a program, are detected when they are read,
+// rather than being misinterpreted or failing with an obscure decoding
+// error.
+type Schema struct {
+	Columns []Column `json:"columns"`
+}
+
+// A Column describes a column of a Schema.
+type Column struct {
+	// Type is the name of the column's Go type, as rendered by
+	// reflect.Type.String.
+	Type string `json:"type"`
+	// Name is the column's name, if any. See slicetype.NamedType.
+	Name string `json:"name,omitempty"`
+	// Nullable tells whether the column may hold nulls.
+	Nullable bool `json:"nullable,omitempty"`
+}
+
+// String returns a description of the column, e.g., "key string?".
+func (c Column) String() string {
+	s := c.Type
+	if c.Nullable {
+		s += "?"
+	}
+	if c.Name != "" {
+		s = c.Name + " " + s
+	}
+	return s
+}
+
+// accepts tells whether data stored in column stored may be read into
+// column c. Names are compared only if both columns are named, so that
+// naming the columns of a cached slice does not invalidate its cache;
+// data that may hold nulls may not be read into columns that cannot.
+func (c Column) accepts(stored Column) bool {
+	return c.Type == stored.Type &&
+		(c.Name == "" || stored.Name == "" || c.Name == stored.Name) &&
+		(c.Nullable || !stored.Nullable)
+}
+
+// SchemaOf returns the schema of data of the provided type.
+func SchemaOf(typ slicetype.Type) Schema {
+	s := Schema{Columns: make([]Column, typ.NumOut())}
+	for i := range s.Columns {
+		s.Columns[i] = Column{
+			Type:     typ.Out(i).String(),
+			Name:     slicetype.ColumnName(typ, i),
+			Nullable: slicetype.Nullable(typ, i),
+		}
+	}
+	return s
+}
+
+// String returns a description of the schema, e.g.,
+// "<key string, int>".
+func (s Schema) String() string {
+	cols := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		cols[i] = c.String()
+	}
+	return "<" + strings.Join(cols, ", ") + ">"
+}
+
+// Diff returns a description of how data stored with schema stored
+// differ from data of schema s, one line per differing column, or ""
+// if data of schema stored may be read as data of schema s.
+func (s Schema) Diff(stored Schema) string {
+	var (
+		b strings.Builder
+		n = len(s.Columns)
+	)
+	if len(stored.Columns) > n {
+		n = len(stored.Columns)
+	}
+	for i := 0; i < n; i++ {
+		switch {
+		case i >= len(stored.Columns):
+			fmt.Fprintf(&b, "column %d: %s is not stored\n", i, s.Columns[i])
+		case i >= len(s.Columns):
+			fmt.Fprintf(&b, "column %d: stored %s is not in the slice\n", i, stored.Columns[i])
+		case !s.Columns[i].accepts(stored.Columns[i]):
+			fmt.Fprintf(&b, "column %d: stored %s, slice has %s\n", i, stored.Columns[i], s.Columns[i])
+		}
+	}
+	return b.String()
+}
+
+// SchemaPath returns the path of the schema sidecar of the data file at
+// path.
+func SchemaPath(path string) string {
+	return path + schemaSuffix
+}
+
+// WriteSchema writes the schema to the sidecar at path.
+func WriteSchema(ctx context.Context, path string, schema Schema) error {
+	p, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	f, err := file.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Writer(ctx).Write(p); err != nil {
+		f.Discard(ctx)
+		return err
+	}
+	return f.Close(ctx)
+}
+
+// ReadSchema reads a schema from the sidecar at path.
+func ReadSchema(ctx context.Context, path string) (Schema, error) {
+	f, err := file.Open(ctx, path)
+	if err != nil {
+		return Schema{}, err
+	}
+	defer f.Close(ctx) // nolint: errcheck
+	p, err := ioutil.ReadAll(f.Reader(ctx))
+	if err != nil {
+		return Schema{}, err
+	}
+	var schema Schema
+	if err := json.Unmarshal(p, &schema); err != nil {
+		return Schema{}, errors.E(errors.Integrity, fmt.Sprintf("%s: invalid schema", path), err)
+	}
+	return schema, nil
+}
+
+// schemaCheck checks the schemas of cache files against the type of
+// the slice whose data they store, and adapts data stored with
+// compatible schemas.
+type schemaCheck struct {
+	typ    slicetype.Type
+	schema Schema
+	// added holds the default values of the columns that were declared
+	// to be added to the slice since its data may have been stored; see
+	// (*FileShardCache).AddColumn. Invalid values denote nulls.
+	added map[int]reflect.Value
+}
+
+// reader returns a reader of the data read by reader, which were read
+// from the file at path with the provided stored schema, as data of
+// the checked type. It returns an error describing the differences
+// between the schemas if the stored data are not compatible with the
+// type, even with the declared added columns.
+func (c *schemaCheck) reader(path string, stored Schema, reader sliceio.Reader) (sliceio.Reader, error) {
+	diff := c.schema.Diff(stored)
+	if diff == "" {
+		return reader, nil
+	}
+	if len(c.added) > 0 {
+		var (
+			evolved Schema
+			types   []reflect.Type
+			cols    []int
+		)
+		for i, col := range c.schema.Columns {
+			if _, ok := c.added[i]; !ok {
+				evolved.Columns = append(evolved.Columns, col)
+				types = append(types, c.typ.Out(i))
+				cols = append(cols, i)
+			}
+		}
+		if evolved.Diff(stored) == "" {
+			return &evolveReader{
+				Reader: reader,
+				stored: slicetype.New(types...),
+				cols:   cols,
+				added:  c.added,
+			}, nil
+		}
+		diff += fmt.Sprintf("(with %d added columns, stored %s, slice has %s)\n",
+			len(c.added), stored, evolved)
+	}
+	return nil, errors.E(errors.Fatal, errors.Precondition,
+		fmt.Sprintf("cache file %s has schema %s, which does not match slice schema %s:\n%s",
+			path, stored, c.schema, strings.TrimSuffix(diff, "\n")))
+}
+
+// EvolveReader reads data stored without the added columns of a slice,
+// filling in their default values.
+type evolveReader struct {
+	sliceio.Reader
+	// stored is the type of the stored data.
+	stored slicetype.Type
+	// cols[i] is the slice column of the i'th stored column.
+	cols  []int
+	added map[int]reflect.Value
+	buf   frame.Frame
+}
+
+func (r *evolveReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.buf.IsZero() {
+		r.buf = frame.Make(r.stored, out.Len(), out.Len())
+	}
+	r.buf = r.buf.Ensure(out.Len())
+	n, err := r.Reader.Read(ctx, r.buf)
+	for i, col := range r.cols {
+		reflect.Copy(out.Value(col), r.buf.Value(i).Slice(0, n))
+		for j := 0; j < n; j++ {
+			out.SetNull(col, j, r.buf.IsNull(i, j))
+		}
+	}
+	for col, v := range r.added {
+		null := !v.IsValid()
+		if null {
+			v = reflect.Zero(out.Out(col))
+		}
+		for j := 0; j < n; j++ {
+			out.Index(col, j).Set(v)
+			out.SetNull(col, j, null)
+		}
+	}
+	return n, err
+}
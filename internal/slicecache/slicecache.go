@@ -3,11 +3,16 @@ package slicecache
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"runtime"
 
+	"github.com/grailbio/base/errors"
 	"github.com/grailbio/base/file"
 	"github.com/grailbio/base/traverse"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/bloom"
 	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
 )
 
 // Cacheable indicates a slice's data should be cached.
@@ -40,6 +45,9 @@ type FileShardCache struct {
 	numShards     int
 	shardIsCached []bool
 	requireAll    bool
+	indexKeys     bool
+	// check, if not nil, checks the schemas of the cache's files.
+	check *schemaCheck
 }
 
 const (
@@ -59,7 +67,7 @@ func NewFileShardCache(ctx context.Context, prefix string, numShards int) *FileS
 	// TODO(jcharumilind): Make this initialization more lazy. This is generally
 	// called within Funcs, but its result is generally ignored on workers to
 	// ensure a consistent view of the cache for consistent compilation.
-	c := FileShardCache{prefix, numShards, make([]bool, numShards), false}
+	c := FileShardCache{prefix, numShards, make([]bool, numShards), false, false, nil}
 	_ = traverse.Limit(10*runtime.NumCPU()).Each(numShards, func(shard int) error {
 		_, err := file.Stat(ctx, c.path(shard))
 		c.shardIsCached[shard] = err == nil // treat lookup errors as cache misses
@@ -94,13 +102,72 @@ func (c *FileShardCache) RequireAllCached() {
 	}
 }
 
+// IndexKeys configures the cache to write, along with the data of each
+// shard, a key index sidecar that is used by LookupReader to skip shards
+// that do not contain the keys that are looked up.
+func (c *FileShardCache) IndexKeys() {
+	if c == nil {
+		return
+	}
+	c.indexKeys = true
+}
+
+// SetType sets the type of the data that are cached. Once it is set,
+// the cache writes, along with the data of each shard, a schema sidecar
+// (see SchemaPath), and checks that the stored schemas of shards match
+// the type when they are read. Shards without schema sidecars, e.g.,
+// those written by earlier versions of bigslice, are not checked.
+func (c *FileShardCache) SetType(typ slicetype.Type) {
+	if c == nil {
+		return
+	}
+	c.check = &schemaCheck{typ: typ, schema: SchemaOf(typ)}
+}
+
+// AddColumn declares that column col of the cache's type, as set by
+// SetType, was added after some of the cache's data may have been
+// stored: shards that were stored without the column are read with the
+// provided default value in the column. A nil value denotes nulls, and
+// is permitted only for nullable columns.
+func (c *FileShardCache) AddColumn(col int, value interface{}) error {
+	if c == nil {
+		return nil
+	}
+	if c.check == nil {
+		return errors.New("cache type is not set")
+	}
+	typ := c.check.typ
+	if col < 0 || col >= typ.NumOut() {
+		return fmt.Errorf("column %d out of range for type %s", col, slicetype.String(typ))
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case value == nil && !slicetype.Nullable(typ, col):
+		return fmt.Errorf("column %d of type %s is not nullable, and cannot default to null", col, typ.Out(col))
+	case value != nil && !v.Type().AssignableTo(typ.Out(col)):
+		return fmt.Errorf("default value of type %s is not assignable to column %d of type %s", v.Type(), col, typ.Out(col))
+	}
+	if c.check.added == nil {
+		c.check.added = make(map[int]reflect.Value)
+	}
+	c.check.added[col] = v
+	return nil
+}
+
 // WritethroughReader returns a reader that populates the cache. reader should
 // read computed data.
 func (c *FileShardCache) WritethroughReader(shard int, reader sliceio.Reader) sliceio.Reader {
 	if c == nil {
 		return reader
 	}
-	return newWritethroughReader(reader, c.path(shard))
+	r := newWritethroughReader(reader, c.path(shard))
+	if c.check != nil {
+		r.schema = &c.check.schema
+	}
+	if c.indexKeys {
+		r.index = new(bloom.Builder)
+	}
+	return r
 }
 
 // CacheReader returns a reader that reads from the cache. If the shard is not
@@ -115,5 +182,16 @@ func (c *FileShardCache) CacheReader(shard int) sliceio.Reader {
 			c.prefix, shard, c.numShards, path)
 		return sliceio.ErrReader(err)
 	}
-	return newFileReader(c.path(shard))
+	return &fileReader{path: c.path(shard), check: c.check}
+}
+
+// LookupReader returns a reader that reads from the cache only the
+// records whose keys are among the keys of the frame keys. See
+// NewLookupReader. If the shard is not cached, returns a reader that
+// will always return an error.
+func (c *FileShardCache) LookupReader(shard int, keys frame.Frame) sliceio.Reader {
+	if !c.shardIsCached[shard] {
+		return c.CacheReader(shard)
+	}
+	return &lookupReader{path: c.path(shard), keys: keys, check: c.check}
 }
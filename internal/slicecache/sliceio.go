@@ -4,16 +4,21 @@ import (
 	"context"
 
 	"github.com/grailbio/base/backgroundcontext"
+	"github.com/grailbio/base/errors"
 	"github.com/grailbio/base/file"
 	"github.com/grailbio/base/log"
 	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/internal/bloom"
 	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
 )
 
 type fileReader struct {
 	sliceio.Reader
 	file file.File
 	path string
+	// check, if not nil, checks the schema of the file.
+	check *schemaCheck
 }
 
 func (f *fileReader) Read(ctx context.Context, frame frame.Frame) (int, error) {
@@ -24,6 +29,11 @@ func (f *fileReader) Read(ctx context.Context, frame frame.Frame) (int, error) {
 			return 0, err
 		}
 		f.Reader = sliceio.NewDecodingReader(f.file.Reader(backgroundcontext.Get()))
+		if f.check != nil {
+			if err := f.checkSchema(ctx); err != nil {
+				f.Reader = sliceio.ErrReader(err)
+			}
+		}
 	}
 	n, err := f.Reader.Read(ctx, frame)
 	if err != nil {
@@ -34,15 +44,46 @@ func (f *fileReader) Read(ctx context.Context, frame frame.Frame) (int, error) {
 	return n, err
 }
 
-func newFileReader(path string) sliceio.Reader {
+// checkSchema checks the schema of the file, as stored in its schema
+// sidecar, if any, and adapts f.Reader to read data with compatible
+// schemas.
+func (f *fileReader) checkSchema(ctx context.Context) error {
+	stored, err := ReadSchema(ctx, SchemaPath(f.path))
+	if errors.Is(errors.NotExist, err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.Reader, err = f.check.reader(f.path, stored, f.Reader)
+	return err
+}
+
+// NewFileReader returns a reader that decodes frames from the file at
+// path, as written by a writethrough reader.
+func NewFileReader(path string) sliceio.Reader {
 	return &fileReader{path: path}
 }
 
+// NewCheckedFileReader returns a reader that decodes frames from the
+// file at path, as NewFileReader does, but which first checks that the
+// schema stored in the file's schema sidecar, if any, matches typ. See
+// (*FileShardCache).SetType.
+func NewCheckedFileReader(path string, typ slicetype.Type) sliceio.Reader {
+	return &fileReader{path: path, check: &schemaCheck{typ: typ, schema: SchemaOf(typ)}}
+}
+
 type writethroughReader struct {
 	sliceio.Reader
 	path string
 	file file.File
 	enc  *sliceio.Encoder
+	// index, if not nil, accumulates the keys of the data written, to be
+	// written to a key index sidecar.
+	index *bloom.Builder
+	// schema, if not nil, is the schema of the data written, to be
+	// written to a schema sidecar.
+	schema *Schema
 }
 
 func (r *writethroughReader) Read(ctx context.Context, frame frame.Frame) (int, error) {
@@ -62,7 +103,24 @@ func (r *writethroughReader) Read(ctx context.Context, frame frame.Frame) (int,
 		if writeErr := r.enc.Write(ctx, frame.Slice(0, n)); writeErr != nil {
 			return n, writeErr
 		}
+		if r.index != nil {
+			r.index.Add(frame.Slice(0, n))
+		}
 		if err == sliceio.EOF {
+			// Write the sidecars before committing the data, so that
+			// committed data are never accompanied by stale sidecars.
+			if r.schema != nil {
+				if schemaErr := WriteSchema(ctx, SchemaPath(r.path), *r.schema); schemaErr != nil {
+					r.file.Discard(backgroundcontext.Get())
+					return n, schemaErr
+				}
+			}
+			if r.index != nil {
+				if indexErr := WriteIndex(ctx, IndexPath(r.path), r.index.Build()); indexErr != nil {
+					r.file.Discard(backgroundcontext.Get())
+					return n, indexErr
+				}
+			}
 			if closeErr := r.file.Close(ctx); closeErr != nil {
 				return n, closeErr
 			}
@@ -73,6 +131,6 @@ func (r *writethroughReader) Read(ctx context.Context, frame frame.Frame) (int,
 	return n, err
 }
 
-func newWritethroughReader(reader sliceio.Reader, path string) sliceio.Reader {
+func newWritethroughReader(reader sliceio.Reader, path string) *writethroughReader {
 	return &writethroughReader{Reader: reader, path: path}
 }
@@ -0,0 +1,623 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/sortio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// joinKind is the kind of a join, which determines which of its sides
+// are optional, i.e., are emitted as zero values when they have no
+// rows for a key.
+type joinKind int
+
+const (
+	innerJoin joinKind = iota
+	leftJoin
+	rightJoin
+	outerJoin
+	semiJoin
+	antiJoin
+)
+
+// String returns the name of the join's operation.
+func (k joinKind) String() string {
+	switch k {
+	case leftJoin:
+		return "leftjoin"
+	case rightJoin:
+		return "rightjoin"
+	case outerJoin:
+		return "outerjoin"
+	case semiJoin:
+		return "semijoin"
+	case antiJoin:
+		return "antijoin"
+	default:
+		return "join"
+	}
+}
+
+// Optional returns whether the provided side (0 for left, 1 for
+// right) of a join of this kind is optional.
+func (k joinKind) Optional(side int) bool {
+	if side == 0 {
+		return k == rightJoin || k == outerJoin
+	}
+	return k == leftJoin || k == outerJoin
+}
+
+// Filters returns whether a join of this kind filters the rows of its
+// left side by the keys of its right side, rather than joining them.
+func (k joinKind) Filters() bool {
+	return k == semiJoin || k == antiJoin
+}
+
+// Join returns a slice that contains a row for each pair of rows in
+// the provided slices that have the same key. Schematically:
+//
+//	Join(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n, t21, ..., t2m>
+//
+// Join uses the prefix columns of each slice as its key; the slices
+// must have the same key types, and keys must be partitionable. Like
+// Cogroup, Join shuffles both slices by key and merges them; the rows
+// of each key are buffered in memory while they are joined. The
+// returned slice retains the prefix of the slices.
+//
+// If one of the slices is small, as indicated by the Broadcast pragma
+// or by its declared size (see Sized and Sizer), Join instead
+// broadcasts it: the small slice is read in full into memory by each
+// shard of the other, large slice, which is joined against it as it is
+// computed, without being shuffled or sorted. The returned slice then
+// has the shards of the large slice. A side is broadcast only if all
+// of the other side's rows are joined with it: thus only the right side
+// of LeftJoin, the left side of RightJoin, and neither side of
+// OuterJoin may be broadcast.
+func Join(left, right Slice) Slice {
+	return makeJoinSlice(innerJoin, left, right)
+}
+
+// LeftJoin is like Join, but also contains a row for each row in the
+// left slice whose key does not appear in the right slice. The right
+// columns of such rows are zero values. LeftJoin appends a boolean
+// column that indicates whether the row's right columns are valid.
+// Schematically:
+//
+//	LeftJoin(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n, t21, ..., t2m, bool>
+func LeftJoin(left, right Slice) Slice {
+	return makeJoinSlice(leftJoin, left, right)
+}
+
+// RightJoin is like Join, but also contains a row for each row in the
+// right slice whose key does not appear in the left slice. The left
+// columns of such rows are zero values. RightJoin appends a boolean
+// column that indicates whether the row's left columns are valid.
+// Schematically:
+//
+//	RightJoin(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n, t21, ..., t2m, bool>
+func RightJoin(left, right Slice) Slice {
+	return makeJoinSlice(rightJoin, left, right)
+}
+
+// OuterJoin is like Join, but also contains a row for each row in
+// either slice whose key does not appear in the other. The columns of
+// the missing side of such rows are zero values. OuterJoin appends two
+// boolean columns that indicate whether the row's left and right
+// columns, respectively, are valid. Schematically:
+//
+//	OuterJoin(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n, t21, ..., t2m, bool, bool>
+func OuterJoin(left, right Slice) Slice {
+	return makeJoinSlice(outerJoin, left, right)
+}
+
+// SemiJoin returns a slice that contains the rows of the left slice
+// whose key appears in the right slice. Each such row appears once,
+// regardless of the number of rows with its key in the right slice.
+// Only the keys of the right slice are shuffled: its other columns are
+// neither written nor read. Keys are as in Join, and, as in Join, a
+// small right slice is broadcast rather than shuffled. Schematically:
+//
+//	SemiJoin(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n>
+func SemiJoin(left, right Slice) Slice {
+	return makeJoinSlice(semiJoin, left, right)
+}
+
+// AntiJoin is like SemiJoin, but returns a slice that contains the
+// rows of the left slice whose key does not appear in the right slice.
+// Schematically:
+//
+//	AntiJoin(Slice<tk1, ..., tkp, t11, ..., t1n>, Slice<tk1, ..., tkp, t21, ..., t2m>)
+//		Slice<tk1, ..., tkp, t11, ..., t1n>
+func AntiJoin(left, right Slice) Slice {
+	return makeJoinSlice(antiJoin, left, right)
+}
+
+// broadcastRows is the maximum number of rows that a slice may
+// declare (see Sizer) for Join to broadcast it without a pragma.
+const broadcastRows = 1 << 20
+
+type joinSlice struct {
+	name     Name
+	kind     joinKind
+	slices   [2]Slice
+	out      []reflect.Type
+	prefix   int
+	numShard int
+	// broadcast is the side of the join that is broadcast, or -1 if
+	// both sides are shuffled.
+	broadcast int
+}
+
+// makeJoinSlice returns a join of the provided kind. It panics with a
+// type error if the slices cannot be joined.
+func makeJoinSlice(kind joinKind, left, right Slice) Slice {
+	if got, want := right.Prefix(), left.Prefix(); got != want {
+		typecheck.Panicf(2, "%s: prefix mismatch: expected %d but got %d", kind, want, got)
+	}
+	prefix := left.Prefix()
+	for i := 0; i < prefix; i++ {
+		if got, want := right.Out(i), left.Out(i); got != want {
+			typecheck.Panicf(2, "%s: key column type mismatch: expected %s but got %s", kind, want, got)
+		}
+		if !frame.CanHash(left.Out(i)) {
+			typecheck.Panicf(2, "%s: key column(%d) type %s cannot be hashed", kind, i, left.Out(i))
+		}
+		if !frame.CanCompare(left.Out(i)) {
+			typecheck.Panicf(2, "%s: key column(%d) type %s cannot be sorted", kind, i, left.Out(i))
+		}
+	}
+	j := &joinSlice{
+		name:      MakeName(kind.String()),
+		kind:      kind,
+		slices:    [2]Slice{left, right},
+		prefix:    prefix,
+		numShard:  left.NumShard(),
+		broadcast: kind.broadcastSide(left, right),
+	}
+	if j.broadcast >= 0 {
+		j.numShard = j.slices[1-j.broadcast].NumShard()
+	} else if right.NumShard() > j.numShard {
+		j.numShard = right.NumShard()
+	}
+	for i := 0; i < left.NumOut(); i++ {
+		j.out = append(j.out, left.Out(i))
+	}
+	if kind.Filters() {
+		j.slices[1] = keyColumns(right)
+		return j
+	}
+	for i := prefix; i < right.NumOut(); i++ {
+		j.out = append(j.out, right.Out(i))
+	}
+	for side := range j.slices {
+		if kind.Optional(side) {
+			j.out = append(j.out, typeOfBool)
+		}
+	}
+	return j
+}
+
+// broadcastSide returns the side of a join of this kind between the
+// provided slices that is broadcast, or -1 if neither is. A side may be
+// broadcast if the other side is not optional and it has the Broadcast
+// pragma or declares at most broadcastRows rows. Pragmas take precedence over
+// sizes, and smaller sides over larger ones.
+func (k joinKind) broadcastSide(left, right Slice) int {
+	var (
+		side = -1
+		rows int
+	)
+	for i, slice := range [2]Slice{left, right} {
+		// Joins that filter their left sides stream them.
+		if k.Optional(1-i) || k.Filters() && i == 0 {
+			continue
+		}
+		if pragma, ok := slice.(Pragma); ok && pragma.Broadcast() {
+			return i
+		}
+		if n := maxRows(slice); n >= 0 && n <= broadcastRows && (side < 0 || n < rows) {
+			side, rows = i, n
+		}
+	}
+	return side
+}
+
+// keyColumns returns a slice of the key (prefix) columns of the
+// provided slice.
+func keyColumns(slice Slice) Slice {
+	cols := make([]int, slice.Prefix())
+	for i := range cols {
+		cols[i] = i
+	}
+	return Prefixed(SelectColumns(slice, cols...), len(cols))
+}
+
+var typeOfBool = reflect.TypeOf(false)
+
+func (j *joinSlice) Name() Name             { return j.name }
+func (j *joinSlice) NumShard() int          { return j.numShard }
+func (j *joinSlice) NumOut() int            { return len(j.out) }
+func (j *joinSlice) Out(i int) reflect.Type { return j.out[i] }
+func (j *joinSlice) Prefix() int            { return j.prefix }
+func (*joinSlice) NumDep() int              { return 2 }
+func (*joinSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (j *joinSlice) ShardType() ShardType {
+	if j.broadcast >= 0 {
+		// Rows remain in the shards of the large side, in order.
+		return j.slices[1-j.broadcast].ShardType()
+	}
+	return HashShard
+}
+
+func (j *joinSlice) Dep(i int) Dep {
+	if j.broadcast < 0 {
+		return Dep{j.slices[i], true, nil, false, false}
+	}
+	return Dep{j.slices[i], false, nil, false, i == j.broadcast}
+}
+
+func (j *joinSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	if j.broadcast >= 0 {
+		return &broadcastJoinReader{joiner: joiner{op: j}, readers: deps}
+	}
+	return &joinReader{joiner: joiner{op: j}, readers: deps}
+}
+
+// joiner joins the rows of each side of a join that have the same key.
+type joiner struct {
+	op *joinSlice
+	// groups hold the rows of each side for the key being joined.
+	groups [2]frame.Frame
+	// buf holds the joined rows of the current key, of which pending
+	// are yet to be read.
+	buf, pending frame.Frame
+}
+
+// drain copies pending joined rows into out, returning the number of
+// rows copied.
+func (j *joiner) drain(out frame.Frame) int {
+	n := frame.Copy(out, j.pending)
+	j.pending = j.pending.Slice(n, j.pending.Len())
+	return n
+}
+
+type joinReader struct {
+	joiner
+	readers []sliceio.Reader
+	err     error
+
+	// bufs buffer the sorted rows of each side; a buffer is nil once
+	// its side is exhausted.
+	bufs [2]*sortio.FrameBuffer
+	// keys holds, in row 0, the key being joined. Row 1 is used to
+	// compare it with the keys of the buffers.
+	keys frame.Frame
+}
+
+func (r *joinReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const (
+		bufferSize = 128
+		spillSize  = 1 << 25
+	)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.keys.IsZero() {
+		for i := range r.bufs {
+			var sorted sliceio.Reader
+			sorted, r.err = sortio.SortReader(ctx, spillSize, r.op.Dep(i), r.readers[i])
+			if r.err != nil {
+				return 0, r.err
+			}
+			buf := &sortio.FrameBuffer{
+				Frame:  frame.Make(r.op.Dep(i), bufferSize, bufferSize),
+				Reader: sorted,
+			}
+			switch err := buf.Fill(ctx); {
+			case err == sliceio.EOF:
+				// No data. Leave the buffer nil.
+			case err != nil:
+				r.err = err
+				return 0, err
+			default:
+				r.bufs[i] = buf
+			}
+		}
+		r.keys = frame.Make(slicetype.New(r.op.out[:r.op.prefix]...), 2, 2).Prefixed(r.op.prefix)
+	}
+	var n int
+	for n < out.Len() {
+		if r.pending.Len() > 0 {
+			n += r.drain(out.Slice(n, out.Len()))
+			continue
+		}
+		if r.bufs[0] == nil && r.bufs[1] == nil {
+			break
+		}
+		// Join the smallest key at the head of either side.
+		side := 0
+		if r.bufs[0] == nil {
+			side = 1
+		} else if r.bufs[1] != nil {
+			r.setKey(0, r.bufs[0])
+			r.setKey(1, r.bufs[1])
+			if r.keys.Less(1, 0) {
+				side = 1
+			}
+		}
+		r.setKey(0, r.bufs[side])
+		for i := range r.groups {
+			if r.err = r.group(ctx, i); r.err != nil {
+				return n, r.err
+			}
+		}
+		r.join()
+	}
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// setKey sets row i of the reader's keys to the key of the current
+// row of the provided buffer.
+func (r *joinReader) setKey(i int, buf *sortio.FrameBuffer) {
+	for col := 0; col < r.op.prefix; col++ {
+		r.keys.Index(col, i).Set(buf.Frame.Index(col, buf.Index))
+	}
+}
+
+// group reads the rows of the provided side with the key being joined
+// into the side's group.
+func (r *joinReader) group(ctx context.Context, side int) error {
+	if !r.groups[side].IsZero() {
+		r.groups[side] = r.groups[side].Slice(0, 0)
+	}
+	for r.bufs[side] != nil {
+		buf := r.bufs[side]
+		r.setKey(1, buf)
+		if r.keys.Less(0, 1) || r.keys.Less(1, 0) {
+			break
+		}
+		r.groups[side] = frame.AppendFrame(r.groups[side], buf.Slice(buf.Index, buf.Index+1))
+		buf.Index++
+		if buf.Index < buf.Len {
+			continue
+		}
+		switch err := buf.Fill(ctx); {
+		case err == sliceio.EOF:
+			r.bufs[side] = nil
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// join joins the groups of the key being joined into the pending
+// rows.
+func (r *joiner) join() {
+	if r.op.kind.Filters() {
+		r.filter()
+		return
+	}
+	var rows [2][]int
+	for side, group := range r.groups {
+		var n int
+		if !group.IsZero() {
+			n = group.Len()
+		}
+		for i := 0; i < n; i++ {
+			rows[side] = append(rows[side], i)
+		}
+		// Missing optional sides are represented by row -1.
+		if n == 0 && r.op.kind.Optional(side) {
+			rows[side] = []int{-1}
+		}
+	}
+	n := len(rows[0]) * len(rows[1])
+	if r.buf.IsZero() {
+		r.buf = frame.Make(r.op, n, n)
+	}
+	r.buf = r.buf.Ensure(n)
+	var (
+		prefix = r.op.prefix
+		k      int
+	)
+	for _, i := range rows[0] {
+		for _, j := range rows[1] {
+			// The key is taken from whichever side is present.
+			keySide, keyRow := 0, i
+			if i < 0 {
+				keySide, keyRow = 1, j
+			}
+			for c := 0; c < prefix; c++ {
+				r.buf.Index(c, k).Set(r.groups[keySide].Index(c, keyRow))
+			}
+			col := prefix
+			for side, row := range [2]int{i, j} {
+				typ := r.op.Dep(side)
+				for c := prefix; c < typ.NumOut(); c++ {
+					if row >= 0 {
+						r.buf.Index(col, k).Set(r.groups[side].Index(c, row))
+					} else {
+						r.buf.Index(col, k).Set(reflect.Zero(typ.Out(c)))
+					}
+					col++
+				}
+			}
+			// Validity columns follow the value columns.
+			for side, row := range [2]int{i, j} {
+				if r.op.kind.Optional(side) {
+					r.buf.Index(col, k).SetBool(row >= 0)
+					col++
+				}
+			}
+			k++
+		}
+	}
+	r.pending = r.buf.Slice(0, n)
+}
+
+// filter filters the left group of the key being joined into the
+// pending rows: the group is kept by semi-joins if the key has rows in
+// the right group, and by anti-joins if it does not.
+func (r *joiner) filter() {
+	left, right := r.groups[0], r.groups[1]
+	if left.IsZero() || left.Len() == 0 {
+		return
+	}
+	matched := !right.IsZero() && right.Len() > 0
+	if matched != (r.op.kind == semiJoin) {
+		return
+	}
+	n := left.Len()
+	if r.buf.IsZero() {
+		r.buf = frame.Make(r.op, n, n)
+	}
+	r.buf = r.buf.Ensure(n)
+	frame.Copy(r.buf, left)
+	r.pending = r.buf.Slice(0, n)
+}
+
+// broadcastJoinReader joins each shard of the large side of a join
+// with the whole of its small, broadcast side, which is read into
+// memory and indexed by key.
+type broadcastJoinReader struct {
+	joiner
+	readers []sliceio.Reader
+	err     error
+
+	// table holds the rows of the broadcast side, sorted by key, and
+	// index maps the hash of each key in it to the [start, end) ranges
+	// of its rows.
+	table frame.Frame
+	index map[uint32][][2]int
+	// in holds the rows of the large side that are being joined, of
+	// which rest are yet to be joined.
+	in, rest frame.Frame
+	// keys is used to compare the key of a row of the large side (row
+	// 0) with the keys of the table (row 1).
+	keys frame.Frame
+}
+
+func (r *broadcastJoinReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 128
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		small = r.op.broadcast
+		large = 1 - small
+	)
+	if r.index == nil {
+		if r.err = r.load(ctx, r.readers[small]); r.err != nil {
+			return 0, r.err
+		}
+		r.in = frame.Make(r.op.Dep(large), bufferSize, bufferSize)
+		r.keys = frame.Make(slicetype.New(r.op.out[:r.op.prefix]...), 2, 2).Prefixed(r.op.prefix)
+	}
+	var n int
+	for n < out.Len() {
+		if r.pending.Len() > 0 {
+			n += r.drain(out.Slice(n, out.Len()))
+			continue
+		}
+		if r.rest.Len() == 0 {
+			if r.readers == nil {
+				break
+			}
+			m, err := r.readers[large].Read(ctx, r.in)
+			switch {
+			case err == sliceio.EOF:
+				r.readers = nil
+			case err != nil:
+				r.err = err
+				return n, err
+			}
+			r.rest = r.in.Slice(0, m)
+			continue
+		}
+		r.groups[large] = r.rest.Slice(0, 1)
+		r.groups[small] = r.lookup(r.rest)
+		r.rest = r.rest.Slice(1, r.rest.Len())
+		r.join()
+	}
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// load reads the rows of the broadcast side from the provided reader
+// into the reader's table, and indexes them.
+func (r *broadcastJoinReader) load(ctx context.Context, reader sliceio.Reader) error {
+	const chunkSize = 1 << 10
+	typ := r.op.Dep(r.op.broadcast)
+	r.table = frame.Make(typ, 0, chunkSize)
+	for {
+		n := r.table.Len()
+		r.table = r.table.Ensure(n + chunkSize)
+		m, err := reader.Read(ctx, r.table.Slice(n, n+chunkSize))
+		r.table = r.table.Slice(0, n+m)
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.table = r.table.Prefixed(r.op.prefix)
+	sort.Sort(r.table)
+	r.index = make(map[uint32][][2]int)
+	for start := 0; start < r.table.Len(); {
+		end := start + 1
+		for end < r.table.Len() && !r.table.Less(start, end) {
+			end++
+		}
+		h := r.table.Hash(start)
+		r.index[h] = append(r.index[h], [2]int{start, end})
+		start = end
+	}
+	return nil
+}
+
+// lookup returns the rows of the table whose key is that of the first
+// row of the provided frame of the large side, or a zero frame if
+// there are none.
+func (r *broadcastJoinReader) lookup(f frame.Frame) frame.Frame {
+	f = f.Prefixed(r.op.prefix)
+	for _, span := range r.index[f.Hash(0)] {
+		for col := 0; col < r.op.prefix; col++ {
+			r.keys.Index(col, 0).Set(f.Index(col, 0))
+			r.keys.Index(col, 1).Set(r.table.Index(col, span[0]))
+		}
+		if !r.keys.Less(0, 1) && !r.keys.Less(1, 0) {
+			return r.table.Slice(span[0], span[1])
+		}
+	}
+	return frame.Frame{}
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+// joinInputs returns the inputs of the join tests. If shuffle is
+// true, the inputs' sizes are unknown, so that they are joined by
+// shuffling; otherwise they may be broadcast.
+func joinInputs(nshard int, shuffle bool) (left, right bigslice.Slice) {
+	left = bigslice.Const(nshard,
+		[]string{"a", "b", "b", "c"},
+		[]int{1, 2, 3, 4},
+	)
+	right = bigslice.Const(nshard+1,
+		[]string{"b", "c", "c", "d"},
+		[]float64{0.2, 0.3, 0.4, 0.5},
+		[]bool{true, false, true, false},
+	)
+	if shuffle {
+		left, right = bigslice.Reshuffle(left), bigslice.Reshuffle(right)
+	}
+	return
+}
+
+func TestJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			// Rows are rendered as strings so that they may be compared in
+			// sorted order.
+			slice := bigslice.Map(bigslice.Join(left, right), func(k string, i int, f float64, b bool) string {
+				return fmt.Sprint(k, " ", i, f, b)
+			})
+			assertEqual(t, slice, true, []string{
+				"b 2 0.2 true",
+				"b 3 0.2 true",
+				"c 4 0.3 false",
+				"c 4 0.4 true",
+			})
+		}
+	}
+}
+
+func TestLeftJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			slice := bigslice.Map(bigslice.LeftJoin(left, right), func(k string, i int, f float64, b, ok bool) string {
+				return fmt.Sprint(k, " ", i, f, b, ok)
+			})
+			assertEqual(t, slice, true, []string{
+				"a 1 0 false false",
+				"b 2 0.2 true true",
+				"b 3 0.2 true true",
+				"c 4 0.3 false true",
+				"c 4 0.4 true true",
+			})
+		}
+	}
+}
+
+func TestRightJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			slice := bigslice.Map(bigslice.RightJoin(left, right), func(k string, i int, f float64, b, ok bool) string {
+				return fmt.Sprint(k, " ", i, f, b, ok)
+			})
+			assertEqual(t, slice, true, []string{
+				"b 2 0.2 true true",
+				"b 3 0.2 true true",
+				"c 4 0.3 false true",
+				"c 4 0.4 true true",
+				"d 0 0.5 false false",
+			})
+		}
+	}
+}
+
+func TestOuterJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			slice := bigslice.Map(bigslice.OuterJoin(left, right), func(k string, i int, f float64, b, lok, rok bool) string {
+				return fmt.Sprint(k, " ", i, f, b, lok, rok)
+			})
+			assertEqual(t, slice, true, []string{
+				"a 1 0 false true false",
+				"b 2 0.2 true true true",
+				"b 3 0.2 true true true",
+				"c 4 0.3 false true true",
+				"c 4 0.4 true true true",
+				"d 0 0.5 false false true",
+			})
+		}
+	}
+}
+
+func TestSemiJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			// Key "c" appears twice on the right, but its row is kept once.
+			assertEqual(t, bigslice.SemiJoin(left, right), true,
+				[]string{"b", "b", "c"},
+				[]int{2, 3, 4},
+			)
+		}
+	}
+}
+
+func TestAntiJoin(t *testing.T) {
+	for nshard := 1; nshard < 4; nshard++ {
+		for _, shuffle := range []bool{false, true} {
+			left, right := joinInputs(nshard, shuffle)
+			assertEqual(t, bigslice.AntiJoin(left, right), true,
+				[]string{"a"},
+				[]int{1},
+			)
+			assertEqual(t, bigslice.AntiJoin(right, left), true,
+				[]string{"d"},
+				[]float64{0.5},
+				[]bool{false},
+			)
+		}
+	}
+}
+
+func TestJoinLarge(t *testing.T) {
+	const N = 10000
+	var (
+		keys   = make([]string, N)
+		values = make([]int, N)
+		want   []string
+	)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i % 100)
+		values[i] = i
+	}
+	for i := 0; i < 100; i++ {
+		want = append(want, fmt.Sprint(i))
+	}
+	left := bigslice.Const(5, keys, values)
+	right := bigslice.Const(3, want, make([]int, 100))
+	slice := bigslice.Join(left, right)
+	slice = bigslice.Map(slice, func(k string, v, w int) (string, int) { return k, 1 })
+	slice = bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	counts := make([]int, 100)
+	for i := range counts {
+		counts[i] = N / 100
+	}
+	assertEqual(t, slice, true, append([]string(nil), want...), counts)
+}
+
+func TestJoinError(t *testing.T) {
+	var (
+		a = bigslice.Const(1, []string{"x"}, []int{1})
+		b = bigslice.Const(1, []int{1}, []int{1})
+		c = bigslice.Prefixed(bigslice.Const(1, []string{"x"}, []int{1}), 2)
+		d = bigslice.Const(1, [][]int{{1}}, []int{1})
+	)
+	expectTypeError(t, "join: key column type mismatch: expected string but got int", func() { bigslice.Join(a, b) })
+	expectTypeError(t, "leftjoin: prefix mismatch: expected 1 but got 2", func() { bigslice.LeftJoin(a, c) })
+	expectTypeError(t, "outerjoin: key column(0) type []int cannot be hashed", func() { bigslice.OuterJoin(d, d) })
+	expectTypeError(t, "semijoin: key column type mismatch: expected string but got int", func() { bigslice.SemiJoin(a, b) })
+	expectTypeError(t, "antijoin: prefix mismatch: expected 1 but got 2", func() { bigslice.AntiJoin(a, c) })
+}
+
+func TestJoinBroadcast(t *testing.T) {
+	const N = 1000
+	large := bigslice.ReaderFunc(2, func(shard int, n *int, keys []string, vals []int) (int, error) {
+		if *n >= N {
+			return 0, sliceio.EOF
+		}
+		m := len(keys)
+		if m > N-*n {
+			m = N - *n
+		}
+		for i := 0; i < m; i++ {
+			keys[i] = fmt.Sprint((*n + i) % 10)
+			vals[i] = shard
+		}
+		*n += m
+		return m, nil
+	})
+	small := bigslice.Const(3, []string{"1", "2", "3"}, []string{"one", "two", "three"})
+	// The size of the small side is unknown, so the pragma determines
+	// that it is broadcast, and the join retains the large side's
+	// shards.
+	small = bigslice.Map(bigslice.Reshuffle(small), func(k, v string) (string, string) { return k, v }, bigslice.Broadcast)
+	slice := bigslice.Join(small, large)
+	if got, want := slice.NumShard(), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	slice = bigslice.Map(slice, func(k, v string, shard int) (string, int) { return v, 1 })
+	slice = bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	assertEqual(t, slice, true, []string{"one", "three", "two"}, []int{2 * N / 10, 2 * N / 10, 2 * N / 10})
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A Limiter is a Slice of which only a limited number of rows, across
+// all of its shards, are needed. Evaluators may thus compute its shards
+// incrementally, and skip the computation of the remaining shards once
+// the computed ones have produced enough rows. See Limit.
+type Limiter interface {
+	// Limit returns the number of rows that are needed.
+	Limit() int
+}
+
+// limitSlice returns at most n rows of its dependency. If gather is
+// false, it limits each shard of its dependency, with which it is
+// pipelined; otherwise, it gathers its dependency, itself a
+// limitSlice, into a single shard.
+type limitSlice struct {
+	name Name
+	Slice
+	n      int
+	gather bool
+}
+
+// Limit returns a slice that contains at most n rows of the provided
+// slice, which has the same type, in a single shard.
+//
+// Limit is meant for sampling the output of a pipeline, e.g., to "show
+// a few rows": the shards of the final stage of the provided slice
+// (i.e., those that are computed after its last shuffle) are computed
+// incrementally, starting with a single shard, and once enough rows
+// have been produced, the computation of the remaining shards is
+// skipped, and that of the shards that are still running is canceled.
+// Each shard also stops reading its input once it has produced n rows.
+// The stages that precede the last shuffle are computed in full.
+//
+// Which rows are returned is unspecified.
+func Limit(slice Slice, n int) Slice {
+	if n <= 0 {
+		typecheck.Panicf(1, "limit: n must be positive, got %d", n)
+	}
+	return limit(MakeName(fmt.Sprintf("limit(%d)", n)), slice, n)
+}
+
+// limit returns a limit slice with the provided name; see Limit.
+func limit(name Name, slice Slice, n int) Slice {
+	shards := &limitSlice{name, slice, n, false}
+	return &limitSlice{name, shards, n, true}
+}
+
+func (l *limitSlice) Name() Name             { return l.name }
+func (*limitSlice) NumDep() int              { return 1 }
+func (l *limitSlice) Dep(i int) Dep          { return singleDep(i, l.Slice, l.gather) }
+func (*limitSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (l *limitSlice) NumShard() int {
+	if l.gather {
+		return 1
+	}
+	return l.Slice.NumShard()
+}
+
+func (l *limitSlice) ShardType() ShardType {
+	if l.gather {
+		return HashShard
+	}
+	return l.Slice.ShardType()
+}
+
+// Limit implements Limiter. Only the shards of the first stage, whose
+// output is gathered, are limited.
+func (l *limitSlice) Limit() int {
+	if l.gather {
+		return 0
+	}
+	return l.n
+}
+
+// MaxRows implements Sizer.
+func (l *limitSlice) MaxRows() int {
+	if max := maxRows(l.Slice); max >= 0 && max < l.n {
+		return max
+	}
+	if l.gather {
+		return l.n
+	}
+	return -1
+}
+
+func (l *limitSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &limitReader{op: l, reader: deps[0], n: l.n}
+}
+
+type limitReader struct {
+	op     *limitSlice
+	reader sliceio.Reader
+	n      int
+}
+
+func (r *limitReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.n <= 0 {
+		return 0, sliceio.EOF
+	}
+	if out.Len() > r.n {
+		out = out.Slice(0, r.n)
+	}
+	n, err := r.reader.Read(ctx, out)
+	r.n -= n
+	if err == nil && r.n == 0 {
+		err = sliceio.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestLimit(t *testing.T) {
+	slice := bigslice.Limit(bigslice.Const(1, []int{1, 2, 3, 4, 5}, []string{"a", "b", "c", "d", "e"}), 3)
+	assertEqual(t, slice, false, []int{1, 2, 3}, []string{"a", "b", "c"})
+	// Limits larger than the slice return it in full.
+	slice = bigslice.Limit(bigslice.Const(2, []int{1, 2, 3}), 10)
+	assertEqual(t, slice, false, []int{1, 2, 3})
+
+	const N = 1000
+	input := make([]int, N)
+	for i := range input {
+		input[i] = i
+	}
+	slice = bigslice.Const(100, input)
+	slice = bigslice.Filter(slice, func(i int) bool { return i%3 == 0 })
+	slice = bigslice.Limit(slice, 20)
+	if got, want := slice.NumShard(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	ctx := context.Background()
+	for name, s := range run(ctx, t, slice) {
+		var (
+			seen = make(map[int]bool)
+			i    int
+		)
+		for s.Scan(ctx, &i) {
+			if i%3 != 0 || seen[i] {
+				t.Errorf("%s: unexpected row %d", name, i)
+			}
+			seen[i] = true
+		}
+		if err := s.Err(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if got, want := len(seen), 20; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	slice := bigslice.Const(1, []int{1})
+	expectTypeError(t, "limit: n must be positive, got 0", func() { bigslice.Limit(slice, 0) })
+}
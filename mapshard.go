@@ -0,0 +1,182 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A ShardFunc computes a whole shard of a slice returned by MapShard.
+// It is passed the shard's number, the total number of shards, a
+// scanner of the input shard, and a writer to which the output shard is
+// written; the shard is complete when the function returns.
+type ShardFunc func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error
+
+// MapShard returns a slice whose shards are computed from the
+// corresponding shards of the provided slice by the provided function,
+// which is invoked once per shard. Unlike Map, which is invoked for
+// each row, MapShard's function sees the whole shard, and its identity,
+// so that it may perform per-shard setup (e.g., open a connection, or
+// an output file named by the shard) and implement algorithms that
+// require the shard's number. The returned slice has the provided type,
+// e.g., as constructed by Schema, and the number of shards of the
+// provided slice. Schematically:
+//
+//	MapShard(Slice<t1, ..., tn>, Type<r1, ..., rm>, ShardFunc) Slice<r1, ..., rm>
+//
+// For example, the following writes each shard to its own file and
+// returns the number of rows written to each:
+//
+//	counts := bigslice.MapShard(slice, bigslice.Schema(1, reflect.TypeOf(0), reflect.TypeOf(0)),
+//		func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+//			f, err := file.Create(ctx, fmt.Sprintf("%s/%04d-of-%04d", dir, shard, numShard))
+//			...
+//			var count int
+//			for in.Scan(ctx, &line) {
+//				...
+//				count++
+//			}
+//			...
+//			return out.Write(ctx, frame.Slices([]int{shard}, []int{count}))
+//		})
+//
+// Frames written to out are copied, and may be reused once Write
+// returns. Write returns an error if the frame's type does not match
+// the returned slice's type. The function is run concurrently with the
+// readers of its output, which are blocked until it writes or returns.
+// As with WriterFunc, errors returned by the function are fatal to the
+// task unless they are temporary. Nulls may be written only to the
+// columns that are nullable in the output type; see
+// slicetype.WithNullable.
+func MapShard(slice Slice, out slicetype.Type, fn ShardFunc) Slice {
+	if out == nil || out.NumOut() == 0 {
+		typecheck.Panic(1, "mapshard: output type must have at least one column")
+	}
+	if fn == nil {
+		typecheck.Panic(1, "mapshard: shard function must be provided")
+	}
+	run := func(ctx context.Context, shard int, in sliceio.Reader, out sliceio.Writer) error {
+		scanner := sliceio.NewScanner(slice, sliceio.NopCloser(in))
+		err := fn(ctx, shard, slice.NumShard(), scanner, out)
+		if err != nil && !errors.IsTemporary(err) {
+			err = errors.E(errors.Fatal, err)
+		}
+		return err
+	}
+	return &mapShardSlice{MakeName("mapshard"), slice, Pragmas(nil), out, run}
+}
+
+// MapShardSlice computes each of its shards by running a function
+// that reads the corresponding input shard and writes the output
+// shard.
+type mapShardSlice struct {
+	name Name
+	Slice
+	Pragmas
+	out slicetype.Type
+	run func(ctx context.Context, shard int, in sliceio.Reader, out sliceio.Writer) error
+}
+
+func (m *mapShardSlice) Name() Name             { return m.name }
+func (m *mapShardSlice) NumOut() int            { return m.out.NumOut() }
+func (m *mapShardSlice) Out(c int) reflect.Type { return m.out.Out(c) }
+func (m *mapShardSlice) Prefix() int            { return m.out.Prefix() }
+func (*mapShardSlice) ShardType() ShardType     { return HashShard }
+func (*mapShardSlice) NumDep() int              { return 1 }
+func (m *mapShardSlice) Dep(i int) Dep          { return singleDep(i, m.Slice, false) }
+func (*mapShardSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// Nullable implements slicetype.NullableType.
+func (m *mapShardSlice) Nullable(i int) bool { return slicetype.Nullable(m.out, i) }
+
+func (m *mapShardSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &mapShardReader{op: m, shard: shard, reader: deps[0]}
+}
+
+// MapShardReader runs a shard's function in a separate goroutine,
+// reading the frames that it writes as they are written.
+type mapShardReader struct {
+	op     *mapShardSlice
+	shard  int
+	reader sliceio.Reader
+
+	// frames carries the frames written by the shard function. It is
+	// closed when the function returns, after err is set to its
+	// error.
+	frames chan frame.Frame
+	err    error
+	// buf is the remainder of the frame that is being read.
+	buf frame.Frame
+}
+
+func (r *mapShardReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.frames == nil {
+		r.frames = make(chan frame.Frame)
+		go func() {
+			r.err = r.op.run(ctx, r.shard, r.reader, &shardWriter{r.op, r.frames})
+			close(r.frames)
+		}()
+	}
+	for r.buf.Len() == 0 {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case f, ok := <-r.frames:
+			if !ok {
+				if r.err == nil {
+					r.err = sliceio.EOF
+				}
+				return 0, r.err
+			}
+			r.buf = f
+		}
+	}
+	n := frame.Copy(out, r.buf)
+	r.buf = r.buf.Slice(n, r.buf.Len())
+	return n, nil
+}
+
+// ShardWriter is the writer to which a shard function writes its
+// output shard.
+type shardWriter struct {
+	op     *mapShardSlice
+	frames chan<- frame.Frame
+}
+
+func (w *shardWriter) Write(ctx context.Context, f frame.Frame) error {
+	if !slicetype.Assignable(f, w.op) {
+		return fmt.Errorf("mapshard: frame of type %s does not match output type %s",
+			slicetype.String(f), slicetype.String(w.op))
+	}
+	for col := 0; col < f.NumOut(); col++ {
+		if !slicetype.Nullable(w.op.out, col) && f.NullCount(col) > 0 {
+			return fmt.Errorf("mapshard: frame has nulls in column %d, which is not nullable in output type %s",
+				col, slicetype.String(w.op.out))
+		}
+	}
+	if f.Len() == 0 {
+		return nil
+	}
+	copied := frame.Make(w.op, f.Len(), f.Len())
+	frame.Copy(copied, f)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case w.frames <- copied:
+		return nil
+	}
+}
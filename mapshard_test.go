@@ -0,0 +1,102 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetest"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func TestMapShard(t *testing.T) {
+	const N = 1000
+	vals := make([]int, N)
+	for i := range vals {
+		vals[i] = i
+	}
+	slice := bigslice.Const(4, vals)
+	// Each shard emits, in separate frames, the sum of its values, its
+	// identity, and the number of shards, after reading the whole shard.
+	slice = bigslice.MapShard(slice, bigslice.Schema(1, reflect.TypeOf(""), reflect.TypeOf(0)),
+		func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+			var v, sum int
+			for in.Scan(ctx, &v) {
+				sum += v
+			}
+			if err := in.Err(); err != nil {
+				return err
+			}
+			for _, f := range []frame.Frame{
+				frame.Slices([]string{"sum"}, []int{sum}),
+				frame.Slices([]string{"shard"}, []int{1 << uint(shard)}),
+				frame.Slices([]string{"numshard"}, []int{numShard}),
+			} {
+				if err := out.Write(ctx, f); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	slice = bigslice.Reduce(slice, func(a, b int) int { return a + b })
+	assertEqual(t, slice, true,
+		[]string{"numshard", "shard", "sum"},
+		[]int{4 * 4, 1 + 2 + 4 + 8, N * (N - 1) / 2})
+}
+
+func TestMapShardError(t *testing.T) {
+	slice := bigslice.Const(2, []int{1, 2, 3})
+	failing := bigslice.MapShard(slice, bigslice.Schema(1, reflect.TypeOf(0)),
+		func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+			return errors.New("shard failed")
+		})
+	if err := slicetest.RunErr(failing); err == nil || !strings.Contains(err.Error(), "shard failed") {
+		t.Errorf("expected shard failure, got %v", err)
+	}
+	mistyped := bigslice.MapShard(slice, bigslice.Schema(1, reflect.TypeOf(0)),
+		func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+			return out.Write(ctx, frame.Slices([]string{"x"}))
+		})
+	if err := slicetest.RunErr(mistyped); err == nil || !strings.Contains(err.Error(), "does not match output type") {
+		t.Errorf("expected type mismatch, got %v", err)
+	}
+	expectTypeError(t, "mapshard: output type must have at least one column", func() {
+		bigslice.MapShard(slice, nil, nil)
+	})
+}
+
+func TestMapShardNulls(t *testing.T) {
+	nulls := func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+		f := frame.Slices([]string{"a", "b"}, []int{1, 0})
+		f.SetNull(1, 1, true)
+		return out.Write(ctx, f)
+	}
+	var (
+		slice = bigslice.Const(1, []int{1})
+		typ   = bigslice.Schema(1, reflect.TypeOf(""), reflect.TypeOf(0))
+	)
+	nullable := bigslice.MapShard(slice, slicetype.WithNullable(typ, 1), nulls)
+	if got, want := slicetype.String(nullable), "slice[1]string,int?"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Nullable columns propagate through unions.
+	union := bigslice.Union(bigslice.Const(1, []string{"c"}, []int{3}), nullable)
+	if got, want := slicetype.String(union), "slice[1]string,int?"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, bigslice.Reshuffle(union), true, []string{"a", "b", "c"}, []int{1, 0, 3})
+
+	notNullable := bigslice.MapShard(slice, typ, nulls)
+	if err := slicetest.RunErr(notNullable); err == nil || !strings.Contains(err.Error(), "which is not nullable") {
+		t.Errorf("expected nullability error, got %v", err)
+	}
+}
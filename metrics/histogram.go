@@ -0,0 +1,192 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Histogram is a metric that counts observed values in a fixed set of
+// buckets, and tracks their number and sum.
+type Histogram struct {
+	id int
+	// bounds are the inclusive upper bounds of the histogram's buckets,
+	// in increasing order. Values greater than the last bound are
+	// counted in an overflow bucket.
+	bounds []float64
+}
+
+// NewHistogram creates, registers, and returns a new Histogram metric
+// with the provided name (which may be empty) and bucket bounds. Each
+// bound is the inclusive upper bound of a bucket; values greater than
+// every bound are counted in an additional overflow bucket.
+// NewHistogram panics if the bounds are not strictly increasing.
+func NewHistogram(name string, bounds ...float64) Histogram {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			panic("metrics.NewHistogram: bounds are not strictly increasing")
+		}
+	}
+	h := Histogram{bounds: append([]float64(nil), bounds...)}
+	newMetric(name, func(id int) Metric {
+		h.id = id
+		return h
+	})
+	return h
+}
+
+// Observe records the value v in this histogram in the provided scope.
+func (h Histogram) Observe(scope *Scope, v float64) {
+	scope.instance(h).(*histogramValue).observe(sort.SearchFloat64s(h.bounds, v), v)
+}
+
+// Value retrieves the current value of this histogram in the provided
+// scope.
+func (h Histogram) Value(scope *Scope) HistogramValue {
+	return scope.instance(h).(*histogramValue).load(h.bounds)
+}
+
+// metricID implements Metric.
+func (h Histogram) metricID() int { return h.id }
+
+// newInstance implements Metric.
+func (h Histogram) newInstance() interface{} {
+	return &histogramValue{state: histogramState{Counts: make([]int64, len(h.bounds)+1)}}
+}
+
+// merge implements Metric.
+func (h Histogram) merge(x, y interface{}) {
+	x.(*histogramValue).merge(y.(*histogramValue))
+}
+
+// value implements Metric.
+func (h Histogram) value(x interface{}) interface{} {
+	return x.(*histogramValue).load(h.bounds)
+}
+
+// HistogramValue is the value of a histogram in a scope.
+type HistogramValue struct {
+	// Bounds are the inclusive upper bounds of the histogram's buckets.
+	Bounds []float64
+	// Counts holds the number of values observed in each bucket. The
+	// last count is that of the overflow bucket.
+	Counts []int64
+	// Count and Sum are the number and sum of the observed values.
+	Count int64
+	Sum   float64
+}
+
+// Mean returns the mean of the observed values, or NaN if none were
+// observed.
+func (v HistogramValue) Mean() float64 {
+	if v.Count == 0 {
+		return math.NaN()
+	}
+	return v.Sum / float64(v.Count)
+}
+
+// Quantile returns an upper bound of the q-quantile of the observed
+// values: the upper bound of the bucket in which it falls. It returns
+// +Inf if the quantile falls in the overflow bucket, and NaN if no
+// values were observed.
+func (v HistogramValue) Quantile(q float64) float64 {
+	if v.Count == 0 {
+		return math.NaN()
+	}
+	rank := int64(math.Ceil(q * float64(v.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var n int64
+	for i, count := range v.Counts {
+		if n += count; n >= rank && i < len(v.Bounds) {
+			return v.Bounds[i]
+		}
+	}
+	return math.Inf(1)
+}
+
+// String returns a summary of the histogram value.
+func (v HistogramValue) String() string {
+	if v.Count == 0 {
+		return "n=0"
+	}
+	return fmt.Sprintf("n=%d mean=%.3g p50<=%g p99<=%g", v.Count, v.Mean(), v.Quantile(0.5), v.Quantile(0.99))
+}
+
+func init() {
+	gob.Register(&histogramValue{})
+}
+
+// histogramValue holds the state of a histogram in a scope.
+type histogramValue struct {
+	mu    sync.Mutex
+	state histogramState
+}
+
+// histogramState is the gob-encoded state of a histogram.
+type histogramState struct {
+	Counts []int64
+	Count  int64
+	Sum    float64
+}
+
+// GobEncode implements gob.GobEncoder, so that histograms may be encoded
+// while they are being updated.
+func (h *histogramValue) GobEncode() ([]byte, error) {
+	var b bytes.Buffer
+	h.mu.Lock()
+	err := gob.NewEncoder(&b).Encode(h.state)
+	h.mu.Unlock()
+	return b.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder.
+func (h *histogramValue) GobDecode(p []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return gob.NewDecoder(bytes.NewReader(p)).Decode(&h.state)
+}
+
+func (h *histogramValue) observe(bucket int, v float64) {
+	h.mu.Lock()
+	h.state.Counts[bucket]++
+	h.state.Count++
+	h.state.Sum += v
+	h.mu.Unlock()
+}
+
+func (h *histogramValue) load(bounds []float64) HistogramValue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramValue{
+		Bounds: bounds,
+		Counts: append([]int64(nil), h.state.Counts...),
+		Count:  h.state.Count,
+		Sum:    h.state.Sum,
+	}
+}
+
+func (h *histogramValue) merge(g *histogramValue) {
+	g.mu.Lock()
+	state := histogramState{
+		Counts: append([]int64(nil), g.state.Counts...),
+		Count:  g.state.Count,
+		Sum:    g.state.Sum,
+	}
+	g.mu.Unlock()
+	h.mu.Lock()
+	for i := range state.Counts {
+		h.state.Counts[i] += state.Counts[i]
+	}
+	h.state.Count += state.Count
+	h.state.Sum += state.Sum
+	h.mu.Unlock()
+}
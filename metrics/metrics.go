@@ -20,11 +20,21 @@
 // optional context.Context argument. The user must retrieve this
 // Scope using the ContextScope func.
 //
+// Metrics may be given names (e.g., NewNamedCounter). The values of
+// named metrics are displayed by the Bigslice runtime as tasks
+// progress, and may be retrieved by name from a Scope.
+//
+// User functions may also report the progress of their task, e.g., the
+// number of records processed or the current stage of a long-running
+// computation, to the Progress retrieved from their context by
+// ContextProgress.
+//
 // Metrics cannot be declared concurrently.
 package metrics
 
 import (
 	"encoding/gob"
+	"fmt"
 	"sync/atomic"
 )
 
@@ -32,9 +42,23 @@ import (
 // the chances of zero-valued metrics instances being used uninitialized.
 var metrics = []Metric{zeroMetric{}}
 
-// newMetric defines a new metric.
-func newMetric(makeMetric func(id int) Metric) {
+// names holds the names of registered metrics, indexed by id. Unnamed
+// metrics have empty names.
+var names = []string{""}
+
+// newMetric defines a new metric with the provided name, which may be
+// empty. NewMetric panics if a metric with the same name has already
+// been defined.
+func newMetric(name string, makeMetric func(id int) Metric) {
+	if name != "" {
+		for _, other := range names {
+			if other == name {
+				panic(fmt.Sprintf("metrics: metric %q already defined", name))
+			}
+		}
+	}
 	metrics = append(metrics, makeMetric(len(metrics)))
+	names = append(names, name)
 }
 
 // Metric is the abstract type of a metric. Each metric type must implement a
@@ -51,6 +75,8 @@ type Metric interface {
 	newInstance() interface{}
 	// merge merges the second metric instance into the first.
 	merge(interface{}, interface{})
+	// value returns the user-facing value of a metric instance.
+	value(interface{}) interface{}
 }
 
 // Counter is a simple counter metric. Counters implement atomic
@@ -61,8 +87,14 @@ type Counter struct {
 
 // NewCounter creates, registers, and returns a new Counter metric.
 func NewCounter() Counter {
+	return NewNamedCounter("")
+}
+
+// NewNamedCounter creates, registers, and returns a new Counter metric
+// with the provided name.
+func NewNamedCounter(name string) Counter {
 	var c Counter
-	newMetric(func(id int) Metric {
+	newMetric(name, func(id int) Metric {
 		c.id = id
 		return c
 	})
@@ -92,6 +124,11 @@ func (c Counter) merge(x, y interface{}) {
 	x.(*counterValue).merge(y.(*counterValue))
 }
 
+// value implements Metric.
+func (c Counter) value(x interface{}) interface{} {
+	return x.(*counterValue).load()
+}
+
 func init() {
 	gob.Register(&counterValue{})
 }
@@ -124,3 +161,4 @@ type zeroMetric struct{}
 func (zeroMetric) metricID() int                  { return 0 }
 func (zeroMetric) newInstance() interface{}       { return nil }
 func (zeroMetric) merge(interface{}, interface{}) {}
+func (zeroMetric) value(interface{}) interface{}  { return nil }
@@ -5,9 +5,13 @@
 package metrics_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"fmt"
 	"log"
+	"math"
+	"reflect"
 	"testing"
 
 	"github.com/grailbio/bigslice"
@@ -63,3 +67,75 @@ func ExampleCounter() {
 	fmt.Println("filtered:", filterCount.Value(res.Scope()))
 	// Output: filtered: 3
 }
+
+func TestHistogram(t *testing.T) {
+	var (
+		a, b metrics.Scope
+		h    = metrics.NewHistogram("", 1, 10, 100)
+	)
+	for _, v := range []float64{0.5, 1, 5, 50, 50, 500} {
+		h.Observe(&a, v)
+	}
+	h.Observe(&b, 2)
+	a.Merge(&b)
+	v := h.Value(&a)
+	if got, want := v.Counts, []int64{2, 2, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := v.Count, int64(7); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := v.Mean(), 608.5/7; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, c := range []struct {
+		q, want float64
+	}{
+		{0, 1}, {0.5, 10}, {0.8, 100}, {1, math.Inf(1)},
+	} {
+		if got := v.Quantile(c.q); got != c.want {
+			t.Errorf("quantile %v: got %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&a); err != nil {
+		t.Fatal(err)
+	}
+	var c metrics.Scope
+	if err := gob.NewDecoder(&buf).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.Value(&c), v; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	var (
+		scope metrics.Scope
+		c     = metrics.NewNamedCounter("test.records")
+		h     = metrics.NewHistogram("test.sizes", 10)
+		_     = metrics.NewNamedCounter("test.unused")
+		_     = metrics.NewCounter()
+	)
+	c.Incr(&scope, 3)
+	h.Observe(&scope, 4)
+	named := scope.Named()
+	if got, want := len(named), 2; got != want {
+		t.Fatalf("got %v, want %v", named, want)
+	}
+	if got, want := named["test.records"], int64(3); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := named["test.sizes"].(metrics.HistogramValue).String(), "n=1 mean=4 p50<=10 p99<=10"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	metrics.NewNamedCounter("test.records")
+}
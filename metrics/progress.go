@@ -0,0 +1,150 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a task's progress reporter. User functions report the
+// progress of the task in which they run (for example, the number of
+// records processed, or the stage of a long-running computation) to the
+// Progress supplied through their optional context.Context argument,
+// retrieved by ContextProgress. Reports also serve as heartbeats: the
+// Bigslice runtime displays progress as tasks run, and uses the time of
+// the most recent report to distinguish slow tasks that are still
+// making progress from hung ones.
+//
+// The methods of a nil *Progress are no-ops, so that user functions
+// may report progress unconditionally.
+type Progress struct {
+	// records and updated are accessed atomically; updated is the Unix
+	// time, in nanoseconds, of the most recent report.
+	records, updated int64
+
+	mu      sync.Mutex
+	message string
+}
+
+// ProgressReport is a snapshot of a Progress.
+type ProgressReport struct {
+	// Records is the number of records reported as processed.
+	Records int64
+	// Message is the most recently reported stage message.
+	Message string
+	// Updated is the time of the most recent report; it is zero if
+	// nothing has been reported.
+	Updated time.Time
+}
+
+// IsZero tells whether the report is empty, i.e., whether nothing has
+// been reported.
+func (r ProgressReport) IsZero() bool {
+	return r.Updated.IsZero()
+}
+
+// String returns a description of the report, e.g.,
+// "1234 records; sorting (3s ago)", relative to the current time.
+func (r ProgressReport) String() string {
+	if r.IsZero() {
+		return "no progress reported"
+	}
+	s := fmt.Sprintf("%d records", r.Records)
+	if r.Message != "" {
+		s += "; " + r.Message
+	}
+	return fmt.Sprintf("%s (%s ago)", s, time.Since(r.Updated).Round(time.Second))
+}
+
+// Add reports that n more records have been processed.
+func (p *Progress) Add(n int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.records, n)
+	p.touch()
+}
+
+// Printf reports the current stage of processing, formatted as by
+// fmt.Sprintf.
+func (p *Progress) Printf(format string, args ...interface{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.message = fmt.Sprintf(format, args...)
+	p.mu.Unlock()
+	p.touch()
+}
+
+// Heartbeat reports that processing is continuing, without otherwise
+// changing the reported progress.
+func (p *Progress) Heartbeat() {
+	if p == nil {
+		return
+	}
+	p.touch()
+}
+
+func (p *Progress) touch() {
+	atomic.StoreInt64(&p.updated, time.Now().UnixNano())
+}
+
+// Report returns a snapshot of the progress reported so far.
+func (p *Progress) Report() ProgressReport {
+	if p == nil {
+		return ProgressReport{}
+	}
+	var r ProgressReport
+	if updated := atomic.LoadInt64(&p.updated); updated != 0 {
+		r.Updated = time.Unix(0, updated)
+	}
+	r.Records = atomic.LoadInt64(&p.records)
+	p.mu.Lock()
+	r.Message = p.message
+	p.mu.Unlock()
+	return r
+}
+
+// Reset sets the progress to the provided report. It is used by the
+// Bigslice runtime to reset progress when a task is (re)run, and to
+// propagate the progress of remotely running tasks.
+func (p *Progress) Reset(r ProgressReport) {
+	var updated int64
+	if !r.Updated.IsZero() {
+		updated = r.Updated.UnixNano()
+	}
+	p.mu.Lock()
+	p.message = r.Message
+	atomic.StoreInt64(&p.records, r.Records)
+	atomic.StoreInt64(&p.updated, updated)
+	p.mu.Unlock()
+}
+
+// progressContextKeyType is used to create a unique context key for
+// progress reporters.
+type progressContextKeyType struct{}
+
+// progressContextKey is the key used to attach progress reporters to
+// contexts.
+var progressContextKey progressContextKeyType
+
+// ProgressContext returns a context with the provided progress
+// reporter attached. The reporter may be retrieved by ContextProgress.
+func ProgressContext(ctx context.Context, p *Progress) context.Context {
+	return context.WithValue(ctx, progressContextKey, p)
+}
+
+// ContextProgress returns the progress reporter attached to the
+// provided context. Unlike ContextScope, ContextProgress returns nil
+// (whose methods are no-ops) if the context has no attached reporter.
+func ContextProgress(ctx context.Context) *Progress {
+	p, _ := ctx.Value(progressContextKey).(*Progress)
+	return p
+}
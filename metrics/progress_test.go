@@ -0,0 +1,66 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice/metrics"
+)
+
+func TestProgress(t *testing.T) {
+	var p metrics.Progress
+	if !p.Report().IsZero() {
+		t.Errorf("got %v, want empty report", p.Report())
+	}
+	before := time.Now()
+	p.Add(10)
+	p.Add(5)
+	p.Printf("stage %d", 2)
+	r := p.Report()
+	if got, want := r.Records, int64(15); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := r.Message, "stage 2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if r.Updated.Before(before) {
+		t.Errorf("report %v predates %v", r.Updated, before)
+	}
+
+	var q metrics.Progress
+	q.Reset(r)
+	if got, want := q.Report(), r; got.Records != want.Records || got.Message != want.Message || !got.Updated.Equal(want.Updated) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	q.Reset(metrics.ProgressReport{})
+	if !q.Report().IsZero() {
+		t.Errorf("got %v, want empty report", q.Report())
+	}
+}
+
+func TestContextProgress(t *testing.T) {
+	ctx := context.Background()
+	// Reports to contexts without progress are dropped.
+	p := metrics.ContextProgress(ctx)
+	if p != nil {
+		t.Fatalf("got %v, want nil", p)
+	}
+	p.Add(1)
+	p.Printf("ignored")
+	p.Heartbeat()
+	if !p.Report().IsZero() {
+		t.Errorf("got %v, want empty report", p.Report())
+	}
+
+	p = new(metrics.Progress)
+	ctx = metrics.ProgressContext(ctx, p)
+	metrics.ContextProgress(ctx).Add(3)
+	if got, want := p.Report().Records, int64(3); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -58,6 +58,22 @@ func (s *Scope) Merge(u *Scope) {
 	}
 }
 
+// Named returns the values of the named metrics that have instances in
+// the scope s, keyed by name. Counter values are int64s; histogram
+// values are HistogramValues.
+func (s *Scope) Named() map[string]interface{} {
+	named := make(map[string]interface{})
+	for i, m := range metrics {
+		if names[i] == "" {
+			continue
+		}
+		if inst := s.load(m); inst != nil {
+			named[names[i]] = m.value(inst)
+		}
+	}
+	return named
+}
+
 // Reset resets the scope s to u. It is reset to its initial (zero) state
 // if u is nil.
 func (s *Scope) Reset(u *Scope) {
@@ -0,0 +1,172 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicestats"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var typeOfTDigest = reflect.TypeOf((*slicestats.TDigest)(nil))
+
+// Percentile returns a slice that estimates the provided percentiles,
+// each in [0, 100], of the values of each key of the provided slice,
+// which must have exactly one value column, of a numeric type. The
+// returned slice has a float64 column for each percentile, in the
+// order provided. Schematically:
+//
+//	Percentile(Slice<k1, ..., kp, v>, p1, ..., pn) Slice<k1, ..., kp, float64, ..., float64>
+//
+// Percentiles are estimated with t-digests (see slicestats.TDigest),
+// which are merged map-side by combiners, so that the values of each
+// key need not be collected. Estimates are within about 1% of rank of
+// the true percentiles, and are more accurate near the tails.
+func Percentile(slice Slice, ps ...float64) Slice {
+	return makePercentileSlice("percentile", slice, ps)
+}
+
+// Median returns a slice that estimates the median of the values of
+// each key of the provided slice, as Percentile(slice, 50).
+// Schematically:
+//
+//	Median(Slice<k1, ..., kp, v>) Slice<k1, ..., kp, float64>
+func Median(slice Slice) Slice {
+	return makePercentileSlice("median", slice, []float64{50})
+}
+
+// makePercentileSlice returns a slice of the provided percentiles of
+// the values of each key of slice. It panics with a type error, on
+// behalf of its caller's caller, if they cannot be computed.
+func makePercentileSlice(op string, slice Slice, ps []float64) Slice {
+	if len(ps) == 0 {
+		typecheck.Panicf(2, "%s: no percentiles provided", op)
+	}
+	for _, p := range ps {
+		if !(p >= 0 && p <= 100) {
+			typecheck.Panicf(2, "%s: percentile %v is not in [0, 100]", op, p)
+		}
+	}
+	if res := slice.NumOut() - slice.Prefix(); res != 1 {
+		typecheck.Panicf(2, "%s: the slice must have exactly 1 value column; has %d", op, res)
+	}
+	switch typ := slice.Out(slice.Prefix()); typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+	default:
+		typecheck.Panicf(2, "%s: value type %s is not numeric", op, typ)
+	}
+	digests := &percentileSlice{
+		name:  MakeName(op),
+		Slice: slice,
+	}
+	if err := canMakeCombiningFrame(digests); err != nil {
+		typecheck.Panic(2, err.Error())
+	}
+	reduced := Reduce(digests, func(x, y *slicestats.TDigest) *slicestats.TDigest {
+		// Digests are made afresh for each row, and are not otherwise
+		// shared, and so they may be merged in place.
+		x.MergeFrom(y)
+		return x
+	})
+	return &percentileSlice{
+		name:  MakeName(op),
+		Slice: reduced,
+		ps:    append([]float64(nil), ps...),
+	}
+}
+
+// percentileSlice replaces the value column of its dependency: by the
+// t-digest of each value if ps is empty, or by the estimated
+// percentiles ps of each digest, otherwise.
+type percentileSlice struct {
+	name Name
+	Slice
+	ps []float64
+}
+
+func (p *percentileSlice) Name() Name { return p.name }
+
+func (p *percentileSlice) NumOut() int {
+	if p.ps == nil {
+		return p.Slice.NumOut()
+	}
+	return p.Prefix() + len(p.ps)
+}
+
+func (p *percentileSlice) Out(c int) reflect.Type {
+	switch {
+	case c < p.Prefix():
+		return p.Slice.Out(c)
+	case p.ps == nil:
+		return typeOfTDigest
+	default:
+		return typeOfFloat64
+	}
+}
+
+func (*percentileSlice) NumDep() int              { return 1 }
+func (p *percentileSlice) Dep(i int) Dep          { return singleDep(i, p.Slice, false) }
+func (*percentileSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (p *percentileSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &percentileReader{op: p, reader: deps[0]}
+}
+
+type percentileReader struct {
+	op     *percentileSlice
+	reader sliceio.Reader
+	in     frame.Frame
+}
+
+func (r *percentileReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, out.Len(), out.Len())
+	} else {
+		r.in = r.in.Ensure(out.Len())
+	}
+	n, err := r.reader.Read(ctx, r.in)
+	vcol := r.op.Prefix()
+	for c := 0; c < vcol; c++ {
+		reflect.Copy(out.Value(c), r.in.Value(c).Slice(0, n))
+	}
+	if r.op.ps == nil {
+		for i := 0; i < n; i++ {
+			digest := slicestats.NewTDigest(slicestats.DefaultCompression)
+			digest.Add(float64Value(r.in.Index(vcol, i)))
+			out.Index(vcol, i).Set(reflect.ValueOf(digest))
+		}
+	} else {
+		for i := 0; i < n; i++ {
+			digest := r.in.Index(vcol, i).Interface().(*slicestats.TDigest)
+			for j, p := range r.op.ps {
+				out.Index(vcol+j, i).SetFloat(digest.Quantile(p / 100))
+			}
+		}
+	}
+	return n, err
+}
+
+// float64Value returns the value of the numeric v as a float64.
+func float64Value(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
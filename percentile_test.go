@@ -0,0 +1,71 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestPercentile(t *testing.T) {
+	const N = 100000
+	keys := make([]string, N)
+	values := make([]int, N)
+	for i := range keys {
+		// Key "a" has the values 0, ..., 49999; key "b" has 1000
+		// repeated.
+		if i%2 == 0 {
+			keys[i] = "a"
+			values[i] = i / 2
+		} else {
+			keys[i] = "b"
+			values[i] = 1000
+		}
+	}
+	for nshard := 1; nshard < 4; nshard++ {
+		slice := bigslice.Const(nshard, keys, values)
+		var (
+			gotKeys       []string
+			p10, p50, p99 []float64
+		)
+		slicetest.RunAndScan(t, bigslice.Percentile(slice, 10, 50, 99), &gotKeys, &p10, &p50, &p99)
+		for i, key := range gotKeys {
+			switch key {
+			case "a":
+				for j, want := range []float64{5000, 25000, 49500} {
+					if got := []float64{p10[i], p50[i], p99[i]}[j]; math.Abs(got-want) > 500 {
+						t.Errorf("a: got %v, want about %v", got, want)
+					}
+				}
+			case "b":
+				if p10[i] != 1000 || p50[i] != 1000 || p99[i] != 1000 {
+					t.Errorf("b: got %v, %v, %v, want 1000", p10[i], p50[i], p99[i])
+				}
+			default:
+				t.Errorf("unexpected key %s", key)
+			}
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	slice := bigslice.Const(2, []string{"x", "x", "x", "y"}, []float64{1, 2, 10, 4})
+	assertEqual(t, bigslice.Median(slice), true, []string{"x", "y"}, []float64{2, 4})
+}
+
+func TestPercentileError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1}, []int{2})
+	expectTypeError(t, "percentile: the slice must have exactly 1 value column; has 2", func() {
+		bigslice.Percentile(input, 50)
+	})
+	input = bigslice.Const(1, []string{"x"}, []string{"y"})
+	expectTypeError(t, "median: value type string is not numeric", func() { bigslice.Median(input) })
+	input = bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "percentile: percentile 101 is not in [0, 100]", func() { bigslice.Percentile(input, 101) })
+	expectTypeError(t, "percentile: no percentiles provided", func() { bigslice.Percentile(input) })
+}
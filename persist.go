@@ -0,0 +1,114 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"fmt"
+
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A StorageLevel determines where the output of a persisted slice is
+// stored. See Persist.
+type StorageLevel int
+
+const (
+	// PersistDisk stores the output of a persisted slice on the disks of
+	// the workers that compute it. This is how task outputs are stored
+	// by default.
+	PersistDisk StorageLevel = iota
+	// PersistMemory stores the output of a persisted slice in the
+	// memory of the workers that compute it, so that it is read without
+	// I/O.
+	PersistMemory
+	// PersistShared stores the output of a persisted slice on the
+	// workers' disks and, written through, in the session's shared
+	// object store (see exec.PersistPrefix), from which it is read
+	// instead of being recomputed by later sessions.
+	PersistShared
+)
+
+// String returns the name of the storage level.
+func (l StorageLevel) String() string {
+	switch l {
+	case PersistDisk:
+		return "disk"
+	case PersistMemory:
+		return "memory"
+	case PersistShared:
+		return "shared"
+	default:
+		return fmt.Sprintf("StorageLevel(%d)", int(l))
+	}
+}
+
+// A Persister is a Slice whose output is persisted under a key by the
+// session that computes it, so that it is computed once, and reused by
+// later invocations that persist a slice under the same key. See
+// Persist.
+type Persister interface {
+	// PersistKey returns the key under which the slice is persisted.
+	PersistKey() string
+	// StorageLevel returns where the slice's output is stored.
+	StorageLevel() StorageLevel
+}
+
+type persistSlice struct {
+	name Name
+	Slice
+	key   string
+	level StorageLevel
+}
+
+// Persist returns a slice that is identical to the provided slice, but
+// whose output is computed once, stored at the provided storage level,
+// and retained by the session under the provided key until it is
+// evicted by exec.Session.Unpersist. Persist is used for intermediate
+// results that are read by multiple downstream slices, or by multiple
+// iterations of an iterative job: within an invocation, the slice is
+// computed by tasks of its own, rather than pipelined with each of its
+// readers; and later invocations that persist a slice under the same
+// key reuse the persisted output instead of computing the slice again.
+// For example:
+//
+//	features := bigslice.Persist(computeFeatures(input), "features", bigslice.PersistMemory)
+//	for i := 0; i < iterations; i++ {
+//		model = sess.Must(ctx, train, features, model)
+//	}
+//
+// It is the caller's responsibility to persist only equivalent slices
+// under the same key, e.g., by including their parameters in the key:
+// persisted outputs are matched only by their keys, types, and numbers
+// of shards.
+func Persist(slice Slice, key string, level StorageLevel) Slice {
+	if key == "" {
+		typecheck.Panic(1, "persist: key must be nonempty")
+	}
+	if level < PersistDisk || level > PersistShared {
+		typecheck.Panicf(1, "persist: invalid storage level %d", int(level))
+	}
+	return &persistSlice{MakeName("persist"), slice, key, level}
+}
+
+func (p *persistSlice) Name() Name                 { return p.name }
+func (*persistSlice) NumDep() int                  { return 1 }
+func (p *persistSlice) Dep(i int) Dep              { return singleDep(i, p.Slice, false) }
+func (*persistSlice) Combiner() slicefunc.Func     { return slicefunc.Nil }
+func (p *persistSlice) MaxRows() int               { return maxRows(p.Slice) }
+func (p *persistSlice) PersistKey() string         { return p.key }
+func (p *persistSlice) StorageLevel() StorageLevel { return p.level }
+
+// Persisted slices are materialized, so that they are computed by
+// tasks of their own.
+func (*persistSlice) Procs() int        { return 1 }
+func (*persistSlice) Exclusive() bool   { return false }
+func (*persistSlice) Materialize() bool { return true }
+func (*persistSlice) Broadcast() bool   { return false }
+
+func (p *persistSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
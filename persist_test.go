@@ -0,0 +1,23 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestPersist(t *testing.T) {
+	slice := bigslice.Const(3, []string{"a", "b", "c", "d"}, []int{1, 2, 3, 4})
+	slice = bigslice.Persist(slice, "letters", bigslice.PersistMemory)
+	assertEqual(t, slice, true, []string{"a", "b", "c", "d"}, []int{1, 2, 3, 4})
+}
+
+func TestPersistError(t *testing.T) {
+	slice := bigslice.Const(1, []int{1})
+	expectTypeError(t, "persist: key must be nonempty", func() { bigslice.Persist(slice, "", bigslice.PersistDisk) })
+	expectTypeError(t, "persist: invalid storage level 3", func() { bigslice.Persist(slice, "key", bigslice.StorageLevel(3)) })
+}
@@ -0,0 +1,290 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// The operators in this file reshape slices by their column names:
+// columns are named by NameColumns, and by ExpandStruct, which expands
+// struct columns into a column for each field; named columns may then
+// be projected and dropped by name. Names are carried by slices'
+// types (see slicetype.NamedType), and are retained by the column
+// operators in columns.go.
+
+type nameColumnsSlice struct {
+	name Name
+	Slice
+	names []string
+}
+
+// NameColumns returns a slice that is identical to slice, but whose
+// columns have the provided names, which may then be used to project
+// and drop columns with ProjectColumns and DropColumns. A name must be
+// provided for each column; names must be unique, except that columns
+// may be left unnamed by the empty string.
+func NameColumns(slice Slice, names ...string) Slice {
+	if len(names) != slice.NumOut() {
+		typecheck.Panicf(1, "namecolumns: got %d names for slice %s with %d columns",
+			len(names), slicetype.String(slice), slice.NumOut())
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name != "" && seen[name] {
+			typecheck.Panicf(1, "namecolumns: duplicate column name %q", name)
+		}
+		seen[name] = true
+	}
+	return &nameColumnsSlice{MakeName("namecolumns"), slice, append([]string(nil), names...)}
+}
+
+func (s *nameColumnsSlice) Name() Name              { return s.name }
+func (*nameColumnsSlice) NumDep() int               { return 1 }
+func (s *nameColumnsSlice) Dep(i int) Dep           { return singleDep(i, s.Slice, false) }
+func (*nameColumnsSlice) Combiner() slicefunc.Func  { return slicefunc.Nil }
+func (s *nameColumnsSlice) ColumnName(i int) string { return s.names[i] }
+
+func (*nameColumnsSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+// DepColumns implements ColumnUser.
+func (*nameColumnsSlice) DepColumns(used []bool) []bool { return used }
+
+// ProjectColumns returns a slice that contains the columns of slice
+// with the provided names, in the order given, as SelectColumns does
+// for column indices. The returned slice has a prefix of 1.
+//
+// Schematically:
+//
+//	ProjectColumns(Slice<a t0, b t1, c t2>, "c", "a") Slice<c t2, a t0>
+func ProjectColumns(slice Slice, names ...string) Slice {
+	if len(names) == 0 {
+		typecheck.Panic(1, "projectcolumns: need at least one column")
+	}
+	var (
+		cols = make([]int, len(names))
+		out  = make([]reflect.Type, len(names))
+	)
+	for i, name := range names {
+		if cols[i] = slicetype.ColumnIndex(slice, name); cols[i] < 0 {
+			typecheck.Panicf(1, "projectcolumns: no column named %q in slice %s", name, columnNames(slice))
+		}
+		out[i] = slice.Out(cols[i])
+	}
+	return &selectColumnsSlice{
+		name:  MakeName("projectcolumns"),
+		Slice: slice,
+		cols:  cols,
+		out:   slicetype.New(out...),
+	}
+}
+
+// DropColumns returns a slice that contains the columns of slice
+// except for those with the provided names, in their original order.
+// At least one column must remain. The returned slice has a prefix of
+// 1.
+//
+// Schematically:
+//
+//	DropColumns(Slice<a t0, b t1, c t2>, "b") Slice<a t0, c t2>
+func DropColumns(slice Slice, names ...string) Slice {
+	drop := make([]bool, slice.NumOut())
+	for _, name := range names {
+		col := slicetype.ColumnIndex(slice, name)
+		if col < 0 {
+			typecheck.Panicf(1, "dropcolumns: no column named %q in slice %s", name, columnNames(slice))
+		}
+		drop[col] = true
+	}
+	var (
+		cols []int
+		out  []reflect.Type
+	)
+	for col := range drop {
+		if !drop[col] {
+			cols = append(cols, col)
+			out = append(out, slice.Out(col))
+		}
+	}
+	if len(cols) == 0 {
+		typecheck.Panic(1, "dropcolumns: cannot drop all columns")
+	}
+	return &selectColumnsSlice{
+		name:  MakeName("dropcolumns"),
+		Slice: slice,
+		cols:  cols,
+		out:   slicetype.New(out...),
+	}
+}
+
+type expandStructSlice struct {
+	name Name
+	Slice
+	col int
+	// Fields are the indices of the struct's expanded fields.
+	fields []int
+	out    slicetype.Type
+	names  []string
+}
+
+// ExpandStruct returns a slice in which column col of slice, which
+// must be of struct type, is replaced by a column for each of the
+// struct's exported fields, in order. The expanded columns are named by
+// their fields' names; other columns retain their names. If col is a
+// prefix column, the prefix is extended to include all of the expanded
+// columns.
+//
+// Schematically:
+//
+//	type T struct{ A a; B b }
+//	ExpandStruct(Slice<t1, T, t2>, 1) Slice<t1, A a, B b, t2>
+//
+// ExpandStruct is typically followed by ProjectColumns or DropColumns,
+// so that a slice's schema may be reshaped without a Map whose function
+// copies every field.
+func ExpandStruct(slice Slice, col int) Slice {
+	if col < 0 || col >= slice.NumOut() {
+		typecheck.Panicf(1, "expandstruct: column %d out of range for slice %s", col, slicetype.String(slice))
+	}
+	typ := slice.Out(col)
+	if typ.Kind() != reflect.Struct {
+		typecheck.Panicf(1, "expandstruct: column %d of type %s is not a struct", col, typ)
+	}
+	var (
+		fields []int
+		out    []reflect.Type
+		names  []string
+	)
+	for i := 0; i < col; i++ {
+		out = append(out, slice.Out(i))
+		names = append(names, slicetype.ColumnName(slice, i))
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.PkgPath == "" {
+			fields = append(fields, i)
+			out = append(out, f.Type)
+			names = append(names, f.Name)
+		}
+	}
+	if len(fields) == 0 {
+		typecheck.Panicf(1, "expandstruct: struct %s has no exported fields", typ)
+	}
+	for i := col + 1; i < slice.NumOut(); i++ {
+		out = append(out, slice.Out(i))
+		names = append(names, slicetype.ColumnName(slice, i))
+	}
+	prefix := slice.Prefix()
+	if col < prefix {
+		prefix += len(fields) - 1
+	}
+	return &expandStructSlice{
+		name:   MakeName("expandstruct"),
+		Slice:  slice,
+		col:    col,
+		fields: fields,
+		out:    schema{slicetype.New(out...), prefix},
+		names:  names,
+	}
+}
+
+func (s *expandStructSlice) Name() Name              { return s.name }
+func (s *expandStructSlice) NumOut() int             { return s.out.NumOut() }
+func (s *expandStructSlice) Out(c int) reflect.Type  { return s.out.Out(c) }
+func (s *expandStructSlice) Prefix() int             { return s.out.Prefix() }
+func (*expandStructSlice) ShardType() ShardType      { return HashShard }
+func (*expandStructSlice) NumDep() int               { return 1 }
+func (s *expandStructSlice) Dep(i int) Dep           { return singleDep(i, s.Slice, false) }
+func (*expandStructSlice) Combiner() slicefunc.Func  { return slicefunc.Nil }
+func (s *expandStructSlice) ColumnName(i int) string { return s.names[i] }
+
+type expandStructReader struct {
+	op     *expandStructSlice
+	reader sliceio.Reader
+	// in is a buffer for the struct column.
+	in reflect.Value
+}
+
+func (r *expandStructReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		n      = out.Len()
+		col    = r.op.col
+		fields = r.op.fields
+	)
+	if !r.in.IsValid() || r.in.Len() < n {
+		r.in = reflect.MakeSlice(reflect.SliceOf(r.op.Slice.Out(col)), n, n)
+	}
+	// Read all other columns directly into the output frame.
+	var (
+		outCols = out.Values()
+		cols    = make([]reflect.Value, 0, r.op.Slice.NumOut())
+	)
+	cols = append(cols, outCols[:col]...)
+	cols = append(cols, r.in.Slice(0, n))
+	cols = append(cols, outCols[col+len(fields):]...)
+	n, err := r.reader.Read(ctx, frame.Values(cols))
+	zero := reflect.Zero(r.in.Type().Elem())
+	for i := 0; i < n; i++ {
+		v := r.in.Index(i)
+		for j, field := range fields {
+			outCols[col+j].Index(i).Set(v.Field(field))
+		}
+		// Clear the buffer so that it does not retain references.
+		v.Set(zero)
+	}
+	return n, err
+}
+
+func (s *expandStructSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &expandStructReader{op: s, reader: deps[0]}
+}
+
+// DepColumns implements ColumnUser.
+func (s *expandStructSlice) DepColumns(used []bool) []bool {
+	var (
+		dep    = make([]bool, s.Slice.NumOut())
+		nfield = len(s.fields)
+	)
+	for i := range dep {
+		switch {
+		case i < s.col:
+			dep[i] = used[i]
+		case i == s.col:
+			for _, u := range used[i : i+nfield] {
+				dep[i] = dep[i] || u
+			}
+		default:
+			dep[i] = used[i+nfield-1]
+		}
+	}
+	return dep
+}
+
+// columnNames returns a description of the column names and types of
+// typ, e.g., "<a int, _ string>", in which unnamed columns are named
+// "_".
+func columnNames(typ slicetype.Type) string {
+	names := make([]string, typ.NumOut())
+	for i := range names {
+		name := slicetype.ColumnName(typ, i)
+		if name == "" {
+			name = "_"
+		}
+		names[i] = name + " " + typ.Out(i).String()
+	}
+	return "<" + strings.Join(names, ", ") + ">"
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+type person struct {
+	Name string
+	Age  int
+	City string
+	id   int
+}
+
+func TestExpandStruct(t *testing.T) {
+	people := []person{
+		{"alice", 30, "paris", 1},
+		{"bob", 40, "tokyo", 2},
+		{"carol", 50, "lima", 3},
+	}
+	slice := bigslice.Const(2, []string{"x", "y", "z"}, people, []int{1, 2, 3})
+	slice = bigslice.ExpandStruct(slice, 1)
+	if got, want := slicetype.String(slice), "slice[1]string,string,int,string,int"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i, want := range []string{"", "Name", "Age", "City", ""} {
+		if got := slicetype.ColumnName(slice, i); got != want {
+			t.Errorf("column %d: got %q, want %q", i, got, want)
+		}
+	}
+	assertEqual(t, slice, true,
+		[]string{"x", "y", "z"},
+		[]string{"alice", "bob", "carol"},
+		[]int{30, 40, 50},
+		[]string{"paris", "tokyo", "lima"},
+		[]int{1, 2, 3})
+
+	// Expanding a prefix column extends the prefix.
+	keyed := bigslice.Prefixed(bigslice.Const(1, people, []int{1, 2, 3}), 1)
+	if got, want := bigslice.ExpandStruct(keyed, 0).Prefix(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProjectColumns(t *testing.T) {
+	people := []person{{"alice", 30, "paris", 1}, {"bob", 40, "tokyo", 2}}
+	expanded := bigslice.ExpandStruct(bigslice.Const(1, people), 0)
+	projected := bigslice.ProjectColumns(expanded, "City", "Name")
+	if got, want := slicetype.ColumnName(projected, 0), "City"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, projected, true, []string{"paris", "tokyo"}, []string{"alice", "bob"})
+	dropped := bigslice.DropColumns(expanded, "Age")
+	assertEqual(t, dropped, true, []string{"alice", "bob"}, []string{"paris", "tokyo"})
+
+	named := bigslice.NameColumns(bigslice.Const(1, []string{"a", "b"}, []int{1, 2}), "key", "value")
+	named = bigslice.CastColumn(named, 1, reflect.TypeOf(int64(0)))
+	assertEqual(t, bigslice.ProjectColumns(named, "value"), false, []int64{1, 2})
+}
+
+func TestProjectColumnsError(t *testing.T) {
+	slice := bigslice.NameColumns(bigslice.Const(1, []string{"a"}, []int{1}), "key", "")
+	expectTypeError(t, `projectcolumns: no column named "value" in slice <key string, _ int>`, func() {
+		bigslice.ProjectColumns(slice, "value")
+	})
+	expectTypeError(t, "dropcolumns: cannot drop all columns", func() {
+		bigslice.DropColumns(bigslice.ProjectColumns(slice, "key"), "key")
+	})
+	expectTypeError(t, "namecolumns: got 1 names for slice slice[1]string,int with 2 columns", func() {
+		bigslice.NameColumns(slice, "x")
+	})
+	expectTypeError(t, `namecolumns: duplicate column name "x"`, func() {
+		bigslice.NameColumns(slice, "x", "x")
+	})
+	expectTypeError(t, "expandstruct: column 0 of type string is not a struct", func() {
+		bigslice.ExpandStruct(slice, 0)
+	})
+}
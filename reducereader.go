@@ -0,0 +1,272 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/sortio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var typeOfReader = reflect.TypeOf((*sliceio.Reader)(nil)).Elem()
+
+type reduceReaderSlice struct {
+	name Name
+	Slice
+	fval slicefunc.Func
+	out  slicetype.Type
+	// keys is the order in which the slice is sorted before it is
+	// grouped: its prefix, followed by any secondary sort keys.
+	keys sortio.SortKeys
+}
+
+// ReduceReader returns a slice that groups the records of the provided
+// slice by its prefix (key) columns, and hands each group to fn as a
+// stream of values. Schematically:
+//
+//	ReduceReader(Slice<k1, ..., kp, v1, ..., vn>, func(k1, ..., kp, sliceio.Reader) (r1, ..., rm)) Slice<k1, ..., kp, r1, ..., rm>
+//
+// The function fn is invoked once for each key, with a reader of the
+// key's values (columns v1, ..., vn). Values are streamed directly from
+// the merge of the sorted, shuffled input, so that groups are never
+// materialized in memory. This makes ReduceReader appropriate for
+// extremely large groups, or for workloads where per-group allocation
+// is prohibitive. The reader is valid only for the duration of the call
+// to fn; values that are not read by fn are skipped.
+//
+// Unlike Reduce, ReduceReader does not perform map-side combining: every
+// record is shuffled and sorted.
+//
+// By default, the order of values within a group is unspecified.
+// Optional sort keys, which must refer to value columns of the slice,
+// specify a secondary sort: each group's values are then read in that
+// order. The secondary sort is performed as part of the merge of the
+// shuffled input, so that fn need not buffer and sort its values.
+// For example, to read each key's values ordered by descending
+// timestamp (column 1):
+//
+//	ReduceReader(slice, fn, Desc(1))
+func ReduceReader(slice Slice, fn interface{}, valueKeys ...SortKey) Slice {
+	if slice.NumOut() == slice.Prefix() {
+		typecheck.Panicf(1, "reducereader: slice %s has no value columns", slicetype.String(slice))
+	}
+	for i := 0; i < slice.Prefix(); i++ {
+		if !frame.CanHash(slice.Out(i)) {
+			typecheck.Panicf(1, "reducereader: key column(%d) type %s cannot be hashed", i, slice.Out(i))
+		}
+		if !frame.CanCompare(slice.Out(i)) {
+			typecheck.Panicf(1, "reducereader: key column(%d) type %s cannot be sorted", i, slice.Out(i))
+		}
+	}
+	for _, k := range valueKeys {
+		if k.Column < slice.Prefix() {
+			typecheck.Panicf(1, "reducereader: sort key column %d is not a value column of slice %s", k.Column, slicetype.String(slice))
+		}
+	}
+	keys := append(sortio.PrefixKeys(slice), valueKeys...)
+	if err := keys.Check(slice); err != nil {
+		typecheck.Panicf(1, "reducereader: %v", err)
+	}
+	arg, ret, ok := typecheck.Func(fn)
+	if !ok {
+		typecheck.Panicf(1, "reducereader: invalid reducer function %T", fn)
+	}
+	keyTypes := make([]reflect.Type, slice.Prefix())
+	for i := range keyTypes {
+		keyTypes[i] = slice.Out(i)
+	}
+	if expect := slicetype.New(append(keyTypes, typeOfReader)...); !typecheck.Equal(expect, arg) {
+		typecheck.Panicf(1, "reducereader: function %T does not match expected arguments %s", fn, slicetype.String(expect))
+	}
+	if ret.NumOut() == 0 {
+		typecheck.Panicf(1, "reducereader: need at least one output column")
+	}
+	out := make([]reflect.Type, 0, len(keyTypes)+ret.NumOut())
+	out = append(out, keyTypes...)
+	for i := 0; i < ret.NumOut(); i++ {
+		out = append(out, ret.Out(i))
+	}
+	return &reduceReaderSlice{
+		name:  MakeName("reducereader"),
+		Slice: slice,
+		fval:  slicefunc.Of(fn),
+		out:   slicetype.New(out...),
+		keys:  keys,
+	}
+}
+
+func (r *reduceReaderSlice) Name() Name             { return r.name }
+func (r *reduceReaderSlice) NumOut() int            { return r.out.NumOut() }
+func (r *reduceReaderSlice) Out(c int) reflect.Type { return r.out.Out(c) }
+func (*reduceReaderSlice) ShardType() ShardType     { return HashShard }
+func (*reduceReaderSlice) NumDep() int              { return 1 }
+func (r *reduceReaderSlice) Dep(i int) Dep          { return Dep{r.Slice, true, nil, false, false} }
+func (*reduceReaderSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (r *reduceReaderSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &reduceReaderReader{op: r, reader: deps[0]}
+}
+
+type reduceReaderReader struct {
+	op     *reduceReaderSlice
+	reader sliceio.Reader
+	sorted sliceio.Reader
+	err    error
+
+	// buf buffers sorted input. Row 0 holds the key of the current
+	// group; rows [beg, end) hold buffered records.
+	buf      frame.Frame
+	beg, end int
+	eof      bool
+}
+
+// fill refills the buffer if it is empty. It reports whether there
+// are any records available.
+func (r *reduceReaderReader) fill(ctx context.Context) bool {
+	if r.err != nil {
+		return false
+	}
+	if r.beg < r.end {
+		return true
+	}
+	if r.eof {
+		return false
+	}
+	n, err := r.sorted.Read(ctx, r.buf.Slice(1, r.buf.Len()))
+	if err != nil && err != sliceio.EOF {
+		r.err = err
+		return false
+	}
+	r.beg, r.end = 1, 1+n
+	r.eof = err == sliceio.EOF
+	return n > 0
+}
+
+// inGroup reports whether the record at index i belongs to the current
+// group.
+func (r *reduceReaderReader) inGroup(i int) bool {
+	return !r.buf.Less(0, i) && !r.buf.Less(i, 0)
+}
+
+func (r *reduceReaderReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const (
+		bufferSize = 1024
+		spillSize  = 1 << 25
+	)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.sorted == nil {
+		r.sorted, r.err = sortio.SortReaderKeys(ctx, spillSize, r.op.Slice, r.op.keys, r.reader)
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.buf = frame.Make(r.op.Slice, bufferSize+1, bufferSize+1)
+	}
+	var (
+		n      int
+		max    = out.Len()
+		prefix = r.op.Slice.Prefix()
+		args   = make([]reflect.Value, prefix+1)
+	)
+	for n < max && r.fill(ctx) {
+		frame.Copy(r.buf.Slice(0, 1), r.buf.Slice(r.beg, r.beg+1))
+		for i := 0; i < prefix; i++ {
+			args[i] = r.buf.Index(i, 0)
+		}
+		group := &groupReader{r: r}
+		args[prefix] = reflect.ValueOf(group)
+		rvs := r.op.fval.Call(ctx, args)
+		// Skip over any values that were not consumed by the user.
+		for !group.done && r.fill(ctx) {
+			for r.beg < r.end && r.inGroup(r.beg) {
+				r.beg++
+			}
+			group.done = r.beg < r.end
+		}
+		if r.err != nil {
+			return n, r.err
+		}
+		for i := 0; i < prefix; i++ {
+			out.Index(i, n).Set(r.buf.Index(i, 0))
+		}
+		for i, rv := range rvs {
+			out.Index(prefix+i, n).Set(rv)
+		}
+		n++
+	}
+	if r.err != nil {
+		return n, r.err
+	}
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// groupReader is the sliceio.Reader handed to ReduceReader functions.
+// It reads the value columns of the records in the current group.
+type groupReader struct {
+	r    *reduceReaderReader
+	done bool
+}
+
+func (g *groupReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	r := g.r
+	if g.done {
+		return 0, sliceio.EOF
+	}
+	prefix := r.op.Slice.Prefix()
+	if out.NumOut() != r.buf.NumOut()-prefix {
+		return 0, errTypeError
+	}
+	for c := 0; c < out.NumOut(); c++ {
+		if out.Out(c) != r.buf.Out(prefix+c) {
+			return 0, errTypeError
+		}
+	}
+	var (
+		n   int
+		max = out.Len()
+	)
+	for n < max {
+		if !r.fill(ctx) {
+			if r.err != nil {
+				return n, r.err
+			}
+			g.done = true
+			break
+		}
+		// Find the run of records in the current group, and copy their
+		// values in bulk.
+		i := r.beg
+		for i < r.end && i-r.beg < max-n && r.inGroup(i) {
+			i++
+		}
+		k := i - r.beg
+		for c := 0; c < out.NumOut(); c++ {
+			reflect.Copy(out.Value(c).Slice(n, n+k), r.buf.Value(prefix+c).Slice(r.beg, i))
+		}
+		n += k
+		r.beg = i
+		if r.beg < r.end && !r.inGroup(r.beg) {
+			g.done = true
+			break
+		}
+	}
+	if g.done && n == 0 {
+		return 0, sliceio.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestReduceReader(t *testing.T) {
+	const N = 10000
+	ints := make([]int, N)
+	for i := range ints {
+		ints[i] = i
+	}
+	for m := 1; m < 5; m++ {
+		slice := bigslice.Const(m, ints)
+		slice = bigslice.Map(slice, func(x int) (string, int) {
+			return fmt.Sprint(x%3) + "x", x
+		})
+		slice = bigslice.ReduceReader(slice, func(ctx context.Context, key string, values sliceio.Reader) (int, int) {
+			var (
+				count, sum int
+				buf        = frame.Slices(make([]int, 7))
+			)
+			for {
+				n, err := values.Read(ctx, buf)
+				for _, v := range buf.Interface(0).([]int)[:n] {
+					sum += v
+				}
+				count += n
+				if err == sliceio.EOF {
+					break
+				}
+				if err != nil {
+					panic(err)
+				}
+			}
+			return count, sum
+		})
+		assertEqual(t, slice, true,
+			[]string{"0x", "1x", "2x"},
+			[]int{3334, 3333, 3333},
+			[]int{16668333, 16661667, 16665000})
+	}
+}
+
+func TestReduceReaderPartial(t *testing.T) {
+	slice := bigslice.Const(2,
+		[]string{"a", "b", "a", "c", "b", "a"},
+		[]int{1, 2, 3, 4, 5, 6},
+	)
+	// Only read the first value of each group; the rest are skipped.
+	slice = bigslice.ReduceReader(slice, func(key string, values sliceio.Reader) bool {
+		n, err := values.Read(context.Background(), frame.Slices(make([]int, 1)))
+		return n == 1 && (err == nil || err == sliceio.EOF)
+	})
+	assertEqual(t, slice, true,
+		[]string{"a", "b", "c"},
+		[]bool{true, true, true})
+}
+
+func TestReduceReaderSecondarySort(t *testing.T) {
+	const N = 1000
+	var (
+		keys   = make([]string, N)
+		times  = make([]int, N)
+		values = make([]int, N)
+	)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i % 3)
+		times[i] = (i * 7) % N
+		values[i] = i
+	}
+	slice := bigslice.Const(4, keys, times, values)
+	// Each group's values are read in descending order of time; return
+	// the value with the latest time, and whether all were ordered.
+	slice = bigslice.ReduceReader(slice, func(ctx context.Context, key string, values sliceio.Reader) (int, bool) {
+		var (
+			times, vals = make([]int, 5), make([]int, 5)
+			buf         = frame.Slices(times, vals)
+			latest      = -1
+			last        = N
+			ordered     = true
+		)
+		for {
+			n, err := values.Read(ctx, buf)
+			for i := 0; i < n; i++ {
+				if latest < 0 {
+					latest = vals[i]
+				}
+				ordered = ordered && times[i] < last
+				last = times[i]
+			}
+			if err == sliceio.EOF {
+				break
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+		return latest, ordered
+	}, bigslice.Desc(1))
+	// Time 999 is at i=857 (key 2), 998 at i=714 (key 0), and 997 at
+	// i=571 (key 1).
+	assertEqual(t, slice, true,
+		[]string{"0", "1", "2"},
+		[]int{714, 571, 857},
+		[]bool{true, true, true})
+}
+
+func TestReduceReaderError(t *testing.T) {
+	expectTypeError(t, "reducereader: function func(string, int) int does not match expected arguments slice[1]string,sliceio.Reader", func() {
+		bigslice.ReduceReader(bigslice.Const(1, []string{}, []int{}), func(string, int) int { return 0 })
+	})
+	expectTypeError(t, "reducereader: slice slice[1]string has no value columns", func() {
+		bigslice.ReduceReader(bigslice.Const(1, []string{}), func(string, sliceio.Reader) int { return 0 })
+	})
+	expectTypeError(t, "reducereader: sort key column 0 is not a value column of slice slice[1]string,int", func() {
+		bigslice.ReduceReader(bigslice.Const(1, []string{}, []int{}), func(string, sliceio.Reader) int { return 0 }, bigslice.Asc(0))
+	})
+}
@@ -31,7 +31,8 @@ type reshuffleSlice struct {
 // all rows with equal prefix values end up in the same shard.
 // Rows are not sorted within a shard.
 //
-// The output slice has the same type as the input.
+// The output slice has the same type as the input. See ReshuffleRange
+// to partition rows by key ranges instead.
 //
 // TODO: Add ReshuffleSort, which also sorts keys within each shard.
 func Reshuffle(slice Slice) Slice {
@@ -78,7 +79,7 @@ func Repartition(slice Slice, fn interface{}) Slice {
 
 func (r *reshuffleSlice) Name() Name             { return r.name }
 func (*reshuffleSlice) NumDep() int              { return 1 }
-func (r *reshuffleSlice) Dep(i int) Dep          { return Dep{r.Slice, true, r.partitioner, false} }
+func (r *reshuffleSlice) Dep(i int) Dep          { return Dep{r.Slice, true, r.partitioner, false, false} }
 func (*reshuffleSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
 
 func (r *reshuffleSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
@@ -87,3 +88,6 @@ func (r *reshuffleSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader
 	}
 	return deps[0]
 }
+
+// DepColumns implements ColumnUser.
+func (*reshuffleSlice) DepColumns(used []bool) []bool { return used }
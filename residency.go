@@ -0,0 +1,66 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A Resident is a Slice whose data may only be processed in a set of
+// regions, e.g., to comply with data residency requirements. An
+// invocation that reads a Resident may only be run by a session whose
+// machines are created in one of the regions permitted by every
+// Resident that it reads (and by its Func; see FuncValue.Residency).
+// See Residency.
+type Resident interface {
+	// Regions returns the regions in which the slice may be processed.
+	Regions() []string
+}
+
+type residencySlice struct {
+	name Name
+	Slice
+	regions []string
+}
+
+// Residency returns a slice that is identical to the provided slice,
+// but whose data may only be processed in the provided regions, e.g.,
+// "eu-west-1". Invocations that read the returned slice are refused,
+// by the session that is asked to run them, unless the session's
+// executor creates its machines in one of the permitted regions (e.g.,
+// as configured by an ec2system), and their tasks are refused by each
+// machine that is not in a permitted region (as reported by its
+// instance metadata). The regions in which an invocation was permitted
+// to run, and the machines on which it was run, are attested with its
+// results. Residency constraints are inherited by the results of
+// invocations, and so by the invocations that read them.
+//
+// Residency is typically applied to sources:
+//
+//	patients := bigslice.ReaderFunc(nshard, readPatients)
+//	patients = bigslice.Residency(patients, "eu-west-1", "eu-central-1")
+func Residency(slice Slice, regions ...string) Slice {
+	if len(regions) == 0 {
+		typecheck.Panic(1, "residency: no regions provided")
+	}
+	for _, region := range regions {
+		if region == "" {
+			typecheck.Panic(1, "residency: regions must be nonempty")
+		}
+	}
+	return &residencySlice{MakeName("residency"), slice, append([]string(nil), regions...)}
+}
+
+func (r *residencySlice) Name() Name             { return r.name }
+func (*residencySlice) NumDep() int              { return 1 }
+func (r *residencySlice) Dep(i int) Dep          { return singleDep(i, r.Slice, false) }
+func (*residencySlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (r *residencySlice) Regions() []string      { return r.regions }
+
+func (r *residencySlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestResidency(t *testing.T) {
+	regions := []string{"eu-west-1", "eu-central-1"}
+	slice := bigslice.Residency(bigslice.Const(2, []int{1, 2, 3}), regions...)
+	// The regions are copied.
+	regions[0] = "us-west-2"
+	resident, ok := slice.(bigslice.Resident)
+	if !ok {
+		t.Fatalf("%T is not a Resident", slice)
+	}
+	if got, want := resident.Regions(), []string{"eu-west-1", "eu-central-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := slice.NumOut(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	fn := bigslice.Func(func() bigslice.Slice { return slice })
+	if got := fn.Invocation("").Regions; got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	if got, want := fn.Residency("eu-west-1").Invocation("").Regions, []string{"eu-west-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestResidencyError(t *testing.T) {
+	slice := bigslice.Const(1, []int{1})
+	expectTypeError(t, "residency: no regions provided", func() { bigslice.Residency(slice) })
+	expectTypeError(t, "residency: regions must be nonempty", func() { bigslice.Residency(slice, "eu-west-1", "") })
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Sample returns a slice that contains a random sample of the rows of
+// the provided slice: each row is included independently, with
+// probability frac. The sample is determined by seed: the same seed
+// selects the same rows of a slice whose shards produce their rows in
+// the same order. Sample is evaluated shard by shard, without a
+// shuffle, and so the returned slice is sharded like the provided one.
+func Sample(slice Slice, frac float64, seed int64) Slice {
+	if frac < 0 || frac > 1 {
+		typecheck.Panicf(1, "sample: fraction %v is not in [0, 1]", frac)
+	}
+	return &sampleSlice{MakeName(fmt.Sprintf("sample(%v)", frac)), slice, seed, 0, frac}
+}
+
+// RandomSplit returns disjoint random samples of the provided slice,
+// one for each of the provided weights, which together contain every
+// row of the slice. Each row is included in the sample of weight w
+// with probability w divided by the sum of weights, e.g., to split a
+// slice into training and validation sets:
+//
+//	splits := RandomSplit(slice, []float64{0.8, 0.2}, seed)
+//	train, validate := splits[0], splits[1]
+//
+// As with Sample, the splits are determined by seed, and are evaluated
+// without a shuffle. Each split reads the provided slice.
+func RandomSplit(slice Slice, weights []float64, seed int64) []Slice {
+	if len(weights) == 0 {
+		typecheck.Panic(1, "randomsplit: no weights")
+	}
+	var total float64
+	for _, w := range weights {
+		if w < 0 {
+			typecheck.Panicf(1, "randomsplit: negative weight %v", w)
+		}
+		total += w
+	}
+	if total == 0 {
+		typecheck.Panic(1, "randomsplit: weights sum to zero")
+	}
+	var (
+		splits = make([]Slice, len(weights))
+		lo     float64
+	)
+	for i, w := range weights {
+		hi := lo + w/total
+		if i == len(weights)-1 {
+			// Guard against rounding, so that every row is in a split.
+			hi = 1
+		}
+		splits[i] = &sampleSlice{MakeName(fmt.Sprintf("randomsplit(%d)", i)), slice, seed, lo, hi}
+		lo = hi
+	}
+	return splits
+}
+
+// A sampleSlice contains the rows of its dependency whose random draws
+// fall in [lo, hi). Each row of a shard draws a number from a source
+// that is seeded by the seed and the shard, so that slices with the
+// same seed, but disjoint ranges, are disjoint samples.
+type sampleSlice struct {
+	name Name
+	Slice
+	seed   int64
+	lo, hi float64
+}
+
+func (s *sampleSlice) Name() Name             { return s.name }
+func (*sampleSlice) NumDep() int              { return 1 }
+func (s *sampleSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*sampleSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *sampleSlice) MaxRows() int           { return maxRows(s.Slice) }
+
+// DepColumns implements ColumnUser.
+func (*sampleSlice) DepColumns(used []bool) []bool { return used }
+
+func (s *sampleSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	seed := int64(uint64(s.seed) ^ (uint64(shard)+1)*0x9e3779b97f4a7c15)
+	return &sampleReader{op: s, reader: deps[0], rand: rand.New(rand.NewSource(seed))}
+}
+
+type sampleReader struct {
+	op     *sampleSlice
+	reader sliceio.Reader
+	rand   *rand.Rand
+	in     frame.Frame
+	err    error
+}
+
+func (r *sampleReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		m   int
+		max = out.Len()
+	)
+	for m < max && r.err == nil {
+		if r.in.IsZero() {
+			r.in = frame.Make(r.op, max-m, max-m)
+		} else {
+			r.in = r.in.Ensure(max - m)
+		}
+		var n int
+		n, r.err = r.reader.Read(ctx, r.in)
+		for i := 0; i < n; i++ {
+			if u := r.rand.Float64(); u < r.op.lo || u >= r.op.hi {
+				continue
+			}
+			frame.Copy(out.Slice(m, m+1), r.in.Slice(i, i+1))
+			m++
+		}
+	}
+	return m, r.err
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func sampleInts(t *testing.T, slice bigslice.Slice) []int {
+	t.Helper()
+	var ints []int
+	slicetest.RunAndScan(t, slice, &ints)
+	sort.Ints(ints)
+	return ints
+}
+
+func TestSample(t *testing.T) {
+	const N = 10000
+	ints := make([]int, N)
+	for i := range ints {
+		ints[i] = i
+	}
+	input := bigslice.Const(7, ints)
+	sample := sampleInts(t, bigslice.Sample(input, 0.3, 1))
+	if n := len(sample); n < 0.27*N || n > 0.33*N {
+		t.Errorf("sampled %d of %d rows", n, N)
+	}
+	// Samples are reproducible.
+	again := sampleInts(t, bigslice.Sample(input, 0.3, 1))
+	if len(again) != len(sample) {
+		t.Fatalf("got %v rows, want %v", len(again), len(sample))
+	}
+	for i := range sample {
+		if sample[i] != again[i] {
+			t.Fatalf("got %v, want %v", again[i], sample[i])
+		}
+	}
+	if other := sampleInts(t, bigslice.Sample(input, 0.3, 2)); len(other) == len(sample) {
+		equal := true
+		for i := range other {
+			equal = equal && other[i] == sample[i]
+		}
+		if equal {
+			t.Error("different seeds produced the same sample")
+		}
+	}
+	if n := len(sampleInts(t, bigslice.Sample(input, 0, 1))); n != 0 {
+		t.Errorf("got %v, want 0", n)
+	}
+	if n := len(sampleInts(t, bigslice.Sample(input, 1, 1))); n != N {
+		t.Errorf("got %v, want %v", n, N)
+	}
+}
+
+func TestRandomSplit(t *testing.T) {
+	const N = 10000
+	ints := make([]int, N)
+	for i := range ints {
+		ints[i] = i
+	}
+	input := bigslice.Const(7, ints)
+	splits := bigslice.RandomSplit(input, []float64{3, 1}, 1)
+	var (
+		train    = sampleInts(t, splits[0])
+		validate = sampleInts(t, splits[1])
+	)
+	if n := len(train); n < 0.72*N || n > 0.78*N {
+		t.Errorf("split %d of %d rows for training", n, N)
+	}
+	// The splits are disjoint, and together hold every row.
+	all := append(train, validate...)
+	sort.Ints(all)
+	if got, want := len(all), N; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range all {
+		if all[i] != i {
+			t.Fatalf("got %v, want %v", all[i], i)
+		}
+	}
+}
+
+func TestSampleError(t *testing.T) {
+	input := bigslice.Const(1, []int{1})
+	expectTypeError(t, "sample: fraction 1.5 is not in [0, 1]", func() {
+		bigslice.Sample(input, 1.5, 0)
+	})
+	expectTypeError(t, "randomsplit: negative weight -1", func() {
+		bigslice.RandomSplit(input, []float64{1, -1}, 0)
+	})
+	expectTypeError(t, "randomsplit: weights sum to zero", func() {
+		bigslice.RandomSplit(input, []float64{0}, 0)
+	})
+}
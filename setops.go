@@ -0,0 +1,218 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/sortio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Intersect returns a slice that contains each distinct row that
+// appears in every one of the provided slices, which must all have
+// the same column types. Rows are equal if all of their columns are
+// equal. The returned slice retains the prefix of the first slice.
+// Schematically:
+//
+//	Intersect(Slice<t1, ..., tn>, Slice<t1, ..., tn>, ...) Slice<t1, ..., tn>
+//
+// Like Cogroup, Intersect shuffles each slice by its rows, and merges
+// the sorted, shuffled slices, so that its memory use is independent
+// of the number of rows. All of the slices' columns must be hashable
+// and sortable.
+func Intersect(slices ...Slice) Slice {
+	if len(slices) == 0 {
+		typecheck.Panic(1, "intersect: need at least one slice")
+	}
+	return makeSetSlice("intersect", true, slices)
+}
+
+// Subtract returns a slice that contains each distinct row of the
+// first provided slice that does not appear in any of the others,
+// which must all have the same column types as the first. Rows are
+// equal if all of their columns are equal. The returned slice retains
+// the prefix of the first slice. Schematically:
+//
+//	Subtract(Slice<t1, ..., tn>, Slice<t1, ..., tn>, ...) Slice<t1, ..., tn>
+//
+// Like Cogroup, Subtract shuffles each slice by its rows, and merges
+// the sorted, shuffled slices, so that its memory use is independent
+// of the number of rows. All of the slices' columns must be hashable
+// and sortable.
+func Subtract(slice Slice, others ...Slice) Slice {
+	return makeSetSlice("subtract", false, append([]Slice{slice}, others...))
+}
+
+type setSlice struct {
+	name Name
+	Slice
+	slices    []Slice
+	intersect bool
+	numShard  int
+}
+
+// makeSetSlice returns a set operation over the provided slices, as
+// performed by Intersect (if intersect is true) or by Subtract. It
+// panics with a type error if the slices' types do not match.
+func makeSetSlice(op string, intersect bool, slices []Slice) Slice {
+	for i, slice := range slices[1:] {
+		if !typecheck.Equal(slices[0], slice) {
+			typecheck.Panicf(2, "%s: slice %d type %s does not match slice 0 type %s",
+				op, i+1, slicetype.String(slice), slicetype.String(slices[0]))
+		}
+	}
+	for i := 0; i < slices[0].NumOut(); i++ {
+		if typ := slices[0].Out(i); !frame.CanHash(typ) || !frame.CanCompare(typ) {
+			typecheck.Panicf(2, "%s: column(%d) type %s cannot be hashed and sorted", op, i, typ)
+		}
+	}
+	// Each slice is shuffled and sorted by all of its columns, so that
+	// equal rows meet in the same shard.
+	s := &setSlice{
+		name:      MakeName(op),
+		slices:    make([]Slice, len(slices)),
+		intersect: intersect,
+	}
+	for i, slice := range slices {
+		s.slices[i] = Prefixed(slice, slice.NumOut())
+		if slice.NumShard() > s.numShard {
+			s.numShard = slice.NumShard()
+		}
+	}
+	s.Slice = s.slices[0]
+	return Prefixed(s, slices[0].Prefix())
+}
+
+func (s *setSlice) Name() Name             { return s.name }
+func (s *setSlice) NumShard() int          { return s.numShard }
+func (*setSlice) ShardType() ShardType     { return HashShard }
+func (s *setSlice) NumDep() int            { return len(s.slices) }
+func (s *setSlice) Dep(i int) Dep          { return Dep{s.slices[i], true, nil, false, false} }
+func (*setSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (s *setSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &setReader{op: s, readers: deps}
+}
+
+type setReader struct {
+	op      *setSlice
+	readers []sliceio.Reader
+	err     error
+
+	// bufs buffer the sorted rows of each dependency; a buffer is nil
+	// once its dependency is exhausted.
+	bufs []*sortio.FrameBuffer
+	// row holds, in row 0, the row that is being considered for
+	// output. Row 1 is used to compare it with rows of the buffers.
+	row frame.Frame
+}
+
+func (r *setReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const (
+		bufferSize = 128
+		spillSize  = 1 << 25
+	)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.bufs == nil {
+		r.bufs = make([]*sortio.FrameBuffer, len(r.readers))
+		for i := range r.readers {
+			var sorted sliceio.Reader
+			sorted, r.err = sortio.SortReader(ctx, spillSize, r.op, r.readers[i])
+			if r.err != nil {
+				return 0, r.err
+			}
+			buf := &sortio.FrameBuffer{
+				Frame:  frame.Make(r.op, bufferSize, bufferSize),
+				Reader: sorted,
+			}
+			switch err := buf.Fill(ctx); {
+			case err == sliceio.EOF:
+				// No data. Leave the buffer nil.
+			case err != nil:
+				r.err = err
+				return 0, err
+			default:
+				r.bufs[i] = buf
+			}
+		}
+		r.row = frame.Make(r.op, 2, 2)
+	}
+	var n int
+	for n < out.Len() && r.bufs[0] != nil {
+		frame.Copy(r.row.Slice(0, 1), r.bufs[0].Slice(r.bufs[0].Index, r.bufs[0].Index+1))
+		// Skip duplicates of the row in the first slice, and rows that
+		// precede it in the others.
+		var matched int
+		for i := range r.bufs {
+			for r.bufs[i] != nil && r.compare(i) < 0 {
+				if r.err = r.advance(ctx, i); r.err != nil {
+					return n, r.err
+				}
+			}
+			if i == 0 {
+				for r.bufs[0] != nil && r.compare(0) == 0 {
+					if r.err = r.advance(ctx, 0); r.err != nil {
+						return n, r.err
+					}
+				}
+				continue
+			}
+			if r.bufs[i] != nil && r.compare(i) == 0 {
+				matched++
+			}
+		}
+		if r.op.intersect && matched == len(r.bufs)-1 || !r.op.intersect && matched == 0 {
+			frame.Copy(out.Slice(n, n+1), r.row.Slice(0, 1))
+			n++
+		}
+	}
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// compare compares the current row of buffer i with the row that is
+// being considered for output, returning -1, 0, or 1 if it is
+// respectively less than, equal to, or greater than it.
+func (r *setReader) compare(i int) int {
+	buf := r.bufs[i]
+	frame.Copy(r.row.Slice(1, 2), buf.Slice(buf.Index, buf.Index+1))
+	switch {
+	case r.row.Less(1, 0):
+		return -1
+	case r.row.Less(0, 1):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// advance advances buffer i to its next row, refilling it as needed.
+// The buffer is set to nil once it is exhausted.
+func (r *setReader) advance(ctx context.Context, i int) error {
+	buf := r.bufs[i]
+	buf.Index++
+	if buf.Index < buf.Len {
+		return nil
+	}
+	switch err := buf.Fill(ctx); {
+	case err == sliceio.EOF:
+		r.bufs[i] = nil
+	case err != nil:
+		return err
+	}
+	return nil
+}
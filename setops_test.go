@@ -0,0 +1,75 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestIntersect(t *testing.T) {
+	var (
+		a = bigslice.Const(3, []string{"a", "b", "b", "c", "d", "e"}, []int{1, 2, 2, 3, 4, 5})
+		b = bigslice.Const(2, []string{"b", "c", "c", "e", "f"}, []int{2, 3, 3, 50, 6})
+		c = bigslice.Const(1, []string{"c", "b", "x"}, []int{3, 2, 0})
+	)
+	assertEqual(t, bigslice.Intersect(a, b), true, []string{"b", "c"}, []int{2, 3})
+	assertEqual(t, bigslice.Intersect(a, b, c), true, []string{"b", "c"}, []int{2, 3})
+	assertEqual(t, bigslice.Intersect(b, c, a), true, []string{"b", "c"}, []int{2, 3})
+	assertEqual(t, bigslice.Intersect(a), true, []string{"a", "b", "c", "d", "e"}, []int{1, 2, 3, 4, 5})
+}
+
+func TestSubtract(t *testing.T) {
+	var (
+		a = bigslice.Const(3, []string{"a", "b", "b", "c", "d", "e"}, []int{1, 2, 2, 3, 4, 5})
+		b = bigslice.Const(2, []string{"b", "c", "c", "e", "f"}, []int{2, 3, 3, 50, 6})
+		c = bigslice.Const(1, []string{"d"}, []int{4})
+	)
+	assertEqual(t, bigslice.Subtract(a, b), true, []string{"a", "d", "e"}, []int{1, 4, 5})
+	assertEqual(t, bigslice.Subtract(a, b, c), true, []string{"a", "e"}, []int{1, 5})
+	assertEqual(t, bigslice.Subtract(b, a), true, []string{"e", "f"}, []int{50, 6})
+	assertEqual(t, bigslice.Subtract(c, a), true, []string{}, []int{})
+}
+
+func TestSetOpsLarge(t *testing.T) {
+	const N = 10000
+	var twos, threes, sixes, notSixes []string
+	for i := 0; i < N; i++ {
+		s := fmt.Sprint(i)
+		if i%2 == 0 {
+			twos = append(twos, s, s)
+			if i%3 == 0 {
+				sixes = append(sixes, s)
+			} else {
+				notSixes = append(notSixes, s)
+			}
+		}
+		if i%3 == 0 {
+			threes = append(threes, s)
+		}
+	}
+	for nshard := 1; nshard < 5; nshard++ {
+		var (
+			a = bigslice.Const(nshard, twos)
+			b = bigslice.Const(nshard+1, threes)
+		)
+		assertEqual(t, bigslice.Intersect(a, b), true, sixes)
+		assertEqual(t, bigslice.Subtract(a, b), true, notSixes)
+	}
+}
+
+func TestSetOpsError(t *testing.T) {
+	var (
+		a = bigslice.Const(1, []string{"x"})
+		b = bigslice.Const(1, []int{1})
+	)
+	expectTypeError(t, "intersect: need at least one slice", func() { bigslice.Intersect() })
+	expectTypeError(t, "intersect: slice 1 type slice[1]int does not match slice 0 type slice[1]string", func() { bigslice.Intersect(a, b) })
+	expectTypeError(t, "subtract: slice 1 type slice[1]int does not match slice 0 type slice[1]string", func() { bigslice.Subtract(a, b) })
+	c := bigslice.Const(1, [][]int{{1}})
+	expectTypeError(t, "subtract: column(0) type []int cannot be hashed and sorted", func() { bigslice.Subtract(c, c) })
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+
+	"github.com/grailbio/base/file"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// ShardStats are statistics about the contents of a shard of a
+// source slice. Statistics need not be exact: they are used to
+// estimate the size and cost of an evaluation before it runs (see
+// exec.Session.Estimate). Unknown values are -1.
+type ShardStats struct {
+	// Rows is the number of rows in the shard.
+	Rows int64
+	// Bytes is the size of the shard's input, e.g., of the file from
+	// which the shard is read.
+	Bytes int64
+}
+
+// A ShardStatter is a Slice that provides statistics about its shards.
+type ShardStatter interface {
+	// ShardStats returns the statistics of the provided shard.
+	ShardStats(shard int) ShardStats
+}
+
+type statsSlice struct {
+	name Name
+	Slice
+	stats []ShardStats
+}
+
+// WithShardStats returns a slice that is identical to the provided
+// slice, typically a source, but which declares the provided
+// statistics about its shards, one for each shard. For example, a
+// slice that reads a shard from each of a set of files may declare
+// their sizes (see FileShardStats), and a slice that reads a table may
+// declare its row counts.
+func WithShardStats(slice Slice, stats []ShardStats) Slice {
+	if len(stats) != slice.NumShard() {
+		typecheck.Panicf(1, "withshardstats: got %d stats for slice with %d shards", len(stats), slice.NumShard())
+	}
+	return &statsSlice{MakeName("withshardstats"), slice, append([]ShardStats(nil), stats...)}
+}
+
+func (s *statsSlice) Name() Name                      { return s.name }
+func (*statsSlice) NumDep() int                       { return 1 }
+func (s *statsSlice) Dep(i int) Dep                   { return singleDep(i, s.Slice, false) }
+func (*statsSlice) Combiner() slicefunc.Func          { return slicefunc.Nil }
+func (s *statsSlice) MaxRows() int                    { return maxRows(s.Slice) }
+func (s *statsSlice) ShardStats(shard int) ShardStats { return s.stats[shard] }
+
+func (*statsSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+// FileShardStats returns the statistics of shards that each read one
+// of the provided files, which may be URLs understood by GRAIL's file
+// library (e.g., S3 paths): their sizes are those of the files, and
+// their row counts are unknown.
+func FileShardStats(ctx context.Context, paths []string) ([]ShardStats, error) {
+	stats := make([]ShardStats, len(paths))
+	for i, path := range paths {
+		info, err := file.Stat(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		stats[i] = ShardStats{Rows: -1, Bytes: info.Size()}
+	}
+	return stats, nil
+}
+
+// ShardStats implements ShardStatter. The sizes of constant slices are
+// not reported, as they are already in memory.
+func (s *constSlice) ShardStats(shard int) ShardStats {
+	// See constSlice.Reader.
+	var (
+		n      = s.frame.Len()
+		shardn = n/s.nshard + 1
+		beg    = shardn * shard
+		end    = beg + shardn
+	)
+	if beg > n {
+		beg = n
+	}
+	if end > n {
+		end = n
+	}
+	return ShardStats{Rows: int64(end - beg), Bytes: -1}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestWithShardStats(t *testing.T) {
+	strs := []string{"w", "x", "y", "z"}
+	slice := bigslice.WithShardStats(bigslice.Const(2, strs), []bigslice.ShardStats{{Rows: 2, Bytes: 10}, {Rows: 2, Bytes: -1}})
+	if got, want := slice.(bigslice.ShardStatter).ShardStats(0), (bigslice.ShardStats{Rows: 2, Bytes: 10}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, slice, true, strs)
+
+	expectTypeError(t, "withshardstats: got 1 stats for slice with 2 shards", func() {
+		bigslice.WithShardStats(bigslice.Const(2, strs), []bigslice.ShardStats{{}})
+	})
+}
+
+func TestConstShardStats(t *testing.T) {
+	slice := bigslice.Const(3, []int{1, 2, 3, 4, 5, 6, 7})
+	var rows int64
+	for shard := 0; shard < slice.NumShard(); shard++ {
+		stats := slice.(bigslice.ShardStatter).ShardStats(shard)
+		if got, want := stats.Bytes, int64(-1); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		rows += stats.Rows
+	}
+	if got, want := rows, int64(7); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -46,6 +46,14 @@ type Dep struct {
 	// not merged) when handed to the slice implementation. This is to
 	// support merge-sorting of shards of the same partition.
 	Expand bool
+	// Broadcast indicates that every shard of the slice reads all of
+	// the rows of the dependency, rather than a single shard or
+	// partition of it. Broadcast dependencies are not shuffled, and
+	// they do not participate in pipelining: a slice with one other,
+	// non-shuffle dependency is pipelined with it. Broadcast
+	// dependencies should be small, as each of them is read in full by
+	// each of the slice's shards.
+	Broadcast bool
 }
 
 // ShardType indicates the type of sharding used by a Slice.
@@ -57,7 +65,9 @@ const (
 	// be assigned a stable shard number.
 	HashShard ShardType = iota
 	// RangeShard Slices are partitioned by the range of a key. The key
-	// is always the first column of the slice.
+	// is always the first column of the slice. Shards hold disjoint,
+	// increasing ranges of keys, and the records of each shard are
+	// sorted by key.
 	RangeShard
 )
 
@@ -117,6 +127,64 @@ type Pragma interface {
 	// Materialize indicates that the result of the slice task should be
 	// materialized, i.e. break pipelining.
 	Materialize() bool
+	// Broadcast indicates that the slice is small enough to be read in
+	// full by every shard of a slice that joins it, so that the join
+	// need not shuffle its other side. See Join.
+	Broadcast() bool
+}
+
+// A GPUPragma is a Pragma that requests GPUs for slice tasks. Pragmas
+// that do not implement GPUPragma request none.
+type GPUPragma interface {
+	Pragma
+	// GPUs returns the number of GPUs a slice task needs to run. Tasks
+	// that need GPUs are only placed on machines that advertise at least
+	// as many GPUs.
+	GPUs() int
+}
+
+// PragmaGPUs returns the number of GPUs requested by the provided
+// pragma, or 0 if it does not implement GPUPragma.
+func PragmaGPUs(p Pragma) int {
+	if g, ok := p.(GPUPragma); ok {
+		return g.GPUs()
+	}
+	return 0
+}
+
+// A ColumnUser is a Slice whose reader reads only some of the columns
+// of its (single) dependency. Unused columns need not be materialized:
+// compilation propagates column usage through pipelined slices so that
+// columns that no slice uses are not decoded when dependencies are
+// read from other machines or from storage. The values of unused
+// columns are zero in the frames that are read.
+type ColumnUser interface {
+	// DepColumns returns the columns of the slice's dependency that are
+	// read, given the slice's output columns that are used: used[i]
+	// indicates whether output column i is used.
+	DepColumns(used []bool) []bool
+}
+
+// A ShardMapper is a Slice each of whose shards reads a single shard
+// of one of its dependencies, rather than the same shard of each of
+// them. The dependencies of a ShardMapper may not be shuffle
+// dependencies, and may have different numbers of shards. The reader
+// of each shard is passed a single reader, of the dependency shard to
+// which it is mapped.
+type ShardMapper interface {
+	// DepShard returns the dependency, and the shard of that dependency,
+	// that is read by the provided shard.
+	DepShard(shard int) (dep, depShard int)
+}
+
+// A Sizer is a Slice that declares an upper bound on the number of
+// rows it contains. Compilation uses the bound to plan evaluation: for
+// example, small sides of joins are computed within the tasks that
+// read them, rather than shuffled.
+type Sizer interface {
+	// MaxRows returns an upper bound on the number of rows in the
+	// slice, or -1 if the bound is unknown.
+	MaxRows() int
 }
 
 // Pragmas composes multiple underlying Pragmas.
@@ -155,11 +223,35 @@ func (p Pragmas) Materialize() bool {
 	return false
 }
 
+// Broadcast implements Pragma.
+func (p Pragmas) Broadcast() bool {
+	for _, q := range p {
+		if q.Broadcast() {
+			return true
+		}
+	}
+	return false
+}
+
+// GPUs implements GPUPragma. If multiple tasks with GPUs pragmas are pipelined,
+// we allocate the maximum to the composed pipeline.
+func (p Pragmas) GPUs() int {
+	var need int
+	for _, q := range p {
+		n := PragmaGPUs(q)
+		if n > need {
+			need = n
+		}
+	}
+	return need
+}
+
 type exclusive struct{}
 
 func (exclusive) Procs() int        { return 1 }
 func (exclusive) Exclusive() bool   { return true }
 func (exclusive) Materialize() bool { return false }
+func (exclusive) Broadcast() bool   { return false }
 
 // Exclusive is a Pragma that indicates the slice task should be given
 // exclusive access to the machine that runs it. Exclusive takes precedence
@@ -171,6 +263,7 @@ type materialize struct{}
 func (materialize) Procs() int        { return 1 }
 func (materialize) Exclusive() bool   { return false }
 func (materialize) Materialize() bool { return true }
+func (materialize) Broadcast() bool   { return false }
 
 // ExperimentalMaterialize is a Pragma that indicates the slice task results
 // should be materialized, i.e. not pipelined. You may want to use this to
@@ -184,6 +277,19 @@ func (materialize) Materialize() bool { return true }
 // multiple slices depend.
 var ExperimentalMaterialize Pragma = materialize{}
 
+type broadcast struct{}
+
+func (broadcast) Procs() int        { return 1 }
+func (broadcast) Exclusive() bool   { return false }
+func (broadcast) Materialize() bool { return false }
+func (broadcast) Broadcast() bool   { return true }
+
+// Broadcast is a Pragma that indicates that the slice is small enough
+// to be broadcast to the shards of the slices that join it: Join reads
+// a Broadcast slice in full within each shard of its other side, which
+// is then neither shuffled nor sorted.
+var Broadcast Pragma = broadcast{}
+
 type procs struct {
 	n int
 }
@@ -191,6 +297,7 @@ type procs struct {
 func (p procs) Procs() int      { return p.n }
 func (procs) Exclusive() bool   { return false }
 func (procs) Materialize() bool { return false }
+func (procs) Broadcast() bool   { return false }
 
 // Procs returns a pragma that sets the number of procs a slice task needs to
 // run to n. It is superceded by Exclusive and clamped to the maximum number of
@@ -199,6 +306,23 @@ func Procs(n int) Pragma {
 	return procs{n: n}
 }
 
+type gpus struct {
+	n int
+}
+
+func (gpus) Procs() int        { return 1 }
+func (gpus) Exclusive() bool   { return false }
+func (gpus) Materialize() bool { return false }
+func (g gpus) GPUs() int       { return g.n }
+func (gpus) Broadcast() bool   { return false }
+
+// GPUs returns a pragma that sets the number of GPUs a slice task needs to
+// run to n. Such tasks are only scheduled on machines that advertise GPUs
+// (see exec.GPUs); a task is failed if no machine can satisfy its demand.
+func GPUs(n int) Pragma {
+	return gpus{n: n}
+}
+
 type constSlice struct {
 	name Name
 	slicetype.Type
@@ -236,6 +360,7 @@ func (*constSlice) ShardType() ShardType     { return HashShard }
 func (*constSlice) NumDep() int              { return 0 }
 func (*constSlice) Dep(i int) Dep            { panic("no deps") }
 func (*constSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *constSlice) MaxRows() int           { return s.frame.Len() }
 
 type constReader struct {
 	op    *constSlice
@@ -282,7 +407,7 @@ func (s *constSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
 
 type readerFuncSlice struct {
 	name Name
-	Pragma
+	Pragmas
 	slicetype.Type
 	nshard    int
 	read      slicefunc.Func
@@ -326,7 +451,7 @@ func ReaderFunc(nshard int, read interface{}, prags ...Pragma) Slice {
 	if s.Type, ok = typecheck.Devectorize(arg); !ok {
 		typecheck.Panicf(1, "readerfunc: function %T is not vectorized", read)
 	}
-	s.Pragma = Pragmas(prags)
+	s.Pragmas = prags
 	return s
 }
 
@@ -536,7 +661,7 @@ func (s *writerFuncSlice) Reader(shard int, reader []sliceio.Reader) sliceio.Rea
 
 type mapSlice struct {
 	name Name
-	Pragma
+	Pragmas
 	Slice
 	fval slicefunc.Func
 	out  slicetype.Type
@@ -567,7 +692,7 @@ func Map(slice Slice, fn interface{}, prags ...Pragma) Slice {
 	}
 	m.fval = slicefunc.Of(fn)
 	m.out = ret
-	m.Pragma = Pragmas(prags)
+	m.Pragmas = prags
 	return m
 }
 
@@ -578,6 +703,7 @@ func (*mapSlice) ShardType() ShardType     { return HashShard }
 func (*mapSlice) NumDep() int              { return 1 }
 func (m *mapSlice) Dep(i int) Dep          { return singleDep(i, m.Slice, false) }
 func (*mapSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (m *mapSlice) MaxRows() int           { return maxRows(m.Slice) }
 
 type mapReader struct {
 	op     *mapSlice
@@ -628,7 +754,7 @@ func (m *mapSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
 
 type filterSlice struct {
 	name Name
-	Pragma
+	Pragmas
 	Slice
 	pred slicefunc.Func
 }
@@ -647,7 +773,7 @@ func Filter(slice Slice, pred interface{}, prags ...Pragma) Slice {
 	f := new(filterSlice)
 	f.name = MakeName("filter")
 	f.Slice = slice
-	f.Pragma = Pragmas(prags)
+	f.Pragmas = prags
 	arg, ret, ok := typecheck.Func(pred)
 	if !ok {
 		typecheck.Panicf(1, "filter: invalid predicate function %T", pred)
@@ -666,6 +792,7 @@ func (f *filterSlice) Name() Name             { return f.name }
 func (*filterSlice) NumDep() int              { return 1 }
 func (f *filterSlice) Dep(i int) Dep          { return singleDep(i, f.Slice, false) }
 func (*filterSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (f *filterSlice) MaxRows() int           { return maxRows(f.Slice) }
 
 type filterReader struct {
 	op     *filterSlice
@@ -716,7 +843,7 @@ func (f *filterSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
 
 type flatmapSlice struct {
 	name Name
-	Pragma
+	Pragmas
 	Slice
 	fval slicefunc.Func
 	out  slicetype.Type
@@ -735,7 +862,7 @@ func Flatmap(slice Slice, fn interface{}, prags ...Pragma) Slice {
 	f := new(flatmapSlice)
 	f.name = MakeName("flatmap")
 	f.Slice = slice
-	f.Pragma = Pragmas(prags)
+	f.Pragmas = prags
 	arg, ret, ok := typecheck.Func(fn)
 	if !ok {
 		typecheck.Panicf(1, "flatmap: invalid flatmap function %T", fn)
@@ -871,7 +998,7 @@ func Fold(slice Slice, fold interface{}) Slice {
 	f.Slice = slice
 	// Fold requires shuffle by the first column.
 	// TODO(marius): allow deps to express shuffling by other columns.
-	f.dep = Dep{slice, true, nil, false}
+	f.dep = Dep{slice, true, nil, false, false}
 
 	arg, ret, ok := typecheck.Func(fold)
 	if !ok {
@@ -943,43 +1070,17 @@ func (f *foldSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
 	return &foldReader{op: f, reader: deps[0]}
 }
 
-type headSlice struct {
-	name Name
-	Slice
-	n int
-}
-
-// Head returns a slice that returns at most the first n items from
-// each shard of the underlying slice. Its type is the same as the
-// provided slice.
+// Head returns a slice that contains at most n rows of the provided
+// slice, which has the same type, in a single shard. Head is Limit by
+// another name: once n rows have been produced, the computation of the
+// remaining shards of the final stage is skipped, and that of the
+// shards that are still running is canceled. Which rows are returned is
+// unspecified. See Limit.
 func Head(slice Slice, n int) Slice {
-	return &headSlice{MakeName(fmt.Sprintf("head(%d)", n)), slice, n}
-}
-
-func (h *headSlice) Name() Name             { return h.name }
-func (*headSlice) NumDep() int              { return 1 }
-func (h *headSlice) Dep(i int) Dep          { return singleDep(i, h.Slice, false) }
-func (*headSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
-
-type headReader struct {
-	reader sliceio.Reader
-	n      int
-}
-
-func (h headSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
-	return &headReader{deps[0], h.n}
-}
-
-func (h *headReader) Read(ctx context.Context, out frame.Frame) (n int, err error) {
-	if h.n <= 0 {
-		return 0, sliceio.EOF
+	if n <= 0 {
+		typecheck.Panicf(1, "head: n must be positive, got %d", n)
 	}
-	n, err = h.reader.Read(ctx, out)
-	h.n -= n
-	if h.n < 0 {
-		n -= -h.n
-	}
-	return
+	return limit(MakeName(fmt.Sprintf("head(%d)", n)), slice, n)
 }
 
 type scanSlice struct {
@@ -1038,7 +1139,44 @@ func Prefixed(slice Slice, prefix int) Slice {
 	return &prefixSlice{slice, prefix}
 }
 
-func (p *prefixSlice) Prefix() int { return p.prefix }
+func (p *prefixSlice) Prefix() int  { return p.prefix }
+func (p *prefixSlice) MaxRows() int { return maxRows(p.Slice) }
+
+type sizedSlice struct {
+	name Name
+	Slice
+	maxRows int
+}
+
+// Sized returns a slice that is identical to the provided slice, but
+// which declares that it contains at most maxRows rows. Declaring the
+// size of small slices, e.g., of lookup tables read by ReaderFunc,
+// lets them be joined without a shuffle; see Sizer.
+func Sized(slice Slice, maxRows int) Slice {
+	if maxRows < 0 {
+		typecheck.Panic(1, "sized: maxRows must be nonnegative")
+	}
+	return &sizedSlice{MakeName("sized"), slice, maxRows}
+}
+
+func (s *sizedSlice) Name() Name             { return s.name }
+func (*sizedSlice) NumDep() int              { return 1 }
+func (s *sizedSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*sizedSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *sizedSlice) MaxRows() int           { return s.maxRows }
+
+func (*sizedSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+// maxRows returns the upper bound on the number of rows in the
+// provided slice, as declared by Sizer, or -1 if it is unknown.
+func maxRows(slice Slice) int {
+	if s, ok := slice.(Sizer); ok {
+		return s.MaxRows()
+	}
+	return -1
+}
 
 // Unwrap returns the underlying slice if the provided slice is used
 // only to amend the type of the slice it composes.
@@ -1066,7 +1204,7 @@ func singleDep(i int, slice Slice, shuffle bool) Dep {
 	if i != 0 {
 		panic(fmt.Sprintf("invalid dependency %d", i))
 	}
-	return Dep{slice, shuffle, nil, false}
+	return Dep{slice, shuffle, nil, false, false}
 }
 
 var (
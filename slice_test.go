@@ -613,6 +613,32 @@ func TestWriterFuncError(t *testing.T) {
 	})
 }
 
+func TestSized(t *testing.T) {
+	var slice bigslice.Slice = bigslice.Const(2, []string{"a", "b", "c"}, []int{1, 2, 3})
+	if got, want := slice.(bigslice.Sizer).MaxRows(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Sizes propagate through maps and filters.
+	slice = bigslice.Map(slice, func(s string, i int) (string, int) { return s, i * 2 })
+	if got, want := slice.(bigslice.Sizer).MaxRows(), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	slice = bigslice.Sized(slice, 10)
+	if got, want := slice.(bigslice.Sizer).MaxRows(), 10; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, slice, true, []string{"a", "b", "c"}, []int{2, 4, 6})
+
+	slice = bigslice.ReaderFunc(1, func(shard int, state *bool, out []int) (int, error) {
+		return 0, sliceio.EOF
+	})
+	slice = bigslice.Filter(slice, func(int) bool { return true })
+	if got, want := slice.(bigslice.Sizer).MaxRows(), -1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	expectTypeError(t, "sized: maxRows must be nonnegative", func() { bigslice.Sized(slice, -1) })
+}
+
 func TestMap(t *testing.T) {
 	const N = 100000
 	input := make([]int, N)
@@ -802,8 +828,27 @@ func TestFoldError(t *testing.T) {
 }
 
 func TestHead(t *testing.T) {
-	slice := bigslice.Head(bigslice.Const(2, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}), 2)
-	assertEqual(t, slice, false, []int{1, 2, 7, 8})
+	slice := bigslice.Head(bigslice.Const(1, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}), 2)
+	assertEqual(t, slice, false, []int{1, 2})
+	// Head limits the slice as a whole, rather than each of its shards.
+	slice = bigslice.Head(bigslice.Const(2, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}), 2)
+	if got, want := slice.NumShard(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	ctx := context.Background()
+	for name, s := range run(ctx, t, slice) {
+		var n, i int
+		for s.Scan(ctx, &i) {
+			n++
+		}
+		if err := s.Err(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if got, want := n, 2; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	expectTypeError(t, "head: n must be positive, got 0", func() { bigslice.Head(slice, 0) })
 }
 
 func TestScan(t *testing.T) {
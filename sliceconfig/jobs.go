@@ -0,0 +1,127 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grailbio/base/config"
+	"github.com/grailbio/base/errors"
+)
+
+// JobsDir is the directory in which the drivers created by Parse
+// register themselves, so that they may be found by their job IDs
+// (e.g., by "bigslice status").
+var JobsDir = os.ExpandEnv("$HOME/.bigslice/jobs")
+
+// A Job describes a running bigslice driver.
+type Job struct {
+	// ID is the job's ID, which is unique on its host.
+	ID string `json:"id"`
+	// Addr is the address of the driver's HTTP server, which serves
+	// its status and debug handlers.
+	Addr string `json:"addr"`
+	// PID is the process ID of the driver.
+	PID int `json:"pid"`
+	// Binary is the name of the driver's binary.
+	Binary string `json:"binary"`
+	// Start is the time at which the driver was started.
+	Start time.Time `json:"start"`
+}
+
+// registerJob registers the running process as a job in JobsDir. The
+// registration is removed by Jobs once the process has exited.
+func registerJob() (Job, error) {
+	addr := ":3333"
+	if v, ok := config.Get("http.addr"); ok {
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			addr = unquoted
+		}
+	}
+	binary := filepath.Base(os.Args[0])
+	job := Job{
+		ID:     fmt.Sprintf("%s-%d", binary, os.Getpid()),
+		Addr:   addr,
+		PID:    os.Getpid(),
+		Binary: binary,
+		Start:  time.Now(),
+	}
+	if err := os.MkdirAll(JobsDir, 0777); err != nil {
+		return job, err
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		return job, err
+	}
+	return job, ioutil.WriteFile(filepath.Join(JobsDir, job.ID+".json"), b, 0666)
+}
+
+// Jobs returns the jobs that are registered in JobsDir, ordered by
+// start time. The registrations of jobs whose processes have exited
+// are removed.
+func Jobs() ([]Job, error) {
+	infos, err := ioutil.ReadDir(JobsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(JobsDir, info.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(b, &job); err != nil {
+			return nil, errors.E(err, "job ", path)
+		}
+		if !alive(job.PID) {
+			_ = os.Remove(path)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Start.Before(jobs[j].Start) })
+	return jobs, nil
+}
+
+// LookupJob returns the running job with the provided ID. An error of
+// kind errors.NotExist is returned if there is none.
+func LookupJob(id string) (Job, error) {
+	jobs, err := Jobs()
+	if err != nil {
+		return Job{}, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return Job{}, errors.E(errors.NotExist, "job ", id)
+}
+
+// alive returns whether the process with the provided ID is running.
+func alive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
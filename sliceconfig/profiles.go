@@ -0,0 +1,77 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grailbio/base/errors"
+)
+
+// ProfilesDir is the directory from which named profiles are read. Each
+// file in the directory is a profile, named by the file's name, in the
+// same syntax as the profile at Path, e.g.:
+//
+//	$HOME/.bigslice/profiles/staging-small:
+//		param bigslice parallelism = 64
+//		param bigmachine/ec2system instance = "m5.2xlarge"
+//
+// A named profile is applied on top of the profile at Path, so that it
+// need only set the parameters in which it differs.
+var ProfilesDir = os.ExpandEnv("$HOME/.bigslice/profiles")
+
+// LocalProfile is the name of the built-in profile that evaluates
+// invocations in the current process, as with Parse's -local flag. It
+// may be overridden by a profile of the same name in ProfilesDir.
+const LocalProfile = "local"
+
+// ProfilePath returns the path of the profile with the provided name. An
+// error of kind errors.NotExist is returned if there is no such profile.
+// The built-in LocalProfile has no path.
+func ProfilePath(name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) || strings.HasPrefix(name, ".") {
+		return "", errors.E(errors.Invalid, "invalid profile name ", name)
+	}
+	path := filepath.Join(ProfilesDir, name)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.E(errors.NotExist, "profile ", name, " does not exist in ", ProfilesDir)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// Profiles returns the names of the available profiles, in sorted
+// order. They include the built-in LocalProfile.
+func Profiles() ([]string, error) {
+	names := []string{LocalProfile}
+	infos, err := ioutil.ReadDir(ProfilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") || info.Name() == LocalProfile {
+			continue
+		}
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// resolveProfile resolves the profile with the provided name, returning
+// its path, or whether it is the built-in LocalProfile.
+func resolveProfile(name string) (path string, local bool, err error) {
+	path, err = ProfilePath(name)
+	if name == LocalProfile && errors.Is(errors.NotExist, err) {
+		return "", true, nil
+	}
+	return path, false, err
+}
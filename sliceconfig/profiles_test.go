@@ -0,0 +1,73 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/base/errors"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sliceconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedDir, savedPath := ProfilesDir, Path
+	defer func() { ProfilesDir, Path = savedDir, savedPath }()
+	ProfilesDir, Path = dir, filepath.Join(dir, "nonexistent")
+
+	for name, contents := range map[string]string{
+		"small": "param bigslice parallelism = 7\n",
+		"large": "param bigslice parallelism = 4096\nparam bigslice max-load = 0.5\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names, []string{"large", "local", "small"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := ProfilePath("medium"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+	if _, err := ProfilePath("../small"); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got %v, want Invalid", err)
+	}
+	if _, err := Start(Options{Name: "medium"}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("got %v, want NotExist", err)
+	}
+
+	sess, err := Start(Options{Name: "large", Params: map[string]string{"bigslice.parallelism": "8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Shutdown()
+	// Parameters override the named profile.
+	if got, want := sess.Parallelism(), 8; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := sess.MaxLoad(), 0.5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	local, err := Start(Options{Name: LocalProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Shutdown()
+	if got, want := local.Summary().Executor, "local"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
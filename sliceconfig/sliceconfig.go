@@ -11,6 +11,7 @@
 package sliceconfig
 
 import (
+	"context"
 	"flag"
 	"net/http"
 
@@ -29,6 +30,7 @@ import (
 	_ "github.com/grailbio/bigmachine/ec2system"
 
 	"github.com/grailbio/bigslice/exec"
+	"github.com/grailbio/bigslice/slicerepl"
 
 	// Imported to provide an http server.
 	_ "github.com/grailbio/base/config/http"
@@ -40,26 +42,90 @@ var Path = os.ExpandEnv("$HOME/.bigslice/config")
 
 // Parse registers configuration flags, bigslice flags, and calls flag.Parse. It
 // reads bigslice configuration from Path defined in this package. Parse returns
-// a session as configured by the configuration and any flags provided. Parse
-// panics if session creation fails. Parse also instantiates the default http
-// server according to the configuration profile, and registers the bigslice
-// session status handlers with it. Call Shutdown() on the returned session when
-// you are done with it.
+// a session as configured by the configuration and any flags provided. The
+// -config flag (or $BIGSLICE_CONFIG) selects a named profile from
+// ProfilesDir, which is applied on top of the profile at Path; the
+// built-in profile "local" is equivalent to -local. If the
+// -explain flag is provided (or if $BIGSLICE_EXPLAIN is set, as it is by
+// "bigslice run -explain"), the returned session is a local dry-run session
+// that prints the plans of invocations to standard output in lieu of running
+// them; see exec.DryRun. Parse panics if session creation fails. Parse also
+// instantiates the default http server according to the configuration
+// profile, and registers the bigslice session status handlers with it. The
+// driver is registered as a job in JobsDir, so that its status may be found
+// by its job ID. If the -repl flag is provided (or if $BIGSLICE_REPL is set,
+// as it is by "bigslice repl"), Parse runs an interactive REPL in the
+// session over the tables registered with package slicerepl, and exits the
+// process once it is done, in lieu of returning. Call Shutdown() on the
+// returned session when you are done with it.
 func Parse() *exec.Session {
 	log.AddFlags()
 	local := flag.Bool("local", false, "run bigslice in local mode")
+	explain := flag.Bool("explain", os.Getenv("BIGSLICE_EXPLAIN") != "", "print the plans of invocations instead of running them")
+	repl := flag.Bool("repl", os.Getenv("BIGSLICE_REPL") != "", "run an interactive REPL over the tables registered with slicerepl")
+	name := flag.String("config", os.Getenv("BIGSLICE_CONFIG"), "use the named profile in "+ProfilesDir+` (e.g., "local")`)
 	config.RegisterFlags("", Path)
 	flag.Parse()
+	if *name != "" {
+		path, isLocal, err := resolveProfile(*name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if isLocal {
+			*local = true
+		} else {
+			useProfile(path)
+		}
+	}
 	must.Nil(config.ProcessFlags())
 	var sess *exec.Session
-	if *local {
+	switch {
+	case *explain:
+		sess = exec.Start(exec.Local, exec.Status(new(status.Status)), exec.DryRun(os.Stdout))
+	case *local:
 		sess = exec.Start(exec.Local, exec.Status(new(status.Status)))
-	} else {
+	default:
 		bigmachine.Init()
 		config.Must("bigslice", &sess)
 	}
 	sess.HandleDebug(http.DefaultServeMux)
 	http.Handle("/debug/status", status.Handler(sess.Status()))
 	config.Must("http", nil)
+	if job, err := registerJob(); err != nil {
+		log.Error.Printf("registering job: %v", err)
+	} else {
+		log.Printf("job %s: status at %s (see \"bigslice status %s\")", job.ID, job.Addr, job.ID)
+	}
+	if *repl {
+		var prompt bool
+		if info, err := os.Stdin.Stat(); err == nil {
+			prompt = info.Mode()&os.ModeCharDevice != 0
+		}
+		err := slicerepl.New(sess, os.Stdout).Run(context.Background(), os.Stdin, prompt)
+		sess.Shutdown()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
 	return sess
 }
+
+// useProfile arranges for the profile at the provided path to be read by
+// config.ProcessFlags after the profiles provided by -profile flags, or
+// after the profile at Path if there are none, and before any parameters
+// provided by -set flags.
+func useProfile(path string) {
+	var explicit bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "profile" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		if _, err := os.Stat(Path); err == nil {
+			must.Nil(flag.Set("profile", Path))
+		}
+	}
+	must.Nil(flag.Set("profile", path))
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceconfig
+
+import (
+	"os"
+
+	"github.com/grailbio/base/config"
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/base/status"
+	"github.com/grailbio/bigmachine"
+	"github.com/grailbio/bigslice/exec"
+)
+
+// Options configures the sessions created by Start.
+type Options struct {
+	// Local indicates that the session should evaluate invocations in
+	// the current process, as with Parse's -local flag. The profile is
+	// not read for local sessions.
+	Local bool
+	// Profile is the path of the profile from which the session is
+	// configured. If it is empty, the profile at Path is read, if it
+	// exists.
+	Profile string
+	// Name is the name of a profile in ProfilesDir that is applied on
+	// top of Profile, as with Parse's -config flag. The built-in profile
+	// LocalProfile implies Local.
+	Name string
+	// Params are assignments to profile parameters, keyed by their
+	// paths (e.g., "bigslice.parallelism"), that are applied after the
+	// profile is read, as with Parse's -set flag.
+	Params map[string]string
+	// Options are additional options with which local sessions are
+	// started.
+	Options []exec.Option
+}
+
+// Start creates a session as Parse does, but from the provided options,
+// so that bigslice may be embedded in programs that do not own their
+// command lines, such as notebook kernels and web tools. Unlike Parse,
+// Start neither reads flags, nor starts an HTTP server, nor registers
+// a job; the session's status may instead be rendered in-process with
+// (*exec.Summary).WriteHTML, or its debug handlers may be registered
+// with the program's own server with Session.HandleDebug.
+//
+// Sessions that are not local call bigmachine.Init, and so the program
+// must call Start (or bigmachine.Init) before doing any other work
+// when it runs as a bigmachine worker.
+func Start(opts Options) (*exec.Session, error) {
+	var named string
+	if opts.Name != "" {
+		path, isLocal, err := resolveProfile(opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		opts.Local = opts.Local || isLocal
+		named = path
+	}
+	if opts.Local {
+		options := append([]exec.Option{exec.Local, exec.Status(new(status.Status))}, opts.Options...)
+		return exec.Start(options...), nil
+	}
+	profile := config.New()
+	path, required := opts.Profile, true
+	if path == "" {
+		path, required = Path, false
+	}
+	if err := parseProfile(profile, path); err != nil && (required || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	if named != "" {
+		if err := parseProfile(profile, named); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range opts.Params {
+		if err := profile.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	bigmachine.Init()
+	var sess *exec.Session
+	if err := profile.Instance("bigslice", &sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// parseProfile parses the profile at the provided path into profile.
+// Errors opening the profile are returned unwrapped, so that they may be
+// inspected with os.IsNotExist.
+func parseProfile(profile *config.Profile, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := profile.Parse(f); err != nil {
+		return errors.E(err, "profile ", path)
+	}
+	return nil
+}
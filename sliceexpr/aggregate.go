@@ -0,0 +1,392 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceexpr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Aggregates are computed by an aggregation stage, which evaluates the
+// aggregate's keys and arguments for each row, as a stage does, and
+// emits the keys with a struct that holds the row's initial aggregate
+// states. The states of each key are then merged by a bigslice.Reduce,
+// which combines them before and after they are shuffled, and the
+// merged states are mapped to the aggregates' results.
+
+// An Agg is an aggregate function, which computes a value from the
+// values of an expression in a group of rows.
+type Agg struct {
+	fn   string
+	arg  Expr
+	name string
+}
+
+// Count returns an aggregate that counts the rows of each group. Its
+// result is an int64.
+func Count() Agg { return Agg{fn: "count"} }
+
+// Sum returns an aggregate that sums the values of a numeric
+// expression. The sum of integers is an int64, and that of floating
+// point numbers a float64.
+func Sum(e Expr) Agg { return Agg{fn: "sum", arg: e} }
+
+// Min returns an aggregate that computes the minimum value of a
+// numeric or string expression.
+func Min(e Expr) Agg { return Agg{fn: "min", arg: e} }
+
+// Max returns an aggregate that computes the maximum value of a
+// numeric or string expression.
+func Max(e Expr) Agg { return Agg{fn: "max", arg: e} }
+
+// Mean returns an aggregate that computes the mean value of a numeric
+// expression, as a float64.
+func Mean(e Expr) Agg { return Agg{fn: "mean", arg: e} }
+
+// As returns the aggregate a, which names the column that it computes
+// with the provided name.
+func (a Agg) As(name string) Agg {
+	a.name = name
+	return a
+}
+
+// String returns a description of the aggregate, e.g., "sum(price)".
+func (a Agg) String() string {
+	if a.fn == "count" {
+		return "count()"
+	}
+	return a.fn + "(" + a.arg.String() + ")"
+}
+
+// columnName returns the name of the column computed by the aggregate.
+func (a Agg) columnName() string {
+	if a.name != "" {
+		return a.name
+	}
+	return a.String()
+}
+
+// An aggregate is an Agg that is bound to the type of the slice that
+// it aggregates.
+type aggregate struct {
+	fn string
+	// arg is the aggregate's bound argument; it is nil for counts.
+	arg *node
+	// field is the index of the aggregate's (first) state field.
+	field int
+	// typ is the type of the aggregate's result.
+	typ reflect.Type
+}
+
+// bind binds the aggregate to the provided type. The aggregate's state
+// fields are appended to fields.
+func (a Agg) bind(typ slicetype.Type, fields []reflect.StructField) (*aggregate, []reflect.StructField, error) {
+	b := &aggregate{fn: a.fn, field: len(fields)}
+	if a.fn == "count" {
+		b.typ = typeOfInt64
+		return b, append(fields, field(len(fields), typeOfInt64)), nil
+	}
+	var err error
+	if b.arg, err = a.arg.node.bind(typ); err != nil {
+		return nil, nil, err
+	}
+	switch c := class(b.arg.typ); {
+	case a.fn == "mean" && (c == classInt || c == classFloat):
+		b.typ = typeOfFloat64
+		return b, append(fields, field(len(fields), typeOfFloat64), field(len(fields)+1, typeOfInt64)), nil
+	case c == classInt && a.fn != "mean":
+		b.typ = typeOfInt64
+	case c == classFloat && a.fn != "mean":
+		b.typ = typeOfFloat64
+	case c == classString && (a.fn == "min" || a.fn == "max"):
+		b.typ = typeOfString
+	default:
+		return nil, nil, fmt.Errorf("%s cannot be applied to %s of type %s", a.fn, a.arg, b.arg.typ)
+	}
+	return b, append(fields, field(len(fields), b.typ)), nil
+}
+
+func field(i int, typ reflect.Type) reflect.StructField {
+	return reflect.StructField{Name: fmt.Sprintf("F%d", i), Type: typ}
+}
+
+// init sets the aggregate's fields of each of the provided states to
+// their initial values for the corresponding row, whose argument
+// values are held by v.
+func (a *aggregate) init(states reflect.Value, v *vector) {
+	for i := 0; i < states.Len(); i++ {
+		f := states.Index(i).Field(a.field)
+		switch {
+		case a.fn == "count":
+			f.SetInt(1)
+		case a.fn == "mean":
+			if class(a.arg.typ) == classFloat {
+				f.SetFloat(v.floats[i])
+			} else {
+				f.SetFloat(float64(v.ints[i]))
+			}
+			states.Index(i).Field(a.field + 1).SetInt(1)
+		case a.typ == typeOfInt64:
+			f.SetInt(v.ints[i])
+		case a.typ == typeOfFloat64:
+			f.SetFloat(v.floats[i])
+		default:
+			f.SetString(v.strs[i])
+		}
+	}
+}
+
+// merge sets the aggregate's fields of state to the merge of those of
+// x and y.
+func (a *aggregate) merge(state, x, y reflect.Value) {
+	f, fx, fy := state.Field(a.field), x.Field(a.field), y.Field(a.field)
+	switch a.fn {
+	case "count":
+		f.SetInt(fx.Int() + fy.Int())
+	case "mean":
+		f.SetFloat(fx.Float() + fy.Float())
+		state.Field(a.field + 1).SetInt(x.Field(a.field+1).Int() + y.Field(a.field+1).Int())
+	case "sum":
+		if a.typ == typeOfInt64 {
+			f.SetInt(fx.Int() + fy.Int())
+		} else {
+			f.SetFloat(fx.Float() + fy.Float())
+		}
+	default:
+		var c int
+		switch a.typ {
+		case typeOfInt64:
+			c = compareInts(fx.Int(), fy.Int())
+		case typeOfFloat64:
+			c = compareFloats(fx.Float(), fy.Float())
+		default:
+			c = compareStrings(fx.String(), fy.String())
+		}
+		if (a.fn == "min") == (c <= 0) {
+			f.Set(fx)
+		} else {
+			f.Set(fy)
+		}
+	}
+}
+
+// result returns the aggregate's result from the provided state.
+func (a *aggregate) result(state reflect.Value) reflect.Value {
+	if a.fn == "mean" {
+		return reflect.ValueOf(state.Field(a.field).Float() / float64(state.Field(a.field+1).Int()))
+	}
+	return state.Field(a.field)
+}
+
+// Aggregate returns a slice that groups the rows of slice by the
+// values of the provided key expressions and computes the provided
+// aggregates over each group. The returned slice has a column for each
+// key, followed by a column for each aggregate; its prefix comprises
+// its key columns. Columns are named as they are by Select; aggregates
+// that are not named by Agg.As are named by their descriptions, e.g.,
+// "sum(price)". If no keys are provided, all of the rows of slice are
+// aggregated into a single row, or none, if slice is empty, and the
+// returned slice has a prefix of 1.
+//
+// Keys may be of any type that can be hashed and compared, as with
+// bigslice.Reduce. Nulls are not retained by Aggregate: null keys are
+// grouped with their zero values.
+//
+// Schematically:
+//
+//	Aggregate(Slice<a string, b int>, []Expr{Col("a")}, Count(), Sum(Col("b"))) Slice<a string, count() int64, sum(b) int64>
+func Aggregate(slice bigslice.Slice, keys []Expr, aggs ...Agg) bigslice.Slice {
+	bigslice.Helper()
+	if len(aggs) == 0 {
+		typecheck.Panic(1, "aggregate: need at least one aggregate")
+	}
+	var (
+		keyNodes = make([]*node, len(keys))
+		names    []string
+	)
+	for i, key := range keys {
+		var err error
+		if keyNodes[i], err = key.node.bind(slice); err != nil {
+			typecheck.Panicf(1, "aggregate: %s: %v", key, err)
+		}
+		if typ := keyNodes[i].typ; !frame.CanHash(typ) || !frame.CanCompare(typ) {
+			typecheck.Panicf(1, "aggregate: key %s of type %s cannot be hashed and compared", key, typ)
+		}
+		names = append(names, key.columnName(slice))
+	}
+	var (
+		bound  = make([]*aggregate, len(aggs))
+		fields []reflect.StructField
+	)
+	for i, agg := range aggs {
+		var err error
+		if bound[i], fields, err = agg.bind(slice, fields); err != nil {
+			typecheck.Panicf(1, "aggregate: %v", err)
+		}
+		names = append(names, agg.columnName())
+	}
+	if err := checkNames(names); err != nil {
+		typecheck.Panicf(1, "aggregate: %v", err)
+	}
+	if len(keyNodes) == 0 {
+		// Aggregate all rows under a single, constant key.
+		keyNodes = []*node{{op: "lit", lit: reflect.ValueOf(int64(0)), typ: typeOfInt64}}
+	}
+	stateType := reflect.StructOf(fields)
+	init := newAggInit(bigslice.MakeName("aggregate_init"), slice, keyNodes, bound, stateType)
+
+	merge := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{stateType, stateType}, []reflect.Type{stateType}, false),
+		func(args []reflect.Value) []reflect.Value {
+			state := reflect.New(stateType).Elem()
+			for _, agg := range bound {
+				agg.merge(state, args[0], args[1])
+			}
+			return []reflect.Value{state}
+		})
+	reduced := bigslice.Reduce(init, merge.Interface())
+
+	var in, out []reflect.Type
+	for _, key := range keyNodes {
+		in = append(in, key.typ)
+	}
+	if len(keys) > 0 {
+		out = append(out, in...)
+	}
+	in = append(in, stateType)
+	for _, agg := range bound {
+		out = append(out, agg.typ)
+	}
+	result := reflect.MakeFunc(reflect.FuncOf(in, out, false), func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, 0, len(out))
+		if len(keys) > 0 {
+			results = append(results, args[:len(keys)]...)
+		}
+		state := args[len(args)-1]
+		for _, agg := range bound {
+			results = append(results, agg.result(state))
+		}
+		return results
+	})
+	return bigslice.NameColumns(bigslice.Map(reduced, result.Interface()), names...)
+}
+
+// An aggInitSlice is the aggregation stage of an aggregate: it emits,
+// for each row of its input that satisfies its filter, the row's keys
+// and initial aggregate states. Like stages, aggregation stages are
+// fused with the stages that they read.
+type aggInitSlice struct {
+	name bigslice.Name
+	bigslice.Slice
+	filter    *node
+	keys      []*node
+	aggs      []*aggregate
+	stateType reflect.Type
+}
+
+func newAggInit(name bigslice.Name, slice bigslice.Slice, keys []*node, aggs []*aggregate, stateType reflect.Type) *aggInitSlice {
+	var filter *node
+	if s, ok := slice.(*stageSlice); ok {
+		filter = s.filter
+		fused := make([]*node, len(keys))
+		for i, key := range keys {
+			fused[i] = key.subst(s.outputs)
+		}
+		fusedAggs := make([]*aggregate, len(aggs))
+		for i, agg := range aggs {
+			fusedAgg := *agg
+			if agg.arg != nil {
+				fusedAgg.arg = agg.arg.subst(s.outputs)
+			}
+			fusedAggs[i] = &fusedAgg
+		}
+		slice, keys, aggs = s.Slice, fused, fusedAggs
+	}
+	return &aggInitSlice{name, slice, filter, keys, aggs, stateType}
+}
+
+func (a *aggInitSlice) Name() bigslice.Name { return a.name }
+func (a *aggInitSlice) NumOut() int         { return len(a.keys) + 1 }
+
+func (a *aggInitSlice) Out(i int) reflect.Type {
+	if i == len(a.keys) {
+		return a.stateType
+	}
+	return a.keys[i].typ
+}
+
+func (a *aggInitSlice) Prefix() int                 { return len(a.keys) }
+func (*aggInitSlice) ShardType() bigslice.ShardType { return bigslice.HashShard }
+func (*aggInitSlice) NumDep() int                   { return 1 }
+func (a *aggInitSlice) Dep(i int) bigslice.Dep      { return bigslice.Dep{Slice: a.Slice} }
+func (*aggInitSlice) Combiner() slicefunc.Func      { return slicefunc.Nil }
+
+func (a *aggInitSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	r := &aggInitReader{op: a, batch: newBatchReader(deps[0], a.Slice, a.filter)}
+	r.keys = make([]evaluator, len(a.keys))
+	for i, key := range a.keys {
+		if key.op != "col" && key.op != "lit" {
+			r.keys[i] = compile(key)
+		}
+	}
+	r.args = make([]evaluator, len(a.aggs))
+	for i, agg := range a.aggs {
+		if agg.arg != nil {
+			r.args[i] = compile(agg.arg)
+		}
+	}
+	return r
+}
+
+type aggInitReader struct {
+	op         *aggInitSlice
+	batch      *batchReader
+	keys, args []evaluator
+	err        error
+}
+
+func (r *aggInitReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		m   int
+		max = out.Len()
+	)
+	for m < max && r.err == nil {
+		var in frame.Frame
+		in, r.err = r.batch.read(ctx, max-m)
+		n := in.Len()
+		dst := out.Slice(m, m+n)
+		for i, key := range r.op.keys {
+			writeColumn(dst, i, in, key, r.keys[i], false)
+		}
+		states := dst.Value(len(r.op.keys))
+		zero := reflect.Zero(r.op.stateType)
+		for i := 0; i < n; i++ {
+			states.Index(i).Set(zero)
+		}
+		var empty vector
+		for i, agg := range r.op.aggs {
+			v := &empty
+			if r.args[i] != nil {
+				v = r.args[i](in)
+			}
+			agg.init(states, v)
+		}
+		m += n
+	}
+	return m, r.err
+}
@@ -0,0 +1,398 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceexpr
+
+import (
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+)
+
+// Expressions are evaluated a batch of rows at a time: each bound node
+// is compiled into an evaluator, which computes the node's values for
+// all of the rows of a frame into a vector of the node's class. The
+// vectors of column nodes share the frame's storage where possible,
+// and those of other nodes are computed into scratch buffers that are
+// owned by their evaluators, which are thus compiled for each reader.
+
+// A vector holds the values of a node for a batch of rows, in the
+// field of the node's class.
+type vector struct {
+	ints   []int64
+	floats []float64
+	strs   []string
+	bools  []bool
+}
+
+// An evaluator computes the values of a node for the rows of a frame.
+// The returned vector is valid until the next evaluation.
+type evaluator func(f frame.Frame) *vector
+
+// compile returns an evaluator of bound node n.
+func compile(n *node) evaluator {
+	switch n.op {
+	case "col":
+		return compileCol(n)
+	case "lit":
+		return compileLit(n)
+	}
+	var (
+		x    = compile(n.args[0])
+		cx   = class(n.args[0].typ)
+		out  vector
+		conv [2][]float64
+	)
+	// floats returns the values of the i'th argument, of class c, as
+	// float64s.
+	floats := func(i, c int, v *vector) []float64 {
+		if c == classFloat {
+			return v.floats
+		}
+		conv[i] = resizeFloats(conv[i], len(v.ints))
+		for j, x := range v.ints {
+			conv[i][j] = float64(x)
+		}
+		return conv[i]
+	}
+	if len(n.args) == 1 {
+		return func(f frame.Frame) *vector {
+			v := x(f)
+			switch {
+			case n.op == "not":
+				out.bools = resizeBools(out.bools, len(v.bools))
+				for i, b := range v.bools {
+					out.bools[i] = !b
+				}
+			case cx == classInt:
+				out.ints = resizeInts(out.ints, len(v.ints))
+				for i, x := range v.ints {
+					out.ints[i] = -x
+				}
+			default:
+				out.floats = resizeFloats(out.floats, len(v.floats))
+				for i, x := range v.floats {
+					out.floats[i] = -x
+				}
+			}
+			return &out
+		}
+	}
+	var (
+		y  = compile(n.args[1])
+		cy = class(n.args[1].typ)
+		op = n.op
+	)
+	switch class(n.typ) {
+	case classInt:
+		return func(f frame.Frame) *vector {
+			a, b := x(f).ints, y(f).ints
+			out.ints = resizeInts(out.ints, len(a))
+			r := out.ints
+			switch op {
+			case "+":
+				for i := range r {
+					r[i] = a[i] + b[i]
+				}
+			case "-":
+				for i := range r {
+					r[i] = a[i] - b[i]
+				}
+			case "*":
+				for i := range r {
+					r[i] = a[i] * b[i]
+				}
+			}
+			return &out
+		}
+	case classFloat:
+		return func(f frame.Frame) *vector {
+			a, b := floats(0, cx, x(f)), floats(1, cy, y(f))
+			out.floats = resizeFloats(out.floats, len(a))
+			r := out.floats
+			switch op {
+			case "+":
+				for i := range r {
+					r[i] = a[i] + b[i]
+				}
+			case "-":
+				for i := range r {
+					r[i] = a[i] - b[i]
+				}
+			case "*":
+				for i := range r {
+					r[i] = a[i] * b[i]
+				}
+			case "/":
+				for i := range r {
+					r[i] = a[i] / b[i]
+				}
+			}
+			return &out
+		}
+	case classString:
+		return func(f frame.Frame) *vector {
+			a, b := x(f).strs, y(f).strs
+			out.strs = resizeStrings(out.strs, len(a))
+			for i := range out.strs {
+				out.strs[i] = a[i] + b[i]
+			}
+			return &out
+		}
+	}
+	// The node is boolean: a comparison or a logical operator.
+	test := tester(op)
+	return func(f frame.Frame) *vector {
+		u, v := x(f), y(f)
+		var n int
+		switch {
+		case cx == classBool:
+			n = len(u.bools)
+		case cx == classString:
+			n = len(u.strs)
+		case cx == classInt:
+			n = len(u.ints)
+		default:
+			n = len(u.floats)
+		}
+		out.bools = resizeBools(out.bools, n)
+		r := out.bools
+		switch {
+		case op == "&&":
+			for i := range r {
+				r[i] = u.bools[i] && v.bools[i]
+			}
+		case op == "||":
+			for i := range r {
+				r[i] = u.bools[i] || v.bools[i]
+			}
+		case cx == classBool:
+			for i := range r {
+				r[i] = (u.bools[i] == v.bools[i]) == (op == "==")
+			}
+		case cx == classString:
+			a, b := u.strs, v.strs
+			for i := range r {
+				r[i] = test(compareStrings(a[i], b[i]))
+			}
+		case cx == classInt && cy == classInt:
+			a, b := u.ints, v.ints
+			for i := range r {
+				r[i] = test(compareInts(a[i], b[i]))
+			}
+		default:
+			a, b := floats(0, cx, u), floats(1, cy, v)
+			for i := range r {
+				r[i] = test(compareFloats(a[i], b[i]))
+			}
+		}
+		return &out
+	}
+}
+
+// compileCol compiles a column node. Columns of type int64, float64,
+// string, and bool are read directly from the frame; columns of other
+// basic kinds are converted.
+func compileCol(n *node) evaluator {
+	var (
+		col = n.col
+		out vector
+	)
+	switch n.typ.Kind() {
+	case reflect.Int64:
+		return func(f frame.Frame) *vector { out.ints = frame.Int64Col(f, col); return &out }
+	case reflect.Float64:
+		return func(f frame.Frame) *vector { out.floats = frame.Float64Col(f, col); return &out }
+	case reflect.String:
+		return func(f frame.Frame) *vector { out.strs = frame.StringCol(f, col); return &out }
+	case reflect.Float32:
+		return func(f frame.Frame) *vector {
+			vals := frame.Float32Col(f, col)
+			out.floats = resizeFloats(out.floats, len(vals))
+			for i, v := range vals {
+				out.floats[i] = float64(v)
+			}
+			return &out
+		}
+	case reflect.Int:
+		return func(f frame.Frame) *vector {
+			vals := frame.IntCol(f, col)
+			out.ints = resizeInts(out.ints, len(vals))
+			for i, v := range vals {
+				out.ints[i] = int64(v)
+			}
+			return &out
+		}
+	case reflect.Int32:
+		return func(f frame.Frame) *vector {
+			vals := frame.Int32Col(f, col)
+			out.ints = resizeInts(out.ints, len(vals))
+			for i, v := range vals {
+				out.ints[i] = int64(v)
+			}
+			return &out
+		}
+	case reflect.Bool:
+		if n.typ == typeOfBool {
+			return func(f frame.Frame) *vector { out.bools = f.Value(col).Interface().([]bool); return &out }
+		}
+	}
+	// Other integer kinds, and named boolean types, are converted
+	// reflectively.
+	return func(f frame.Frame) *vector {
+		vals := f.Value(col)
+		if n.typ.Kind() == reflect.Bool {
+			out.bools = resizeBools(out.bools, f.Len())
+			for i := range out.bools {
+				out.bools[i] = vals.Index(i).Bool()
+			}
+			return &out
+		}
+		out.ints = resizeInts(out.ints, f.Len())
+		for i := range out.ints {
+			out.ints[i] = toInt64(vals.Index(i))
+		}
+		return &out
+	}
+}
+
+// compileLit compiles a literal node, whose vectors hold the literal
+// value in every row.
+func compileLit(n *node) evaluator {
+	var out vector
+	switch class(n.typ) {
+	case classInt:
+		v := toInt64(n.lit)
+		return func(f frame.Frame) *vector { out.ints = fillInts(out.ints, f.Len(), v); return &out }
+	case classFloat:
+		v := n.lit.Float()
+		return func(f frame.Frame) *vector { out.floats = fillFloats(out.floats, f.Len(), v); return &out }
+	case classString:
+		v := n.lit.String()
+		return func(f frame.Frame) *vector { out.strs = fillStrings(out.strs, f.Len(), v); return &out }
+	default:
+		v := n.lit.Bool()
+		return func(f frame.Frame) *vector { out.bools = fillBools(out.bools, f.Len(), v); return &out }
+	}
+}
+
+func toInt64(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+// tester returns a function that tells whether the result of a
+// comparison, as returned by compareInts, satisfies the provided
+// comparison operator.
+func tester(op string) func(c int) bool {
+	switch op {
+	case "==":
+		return func(c int) bool { return c == 0 }
+	case "!=":
+		return func(c int) bool { return c != 0 }
+	case "<":
+		return func(c int) bool { return c < 0 }
+	case "<=":
+		return func(c int) bool { return c <= 0 }
+	case ">":
+		return func(c int) bool { return c > 0 }
+	}
+	return func(c int) bool { return c >= 0 }
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// The following functions return vectors of length n, reusing the
+// provided vectors' storage where possible.
+
+func resizeInts(v []int64, n int) []int64 {
+	if cap(v) < n {
+		return make([]int64, n)
+	}
+	return v[:n]
+}
+
+func resizeFloats(v []float64, n int) []float64 {
+	if cap(v) < n {
+		return make([]float64, n)
+	}
+	return v[:n]
+}
+
+func resizeStrings(v []string, n int) []string {
+	if cap(v) < n {
+		return make([]string, n)
+	}
+	return v[:n]
+}
+
+func resizeBools(v []bool, n int) []bool {
+	if cap(v) < n {
+		return make([]bool, n)
+	}
+	return v[:n]
+}
+
+func fillInts(v []int64, n int, x int64) []int64 {
+	v = resizeInts(v, n)
+	for i := range v {
+		v[i] = x
+	}
+	return v
+}
+
+func fillFloats(v []float64, n int, x float64) []float64 {
+	v = resizeFloats(v, n)
+	for i := range v {
+		v[i] = x
+	}
+	return v
+}
+
+func fillStrings(v []string, n int, x string) []string {
+	v = resizeStrings(v, n)
+	for i := range v {
+		v[i] = x
+	}
+	return v
+}
+
+func fillBools(v []bool, n int, x bool) []bool {
+	v = resizeBools(v, n)
+	for i := range v {
+		v[i] = x
+	}
+	return v
+}
@@ -0,0 +1,326 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package sliceexpr provides a column-expression API for bigslice, in
+// which slices are transformed by expressions over their columns,
+// rather than by Go functions. For example:
+//
+//	orders := bigslice.NameColumns(slice, "id", "price", "quantity")
+//	totals := sliceexpr.Select(orders,
+//		sliceexpr.Col("id"),
+//		sliceexpr.Col("price").Times(sliceexpr.Col("quantity")).As("total"))
+//	large := sliceexpr.Filter(totals, sliceexpr.Col("total").Gt(sliceexpr.Lit(100)))
+//
+// Since expressions are known to bigslice, and not opaque functions,
+// they are evaluated a column at a time, by typed loops over frames'
+// column vectors, without the reflective per-row function calls of
+// bigslice.Map and bigslice.Filter. Further, consecutive Selects,
+// Filters, and WithColumns are fused into a single stage: the
+// expressions of each operation are substituted into those of the
+// operations that follow it, so that the example above computes its
+// output in one pass, without materializing the intermediate totals.
+//
+// Columns are referred to by name (see bigslice.NameColumns) with Col,
+// or by index with Index. Expressions operate on columns of Go's basic
+// kinds: integers, which are computed as int64s; floating point
+// numbers, which are computed as float64s; strings; and booleans.
+// Columns of other types may be selected, but not otherwise used in
+// expressions. Expressions do not operate on nulls: null values are
+// treated as their (zero) values, except in columns that are selected
+// unchanged, which retain their nulls.
+package sliceexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var (
+	typeOfInt64   = reflect.TypeOf(int64(0))
+	typeOfFloat64 = reflect.TypeOf(float64(0))
+	typeOfString  = reflect.TypeOf("")
+	typeOfBool    = reflect.TypeOf(false)
+)
+
+// An Expr is an expression over the columns of a slice, which computes
+// a column of values. Exprs are constructed by Col, Index, and Lit, and
+// are combined by their methods.
+type Expr struct {
+	node *node
+	// name is the name given to the expression by As, if any.
+	name string
+}
+
+// A node is a node of an expression tree. Nodes are bound to the type
+// of the slice over which they are evaluated by bind, which resolves
+// their column references and types.
+type node struct {
+	// op is the node's operation: "col", "lit", a unary operator ("neg"
+	// or "not"), or a binary operator.
+	op string
+	// name and col identify the column referred to by "col" nodes: by
+	// name, if name is nonempty, and otherwise by index. Bound column
+	// nodes always refer to columns by index.
+	name string
+	col  int
+	// lit is the value of "lit" nodes.
+	lit  reflect.Value
+	args []*node
+	// typ is the type of the node's values; it is set in bound nodes.
+	typ reflect.Type
+}
+
+// Col returns an expression that evaluates to the column with the
+// provided name.
+func Col(name string) Expr {
+	return Expr{node: &node{op: "col", name: name}}
+}
+
+// Index returns an expression that evaluates to the column with the
+// provided index.
+func Index(col int) Expr {
+	return Expr{node: &node{op: "col", col: col}}
+}
+
+// Lit returns an expression that evaluates to the provided value,
+// which must be of a basic kind.
+func Lit(value interface{}) Expr {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || class(v.Type()) == classOther {
+		typecheck.Panicf(1, "lit: %v (%T) is not of a basic kind", value, value)
+	}
+	return Expr{node: &node{op: "lit", lit: v}}
+}
+
+func (e Expr) unary(op string) Expr {
+	return Expr{node: &node{op: op, args: []*node{e.node}}}
+}
+
+func (e Expr) binary(op string, f Expr) Expr {
+	return Expr{node: &node{op: op, args: []*node{e.node, f.node}}}
+}
+
+// Plus returns the sum of e and f, or, if they are strings, their
+// concatenation.
+func (e Expr) Plus(f Expr) Expr { return e.binary("+", f) }
+
+// Minus returns the difference of e and f.
+func (e Expr) Minus(f Expr) Expr { return e.binary("-", f) }
+
+// Times returns the product of e and f.
+func (e Expr) Times(f Expr) Expr { return e.binary("*", f) }
+
+// Div returns the quotient of e and f, which is always a float64.
+func (e Expr) Div(f Expr) Expr { return e.binary("/", f) }
+
+// Neg returns the negation of e.
+func (e Expr) Neg() Expr { return e.unary("neg") }
+
+// Eq returns whether e is equal to f.
+func (e Expr) Eq(f Expr) Expr { return e.binary("==", f) }
+
+// Ne returns whether e is not equal to f.
+func (e Expr) Ne(f Expr) Expr { return e.binary("!=", f) }
+
+// Lt returns whether e is less than f.
+func (e Expr) Lt(f Expr) Expr { return e.binary("<", f) }
+
+// Le returns whether e is less than or equal to f.
+func (e Expr) Le(f Expr) Expr { return e.binary("<=", f) }
+
+// Gt returns whether e is greater than f.
+func (e Expr) Gt(f Expr) Expr { return e.binary(">", f) }
+
+// Ge returns whether e is greater than or equal to f.
+func (e Expr) Ge(f Expr) Expr { return e.binary(">=", f) }
+
+// And returns the conjunction of boolean expressions e and f.
+func (e Expr) And(f Expr) Expr { return e.binary("&&", f) }
+
+// Or returns the disjunction of boolean expressions e and f.
+func (e Expr) Or(f Expr) Expr { return e.binary("||", f) }
+
+// Not returns the negation of boolean expression e.
+func (e Expr) Not() Expr { return e.unary("not") }
+
+// As returns the expression e, which names the column that it
+// computes with the provided name.
+func (e Expr) As(name string) Expr {
+	e.name = name
+	return e
+}
+
+// String returns a description of the expression, e.g.,
+// "(price * quantity)".
+func (e Expr) String() string {
+	return e.node.String()
+}
+
+func (n *node) String() string {
+	switch n.op {
+	case "col":
+		if n.name != "" {
+			return n.name
+		}
+		return fmt.Sprintf("$%d", n.col)
+	case "lit":
+		if n.lit.Kind() == reflect.String {
+			return fmt.Sprintf("%q", n.lit.String())
+		}
+		return fmt.Sprint(n.lit.Interface())
+	case "neg":
+		return "-" + n.args[0].String()
+	case "not":
+		return "!" + n.args[0].String()
+	}
+	args := make([]string, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.String()
+	}
+	return "(" + strings.Join(args, " "+n.op+" ") + ")"
+}
+
+// columnName returns the name of the column computed by the expression
+// over a slice of the provided type: its name as given by As, or the
+// name of the column that it selects, if any, or else "".
+func (e Expr) columnName(typ slicetype.Type) string {
+	if e.name != "" {
+		return e.name
+	}
+	if e.node.op == "col" {
+		if e.node.name != "" {
+			return e.node.name
+		}
+		if e.node.col >= 0 && e.node.col < typ.NumOut() {
+			return slicetype.ColumnName(typ, e.node.col)
+		}
+	}
+	return ""
+}
+
+// Classes of types, by which expressions are typechecked and
+// evaluated.
+const (
+	classOther = iota
+	classInt
+	classFloat
+	classString
+	classBool
+)
+
+func class(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return classInt
+	case reflect.Float32, reflect.Float64:
+		return classFloat
+	case reflect.String:
+		return classString
+	case reflect.Bool:
+		return classBool
+	}
+	return classOther
+}
+
+// bind returns a copy of the node, bound to the provided type, or an
+// error if it refers to columns that do not exist or applies operators
+// to values of the wrong types.
+func (n *node) bind(typ slicetype.Type) (*node, error) {
+	b := &node{op: n.op, col: n.col, lit: n.lit}
+	for _, arg := range n.args {
+		barg, err := arg.bind(typ)
+		if err != nil {
+			return nil, err
+		}
+		b.args = append(b.args, barg)
+	}
+	switch n.op {
+	case "col":
+		if n.name != "" {
+			if b.col = slicetype.ColumnIndex(typ, n.name); b.col < 0 {
+				return nil, fmt.Errorf("no column named %q", n.name)
+			}
+		} else if n.col < 0 || n.col >= typ.NumOut() {
+			return nil, fmt.Errorf("column %d out of range for slice %s", n.col, slicetype.String(typ))
+		}
+		b.typ = typ.Out(b.col)
+		return b, nil
+	case "lit":
+		b.typ = n.lit.Type()
+		return b, nil
+	}
+	var (
+		x  = b.args[0]
+		cx = class(x.typ)
+		cy = classOther
+	)
+	if len(b.args) > 1 {
+		cy = class(b.args[1].typ)
+	}
+	numeric := (cx == classInt || cx == classFloat) && (cy == classInt || cy == classFloat)
+	switch n.op {
+	case "neg":
+		switch cx {
+		case classInt:
+			b.typ = typeOfInt64
+		case classFloat:
+			b.typ = typeOfFloat64
+		}
+	case "not":
+		if cx == classBool {
+			b.typ = typeOfBool
+		}
+	case "+", "-", "*":
+		switch {
+		case numeric && (cx == classFloat || cy == classFloat):
+			b.typ = typeOfFloat64
+		case numeric:
+			b.typ = typeOfInt64
+		case n.op == "+" && cx == classString && cy == classString:
+			b.typ = typeOfString
+		}
+	case "/":
+		if numeric {
+			b.typ = typeOfFloat64
+		}
+	case "==", "!=", "<", "<=", ">", ">=":
+		ordered := cx == cy && (cx == classString || cx == classBool && (n.op == "==" || n.op == "!="))
+		if numeric || ordered {
+			b.typ = typeOfBool
+		}
+	case "&&", "||":
+		if cx == classBool && cy == classBool {
+			b.typ = typeOfBool
+		}
+	}
+	if b.typ == nil {
+		if len(b.args) == 1 {
+			return nil, fmt.Errorf("operator %s cannot be applied to %s of type %s", n.op, n.args[0], x.typ)
+		}
+		return nil, fmt.Errorf("operator %s cannot be applied to %s of type %s and %s of type %s",
+			n.op, n.args[0], x.typ, n.args[1], b.args[1].typ)
+	}
+	return b, nil
+}
+
+// subst returns a copy of bound node n in which references to column
+// i are replaced by cols[i]. It is used to fuse the expressions of
+// consecutive operations: n is evaluated over the outputs of an
+// operation whose output columns are computed by cols.
+func (n *node) subst(cols []*node) *node {
+	if n.op == "col" {
+		return cols[n.col]
+	}
+	s := *n
+	s.args = make([]*node, len(n.args))
+	for i, arg := range n.args {
+		s.args[i] = arg.subst(cols)
+	}
+	return &s
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceexpr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func TestString(t *testing.T) {
+	for _, test := range []struct {
+		expr Expr
+		want string
+	}{
+		{Col("a").Plus(Col("b")).Times(Lit(2)), "((a + b) * 2)"},
+		{Index(1).Neg().Le(Lit(1.5)), "(-$1 <= 1.5)"},
+		{Col("s").Eq(Lit("x")).Not().Or(Lit(true)), "(!(s == \"x\") || true)"},
+	} {
+		if got, want := test.expr.String(), test.want; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	typ := slicetype.New(reflect.TypeOf(int32(0)), reflect.TypeOf(0.0), reflect.TypeOf(uint8(0)))
+	for _, test := range []struct {
+		expr Expr
+		want reflect.Type
+	}{
+		{Index(0).Plus(Index(2)), typeOfInt64},
+		{Index(0).Minus(Index(1)), typeOfFloat64},
+		{Index(0).Div(Index(2)), typeOfFloat64},
+		{Index(2).Neg(), typeOfInt64},
+		{Index(1).Gt(Index(0)).And(Lit(true)), typeOfBool},
+		{Index(0), reflect.TypeOf(int32(0))},
+	} {
+		n, err := test.expr.node.bind(typ)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got, want := n.typ, test.want; got != want {
+			t.Errorf("%s: got %v, want %v", test.expr, got, want)
+		}
+	}
+	if _, err := Index(0).And(Lit(true)).node.bind(typ); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := Col("x").node.bind(typ); err == nil {
+		t.Error("expected error")
+	}
+}
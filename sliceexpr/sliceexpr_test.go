@@ -0,0 +1,241 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceexpr_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceexpr"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetest"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var col, lit = sliceexpr.Col, sliceexpr.Lit
+
+func orders() bigslice.Slice {
+	slice := bigslice.Const(3,
+		[]string{"a", "b", "c", "d", "e", "f"},
+		[]string{"us", "fr", "us", "de", "fr", "us"},
+		[]float64{2.5, 10, 4, 1, 3, 6},
+		[]int32{4, 1, 3, 10, 2, 1},
+	)
+	return bigslice.NameColumns(slice, "id", "country", "price", "quantity")
+}
+
+// rows runs the provided slice and returns its rows, formatted with
+// fmt.Sprint and separated by spaces, in sorted order.
+func rows(t *testing.T, slice bigslice.Slice) []string {
+	t.Helper()
+	scan := slicetest.Run(t, slice)
+	defer scan.Close()
+	var (
+		ctx  = context.Background()
+		ptrs = make([]interface{}, slice.NumOut())
+		vals = make([]string, slice.NumOut())
+		rows []string
+	)
+	for i := range ptrs {
+		ptrs[i] = reflect.New(slice.Out(i)).Interface()
+	}
+	for scan.Scan(ctx, ptrs...) {
+		for i := range ptrs {
+			vals[i] = fmt.Sprint(reflect.ValueOf(ptrs[i]).Elem().Interface())
+		}
+		rows = append(rows, strings.Join(vals, " "))
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+func names(slice bigslice.Slice) []string {
+	names := make([]string, slice.NumOut())
+	for i := range names {
+		names[i] = slicetype.ColumnName(slice, i)
+	}
+	return names
+}
+
+func TestSelect(t *testing.T) {
+	slice := sliceexpr.Select(orders(),
+		col("id"),
+		col("price").Times(col("quantity")).As("total"),
+		col("quantity").Minus(lit(1)).Neg(),
+		col("country").Plus(lit("!")).As("shout"),
+		col("price").Div(lit(2)).Ge(lit(2)).As("big"),
+		lit("x").As("x"),
+	)
+	if got, want := names(slice), []string{"id", "total", "", "shout", "big", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want := slicetype.New(reflect.TypeOf(""), reflect.TypeOf(0.0), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(""), reflect.TypeOf(false), reflect.TypeOf(""))
+	if got, want := slicetype.String(slice), slicetype.String(want); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := slice.Prefix(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{
+		"a 10 -3 us! false x",
+		"b 10 0 fr! true x",
+		"c 12 -2 us! true x",
+		"d 10 -9 de! false x",
+		"e 6 -1 fr! false x",
+		"f 6 0 us! true x",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	input := orders()
+	slice := sliceexpr.Filter(input, col("country").Eq(lit("us")).Or(col("quantity").Gt(lit(5))).And(col("id").Ne(lit("c"))))
+	if got, want := names(slice), names(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{"a us 2.5 4", "d de 1 10", "f us 6 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	slice = sliceexpr.Filter(input, col("price").Lt(lit(0)).Not().And(lit(false)))
+	if got := rows(t, slice); len(got) != 0 {
+		t.Errorf("got %q, want none", got)
+	}
+}
+
+func TestWithColumn(t *testing.T) {
+	slice := sliceexpr.WithColumn(orders(), col("price").Times(lit(2)).As("price"))
+	slice = sliceexpr.WithColumn(slice, col("price").Plus(col("quantity")).As("sum"))
+	if got, want := names(slice), []string{"id", "country", "price", "quantity", "sum"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{
+		"a us 5 4 9",
+		"b fr 20 1 21",
+		"c us 8 3 11",
+		"d de 2 10 12",
+		"e fr 6 2 8",
+		"f us 12 1 13",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFusion(t *testing.T) {
+	input := orders()
+	slice := sliceexpr.Select(input, col("id"), col("price").Times(col("quantity")).As("total"))
+	slice = sliceexpr.Filter(slice, col("total").Gt(lit(9)))
+	slice = sliceexpr.WithColumn(slice, col("total").Minus(lit(10)).As("excess"))
+	slice = sliceexpr.Filter(slice, col("id").Ne(lit("d")))
+	if got, want := slice.NumDep(), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if slice.Dep(0).Slice != input {
+		t.Errorf("stages were not fused: slice depends on %s", slice.Dep(0).Name())
+	}
+	if got, want := rows(t, slice), []string{"a 10 0", "b 10 0", "c 12 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	input := sliceexpr.WithColumn(orders(), col("price").Times(col("quantity")).As("total"))
+	slice := sliceexpr.Aggregate(input, []sliceexpr.Expr{col("country")},
+		sliceexpr.Count().As("n"),
+		sliceexpr.Sum(col("quantity")),
+		sliceexpr.Sum(col("total")).As("total"),
+		sliceexpr.Min(col("id")),
+		sliceexpr.Max(col("price")),
+		sliceexpr.Mean(col("quantity")).As("mean"),
+	)
+	if got, want := names(slice), []string{"country", "n", "sum(quantity)", "total", "min(id)", "max(price)", "mean"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := slice.Prefix(), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{
+		"de 1 10 10 d 1 10",
+		"fr 2 3 16 b 10 1.5",
+		"us 3 8 28 a 6 2.6666666666666665",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	slice = sliceexpr.Aggregate(sliceexpr.Filter(input, col("country").Ne(lit("de"))), nil,
+		sliceexpr.Count(), sliceexpr.Max(col("total")))
+	if got, want := rows(t, slice), []string{"5 12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNulls(t *testing.T) {
+	nulls := func(ctx context.Context, shard, numShard int, in *sliceio.Scanner, out sliceio.Writer) error {
+		f := frame.Slices([]string{"a", "b"}, []int{1, 0})
+		f.SetNull(1, 1, true)
+		return out.Write(ctx, f)
+	}
+	typ := bigslice.Schema(1, reflect.TypeOf(""), reflect.TypeOf(0))
+	input := bigslice.MapShard(bigslice.Const(1, []int{1}), slicetype.WithNullable(typ, 1), nulls)
+	// Selected columns retain their nulls; computed columns are never
+	// null.
+	slice := sliceexpr.Select(input, sliceexpr.Index(1), sliceexpr.Index(1).Plus(lit(1)), sliceexpr.Index(0))
+	if got, want := slicetype.String(slice), "slice[1]int?,int64,string"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{"0 1 b", "1 2 a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	slice = sliceexpr.Filter(input, sliceexpr.Index(0).Ne(lit("x")))
+	if got, want := slicetype.String(slice), "slice[1]string,int?"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := rows(t, slice), []string{"a 1", "b 0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTypeError(t *testing.T) {
+	for _, test := range []struct {
+		fn  func()
+		err string
+	}{
+		{func() { sliceexpr.Select(orders(), col("nope")) }, `select: nope: no column named "nope"`},
+		{func() { sliceexpr.Select(orders(), sliceexpr.Index(4)) }, "select: $4: column 4 out of range"},
+		{func() { sliceexpr.Select(orders(), col("id"), col("price").As("id")) }, `select: duplicate column name "id"`},
+		{func() { sliceexpr.Select(orders(), col("id").Minus(lit(1))) }, "select: (id - 1): operator - cannot be applied to id of type string and 1 of type int"},
+		{func() { sliceexpr.Filter(orders(), col("price")) }, "filter: predicate price is not boolean"},
+		{func() { sliceexpr.WithColumn(orders(), lit(1)) }, "withcolumn: expression 1 is not named"},
+		{func() { sliceexpr.Aggregate(orders(), nil, sliceexpr.Sum(col("id"))) }, "aggregate: sum cannot be applied to id of type string"},
+		{func() { sliceexpr.Aggregate(orders(), nil) }, "aggregate: need at least one aggregate"},
+		{func() { sliceexpr.Lit([]int{1}) }, "lit: [1] ([]int) is not of a basic kind"},
+	} {
+		func() {
+			defer func() {
+				e := recover()
+				err, ok := e.(*typecheck.Error)
+				if !ok {
+					t.Errorf("expected type error %q, got %v", test.err, e)
+					return
+				}
+				if got, want := err.Err.Error(), test.err; !strings.Contains(got, want) {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			}()
+			test.fn()
+		}()
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceexpr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var errTypeError = errors.New("type error")
+
+// A stageSlice filters the rows of its input by a predicate and
+// computes its output columns from each remaining row by expressions.
+// Select, Filter, and WithColumn all produce stageSlices; when they are
+// applied to a stageSlice, they are fused with it, so that the
+// returned stageSlice reads the original stage's input directly.
+type stageSlice struct {
+	name bigslice.Name
+	bigslice.Slice
+	// filter is the stage's predicate, bound to its input's type, or
+	// nil if the stage does not filter rows.
+	filter *node
+	// outputs are the expressions that compute the stage's columns,
+	// bound to its input's type.
+	outputs []*node
+	names   []string
+	prefix  int
+}
+
+// newStage returns a stage with the provided name that filters the
+// rows of slice by filter and computes outputs from them. Both are
+// bound to the type of slice; if slice is itself a stage, the returned
+// stage is fused with it.
+func newStage(name bigslice.Name, slice bigslice.Slice, filter *node, outputs []*node, names []string, prefix int) *stageSlice {
+	if s, ok := slice.(*stageSlice); ok {
+		if filter != nil {
+			filter = filter.subst(s.outputs)
+			if s.filter != nil {
+				filter = &node{op: "&&", args: []*node{s.filter, filter}, typ: typeOfBool}
+			}
+		} else {
+			filter = s.filter
+		}
+		fused := make([]*node, len(outputs))
+		for i, out := range outputs {
+			fused[i] = out.subst(s.outputs)
+		}
+		slice, outputs = s.Slice, fused
+	}
+	return &stageSlice{name, slice, filter, outputs, names, prefix}
+}
+
+// Select returns a slice with a column for each of the provided
+// expressions, computed from each row of slice. Columns are named by
+// the names given to the expressions by Expr.As or, for expressions
+// that select a column, by the column's name. The returned slice has a
+// prefix of 1.
+//
+// Schematically:
+//
+//	Select(Slice<a t0, b t1>, Col("b"), Col("a").Plus(Lit(1)).As("c")) Slice<b t1, c int64>
+func Select(slice bigslice.Slice, exprs ...Expr) bigslice.Slice {
+	bigslice.Helper()
+	if len(exprs) == 0 {
+		typecheck.Panic(1, "select: need at least one expression")
+	}
+	var (
+		outputs = make([]*node, len(exprs))
+		names   = make([]string, len(exprs))
+	)
+	for i, e := range exprs {
+		var err error
+		if outputs[i], err = e.node.bind(slice); err != nil {
+			typecheck.Panicf(1, "select: %s: %v", e, err)
+		}
+		names[i] = e.columnName(slice)
+	}
+	if err := checkNames(names); err != nil {
+		typecheck.Panicf(1, "select: %v", err)
+	}
+	return newStage(bigslice.MakeName("select"), slice, nil, outputs, names, 1)
+}
+
+// Filter returns a slice that contains the rows of slice for which the
+// provided boolean expression is true. The returned slice has the same
+// type, column names, and prefix as slice.
+func Filter(slice bigslice.Slice, pred Expr) bigslice.Slice {
+	bigslice.Helper()
+	filter, err := pred.node.bind(slice)
+	if err != nil {
+		typecheck.Panicf(1, "filter: %s: %v", pred, err)
+	}
+	if filter.typ.Kind() != reflect.Bool {
+		typecheck.Panicf(1, "filter: predicate %s is not boolean", pred)
+	}
+	outputs, names := identity(slice)
+	return newStage(bigslice.MakeName("filter"), slice, filter, outputs, names, slice.Prefix())
+}
+
+// WithColumn returns a slice that contains the columns of slice and a
+// column computed by the provided expression, which must be named by
+// Expr.As. If slice has a column of the same name, the column is
+// replaced by the computed column; otherwise the computed column is
+// appended to the slice's columns. The returned slice has the same
+// prefix as slice.
+func WithColumn(slice bigslice.Slice, expr Expr) bigslice.Slice {
+	bigslice.Helper()
+	name := expr.columnName(slice)
+	if name == "" {
+		typecheck.Panicf(1, "withcolumn: expression %s is not named", expr)
+	}
+	output, err := expr.node.bind(slice)
+	if err != nil {
+		typecheck.Panicf(1, "withcolumn: %s: %v", expr, err)
+	}
+	outputs, names := identity(slice)
+	if col := slicetype.ColumnIndex(slice, name); col >= 0 {
+		outputs[col] = output
+	} else {
+		outputs, names = append(outputs, output), append(names, name)
+	}
+	return newStage(bigslice.MakeName("withcolumn"), slice, nil, outputs, names, slice.Prefix())
+}
+
+// identity returns bound expressions that select each of the columns
+// of the provided type, and the columns' names.
+func identity(typ slicetype.Type) ([]*node, []string) {
+	var (
+		outputs = make([]*node, typ.NumOut())
+		names   = make([]string, typ.NumOut())
+	)
+	for i := range outputs {
+		outputs[i] = &node{op: "col", col: i, typ: typ.Out(i)}
+		names[i] = slicetype.ColumnName(typ, i)
+	}
+	return outputs, names
+}
+
+// checkNames returns an error if the provided column names are not
+// unique. Empty names, of unnamed columns, may be repeated.
+func checkNames(names []string) error {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name != "" && seen[name] {
+			return fmt.Errorf("duplicate column name %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (s *stageSlice) Name() bigslice.Name         { return s.name }
+func (s *stageSlice) NumOut() int                 { return len(s.outputs) }
+func (s *stageSlice) Out(i int) reflect.Type      { return s.outputs[i].typ }
+func (s *stageSlice) Prefix() int                 { return s.prefix }
+func (*stageSlice) ShardType() bigslice.ShardType { return bigslice.HashShard }
+func (*stageSlice) NumDep() int                   { return 1 }
+func (s *stageSlice) Dep(i int) bigslice.Dep      { return bigslice.Dep{Slice: s.Slice} }
+func (*stageSlice) Combiner() slicefunc.Func      { return slicefunc.Nil }
+func (s *stageSlice) ColumnName(i int) string     { return s.names[i] }
+
+// Nullable implements slicetype.NullableType. Columns that are selected
+// unchanged from nullable columns of the stage's input are nullable.
+func (s *stageSlice) Nullable(i int) bool {
+	return s.outputs[i].op == "col" && slicetype.Nullable(s.Slice, s.outputs[i].col)
+}
+
+// MaxRows implements bigslice.Sizer: a stage has no more rows than its
+// input.
+func (s *stageSlice) MaxRows() int {
+	if sizer, ok := s.Slice.(bigslice.Sizer); ok {
+		return sizer.MaxRows()
+	}
+	return -1
+}
+
+func (s *stageSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	r := &stageReader{op: s, batch: newBatchReader(deps[0], s.Slice, s.filter)}
+	r.outputs = make([]evaluator, len(s.outputs))
+	for i, out := range s.outputs {
+		if out.op != "col" && out.op != "lit" {
+			r.outputs[i] = compile(out)
+		}
+	}
+	return r
+}
+
+type stageReader struct {
+	op    *stageSlice
+	batch *batchReader
+	// outputs holds the evaluators of the stage's computed columns;
+	// columns that are selected or literal are copied and filled.
+	outputs []evaluator
+	err     error
+}
+
+func (r *stageReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		m   int
+		max = out.Len()
+	)
+	for m < max && r.err == nil {
+		var in frame.Frame
+		in, r.err = r.batch.read(ctx, max-m)
+		n := in.Len()
+		dst := out.Slice(m, m+n)
+		for i, output := range r.op.outputs {
+			writeColumn(dst, i, in, output, r.outputs[i], r.op.Nullable(i))
+		}
+		m += n
+	}
+	return m, r.err
+}
+
+// A batchReader reads batches of input rows that satisfy a predicate.
+type batchReader struct {
+	reader sliceio.Reader
+	typ    slicetype.Type
+	// pred evaluates the predicate, or is nil if all rows are read.
+	pred evaluator
+	buf  frame.Frame
+}
+
+func newBatchReader(reader sliceio.Reader, typ slicetype.Type, filter *node) *batchReader {
+	b := &batchReader{reader: reader, typ: typ}
+	if filter != nil {
+		b.pred = compile(filter)
+	}
+	return b
+}
+
+// read reads at most n rows and returns those that satisfy the
+// predicate. The returned frame is valid until the next call to read.
+func (b *batchReader) read(ctx context.Context, n int) (frame.Frame, error) {
+	if b.buf.IsZero() {
+		b.buf = frame.Make(b.typ, n, n)
+	} else {
+		b.buf = b.buf.Ensure(n)
+	}
+	n, err := b.reader.Read(ctx, b.buf)
+	in := b.buf.Slice(0, n)
+	if b.pred == nil || n == 0 {
+		return in, err
+	}
+	// Compact the rows that satisfy the predicate in place. Rows are
+	// only copied backwards, so rows are not overwritten before they
+	// are tested, even if the predicate's vector is a column of in.
+	var m int
+	for i, ok := range b.pred(in).bools {
+		if !ok {
+			continue
+		}
+		if i != m {
+			frame.Copy(in.Slice(m, m+1), in.Slice(i, i+1))
+		}
+		m++
+	}
+	return in.Slice(0, m), err
+}
+
+// writeColumn writes the values of the provided bound expression,
+// computed from the rows of in, into column col of dst, which has the
+// same number of rows. The expression's evaluator is used if it is
+// computed. If nullable is true, the nulls of selected columns are
+// retained.
+func writeColumn(dst frame.Frame, col int, in frame.Frame, n *node, eval evaluator, nullable bool) {
+	switch n.op {
+	case "col":
+		reflect.Copy(dst.Value(col), in.Value(n.col))
+		if nullable && in.Nullable(n.col) {
+			for i := 0; i < dst.Len(); i++ {
+				dst.SetNull(col, i, in.IsNull(n.col, i))
+			}
+			return
+		}
+	case "lit":
+		vals := dst.Value(col)
+		for i := 0; i < dst.Len(); i++ {
+			vals.Index(i).Set(n.lit)
+		}
+	default:
+		v := eval(in)
+		switch n.typ {
+		case typeOfInt64:
+			copy(frame.Int64Col(dst, col), v.ints)
+		case typeOfFloat64:
+			copy(frame.Float64Col(dst, col), v.floats)
+		case typeOfString:
+			copy(frame.StringCol(dst, col), v.strs)
+		default:
+			copy(dst.Value(col).Interface().([]bool), v.bools)
+		}
+	}
+	// Other columns are never null.
+	if dst.Nullable(col) {
+		for i := 0; i < dst.Len(); i++ {
+			dst.SetNull(col, i, false)
+		}
+	}
+}
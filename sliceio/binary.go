@@ -0,0 +1,298 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sliceio
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/frame"
+)
+
+// Column encodings. Each encoded column is preceded by its encoding.
+const (
+	// encodingGob encodes columns with gob. It is the fallback for
+	// columns of types that have neither a codec nor a binary encoding,
+	// e.g., interfaces and user-defined structs.
+	encodingGob uint8 = iota
+	// encodingCodec encodes columns with the codec that is registered
+	// for their type; see frame.Ops.
+	encodingCodec
+	// encodingBinary encodes columns of basic kinds with the binary
+	// format implemented in this file.
+	encodingBinary
+)
+
+// streamHeader begins streams whose columns are preceded by their
+// nulls, if any, and by their encodings. Streams written before nullable
+// columns and the binary encoding were introduced have no header: their
+// columns have no nulls, and are preceded instead by a boolean that
+// indicates whether they are encoded with a codec. Such streams begin
+// with the length of a gob message, which is never zero, and so they
+// are told apart by the header's leading zero byte. The header's last
+// byte is the version of the format, which must change with it.
+const streamHeader = "\x00bigslice\x01"
+
+// The binary encoding is a purpose-built, columnar encoding for
+// columns of basic kinds, which dominate the data that are shuffled
+// between tasks, and for which gob's general machinery (reflection,
+// per-value type dispatch) is costly. A column is encoded into a
+// single buffer, which is written to the stream verbatim, preceded by
+// its length. Signed integers are zig-zag varint encoded, unsigned
+// integers are varint encoded, floating point numbers are encoded as
+// their raw little-endian IEEE 754 bits, booleans are encoded as
+// bytes, and strings are encoded as their varint encoded lengths,
+// followed by their concatenated bytes.
+
+var errBinaryCorrupt = errors.E(errors.Integrity, "sliceio: corrupt binary column")
+
+// binaryEncoding tells whether columns of the provided type are
+// encoded with the binary encoding.
+func binaryEncoding(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool, reflect.String:
+		return true
+	}
+	return false
+}
+
+// appendBinary appends the binary encoding of column col of frame f
+// to buf, and returns the extended buffer.
+func appendBinary(buf []byte, f frame.Frame, col int) []byte {
+	switch f.Out(col).Kind() {
+	case reflect.Int:
+		for _, v := range frame.IntCol(f, col) {
+			buf = appendVarint(buf, int64(v))
+		}
+	case reflect.Int8:
+		for _, v := range frame.Int8Col(f, col) {
+			buf = appendVarint(buf, int64(v))
+		}
+	case reflect.Int16:
+		for _, v := range frame.Int16Col(f, col) {
+			buf = appendVarint(buf, int64(v))
+		}
+	case reflect.Int32:
+		for _, v := range frame.Int32Col(f, col) {
+			buf = appendVarint(buf, int64(v))
+		}
+	case reflect.Int64:
+		for _, v := range frame.Int64Col(f, col) {
+			buf = appendVarint(buf, v)
+		}
+	case reflect.Uint:
+		for _, v := range frame.UintCol(f, col) {
+			buf = appendUvarint(buf, uint64(v))
+		}
+	case reflect.Uint8:
+		buf = append(buf, frame.Uint8Col(f, col)...)
+	case reflect.Uint16:
+		for _, v := range frame.Uint16Col(f, col) {
+			buf = appendUvarint(buf, uint64(v))
+		}
+	case reflect.Uint32:
+		for _, v := range frame.Uint32Col(f, col) {
+			buf = appendUvarint(buf, uint64(v))
+		}
+	case reflect.Uint64:
+		for _, v := range frame.Uint64Col(f, col) {
+			buf = appendUvarint(buf, v)
+		}
+	case reflect.Float32:
+		for _, v := range frame.Float32Col(f, col) {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], math.Float32bits(v))
+			buf = append(buf, b[:]...)
+		}
+	case reflect.Float64:
+		for _, v := range frame.Float64Col(f, col) {
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+			buf = append(buf, b[:]...)
+		}
+	case reflect.Bool:
+		vals := f.Value(col)
+		for i := 0; i < f.Len(); i++ {
+			var b byte
+			if vals.Index(i).Bool() {
+				b = 1
+			}
+			buf = append(buf, b)
+		}
+	case reflect.String:
+		strs := frame.StringCol(f, col)
+		for _, s := range strs {
+			buf = appendUvarint(buf, uint64(len(s)))
+		}
+		for _, s := range strs {
+			buf = append(buf, s...)
+		}
+	default:
+		panic("sliceio: no binary encoding for " + f.Out(col).String())
+	}
+	return buf
+}
+
+// decodeBinary decodes column col of frame f from buf, which holds
+// the binary encoding of f.Len() values, as encoded by appendBinary.
+func decodeBinary(buf []byte, f frame.Frame, col int) error {
+	var (
+		n   = f.Len()
+		d   = binaryDecoder{buf: buf}
+		typ = f.Out(col)
+	)
+	switch typ.Kind() {
+	case reflect.Int:
+		vals := frame.IntCol(f, col)
+		for i := range vals {
+			vals[i] = int(d.varint())
+		}
+	case reflect.Int8:
+		vals := frame.Int8Col(f, col)
+		for i := range vals {
+			vals[i] = int8(d.varint())
+		}
+	case reflect.Int16:
+		vals := frame.Int16Col(f, col)
+		for i := range vals {
+			vals[i] = int16(d.varint())
+		}
+	case reflect.Int32:
+		vals := frame.Int32Col(f, col)
+		for i := range vals {
+			vals[i] = int32(d.varint())
+		}
+	case reflect.Int64:
+		vals := frame.Int64Col(f, col)
+		for i := range vals {
+			vals[i] = d.varint()
+		}
+	case reflect.Uint:
+		vals := frame.UintCol(f, col)
+		for i := range vals {
+			vals[i] = uint(d.uvarint())
+		}
+	case reflect.Uint8:
+		copy(frame.Uint8Col(f, col), d.bytes(n))
+	case reflect.Uint16:
+		vals := frame.Uint16Col(f, col)
+		for i := range vals {
+			vals[i] = uint16(d.uvarint())
+		}
+	case reflect.Uint32:
+		vals := frame.Uint32Col(f, col)
+		for i := range vals {
+			vals[i] = uint32(d.uvarint())
+		}
+	case reflect.Uint64:
+		vals := frame.Uint64Col(f, col)
+		for i := range vals {
+			vals[i] = d.uvarint()
+		}
+	case reflect.Float32:
+		vals := frame.Float32Col(f, col)
+		b := d.bytes(4 * n)
+		for i := 0; d.err == nil && i < n; i++ {
+			vals[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+	case reflect.Float64:
+		vals := frame.Float64Col(f, col)
+		b := d.bytes(8 * n)
+		for i := 0; d.err == nil && i < n; i++ {
+			vals[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+		}
+	case reflect.Bool:
+		vals := f.Value(col)
+		b := d.bytes(n)
+		for i := 0; d.err == nil && i < n; i++ {
+			vals.Index(i).SetBool(b[i] != 0)
+		}
+	case reflect.String:
+		// The strings' bytes are read at once, but each string is
+		// copied out of them, so that strings that are retained, e.g.,
+		// by user functions, do not retain the whole column.
+		var (
+			lens  = make([]int, n)
+			total int
+		)
+		for i := range lens {
+			lens[i] = int(d.uvarint())
+			if lens[i] < 0 || lens[i] > len(d.buf) {
+				d.err = errBinaryCorrupt
+			}
+			total += lens[i]
+		}
+		if b := d.bytes(total); d.err == nil {
+			frame.SetStringsFromBytes(f, col, b, lens)
+		}
+	default:
+		panic("sliceio: no binary encoding for " + typ.String())
+	}
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = errBinaryCorrupt
+	}
+	return d.err
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+// BinaryDecoder decodes values from a buffer, recording the first
+// error that is encountered. Once an error is encountered, decoded
+// values are zero.
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errBinaryCorrupt
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errBinaryCorrupt
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errBinaryCorrupt
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
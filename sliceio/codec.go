@@ -68,34 +68,71 @@ func newGobDecoder(r io.Reader) *gobDecoder {
 type Encoder struct {
 	enc *gobEncoder
 	crc hash.Hash32
+	// w is the encoder's writer, to which binary encoded columns are
+	// written directly, between gob messages.
+	w io.Writer
+	// buf is a scratch buffer for binary encoded columns.
+	buf []byte
+	// header indicates whether the stream header has been written.
+	header bool
 }
 
 // NewEncodingWriter returns a Writer that streams slices into the provided
 // writer.
 func NewEncodingWriter(w io.Writer) *Encoder {
 	crc := crc32.NewIEEE()
+	w = io.MultiWriter(w, crc)
 	return &Encoder{
-		enc: newGobEncoder(io.MultiWriter(w, crc)),
+		enc: newGobEncoder(w),
 		crc: crc,
+		w:   w,
 	}
 }
 
 // Encode encodes a batch of rows and writes the encoded output into
 // the encoder's writer.
 func (e *Encoder) Write(_ context.Context, f frame.Frame) error {
+	if !e.header {
+		if _, err := io.WriteString(e.w, streamHeader); err != nil {
+			return err
+		}
+		e.header = true
+	}
 	e.crc.Reset()
 	if err := e.enc.Encode(f.Len()); err != nil {
 		return err
 	}
 	for col := 0; col < f.NumOut(); col++ {
-		codec := f.HasCodec(col)
-		if err := e.enc.Encode(codec); err != nil {
+		// Each column is preceded by its nulls, if any.
+		nulls := f.NullWords(col)
+		if err := e.enc.Encode(nulls != nil); err != nil {
+			return err
+		}
+		if nulls != nil {
+			if err := e.enc.Encode(nulls); err != nil {
+				return err
+			}
+		}
+		encoding := encodingGob
+		switch {
+		case f.HasCodec(col):
+			encoding = encodingCodec
+		case binaryEncoding(f.Out(col)):
+			encoding = encodingBinary
+		}
+		if err := e.enc.Encode(encoding); err != nil {
 			return err
 		}
 		var err error
-		if codec {
+		switch encoding {
+		case encodingCodec:
 			err = f.Encode(col, e.enc)
-		} else {
+		case encodingBinary:
+			e.buf = appendBinary(e.buf[:0], f, col)
+			if err = e.enc.Encode(len(e.buf)); err == nil {
+				_, err = e.w.Write(e.buf)
+			}
+		default:
 			err = e.enc.EncodeValue(f.Value(col))
 		}
 		if err != nil {
@@ -114,11 +151,23 @@ func (e *Encoder) Write(_ context.Context, f frame.Frame) error {
 // DecodingReader provides a Reader on top of a gob stream
 // encoded with batches of rows stored in column-major order.
 type decodingReader struct {
-	dec     *gobDecoder
+	dec *gobDecoder
+	// in is the stream, from which its header is read.
+	in scanReader
+	// header indicates whether the stream's header has been read, and
+	// legacy whether the stream is without one; see streamHeader.
+	header, legacy bool
+	// r is the decoder's underlying reader, from which binary encoded
+	// columns are read directly, between gob messages.
+	r io.Reader
+	// raw is a scratch buffer for binary encoded columns.
+	raw     []byte
 	crc     hash.Hash32
 	scratch frame.Frame
 	buf     frame.Frame
 	err     error
+	// cols indicates which columns are decoded; if nil, all are.
+	cols []bool
 }
 
 // NewDecodingReader returns a new Reader that decodes values from
@@ -134,17 +183,69 @@ func NewDecodingReader(r io.Reader) Reader {
 	// checksumming. Instead we fake an implementation of io.ByteReader,
 	// and take over the responsibility of ensuring that IO is buffered.
 	crc := crc32.NewIEEE()
-	if _, ok := r.(io.ByteReader); !ok {
-		r = bufio.NewReader(r)
+	in, ok := r.(scanReader)
+	if !ok {
+		in = bufio.NewReader(r)
 	}
-	r = io.TeeReader(r, crc)
-	return &decodingReader{dec: newGobDecoder(readerByteReader{Reader: r}), crc: crc}
+	r = io.TeeReader(in, crc)
+	return &decodingReader{dec: newGobDecoder(readerByteReader{Reader: r}), in: in, r: r, crc: crc}
+}
+
+// A scanReader is a reader from which bytes may be unread.
+type scanReader interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// readHeader reads the stream's header, if it has one.
+func (d *decodingReader) readHeader() error {
+	b, err := d.in.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != streamHeader[0] {
+		d.legacy = true
+		return d.in.UnreadByte()
+	}
+	for i := 1; i < len(streamHeader); i++ {
+		if b, err = d.in.ReadByte(); err != nil {
+			if err == io.EOF {
+				err = errors.E(errors.Integrity, "truncated stream header")
+			}
+			return err
+		}
+		if b != streamHeader[i] {
+			return errors.E(errors.Integrity, "invalid stream header")
+		}
+	}
+	return nil
+}
+
+// NewPartialDecodingReader returns a new Reader that decodes values
+// from the provided stream, as NewDecodingReader, but only for the
+// columns col for which cols[col] is true. The values of other columns
+// are skipped without being materialized, and are left zero in the
+// frames that are read. Columns that are encoded with a custom codec
+// are always decoded. If cols is nil, all columns are decoded.
+func NewPartialDecodingReader(r io.Reader, cols []bool) Reader {
+	d := NewDecodingReader(r).(*decodingReader)
+	d.cols = cols
+	return d
 }
 
 func (d *decodingReader) Read(ctx context.Context, f frame.Frame) (n int, err error) {
 	if d.err != nil {
 		return 0, d.err
 	}
+	if !d.header {
+		if d.err = d.readHeader(); d.err != nil {
+			if d.err == io.EOF {
+				d.err = EOF
+			}
+			return 0, d.err
+		}
+		d.header = true
+	}
 	for d.buf.Len() == 0 {
 		d.crc.Reset()
 		if d.err = d.dec.Decode(&n); d.err != nil {
@@ -186,18 +287,80 @@ func (d *decodingReader) decode(f frame.Frame) error {
 	// that involves user code.
 	f.Zero()
 	for col := 0; col < f.NumOut(); col++ {
-		var codec bool
-		if err := d.dec.Decode(&codec); err != nil {
-			return err
+		// Legacy streams predate nullable columns, and so their columns
+		// are not preceded by nulls.
+		var hasNulls bool
+		if !d.legacy {
+			if err := d.dec.Decode(&hasNulls); err != nil {
+				return err
+			}
 		}
-		if codec && !f.HasCodec(col) {
-			return errors.New("column encoded with custom codec but no codec available on receipt")
+		if hasNulls {
+			var nulls []uint64
+			if err := d.dec.Decode(&nulls); err != nil {
+				return err
+			}
+			f.SetNullWords(col, nulls)
 		}
-		if codec {
+		var encoding uint8
+		if d.legacy {
+			var codec bool
+			if err := d.dec.Decode(&codec); err != nil {
+				return err
+			}
+			if codec {
+				encoding = encodingCodec
+			}
+		} else if err := d.dec.Decode(&encoding); err != nil {
+			return err
+		}
+		switch encoding {
+		case encodingCodec:
+			if !f.HasCodec(col) {
+				return errors.New("column encoded with custom codec but no codec available on receipt")
+			}
 			if err := f.Decode(col, d.dec); err != nil {
 				return err
 			}
 			continue
+		case encodingBinary:
+			if !binaryEncoding(f.Out(col)) {
+				return errors.New("column encoded with binary encoding but is of type " + f.Out(col).String())
+			}
+			var n int
+			if err := d.dec.Decode(&n); err != nil {
+				return err
+			}
+			if n < 0 {
+				return errors.E(errors.Integrity, fmt.Sprintf("invalid binary column length %d", n))
+			}
+			if cap(d.raw) < n {
+				d.raw = make([]byte, n)
+			}
+			if _, err := io.ReadFull(d.r, d.raw[:n]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return errors.E(errors.Integrity, "truncated binary column")
+				}
+				return err
+			}
+			if d.cols != nil && !d.cols[col] {
+				continue
+			}
+			if err := decodeBinary(d.raw[:n], f, col); err != nil {
+				return err
+			}
+			continue
+		}
+		if d.cols != nil && !d.cols[col] {
+			// Gob discards values that are decoded into the zero Value,
+			// parsing them without allocating or invoking user decoders.
+			if err := d.dec.DecodeValue(reflect.Value{}); err != nil {
+				if err == io.EOF {
+					return EOF
+				}
+				return err
+			}
+			continue
 		}
 		// Arrange for gob to decode directly into the frame's underlying
 		// slice. We have to do some gymnastics to produce a pointer to
@@ -8,10 +8,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	fuzz "github.com/google/gofuzz"
 	"github.com/grailbio/base/errors"
@@ -135,6 +142,86 @@ func TestCodec(t *testing.T) {
 	*/
 }
 
+// countedValue is a gob-encoded value that counts its decodings.
+type countedValue struct{ V byte }
+
+var countedDecodes int
+
+func (v countedValue) GobEncode() ([]byte, error) { return []byte{v.V}, nil }
+
+func (v *countedValue) GobDecode(p []byte) error {
+	countedDecodes++
+	v.V = p[0]
+	return nil
+}
+
+func TestPartialDecodingReader(t *testing.T) {
+	const N = 100
+	var (
+		c0 = make([]string, N)
+		c1 = make([]int, N)
+		c2 = make([]testStruct, N)
+		c3 = make([]countedValue, N)
+	)
+	for i := range c0 {
+		c0[i] = fmt.Sprint(i)
+		c1[i] = i
+		c2[i] = testStruct{i, i, i}
+		c3[i] = countedValue{byte(i + 1)}
+	}
+	var b bytes.Buffer
+	enc := NewEncodingWriter(&b)
+	ctx := context.Background()
+	in := frame.Slices(c0, c1, c2, c3)
+	for i := 0; i < 2; i++ {
+		if err := enc.Write(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cols := range [][]bool{
+		{false, true, false, false},
+		{true, false, false, true},
+		nil,
+	} {
+		countedDecodes = 0
+		dec := NewPartialDecodingReader(bytes.NewReader(b.Bytes()), cols)
+		// Read in chunks that are smaller than the encoded batches, to
+		// exercise buffering.
+		out := frame.Make(in, N*2, N*2)
+		for i := 0; i < N*2; {
+			j := i + N/3
+			if j > N*2 {
+				j = N * 2
+			}
+			n, err := dec.Read(ctx, out.Slice(i, j))
+			if err != nil {
+				t.Fatal(err)
+			}
+			i += n
+		}
+		if n, err := dec.Read(ctx, out); err != EOF || n != 0 {
+			t.Fatalf("got %v, %v, want 0, EOF", n, err)
+		}
+		for col := 0; col < in.NumOut(); col++ {
+			// Column 2 is encoded with a custom codec, and so is always
+			// decoded.
+			decoded := cols == nil || cols[col] || col == 2
+			for _, half := range []frame.Frame{out.Slice(0, N), out.Slice(N, N*2)} {
+				want := in.Interface(col)
+				if !decoded {
+					want = reflect.MakeSlice(reflect.SliceOf(in.Out(col)), N, N).Interface()
+				}
+				if got := half.Interface(col); !reflect.DeepEqual(got, want) {
+					t.Errorf("cols %v: column %d: got %v, want %v", cols, col, got, want)
+				}
+			}
+		}
+		if got, want := countedDecodes > 0, cols == nil || cols[3]; got != want {
+			t.Errorf("cols %v: got %v, want %v", cols, got, want)
+		}
+	}
+}
+
 func TestDecodingReaderWithZeros(t *testing.T) {
 	// Gob, in its infinite cleverness, does not transmit zero values.
 	// However, it apparently also does not zero out zero values in
@@ -407,3 +494,248 @@ func TestSession(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestCodecNulls(t *testing.T) {
+	const N = 100
+	in := frame.Make(slicetype.New(typeOfString, typeOfInt), N, N)
+	for i := 0; i < N; i += 7 {
+		in.SetNull(1, i, true)
+	}
+	var b bytes.Buffer
+	ctx := context.Background()
+	if err := NewEncodingWriter(&b).Write(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	out := frame.Make(in, N, N)
+	out.SetNull(0, 0, true)
+	n, err := NewDecodingReader(bytes.NewReader(b.Bytes())).Read(ctx, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, N; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := 0; i < N; i++ {
+		if got, want := out.IsNull(1, i), i%7 == 0; got != want {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+		if out.IsNull(0, i) {
+			t.Errorf("row %d: unexpected null", i)
+		}
+	}
+}
+
+func TestCodecTimeDecimal(t *testing.T) {
+	var (
+		t0    = time.Unix(1e9, 123).UTC()
+		zone  = time.FixedZone("", -5*3600)
+		times = []time.Time{t0, t0.Add(time.Hour).In(zone), {}}
+		decs  = []slicetype.Decimal{slicetype.NewDecimal(1, 2), slicetype.NewDecimal(-300, 0), {}}
+	)
+	in := frame.Slices(times, decs)
+	if !in.HasCodec(0) || !in.HasCodec(1) {
+		t.Fatal("expected native codecs")
+	}
+	var b bytes.Buffer
+	ctx := context.Background()
+	if err := NewEncodingWriter(&b).Write(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	out := frame.Make(in, len(times), len(times))
+	if _, err := NewDecodingReader(bytes.NewReader(b.Bytes())).Read(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.Interface(1), decs; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i, got := range frame.TimeCol(out, 0) {
+		want := times[i]
+		if !got.Equal(want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		_, gotOffset := got.Zone()
+		_, wantOffset := want.Zone()
+		if gotOffset != wantOffset {
+			t.Errorf("got offset %v, want %v", gotOffset, wantOffset)
+		}
+	}
+	// UTC times are decoded as UTC, regardless of the local zone.
+	if got, want := frame.TimeCol(out, 0)[0], t0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !frame.TimeCol(out, 0)[2].IsZero() {
+		t.Error("expected zero time")
+	}
+}
+
+type (
+	namedString string
+	namedBool   bool
+)
+
+func TestBinaryTypes(t *testing.T) {
+	testRoundTrip(t,
+		[]int{}, []int8{}, []int16{}, []int32{}, []int64{},
+		[]uint{}, []uint8{}, []uint16{}, []uint32{}, []uint64{},
+		[]float32{}, []float64{}, []bool{}, []string{},
+		[]namedString{}, []namedBool{}, []time.Duration{})
+	for _, typ := range []reflect.Type{typeOfInt, typeOfString, reflect.TypeOf(time.Duration(0)), reflect.TypeOf(namedBool(false))} {
+		if !binaryEncoding(typ) {
+			t.Errorf("%s: expected binary encoding", typ)
+		}
+	}
+	for _, typ := range []reflect.Type{reflect.TypeOf([]byte{}), reflect.TypeOf(testStruct{}), reflect.TypeOf((*interface{})(nil)).Elem()} {
+		if binaryEncoding(typ) {
+			t.Errorf("%s: unexpected binary encoding", typ)
+		}
+	}
+}
+
+func TestBinaryCorrupt(t *testing.T) {
+	f := frame.Slices([]string{"abc", "d"})
+	buf := appendBinary(nil, f, 0)
+	for _, corrupt := range [][]byte{buf[:len(buf)-1], append(buf, 0), buf[:1]} {
+		out := frame.Make(f, 2, 2)
+		if err := decodeBinary(corrupt, out, 0); !errors.Is(errors.Integrity, err) {
+			t.Errorf("%v: expected integrity error, got %v", corrupt, err)
+		}
+	}
+}
+
+// writeLegacy writes f to enc as did encoders before the introduction
+// of nullable columns and the binary encoding, whose streams have no
+// header, and whose columns are preceded only by a boolean that
+// indicates whether they are encoded with a codec.
+func writeLegacy(enc *gobEncoder, crc hash.Hash32, f frame.Frame) error {
+	crc.Reset()
+	if err := enc.Encode(f.Len()); err != nil {
+		return err
+	}
+	for col := 0; col < f.NumOut(); col++ {
+		codec := f.HasCodec(col)
+		if err := enc.Encode(codec); err != nil {
+			return err
+		}
+		var err error
+		if codec {
+			err = f.Encode(col, enc)
+		} else {
+			err = enc.EncodeValue(f.Value(col))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return enc.Encode(crc.Sum32())
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	var (
+		b   bytes.Buffer
+		crc = crc32.NewIEEE()
+		enc = newGobEncoder(io.MultiWriter(&b, crc))
+	)
+	for i := 0; i < 2; i++ {
+		if err := writeLegacy(enc, crc, frame.Slices(legacyInts, legacyStrs, legacyVals, legacyIfaces)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testDecodeLegacy(t, &b)
+}
+
+// TestDecodeLegacyStream decodes testdata/legacy.stream, which was
+// written by the encoder as it was before the introduction of nullable
+// columns and the binary encoding. It holds two frames of legacyInts,
+// legacyStrs, legacyVals, and legacyIfaces.
+func TestDecodeLegacyStream(t *testing.T) {
+	f, err := os.Open("testdata/legacy.stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	testDecodeLegacy(t, f)
+}
+
+// The columns of the frames of the legacy streams decoded by
+// testDecodeLegacy.
+var (
+	legacyInts   = []int{1, 2, 3}
+	legacyStrs   = []string{"a", "bc", ""}
+	legacyVals   = []testStruct{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+	legacyIfaces = []interface{}{"x", 1.5, true}
+)
+
+func testDecodeLegacy(t *testing.T, r io.Reader) {
+	t.Helper()
+	var (
+		gotInts   []int
+		gotStrs   []string
+		gotVals   []testStruct
+		gotIfaces []interface{}
+	)
+	if err := ReadAll(context.Background(), NewDecodingReader(r), &gotInts, &gotStrs, &gotVals, &gotIfaces); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gotInts, append(legacyInts, legacyInts...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := gotStrs, append(legacyStrs, legacyStrs...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := gotVals, append(legacyVals, legacyVals...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := gotIfaces, append(legacyIfaces, legacyIfaces...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBinaryStringCopies(t *testing.T) {
+	const N = 1000
+	strs := make([]string, N)
+	for i := range strs {
+		strs[i] = fmt.Sprint(N + i)
+	}
+	var (
+		buf = appendBinary(nil, frame.Slices(strs), 0)
+		out = frame.Make(slicetype.New(typeOfString), N, N)
+	)
+	allocs := testing.AllocsPerRun(10, func() {
+		if err := decodeBinary(buf, out, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// Each value is copied, so that retaining one does not retain the
+	// others.
+	if allocs < N {
+		t.Errorf("got %v allocations, want at least %v", allocs, N)
+	}
+	if got, want := out.Interface(0), strs; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	const N = 1024
+	fz := fuzz.NewWithSeed(1)
+	fz.NilChance(0)
+	fz.NumElements(N, N)
+	var (
+		ints   []int
+		floats []float64
+		strs   []string
+	)
+	fz.Fuzz(&ints)
+	fz.Fuzz(&floats)
+	fz.Fuzz(&strs)
+	f := frame.Slices(ints, floats, strs)
+	enc := NewEncodingWriter(ioutil.Discard)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Write(ctx, f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package slicerepl implements an interactive read-eval-print loop for
+// exploratory analysis with bigslice. Users query tables, registered
+// by the program with Register, in the SQL dialect of package
+// slicesql; each query is run as an invocation of a long-lived
+// session, so that the machines that the session has warmed up are
+// reused from one query to the next.
+//
+// The results of queries may be kept for later queries as views:
+//
+//	bigslice> CREATE VIEW big AS SELECT id, amount FROM orders WHERE amount > 100;
+//	bigslice> SELECT COUNT(*) FROM big;
+//
+// Views are persisted in the session (see bigslice.Persist), so that
+// they are computed once, when they are created, and read by the
+// queries that use them without being recomputed.
+//
+// Programs typically register their tables in init, and create their
+// sessions with sliceconfig.Parse, which runs the REPL in lieu of the
+// program when given the -repl flag, as it is by "bigslice repl".
+// Tables must be registered before the session is created, as
+// bigmachine workers do not run the program beyond that point.
+package slicerepl
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
+	"github.com/grailbio/bigslice/slicesql"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// DefaultMaxRows is the default number of rows of a query's result that
+// are printed.
+const DefaultMaxRows = exec.DefaultPreviewRows
+
+// A table is a registered table.
+type table struct {
+	fn      func() bigslice.Slice
+	columns []string
+}
+
+var (
+	mu     sync.Mutex
+	tables = make(map[string]table)
+)
+
+// Register registers a table with the provided name, which is computed
+// by the slice returned by fn, and whose columns are named as by
+// slicesql.DB.Register. The slice is constructed anew for each query
+// that is run, both by the driver and by the workers that evaluate it,
+// so fn must be deterministic. Tables must be registered in every
+// process of a program, e.g., in init.
+func Register(name string, fn func() bigslice.Slice, columns ...string) {
+	mu.Lock()
+	tables[name] = table{fn, append([]string(nil), columns...)}
+	mu.Unlock()
+}
+
+// A View is a query whose results are kept, under a name, for later
+// queries.
+type View struct {
+	// Name is the name of the view, by which it is queried.
+	Name string
+	// Query is the query that computes the view.
+	Query string
+}
+
+// persistKey returns the key under which the last of the provided
+// views is persisted. The key identifies the view's query and the
+// views that precede it, on which it may depend.
+func persistKey(views []View) string {
+	h := sha256.New()
+	for _, view := range views {
+		fmt.Fprintf(h, "%q %q\n", view.Name, view.Query)
+	}
+	return fmt.Sprintf("slicerepl/%s/%x", views[len(views)-1].Name, h.Sum(nil)[:8])
+}
+
+// build compiles the provided query against the registered tables and
+// the provided views.
+func build(query string, views []View) (bigslice.Slice, error) {
+	bigslice.Helper()
+	db := slicesql.New()
+	mu.Lock()
+	for name, t := range tables {
+		if err := db.Register(name, t.fn(), t.columns...); err != nil {
+			mu.Unlock()
+			return nil, err
+		}
+	}
+	mu.Unlock()
+	for i, view := range views {
+		slice, err := db.Query(view.Query)
+		if err != nil {
+			return nil, errors.E(err, "view ", view.Name)
+		}
+		columns := make([]string, slice.NumOut())
+		for j := range columns {
+			columns[j] = slicetype.ColumnName(slice, j)
+		}
+		slice = bigslice.Persist(slice, persistKey(views[:i+1]), bigslice.PersistDisk)
+		if err := db.Register(view.Name, slice, columns...); err != nil {
+			return nil, err
+		}
+	}
+	return db.Query(query)
+}
+
+// queryFunc computes the result of a query against the registered
+// tables and the provided views.
+var queryFunc = bigslice.Func(func(query string, views []View) bigslice.Slice {
+	slice, err := build(query, views)
+	if err != nil {
+		panic(err)
+	}
+	return slice
+})
+
+// A REPL is an interactive session in which queries are run. A REPL is
+// not safe for concurrent use.
+type REPL struct {
+	sess    *exec.Session
+	out     io.Writer
+	views   []View
+	maxRows int
+}
+
+// New returns a new REPL that runs its queries in the provided session
+// and writes their results to w.
+func New(sess *exec.Session, w io.Writer) *REPL {
+	return &REPL{sess: sess, out: w, maxRows: DefaultMaxRows}
+}
+
+// Run runs the REPL, reading statements from r until it is exhausted,
+// or until the statement \quit. Statements that fail are reported, and
+// do not end the REPL. If prompt is true, a prompt is written before
+// each statement.
+func (r *REPL) Run(ctx context.Context, in io.Reader, prompt bool) error {
+	var (
+		scan = bufio.NewScanner(in)
+		stmt strings.Builder
+	)
+	for {
+		if prompt {
+			if stmt.Len() == 0 {
+				fmt.Fprint(r.out, "bigslice> ")
+			} else {
+				fmt.Fprint(r.out, "       -> ")
+			}
+		}
+		if !scan.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scan.Text())
+		if line == "" {
+			continue
+		}
+		// Commands occupy a line, and statements continue until they end
+		// with a semicolon.
+		if stmt.Len() == 0 && !strings.HasPrefix(line, `\`) && !strings.HasSuffix(line, ";") ||
+			stmt.Len() > 0 && !strings.HasSuffix(line, ";") {
+			stmt.WriteString(line)
+			stmt.WriteString("\n")
+			continue
+		}
+		stmt.WriteString(line)
+		text := stmt.String()
+		stmt.Reset()
+		if text == `\quit` || text == `\q` {
+			return nil
+		}
+		if err := r.Exec(ctx, text); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	}
+	return scan.Err()
+}
+
+var createViewRE = regexp.MustCompile(`(?is)^CREATE\s+VIEW\s+([A-Za-z_][A-Za-z0-9_]*)\s+AS\s+(.*)$`)
+
+// Exec executes the provided statement, which is either a query, a
+// CREATE VIEW statement, or a command (see \help).
+func (r *REPL) Exec(ctx context.Context, stmt string) error {
+	stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+	if strings.HasPrefix(stmt, `\`) {
+		return r.command(ctx, stmt)
+	}
+	if m := createViewRE.FindStringSubmatch(stmt); m != nil {
+		return r.createView(ctx, m[1], m[2])
+	}
+	res, err := r.run(ctx, stmt, r.views)
+	if err != nil {
+		return err
+	}
+	defer res.Discard(ctx)
+	return r.print(ctx, res)
+}
+
+const help = `Statements end with a semicolon. They are:
+
+	SELECT ...;                        run a query and print its results
+	CREATE VIEW name AS SELECT ...;    run a query and keep its results as a view
+	\tables                            list the tables and views and their columns
+	\drop name                         drop a view
+	\explain SELECT ...                print the plan of a query without running it
+	\rows n                            print at most n rows of each result
+	\help                              print this message
+	\quit                              exit
+`
+
+func (r *REPL) command(ctx context.Context, cmd string) error {
+	fields := strings.Fields(cmd)
+	switch fields[0] {
+	case `\help`, `\h`, `\?`:
+		_, err := io.WriteString(r.out, help)
+		return err
+	case `\tables`:
+		return r.printTables()
+	case `\drop`:
+		if len(fields) != 2 {
+			return errors.E(errors.Invalid, `usage: \drop name`)
+		}
+		return r.dropView(ctx, fields[1])
+	case `\explain`:
+		query := strings.TrimSpace(strings.TrimPrefix(cmd, `\explain`))
+		if _, err := build(query, r.views); err != nil {
+			return err
+		}
+		return r.sess.Explain(ctx, r.out, queryFunc, query, r.views)
+	case `\rows`:
+		if len(fields) != 2 {
+			return errors.E(errors.Invalid, `usage: \rows n`)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n <= 0 {
+			return errors.E(errors.Invalid, "invalid number of rows ", fields[1])
+		}
+		r.maxRows = n
+		return nil
+	default:
+		return errors.E(errors.Invalid, "unknown command ", fields[0], `; see \help`)
+	}
+}
+
+// run runs the provided query against the provided views. The query
+// is first compiled by the driver, so that invalid queries are
+// reported without running anything.
+func (r *REPL) run(ctx context.Context, query string, views []View) (*exec.Result, error) {
+	if _, err := build(query, views); err != nil {
+		return nil, err
+	}
+	return r.sess.Run(ctx, queryFunc, query, views)
+}
+
+func (r *REPL) createView(ctx context.Context, name, query string) error {
+	mu.Lock()
+	_, ok := tables[name]
+	mu.Unlock()
+	if ok {
+		return errors.E(errors.Exists, "table ", name, " exists")
+	}
+	for _, view := range r.views {
+		if view.Name == name {
+			return errors.E(errors.Exists, "view ", name, ` exists; \drop it first`)
+		}
+	}
+	views := append(r.views[:len(r.views):len(r.views)], View{name, query})
+	// The view is computed, and persisted, by a query that reads it.
+	res, err := r.run(ctx, "SELECT COUNT(*) AS n FROM "+name, views)
+	if err != nil {
+		return err
+	}
+	defer res.Discard(ctx)
+	var (
+		scan = res.Scanner()
+		n    int64
+	)
+	defer scan.Close()
+	scan.Scan(ctx, &n)
+	if err := scan.Err(); err != nil {
+		return err
+	}
+	r.views = views
+	fmt.Fprintf(r.out, "created view %s (%d rows)\n", name, n)
+	return nil
+}
+
+func (r *REPL) dropView(ctx context.Context, name string) error {
+	for i, view := range r.views {
+		if view.Name != name {
+			continue
+		}
+		if i < len(r.views)-1 {
+			// Later views may depend on the view, and are persisted under
+			// keys that include it.
+			return errors.E(errors.Invalid, "view ", name, " was created before view ", r.views[len(r.views)-1].Name, "; drop the later views first")
+		}
+		key := persistKey(r.views)
+		r.views = r.views[:i]
+		if err := r.sess.Unpersist(ctx, key); err != nil && !errors.Is(errors.NotExist, err) {
+			return err
+		}
+		return nil
+	}
+	return errors.E(errors.NotExist, "view ", name)
+}
+
+func (r *REPL) printTables() error {
+	tw := tabwriter.NewWriter(r.out, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tkind\tcolumns")
+	mu.Lock()
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		slice, err := build("SELECT * FROM "+name, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\ttable\t%s\n", name, columns(slice))
+	}
+	for i, view := range r.views {
+		slice, err := build("SELECT * FROM "+view.Name, r.views[:i+1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\tview\t%s\n", view.Name, columns(slice))
+	}
+	return tw.Flush()
+}
+
+// columns describes the columns of the provided slice.
+func columns(slice bigslice.Slice) string {
+	cols := make([]string, slice.NumOut())
+	for i := range cols {
+		cols[i] = fmt.Sprintf("%s %s", slicetype.ColumnName(slice, i), slice.Out(i))
+	}
+	return strings.Join(cols, ", ")
+}
+
+// print prints up to r.maxRows rows of the provided result.
+func (r *REPL) print(ctx context.Context, res *exec.Result) error {
+	p, err := res.Preview(ctx, r.maxRows)
+	if err != nil {
+		return err
+	}
+	return p.WriteText(r.out)
+}
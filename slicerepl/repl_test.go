@@ -0,0 +1,126 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicerepl_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/exec"
+	"github.com/grailbio/bigslice/slicerepl"
+)
+
+func init() {
+	slicerepl.Register("orders", func() bigslice.Slice {
+		return bigslice.Const(3,
+			[]int{1, 1, 2, 3, 3, 3, 5},
+			[]float64{10, 20, 5, 1, 2, 3, 100},
+		)
+	}, "user_id", "amount")
+}
+
+func testREPL() (*slicerepl.REPL, *bytes.Buffer, func()) {
+	sess := exec.Start(exec.Local)
+	var b bytes.Buffer
+	return slicerepl.New(sess, &b), &b, sess.Shutdown
+}
+
+func TestREPL(t *testing.T) {
+	ctx := context.Background()
+	r, b, shutdown := testREPL()
+	defer shutdown()
+	if err := r.Exec(ctx, "SELECT COUNT(*) AS n, SUM(amount) AS total FROM orders;"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Fields(b.String()), []string{"n", "total", "7", "141"}; !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	b.Reset()
+	if err := r.Exec(ctx, "CREATE VIEW big AS SELECT user_id, amount FROM orders WHERE amount >= 10;"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "created view big (3 rows)\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	b.Reset()
+	if err := r.Exec(ctx, "SELECT COUNT(*) AS n FROM big WHERE user_id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Fields(b.String()), []string{"n", "2"}; !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := r.Exec(ctx, "CREATE VIEW big AS SELECT * FROM orders"); err == nil {
+		t.Error("expected error redefining view")
+	}
+	if err := r.Exec(ctx, `\drop big`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Exec(ctx, "SELECT * FROM big"); err == nil {
+		t.Error("expected error querying dropped view")
+	}
+}
+
+func TestREPLRows(t *testing.T) {
+	ctx := context.Background()
+	r, b, shutdown := testREPL()
+	defer shutdown()
+	if err := r.Exec(ctx, `\rows 2`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Exec(ctx, "SELECT user_id FROM orders"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if got, want := len(lines), 4; got != want {
+		t.Fatalf("got %v, want %v: %q", got, want, lines)
+	}
+	if got, want := lines[3], "(more than 2 rows)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestREPLRun(t *testing.T) {
+	ctx := context.Background()
+	r, b, shutdown := testREPL()
+	defer shutdown()
+	in := strings.NewReader(`SELECT SUM(amount) AS total
+		FROM orders WHERE user_id = 3;
+		SELECT nope FROM orders;
+		\tables
+		\quit
+		SELECT COUNT(*) AS n FROM orders;
+	`)
+	if err := r.Run(ctx, in, false); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"total\n6\n",
+		"error: ",
+		"orders  table  user_id int, amount float64",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "n\n") {
+		t.Errorf("output %q contains statement after \\quit", out)
+	}
+}
+
+func equal(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
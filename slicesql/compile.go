@@ -0,0 +1,800 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicesql
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// Queries are compiled into slices as follows. The query's tables are
+// joined, in order, by bigslice.Join, after their key columns are
+// moved to the front of each side by bigslice.SelectColumns; WHERE
+// clauses are compiled into a bigslice.Filter. Queries without
+// aggregates are then projected by SelectColumns, if they select only
+// columns, or else by a bigslice.Map. Aggregate queries are compiled
+// into a Map that emits, for each row, its GROUP BY key columns and a
+// struct that holds the initial states of the query's aggregates, a
+// bigslice.Reduce that merges the states of each key, and a Map that
+// computes the query's select list from the keys and merged states.
+// The functions passed to Filter, Map, and Reduce are constructed by
+// reflect.MakeFunc, and evaluate the query's expressions, which are
+// compiled into closures over rows of reflect.Values.
+
+var (
+	typeOfInt64   = reflect.TypeOf(int64(0))
+	typeOfFloat64 = reflect.TypeOf(float64(0))
+	typeOfBool    = reflect.TypeOf(false)
+)
+
+// A relation is an intermediate result of a query: a slice, and the
+// names by which its columns are referred to.
+type relation struct {
+	slice bigslice.Slice
+	// refs holds, for each column, its qualified names. The key columns
+	// of joins have a name for each side of the join.
+	refs [][]colRef
+}
+
+// relationOf returns the relation of the table referred to by ref.
+func (db *DB) relationOf(ref tableRef) (*relation, error) {
+	t, ok := db.tables[ref.table]
+	if !ok {
+		return nil, fmt.Errorf("no table named %s", ref.table)
+	}
+	r := &relation{slice: t.slice, refs: make([][]colRef, len(t.columns))}
+	for i, col := range t.columns {
+		r.refs[i] = []colRef{{ref.name(), col}}
+	}
+	return r, nil
+}
+
+// lookup returns the index of the column referred to by ref, or -1 if
+// there is no such column. It returns an error if ref is ambiguous.
+func (r *relation) lookup(ref *colRef) (int, error) {
+	col := -1
+	for i, refs := range r.refs {
+		for _, name := range refs {
+			if name.column != ref.column || ref.table != "" && name.table != ref.table {
+				continue
+			}
+			if col >= 0 && col != i {
+				return -1, fmt.Errorf("column reference %s is ambiguous", ref)
+			}
+			col = i
+		}
+	}
+	return col, nil
+}
+
+// resolve returns the index of the column referred to by ref.
+func (r *relation) resolve(ref *colRef) (int, error) {
+	col, err := r.lookup(ref)
+	if err == nil && col < 0 {
+		err = fmt.Errorf("no column named %s", ref)
+	}
+	return col, err
+}
+
+func (r *relation) types() []reflect.Type {
+	return slicetype.Columns(r.slice)
+}
+
+func (db *DB) compile(q *query) (bigslice.Slice, error) {
+	rel, err := db.relationOf(q.from)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]bool{q.from.name(): true}
+	for _, j := range q.joins {
+		if tables[j.table.name()] {
+			return nil, fmt.Errorf("duplicate table name %s; use an alias", j.table.name())
+		}
+		tables[j.table.name()] = true
+		right, err := db.relationOf(j.table)
+		if err != nil {
+			return nil, err
+		}
+		if rel, err = joinRelations(rel, right, j.on); err != nil {
+			return nil, err
+		}
+	}
+	if q.where != nil {
+		pred, err := compileExpr(q.where, rowEnv{rel, "WHERE"})
+		if err != nil {
+			return nil, err
+		}
+		if pred.typ != typeOfBool {
+			return nil, fmt.Errorf("WHERE clause %s is not boolean", q.where)
+		}
+		fn := makeFunc(rel.types(), []reflect.Type{typeOfBool}, func(args []reflect.Value) []reflect.Value {
+			return []reflect.Value{pred.eval(args)}
+		})
+		rel.slice = bigslice.Filter(rel.slice, fn)
+	}
+	var (
+		slice bigslice.Slice
+		names []string
+	)
+	if q.star {
+		if len(q.groupBy) > 0 {
+			return nil, fmt.Errorf("SELECT * cannot be used with GROUP BY")
+		}
+		slice, names = rel.slice, starNames(rel)
+	} else {
+		aggregates := len(q.groupBy) > 0
+		for _, item := range q.items {
+			aggregates = aggregates || hasAggregate(item.expr)
+		}
+		if aggregates {
+			slice, err = compileAggregate(q, rel)
+		} else {
+			slice, err = compileProject(q, rel)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, item := range q.items {
+			name := item.alias
+			if name == "" {
+				if ref, ok := item.expr.(*colRef); ok {
+					name = ref.column
+				} else {
+					name = item.expr.String()
+				}
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate output column name %s; use AS to rename columns", name)
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if q.limit > 0 {
+		slice = bigslice.Limit(slice, q.limit)
+	}
+	if slice.Prefix() > 1 {
+		// The results of joins and aggregates retain the prefixes of
+		// their keys, which need not be selected by the query.
+		slice = bigslice.Prefixed(slice, 1)
+	}
+	return bigslice.NameColumns(slice, names...), nil
+}
+
+// starNames returns the names of the columns of rel as selected by
+// "SELECT *": columns are named by their unqualified names, unless
+// those are ambiguous.
+func starNames(rel *relation) []string {
+	count := make(map[string]int)
+	for _, refs := range rel.refs {
+		count[refs[0].column]++
+	}
+	names := make([]string, len(rel.refs))
+	for i, refs := range rel.refs {
+		if names[i] = refs[0].column; count[names[i]] > 1 {
+			names[i] = refs[0].String()
+		}
+	}
+	return names
+}
+
+// joinRelations returns the inner join of relations left and right on
+// the provided condition, which must be a conjunction of equalities
+// between columns of the two relations.
+func joinRelations(left, right *relation, on expr) (*relation, error) {
+	var leftKeys, rightKeys []int
+	var addKeys func(e expr) error
+	addKeys = func(e expr) error {
+		b, ok := e.(*binaryExpr)
+		if ok && b.op == "AND" {
+			if err := addKeys(b.x); err != nil {
+				return err
+			}
+			return addKeys(b.y)
+		}
+		if !ok || b.op != "=" {
+			return fmt.Errorf("JOIN condition %s is not an equality of columns", e)
+		}
+		x, xok := b.x.(*colRef)
+		y, yok := b.y.(*colRef)
+		if !xok || !yok {
+			return fmt.Errorf("JOIN condition %s is not an equality of columns", e)
+		}
+		for _, refs := range [][2]*colRef{{x, y}, {y, x}} {
+			l, err := left.lookup(refs[0])
+			if err != nil {
+				return err
+			}
+			r, err := right.lookup(refs[1])
+			if err != nil {
+				return err
+			}
+			if l >= 0 && r >= 0 {
+				lt, rt := left.slice.Out(l), right.slice.Out(r)
+				if lt != rt {
+					return fmt.Errorf("JOIN condition %s compares columns of different types %s and %s", e, lt, rt)
+				}
+				if !frame.CanHash(lt) || !frame.CanCompare(lt) {
+					return fmt.Errorf("JOIN condition %s: cannot join on columns of type %s", e, lt)
+				}
+				leftKeys = append(leftKeys, l)
+				rightKeys = append(rightKeys, r)
+				return nil
+			}
+		}
+		return fmt.Errorf("JOIN condition %s does not compare a column of each side of the join", e)
+	}
+	if err := addKeys(on); err != nil {
+		return nil, err
+	}
+	var (
+		joined               = new(relation)
+		leftCols, leftRest   = reorder(left, leftKeys)
+		rightCols, rightRest = reorder(right, rightKeys)
+	)
+	for i := range leftKeys {
+		refs := append(append([]colRef(nil), left.refs[leftKeys[i]]...), right.refs[rightKeys[i]]...)
+		joined.refs = append(joined.refs, refs)
+	}
+	for _, col := range leftRest {
+		joined.refs = append(joined.refs, left.refs[col])
+	}
+	for _, col := range rightRest {
+		joined.refs = append(joined.refs, right.refs[col])
+	}
+	var (
+		leftSlice  = bigslice.SelectColumns(left.slice, leftCols...)
+		rightSlice = bigslice.SelectColumns(right.slice, rightCols...)
+	)
+	if n := len(leftKeys); n > 1 {
+		leftSlice = bigslice.Prefixed(leftSlice, n)
+		rightSlice = bigslice.Prefixed(rightSlice, n)
+	}
+	joined.slice = bigslice.Join(leftSlice, rightSlice)
+	return joined, nil
+}
+
+// reorder returns the columns of rel with the provided key columns
+// first, and the remaining (non-key) columns.
+func reorder(rel *relation, keys []int) (cols, rest []int) {
+	isKey := make(map[int]bool)
+	for _, key := range keys {
+		isKey[key] = true
+	}
+	cols = append(cols, keys...)
+	for col := range rel.refs {
+		if !isKey[col] {
+			cols = append(cols, col)
+			rest = append(rest, col)
+		}
+	}
+	return
+}
+
+// compileProject compiles the select list of a query without
+// aggregates.
+func compileProject(q *query, rel *relation) (bigslice.Slice, error) {
+	var (
+		vals = make([]value, len(q.items))
+		out  = make([]reflect.Type, len(q.items))
+		cols []int
+	)
+	for i, item := range q.items {
+		var err error
+		if vals[i], err = compileExpr(item.expr, rowEnv{rel, "SELECT"}); err != nil {
+			return nil, err
+		}
+		out[i] = vals[i].typ
+		if ref, ok := item.expr.(*colRef); ok {
+			col, _ := rel.resolve(ref)
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == len(q.items) {
+		// The query selects only columns, which need not be evaluated.
+		return bigslice.SelectColumns(rel.slice, cols...), nil
+	}
+	fn := makeFunc(rel.types(), out, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, len(vals))
+		for i := range vals {
+			results[i] = vals[i].eval(args)
+		}
+		return results
+	})
+	return bigslice.Map(rel.slice, fn), nil
+}
+
+// An aggregate is an aggregate function of a query, which is computed
+// by merging states of the type of a field (or fields) of the query's
+// aggregate state struct.
+type aggregate struct {
+	fn string
+	// arg is the function's argument, if any.
+	arg value
+	// field is the index of the aggregate's (first) state field.
+	field int
+}
+
+// compileAggregate compiles the select list of a query with aggregates
+// or a GROUP BY clause.
+func compileAggregate(q *query, rel *relation) (bigslice.Slice, error) {
+	env := &groupEnv{rel: rel}
+	for _, e := range q.groupBy {
+		ref, ok := e.(*colRef)
+		if !ok {
+			return nil, fmt.Errorf("GROUP BY expression %s is not a column", e)
+		}
+		col, err := rel.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		if typ := rel.slice.Out(col); !frame.CanHash(typ) || !frame.CanCompare(typ) {
+			return nil, fmt.Errorf("cannot GROUP BY column %s of type %s", ref, typ)
+		}
+		env.keys = append(env.keys, col)
+	}
+	var keyTypes []reflect.Type
+	for _, col := range env.keys {
+		keyTypes = append(keyTypes, rel.slice.Out(col))
+	}
+	if len(keyTypes) == 0 {
+		// Aggregate all rows under a single, constant key.
+		keyTypes = []reflect.Type{typeOfInt64}
+	}
+	env.state = len(keyTypes)
+	var (
+		vals = make([]value, len(q.items))
+		out  = make([]reflect.Type, len(q.items))
+	)
+	for i, item := range q.items {
+		var err error
+		if vals[i], err = compileExpr(item.expr, env); err != nil {
+			return nil, err
+		}
+		out[i] = vals[i].typ
+	}
+	if len(env.fields) == 0 {
+		// Queries that only group by keys still need a state column to
+		// reduce, and gob cannot encode structs without fields.
+		env.fields = append(env.fields, reflect.StructField{Name: "F0", Type: typeOfInt64})
+	}
+	stateType := reflect.StructOf(env.fields)
+
+	// Emit the key columns and initial aggregate states of each row.
+	initOut := append(append([]reflect.Type(nil), keyTypes...), stateType)
+	initFn := makeFunc(rel.types(), initOut, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, 0, len(initOut))
+		for _, col := range env.keys {
+			results = append(results, args[col])
+		}
+		if len(env.keys) == 0 {
+			results = append(results, reflect.ValueOf(int64(0)))
+		}
+		state := reflect.New(stateType).Elem()
+		for _, agg := range env.aggs {
+			agg.init(state, args)
+		}
+		return append(results, state)
+	})
+	slice := bigslice.Map(rel.slice, initFn)
+	if len(keyTypes) > 1 {
+		slice = bigslice.Prefixed(slice, len(keyTypes))
+	}
+
+	// Merge the states of each key.
+	mergeFn := makeFunc([]reflect.Type{stateType, stateType}, []reflect.Type{stateType}, func(args []reflect.Value) []reflect.Value {
+		state := reflect.New(stateType).Elem()
+		for _, agg := range env.aggs {
+			agg.merge(state, args[0], args[1])
+		}
+		return []reflect.Value{state}
+	})
+	slice = bigslice.Reduce(slice, mergeFn)
+
+	// Compute the select list from the keys and merged states.
+	selectFn := makeFunc(initOut, out, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, len(vals))
+		for i := range vals {
+			results[i] = vals[i].eval(args)
+		}
+		return results
+	})
+	return bigslice.Map(slice, selectFn), nil
+}
+
+// init sets the aggregate's fields of state to their initial values
+// for a row.
+func (a *aggregate) init(state reflect.Value, row []reflect.Value) {
+	switch a.fn {
+	case "COUNT":
+		state.Field(a.field).SetInt(1)
+	case "SUM":
+		if v := a.arg.eval(row); class(a.arg.typ) == classFloat {
+			state.Field(a.field).SetFloat(toFloat64(v))
+		} else {
+			state.Field(a.field).SetInt(toInt64(v))
+		}
+	case "MIN", "MAX":
+		state.Field(a.field).Set(a.arg.eval(row))
+	case "AVG":
+		state.Field(a.field).SetFloat(toFloat64(a.arg.eval(row)))
+		state.Field(a.field + 1).SetInt(1)
+	}
+}
+
+// merge sets the aggregate's fields of state to the merge of those of
+// states x and y.
+func (a *aggregate) merge(state, x, y reflect.Value) {
+	f, xf, yf := state.Field(a.field), x.Field(a.field), y.Field(a.field)
+	switch a.fn {
+	case "COUNT":
+		f.SetInt(xf.Int() + yf.Int())
+	case "SUM":
+		if f.Kind() == reflect.Float64 {
+			f.SetFloat(xf.Float() + yf.Float())
+		} else {
+			f.SetInt(xf.Int() + yf.Int())
+		}
+	case "MIN", "MAX":
+		less := compare(xf, yf) < 0
+		if less == (a.fn == "MIN") {
+			f.Set(xf)
+		} else {
+			f.Set(yf)
+		}
+	case "AVG":
+		f.SetFloat(xf.Float() + yf.Float())
+		n := a.field + 1
+		state.Field(n).SetInt(x.Field(n).Int() + y.Field(n).Int())
+	}
+}
+
+// result returns the aggregate's value for a merged state.
+func (a *aggregate) result(state reflect.Value) reflect.Value {
+	if a.fn == "AVG" {
+		return reflect.ValueOf(state.Field(a.field).Float() / float64(state.Field(a.field+1).Int()))
+	}
+	return state.Field(a.field)
+}
+
+// A value is a compiled expression.
+type value struct {
+	// typ is the type of the expression's values.
+	typ reflect.Type
+	// eval evaluates the expression for a row.
+	eval func(row []reflect.Value) reflect.Value
+}
+
+// An env resolves the column references and aggregate functions of
+// expressions.
+type env interface {
+	column(ref *colRef) (value, error)
+	aggregate(c *call) (value, error)
+}
+
+// RowEnv resolves column references to the columns of a relation, and
+// does not permit aggregate functions.
+type rowEnv struct {
+	rel *relation
+	// clause is the clause in which expressions are compiled, for error
+	// messages.
+	clause string
+}
+
+func (e rowEnv) column(ref *colRef) (value, error) {
+	col, err := e.rel.resolve(ref)
+	if err != nil {
+		return value{}, err
+	}
+	return value{e.rel.slice.Out(col), func(row []reflect.Value) reflect.Value { return row[col] }}, nil
+}
+
+func (e rowEnv) aggregate(c *call) (value, error) {
+	return value{}, fmt.Errorf("aggregate function %s is not permitted in %s", c, e.clause)
+}
+
+// GroupEnv resolves column references to the GROUP BY key columns of
+// aggregated rows, and aggregate functions to the aggregates' states.
+// Aggregated rows comprise the key columns followed by a state struct.
+type groupEnv struct {
+	rel *relation
+	// keys are the columns of rel that are grouped by.
+	keys []int
+	// state is the index of the state struct in aggregated rows.
+	state  int
+	aggs   []*aggregate
+	fields []reflect.StructField
+}
+
+func (e *groupEnv) column(ref *colRef) (value, error) {
+	col, err := e.rel.resolve(ref)
+	if err != nil {
+		return value{}, err
+	}
+	for i, key := range e.keys {
+		if key == col {
+			return value{e.rel.slice.Out(col), func(row []reflect.Value) reflect.Value { return row[i] }}, nil
+		}
+	}
+	return value{}, fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate function", ref)
+}
+
+func (e *groupEnv) aggregate(c *call) (value, error) {
+	agg := &aggregate{fn: c.fn, field: len(e.fields)}
+	if c.arg == nil {
+		if c.fn != "COUNT" {
+			return value{}, fmt.Errorf("%s requires an argument", c.fn)
+		}
+	} else {
+		var err error
+		if agg.arg, err = compileExpr(c.arg, rowEnv{e.rel, c.fn}); err != nil {
+			return value{}, err
+		}
+	}
+	var types []reflect.Type
+	switch c.fn {
+	case "COUNT":
+		types = []reflect.Type{typeOfInt64}
+	case "SUM":
+		switch class(agg.arg.typ) {
+		case classInt:
+			types = []reflect.Type{typeOfInt64}
+		case classFloat:
+			types = []reflect.Type{typeOfFloat64}
+		}
+	case "MIN", "MAX":
+		if cl := class(agg.arg.typ); cl == classInt || cl == classFloat || cl == classString {
+			types = []reflect.Type{agg.arg.typ}
+		}
+	case "AVG":
+		if cl := class(agg.arg.typ); cl == classInt || cl == classFloat {
+			types = []reflect.Type{typeOfFloat64, typeOfInt64}
+		}
+	default:
+		return value{}, fmt.Errorf("unknown function %s", c.fn)
+	}
+	if types == nil {
+		return value{}, fmt.Errorf("%s cannot be applied to %s of type %s", c.fn, c.arg, agg.arg.typ)
+	}
+	for _, typ := range types {
+		e.fields = append(e.fields, reflect.StructField{Name: fmt.Sprintf("F%d", len(e.fields)), Type: typ})
+	}
+	e.aggs = append(e.aggs, agg)
+	state := e.state
+	// The type of each aggregate's result is that of its first field.
+	return value{types[0], func(row []reflect.Value) reflect.Value { return agg.result(row[state]) }}, nil
+}
+
+// hasAggregate tells whether expression e applies an aggregate
+// function.
+func hasAggregate(e expr) bool {
+	switch e := e.(type) {
+	case *call:
+		return true
+	case *unaryExpr:
+		return hasAggregate(e.x)
+	case *binaryExpr:
+		return hasAggregate(e.x) || hasAggregate(e.y)
+	}
+	return false
+}
+
+// Classes of types, by which operators are typechecked.
+const (
+	classOther = iota
+	classInt
+	classFloat
+	classString
+	classBool
+)
+
+func class(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return classInt
+	case reflect.Float32, reflect.Float64:
+		return classFloat
+	case reflect.String:
+		return classString
+	case reflect.Bool:
+		return classBool
+	}
+	return classOther
+}
+
+func toInt64(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+func toFloat64(v reflect.Value) float64 {
+	switch class(v.Type()) {
+	case classInt:
+		return float64(toInt64(v))
+	}
+	return v.Float()
+}
+
+// compare compares values x and y, which are of the same class, and
+// returns -1, 0, or +1 as x is less than, equal to, or greater than y.
+// Integers are compared as floating point numbers if either value is a
+// floating point number.
+func compare(x, y reflect.Value) int {
+	cx, cy := class(x.Type()), class(y.Type())
+	switch {
+	case cx == classFloat || cy == classFloat:
+		a, b := toFloat64(x), toFloat64(y)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case cx == classInt:
+		a, b := toInt64(x), toInt64(y)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case cx == classString:
+		a, b := x.String(), y.String()
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case cx == classBool:
+		a, b := x.Bool(), y.Bool()
+		switch {
+		case !a && b:
+			return -1
+		case a && !b:
+			return 1
+		}
+	}
+	return 0
+}
+
+// compileExpr compiles expression e, whose column references and
+// aggregates are resolved by env.
+func compileExpr(e expr, env env) (value, error) {
+	switch e := e.(type) {
+	case *colRef:
+		return env.column(e)
+	case *call:
+		return env.aggregate(e)
+	case *literal:
+		v := reflect.ValueOf(e.value)
+		return value{v.Type(), func([]reflect.Value) reflect.Value { return v }}, nil
+	case *unaryExpr:
+		x, err := compileExpr(e.x, env)
+		if err != nil {
+			return value{}, err
+		}
+		switch cl := class(x.typ); {
+		case e.op == "NOT" && cl == classBool:
+			return value{typeOfBool, func(row []reflect.Value) reflect.Value {
+				return reflect.ValueOf(!x.eval(row).Bool())
+			}}, nil
+		case e.op == "-" && cl == classInt:
+			return value{typeOfInt64, func(row []reflect.Value) reflect.Value {
+				return reflect.ValueOf(-toInt64(x.eval(row)))
+			}}, nil
+		case e.op == "-" && cl == classFloat:
+			return value{typeOfFloat64, func(row []reflect.Value) reflect.Value {
+				return reflect.ValueOf(-toFloat64(x.eval(row)))
+			}}, nil
+		}
+		return value{}, fmt.Errorf("operator %s cannot be applied to %s of type %s", e.op, e.x, x.typ)
+	case *binaryExpr:
+		x, err := compileExpr(e.x, env)
+		if err != nil {
+			return value{}, err
+		}
+		y, err := compileExpr(e.y, env)
+		if err != nil {
+			return value{}, err
+		}
+		return compileBinary(e, x, y)
+	}
+	panic(fmt.Sprintf("slicesql: unknown expression %T", e))
+}
+
+func compileBinary(e *binaryExpr, x, y value) (value, error) {
+	var (
+		cx, cy  = class(x.typ), class(y.typ)
+		numeric = (cx == classInt || cx == classFloat) && (cy == classInt || cy == classFloat)
+		float   = cx == classFloat || cy == classFloat
+	)
+	switch e.op {
+	case "AND", "OR":
+		if cx != classBool || cy != classBool {
+			break
+		}
+		and := e.op == "AND"
+		return value{typeOfBool, func(row []reflect.Value) reflect.Value {
+			if x.eval(row).Bool() != and {
+				return reflect.ValueOf(!and)
+			}
+			return y.eval(row)
+		}}, nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		if !numeric && (cx != cy || cx == classOther || cx == classBool && e.op != "=" && e.op != "<>") {
+			break
+		}
+		var test func(int) bool
+		switch e.op {
+		case "=":
+			test = func(c int) bool { return c == 0 }
+		case "<>":
+			test = func(c int) bool { return c != 0 }
+		case "<":
+			test = func(c int) bool { return c < 0 }
+		case "<=":
+			test = func(c int) bool { return c <= 0 }
+		case ">":
+			test = func(c int) bool { return c > 0 }
+		case ">=":
+			test = func(c int) bool { return c >= 0 }
+		}
+		return value{typeOfBool, func(row []reflect.Value) reflect.Value {
+			return reflect.ValueOf(test(compare(x.eval(row), y.eval(row))))
+		}}, nil
+	case "/":
+		if !numeric {
+			break
+		}
+		return value{typeOfFloat64, func(row []reflect.Value) reflect.Value {
+			return reflect.ValueOf(toFloat64(x.eval(row)) / toFloat64(y.eval(row)))
+		}}, nil
+	case "+", "-", "*":
+		if !numeric {
+			break
+		}
+		op := e.op
+		if float {
+			return value{typeOfFloat64, func(row []reflect.Value) reflect.Value {
+				a, b := toFloat64(x.eval(row)), toFloat64(y.eval(row))
+				switch op {
+				case "+":
+					return reflect.ValueOf(a + b)
+				case "-":
+					return reflect.ValueOf(a - b)
+				}
+				return reflect.ValueOf(a * b)
+			}}, nil
+		}
+		return value{typeOfInt64, func(row []reflect.Value) reflect.Value {
+			a, b := toInt64(x.eval(row)), toInt64(y.eval(row))
+			switch op {
+			case "+":
+				return reflect.ValueOf(a + b)
+			case "-":
+				return reflect.ValueOf(a - b)
+			}
+			return reflect.ValueOf(a * b)
+		}}, nil
+	}
+	return value{}, fmt.Errorf("operator %s cannot be applied to %s of type %s and %s of type %s",
+		e.op, e.x, x.typ, e.y, y.typ)
+}
+
+// makeFunc returns a function of the provided argument and result
+// types that is implemented by fn.
+func makeFunc(in, out []reflect.Type, fn func(args []reflect.Value) []reflect.Value) interface{} {
+	return reflect.MakeFunc(reflect.FuncOf(in, out, false), fn).Interface()
+}
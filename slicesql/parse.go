@@ -0,0 +1,456 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicesql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A query is a parsed SELECT statement.
+type query struct {
+	// star is true if the query selects all columns ("SELECT *").
+	star    bool
+	items   []selectItem
+	from    tableRef
+	joins   []join
+	where   expr
+	groupBy []expr
+	// limit is the query's LIMIT, or 0 if it has none.
+	limit int
+}
+
+// A selectItem is an expression of a query's select list.
+type selectItem struct {
+	expr expr
+	// alias is the name given to the item by AS, if any.
+	alias string
+}
+
+// A tableRef refers to a registered table, optionally by an alias.
+type tableRef struct {
+	table, alias string
+}
+
+// Name returns the name by which the table's columns are qualified.
+func (t tableRef) name() string {
+	if t.alias != "" {
+		return t.alias
+	}
+	return t.table
+}
+
+// A join is a JOIN clause of a query.
+type join struct {
+	table tableRef
+	on    expr
+}
+
+// An expr is an expression: one of *colRef, *literal, *unaryExpr,
+// *binaryExpr, and *call.
+type expr interface {
+	String() string
+}
+
+// A colRef refers to a column, optionally qualified by its table.
+type colRef struct {
+	table, column string
+}
+
+func (c *colRef) String() string {
+	if c.table != "" {
+		return c.table + "." + c.column
+	}
+	return c.column
+}
+
+// A literal is a constant of type int64, float64, string, or bool.
+type literal struct {
+	value interface{}
+}
+
+func (l *literal) String() string {
+	if s, ok := l.value.(string); ok {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return fmt.Sprint(l.value)
+}
+
+// A unaryExpr is the application of NOT or - to an expression.
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (u *unaryExpr) String() string {
+	if u.op == "NOT" {
+		return "NOT " + u.x.String()
+	}
+	return u.op + u.x.String()
+}
+
+// A binaryExpr is the application of a binary operator: one of AND,
+// OR, =, <>, <, <=, >, >=, +, -, *, and /.
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (b *binaryExpr) String() string {
+	return "(" + b.x.String() + " " + b.op + " " + b.y.String() + ")"
+}
+
+// A call is the application of an aggregate function.
+type call struct {
+	// fn is the upper-cased name of the function.
+	fn string
+	// arg is the function's argument, or nil for "*".
+	arg expr
+}
+
+func (c *call) String() string {
+	if c.arg == nil {
+		return c.fn + "(*)"
+	}
+	return c.fn + "(" + c.arg.String() + ")"
+}
+
+// Token kinds.
+const (
+	tokEOF = iota
+	tokIdent
+	tokKeyword
+	tokInt
+	tokFloat
+	tokString
+	tokOp
+)
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"JOIN": true, "INNER": true, "ON": true, "AS": true, "AND": true,
+	"OR": true, "NOT": true, "LIMIT": true, "TRUE": true, "FALSE": true,
+}
+
+type token struct {
+	kind int
+	// text is the token's text; keywords are upper-cased, and strings
+	// are unquoted.
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return "'" + t.text + "'"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lex splits the query into tokens.
+func lex(q string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(q); {
+		c := rune(q[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(q) && (q[j] == '_' || unicode.IsLetter(rune(q[j])) || unicode.IsDigit(rune(q[j]))) {
+				j++
+			}
+			text := q[i:j]
+			if upper := strings.ToUpper(text); keywords[upper] {
+				toks = append(toks, token{tokKeyword, upper, i})
+			} else {
+				toks = append(toks, token{tokIdent, text, i})
+			}
+			i = j
+		case unicode.IsDigit(c):
+			j, kind := i, tokInt
+			for j < len(q) && (unicode.IsDigit(rune(q[j])) || q[j] == '.') {
+				if q[j] == '.' {
+					kind = tokFloat
+				}
+				j++
+			}
+			toks = append(toks, token{kind, q[i:j], i})
+			i = j
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j == len(q) {
+					return nil, fmt.Errorf("unterminated string at offset %d", i)
+				}
+				if q[j] == '\'' {
+					if j+1 < len(q) && q[j+1] == '\'' {
+						b.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(q[j])
+			}
+			toks = append(toks, token{tokString, b.String(), i})
+			i = j + 1
+		default:
+			op := q[i : i+1]
+			if i+1 < len(q) {
+				switch two := q[i : i+2]; two {
+				case "<>", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			if !strings.Contains("<>!=,.()*+-/;", op[:1]) || op == "!" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			if op == "!=" {
+				op = "<>"
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(q)}), nil
+}
+
+// A parser is a recursive descent parser of queries. Parse errors are
+// raised as panics of type parseError, and are recovered by parse.
+type parser struct {
+	toks []token
+}
+
+type parseError struct{ error }
+
+// parse parses a query.
+func parse(q string) (parsed *query, err error) {
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	defer func() {
+		if e := recover(); e != nil {
+			perr, ok := e.(parseError)
+			if !ok {
+				panic(e)
+			}
+			parsed, err = nil, perr.error
+		}
+	}()
+	parsed = p.query()
+	p.accept(tokOp, ";")
+	if p.peek().kind != tokEOF {
+		p.errorf("unexpected %s", p.peek())
+	}
+	return parsed, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	panic(parseError{fmt.Errorf("at offset %d: %s", p.peek().pos, fmt.Sprintf(format, args...))})
+}
+
+func (p *parser) peek() token {
+	return p.toks[0]
+}
+
+func (p *parser) next() token {
+	t := p.toks[0]
+	if t.kind != tokEOF {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+// accept consumes the next token if it is of the provided kind and
+// text, and reports whether it did.
+func (p *parser) accept(kind int, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind int, text string) {
+	if !p.accept(kind, text) {
+		p.errorf("expected %q, got %s", text, p.peek())
+	}
+}
+
+func (p *parser) ident() string {
+	t := p.next()
+	if t.kind != tokIdent {
+		p.toks = append([]token{t}, p.toks...)
+		p.errorf("expected identifier, got %s", t)
+	}
+	return t.text
+}
+
+func (p *parser) query() *query {
+	q := new(query)
+	p.expect(tokKeyword, "SELECT")
+	if p.accept(tokOp, "*") {
+		q.star = true
+	} else {
+		for {
+			item := selectItem{expr: p.expr()}
+			if p.accept(tokKeyword, "AS") || p.peek().kind == tokIdent {
+				item.alias = p.ident()
+			}
+			q.items = append(q.items, item)
+			if !p.accept(tokOp, ",") {
+				break
+			}
+		}
+	}
+	p.expect(tokKeyword, "FROM")
+	q.from = p.tableRef()
+	for {
+		inner := p.accept(tokKeyword, "INNER")
+		if !p.accept(tokKeyword, "JOIN") {
+			if inner {
+				p.errorf("expected JOIN, got %s", p.peek())
+			}
+			break
+		}
+		j := join{table: p.tableRef()}
+		p.expect(tokKeyword, "ON")
+		j.on = p.expr()
+		q.joins = append(q.joins, j)
+	}
+	if p.accept(tokKeyword, "WHERE") {
+		q.where = p.expr()
+	}
+	if p.accept(tokKeyword, "GROUP") {
+		p.expect(tokKeyword, "BY")
+		for {
+			q.groupBy = append(q.groupBy, p.expr())
+			if !p.accept(tokOp, ",") {
+				break
+			}
+		}
+	}
+	if p.accept(tokKeyword, "LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokInt || err != nil || n <= 0 {
+			p.errorf("invalid limit %s", t)
+		}
+		q.limit = n
+	}
+	return q
+}
+
+func (p *parser) tableRef() tableRef {
+	t := tableRef{table: p.ident()}
+	if p.accept(tokKeyword, "AS") || p.peek().kind == tokIdent {
+		t.alias = p.ident()
+	}
+	return t
+}
+
+// Binary operators, by increasing precedence.
+var precedence = [][]string{
+	{"OR"},
+	{"AND"},
+	{"=", "<>", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *parser) expr() expr {
+	return p.binary(0)
+}
+
+func (p *parser) binary(level int) expr {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	if level == 2 && p.accept(tokKeyword, "NOT") {
+		// NOT binds more loosely than comparisons, but more tightly
+		// than AND.
+		return &unaryExpr{"NOT", p.binary(level)}
+	}
+	x := p.binary(level + 1)
+	for {
+		t := p.peek()
+		var op string
+		for _, o := range precedence[level] {
+			if (t.kind == tokOp || t.kind == tokKeyword) && t.text == o {
+				op = o
+			}
+		}
+		if op == "" {
+			return x
+		}
+		p.next()
+		x = &binaryExpr{op, x, p.binary(level + 1)}
+	}
+}
+
+func (p *parser) unary() expr {
+	if p.accept(tokOp, "-") {
+		return &unaryExpr{"-", p.unary()}
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			p.errorf("invalid integer %s", t)
+		}
+		return &literal{v}
+	case tokFloat:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.errorf("invalid number %s", t)
+		}
+		return &literal{v}
+	case tokString:
+		return &literal{t.text}
+	case tokKeyword:
+		switch t.text {
+		case "TRUE":
+			return &literal{true}
+		case "FALSE":
+			return &literal{false}
+		}
+	case tokOp:
+		if t.text == "(" {
+			x := p.expr()
+			p.expect(tokOp, ")")
+			return x
+		}
+	case tokIdent:
+		if p.accept(tokOp, "(") {
+			c := &call{fn: strings.ToUpper(t.text)}
+			if !p.accept(tokOp, "*") {
+				c.arg = p.expr()
+			}
+			p.expect(tokOp, ")")
+			return c
+		}
+		if p.accept(tokOp, ".") {
+			return &colRef{t.text, p.ident()}
+		}
+		return &colRef{"", t.text}
+	}
+	p.toks = append([]token{t}, p.toks...)
+	p.errorf("unexpected %s", t)
+	panic("not reached")
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicesql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{"a + b * c - 1", "((a + (b * c)) - 1)"},
+		{"a = 1 OR b <> 2 AND NOT c >= 3", "((a = 1) OR ((b <> 2) AND NOT (c >= 3)))"},
+		{"-(a + t.b) / 2.5", "(-(a + t.b) / 2.5)"},
+		{"x != 'it''s'", "(x <> 'it''s')"},
+		{"count(*) + Sum(x)", "(COUNT(*) + SUM(x))"},
+		{"true AND FALSE", "(true AND false)"},
+	} {
+		q, err := parse("SELECT " + test.expr + " FROM t")
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got, want := q.items[0].expr.String(), test.want; got != want {
+			t.Errorf("%s: got %v, want %v", test.expr, got, want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := parse(`select a.x AS y, b.z w from t1 a inner join t2 as b on a.x = b.x
+		join t3 ON x = v where y > 1 group by a.x, w limit 5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(q.items), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := q.items[0].alias, "y"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := q.items[1].alias, "w"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := q.from, (tableRef{"t1", "a"}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(q.joins), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := q.joins[1].table.name(), "t3"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := q.joins[0].on.String(), "(a.x = b.x)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(q.groupBy), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := q.limit, 5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range []struct {
+		query, err string
+	}{
+		{"SELECT a FROM t WHERE 'x", "unterminated string"},
+		{"SELECT a FROM t WHERE a ! b", "unexpected character '!'"},
+		{"SELECT FROM t", `at offset 7: unexpected "FROM"`},
+		{"SELECT a t", `expected "FROM", got end of query`},
+		{"SELECT a FROM t INNER t2", `expected JOIN, got "t2"`},
+		{"SELECT a FROM t WHERE (a = 1", `expected ")", got end of query`},
+		{"SELECT a FROM t extra stuff", `unexpected "stuff"`},
+	} {
+		_, err := parse(test.query)
+		if err == nil {
+			t.Errorf("%s: expected error", test.query)
+			continue
+		}
+		if got, want := err.Error(), test.err; !strings.Contains(got, want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package slicesql implements a SQL query layer over bigslice. Slices
+// are registered as named tables of a DB, and queries over the tables
+// are compiled into slices that compute their results with bigslice's
+// operators: for example, WHERE clauses are compiled into Filters,
+// JOINs into Joins, and GROUP BY clauses into Reduces, so that queries
+// are evaluated with bigslice's usual shuffling, combining, and
+// pipelining.
+//
+// Queries are compiled in the same manner as other slices, and thus
+// must be compiled within a bigslice.Func:
+//
+//	var countsByCountry = bigslice.Func(func(path string) bigslice.Slice {
+//		db := slicesql.New()
+//		db.Register("users", readUsers(path), "id", "name", "country")
+//		db.Register("orders", readOrders(path), "user_id", "amount")
+//		return db.MustQuery(`
+//			SELECT u.country, COUNT(*) AS orders, SUM(o.amount) AS total
+//			FROM users u JOIN orders o ON u.id = o.user_id
+//			WHERE o.amount > 0
+//			GROUP BY u.country`)
+//	})
+//
+// The columns of the returned slice are named by the query (see
+// bigslice.NameColumns), by their aliases, if any, or by the names of
+// the columns that they select, and the slice has a prefix of 1.
+//
+// The supported dialect is a subset of SQL:
+//
+//	SELECT (* | expr [[AS] name], ...)
+//	FROM table [[AS] alias]
+//	[[INNER] JOIN table [[AS] alias] ON col = col [AND col = col ...] ...]
+//	[WHERE expr]
+//	[GROUP BY col, ...]
+//	[LIMIT n]
+//
+// Expressions comprise column references, which may be qualified by
+// their tables, e.g., "u.id"; integer, floating point, string ('...'),
+// and boolean (TRUE, FALSE) literals; the arithmetic operators +, -,
+// *, and /; the comparison operators =, <> (or !=), <, <=, >, and >=;
+// the logical operators AND, OR, and NOT; and the aggregate functions
+// COUNT(*), COUNT(expr), SUM(expr), MIN(expr), MAX(expr), and
+// AVG(expr). Expressions operate on columns of Go's basic kinds
+// (integers, floating point numbers, strings, and booleans); columns of
+// other types may be selected, grouped by, and joined on, but not
+// otherwise used in expressions. Integer arithmetic is performed with
+// int64s, and arithmetic that involves floating point numbers with
+// float64s; division always yields a float64. Queries with aggregate functions but without GROUP BY
+// aggregate all rows into one, or return no rows if there are none.
+//
+// Since bigslice slices do not carry nulls through user functions,
+// columns are never null in expressions: COUNT(expr) counts all rows,
+// as COUNT(*) does. Joins are inner joins, whose keys must be of
+// identical types, and the result of a query is unordered: ORDER BY is
+// not supported.
+package slicesql
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// A DB is a set of named tables, each of which is a slice whose
+// columns are named. A DB is not safe for concurrent use.
+type DB struct {
+	tables map[string]table
+}
+
+// A table is a registered slice.
+type table struct {
+	slice   bigslice.Slice
+	columns []string
+}
+
+// New returns a new, empty DB.
+func New() *DB {
+	return &DB{tables: make(map[string]table)}
+}
+
+// Register registers the provided slice as a table with the provided
+// name, replacing any table of the same name. The table's columns are
+// named by columns, one for each column of the slice. If no names are
+// provided, the columns are named by the slice's column names (see
+// bigslice.NameColumns), and all of the slice's columns must be named.
+// Column names must be unique.
+func (db *DB) Register(name string, slice bigslice.Slice, columns ...string) error {
+	if len(columns) == 0 {
+		columns = make([]string, slice.NumOut())
+		for i := range columns {
+			if columns[i] = slicetype.ColumnName(slice, i); columns[i] == "" {
+				return fmt.Errorf("slicesql: register %s: column %d of slice %s is not named",
+					name, i, slicetype.String(slice))
+			}
+		}
+	}
+	if len(columns) != slice.NumOut() {
+		return fmt.Errorf("slicesql: register %s: got %d column names for slice %s with %d columns",
+			name, len(columns), slicetype.String(slice), slice.NumOut())
+	}
+	seen := make(map[string]bool)
+	for _, col := range columns {
+		if seen[col] {
+			return fmt.Errorf("slicesql: register %s: duplicate column name %q", name, col)
+		}
+		seen[col] = true
+	}
+	db.tables[name] = table{slice, append([]string(nil), columns...)}
+	return nil
+}
+
+// Tables returns the names of the DB's tables, in sorted order.
+func (db *DB) Tables() []string {
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query parses the provided query and compiles it into a slice that
+// computes its results. Query returns an error if the query cannot be
+// parsed or is invalid, e.g., because it refers to tables or columns
+// that do not exist, or applies operators to columns of unsupported
+// types.
+func (db *DB) Query(query string) (bigslice.Slice, error) {
+	bigslice.Helper()
+	q, err := parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("slicesql: %v", err)
+	}
+	slice, err := db.compile(q)
+	if err != nil {
+		return nil, fmt.Errorf("slicesql: %v", err)
+	}
+	return slice, nil
+}
+
+// MustQuery is like Query, but panics if the query cannot be compiled.
+func (db *DB) MustQuery(query string) bigslice.Slice {
+	bigslice.Helper()
+	slice, err := db.Query(query)
+	if err != nil {
+		panic(err)
+	}
+	return slice
+}
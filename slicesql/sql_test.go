@@ -0,0 +1,200 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicesql_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicesql"
+	"github.com/grailbio/bigslice/slicetest"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func testDB(t *testing.T) *slicesql.DB {
+	t.Helper()
+	db := slicesql.New()
+	users := bigslice.Const(2,
+		[]int{1, 2, 3, 4},
+		[]string{"ann", "bob", "cat", "dan"},
+		[]string{"us", "us", "fr", "de"},
+		[]int32{31, 25, 47, 30},
+	)
+	if err := db.Register("users", users, "id", "name", "country", "age"); err != nil {
+		t.Fatal(err)
+	}
+	orders := bigslice.Const(3,
+		[]int{1, 1, 2, 3, 3, 3, 5},
+		[]float64{10, 20, 5, 1, 2, 3, 100},
+	)
+	orders = bigslice.NameColumns(orders, "user_id", "amount")
+	if err := db.Register("orders", orders); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// rows runs the provided slice and returns its rows, formatted with
+// fmt.Sprint and separated by spaces, in sorted order.
+func rows(t *testing.T, slice bigslice.Slice) []string {
+	t.Helper()
+	scan := slicetest.Run(t, slice)
+	defer scan.Close()
+	var (
+		ctx  = context.Background()
+		ptrs = make([]interface{}, slice.NumOut())
+		vals = make([]string, slice.NumOut())
+		rows []string
+	)
+	for i := range ptrs {
+		ptrs[i] = reflect.New(slice.Out(i)).Interface()
+	}
+	for scan.Scan(ctx, ptrs...) {
+		for i := range ptrs {
+			vals[i] = fmt.Sprint(reflect.ValueOf(ptrs[i]).Elem().Interface())
+		}
+		rows = append(rows, strings.Join(vals, " "))
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+func TestQuery(t *testing.T) {
+	db := testDB(t)
+	for _, test := range []struct {
+		query string
+		names []string
+		rows  []string
+	}{
+		{
+			"SELECT * FROM users WHERE age >= 30 AND NOT country = 'fr'",
+			[]string{"id", "name", "country", "age"},
+			[]string{"1 ann us 31", "4 dan de 30"},
+		},
+		{
+			"select name, age + 1 as next, age / 2 half from users where id < 3 or name = 'cat'",
+			[]string{"name", "next", "half"},
+			[]string{"ann 32 15.5", "bob 26 12.5", "cat 48 23.5"},
+		},
+		{
+			"SELECT u.name, o.amount FROM users AS u JOIN orders o ON o.user_id = u.id WHERE o.amount > 2",
+			[]string{"name", "amount"},
+			[]string{"ann 10", "ann 20", "bob 5", "cat 3"},
+		},
+		{
+			"SELECT * FROM users u JOIN orders o ON u.id = o.user_id WHERE u.id = 2",
+			[]string{"id", "name", "country", "age", "amount"},
+			[]string{"2 bob us 25 5"},
+		},
+		{
+			`SELECT country, COUNT(*) AS n, SUM(amount) total, MIN(amount), MAX(name), AVG(amount * 2) AS avg2
+			FROM users JOIN orders ON id = user_id
+			GROUP BY country`,
+			[]string{"country", "n", "total", "MIN(amount)", "MAX(name)", "avg2"},
+			[]string{"fr 3 6 1 cat 4", "us 3 35 5 bob 23.333333333333332"},
+		},
+		{
+			"SELECT COUNT(*), SUM(age), MAX(age) - MIN(age) AS spread FROM users",
+			[]string{"COUNT(*)", "SUM(age)", "spread"},
+			[]string{"4 133 22"},
+		},
+		{
+			"SELECT country, age FROM users GROUP BY country, age LIMIT 10;",
+			[]string{"country", "age"},
+			[]string{"de 30", "fr 47", "us 25", "us 31"},
+		},
+		{
+			"SELECT COUNT(*) FROM users WHERE age > 100",
+			[]string{"COUNT(*)"},
+			nil,
+		},
+	} {
+		slice, err := db.Query(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var names []string
+		for i := 0; i < slice.NumOut(); i++ {
+			names = append(names, slicetype.ColumnName(slice, i))
+		}
+		if got, want := names, test.names; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, want)
+		}
+		if got, want := rows(t, slice), test.rows; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", test.query, got, want)
+		}
+	}
+}
+
+func TestQueryTypes(t *testing.T) {
+	db := testDB(t)
+	slice := db.MustQuery("SELECT id, age, age * 2, SUM(age) FROM users GROUP BY id, age")
+	want := slicetype.New(reflect.TypeOf(0), reflect.TypeOf(int32(0)), reflect.TypeOf(int64(0)), reflect.TypeOf(int64(0)))
+	if got, want := slicetype.String(slice), slicetype.String(want); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	db := testDB(t)
+	for _, test := range []struct {
+		query, err string
+	}{
+		{"SELECT name FROM nope", "no table named nope"},
+		{"SELECT nope FROM users", "no column named nope"},
+		{"SELECT id FROM users JOIN orders o ON id = user_id JOIN users ON id = o.user_id", "duplicate table name users"},
+		{"SELECT x.id FROM users x JOIN users y ON x.id = y.id WHERE name = 'ann'", "column reference name is ambiguous"},
+		{"SELECT name FROM users JOIN orders ON name = user_id", "compares columns of different types string and int"},
+		{"SELECT name FROM users JOIN orders ON id < user_id", "is not an equality of columns"},
+		{"SELECT name FROM users WHERE age", "WHERE clause age is not boolean"},
+		{"SELECT name FROM users WHERE name > 1", "operator > cannot be applied to name of type string and 1 of type int64"},
+		{"SELECT name FROM users WHERE COUNT(*) > 1", "aggregate function COUNT(*) is not permitted in WHERE"},
+		{"SELECT name, COUNT(*) FROM users", "column name must appear in GROUP BY"},
+		{"SELECT SUM(name) FROM users", "SUM cannot be applied to name of type string"},
+		{"SELECT MEDIAN(age) FROM users", "unknown function MEDIAN"},
+		{"SELECT * FROM users GROUP BY country", "SELECT * cannot be used with GROUP BY"},
+		{"SELECT name, country AS name FROM users", "duplicate output column name name"},
+		{"SELECT name FROM users WHERE", "unexpected end of query"},
+		{"SELECT name FROM users LIMIT 0", "invalid limit"},
+	} {
+		_, err := db.Query(test.query)
+		if err == nil {
+			t.Errorf("%s: expected error", test.query)
+			continue
+		}
+		if got, want := err.Error(), test.err; !strings.Contains(got, want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, want)
+		}
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	db := slicesql.New()
+	slice := bigslice.Const(1, []int{1}, []string{"a"})
+	if err := db.Register("t", slice); err == nil || !strings.Contains(err.Error(), "column 0 of slice slice[1]int,string is not named") {
+		t.Errorf("got %v", err)
+	}
+	if err := db.Register("t", slice, "a", "a"); err == nil || !strings.Contains(err.Error(), `duplicate column name "a"`) {
+		t.Errorf("got %v", err)
+	}
+	if err := db.Register("t", slice, "a"); err == nil {
+		t.Error("expected error")
+	}
+	if err := db.Register("t", slice, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := db.Tables(), []string{"t"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+)
+
+func init() {
+	gob.Register(CountMin{})
+}
+
+// A CountMin is a count-min sketch, as described by Cormode and
+// Muthukrishnan, "An Improved Data Stream Summary: The Count-Min
+// Sketch and its Applications". It estimates the frequencies of
+// observations, which are added as 64-bit hashes of their values. A
+// sketch of width w and depth d overestimates each frequency by at
+// most e/w times the total count, with probability 1-exp(-d); it
+// never underestimates.
+type CountMin struct {
+	// Width is the number of counters in each row; Depth is the number
+	// of rows.
+	Width, Depth int
+	// Total is the total count of the observations.
+	Total int64
+	// Counts holds the sketch's counters, row by row.
+	Counts []int64
+}
+
+// NewCountMin returns an empty sketch of the provided width and depth.
+func NewCountMin(width, depth int) *CountMin {
+	if width <= 0 || depth <= 0 {
+		panic(fmt.Sprintf("slicestats: invalid count-min sketch dimensions %dx%d", width, depth))
+	}
+	return &CountMin{Width: width, Depth: depth, Counts: make([]int64, width*depth)}
+}
+
+// NewCountMinError returns an empty sketch whose estimates exceed
+// frequencies by at most eps times the total count, with probability
+// at least 1-delta.
+func NewCountMinError(eps, delta float64) *CountMin {
+	return NewCountMin(int(math.Ceil(math.E/eps)), int(math.Ceil(math.Log(1/delta))))
+}
+
+// CountMinOf returns the sketch, of the provided width and depth, of
+// the single observation whose hash is h.
+func CountMinOf(width, depth int, h uint64) CountMin {
+	c := NewCountMin(width, depth)
+	c.Add(h, 1)
+	return *c
+}
+
+// index returns the index of the counter of hash h in the provided
+// row. Rows' hash functions are derived from the two halves of h, as
+// described by Kirsch and Mitzenmacher, "Less Hashing, Same
+// Performance".
+func (c *CountMin) index(row int, h uint64) int {
+	h1, h2 := h&0xffffffff, h>>32
+	return row*c.Width + int((h1+uint64(row)*h2)%uint64(c.Width))
+}
+
+// Add adds n observations whose hash is h to the sketch.
+func (c *CountMin) Add(h uint64, n int64) {
+	c.Total += n
+	for row := 0; row < c.Depth; row++ {
+		c.Counts[c.index(row, h)] += n
+	}
+}
+
+// Count returns the estimated number of observations whose hash is h.
+func (c *CountMin) Count(h uint64) int64 {
+	var min int64 = math.MaxInt64
+	for row := 0; row < c.Depth; row++ {
+		if n := c.Counts[c.index(row, h)]; n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+// MergeFrom adds the observations of sketch d to c, which is modified
+// in place. It panics if the sketches' dimensions differ.
+func (c *CountMin) MergeFrom(d *CountMin) {
+	if c.Width != d.Width || c.Depth != d.Depth {
+		panic(fmt.Sprintf("slicestats: cannot merge count-min sketches of dimensions %dx%d and %dx%d",
+			c.Width, c.Depth, d.Width, d.Depth))
+	}
+	c.Total += d.Total
+	for i, n := range d.Counts {
+		c.Counts[i] += n
+	}
+}
+
+// Merge implements Stat. It panics if the sketches' dimensions differ.
+func (c CountMin) Merge(stat Stat) Stat {
+	d := stat.(CountMin)
+	merged := c
+	merged.Counts = append([]int64(nil), c.Counts...)
+	merged.MergeFrom(&d)
+	return merged
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/grailbio/bigslice/slicestats"
+)
+
+func TestCountMin(t *testing.T) {
+	const N = 100000
+	var (
+		r      = rand.New(rand.NewSource(1))
+		x      = slicestats.NewCountMinError(0.001, 0.01)
+		y      = slicestats.NewCountMinError(0.001, 0.01)
+		hashes = make([]uint64, 100)
+		counts = make([]int64, len(hashes))
+	)
+	for i := range hashes {
+		hashes[i] = r.Uint64()
+	}
+	for i := 0; i < N; i++ {
+		// Half of the observations are of 100 values, each with a
+		// different frequency; the rest are distinct.
+		h := r.Uint64()
+		if i%2 == 0 {
+			j := r.Intn(len(hashes)) * r.Intn(len(hashes)) / len(hashes)
+			h = hashes[j]
+			counts[j]++
+		}
+		if i < N/3 {
+			x.Add(h, 1)
+		} else {
+			y.Add(h, 1)
+		}
+	}
+	merged := x.Merge(*y).(slicestats.CountMin)
+	if got, want := merged.Total, int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i, h := range hashes {
+		if got, want := merged.Count(h), counts[i]; got < want || got > want+N/1000 {
+			t.Errorf("%d: got %v, want %v", i, got, want)
+		}
+	}
+}
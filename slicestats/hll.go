@@ -0,0 +1,196 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+func init() {
+	gob.Register(HyperLogLog{})
+}
+
+// MinPrecision and MaxPrecision bound the precision of a HyperLogLog.
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+)
+
+// A HyperLogLog is a sketch that estimates the number of distinct
+// values in a set of observations, as described by Flajolet et al.,
+// "HyperLogLog: the analysis of a near-optimal cardinality estimation
+// algorithm". Observations are added as 64-bit hashes of the values.
+// A sketch of precision p has 2^p registers, and estimates counts with
+// a relative standard error of about 1.04/sqrt(2^p).
+//
+// Sketches of few observations are kept sparse, as a list of their
+// hashes, so that they are small, and their counts exact, until the
+// list outgrows a fraction of the registers.
+type HyperLogLog struct {
+	// Precision is the base-2 logarithm of the number of registers.
+	Precision int
+	// Registers holds the sketch's registers, or is nil if the sketch
+	// is sparse.
+	Registers []uint8
+	// Hashes holds the hashes of the observations of a sparse sketch.
+	// It may contain duplicates.
+	Hashes []uint64
+}
+
+// NewHyperLogLog returns an empty sketch with the provided precision,
+// which must be between MinPrecision and MaxPrecision.
+func NewHyperLogLog(precision int) *HyperLogLog {
+	if precision < MinPrecision || precision > MaxPrecision {
+		panic(fmt.Sprintf("slicestats: precision %d is not in [%d, %d]", precision, MinPrecision, MaxPrecision))
+	}
+	return &HyperLogLog{Precision: precision}
+}
+
+// HyperLogLogOf returns the sketch, with the provided precision, of the
+// single observation whose hash is h.
+func HyperLogLogOf(precision int, h uint64) HyperLogLog {
+	s := NewHyperLogLog(precision)
+	s.AddHash(h)
+	return *s
+}
+
+// maxSparse returns the number of hashes beyond which a sparse sketch
+// is made dense; a sparse sketch is then at most half the size of a
+// dense one.
+func (s *HyperLogLog) maxSparse() int {
+	return 1 << uint(s.Precision) / 16
+}
+
+// AddHash adds the observation whose hash is h to the sketch.
+func (s *HyperLogLog) AddHash(h uint64) {
+	if s.Registers != nil {
+		s.set(h)
+		return
+	}
+	s.Hashes = append(s.Hashes, h)
+	if len(s.Hashes) <= s.maxSparse() {
+		return
+	}
+	s.compact()
+	if len(s.Hashes) > s.maxSparse() {
+		s.densify()
+	}
+}
+
+// set updates the register of hash h.
+func (s *HyperLogLog) set(h uint64) {
+	p := uint(s.Precision)
+	// The register is chosen by the top p bits of the hash, and updated
+	// with the position of the first 1 bit of the remainder. The set low
+	// bit bounds the position.
+	i := h >> (64 - p)
+	rank := uint8(bits.LeadingZeros64(h<<p|1<<(p-1)) + 1)
+	if rank > s.Registers[i] {
+		s.Registers[i] = rank
+	}
+}
+
+// compact sorts the hashes of a sparse sketch and removes duplicates.
+func (s *HyperLogLog) compact() {
+	sort.Slice(s.Hashes, func(i, j int) bool { return s.Hashes[i] < s.Hashes[j] })
+	var n int
+	for i, h := range s.Hashes {
+		if i == 0 || h != s.Hashes[n-1] {
+			s.Hashes[n] = h
+			n++
+		}
+	}
+	s.Hashes = s.Hashes[:n]
+}
+
+func (s *HyperLogLog) densify() {
+	s.Registers = make([]uint8, 1<<uint(s.Precision))
+	for _, h := range s.Hashes {
+		s.set(h)
+	}
+	s.Hashes = nil
+}
+
+// MergeFrom merges the observations of sketch t into s, which is
+// modified in place. It panics if the sketches' precisions differ.
+func (s *HyperLogLog) MergeFrom(t *HyperLogLog) {
+	if s.Precision != t.Precision {
+		panic(fmt.Sprintf("slicestats: cannot merge sketches of precision %d and %d", s.Precision, t.Precision))
+	}
+	if t.Registers == nil {
+		for _, h := range t.Hashes {
+			s.AddHash(h)
+		}
+		return
+	}
+	if s.Registers == nil {
+		s.densify()
+	}
+	for i, rank := range t.Registers {
+		if rank > s.Registers[i] {
+			s.Registers[i] = rank
+		}
+	}
+}
+
+// Merge implements Stat. It panics if the sketches' precisions differ.
+func (s HyperLogLog) Merge(stat Stat) Stat {
+	t := stat.(HyperLogLog)
+	merged := HyperLogLog{Precision: s.Precision}
+	if s.Registers != nil {
+		merged.Registers = append([]uint8(nil), s.Registers...)
+	} else {
+		merged.Hashes = append([]uint64(nil), s.Hashes...)
+	}
+	merged.MergeFrom(&t)
+	return merged
+}
+
+// Count returns the estimated number of distinct observations in the
+// sketch. Counts of sparse sketches are exact, barring hash
+// collisions.
+func (s HyperLogLog) Count() int64 {
+	if s.Registers == nil {
+		distinct := make(map[uint64]bool, len(s.Hashes))
+		for _, h := range s.Hashes {
+			distinct[h] = true
+		}
+		return int64(len(distinct))
+	}
+	var (
+		m     = float64(len(s.Registers))
+		sum   float64
+		zeros int
+	)
+	for _, rank := range s.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	var alpha float64
+	switch len(s.Registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+	// Small cardinalities are estimated by linear counting of the
+	// registers that are still empty. Hashes are 64 bits, and so no
+	// correction is needed for large cardinalities.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/grailbio/bigslice/slicestats"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 100, 1000, 100000} {
+		var (
+			s      = slicestats.NewHyperLogLog(12)
+			hashes = make([]uint64, n)
+		)
+		for i := range hashes {
+			hashes[i] = r.Uint64()
+			// Each observation is added twice.
+			s.AddHash(hashes[i])
+			s.AddHash(hashes[i])
+		}
+		count := s.Count()
+		// Sparse sketches are exact.
+		if n <= 256 {
+			if count != int64(n) {
+				t.Errorf("got %v, want %v", count, n)
+			}
+		} else if err := math.Abs(float64(count)-float64(n)) / float64(n); err > 0.05 {
+			t.Errorf("%d: estimated %d, error %v", n, count, err)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const N = 50000
+	var (
+		x     = slicestats.HyperLogLogOf(14, r.Uint64())
+		y     = slicestats.HyperLogLogOf(14, r.Uint64())
+		stats = []slicestats.Stat{x, y}
+	)
+	for i := 2; i < N; i++ {
+		h := slicestats.HyperLogLogOf(14, r.Uint64())
+		stats[i%2] = stats[i%2].Merge(h)
+	}
+	// Sketches overlap entirely when merged with themselves.
+	merged := stats[0].Merge(stats[1]).Merge(stats[0]).(slicestats.HyperLogLog)
+	if err := math.Abs(float64(merged.Count())-N) / N; err > 0.03 {
+		t.Errorf("estimated %d, error %v", merged.Count(), err)
+	}
+	// Merge does not modify its operands.
+	if got, want := x.Count(), int64(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&merged); err != nil {
+		t.Fatal(err)
+	}
+	var decoded slicestats.HyperLogLog
+	if err := gob.NewDecoder(&b).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded.Count(), merged.Count(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
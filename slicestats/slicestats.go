@@ -0,0 +1,310 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+// Package slicestats provides mergeable statistics, which may be used
+// as combiners to compute per-key statistics of bigslices in a single
+// Reduce pass.
+//
+// Each statistic is a Stat: a value that summarizes a set of
+// observations, and that can be merged with another summary of the same
+// kind. Rows are mapped to one Stat per observation, and these are
+// merged by Reduce. Stats of several columns are combined by a Row,
+// whose Stats are merged element-wise, so that any number of statistics
+// are computed by a single Reduce. For example:
+//
+//	// slice is a Slice<string, float64, float64>
+//	slice = bigslice.Map(slice, func(key string, x, y float64) (string, slicestats.Row) {
+//		return key, slicestats.Row{
+//			slicestats.SummaryOf(x),
+//			slicestats.SummaryOf(y),
+//			slicestats.CorrelationOf(x, y),
+//		}
+//	})
+//	slice = bigslice.Reduce(slice, slicestats.Merge)
+package slicestats
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sort"
+)
+
+func init() {
+	gob.Register(Summary{})
+	gob.Register(Correlation{})
+	gob.Register(Histogram{})
+	gob.Register(StreamingHistogram{})
+}
+
+// A Stat is a mergeable statistic. Merge returns the statistic of the
+// union of the observations of the receiver and the provided Stat,
+// which must be of the same kind. Merge does not modify either
+// operand.
+type Stat interface {
+	Merge(Stat) Stat
+}
+
+// A Row is a set of statistics, e.g., of several columns of a slice,
+// that are merged element-wise.
+type Row []Stat
+
+// Merge merges the rows r and s element-wise. It panics if the rows
+// differ in length.
+func (r Row) Merge(s Row) Row {
+	if len(r) != len(s) {
+		panic(fmt.Sprintf("slicestats: cannot merge rows of lengths %d and %d", len(r), len(s)))
+	}
+	merged := make(Row, len(r))
+	for i := range r {
+		merged[i] = r[i].Merge(s[i])
+	}
+	return merged
+}
+
+// Merge merges the rows r and s. It is a reduce function for
+// bigslice.Reduce.
+func Merge(r, s Row) Row { return r.Merge(s) }
+
+// A Summary holds the count, minimum, maximum, mean, and variance of a
+// set of observations. Means and variances are accumulated by Welford's
+// method, so that they are numerically stable.
+type Summary struct {
+	// N is the number of observations.
+	N int64
+	// Min and Max are the smallest and largest observations.
+	Min, Max float64
+	// Mean is the mean of the observations.
+	Mean float64
+	// M2 is the sum of the squared deviations of the observations from
+	// their mean.
+	M2 float64
+}
+
+// SummaryOf returns the summary of the single observation x.
+func SummaryOf(x float64) Summary {
+	return Summary{N: 1, Min: x, Max: x, Mean: x}
+}
+
+// Merge implements Stat.
+func (s Summary) Merge(stat Stat) Stat {
+	t := stat.(Summary)
+	switch {
+	case s.N == 0:
+		return t
+	case t.N == 0:
+		return s
+	}
+	var (
+		n     = s.N + t.N
+		delta = t.Mean - s.Mean
+	)
+	return Summary{
+		N:    n,
+		Min:  math.Min(s.Min, t.Min),
+		Max:  math.Max(s.Max, t.Max),
+		Mean: s.Mean + delta*float64(t.N)/float64(n),
+		M2:   s.M2 + t.M2 + delta*delta*float64(s.N)*float64(t.N)/float64(n),
+	}
+}
+
+// Variance returns the population variance of the observations.
+func (s Summary) Variance() float64 { return s.M2 / float64(s.N) }
+
+// SampleVariance returns the unbiased sample variance of the
+// observations.
+func (s Summary) SampleVariance() float64 { return s.M2 / float64(s.N-1) }
+
+// Stddev returns the population standard deviation of the
+// observations.
+func (s Summary) Stddev() float64 { return math.Sqrt(s.Variance()) }
+
+// A Correlation holds the moments of a set of paired observations
+// (x, y), from which their covariance and correlation are computed.
+type Correlation struct {
+	// N is the number of observations.
+	N int64
+	// MeanX and MeanY are the means of x and y.
+	MeanX, MeanY float64
+	// M2X and M2Y are the sums of the squared deviations of x and y
+	// from their means.
+	M2X, M2Y float64
+	// C is the sum of the products of the deviations of x and y from
+	// their means.
+	C float64
+}
+
+// CorrelationOf returns the correlation of the single paired
+// observation (x, y).
+func CorrelationOf(x, y float64) Correlation {
+	return Correlation{N: 1, MeanX: x, MeanY: y}
+}
+
+// Merge implements Stat.
+func (c Correlation) Merge(stat Stat) Stat {
+	d := stat.(Correlation)
+	switch {
+	case c.N == 0:
+		return d
+	case d.N == 0:
+		return c
+	}
+	var (
+		n      = c.N + d.N
+		dx     = d.MeanX - c.MeanX
+		dy     = d.MeanY - c.MeanY
+		weight = float64(c.N) * float64(d.N) / float64(n)
+	)
+	return Correlation{
+		N:     n,
+		MeanX: c.MeanX + dx*float64(d.N)/float64(n),
+		MeanY: c.MeanY + dy*float64(d.N)/float64(n),
+		M2X:   c.M2X + d.M2X + dx*dx*weight,
+		M2Y:   c.M2Y + d.M2Y + dy*dy*weight,
+		C:     c.C + d.C + dx*dy*weight,
+	}
+}
+
+// Covariance returns the population covariance of x and y.
+func (c Correlation) Covariance() float64 { return c.C / float64(c.N) }
+
+// Pearson returns the Pearson correlation coefficient of x and y.
+func (c Correlation) Pearson() float64 { return c.C / math.Sqrt(c.M2X*c.M2Y) }
+
+// A Histogram counts observations in buckets with fixed boundaries.
+// Bucket i counts the observations x with Bounds[i-1] <= x < Bounds[i];
+// the first and last buckets are unbounded below and above,
+// respectively, so that there are len(Bounds)+1 buckets.
+type Histogram struct {
+	// Bounds are the ascending boundaries of the buckets.
+	Bounds []float64
+	// Counts are the number of observations in each bucket.
+	Counts []int64
+}
+
+// HistogramOf returns the histogram of the single observation x, with
+// the provided ascending bucket boundaries. Bounds are shared, and must
+// not be modified.
+func HistogramOf(bounds []float64, x float64) Histogram {
+	h := Histogram{Bounds: bounds, Counts: make([]int64, len(bounds)+1)}
+	h.Counts[sort.Search(len(bounds), func(i int) bool { return x < bounds[i] })]++
+	return h
+}
+
+// Merge implements Stat. It panics if the histograms' bucket
+// boundaries differ.
+func (h Histogram) Merge(stat Stat) Stat {
+	g := stat.(Histogram)
+	if len(h.Bounds) != len(g.Bounds) {
+		panic("slicestats: cannot merge histograms with different bounds")
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != g.Bounds[i] {
+			panic("slicestats: cannot merge histograms with different bounds")
+		}
+	}
+	counts := make([]int64, len(h.Counts))
+	for i := range counts {
+		counts[i] = h.Counts[i] + g.Counts[i]
+	}
+	return Histogram{Bounds: h.Bounds, Counts: counts}
+}
+
+// A Bin is a bin of a StreamingHistogram: Count observations centered
+// at Value.
+type Bin struct {
+	Value float64
+	Count int64
+}
+
+// A StreamingHistogram is an approximate histogram whose bucket
+// boundaries are not known in advance, but adapt to the observations.
+// It holds at most MaxBins bins; when merging would exceed this, the
+// closest bins are combined, as described by Ben-Haim and Tom-Tov, "A
+// Streaming Parallel Decision Tree Algorithm".
+type StreamingHistogram struct {
+	// MaxBins is the maximum number of bins of the histogram.
+	MaxBins int
+	// Bins are the histogram's bins, ordered by value.
+	Bins []Bin
+}
+
+// StreamingHistogramOf returns the streaming histogram, with at most
+// maxBins bins, of the single observation x.
+func StreamingHistogramOf(maxBins int, x float64) StreamingHistogram {
+	return StreamingHistogram{MaxBins: maxBins, Bins: []Bin{{x, 1}}}
+}
+
+// Merge implements Stat.
+func (h StreamingHistogram) Merge(stat Stat) Stat {
+	g := stat.(StreamingHistogram)
+	bins := make([]Bin, 0, len(h.Bins)+len(g.Bins))
+	i, j := 0, 0
+	for i < len(h.Bins) || j < len(g.Bins) {
+		var b Bin
+		if j == len(g.Bins) || i < len(h.Bins) && h.Bins[i].Value <= g.Bins[j].Value {
+			b = h.Bins[i]
+			i++
+		} else {
+			b = g.Bins[j]
+			j++
+		}
+		if n := len(bins); n > 0 && bins[n-1].Value == b.Value {
+			bins[n-1].Count += b.Count
+		} else {
+			bins = append(bins, b)
+		}
+	}
+	for len(bins) > h.MaxBins && len(bins) > 1 {
+		// Combine the two closest bins into their weighted mean.
+		k := 0
+		for i := 1; i < len(bins)-1; i++ {
+			if bins[i+1].Value-bins[i].Value < bins[k+1].Value-bins[k].Value {
+				k = i
+			}
+		}
+		a, b := bins[k], bins[k+1]
+		count := a.Count + b.Count
+		bins[k] = Bin{(a.Value*float64(a.Count) + b.Value*float64(b.Count)) / float64(count), count}
+		bins = append(bins[:k+1], bins[k+2:]...)
+	}
+	return StreamingHistogram{MaxBins: h.MaxBins, Bins: bins}
+}
+
+// Count returns the number of observations in the histogram.
+func (h StreamingHistogram) Count() int64 {
+	var n int64
+	for _, b := range h.Bins {
+		n += b.Count
+	}
+	return n
+}
+
+// Quantile returns an estimate of the q-quantile, 0 <= q <= 1, of the
+// observations, interpolated linearly between the values of the bins
+// that straddle it. It returns NaN if the histogram is empty.
+func (h StreamingHistogram) Quantile(q float64) float64 {
+	if len(h.Bins) == 0 {
+		return math.NaN()
+	}
+	var (
+		target = q * float64(h.Count())
+		// Each bin's observations are taken to be centered at its value,
+		// so that its cumulative count is reached halfway through it.
+		cum float64
+	)
+	for i, b := range h.Bins {
+		mid := cum + float64(b.Count)/2
+		if target <= mid {
+			if i == 0 {
+				return b.Value
+			}
+			prev := h.Bins[i-1]
+			prevMid := cum - float64(prev.Count)/2
+			return prev.Value + (b.Value-prev.Value)*(target-prevMid)/(mid-prevMid)
+		}
+		cum += float64(b.Count)
+	}
+	return h.Bins[len(h.Bins)-1].Value
+}
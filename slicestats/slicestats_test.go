@@ -0,0 +1,179 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicestats"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func approxEqual(x, y float64) bool {
+	return math.Abs(x-y) <= 1e-9*math.Max(1, math.Max(math.Abs(x), math.Abs(y)))
+}
+
+// mergeAll merges the stats of the provided observations in a random
+// order and grouping, as a Reduce would.
+func mergeAll(r *rand.Rand, stats []slicestats.Stat) slicestats.Stat {
+	for len(stats) > 1 {
+		i := r.Intn(len(stats) - 1)
+		stats[i] = stats[i].Merge(stats[i+1])
+		stats = append(stats[:i+1], stats[i+2:]...)
+	}
+	return stats[0]
+}
+
+func TestSummaryCorrelation(t *testing.T) {
+	const N = 1000
+	r := rand.New(rand.NewSource(0))
+	var (
+		xs           = make([]float64, N)
+		ys           = make([]float64, N)
+		summaries    = make([]slicestats.Stat, N)
+		correlations = make([]slicestats.Stat, N)
+	)
+	for i := range xs {
+		xs[i] = r.NormFloat64()*10 + 100
+		ys[i] = 2*xs[i] + r.NormFloat64()
+		summaries[i] = slicestats.SummaryOf(xs[i])
+		correlations[i] = slicestats.CorrelationOf(xs[i], ys[i])
+	}
+	var meanX, meanY, minX, maxX = 0.0, 0.0, math.Inf(1), math.Inf(-1)
+	for i := range xs {
+		meanX += xs[i] / N
+		meanY += ys[i] / N
+		minX = math.Min(minX, xs[i])
+		maxX = math.Max(maxX, xs[i])
+	}
+	var varX, varY, cov float64
+	for i := range xs {
+		varX += (xs[i] - meanX) * (xs[i] - meanX) / N
+		varY += (ys[i] - meanY) * (ys[i] - meanY) / N
+		cov += (xs[i] - meanX) * (ys[i] - meanY) / N
+	}
+
+	s := mergeAll(r, summaries).(slicestats.Summary)
+	if got, want := s.N, int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.Min, minX; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.Max, maxX; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.Mean, meanX; !approxEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.Variance(), varX; !approxEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.SampleVariance(), varX*N/(N-1); !approxEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	c := mergeAll(r, correlations).(slicestats.Correlation)
+	if got, want := c.Covariance(), cov; !approxEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := c.Pearson(), cov/math.Sqrt(varX*varY); !approxEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	bounds := []float64{0, 10, 20}
+	var stats []slicestats.Stat
+	for _, x := range []float64{-1, 0, 5, 10, 15, 19.9, 20, 100} {
+		stats = append(stats, slicestats.HistogramOf(bounds, x))
+	}
+	h := mergeAll(rand.New(rand.NewSource(0)), stats).(slicestats.Histogram)
+	if got, want := h.Counts, []int64{1, 2, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStreamingHistogram(t *testing.T) {
+	const N = 10000
+	r := rand.New(rand.NewSource(0))
+	xs := make([]float64, N)
+	stats := make([]slicestats.Stat, N)
+	for i := range xs {
+		xs[i] = r.Float64() * 100
+		stats[i] = slicestats.StreamingHistogramOf(32, xs[i])
+	}
+	sort.Float64s(xs)
+	h := mergeAll(r, stats).(slicestats.StreamingHistogram)
+	if got, want := len(h.Bins), 32; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := h.Count(), int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.9} {
+		if got, want := h.Quantile(q), xs[int(q*N)]; math.Abs(got-want) > 2 {
+			t.Errorf("quantile %v: got %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestRowGob(t *testing.T) {
+	row := slicestats.Row{
+		slicestats.SummaryOf(1),
+		slicestats.CorrelationOf(1, 2),
+		slicestats.HistogramOf([]float64{0, 1}, 0.5),
+		slicestats.StreamingHistogramOf(10, 1),
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(row); err != nil {
+		t.Fatal(err)
+	}
+	var decoded slicestats.Row
+	if err := gob.NewDecoder(&b).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(row, decoded) {
+		t.Errorf("got %v, want %v", decoded, row)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	keys := []string{"a", "b", "a", "b", "a"}
+	xs := []float64{1, 2, 3, 4, 5}
+	slice := bigslice.Const(2, keys, xs)
+	slice = bigslice.Map(slice, func(key string, x float64) (string, slicestats.Row) {
+		return key, slicestats.Row{
+			slicestats.SummaryOf(x),
+			slicestats.HistogramOf([]float64{3}, x),
+		}
+	})
+	slice = bigslice.Reduce(slice, slicestats.Merge)
+	var (
+		gotKeys []string
+		rows    []slicestats.Row
+	)
+	slicetest.RunAndScan(t, slice, &gotKeys, &rows)
+	got := make(map[string]slicestats.Row)
+	for i, key := range gotKeys {
+		got[key] = rows[i]
+	}
+	if got, want := got["a"][0].(slicestats.Summary).Mean, 3.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := got["b"][0].(slicestats.Summary).Variance(), 1.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := got["a"][1].(slicestats.Histogram).Counts, []int64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"sort"
+)
+
+func init() {
+	gob.Register(TDigest{})
+}
+
+// DefaultCompression is a compression for t-digests that estimates
+// quantiles to within about 1% of rank, and much better than that
+// near the tails, with a few hundred centroids.
+const DefaultCompression = 100
+
+// A Centroid is a centroid of a TDigest: Count observations whose mean
+// is Mean.
+type Centroid struct {
+	Mean  float64
+	Count int64
+}
+
+// A TDigest is a sketch that estimates quantiles of a set of
+// observations, as described by Dunning and Ertl, "Computing Extremely
+// Accurate Quantiles Using t-Digests". Observations are clustered into
+// centroids, whose sizes are bounded by a scale function of their
+// quantiles, so that centroids near the tails are small, and the
+// estimates of extreme quantiles are accurate. A digest of compression
+// δ holds at most about δ centroids.
+type TDigest struct {
+	// Compression bounds the number of centroids of the digest.
+	Compression float64
+	// Centroids are the digest's merged centroids, ordered by mean.
+	Centroids []Centroid
+	// Unmerged holds observations, and centroids of merged digests,
+	// that are yet to be merged into Centroids.
+	Unmerged []Centroid
+	// Min and Max are the smallest and largest observations.
+	Min, Max float64
+}
+
+// NewTDigest returns an empty digest with the provided compression.
+func NewTDigest(compression float64) *TDigest {
+	if compression < 1 {
+		panic(fmt.Sprintf("slicestats: invalid t-digest compression %v", compression))
+	}
+	return &TDigest{Compression: compression, Min: math.Inf(1), Max: math.Inf(-1)}
+}
+
+// TDigestOf returns the digest, with the provided compression, of the
+// single observation x.
+func TDigestOf(compression float64, x float64) TDigest {
+	d := NewTDigest(compression)
+	d.Add(x)
+	return *d
+}
+
+// Add adds the observation x to the digest.
+func (d *TDigest) Add(x float64) {
+	d.add(Centroid{x, 1}, x, x)
+}
+
+func (d *TDigest) add(c Centroid, min, max float64) {
+	d.Unmerged = append(d.Unmerged, c)
+	if min < d.Min {
+		d.Min = min
+	}
+	if max > d.Max {
+		d.Max = max
+	}
+	if len(d.Unmerged) > 4*int(d.Compression) {
+		d.compress()
+	}
+}
+
+// MergeFrom merges the observations of digest e into d, which is
+// modified in place.
+func (d *TDigest) MergeFrom(e *TDigest) {
+	for _, c := range e.Centroids {
+		d.add(c, e.Min, e.Max)
+	}
+	for _, c := range e.Unmerged {
+		d.add(c, e.Min, e.Max)
+	}
+}
+
+// Merge implements Stat.
+func (d TDigest) Merge(stat Stat) Stat {
+	e := stat.(TDigest)
+	merged := d
+	merged.Centroids = append([]Centroid(nil), d.Centroids...)
+	merged.Unmerged = append([]Centroid(nil), d.Unmerged...)
+	merged.MergeFrom(&e)
+	return merged
+}
+
+// k is the digest's scale function, k1 of Dunning and Ertl, which maps
+// quantiles to indices; each centroid spans at most one unit of index.
+func (d *TDigest) k(q float64) float64 {
+	return d.Compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// kInverse is the inverse of k.
+func (d *TDigest) kInverse(k float64) float64 {
+	if k >= d.Compression/4 {
+		return 1
+	}
+	return (math.Sin(2*math.Pi*k/d.Compression) + 1) / 2
+}
+
+// compress merges the digest's unmerged centroids into its centroids.
+func (d *TDigest) compress() {
+	if len(d.Unmerged) == 0 {
+		return
+	}
+	all := append(d.Unmerged, d.Centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+	var total int64
+	for _, c := range all {
+		total += c.Count
+	}
+	var (
+		merged = make([]Centroid, 0, len(d.Centroids)+1)
+		cur    = all[0]
+		// seen is the number of observations in the emitted centroids;
+		// limit is the number at which the current centroid is full.
+		seen  int64
+		limit = float64(total) * d.kInverse(d.k(0)+1)
+	)
+	for _, c := range all[1:] {
+		if float64(seen+cur.Count+c.Count) <= limit {
+			n := cur.Count + c.Count
+			cur.Mean += (c.Mean - cur.Mean) * float64(c.Count) / float64(n)
+			cur.Count = n
+			continue
+		}
+		merged = append(merged, cur)
+		seen += cur.Count
+		limit = float64(total) * d.kInverse(d.k(float64(seen)/float64(total))+1)
+		cur = c
+	}
+	d.Centroids = append(merged, cur)
+	d.Unmerged = nil
+}
+
+// Count returns the number of observations in the digest.
+func (d TDigest) Count() int64 {
+	var n int64
+	for _, c := range d.Centroids {
+		n += c.Count
+	}
+	for _, c := range d.Unmerged {
+		n += c.Count
+	}
+	return n
+}
+
+// Quantile returns an estimate of the q-quantile, 0 <= q <= 1, of the
+// observations, interpolated linearly between the means of the
+// centroids that straddle it, and the extreme observations. It returns
+// NaN if the digest is empty.
+func (d TDigest) Quantile(q float64) float64 {
+	if len(d.Unmerged) > 0 {
+		d.Centroids = append([]Centroid(nil), d.Centroids...)
+		d.Unmerged = append([]Centroid(nil), d.Unmerged...)
+		d.compress()
+	}
+	if len(d.Centroids) == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return d.Min
+	}
+	if q >= 1 {
+		return d.Max
+	}
+	var (
+		total = float64(d.Count())
+		// Each centroid's observations are taken to be centered at its
+		// mean, so that its cumulative count is reached halfway through
+		// it. The minimum and maximum are at the ends.
+		target            = q * total
+		prevMid, prevMean = 0.0, d.Min
+		cum               float64
+	)
+	for _, c := range d.Centroids {
+		mid := cum + float64(c.Count)/2
+		if target <= mid {
+			if mid == prevMid {
+				return c.Mean
+			}
+			return prevMean + (c.Mean-prevMean)*(target-prevMid)/(mid-prevMid)
+		}
+		prevMid, prevMean = mid, c.Mean
+		cum += float64(c.Count)
+	}
+	if total == prevMid {
+		return d.Max
+	}
+	return prevMean + (d.Max-prevMean)*(target-prevMid)/(total-prevMid)
+}
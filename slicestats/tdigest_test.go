@@ -0,0 +1,91 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicestats_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/grailbio/bigslice/slicestats"
+)
+
+func TestTDigest(t *testing.T) {
+	const N = 100000
+	var (
+		r    = rand.New(rand.NewSource(1))
+		d    = slicestats.NewTDigest(slicestats.DefaultCompression)
+		vals = make([]float64, N)
+	)
+	for i := range vals {
+		vals[i] = r.NormFloat64()
+		d.Add(vals[i])
+	}
+	sort.Float64s(vals)
+	if got, want := d.Count(), int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		// Errors are measured in rank, which are smaller near the tails.
+		got := d.Quantile(q)
+		rank := float64(sort.SearchFloat64s(vals, got)) / N
+		if err, max := math.Abs(rank-q), 0.01*math.Min(1, 4*q*(1-q)+0.01); err > max {
+			t.Errorf("quantile %v: got %v (rank %v), error %v exceeds %v", q, got, rank, err, max)
+		}
+	}
+	if got, want := d.Quantile(0), vals[0]; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := d.Quantile(1), vals[N-1]; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(d.Centroids) > 2*slicestats.DefaultCompression {
+		t.Errorf("digest has %d centroids", len(d.Centroids))
+	}
+	if q := slicestats.NewTDigest(slicestats.DefaultCompression).Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("got %v, want NaN", q)
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	const N = 20000
+	var (
+		r     = rand.New(rand.NewSource(1))
+		x     = slicestats.TDigestOf(slicestats.DefaultCompression, 0)
+		y     = slicestats.TDigestOf(slicestats.DefaultCompression, 1)
+		stats = []slicestats.Stat{x, y}
+	)
+	for i := 2; i < N; i++ {
+		stats[i%2] = stats[i%2].Merge(slicestats.TDigestOf(slicestats.DefaultCompression, r.Float64()))
+	}
+	merged := stats[0].Merge(stats[1]).(slicestats.TDigest)
+	if got, want := merged.Count(), int64(N); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.9} {
+		if got := merged.Quantile(q); math.Abs(got-q) > 0.01 {
+			t.Errorf("quantile %v: got %v", q, got)
+		}
+	}
+	// Merge does not modify its operands.
+	if got, want := x.Count(), int64(1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&merged); err != nil {
+		t.Fatal(err)
+	}
+	var decoded slicestats.TDigest
+	if err := gob.NewDecoder(&b).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded.Quantile(0.5), merged.Quantile(0.5); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicetype
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxDecimalPrecision is the largest number of decimal digits that a
+// Decimal can represent exactly.
+const MaxDecimalPrecision = 18
+
+// A Decimal is a fixed-point decimal number whose value is
+// Unscaled×10^-Scale. Decimals represent exact quantities, e.g.,
+// the DECIMAL columns of SQL tables and Parquet files, without the
+// rounding of floating point numbers. Columns of Decimals are stored
+// inline, ordered and hashed by their values (so that, e.g., 1.5 and
+// 1.50 are equal), and are encoded compactly, without gob.
+type Decimal struct {
+	// Unscaled is the decimal's unscaled value.
+	Unscaled int64
+	// Scale is the number of digits after the decimal point.
+	Scale int32
+}
+
+// NewDecimal returns the decimal unscaled×10^-scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{unscaled, int32(scale)}
+}
+
+// ParseDecimal parses a decimal from its string representation, e.g.,
+// "-12.340". The decimal's scale is the number of digits after the
+// decimal point.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := s
+	var scale int
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		digits = s[:i] + s[i+1:]
+	}
+	if digits == "" || digits == "-" || digits == "+" || scale > MaxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("slicetype.ParseDecimal: invalid decimal %q", s)
+	}
+	unscaled, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("slicetype.ParseDecimal: invalid decimal %q", s)
+	}
+	return NewDecimal(unscaled, scale), nil
+}
+
+// String returns the decimal's representation with Scale digits after
+// the decimal point.
+func (d Decimal) String() string {
+	if d.Scale <= 0 {
+		return d.big().RatString()
+	}
+	s := strconv.FormatInt(d.Unscaled, 10)
+	var sign string
+	if d.Unscaled < 0 {
+		sign, s = "-", s[1:]
+	}
+	if n := int(d.Scale) + 1 - len(s); n > 0 {
+		s = strings.Repeat("0", n) + s
+	}
+	i := len(s) - int(d.Scale)
+	return sign + s[:i] + "." + s[i:]
+}
+
+// Float64 returns the nearest float64 value of the decimal.
+func (d Decimal) Float64() float64 {
+	return float64(d.Unscaled) * math.Pow10(-int(d.Scale))
+}
+
+// Cmp compares decimals d and e by their values, returning -1, 0, or
+// +1 as d is less than, equal to, or greater than e.
+func (d Decimal) Cmp(e Decimal) int {
+	if d.Scale == e.Scale {
+		switch {
+		case d.Unscaled < e.Unscaled:
+			return -1
+		case d.Unscaled > e.Unscaled:
+			return 1
+		}
+		return 0
+	}
+	return d.big().Cmp(e.big())
+}
+
+// Normalize returns the decimal with the smallest nonnegative scale
+// that has the same value as d. Equal decimals have equal normalized
+// representations.
+func (d Decimal) Normalize() Decimal {
+	if d.Unscaled == 0 {
+		return Decimal{}
+	}
+	for d.Scale > 0 && d.Unscaled%10 == 0 {
+		d.Unscaled /= 10
+		d.Scale--
+	}
+	return d
+}
+
+// big returns the decimal's value as a rational number.
+func (d Decimal) big() *big.Rat {
+	r := new(big.Rat).SetInt64(d.Unscaled)
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(d.Scale))), nil)
+	if d.Scale > 0 {
+		return r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	return r.Mul(r, new(big.Rat).SetInt(pow))
+}
+
+func abs(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
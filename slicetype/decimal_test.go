@@ -0,0 +1,68 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package slicetype
+
+import "testing"
+
+func TestDecimal(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		d    Decimal
+		want string
+	}{
+		{"12.340", NewDecimal(12340, 3), "12.340"},
+		{"-0.05", NewDecimal(-5, 2), "-0.05"},
+		{"42", NewDecimal(42, 0), "42"},
+		{".5", NewDecimal(5, 1), "0.5"},
+	} {
+		d, err := ParseDecimal(c.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := d, c.d; got != want {
+			t.Errorf("%s: got %v, want %v", c.s, got, want)
+		}
+		if got, want := d.String(), c.want; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	for _, s := range []string{"", "-", "1.2.3", "x", "0.1234567890123456789"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+	if got, want := NewDecimal(-123, -2).String(), "-12300"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := NewDecimal(125, 2).Float64(), 1.25; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDecimalCmp(t *testing.T) {
+	for _, c := range []struct {
+		d, e Decimal
+		want int
+	}{
+		{NewDecimal(15, 1), NewDecimal(150, 2), 0},
+		{NewDecimal(15, 1), NewDecimal(151, 2), -1},
+		{NewDecimal(2, 0), NewDecimal(1999, 3), 1},
+		{NewDecimal(-1, 0), NewDecimal(1, 9), -1},
+		{NewDecimal(3, 1), NewDecimal(2, 1), 1},
+	} {
+		if got := c.d.Cmp(c.e); got != c.want {
+			t.Errorf("%v cmp %v: got %v, want %v", c.d, c.e, got, c.want)
+		}
+		if got := c.e.Cmp(c.d); got != -c.want {
+			t.Errorf("%v cmp %v: got %v, want %v", c.e, c.d, got, -c.want)
+		}
+	}
+	if got, want := NewDecimal(1500, 3).Normalize(), NewDecimal(15, 1); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := NewDecimal(0, 3).Normalize(), (Decimal{}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
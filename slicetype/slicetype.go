@@ -26,6 +26,87 @@ type Type interface {
 	Prefix() int
 }
 
+// A NullableType is a Type some of whose columns may be nullable. The
+// values of a nullable column may be null, i.e., absent, which is
+// distinct from the zero value of the column's type. Nullable columns
+// are used to represent, e.g., the NULLs of SQL tables and the optional
+// fields of Parquet files.
+type NullableType interface {
+	Type
+	// Nullable tells whether the ith column is nullable.
+	Nullable(i int) bool
+}
+
+// Nullable tells whether the ith column of the provided type is
+// nullable. Columns of types that do not implement NullableType are
+// never nullable.
+func Nullable(typ Type, i int) bool {
+	if typ, ok := typ.(NullableType); ok {
+		return typ.Nullable(i)
+	}
+	return false
+}
+
+// WithNullable returns a type that is identical to the provided type,
+// including its prefix, except that the provided columns are nullable.
+// Columns that are nullable in the provided type remain nullable.
+func WithNullable(typ Type, cols ...int) Type {
+	t := nullableType{typ, make([]bool, typ.NumOut())}
+	for i := range t.nulls {
+		t.nulls[i] = Nullable(typ, i)
+	}
+	for _, col := range cols {
+		if col < 0 || col >= typ.NumOut() {
+			panic("slicetype.WithNullable: invalid column")
+		}
+		t.nulls[col] = true
+	}
+	return t
+}
+
+type nullableType struct {
+	Type
+	nulls []bool
+}
+
+func (t nullableType) Nullable(i int) bool     { return t.nulls[i] }
+func (t nullableType) ColumnName(i int) string { return ColumnName(t.Type, i) }
+
+// A NamedType is a Type whose columns may be named, e.g., by the
+// fields of the struct from which they were expanded. Names are
+// informational: columns are always addressed by their positions, but
+// operators may resolve names to positions.
+type NamedType interface {
+	Type
+	// ColumnName returns the name of the ith column, or an empty
+	// string if the column is unnamed.
+	ColumnName(i int) string
+}
+
+// ColumnName returns the name of the ith column of the provided type,
+// or an empty string if the column is unnamed. Columns of types that
+// do not implement NamedType are unnamed.
+func ColumnName(typ Type, i int) string {
+	if typ, ok := typ.(NamedType); ok {
+		return typ.ColumnName(i)
+	}
+	return ""
+}
+
+// ColumnIndex returns the index of the first column of the provided
+// type with the provided name, or -1 if there is no such column.
+func ColumnIndex(typ Type, name string) int {
+	if name == "" {
+		return -1
+	}
+	for i := 0; i < typ.NumOut(); i++ {
+		if ColumnName(typ, i) == name {
+			return i
+		}
+	}
+	return -1
+}
+
 type typeSlice []reflect.Type
 
 // New returns a new Type using the provided column types.
@@ -64,10 +145,21 @@ func Columns(typ Type) []reflect.Type {
 }
 
 func Concat(types ...Type) Type {
-	var t typeSlice
+	var (
+		t     typeSlice
+		nulls []int
+	)
 	for _, typ := range types {
+		for i := 0; i < typ.NumOut(); i++ {
+			if Nullable(typ, i) {
+				nulls = append(nulls, len(t)+i)
+			}
+		}
 		t = append(t, Columns(typ)...)
 	}
+	if len(nulls) > 0 {
+		return WithNullable(t, nulls...)
+	}
 	return t
 }
 
@@ -75,6 +167,9 @@ func String(typ Type) string {
 	elems := make([]string, typ.NumOut())
 	for i := range elems {
 		elems[i] = typ.Out(i).String()
+		if Nullable(typ, i) {
+			elems[i] += "?"
+		}
 	}
 	return fmt.Sprintf("slice[%d]%s", typ.Prefix(), strings.Join(elems, ","))
 }
@@ -96,6 +191,20 @@ func (a appendType) Out(i int) reflect.Type {
 
 func (a appendType) Prefix() int { return a.t1.Prefix() }
 
+func (a appendType) Nullable(i int) bool {
+	if i < a.t1.NumOut() {
+		return Nullable(a.t1, i)
+	}
+	return Nullable(a.t2, i-a.t1.NumOut())
+}
+
+func (a appendType) ColumnName(i int) string {
+	if i < a.t1.NumOut() {
+		return ColumnName(a.t1, i)
+	}
+	return ColumnName(a.t2, i-a.t1.NumOut())
+}
+
 func Append(t1, t2 Type) Type {
 	return appendType{t1, t2}
 }
@@ -125,6 +234,14 @@ func (s sliceType) Prefix() int {
 	return 1
 }
 
+func (s sliceType) Nullable(i int) bool {
+	return Nullable(s.t, s.i+i)
+}
+
+func (s sliceType) ColumnName(i int) string {
+	return ColumnName(s.t, s.i+i)
+}
+
 func Slice(t Type, i, j int) Type {
 	if i < 0 || i > t.NumOut() || j < i || j > t.NumOut() {
 		panic("slice: invalid argument")
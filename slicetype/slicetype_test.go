@@ -40,3 +40,50 @@ func TestSignature(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestNullable(t *testing.T) {
+	typ := WithNullable(New(typeOfString, typeOfInt, typeOfString), 1)
+	if Nullable(typ, 0) || !Nullable(typ, 1) || Nullable(typ, 2) {
+		t.Error("wrong nullable columns")
+	}
+	if got, want := String(typ), "slice[1]string,int?,string"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, c := range []struct {
+		typ  Type
+		want string
+	}{
+		{Slice(typ, 1, 3), "slice[1]int?,string"},
+		{Append(New(typeOfInt), typ), "slice[1]int,string,int?,string"},
+		{Concat(typ, WithNullable(New(typeOfInt), 0)), "slice[1]string,int?,string,int?"},
+		{WithNullable(typ, 0), "slice[1]string?,int?,string"},
+	} {
+		if got := String(c.typ); got != c.want {
+			t.Errorf("got %v, want %v", got, c.want)
+		}
+	}
+}
+
+type namedType struct {
+	Type
+	names []string
+}
+
+func (t namedType) ColumnName(i int) string { return t.names[i] }
+
+func TestColumnName(t *testing.T) {
+	typ := namedType{New(typeOfString, typeOfInt), []string{"a", "b"}}
+	if got, want := ColumnIndex(typ, "b"), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := ColumnIndex(typ, "c"), -1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Names are retained by derived types.
+	derived := Slice(Append(WithNullable(typ, 0), New(typeOfInt)), 1, 3)
+	for i, want := range []string{"b", ""} {
+		if got := ColumnName(derived, i); got != want {
+			t.Errorf("column %d: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A Snapshotter is a Slice that is read at the snapshot of a group of
+// sources, so that it is consistent with the other sources of the
+// group. The snapshot of each group is resolved once per invocation,
+// when the invocation is compiled by the driver; the resolved snapshot
+// is then passed to the readers of the slice (and of the slices that
+// are pipelined with it) through their contexts. See Snapshot.
+type Snapshotter interface {
+	// SnapshotGroup returns the name of the slice's snapshot group.
+	SnapshotGroup() string
+	// ResolveSnapshot resolves the current snapshot of the group.
+	ResolveSnapshot(ctx context.Context) (string, error)
+}
+
+type snapshotSlice struct {
+	name Name
+	Slice
+	group   string
+	resolve func(context.Context) (string, error)
+}
+
+// Snapshot returns a slice that is identical to the provided slice,
+// but which is read at the snapshot of the named group, as resolved by
+// the provided function, e.g., the latest committed version of a set
+// of tables. Snapshot is used to keep multiple sources that are read
+// by an invocation mutually consistent, e.g., a table of events and a
+// snapshot of a dimension table: all of the sources of an invocation
+// that belong to the same group are read at the same snapshot, which
+// is resolved once, by the driver, when the invocation is compiled.
+// (The resolvers of a group should thus be equivalent; only one of
+// them is called.) The resolved snapshots are recorded with the
+// invocation's results.
+//
+// The provided slice, typically a source, and the slices that are
+// pipelined with it obtain the snapshot from the contexts passed to
+// their readers, through SnapshotFromContext. For example, ReaderFunc
+// passes the context to read functions that accept one as their first
+// argument:
+//
+//	events := bigslice.ReaderFunc(nshard, func(ctx context.Context, shard int, ...) (int, error) {
+//		version, _ := bigslice.SnapshotFromContext(ctx, "warehouse")
+//		...
+//	})
+//	events = bigslice.Snapshot(events, "warehouse", latestVersion)
+func Snapshot(slice Slice, group string, resolve func(context.Context) (string, error)) Slice {
+	if group == "" {
+		typecheck.Panic(1, "snapshot: group must be nonempty")
+	}
+	return &snapshotSlice{MakeName("snapshot"), slice, group, resolve}
+}
+
+func (s *snapshotSlice) Name() Name             { return s.name }
+func (*snapshotSlice) NumDep() int              { return 1 }
+func (s *snapshotSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*snapshotSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *snapshotSlice) SnapshotGroup() string  { return s.group }
+
+func (s *snapshotSlice) ResolveSnapshot(ctx context.Context) (string, error) {
+	return s.resolve(ctx)
+}
+
+func (s *snapshotSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+type snapshotKey string
+
+// WithSnapshot returns a context that carries the provided snapshot of
+// the named group. It is used by the evaluator to pass resolved
+// snapshots to the readers of Snapshotters.
+func WithSnapshot(ctx context.Context, group, snapshot string) context.Context {
+	return context.WithValue(ctx, snapshotKey(group), snapshot)
+}
+
+// SnapshotFromContext returns the snapshot of the named group that is
+// carried by the provided context, and whether there is one. Readers
+// of slices returned by Snapshot, and of the slices that are pipelined
+// with them, are passed contexts that carry their groups' snapshots.
+func SnapshotFromContext(ctx context.Context, group string) (string, bool) {
+	snapshot, ok := ctx.Value(snapshotKey(group)).(string)
+	return snapshot, ok
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/sliceio"
+)
+
+func TestSnapshot(t *testing.T) {
+	var version int32
+	resolve := func(ctx context.Context) (string, error) {
+		return fmt.Sprint("v", atomic.AddInt32(&version, 1)), nil
+	}
+	// source returns a source whose rows record the snapshot at which
+	// they were read.
+	source := func(name string) bigslice.Slice {
+		slice := bigslice.ReaderFunc(2, func(ctx context.Context, shard int, done *bool, names, snapshots []string) (int, error) {
+			if *done {
+				return 0, sliceio.EOF
+			}
+			*done = true
+			snapshot, ok := bigslice.SnapshotFromContext(ctx, "warehouse")
+			if !ok {
+				return 0, fmt.Errorf("no snapshot for shard %d", shard)
+			}
+			names[0], snapshots[0] = fmt.Sprint(name, shard), snapshot
+			return 1, nil
+		})
+		return bigslice.Snapshot(slice, "warehouse", resolve)
+	}
+	slice := bigslice.Union(source("events"), source("dims"))
+	// Each executor runs a separate invocation, which resolves its own
+	// snapshot; the sources of each invocation read the same one.
+	ctx := context.Background()
+	for name, s := range run(ctx, t, slice) {
+		var (
+			names, snapshots []string
+			row, snapshot    string
+		)
+		for s.Scan(ctx, &row, &snapshot) {
+			names = append(names, row)
+			snapshots = append(snapshots, snapshot)
+		}
+		if err := s.Err(); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got, want := len(names), 4; got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+		for _, snapshot := range snapshots {
+			if snapshot != snapshots[0] {
+				t.Errorf("%s: inconsistent snapshots %v", name, snapshots)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/sortio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// sortSamplesPerShard is the number of rows that are sampled, in
+// total, for each shard of a sorted slice, from which the shards' key
+// ranges are determined.
+const sortSamplesPerShard = 100
+
+// SortBy returns a slice with nshard shards that contains the rows of
+// the provided slice, globally sorted by the provided sort keys: each
+// shard is sorted, and holds rows that sort after those of the shards
+// that precede it. Keys may name any comparable columns of the slice,
+// each in ascending or descending order (see Asc and Desc), and with
+// its nulls ordered as the key specifies; later keys break ties of
+// earlier ones. If the slice is sorted ascending by its first column,
+// the returned slice is bigslice.RangeShard. The returned slice retains the prefix of slice.
+// Schematically:
+//
+//	SortBy(Slice<t1, ..., tn>, nshard, keys...) Slice<t1, ..., tn>
+//
+// SortBy range partitions the slice: its rows are first sampled to
+// determine the key range of each shard, and then shuffled to the
+// shards whose ranges contain them, where they are sorted. Thus the
+// slice is read twice, but its output is computed only once.
+func SortBy(slice Slice, nshard int, keys ...SortKey) Slice {
+	if nshard <= 0 {
+		typecheck.Panicf(1, "sortby: nshard must be positive, got %d", nshard)
+	}
+	if err := sortio.SortKeys(keys).Check(slice); err != nil {
+		typecheck.Panicf(1, "sortby: %v", err)
+	}
+	order := sortOrder{keys: keys}
+	shardType := HashShard
+	if k := keys[0]; k.Column == 0 && k.Direction == sortio.Ascending && k.Nulls == sortio.NullsDefault {
+		shardType = RangeShard
+	}
+	return makeSortSlice("sortby", slice, nshard, order, shardType)
+}
+
+// SortByFunc returns a slice with nshard shards that contains the rows
+// of the provided slice, globally sorted by the function less, which
+// reports whether the row given by the first half of its arguments
+// sorts before the row given by the second half. Less must define a
+// strict weak ordering. SortByFunc is otherwise like SortBy.
+// Schematically:
+//
+//	SortByFunc(Slice<t1, ..., tn>, nshard, func(t1, ..., tn, t1, ..., tn) bool) Slice<t1, ..., tn>
+func SortByFunc(slice Slice, nshard int, less interface{}) Slice {
+	if nshard <= 0 {
+		typecheck.Panicf(1, "sortbyfunc: nshard must be positive, got %d", nshard)
+	}
+	arg, ret, ok := typecheck.Func(less)
+	if !ok {
+		typecheck.Panicf(1, "sortbyfunc: invalid less function %T", less)
+	}
+	if !typecheck.Equal(slicetype.Concat(slice, slice), arg) {
+		typecheck.Panicf(1, "sortbyfunc: less function %T does not match input slice type %s", less, slicetype.String(slice))
+	}
+	if ret.NumOut() != 1 || ret.Out(0).Kind() != reflect.Bool {
+		typecheck.Panic(1, "sortbyfunc: less function must return a single boolean value")
+	}
+	order := sortOrder{less: slicefunc.Of(less), numOut: slice.NumOut()}
+	return makeSortSlice("sortbyfunc", slice, nshard, order, HashShard)
+}
+
+// ReshuffleRange returns a slice with nshard shards that contains the
+// rows of the provided slice, range partitioned by its prefix columns:
+// all rows with equal prefix values are in the same shard, and the keys
+// of each shard sort after those of the shards that precede it. Unlike
+// SortBy, ReshuffleRange does not sort the rows within each shard.
+// Schematically:
+//
+//	ReshuffleRange(Slice<t1, ..., tn>, nshard) Slice<t1, ..., tn>
+//
+// Like SortBy, ReshuffleRange samples the slice's keys to determine the
+// key range of each shard, so that shards receive similar numbers of
+// rows, unless some keys are much more frequent than others: the rows
+// of a key are never split across shards. The prefix columns must be
+// comparable. ReshuffleRange is useful to write globally ordered
+// output files, each of which may be sorted independently.
+func ReshuffleRange(slice Slice, nshard int) Slice {
+	if nshard <= 0 {
+		typecheck.Panicf(1, "reshufflerange: nshard must be positive, got %d", nshard)
+	}
+	keys := make(sortio.SortKeys, slice.Prefix())
+	for i := range keys {
+		keys[i] = sortio.Asc(i)
+	}
+	if err := keys.Check(slice); err != nil {
+		typecheck.Panicf(1, "reshufflerange: %v", err)
+	}
+	s := makeSortSlice("reshufflerange", slice, nshard, sortOrder{keys: keys}, HashShard)
+	s.unsorted = true
+	return s
+}
+
+// A sortOrder orders rows either by sort keys or by a user-provided
+// less function.
+type sortOrder struct {
+	keys   sortio.SortKeys
+	less   slicefunc.Func
+	numOut int
+}
+
+// LessFunc returns the sortio.LessFunc of the order. User less
+// functions are invoked with the provided context.
+func (o sortOrder) LessFunc(ctx context.Context) sortio.LessFunc {
+	if o.keys != nil {
+		return o.keys.Less
+	}
+	args := make([]reflect.Value, 2*o.numOut)
+	return func(f frame.Frame, i, j int) bool {
+		for c := 0; c < o.numOut; c++ {
+			args[c] = f.Index(c, i)
+			args[o.numOut+c] = f.Index(c, j)
+		}
+		return o.less.Call(ctx, args)[0].Bool()
+	}
+}
+
+// makeSortSlice returns a slice that sorts the provided slice into
+// nshard range partitioned shards. The slice is materialized, so that
+// it is computed once, and read both by a sampling slice, which is
+// broadcast, and by a partitioning slice, which labels each row with
+// the shard to which it is shuffled.
+func makeSortSlice(op string, slice Slice, nshard int, order sortOrder, shardType ShardType) *sortSlice {
+	input := &materializedSlice{MakeName(op + "input"), slice}
+	perShard := (sortSamplesPerShard*nshard + slice.NumShard() - 1) / slice.NumShard()
+	sample := &sortSampleSlice{MakeName(op + "sample"), input, perShard}
+	out := append(slicetype.Columns(slice)[:slice.NumOut():slice.NumOut()], reflect.TypeOf(0))
+	partition := &sortPartitionSlice{
+		name:   MakeName(op + "partition"),
+		Slice:  input,
+		sample: sample,
+		nshard: nshard,
+		order:  order,
+		out:    slicetype.New(out...),
+	}
+	return &sortSlice{
+		name:      MakeName(fmt.Sprintf("%s(%d)", op, nshard)),
+		Slice:     slice,
+		partition: partition,
+		nshard:    nshard,
+		order:     order,
+		shardType: shardType,
+	}
+}
+
+// A materializedSlice is a pass-through slice whose output is
+// materialized, so that it is computed once by tasks of its own, even
+// if it is read by multiple slices.
+type materializedSlice struct {
+	name Name
+	Slice
+}
+
+func (m *materializedSlice) Name() Name             { return m.name }
+func (*materializedSlice) NumDep() int              { return 1 }
+func (m *materializedSlice) Dep(i int) Dep          { return singleDep(i, m.Slice, false) }
+func (*materializedSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (m *materializedSlice) MaxRows() int           { return maxRows(m.Slice) }
+
+func (*materializedSlice) Procs() int        { return 1 }
+func (*materializedSlice) Exclusive() bool   { return false }
+func (*materializedSlice) Materialize() bool { return true }
+func (*materializedSlice) Broadcast() bool   { return false }
+
+func (m *materializedSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
+
+// A sortSampleSlice samples up to n rows of each shard of its
+// dependency. Each shard is sampled with its own fixed seed, so that
+// recomputed samples are the same, and so are the key ranges that are
+// derived from them.
+type sortSampleSlice struct {
+	name Name
+	Slice
+	n int
+}
+
+func (s *sortSampleSlice) Name() Name             { return s.name }
+func (*sortSampleSlice) NumDep() int              { return 1 }
+func (s *sortSampleSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*sortSampleSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// MaxRows implements Sizer.
+func (s *sortSampleSlice) MaxRows() int { return s.n * s.NumShard() }
+
+func (s *sortSampleSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &sortSampleReader{op: s, reader: deps[0], rand: rand.New(rand.NewSource(int64(shard)))}
+}
+
+// sortSampleReader reads a reservoir sample of its underlying reader.
+type sortSampleReader struct {
+	op     *sortSampleSlice
+	reader sliceio.Reader
+	rand   *rand.Rand
+	sample frame.Frame
+	err    error
+}
+
+func (r *sortSampleReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 1024
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.sample.IsZero() {
+		r.sample = frame.Make(r.op, 0, r.op.n)
+		in := frame.Make(r.op, bufferSize, bufferSize)
+		var seen int
+		for {
+			n, err := r.reader.Read(ctx, in)
+			for i := 0; i < n; i++ {
+				switch j := seen; {
+				case j < r.op.n:
+					r.sample = r.sample.Grow(1)
+					frame.Copy(r.sample.Slice(j, j+1), in.Slice(i, i+1))
+				default:
+					if j = r.rand.Intn(seen + 1); j < r.op.n {
+						frame.Copy(r.sample.Slice(j, j+1), in.Slice(i, i+1))
+					}
+				}
+				seen++
+			}
+			if err == sliceio.EOF {
+				break
+			}
+			if err != nil {
+				r.err = err
+				return 0, err
+			}
+		}
+	}
+	n := frame.Copy(out, r.sample)
+	r.sample = r.sample.Slice(n, r.sample.Len())
+	if r.sample.Len() == 0 {
+		r.err = sliceio.EOF
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return n, r.err
+}
+
+// A sortPartitionSlice appends to each row of its dependency the shard
+// of the sorted slice to which it belongs, as determined by the key
+// ranges derived from the sample of the dependency, which is broadcast
+// to each of its shards.
+type sortPartitionSlice struct {
+	name Name
+	Slice
+	sample Slice
+	nshard int
+	order  sortOrder
+	out    slicetype.Type
+}
+
+func (p *sortPartitionSlice) Name() Name             { return p.name }
+func (p *sortPartitionSlice) NumOut() int            { return p.out.NumOut() }
+func (p *sortPartitionSlice) Out(c int) reflect.Type { return p.out.Out(c) }
+func (*sortPartitionSlice) NumDep() int              { return 2 }
+func (*sortPartitionSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (p *sortPartitionSlice) Dep(i int) Dep {
+	if i == 1 {
+		return Dep{p.sample, false, nil, false, true}
+	}
+	return Dep{p.Slice, false, nil, false, false}
+}
+
+func (p *sortPartitionSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &sortPartitionReader{op: p, reader: deps[0], sample: deps[1]}
+}
+
+type sortPartitionReader struct {
+	op     *sortPartitionSlice
+	reader sliceio.Reader
+	sample sliceio.Reader
+	err    error
+
+	// keys holds, in rows 1 through nshard-1, the smallest row of each
+	// shard but the first. Row 0 holds the row that is being
+	// partitioned.
+	keys frame.Frame
+	less sortio.LessFunc
+	in   frame.Frame
+}
+
+func (r *sortPartitionReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.less == nil {
+		r.less = r.op.order.LessFunc(ctx)
+		if r.err = r.loadKeys(ctx); r.err != nil {
+			return 0, r.err
+		}
+	}
+	typ := r.op.Slice
+	if r.in.IsZero() {
+		r.in = frame.Make(typ, out.Len(), out.Len())
+	}
+	r.in = r.in.Ensure(out.Len())
+	n, err := r.reader.Read(ctx, r.in.Slice(0, out.Len()))
+	cols := out.Values()
+	frame.Copy(frame.Values(cols[:typ.NumOut()]), r.in.Slice(0, n))
+	partitions := cols[typ.NumOut()]
+	nkey := r.keys.Len() - 1
+	for i := 0; i < n; i++ {
+		frame.Copy(r.keys.Slice(0, 1), r.in.Slice(i, i+1))
+		// Rows that are equal to a shard's smallest row belong to it.
+		p := sort.Search(nkey, func(k int) bool { return r.less(r.keys, 0, k+1) })
+		partitions.Index(i).SetInt(int64(p))
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// loadKeys reads and sorts the sample, and selects from it the
+// smallest row of each shard but the first, so that shards receive
+// similar numbers of rows.
+func (r *sortPartitionReader) loadKeys(ctx context.Context) error {
+	var (
+		typ    = r.op.Slice
+		sample = frame.Make(typ, 0, 0)
+		buf    = frame.Make(typ, 1024, 1024)
+	)
+	for {
+		n, err := r.sample.Read(ctx, buf)
+		sample = frame.AppendFrame(sample, buf.Slice(0, n))
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	sort.Sort(sortFrame{sample, r.less})
+	nkey := r.op.nshard - 1
+	if nkey > sample.Len() {
+		nkey = sample.Len()
+	}
+	r.keys = frame.Make(typ, nkey+1, nkey+1)
+	for k := 0; k < nkey; k++ {
+		i := (k + 1) * sample.Len() / (nkey + 1)
+		frame.Copy(r.keys.Slice(k+1, k+2), sample.Slice(i, i+1))
+	}
+	return nil
+}
+
+// sortFrame sorts a frame by a less function.
+type sortFrame struct {
+	frame.Frame
+	less sortio.LessFunc
+}
+
+func (s sortFrame) Less(i, j int) bool { return s.less(s.Frame, i, j) }
+
+// A sortSlice shuffles the rows labeled by a sortPartitionSlice to
+// their shards, each of which sorts its rows, unless unsorted is set.
+type sortSlice struct {
+	name Name
+	Slice
+	partition *sortPartitionSlice
+	nshard    int
+	order     sortOrder
+	shardType ShardType
+	unsorted  bool
+}
+
+func (s *sortSlice) Name() Name             { return s.name }
+func (s *sortSlice) NumShard() int          { return s.nshard }
+func (s *sortSlice) ShardType() ShardType   { return s.shardType }
+func (*sortSlice) NumDep() int              { return 1 }
+func (*sortSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (s *sortSlice) MaxRows() int           { return maxRows(s.Slice) }
+
+func (s *sortSlice) Dep(i int) Dep {
+	return Dep{s.partition, true, partitionByLastColumn, false, false}
+}
+
+// partitionByLastColumn is a Partitioner that assigns each row to the
+// partition given by its last column.
+func partitionByLastColumn(_ context.Context, f frame.Frame, nshard int, shards []int) {
+	col := f.Value(f.NumOut() - 1)
+	for i := range shards {
+		shards[i] = int(col.Index(i).Int())
+	}
+}
+
+func (s *sortSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	if s.unsorted {
+		return &dropLastColumnReader{reader: deps[0], typ: s.partition}
+	}
+	return &sortReader{op: s, reader: deps[0]}
+}
+
+type sortReader struct {
+	op     *sortSlice
+	reader sliceio.Reader
+	sorted sliceio.Reader
+	err    error
+}
+
+func (r *sortReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const spillSize = 1 << 25
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.sorted == nil {
+		in := &dropLastColumnReader{reader: r.reader, typ: r.op.partition}
+		r.sorted, r.err = sortio.SortReaderFunc(ctx, spillSize, r.op, r.op.order.LessFunc(ctx), in)
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+	var n int
+	n, r.err = r.sorted.Read(ctx, out)
+	return n, r.err
+}
+
+// dropLastColumnReader reads the rows of a reader of type typ, without
+// their last column.
+type dropLastColumnReader struct {
+	reader sliceio.Reader
+	typ    slicetype.Type
+	buf    frame.Frame
+}
+
+func (r *dropLastColumnReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.buf.IsZero() {
+		r.buf = frame.Make(r.typ, out.Len(), out.Len())
+	}
+	r.buf = r.buf.Ensure(out.Len())
+	n, err := r.reader.Read(ctx, r.buf.Slice(0, out.Len()))
+	cols := r.buf.Values()
+	frame.Copy(out, frame.Values(cols[:len(cols)-1]).Slice(0, n))
+	return n, err
+}
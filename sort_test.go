@@ -0,0 +1,156 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestSortBy(t *testing.T) {
+	const N = 1000
+	var (
+		keys   = make([]string, N)
+		groups = make([]int, N)
+		values = make([]int, N)
+	)
+	for i := range keys {
+		// Values are a permutation of 0..N-1.
+		values[i] = (i * 7) % N
+		keys[i] = fmt.Sprintf("%03d", values[i])
+		groups[i] = values[i] % 3
+	}
+	type row struct {
+		key          string
+		group, value int
+	}
+	expect := func(less func(r1, r2 row) bool) []interface{} {
+		rows := make([]row, N)
+		for i := range rows {
+			rows[i] = row{keys[i], groups[i], values[i]}
+		}
+		sort.Slice(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+		var (
+			k    = make([]string, N)
+			g, v = make([]int, N), make([]int, N)
+		)
+		for i, r := range rows {
+			k[i], g[i], v[i] = r.key, r.group, r.value
+		}
+		return []interface{}{k, g, v}
+	}
+	var (
+		asc      = expect(func(r1, r2 row) bool { return r1.value < r2.value })
+		desc     = expect(func(r1, r2 row) bool { return r1.value > r2.value })
+		multiKey = expect(func(r1, r2 row) bool {
+			if r1.group != r2.group {
+				return r1.group > r2.group
+			}
+			return r1.value < r2.value
+		})
+	)
+	for _, nshard := range []int{1, 3, 7} {
+		slice := bigslice.Const(5, keys, groups, values)
+		assertEqual(t, bigslice.SortBy(slice, nshard, bigslice.Asc(0)), false, asc...)
+		assertEqual(t, bigslice.SortBy(slice, nshard, bigslice.Desc(2)), false, desc...)
+		assertEqual(t, bigslice.SortBy(slice, nshard, bigslice.Desc(1), bigslice.Asc(2)), false, multiKey...)
+		// The columns have no nulls, and so their null ordering is moot.
+		assertEqual(t, bigslice.SortBy(slice, nshard, bigslice.Desc(1).WithNulls(bigslice.NullsLast), bigslice.Asc(2)), false, multiKey...)
+		assertEqual(t, bigslice.SortByFunc(slice, nshard, func(k1 string, g1, v1 int, k2 string, g2, v2 int) bool {
+			if g1 != g2 {
+				return g1 > g2
+			}
+			return v1 < v2
+		}), false, multiKey...)
+	}
+}
+
+func TestSortByShardType(t *testing.T) {
+	slice := bigslice.Const(2, []string{"a", "b"}, []int{1, 2})
+	if got, want := bigslice.SortBy(slice, 2, bigslice.Asc(0)).ShardType(), bigslice.RangeShard; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := bigslice.SortBy(slice, 2, bigslice.Desc(0)).ShardType(), bigslice.HashShard; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortByError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "sortby: nshard must be positive, got 0", func() {
+		bigslice.SortBy(input, 0, bigslice.Asc(0))
+	})
+	expectTypeError(t, "sortby: sortio: sort key column 2 out of range for slice[1]string,int", func() {
+		bigslice.SortBy(input, 1, bigslice.Asc(2))
+	})
+	expectTypeError(t, "sortbyfunc: less function func(int, int) bool does not match input slice type slice[1]string,int", func() {
+		bigslice.SortByFunc(input, 1, func(x, y int) bool { return false })
+	})
+	expectTypeError(t, "sortbyfunc: less function must return a single boolean value", func() {
+		bigslice.SortByFunc(input, 1, func(k1 string, v1 int, k2 string, v2 int) int { return 0 })
+	})
+}
+
+func TestReshuffleRange(t *testing.T) {
+	const (
+		N      = 10000
+		nshard = 4
+	)
+	var (
+		keys   = make([]string, N)
+		values = make([]int, N)
+	)
+	for i := range keys {
+		// Each key has two rows.
+		keys[i] = fmt.Sprintf("%04d", (i*7)%(N/2))
+		values[i] = i
+	}
+	slice := bigslice.Const(5, keys, values)
+	slice = bigslice.ReshuffleRange(slice, nshard)
+	if got, want := slice.NumShard(), nshard; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var (
+		mu     sync.Mutex
+		shards = make([][]string, nshard)
+	)
+	slice = bigslice.WriterFunc(slice, func(shard int, _ *int, err error, keys []string, values []int) error {
+		mu.Lock()
+		shards[shard] = append(shards[shard], keys...)
+		mu.Unlock()
+		return nil
+	})
+	slicetest.Run(t, slice)
+	var prev string
+	for shard, keys := range shards {
+		// Shards receive similar numbers of rows.
+		if got, min, max := len(keys), N/nshard/2, 2*N/nshard; got < min || got > max {
+			t.Errorf("shard %d: got %v rows, want [%v, %v]", shard, got, min, max)
+		}
+		sort.Strings(keys)
+		// Shards hold disjoint, increasing key ranges.
+		if len(keys) > 0 && shard > 0 && keys[0] <= prev {
+			t.Errorf("shard %d: key %s does not follow %s", shard, keys[0], prev)
+		}
+		if len(keys) > 0 {
+			prev = keys[len(keys)-1]
+		}
+	}
+	assertEqual(t, bigslice.ReshuffleRange(bigslice.Const(5, keys, values), 3), true, keys, values)
+}
+
+func TestReshuffleRangeError(t *testing.T) {
+	expectTypeError(t, "reshufflerange: nshard must be positive, got 0", func() {
+		bigslice.ReshuffleRange(bigslice.Const(1, []string{"x"}), 0)
+	})
+	expectTypeError(t, "reshufflerange: sortio: sort key column 0 of type []int is not comparable", func() {
+		bigslice.ReshuffleRange(bigslice.Const(1, [][]int{{1}}), 1)
+	})
+}
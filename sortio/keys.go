@@ -0,0 +1,162 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sortio
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// Direction is the direction in which a sort key column is ordered.
+type Direction int
+
+const (
+	// Ascending orders smaller values first.
+	Ascending Direction = iota
+	// Descending orders larger values first.
+	Descending
+)
+
+// NullOrder determines where null values of a sort key column are
+// ordered. Null values are the nulls of nullable frame columns (see
+// frame.Frame.IsNull), and the nil values of columns whose values may
+// be nil (pointers, interfaces, slices, maps, channels, and funcs).
+type NullOrder int
+
+const (
+	// NullsDefault orders null values as the column's type does, respecting
+	// the key's direction.
+	NullsDefault NullOrder = iota
+	// NullsFirst orders null values before all other values, regardless of
+	// the key's direction.
+	NullsFirst
+	// NullsLast orders null values after all other values, regardless of
+	// the key's direction.
+	NullsLast
+)
+
+// A SortKey describes how a single column participates in a sort.
+type SortKey struct {
+	// Column is the index of the column.
+	Column int
+	// Direction is the direction in which the column is ordered.
+	Direction Direction
+	// Nulls determines where null values are ordered.
+	Nulls NullOrder
+}
+
+// Asc returns an ascending sort key on column col.
+func Asc(col int) SortKey {
+	return SortKey{Column: col, Direction: Ascending}
+}
+
+// Desc returns a descending sort key on column col.
+func Desc(col int) SortKey {
+	return SortKey{Column: col, Direction: Descending}
+}
+
+// WithNulls returns k with null values ordered according to nulls.
+func (k SortKey) WithNulls(nulls NullOrder) SortKey {
+	k.Nulls = nulls
+	return k
+}
+
+// SortKeys is a declarative, multi-column sort specification. Rows are
+// compared by each key in turn; later keys break ties of earlier ones.
+// The bigslice package exports the sort key API to users (see
+// bigslice.SortKey).
+type SortKeys []SortKey
+
+// PrefixKeys returns the sort keys corresponding to the default
+// ordering of typ: its prefix columns, in ascending order.
+func PrefixKeys(typ slicetype.Type) SortKeys {
+	keys := make(SortKeys, typ.Prefix())
+	for i := range keys {
+		keys[i] = Asc(i)
+	}
+	return keys
+}
+
+// Check returns an error if keys do not describe a valid sort of rows
+// of type typ: each key must refer to a distinct, comparable column.
+func (keys SortKeys) Check(typ slicetype.Type) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("sortio: no sort keys")
+	}
+	seen := make(map[int]bool)
+	for _, k := range keys {
+		if k.Column < 0 || k.Column >= typ.NumOut() {
+			return fmt.Errorf("sortio: sort key column %d out of range for %s", k.Column, slicetype.String(typ))
+		}
+		if seen[k.Column] {
+			return fmt.Errorf("sortio: duplicate sort key column %d", k.Column)
+		}
+		seen[k.Column] = true
+		if !frame.CanCompare(typ.Out(k.Column)) {
+			return fmt.Errorf("sortio: sort key column %d of type %s is not comparable", k.Column, typ.Out(k.Column))
+		}
+		if k.Direction != Ascending && k.Direction != Descending {
+			return fmt.Errorf("sortio: invalid direction %d for column %d", k.Direction, k.Column)
+		}
+		if k.Nulls < NullsDefault || k.Nulls > NullsLast {
+			return fmt.Errorf("sortio: invalid null ordering %d for column %d", k.Nulls, k.Column)
+		}
+	}
+	return nil
+}
+
+// Less reports whether row i of frame f should sort before row j
+// according to keys.
+func (keys SortKeys) Less(f frame.Frame, i, j int) bool {
+	for _, k := range keys {
+		if k.Nulls != NullsDefault && (f.Nullable(k.Column) || nillable(f.Out(k.Column))) {
+			ni, nj := isNull(f, k.Column, i), isNull(f, k.Column, j)
+			switch {
+			case ni && nj:
+				continue
+			case ni:
+				return k.Nulls == NullsFirst
+			case nj:
+				return k.Nulls == NullsLast
+			}
+		}
+		a, b := i, j
+		if k.Direction == Descending {
+			a, b = j, i
+		}
+		switch {
+		case f.LessColumn(k.Column, a, b):
+			return true
+		case f.LessColumn(k.Column, b, a):
+			return false
+		}
+	}
+	return false
+}
+
+// isNull tells whether row i of column col of frame f is null.
+func isNull(f frame.Frame, col, i int) bool {
+	return f.IsNull(col, i) || nillable(f.Out(col)) && f.Index(col, i).IsNil()
+}
+
+func nillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+		return true
+	}
+	return false
+}
+
+// lessSorter implements sort.Interface for a frame ordered by a less
+// function, e.g., that of a set of sort keys.
+type lessSorter struct {
+	frame.Frame
+	less LessFunc
+}
+
+func (s lessSorter) Less(i, j int) bool { return s.less(s.Frame, i, j) }
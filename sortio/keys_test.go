@@ -0,0 +1,126 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sortio
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+func TestSortKeys(t *testing.T) {
+	f := frame.Slices(
+		[]string{"a", "b", "a", "c", "b", "a"},
+		[]int{1, 2, 3, 1, 5, 2},
+	)
+	keys := SortKeys{Asc(0), Desc(1)}
+	if err := keys.Check(f); err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(lessSorter{f, keys.Less})
+	if got, want := f.Interface(0), []string{"a", "a", "a", "b", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := f.Interface(1), []int{3, 2, 1, 5, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	keys = SortKeys{Desc(1), Desc(0)}
+	sort.Sort(lessSorter{f, keys.Less})
+	if got, want := f.Interface(0), []string{"b", "a", "b", "a", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := f.Interface(1), []int{5, 3, 2, 2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortKeysNulls(t *testing.T) {
+	for _, c := range []struct {
+		key  SortKey
+		want []string
+	}{
+		{Asc(0), []string{"", "", "a", "b"}},
+		{Asc(0).WithNulls(NullsLast), []string{"a", "b", "", ""}},
+		{Desc(0), []string{"b", "a", "", ""}},
+		{Desc(0).WithNulls(NullsFirst), []string{"", "", "b", "a"}},
+	} {
+		f := frame.Slices([][]byte{[]byte("b"), nil, []byte("a"), nil})
+		sort.Stable(lessSorter{f, SortKeys{c.key}.Less})
+		var got []string
+		for _, b := range f.Interface(0).([][]byte) {
+			got = append(got, string(b))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: got %q, want %q", c.key, got, c.want)
+		}
+	}
+}
+
+func TestSortKeysFrameNulls(t *testing.T) {
+	f := frame.Slices([]int{3, 0, 1, 0}, []string{"c", "null1", "a", "null2"})
+	f.SetNull(0, 1, true)
+	f.SetNull(0, 3, true)
+	sort.Stable(lessSorter{f, SortKeys{Desc(0).WithNulls(NullsLast)}.Less})
+	if got, want := f.Interface(1), []string{"c", "a", "null1", "null2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !f.IsNull(0, 2) || !f.IsNull(0, 3) || f.IsNull(0, 0) || f.IsNull(0, 1) {
+		t.Error("nulls were not swapped with their rows")
+	}
+}
+
+func TestSortKeysCheck(t *testing.T) {
+	typ := slicetype.New(typeOfString, typeOfInt, reflect.TypeOf(map[int]int{}))
+	for _, keys := range []SortKeys{
+		nil,
+		{Asc(3)},
+		{Asc(0), Desc(0)},
+		{Asc(2)},
+		{{Column: 1, Direction: 2}},
+	} {
+		if err := keys.Check(typ); err == nil {
+			t.Errorf("%v: expected error", keys)
+		}
+	}
+	if err := PrefixKeys(typ).Check(typ); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSortReaderKeys(t *testing.T) {
+	const N = 1 << 16
+	var (
+		fz   = fuzz.NewWithSeed(123456)
+		r    = &fuzzReader{fz, N, frame.Frame{}}
+		ctx  = context.Background()
+		typ  = slicetype.New(typeOfInt, typeOfString)
+		keys = SortKeys{Desc(1), Asc(0)}
+	)
+	fz.NumElements(0, 2)
+	sorted, err := SortReaderKeys(ctx, 1<<14, typ, keys, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := frame.Make(typ, N, N)
+	n, err := sliceio.ReadFull(ctx, sorted, out)
+	if err != nil && err != sliceio.EOF {
+		t.Fatal(err)
+	}
+	if got, want := n, N; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i := 1; i < n; i++ {
+		if keys.Less(out, i, i-1) {
+			t.Fatalf("row %d out of order", i)
+		}
+	}
+}
@@ -29,6 +29,31 @@ var numCanaryRows = &defaultsize.SortCanary
 // is revisited on every subsequent fill and adjusted if it is
 // violated by more than 5%.
 func SortReader(ctx context.Context, spillTarget int, typ slicetype.Type, r sliceio.Reader) (sliceio.Reader, error) {
+	return sortReader(ctx, spillTarget, typ, nil, r)
+}
+
+// SortReaderKeys is like SortReader, but sorts the reader's rows by the
+// provided sort keys instead of by its prefix columns. SortReaderKeys
+// returns an error if the keys are not valid for typ.
+func SortReaderKeys(ctx context.Context, spillTarget int, typ slicetype.Type, keys SortKeys, r sliceio.Reader) (sliceio.Reader, error) {
+	if err := keys.Check(typ); err != nil {
+		return nil, err
+	}
+	return sortReader(ctx, spillTarget, typ, keys.Less, r)
+}
+
+// A LessFunc reports whether row i of frame f sorts before row j.
+type LessFunc func(f frame.Frame, i, j int) bool
+
+// SortReaderFunc is like SortReader, but sorts the reader's rows by
+// the provided less function instead of by its prefix columns. Less
+// must define a strict weak ordering of the rows.
+func SortReaderFunc(ctx context.Context, spillTarget int, typ slicetype.Type, less LessFunc, r sliceio.Reader) (sliceio.Reader, error) {
+	return sortReader(ctx, spillTarget, typ, less, r)
+}
+
+// sortReader sorts r by less, or by its prefix columns if less is nil.
+func sortReader(ctx context.Context, spillTarget int, typ slicetype.Type, less LessFunc, r sliceio.Reader) (sliceio.Reader, error) {
 	spill, err := sliceio.NewSpiller("sorter")
 	if err != nil {
 		return nil, err
@@ -49,7 +74,11 @@ func SortReader(ctx context.Context, spillTarget int, typ slicetype.Type, r slic
 		}
 		eof := err == sliceio.EOF
 		g := f.Slice(0, n)
-		sort.Sort(g)
+		if less == nil {
+			sort.Sort(g)
+		} else {
+			sort.Sort(lessSorter{g, less})
+		}
 		var size int
 		size, err = spill.Spill(g)
 		if err != nil {
@@ -72,7 +101,7 @@ func SortReader(ctx context.Context, spillTarget int, typ slicetype.Type, r slic
 	if err != nil {
 		return nil, err
 	}
-	return NewMergeReader(ctx, typ, readers)
+	return newMergeReader(ctx, typ, less, readers)
 }
 
 // A FrameBuffer is a buffered frame. The frame is filled from
@@ -119,7 +148,10 @@ func (f *FrameBuffer) Fill(ctx context.Context) error {
 }
 
 // FrameBufferHeap implements a heap of FrameBuffers,
-// ordered by the provided sorter.
+// ordered by the provided sorter. Ties are broken by the buffers'
+// offsets, so that records with equal keys are merged in the order of
+// the buffers' readers, independently of how the readers happen to
+// chunk their data.
 type FrameBufferHeap struct {
 	Buffers []*FrameBuffer
 	// Less compares the current index of buffers i and j.
@@ -128,7 +160,14 @@ type FrameBufferHeap struct {
 
 func (f *FrameBufferHeap) Len() int { return len(f.Buffers) }
 func (f *FrameBufferHeap) Less(i, j int) bool {
-	return f.LessFunc(i, j)
+	switch {
+	case f.LessFunc(i, j):
+		return true
+	case f.LessFunc(j, i):
+		return false
+	default:
+		return f.Buffers[i].Off < f.Buffers[j].Off
+	}
 }
 func (f *FrameBufferHeap) Swap(i, j int) {
 	f.Buffers[i], f.Buffers[j] = f.Buffers[j], f.Buffers[i]
@@ -159,12 +198,38 @@ type mergeReader struct {
 // NewMergeReader returns a new Reader that is sorted by its prefix columns. The
 // readers to be merged must already be sorted.
 func NewMergeReader(ctx context.Context, typ slicetype.Type, readers []sliceio.Reader) (sliceio.Reader, error) {
+	return newMergeReader(ctx, typ, nil, readers)
+}
+
+// NewMergeReaderKeys returns a new Reader that is sorted by the provided sort
+// keys. The readers to be merged must already be sorted by the same keys.
+func NewMergeReaderKeys(ctx context.Context, typ slicetype.Type, keys SortKeys, readers []sliceio.Reader) (sliceio.Reader, error) {
+	if err := keys.Check(typ); err != nil {
+		return nil, err
+	}
+	return newMergeReader(ctx, typ, keys.Less, readers)
+}
+
+// NewMergeReaderFunc returns a new Reader that is sorted by the provided
+// less function. The readers to be merged must already be sorted by
+// the same function.
+func NewMergeReaderFunc(ctx context.Context, typ slicetype.Type, less LessFunc, readers []sliceio.Reader) (sliceio.Reader, error) {
+	return newMergeReader(ctx, typ, less, readers)
+}
+
+func newMergeReader(ctx context.Context, typ slicetype.Type, less LessFunc, readers []sliceio.Reader) (sliceio.Reader, error) {
 	h := new(FrameBufferHeap)
 	h.Buffers = make([]*FrameBuffer, 0, len(readers))
 	n := len(readers) * sliceio.SpillBatchSize
 	f := frame.Make(typ, n, n)
-	h.LessFunc = func(i, j int) bool {
-		return f.Less(h.Buffers[i].Pos(), h.Buffers[j].Pos())
+	if less == nil {
+		h.LessFunc = func(i, j int) bool {
+			return f.Less(h.Buffers[i].Pos(), h.Buffers[j].Pos())
+		}
+	} else {
+		h.LessFunc = func(i, j int) bool {
+			return less(f, h.Buffers[i].Pos(), h.Buffers[j].Pos())
+		}
 	}
 	for i := range readers {
 		off := i * sliceio.SpillBatchSize
@@ -6,9 +6,11 @@ package sortio
 
 import (
 	"context"
+	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	fuzz "github.com/google/gofuzz"
 	"github.com/grailbio/bigslice/frame"
@@ -157,6 +159,64 @@ func TestMergeReader(t *testing.T) {
 	}
 }
 
+// chunkReader reads from an underlying reader in randomly sized chunks.
+type chunkReader struct {
+	sliceio.Reader
+	rnd *rand.Rand
+}
+
+func (c *chunkReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if n := out.Len(); n > 1 {
+		out = out.Slice(0, 1+c.rnd.Intn(n-1))
+	}
+	return c.Reader.Read(ctx, out)
+}
+
+func TestMergeReaderStable(t *testing.T) {
+	const (
+		N = 1000
+		M = 10
+	)
+	var (
+		rnd     = rand.New(rand.NewSource(0))
+		readers = make([]sliceio.Reader, M)
+	)
+	for i := range readers {
+		var (
+			keys = make([]int, N)
+			vals = make([]int, N)
+		)
+		for j := range keys {
+			keys[j] = j / 100
+			vals[j] = i
+		}
+		readers[i] = &chunkReader{sliceio.FrameReader(frame.Slices(keys, vals)), rnd}
+	}
+	ctx := context.Background()
+	m, err := NewMergeReader(ctx, slicetype.New(typeOfInt, typeOfInt), readers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := frame.Make(slicetype.New(typeOfInt, typeOfInt), N*M, N*M)
+	n, err := sliceio.ReadFull(ctx, m, out)
+	if err != nil && err != sliceio.EOF {
+		t.Fatal(err)
+	}
+	if got, want := n, N*M; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// Records with equal keys must appear in reader order.
+	var (
+		keys = out.Interface(0).([]int)
+		vals = out.Interface(1).([]int)
+	)
+	for i := 1; i < n; i++ {
+		if keys[i] == keys[i-1] && vals[i] < vals[i-1] {
+			t.Fatalf("row %d: key %d: reader %d merged after reader %d", i, keys[i], vals[i], vals[i-1])
+		}
+	}
+}
+
 func TestSortReader(t *testing.T) {
 	const N = 1 << 20
 	var (
@@ -261,3 +321,38 @@ func TestReduceReader(t *testing.T) {
 		}
 	}
 }
+
+func TestSortReaderDecimalTime(t *testing.T) {
+	const N = 10000
+	var (
+		ctx   = context.Background()
+		r     = rand.New(rand.NewSource(0))
+		decs  = make([]slicetype.Decimal, N)
+		times = make([]time.Time, N)
+	)
+	for i := range decs {
+		// Equal values are represented with different scales.
+		scale := r.Intn(3)
+		unscaled := int64(r.Intn(1000) - 500)
+		for j := 0; j < scale; j++ {
+			unscaled *= 10
+		}
+		decs[i] = slicetype.NewDecimal(unscaled, scale)
+		zone := time.FixedZone("", 3600*(r.Intn(24)-12))
+		times[i] = time.Unix(int64(r.Intn(1e9)), 0).In(zone)
+	}
+	for _, col := range []interface{}{decs, times} {
+		in := frame.Slices(col)
+		sorted, err := SortReader(ctx, 1<<10, in, sliceio.FrameReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := frame.Make(in, N, N)
+		if n, err := sliceio.ReadFull(ctx, sorted, out); err != nil && err != sliceio.EOF || n != N {
+			t.Fatalf("got %v, %v, want %v", n, err, N)
+		}
+		if !sort.IsSorted(out) {
+			t.Errorf("%s: output not sorted", out.Out(0))
+		}
+	}
+}
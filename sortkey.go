@@ -0,0 +1,50 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import "github.com/grailbio/bigslice/sortio"
+
+// A SortKey declares how a single column participates in a sort: the
+// column's index, the direction in which it is ordered, and where its
+// null values are ordered. Slices are sorted by sort keys with SortBy,
+// and the values of ReduceReader groups are secondarily sorted by them.
+// Multiple keys are compared in turn; later keys break ties of earlier
+// ones. For example, to sort a slice by descending score (column 2),
+// with nulls last, and then by ascending name (column 0):
+//
+//	SortBy(slice, nshard, Desc(2).WithNulls(NullsLast), Asc(0))
+type SortKey = sortio.SortKey
+
+// Direction is the direction in which a sort key column is ordered.
+type Direction = sortio.Direction
+
+// NullOrder determines where the null values of a sort key column are
+// ordered.
+type NullOrder = sortio.NullOrder
+
+const (
+	// Ascending orders smaller values first.
+	Ascending = sortio.Ascending
+	// Descending orders larger values first.
+	Descending = sortio.Descending
+)
+
+const (
+	// NullsDefault orders null values as the column's type does,
+	// respecting the key's direction.
+	NullsDefault = sortio.NullsDefault
+	// NullsFirst orders null values before all other values, regardless
+	// of the key's direction.
+	NullsFirst = sortio.NullsFirst
+	// NullsLast orders null values after all other values, regardless of
+	// the key's direction.
+	NullsLast = sortio.NullsLast
+)
+
+// Asc returns an ascending sort key on column col.
+func Asc(col int) SortKey { return sortio.Asc(col) }
+
+// Desc returns a descending sort key on column col.
+func Desc(col int) SortKey { return sortio.Desc(col) }
@@ -0,0 +1,475 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var (
+	typeOfFloat64     = reflect.TypeOf(0.0)
+	typeOfStrataCount = reflect.TypeOf(strataCount{})
+)
+
+// StratifiedSample returns a random sample of the provided slice in
+// which each row is included independently, with a probability that
+// depends on its key, i.e., its first column. Fractions are given by
+// fracs, a map[k]float64 from keys to sampling fractions; rows whose
+// keys are not in the map are always included. This allows imbalanced
+// datasets to be downsampled per class in a single pass:
+//
+//	sample, counts := StratifiedSample(Slice<k, ...>, map[k]float64, seed)
+//
+// StratifiedSample also returns the exact number of rows of each key,
+// and the number of them that were sampled, as a slice computed in the
+// same pass over the input:
+//
+//	counts: Slice<k, int, int>
+//
+// As with Sample, the sample is determined by seed, and is evaluated
+// shard by shard, without a shuffle.
+func StratifiedSample(slice Slice, fracs interface{}, seed int64) (sample, counts Slice) {
+	m := checkStrata("stratifiedsample", slice, fracs, typeOfFloat64)
+	for _, key := range m.MapKeys() {
+		if frac := m.MapIndex(key).Float(); frac < 0 || frac > 1 {
+			typecheck.Panicf(1, "stratifiedsample: fraction %v of key %v is not in [0, 1]", frac, key)
+		}
+	}
+	return makeStrata("stratifiedsample", slice, m, seed, false)
+}
+
+// StratifiedSampleN returns a random sample of the provided slice that
+// contains, for each key, i.e., value of the first column, a target
+// number of rows. Targets are given by n, a map[k]int from keys to
+// target counts; each key with fewer rows than its target is included
+// in full, as are keys that are not in the map. Rows are shuffled by
+// key, and the sample of each key is drawn uniformly by reservoir
+// sampling, which keeps the targeted rows of each key in memory.
+// Schematically:
+//
+//	sample, counts := StratifiedSampleN(Slice<k, ...>, map[k]int, seed)
+//
+// As with StratifiedSample, the exact number of rows of each key, and
+// the number of them that were sampled, are returned as a slice
+// computed in the same pass over the input.
+func StratifiedSampleN(slice Slice, n interface{}, seed int64) (sample, counts Slice) {
+	m := checkStrata("stratifiedsamplen", slice, n, typeOfInt)
+	for _, key := range m.MapKeys() {
+		if target := m.MapIndex(key).Int(); target < 0 {
+			typecheck.Panicf(1, "stratifiedsamplen: target %d of key %v is negative", target, key)
+		}
+	}
+	if !frame.CanHash(slice.Out(0)) {
+		typecheck.Panicf(1, "stratifiedsamplen: key type %s cannot be hashed", slice.Out(0))
+	}
+	return makeStrata("stratifiedsamplen", slice, m, seed, true)
+}
+
+// checkStrata panics with a type error if strata is not a map from
+// the key type of slice to elem, and returns its value otherwise.
+func checkStrata(op string, slice Slice, strata interface{}, elem reflect.Type) reflect.Value {
+	if slice.NumOut() == 0 {
+		typecheck.Panicf(2, "%s: slice %s has no columns", op, slicetype.String(slice))
+	}
+	m := reflect.ValueOf(strata)
+	if want := reflect.MapOf(slice.Out(0), elem); m.Type() != want {
+		typecheck.Panicf(2, "%s: expected %s, got %T", op, want, strata)
+	}
+	if err := canMakeCombiningFrame(slicetype.New(slice.Out(0), typeOfStrataCount)); err != nil {
+		typecheck.Panicf(2, "%s: %v", op, err)
+	}
+	return m
+}
+
+func makeStrata(op string, slice Slice, strata reflect.Value, seed int64, shuffle bool) (sample, counts Slice) {
+	out := append(slicetype.Columns(slice)[:slice.NumOut():slice.NumOut()], typeOfInt, typeOfInt)
+	s := &strataSlice{
+		name:    MakeName(op),
+		Slice:   slice,
+		strata:  strata,
+		seed:    seed,
+		shuffle: shuffle,
+		out:     slicetype.New(out...),
+	}
+	sample = &strataProjectSlice{
+		name:   MakeName(op + "sample"),
+		Slice:  s,
+		out:    slice,
+		prefix: slice.Prefix(),
+	}
+	counts = Reduce(&strataProjectSlice{
+		name:   MakeName(op + "counts"),
+		Slice:  s,
+		counts: true,
+		out:    slicetype.New(slice.Out(0), typeOfStrataCount),
+		prefix: 1,
+	}, addStrataCounts)
+	counts = &strataCountsSlice{MakeName(op + "counts"), counts}
+	return sample, counts
+}
+
+// A strataCount holds the number of rows of a key, and the number of
+// them that were sampled.
+type strataCount struct {
+	N, Sampled int
+}
+
+func addStrataCounts(c, d strataCount) strataCount {
+	return strataCount{c.N + d.N, c.Sampled + d.Sampled}
+}
+
+// A strataSlice samples the rows of its dependency by key. Each shard
+// emits the rows that were sampled, followed by a count row for each
+// of its keys. Two columns are appended to the dependency's: they are
+// zero in sampled rows, and hold the key's counts in count rows, whose
+// value columns are zero. The slice is materialized, so that the
+// sample and the counts are computed in a single pass.
+type strataSlice struct {
+	name Name
+	Slice
+	// strata maps keys to fractions, or to target counts if shuffle is
+	// true.
+	strata  reflect.Value
+	seed    int64
+	shuffle bool
+	out     slicetype.Type
+}
+
+func (s *strataSlice) Name() Name             { return s.name }
+func (s *strataSlice) NumOut() int            { return s.out.NumOut() }
+func (s *strataSlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (*strataSlice) NumDep() int              { return 1 }
+func (*strataSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (s *strataSlice) ShardType() ShardType {
+	if s.shuffle {
+		return HashShard
+	}
+	return s.Slice.ShardType()
+}
+
+func (s *strataSlice) Dep(i int) Dep {
+	if s.shuffle {
+		return Dep{s.Slice, true, partitionByFirstColumn, false, false}
+	}
+	return singleDep(i, s.Slice, false)
+}
+
+func (*strataSlice) Procs() int        { return 1 }
+func (*strataSlice) Exclusive() bool   { return false }
+func (*strataSlice) Materialize() bool { return true }
+
+// partitionByFirstColumn is a Partitioner that assigns each row to a
+// partition by the hash of its first column.
+func partitionByFirstColumn(_ context.Context, f frame.Frame, nshard int, shards []int) {
+	keys := frame.Values([]reflect.Value{f.Value(0)})
+	for i := range shards {
+		shards[i] = int(keys.Hash(i) % uint32(nshard))
+	}
+}
+
+func (s *strataSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	seed := int64(uint64(s.seed) ^ (uint64(shard)+1)*0x9e3779b97f4a7c15)
+	return &strataReader{
+		op:     s,
+		reader: deps[0],
+		rand:   rand.New(rand.NewSource(seed)),
+		strata: make(map[interface{}]*stratum),
+	}
+}
+
+// A stratum holds the state of a key in a shard.
+type stratum struct {
+	key reflect.Value
+	strataCount
+	// target is the target number of sampled rows of a key of a
+	// StratifiedSampleN, or -1 if its rows are not reservoir sampled.
+	target int
+	// reservoir holds the rows sampled so far, if target >= 0.
+	reservoir frame.Frame
+}
+
+type strataReader struct {
+	op     *strataSlice
+	reader sliceio.Reader
+	rand   *rand.Rand
+	in     frame.Frame
+	eof    bool
+	err    error
+
+	strata map[interface{}]*stratum
+	// keys lists the strata in the order in which their keys were
+	// first read.
+	keys []*stratum
+	// pending holds the reservoirs and count rows that are emitted once
+	// the dependency has been read; beg indexes the next row.
+	pending frame.Frame
+	beg     int
+}
+
+func (r *strataReader) stratum(key reflect.Value) *stratum {
+	k := key.Interface()
+	if s := r.strata[k]; s != nil {
+		return s
+	}
+	// The key is copied, since the frame from which it is read is
+	// reused.
+	s := &stratum{key: reflect.New(key.Type()).Elem(), target: -1}
+	s.key.Set(key)
+	if r.op.shuffle {
+		if target := r.op.strata.MapIndex(key); target.IsValid() {
+			s.target = int(target.Int())
+			s.reservoir = frame.Make(r.op.Slice, 0, s.target)
+		}
+	}
+	r.strata[k] = s
+	r.keys = append(r.keys, s)
+	return s
+}
+
+// sample tells whether row i of the input frame is sampled now; rows
+// that are reservoir sampled are instead added to the reservoir of
+// their key.
+func (r *strataReader) sample(i int) bool {
+	s := r.stratum(r.in.Index(0, i))
+	s.N++
+	if !r.op.shuffle {
+		frac := r.op.strata.MapIndex(s.key)
+		if !frac.IsValid() || r.rand.Float64() < frac.Float() {
+			s.Sampled++
+			return true
+		}
+		return false
+	}
+	switch {
+	case s.target < 0:
+		s.Sampled++
+		return true
+	case s.reservoir.Len() < s.target:
+		s.reservoir = frame.AppendFrame(s.reservoir, r.in.Slice(i, i+1))
+	default:
+		if j := r.rand.Intn(s.N); j < s.target {
+			frame.Copy(s.reservoir.Slice(j, j+1), r.in.Slice(i, i+1))
+		}
+	}
+	return false
+}
+
+// finish computes the rows that are emitted once the dependency has
+// been read: the reservoirs, followed by the count rows.
+func (r *strataReader) finish() {
+	var n int
+	for _, s := range r.keys {
+		if s.target >= 0 {
+			s.Sampled = s.reservoir.Len()
+			n += s.Sampled
+		}
+	}
+	var (
+		ncols = r.op.Slice.NumOut()
+		i     int
+	)
+	// Sampled rows, and the value columns of count rows, have zero
+	// counts, as made.
+	r.pending = frame.Make(r.op, n+len(r.keys), n+len(r.keys))
+	for _, s := range r.keys {
+		if s.target < 0 {
+			continue
+		}
+		rows := s.reservoir.Len()
+		for c := 0; c < ncols; c++ {
+			reflect.Copy(r.pending.Value(c).Slice(i, i+rows), s.reservoir.Value(c))
+		}
+		i += rows
+	}
+	for _, s := range r.keys {
+		r.pending.Index(0, i).Set(s.key)
+		r.pending.Index(ncols, i).SetInt(int64(s.N))
+		r.pending.Index(ncols+1, i).SetInt(int64(s.Sampled))
+		i++
+	}
+}
+
+func (r *strataReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		m     int
+		max   = out.Len()
+		ncols = r.op.Slice.NumOut()
+	)
+	for m < max && !r.eof {
+		if r.in.IsZero() {
+			r.in = frame.Make(r.op.Slice, max-m, max-m)
+		} else {
+			r.in = r.in.Ensure(max - m)
+		}
+		n, err := r.reader.Read(ctx, r.in)
+		if err == sliceio.EOF {
+			r.eof = true
+			r.finish()
+		} else if err != nil {
+			r.err = err
+			return m, err
+		}
+		for i := 0; i < n; i++ {
+			if !r.sample(i) {
+				continue
+			}
+			for c := 0; c < ncols; c++ {
+				out.Index(c, m).Set(r.in.Index(c, i))
+			}
+			out.Index(ncols, m).SetInt(0)
+			out.Index(ncols+1, m).SetInt(0)
+			m++
+		}
+	}
+	if !r.eof {
+		return m, nil
+	}
+	n := frame.Copy(out.Slice(m, max), r.pending.Slice(r.beg, r.pending.Len()))
+	r.beg += n
+	m += n
+	if r.beg == r.pending.Len() {
+		r.err = sliceio.EOF
+	}
+	if m > 0 {
+		return m, nil
+	}
+	return 0, r.err
+}
+
+// A strataProjectSlice projects the output of a strataSlice: either
+// its sampled rows, without the count columns, or its count rows, as
+// a key and its strataCount.
+type strataProjectSlice struct {
+	name Name
+	Slice
+	counts bool
+	out    slicetype.Type
+	prefix int
+}
+
+func (s *strataProjectSlice) Name() Name             { return s.name }
+func (s *strataProjectSlice) NumOut() int            { return s.out.NumOut() }
+func (s *strataProjectSlice) Out(c int) reflect.Type { return s.out.Out(c) }
+func (s *strataProjectSlice) Prefix() int            { return s.prefix }
+func (*strataProjectSlice) NumDep() int              { return 1 }
+func (s *strataProjectSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*strataProjectSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (s *strataProjectSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &strataProjectReader{op: s, reader: deps[0]}
+}
+
+type strataProjectReader struct {
+	op     *strataProjectSlice
+	reader sliceio.Reader
+	in     frame.Frame
+	err    error
+}
+
+func (r *strataProjectReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	var (
+		m     int
+		max   = out.Len()
+		ncols = r.op.Slice.NumOut() - 2
+	)
+	for m < max && r.err == nil {
+		if r.in.IsZero() {
+			r.in = frame.Make(r.op.Slice, max-m, max-m)
+		} else {
+			r.in = r.in.Ensure(max - m)
+		}
+		var n int
+		n, r.err = r.reader.Read(ctx, r.in)
+		for i := 0; i < n; i++ {
+			count := strataCount{int(r.in.Index(ncols, i).Int()), int(r.in.Index(ncols+1, i).Int())}
+			// Count rows are the only rows with a nonzero count, since
+			// every key in a shard has at least one row.
+			if isCount := count.N > 0; isCount != r.op.counts {
+				continue
+			}
+			if r.op.counts {
+				out.Index(0, m).Set(r.in.Index(0, i))
+				out.Index(1, m).Set(reflect.ValueOf(count))
+			} else {
+				for c := 0; c < ncols; c++ {
+					out.Index(c, m).Set(r.in.Index(c, i))
+				}
+			}
+			m++
+		}
+	}
+	return m, r.err
+}
+
+// A strataCountsSlice flattens the reduced strataCounts of each key
+// into two int columns.
+type strataCountsSlice struct {
+	name Name
+	Slice
+}
+
+func (s *strataCountsSlice) Name() Name { return s.name }
+func (*strataCountsSlice) NumOut() int  { return 3 }
+
+func (s *strataCountsSlice) Out(c int) reflect.Type {
+	if c == 0 {
+		return s.Slice.Out(0)
+	}
+	return typeOfInt
+}
+
+func (*strataCountsSlice) NumDep() int              { return 1 }
+func (s *strataCountsSlice) Dep(i int) Dep          { return singleDep(i, s.Slice, false) }
+func (*strataCountsSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (s *strataCountsSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &strataCountsReader{op: s, reader: deps[0]}
+}
+
+type strataCountsReader struct {
+	op     *strataCountsSlice
+	reader sliceio.Reader
+	in     frame.Frame
+}
+
+func (r *strataCountsReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, out.Len(), out.Len())
+	} else {
+		r.in = r.in.Ensure(out.Len())
+	}
+	n, err := r.reader.Read(ctx, r.in)
+	for i := 0; i < n; i++ {
+		count := r.in.Index(1, i).Interface().(strataCount)
+		out.Index(0, i).Set(r.in.Index(0, i))
+		out.Index(1, i).SetInt(int64(count.N))
+		out.Index(2, i).SetInt(int64(count.Sampled))
+	}
+	return n, err
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+// imbalanced returns a slice of keys "a", "b", and "c", with 9000,
+// 900, and 100 rows each.
+func imbalanced() bigslice.Slice {
+	var (
+		keys   []string
+		values []int
+	)
+	for key, n := range map[string]int{"a": 9000, "b": 900, "c": 100} {
+		for i := 0; i < n; i++ {
+			keys = append(keys, key)
+			values = append(values, i)
+		}
+	}
+	return bigslice.Const(7, keys, values)
+}
+
+func strataCounts(t *testing.T, slice bigslice.Slice) map[string][2]int {
+	t.Helper()
+	var (
+		keys       []string
+		n, sampled []int
+	)
+	slicetest.RunAndScan(t, slice, &keys, &n, &sampled)
+	counts := make(map[string][2]int)
+	for i, key := range keys {
+		counts[key] = [2]int{n[i], sampled[i]}
+	}
+	return counts
+}
+
+func strataSample(t *testing.T, slice bigslice.Slice) map[string]int {
+	t.Helper()
+	var (
+		keys   []string
+		values []int
+	)
+	slicetest.RunAndScan(t, slice, &keys, &values)
+	sample := make(map[string]int)
+	for _, key := range keys {
+		sample[key]++
+	}
+	return sample
+}
+
+func TestStratifiedSample(t *testing.T) {
+	sample, counts := bigslice.StratifiedSample(imbalanced(), map[string]float64{"a": 0.1, "b": 0.5}, 1)
+	got := strataSample(t, sample)
+	if n := got["a"]; n < 800 || n > 1000 {
+		t.Errorf("sampled %d of 9000 rows of a", n)
+	}
+	if n := got["b"]; n < 400 || n > 500 {
+		t.Errorf("sampled %d of 900 rows of b", n)
+	}
+	if got, want := got["c"], 100; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	c := strataCounts(t, counts)
+	for key, n := range map[string]int{"a": 9000, "b": 900, "c": 100} {
+		if got, want := c[key], [2]int{n, got[key]}; got != want {
+			t.Errorf("%s: got %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestStratifiedSampleN(t *testing.T) {
+	sample, counts := bigslice.StratifiedSampleN(imbalanced(), map[string]int{"a": 100, "b": 100, "c": 1000}, 1)
+	got := strataSample(t, sample)
+	want := map[string]int{"a": 100, "b": 100, "c": 100}
+	for key := range want {
+		if got[key] != want[key] {
+			t.Errorf("%s: got %v, want %v", key, got[key], want[key])
+		}
+	}
+	c := strataCounts(t, counts)
+	for key, n := range map[string]int{"a": 9000, "b": 900, "c": 100} {
+		if got, want := c[key], [2]int{n, want[key]}; got != want {
+			t.Errorf("%s: got %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestStratifiedSampleError(t *testing.T) {
+	input := bigslice.Const(1, []string{"a"}, []int{1})
+	expectTypeError(t, "stratifiedsample: expected map[string]float64, got map[int]float64", func() {
+		bigslice.StratifiedSample(input, map[int]float64{}, 1)
+	})
+	expectTypeError(t, "stratifiedsample: fraction 2 of key a is not in [0, 1]", func() {
+		bigslice.StratifiedSample(input, map[string]float64{"a": 2}, 1)
+	})
+	expectTypeError(t, "stratifiedsamplen: target -1 of key a is negative", func() {
+		bigslice.StratifiedSampleN(input, map[string]int{"a": -1}, 1)
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// TopN returns a single-shard slice that contains the n largest rows
+// of the provided slice, as ordered by the function less, which
+// reports whether the row given by the first half of its arguments is
+// less than the row given by the second half. The rows are returned
+// in descending order; ties are broken arbitrarily. Schematically:
+//
+//	TopN(Slice<t1, ..., tn>, n, func(t1, ..., tn, t1, ..., tn) bool) Slice<t1, ..., tn>
+//
+// Each shard keeps only its own n largest rows, in a bounded heap, and
+// these are merged by a single reducer, so that at most n rows of each
+// shard are shuffled, and no full sort of the slice is required.
+func TopN(slice Slice, n int, less interface{}) Slice {
+	if n <= 0 {
+		typecheck.Panicf(1, "topn: n must be positive, got %d", n)
+	}
+	arg, ret, ok := typecheck.Func(less)
+	if !ok {
+		typecheck.Panicf(1, "topn: invalid less function %T", less)
+	}
+	if !typecheck.Equal(slicetype.Concat(slice, slice), arg) {
+		typecheck.Panicf(1, "topn: less function %T does not match input slice type %s", less, slicetype.String(slice))
+	}
+	if ret.NumOut() != 1 || ret.Out(0).Kind() != reflect.Bool {
+		typecheck.Panic(1, "topn: less function must return a single boolean value")
+	}
+	fn := slicefunc.Of(less)
+	shards := &topNSlice{MakeName(fmt.Sprintf("topn(%d)", n)), slice, n, fn, false}
+	return &topNSlice{MakeName(fmt.Sprintf("topn(%d)", n)), shards, n, fn, true}
+}
+
+// A topNSlice keeps the n largest rows of each shard of its
+// dependency. If merge is true, the dependency, itself a topNSlice, is
+// shuffled to a single shard, whose rows are emitted in descending
+// order.
+type topNSlice struct {
+	name Name
+	Slice
+	n     int
+	less  slicefunc.Func
+	merge bool
+}
+
+func (t *topNSlice) Name() Name             { return t.name }
+func (*topNSlice) NumDep() int              { return 1 }
+func (t *topNSlice) Dep(i int) Dep          { return singleDep(i, t.Slice, t.merge) }
+func (*topNSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (t *topNSlice) NumShard() int {
+	if t.merge {
+		return 1
+	}
+	return t.Slice.NumShard()
+}
+
+func (t *topNSlice) ShardType() ShardType {
+	if t.merge {
+		return HashShard
+	}
+	return t.Slice.ShardType()
+}
+
+// MaxRows implements Sizer.
+func (t *topNSlice) MaxRows() int {
+	if t.merge {
+		return t.n
+	}
+	return -1
+}
+
+func (t *topNSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &topNReader{op: t, reader: deps[0]}
+}
+
+// topNReader reads the n largest rows of its underlying reader. The
+// rows are kept in a frame, indexed by a min-heap, so that each
+// incoming row need only be compared with the smallest row kept.
+type topNReader struct {
+	op     *topNSlice
+	reader sliceio.Reader
+	err    error
+
+	ctx   context.Context
+	rows  frame.Frame
+	index []int
+	args  []reflect.Value
+	// off is the offset of the next row to be emitted, once all rows
+	// have been read.
+	off int
+}
+
+func (r *topNReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 1024
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	r.ctx = ctx
+	if r.index == nil {
+		r.rows = frame.Make(r.op, 0, r.op.n)
+		r.index = make([]int, 0, r.op.n)
+		r.args = make([]reflect.Value, 2*r.op.NumOut())
+		in := frame.Make(r.op, bufferSize, bufferSize)
+		for {
+			n, err := r.reader.Read(ctx, in)
+			for i := 0; i < n; i++ {
+				r.add(in, i)
+			}
+			if err == sliceio.EOF {
+				break
+			}
+			if err != nil {
+				r.err = err
+				return 0, err
+			}
+		}
+		if r.op.merge {
+			sort.Sort(sort.Reverse(r))
+			sorted := frame.Make(r.op, len(r.index), len(r.index))
+			for i, j := range r.index {
+				frame.Copy(sorted.Slice(i, i+1), r.rows.Slice(j, j+1))
+			}
+			r.rows = sorted
+		}
+	}
+	n := frame.Copy(out, r.rows.Slice(r.off, r.rows.Len()))
+	r.off += n
+	if n == 0 {
+		r.err = sliceio.EOF
+	}
+	return n, r.err
+}
+
+// add considers row i of the provided frame for inclusion among the
+// largest rows.
+func (r *topNReader) add(f frame.Frame, i int) {
+	if len(r.index) < r.op.n {
+		j := r.rows.Len()
+		r.rows = r.rows.Grow(1)
+		frame.Copy(r.rows.Slice(j, j+1), f.Slice(i, i+1))
+		heap.Push(r, j)
+		return
+	}
+	if !r.call(r.rows, r.index[0], f, i) {
+		return
+	}
+	frame.Copy(r.rows.Slice(r.index[0], r.index[0]+1), f.Slice(i, i+1))
+	heap.Fix(r, 0)
+}
+
+// call reports whether row i of frame f is less than row j of frame g.
+func (r *topNReader) call(f frame.Frame, i int, g frame.Frame, j int) bool {
+	k := f.NumOut()
+	for c := 0; c < k; c++ {
+		r.args[c] = f.Value(c).Index(i)
+		r.args[k+c] = g.Value(c).Index(j)
+	}
+	return r.op.less.Call(r.ctx, r.args)[0].Bool()
+}
+
+// Len, Less, Swap, Push, and Pop implement heap.Interface over the
+// index of kept rows, so that the smallest row is at the root.
+
+func (r *topNReader) Len() int { return len(r.index) }
+
+func (r *topNReader) Less(i, j int) bool {
+	return r.call(r.rows, r.index[i], r.rows, r.index[j])
+}
+
+func (r *topNReader) Swap(i, j int) { r.index[i], r.index[j] = r.index[j], r.index[i] }
+
+func (r *topNReader) Push(x interface{}) { r.index = append(r.index, x.(int)) }
+
+func (r *topNReader) Pop() interface{} {
+	x := r.index[len(r.index)-1]
+	r.index = r.index[:len(r.index)-1]
+	return x
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestTopN(t *testing.T) {
+	const N = 1000
+	keys := make([]string, N)
+	values := make([]int, N)
+	for i := range keys {
+		// Values are a permutation of 0..N-1.
+		values[i] = (i * 7) % N
+		keys[i] = fmt.Sprint(values[i])
+	}
+	less := func(k1 string, v1 int, k2 string, v2 int) bool { return v1 < v2 }
+	for nshard := 1; nshard < 5; nshard++ {
+		slice := bigslice.Const(nshard, keys, values)
+		assertEqual(t, bigslice.TopN(slice, 3, less), false,
+			[]string{"999", "998", "997"}, []int{999, 998, 997})
+		// Slices with fewer than n rows are returned in full.
+		small := bigslice.Const(nshard, keys[:4], values[:4])
+		assertEqual(t, bigslice.TopN(small, 10, less), false,
+			[]string{"21", "14", "7", "0"}, []int{21, 14, 7, 0})
+	}
+}
+
+func TestTopNError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "topn: n must be positive, got 0", func() {
+		bigslice.TopN(input, 0, func(k1 string, v1 int, k2 string, v2 int) bool { return false })
+	})
+	expectTypeError(t, "topn: less function func(int, int) bool does not match input slice type slice[1]string,int", func() {
+		bigslice.TopN(input, 1, func(x, y int) bool { return false })
+	})
+	expectTypeError(t, "topn: less function must return a single boolean value", func() {
+		bigslice.TopN(input, 1, func(k1 string, v1 int, k2 string, v2 int) int { return 0 })
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A Transform is a reusable, named sub-pipeline: a function from a
+// slice to a slice, with a declared input and output schema. Transforms
+// are the unit by which slice transformations are packaged and shared,
+// e.g., across teams: a package exports a constructor for each of its
+// transforms, whose parameters configure the transform, and users
+// compose them with each other and apply them to their own slices.
+//
+// Schemas are checked when transforms are composed and applied, rather
+// than when the resulting slices are evaluated, so that
+// incompatibilities are reported as type errors at the site of the
+// composition. For example:
+//
+//	// Package sessions:
+//	func Sessionize(gap time.Duration) *bigslice.Transform {
+//		return bigslice.NewTransform("sessionize",
+//			bigslice.Schema(1, reflect.TypeOf(""), reflect.TypeOf(time.Time{})),
+//			bigslice.Schema(1, reflect.TypeOf(""), reflect.TypeOf(0)),
+//			func(events bigslice.Slice) bigslice.Slice {
+//				...
+//			})
+//	}
+//
+//	// Elsewhere:
+//	pipeline := sessions.Sessionize(30*time.Minute).Then(stats.Histogram(10))
+//	slice = pipeline.Apply(slice)
+type Transform struct {
+	name    string
+	in, out slicetype.Type
+	apply   func(Slice) Slice
+}
+
+// NewTransform returns a new transform with the provided name, which
+// transforms slices of schema in to slices of schema out by the
+// provided function. The function is called once for each application
+// of the transform, when the pipeline is constructed; it may itself
+// apply other transforms.
+func NewTransform(name string, in, out slicetype.Type, apply func(Slice) Slice) *Transform {
+	if name == "" {
+		typecheck.Panic(1, "transform: name must be nonempty")
+	}
+	if in == nil || out == nil {
+		typecheck.Panicf(1, "transform %s: schemas must be provided", name)
+	}
+	return &Transform{name, in, out, apply}
+}
+
+// Compose returns a transform, with the provided name, that applies
+// the provided transforms in order. Compose panics with a type error if
+// the output schema of any transform is incompatible with the input
+// schema of the next.
+func Compose(name string, transforms ...*Transform) *Transform {
+	if len(transforms) == 0 {
+		typecheck.Panicf(1, "compose %s: no transforms provided", name)
+	}
+	for i := 1; i < len(transforms); i++ {
+		prev, next := transforms[i-1], transforms[i]
+		if err := checkSchema(prev.out, next.in); err != "" {
+			typecheck.Panicf(1, "compose %s: output of transform %s is incompatible with input of transform %s: %s",
+				name, prev.name, next.name, err)
+		}
+	}
+	transforms = append([]*Transform(nil), transforms...)
+	return &Transform{
+		name: name,
+		in:   transforms[0].in,
+		out:  transforms[len(transforms)-1].out,
+		apply: func(slice Slice) Slice {
+			for _, t := range transforms {
+				slice = t.apply1(slice)
+			}
+			return slice
+		},
+	}
+}
+
+// Then returns a transform that applies t and then next. It panics with
+// a type error if the output schema of t is incompatible with the
+// input schema of next.
+func (t *Transform) Then(next *Transform) *Transform {
+	if err := checkSchema(t.out, next.in); err != "" {
+		typecheck.Panicf(1, "transform %s: output is incompatible with input of transform %s: %s", t.name, next.name, err)
+	}
+	return &Transform{
+		name: t.name + "." + next.name,
+		in:   t.in,
+		out:  next.out,
+		apply: func(slice Slice) Slice {
+			return next.apply1(t.apply1(slice))
+		},
+	}
+}
+
+// Name returns the transform's name.
+func (t *Transform) Name() string { return t.name }
+
+// In returns the transform's input schema.
+func (t *Transform) In() slicetype.Type { return t.in }
+
+// Out returns the transform's output schema.
+func (t *Transform) Out() slicetype.Type { return t.out }
+
+func (t *Transform) String() string {
+	return fmt.Sprintf("%s: %s -> %s", t.name, slicetype.String(t.in), slicetype.String(t.out))
+}
+
+// Apply applies the transform to the provided slice, and returns the
+// transformed slice. Apply panics with a type error if the slice is
+// incompatible with the transform's input schema, or if the transform
+// produces a slice that is incompatible with its output schema.
+func (t *Transform) Apply(slice Slice) Slice {
+	if err := checkSchema(slice, t.in); err != "" {
+		typecheck.Panicf(1, "transform %s: slice is incompatible with input schema: %s", t.name, err)
+	}
+	out := t.apply(slice)
+	if err := checkSchema(out, t.out); err != "" {
+		typecheck.Panicf(1, "transform %s: transformed slice is incompatible with output schema: %s", t.name, err)
+	}
+	return out
+}
+
+// apply1 applies the transform, which is composed into another, to a
+// slice whose compatibility with its input schema was checked when the
+// transforms were composed.
+func (t *Transform) apply1(slice Slice) Slice {
+	out := t.apply(slice)
+	if err := checkSchema(out, t.out); err != "" {
+		typecheck.Panicf(2, "transform %s: transformed slice is incompatible with output schema: %s", t.name, err)
+	}
+	return out
+}
+
+type schema struct {
+	slicetype.Type
+	prefix int
+}
+
+func (s schema) Prefix() int { return s.prefix }
+
+// Schema returns a schema, for use with NewTransform, of slices with
+// the provided column types, the first prefix of which are key
+// columns.
+func Schema(prefix int, columns ...reflect.Type) slicetype.Type {
+	if len(columns) == 0 {
+		typecheck.Panic(1, "schema: no columns provided")
+	}
+	if prefix < 1 || prefix > len(columns) {
+		typecheck.Panicf(1, "schema: prefix %d is not in [1, %d]", prefix, len(columns))
+	}
+	return schema{slicetype.New(columns...), prefix}
+}
+
+// checkSchema checks that slices of type typ are compatible with the
+// provided schema: they must have the same number of columns, and the
+// same prefix, and each of their columns must be assignable to the
+// schema's, nulls included. It returns a description of the incompatibility, or an
+// empty string if they are compatible.
+func checkSchema(typ, schema slicetype.Type) string {
+	if typ.NumOut() != schema.NumOut() {
+		return fmt.Sprintf("got %d columns (%s), want %d (%s)",
+			typ.NumOut(), columnString(typ), schema.NumOut(), columnString(schema))
+	}
+	for i := 0; i < typ.NumOut(); i++ {
+		if !typ.Out(i).AssignableTo(schema.Out(i)) {
+			return fmt.Sprintf("column %d is of type %s, want %s", i, typ.Out(i), schema.Out(i))
+		}
+	}
+	if typ.Prefix() != schema.Prefix() {
+		return fmt.Sprintf("got prefix %d, want %d", typ.Prefix(), schema.Prefix())
+	}
+	if !typecheck.NullsAssignable(schema, typ) {
+		return fmt.Sprintf("got nullable columns (%s), want (%s)", slicetype.String(typ), slicetype.String(schema))
+	}
+	return ""
+}
+
+// columnString returns a comma-separated list of the column types of
+// typ.
+func columnString(typ slicetype.Type) string {
+	columns := make([]string, typ.NumOut())
+	for i := range columns {
+		columns[i] = typ.Out(i).String()
+	}
+	return strings.Join(columns, ", ")
+}
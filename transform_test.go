@@ -0,0 +1,91 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+var (
+	typeOfString = reflect.TypeOf("")
+	typeOfInt    = reflect.TypeOf(0)
+)
+
+// countWords returns a transform that counts the words of at least
+// minLen characters in a slice of lines.
+func countWords(minLen int) *bigslice.Transform {
+	return bigslice.NewTransform("countwords",
+		bigslice.Schema(1, typeOfString),
+		bigslice.Schema(1, typeOfString, typeOfInt),
+		func(lines bigslice.Slice) bigslice.Slice {
+			words := bigslice.Flatmap(lines, func(line string) []string {
+				var words []string
+				for _, word := range strings.Fields(line) {
+					if len(word) >= minLen {
+						words = append(words, word)
+					}
+				}
+				return words
+			})
+			counts := bigslice.Map(words, func(word string) (string, int) { return word, 1 })
+			return bigslice.Reduce(counts, func(a, b int) int { return a + b })
+		})
+}
+
+// atLeast returns a transform that filters counts below n.
+func atLeast(n int) *bigslice.Transform {
+	return bigslice.NewTransform("atleast",
+		bigslice.Schema(1, typeOfString, typeOfInt),
+		bigslice.Schema(1, typeOfString, typeOfInt),
+		func(counts bigslice.Slice) bigslice.Slice {
+			return bigslice.Filter(counts, func(_ string, count int) bool { return count >= n })
+		})
+}
+
+func TestTransform(t *testing.T) {
+	lines := bigslice.Const(2, []string{"the quick brown fox", "jumps over the lazy dog", "the end"})
+	assertEqual(t, countWords(4).Apply(lines), true,
+		[]string{"brown", "jumps", "lazy", "over", "quick"},
+		[]int{1, 1, 1, 1, 1},
+	)
+	pipeline := countWords(3).Then(atLeast(2))
+	if got, want := pipeline.Name(), "countwords.atleast"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, pipeline.Apply(lines), false, []string{"the"}, []int{3})
+	composed := bigslice.Compose("frequent", countWords(1), atLeast(2), atLeast(3))
+	assertEqual(t, composed.Apply(lines), false, []string{"the"}, []int{3})
+}
+
+func TestTransformError(t *testing.T) {
+	ints := bigslice.Const(1, []int{1, 2, 3})
+	expectTypeError(t, "transform countwords: slice is incompatible with input schema: column 0 is of type int, want string", func() {
+		countWords(1).Apply(ints)
+	})
+	expectTypeError(t, "transform atleast: output is incompatible with input of transform countwords: got 2 columns (string, int), want 1 (string)", func() {
+		atLeast(1).Then(countWords(1))
+	})
+	expectTypeError(t, "compose bad: output of transform countwords is incompatible with input of transform countwords: got 2 columns (string, int), want 1 (string)", func() {
+		bigslice.Compose("bad", countWords(1), countWords(1))
+	})
+	// Transforms are checked against their declared output schemas.
+	wrong := bigslice.NewTransform("wrong",
+		bigslice.Schema(1, typeOfInt),
+		bigslice.Schema(1, typeOfString),
+		func(slice bigslice.Slice) bigslice.Slice { return slice })
+	expectTypeError(t, "transform wrong: transformed slice is incompatible with output schema: column 0 is of type int, want string", func() {
+		wrong.Apply(ints)
+	})
+	expectTypeError(t, "transform atleast: slice is incompatible with input schema: got prefix 2, want 1", func() {
+		atLeast(1).Apply(bigslice.Prefixed(bigslice.Const(1, []string{"a"}, []int{1}), 2))
+	})
+	expectTypeError(t, "schema: prefix 2 is not in [1, 1]", func() {
+		bigslice.Schema(2, typeOfInt)
+	})
+}
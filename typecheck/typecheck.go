@@ -55,3 +55,40 @@ func Devectorize(typ slicetype.Type) (slicetype.Type, bool) {
 	}
 	return slicetype.New(elems...), true
 }
+
+// NullsAssignable tells whether the nulls of the columns of src may be
+// assigned to the corresponding columns of dst: a nullable column may
+// be assigned only to a nullable column, so that nulls are not silently
+// replaced by zero values. Non-nullable columns may be assigned to
+// either. The types are assumed to have the same number of columns.
+func NullsAssignable(dst, src slicetype.Type) bool {
+	for i := 0; i < src.NumOut(); i++ {
+		if slicetype.Nullable(src, i) && !slicetype.Nullable(dst, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// NullUnion returns the type typ whose columns are nullable if the
+// corresponding column of typ or of any of the provided types is
+// nullable. It is the rule by which nullability propagates through
+// operators that combine the rows of multiple slices, e.g., Union.
+func NullUnion(typ slicetype.Type, types ...slicetype.Type) slicetype.Type {
+	var nulls []int
+	for i := 0; i < typ.NumOut(); i++ {
+		if slicetype.Nullable(typ, i) {
+			continue
+		}
+		for _, t := range types {
+			if slicetype.Nullable(t, i) {
+				nulls = append(nulls, i)
+				break
+			}
+		}
+	}
+	if len(nulls) == 0 {
+		return typ
+	}
+	return slicetype.WithNullable(typ, nulls...)
+}
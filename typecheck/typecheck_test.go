@@ -82,3 +82,22 @@ func TestDevectorize(t *testing.T) {
 		t.Error("ok")
 	}
 }
+
+func TestNulls(t *testing.T) {
+	var (
+		typ      = slicetype.New(typeOfString, typeOfInt)
+		nullable = slicetype.WithNullable(typ, 1)
+	)
+	if !NullsAssignable(nullable, typ) {
+		t.Error("non-nullable columns should be assignable to nullable columns")
+	}
+	if NullsAssignable(typ, nullable) {
+		t.Error("nullable columns should not be assignable to non-nullable columns")
+	}
+	if got, want := slicetype.String(NullUnion(typ, typ)), "slice[1]string,int"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := slicetype.String(NullUnion(typ, typ, nullable)), "slice[1]string,int?"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// Union returns a slice that concatenates the provided slices, which
+// must all have the same column types. Schematically:
+//
+//	Union(Slice<t1, ..., tn>, Slice<t1, ..., tn>, ...) Slice<t1, ..., tn>
+//
+// The shards of the returned slice are the shards of each of the
+// provided slices, in order, so that the union is computed with the
+// combined parallelism of its inputs, and without a shuffle. Union is
+// useful to process heterogeneous inputs, e.g., many daily partitions
+// of a dataset, as a single slice. The returned slice has the prefix
+// of the first slice. A column of the returned slice is nullable if
+// the column is nullable in any of the provided slices.
+func Union(slices ...Slice) Slice {
+	if len(slices) == 0 {
+		typecheck.Panic(1, "union: need at least one slice")
+	}
+	if len(slices) == 1 {
+		return slices[0]
+	}
+	for i, slice := range slices[1:] {
+		if !typecheck.Equal(slices[0], slice) {
+			typecheck.Panicf(1, "union: slice %d type %s does not match slice 0 type %s",
+				i+1, slicetype.String(slice), slicetype.String(slices[0]))
+		}
+	}
+	u := &unionSlice{
+		name:   MakeName("union"),
+		Slice:  slices[0],
+		slices: append([]Slice(nil), slices...),
+	}
+	types := make([]slicetype.Type, len(slices))
+	for i, slice := range slices {
+		u.numShard += slice.NumShard()
+		types[i] = slice
+	}
+	u.typ = typecheck.NullUnion(slices[0], types[1:]...)
+	return u
+}
+
+type unionSlice struct {
+	name Name
+	Slice
+	slices   []Slice
+	numShard int
+	typ      slicetype.Type
+}
+
+func (u *unionSlice) Name() Name             { return u.name }
+func (u *unionSlice) NumShard() int          { return u.numShard }
+func (*unionSlice) ShardType() ShardType     { return HashShard }
+func (u *unionSlice) NumDep() int            { return len(u.slices) }
+func (u *unionSlice) Dep(i int) Dep          { return Dep{u.slices[i], false, nil, false, false} }
+func (*unionSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+// Nullable implements slicetype.NullableType.
+func (u *unionSlice) Nullable(i int) bool { return slicetype.Nullable(u.typ, i) }
+
+// DepShard implements ShardMapper.
+func (u *unionSlice) DepShard(shard int) (dep, depShard int) {
+	for dep, slice := range u.slices {
+		if shard < slice.NumShard() {
+			return dep, shard
+		}
+		shard -= slice.NumShard()
+	}
+	panic("union: shard out of range")
+}
+
+func (*unionSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
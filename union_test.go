@@ -0,0 +1,54 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestUnion(t *testing.T) {
+	var (
+		a = bigslice.Const(2, []string{"a", "b", "c"}, []int{1, 2, 3})
+		b = bigslice.Const(3, []string{"d", "e", "f", "g"}, []int{4, 5, 6, 7})
+		c = bigslice.Const(1, []string{"a"}, []int{10})
+	)
+	slice := bigslice.Union(a, b, c)
+	if got, want := slice.NumShard(), 6; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Pipelined and shuffled consumers read all of the union's shards.
+	slice = bigslice.Map(slice, func(s string, i int) (string, int) { return s, i * 2 })
+	assertEqual(t, slice, true,
+		[]string{"a", "a", "b", "c", "d", "e", "f", "g"},
+		[]int{2, 20, 4, 6, 8, 10, 12, 14})
+	slice = bigslice.Reduce(slice, func(x, y int) int { return x + y })
+	assertEqual(t, slice, true,
+		[]string{"a", "b", "c", "d", "e", "f", "g"},
+		[]int{22, 4, 6, 8, 10, 12, 14})
+}
+
+func TestUnionMany(t *testing.T) {
+	const N = 20
+	var (
+		slices []bigslice.Slice
+		want   []string
+	)
+	for i := 0; i < N; i++ {
+		day := fmt.Sprintf("day%02d", i)
+		slices = append(slices, bigslice.Const(1+i%3, []string{day + "a", day + "b"}))
+		want = append(want, day+"a", day+"b")
+	}
+	assertEqual(t, bigslice.Union(slices...), true, want)
+}
+
+func TestUnionError(t *testing.T) {
+	a := bigslice.Const(1, []string{"x"})
+	b := bigslice.Const(1, []int{1})
+	expectTypeError(t, "union: slice 1 type slice[1]int does not match slice 0 type slice[1]string", func() { bigslice.Union(a, b) })
+	expectTypeError(t, "union: need at least one slice", func() { bigslice.Union() })
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+// A ShardVersioner is a Slice whose shards are versioned: the version
+// of a shard identifies its contents, and changes whenever they do.
+// Versions let the tasks of resident invocations, which are run
+// repeatedly as new input arrives, be reused across runs: a task that
+// reads only shards whose versions are unchanged need not be
+// recomputed. See exec.Resident.
+type ShardVersioner interface {
+	// ShardVersion returns the version of the provided shard.
+	ShardVersion(shard int) string
+}
+
+type versionedSlice struct {
+	name Name
+	Slice
+	versions []string
+}
+
+// Versioned returns a slice that is identical to the provided slice,
+// typically a source, but whose shards have the provided versions,
+// one for each shard. For example, a slice that reads a shard from
+// each file in a directory may be versioned by the files' paths and
+// modification times, so that each run of a resident invocation over
+// the directory recomputes only the shards of new or changed files.
+//
+// The computation of a versioned shard is presumed to depend only on
+// its version, and not on its index or on the number of shards: a
+// shard with a given version may thus be read by a later run at a
+// different index.
+func Versioned(slice Slice, versions []string) Slice {
+	if len(versions) != slice.NumShard() {
+		typecheck.Panicf(1, "versioned: got %d versions for slice with %d shards", len(versions), slice.NumShard())
+	}
+	return &versionedSlice{MakeName("versioned"), slice, append([]string(nil), versions...)}
+}
+
+func (s *versionedSlice) Name() Name                    { return s.name }
+func (*versionedSlice) NumDep() int                     { return 1 }
+func (s *versionedSlice) Dep(i int) Dep                 { return singleDep(i, s.Slice, false) }
+func (*versionedSlice) Combiner() slicefunc.Func        { return slicefunc.Nil }
+func (s *versionedSlice) MaxRows() int                  { return maxRows(s.Slice) }
+func (s *versionedSlice) ShardVersion(shard int) string { return s.versions[shard] }
+
+func (*versionedSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return deps[0]
+}
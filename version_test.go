@@ -0,0 +1,24 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"testing"
+
+	"github.com/grailbio/bigslice"
+)
+
+func TestVersioned(t *testing.T) {
+	strs := []string{"w", "x", "y", "z"}
+	slice := bigslice.Versioned(bigslice.Const(2, strs), []string{"a", "b"})
+	if got, want := slice.(bigslice.ShardVersioner).ShardVersion(1), "b"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	assertEqual(t, slice, true, strs)
+
+	expectTypeError(t, "versioned: got 1 versions for slice with 2 shards", func() {
+		bigslice.Versioned(bigslice.Const(2, strs), []string{"a"})
+	})
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+	"github.com/grailbio/bigslice/typecheck"
+)
+
+var (
+	typeOfTime = reflect.TypeOf(time.Time{})
+	unixEpoch  = time.Unix(0, 0).UTC()
+)
+
+// Windows describes how rows are assigned to time windows. Windows
+// have a fixed size, and start at multiples of their slide, counted
+// from the Unix epoch; each row is assigned to every window that
+// contains its timestamp. Windows are tumbling if their slide equals
+// their size, so that each row belongs to exactly one window, and
+// sliding if their slide is smaller, so that windows overlap.
+// Timestamps must lie within about 290 years of the Unix epoch.
+type Windows struct {
+	size, slide time.Duration
+	// arrivalCol is the column that holds the time at which each row
+	// arrived, or -1 if late rows are not dropped.
+	arrivalCol int
+	lateness   time.Duration
+}
+
+// TumblingWindows returns non-overlapping windows of the provided size.
+func TumblingWindows(size time.Duration) Windows {
+	return SlidingWindows(size, size)
+}
+
+// SlidingWindows returns windows of the provided size, a new one of
+// which starts every slide.
+func SlidingWindows(size, slide time.Duration) Windows {
+	return Windows{size: size, slide: slide, arrivalCol: -1}
+}
+
+// AllowedLateness returns windows that admit rows only if they arrived
+// no later than the provided lateness after the end of the window.
+// Each row's arrival time is read from the time.Time column col; rows
+// that arrived too late for a window are dropped from it, but are
+// assigned to later windows for which they are on time.
+func (w Windows) AllowedLateness(col int, lateness time.Duration) Windows {
+	w.arrivalCol = col
+	w.lateness = lateness
+	return w
+}
+
+// check panics with a type error if w is not a valid set of windows
+// of the provided slice, whose timestamps are in column col.
+func (w Windows) check(op string, slice Slice, col int) {
+	if w.size <= 0 || w.slide <= 0 || w.slide > w.size {
+		typecheck.Panicf(2, "%s: invalid windows of size %s and slide %s", op, w.size, w.slide)
+	}
+	cols := []int{col}
+	if w.arrivalCol != -1 {
+		cols = append(cols, w.arrivalCol)
+	}
+	for _, c := range cols {
+		if c < 0 || c >= slice.NumOut() {
+			typecheck.Panicf(2, "%s: column %d out of range for slice %s", op, c, slicetype.String(slice))
+		}
+		if typ := slice.Out(c); typ != typeOfTime {
+			typecheck.Panicf(2, "%s: column %d has type %s, not %s", op, c, typ, typeOfTime)
+		}
+	}
+}
+
+// Window returns a slice that assigns each row of the provided slice
+// to the windows that contain its timestamp, which is read from the
+// time.Time column col. A row is emitted once for each of its windows,
+// prefixed by the window's start time, which becomes part of the
+// slice's key, so that rows may then be aggregated per window and key,
+// e.g., by Reduce. Schematically:
+//
+//	Window(Slice<k1, ..., kp, t1, ..., tn>, col, windows) Slice<time.Time, k1, ..., kp, t1, ..., tn>
+func Window(slice Slice, col int, windows Windows) Slice {
+	windows.check("window", slice, col)
+	return makeWindowSlice(slice, col, windows, nil)
+}
+
+// WindowReduce assigns each row of the provided slice to the windows
+// that contain its timestamp, as Window does, and reduces the rows of
+// each window and key with the provided reduce function, as Reduce
+// does. The timestamp column, and the arrival time column of windows
+// with allowed lateness, are dropped before rows are reduced, and so
+// the slice must have exactly one other value column. Schematically:
+//
+//	WindowReduce(Slice<k1, ..., kp, time.Time, v>, col, windows, func(v, v) v) Slice<time.Time, k1, ..., kp, v>
+func WindowReduce(slice Slice, col int, windows Windows, reduce interface{}) Slice {
+	windows.check("windowreduce", slice, col)
+	drop := make([]bool, slice.NumOut())
+	drop[col] = true
+	if windows.arrivalCol >= 0 {
+		drop[windows.arrivalCol] = true
+	}
+	var values int
+	for c := slice.Prefix(); c < slice.NumOut(); c++ {
+		if !drop[c] {
+			values++
+		}
+	}
+	if values != 1 {
+		typecheck.Panicf(1, "windowreduce: slice %s must have exactly one value column other than its time columns; has %d",
+			slicetype.String(slice), values)
+	}
+	return Reduce(makeWindowSlice(slice, col, windows, drop), reduce)
+}
+
+// A windowSlice emits each row of its dependency once for each window
+// to which it is assigned, prefixed by the window's start time, and
+// without the columns that are dropped.
+type windowSlice struct {
+	name Name
+	Slice
+	col     int
+	windows Windows
+	// cols are the columns of the dependency that are emitted, after
+	// the window start time.
+	cols   []int
+	prefix int
+	out    slicetype.Type
+}
+
+func makeWindowSlice(slice Slice, col int, windows Windows, drop []bool) *windowSlice {
+	w := &windowSlice{
+		name:    MakeName(fmt.Sprintf("window(%s,%s)", windows.size, windows.slide)),
+		Slice:   slice,
+		col:     col,
+		windows: windows,
+		prefix:  1,
+	}
+	out := []reflect.Type{typeOfTime}
+	for c := 0; c < slice.NumOut(); c++ {
+		if drop != nil && drop[c] {
+			continue
+		}
+		w.cols = append(w.cols, c)
+		out = append(out, slice.Out(c))
+		if c < slice.Prefix() {
+			w.prefix++
+		}
+	}
+	w.out = slicetype.New(out...)
+	return w
+}
+
+func (w *windowSlice) Name() Name             { return w.name }
+func (w *windowSlice) NumOut() int            { return w.out.NumOut() }
+func (w *windowSlice) Out(c int) reflect.Type { return w.out.Out(c) }
+func (w *windowSlice) Prefix() int            { return w.prefix }
+func (*windowSlice) ShardType() ShardType     { return HashShard }
+func (*windowSlice) NumDep() int              { return 1 }
+func (w *windowSlice) Dep(i int) Dep          { return singleDep(i, w.Slice, false) }
+func (*windowSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (w *windowSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &windowReader{op: w, reader: deps[0]}
+}
+
+type windowReader struct {
+	op     *windowSlice
+	reader sliceio.Reader
+	err    error
+	eof    bool
+
+	// in buffers rows of the dependency; rows [beg, end) have not yet
+	// been emitted in all of their windows.
+	in       frame.Frame
+	beg, end int
+	// start is the start of the next window of row beg, if started is
+	// true.
+	start   time.Time
+	started bool
+}
+
+func (r *windowReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 1024
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, bufferSize, bufferSize)
+	}
+	var (
+		n       int
+		windows = r.op.windows
+		starts  = out.Value(0)
+	)
+	for n < out.Len() {
+		if r.beg == r.end {
+			if r.eof {
+				r.err = sliceio.EOF
+				break
+			}
+			m, err := r.reader.Read(ctx, r.in)
+			if err == sliceio.EOF {
+				r.eof = true
+			} else if err != nil {
+				r.err = err
+				return n, err
+			}
+			r.beg, r.end = 0, m
+			continue
+		}
+		t := r.in.Index(r.op.col, r.beg).Interface().(time.Time)
+		if !r.started {
+			r.start = firstWindow(t, windows.size, windows.slide)
+			r.started = true
+		}
+		if r.start.After(t) {
+			r.beg++
+			r.started = false
+			continue
+		}
+		start := r.start
+		r.start = r.start.Add(windows.slide)
+		if windows.arrivalCol >= 0 {
+			arrival := r.in.Index(windows.arrivalCol, r.beg).Interface().(time.Time)
+			if arrival.After(start.Add(windows.size + windows.lateness)) {
+				continue
+			}
+		}
+		starts.Index(n).Set(reflect.ValueOf(start))
+		for i, c := range r.op.cols {
+			out.Index(i+1, n).Set(r.in.Index(c, r.beg))
+		}
+		n++
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// firstWindow returns the start of the earliest window of the provided
+// size and slide that contains t. Windows start at multiples of slide
+// from the Unix epoch.
+func firstWindow(t time.Time, size, slide time.Duration) time.Time {
+	since := t.Sub(unixEpoch)
+	k := since / slide
+	if since%slide < 0 {
+		k--
+	}
+	// Start is the latest window start not after t; earlier windows
+	// contain t if they end after it.
+	start := unixEpoch.Add(k * slide)
+	back := (size - t.Sub(start) - 1) / slide
+	return start.Add(-back * slide)
+}
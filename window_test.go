@@ -0,0 +1,74 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grailbio/bigslice"
+)
+
+// windowKeys maps the rows of a Slice<time.Time, string, int> to
+// string keys of the form "key@minute", so that they may be sorted.
+func windowKeys(slice bigslice.Slice) bigslice.Slice {
+	return bigslice.Map(slice, func(start time.Time, key string, n int) (string, int) {
+		return fmt.Sprintf("%s@%d", key, start.Unix()/60), n
+	})
+}
+
+func TestWindowReduce(t *testing.T) {
+	at := func(min int) time.Time { return time.Unix(int64(min)*60, 0).UTC() }
+	var (
+		keys  = []string{"a", "a", "b", "a", "b", "a"}
+		times = []time.Time{at(0), at(4), at(5), at(9), at(10), at(12)}
+		ones  = []int{1, 1, 1, 1, 1, 1}
+		add   = func(x, y int) int { return x + y }
+	)
+	input := bigslice.Const(2, keys, times, ones)
+	assertEqual(t, windowKeys(bigslice.WindowReduce(input, 1, bigslice.TumblingWindows(5*time.Minute), add)), true,
+		[]string{"a@0", "a@10", "a@5", "b@10", "b@5"},
+		[]int{2, 1, 1, 1, 1})
+	// Sliding windows of 10 minutes, every 5 minutes: each row belongs
+	// to two windows.
+	assertEqual(t, windowKeys(bigslice.WindowReduce(input, 1, bigslice.SlidingWindows(10*time.Minute, 5*time.Minute), add)), true,
+		[]string{"a@-5", "a@0", "a@10", "a@5", "b@0", "b@10", "b@5"},
+		[]int{2, 3, 1, 2, 1, 1, 2})
+}
+
+func TestWindowLateness(t *testing.T) {
+	at := func(min int) time.Time { return time.Unix(int64(min)*60, 0).UTC() }
+	var (
+		keys     = []string{"a", "a", "a"}
+		times    = []time.Time{at(1), at(2), at(3)}
+		arrivals = []time.Time{at(1), at(7), at(20)}
+		values   = []int{1, 2, 3}
+	)
+	input := bigslice.Const(1, keys, times, arrivals, values)
+	// Windows end at minute 5, and admit rows that arrive up to
+	// minute 8.
+	windows := bigslice.TumblingWindows(5*time.Minute).AllowedLateness(2, 3*time.Minute)
+	windowed := bigslice.Window(input, 1, windows)
+	windowed = bigslice.Map(windowed, func(start time.Time, key string, t, arrival time.Time, n int) (string, int) {
+		return fmt.Sprintf("%s@%d", key, start.Unix()/60), n
+	})
+	assertEqual(t, windowed, true,
+		[]string{"a@0", "a@0"},
+		[]int{1, 2})
+}
+
+func TestWindowError(t *testing.T) {
+	input := bigslice.Const(1, []string{"x"}, []int{1})
+	expectTypeError(t, "window: invalid windows of size 1s and slide 2s", func() {
+		bigslice.Window(input, 1, bigslice.SlidingWindows(time.Second, 2*time.Second))
+	})
+	expectTypeError(t, "window: column 1 has type int, not time.Time", func() {
+		bigslice.Window(input, 1, bigslice.TumblingWindows(time.Second))
+	})
+	expectTypeError(t, "windowreduce: column 2 out of range for slice slice[1]string,int", func() {
+		bigslice.WindowReduce(input, 2, bigslice.TumblingWindows(time.Second), func(x, y int) int { return x + y })
+	})
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grailbio/base/errors"
+	"github.com/grailbio/bigslice/frame"
+	"github.com/grailbio/bigslice/slicefunc"
+	"github.com/grailbio/bigslice/sliceio"
+	"github.com/grailbio/bigslice/slicetype"
+)
+
+// ZipWithIndex returns a slice that appends to each row of the provided
+// slice its index in the slice: rows are numbered consecutively from 0,
+// shard by shard, in the order in which they are produced.
+// Schematically:
+//
+//	ZipWithIndex(Slice<t1, ..., tn>) Slice<t1, ..., tn, int64>
+//
+// ZipWithIndex computes the provided slice twice: once to count the
+// rows of each shard, which are broadcast to every shard, and once more
+// to number them. The slice must thus produce the same rows, in the
+// same order, each time it is computed; slices that are computed by
+// previous invocations (e.g., by Cache) are read, rather than
+// recomputed. Use ZipWithUniqueID if IDs need not be consecutive.
+func ZipWithIndex(slice Slice) Slice {
+	name := MakeName("zipwithindex")
+	return &zipSlice{name, slice, &zipCountSlice{name, slice}}
+}
+
+// ZipWithUniqueID returns a slice that appends to each row of the
+// provided slice an ID that is unique within the slice. Schematically:
+//
+//	ZipWithUniqueID(Slice<t1, ..., tn>) Slice<t1, ..., tn, int64>
+//
+// The IDs of shard s of a slice of n shards are s, s+n, s+2n, ...; they
+// are thus computed in a single pass, but are not consecutive. Use
+// ZipWithIndex for consecutive IDs.
+func ZipWithUniqueID(slice Slice) Slice {
+	return &zipSlice{MakeName("zipwithuniqueid"), slice, nil}
+}
+
+// zipSlice appends an int64 ID to each row of its dependency. If
+// counts is nil, IDs are unique; otherwise, they are indices, which
+// are offset by the row counts of the preceding shards, as read from
+// the broadcast counts.
+type zipSlice struct {
+	name Name
+	Slice
+	counts *zipCountSlice
+}
+
+func (z *zipSlice) Name() Name             { return z.name }
+func (z *zipSlice) NumOut() int            { return z.Slice.NumOut() + 1 }
+func (*zipSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+
+func (z *zipSlice) Out(c int) reflect.Type {
+	if c == z.Slice.NumOut() {
+		return typeOfInt64
+	}
+	return z.Slice.Out(c)
+}
+
+func (z *zipSlice) NumDep() int {
+	if z.counts == nil {
+		return 1
+	}
+	return 2
+}
+
+func (z *zipSlice) Dep(i int) Dep {
+	if i == 0 {
+		return Dep{z.Slice, false, nil, false, false}
+	}
+	return Dep{z.counts, false, nil, false, true}
+}
+
+// MaxRows implements Sizer.
+func (z *zipSlice) MaxRows() int { return maxRows(z.Slice) }
+
+func (z *zipSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	r := &zipReader{op: z, reader: deps[0], shard: shard}
+	if z.counts == nil {
+		r.next, r.step = int64(shard), int64(z.NumShard())
+		r.started = true
+	} else {
+		r.countReader = deps[1]
+		r.step = 1
+	}
+	return r
+}
+
+type zipReader struct {
+	op                  *zipSlice
+	reader, countReader sliceio.Reader
+	shard               int
+	// next is the ID of the next row; step is the difference between
+	// the IDs of consecutive rows.
+	next, step int64
+	started    bool
+	in         frame.Frame
+}
+
+func (r *zipReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if !r.started {
+		if err := r.readOffset(ctx); err != nil {
+			return 0, err
+		}
+		r.started = true
+	}
+	if r.in.IsZero() {
+		r.in = frame.Make(r.op.Slice, out.Len(), out.Len())
+	} else {
+		r.in = r.in.Ensure(out.Len())
+	}
+	n, err := r.reader.Read(ctx, r.in)
+	idcol := r.op.Slice.NumOut()
+	for c := 0; c < idcol; c++ {
+		reflect.Copy(out.Value(c), r.in.Value(c).Slice(0, n))
+	}
+	for i := 0; i < n; i++ {
+		out.Index(idcol, i).SetInt(r.next)
+		r.next += r.step
+	}
+	return n, err
+}
+
+// readOffset sets the ID of the shard's first row to the number of
+// rows in the preceding shards, as read from the broadcast counts.
+func (r *zipReader) readOffset(ctx context.Context) error {
+	var (
+		counts = frame.Make(r.op.counts, r.op.NumShard(), r.op.NumShard())
+		found  bool
+	)
+	for {
+		n, err := r.countReader.Read(ctx, counts)
+		for i := 0; i < n; i++ {
+			switch shard := int(counts.Index(0, i).Int()); {
+			case shard < r.shard:
+				r.next += counts.Index(1, i).Int()
+			case shard == r.shard:
+				found = true
+			}
+		}
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errors.E(errors.Fatal, errors.Invalid, "zipwithindex: missing row count")
+	}
+	return nil
+}
+
+// zipCountSlice emits the number of rows in each shard of its
+// dependency, keyed by the shard.
+type zipCountSlice struct {
+	name Name
+	Slice
+}
+
+func (z *zipCountSlice) Name() Name             { return z.name }
+func (*zipCountSlice) NumOut() int              { return 2 }
+func (*zipCountSlice) Prefix() int              { return 1 }
+func (*zipCountSlice) NumDep() int              { return 1 }
+func (z *zipCountSlice) Dep(i int) Dep          { return singleDep(i, z.Slice, false) }
+func (*zipCountSlice) Combiner() slicefunc.Func { return slicefunc.Nil }
+func (z *zipCountSlice) MaxRows() int           { return z.NumShard() }
+
+func (*zipCountSlice) Out(c int) reflect.Type {
+	if c == 0 {
+		return typeOfInt
+	}
+	return typeOfInt64
+}
+
+func (z *zipCountSlice) Reader(shard int, deps []sliceio.Reader) sliceio.Reader {
+	return &zipCountReader{op: z, reader: deps[0], shard: shard}
+}
+
+type zipCountReader struct {
+	op     *zipCountSlice
+	reader sliceio.Reader
+	shard  int
+	done   bool
+}
+
+func (r *zipCountReader) Read(ctx context.Context, out frame.Frame) (int, error) {
+	const bufferSize = 1024
+	if !slicetype.Assignable(out, r.op) {
+		return 0, errTypeError
+	}
+	if r.done {
+		return 0, sliceio.EOF
+	}
+	if out.Len() == 0 {
+		return 0, nil
+	}
+	var (
+		count int64
+		in    = frame.Make(r.op.Slice, bufferSize, bufferSize)
+	)
+	for {
+		n, err := r.reader.Read(ctx, in)
+		count += int64(n)
+		if err == sliceio.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	r.done = true
+	out.Index(0, 0).SetInt(int64(r.shard))
+	out.Index(1, 0).SetInt(count)
+	return 1, nil
+}
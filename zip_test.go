@@ -0,0 +1,80 @@
+// Copyright 2019 GRAIL, Inc. All rights reserved.
+// Use of this source code is governed by the Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bigslice_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grailbio/bigslice"
+	"github.com/grailbio/bigslice/slicetest"
+)
+
+func TestZipWithIndex(t *testing.T) {
+	const N = 1000
+	keys := make([]string, N)
+	vals := make([]int, N)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+		vals[i] = i
+	}
+	for nshard := 1; nshard < 8; nshard += 3 {
+		slice := bigslice.Const(nshard, keys, vals)
+		slice = bigslice.ZipWithIndex(slice)
+		var (
+			gotVals    []int
+			gotIndices []int64
+		)
+		slicetest.RunAndScan(t, slice, new([]string), &gotVals, &gotIndices)
+		if got, want := len(gotIndices), N; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		// Const shards its rows contiguously, so the rows' indices are
+		// their values.
+		for i := range gotVals {
+			if got, want := gotIndices[i], int64(gotVals[i]); got != want {
+				t.Errorf("nshard %d: row %d: got %v, want %v", nshard, gotVals[i], got, want)
+			}
+		}
+	}
+	// Empty shards do not consume indices.
+	slice := bigslice.Const(4, []string{"a", "b"})
+	slice = bigslice.ZipWithIndex(slice)
+	assertEqual(t, slice, true, []string{"a", "b"}, []int64{0, 1})
+}
+
+func TestZipWithUniqueID(t *testing.T) {
+	const N = 1000
+	vals := make([]int, N)
+	for i := range vals {
+		vals[i] = i
+	}
+	for nshard := 1; nshard < 8; nshard += 3 {
+		slice := bigslice.Const(nshard, vals)
+		slice = bigslice.ZipWithUniqueID(slice)
+		var (
+			gotVals []int
+			gotIDs  []int64
+		)
+		slicetest.RunAndScan(t, slice, &gotVals, &gotIDs)
+		if got, want := len(gotIDs), N; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		ids := make(map[int64]bool)
+		for i, id := range gotIDs {
+			if ids[id] {
+				t.Errorf("nshard %d: duplicate id %d", nshard, id)
+			}
+			ids[id] = true
+			// Const shards its rows contiguously, in shards of size
+			// N/nshard+1.
+			shardn := N/nshard + 1
+			shard, row := gotVals[i]/shardn, gotVals[i]%shardn
+			if got, want := id, int64(row*nshard+shard); got != want {
+				t.Errorf("nshard %d: row %d: got %v, want %v", nshard, gotVals[i], got, want)
+			}
+		}
+	}
+}